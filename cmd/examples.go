@@ -0,0 +1,343 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/examples"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+func init() {
+	examples.Register("version",
+		examples.Example{Line: "tg version", Description: "Show the installed and latest available versions"},
+		examples.Example{Line: "tg version --short", Description: "Print only the installed version number, for scripts"},
+	)
+
+	examples.Register("cloud login",
+		examples.Example{Line: "tg cloud login", Description: "Log in with interactive prompts"},
+		examples.Example{Line: "tg cloud login -e user@domain.com -p secret -s", Description: "Log in and save the credentials"},
+		examples.Example{Line: "tg cloud login -e user@domain.com -p secret -o json", Description: "Log in and print the result as JSON"},
+	)
+	examples.Register("cloud start",
+		examples.Example{Line: "tg cloud start -i INSTANCE_ID", Description: "Start a cloud instance"},
+		examples.Example{Line: "tg cloud start -i INSTANCE_ID --events", Description: "Stream JSON Lines progress events for scripts"},
+		examples.Example{Line: "tg cloud start -i @2", Description: "Start the machine in row 2 of the last list"},
+		examples.Example{Line: "tg cloud start --id-file instances.txt", Description: "Start every instance listed in a file, after one confirmation"},
+	)
+	examples.Register("cloud stop",
+		examples.Example{Line: "tg cloud stop -i INSTANCE_ID", Description: "Stop a cloud instance"},
+		examples.Example{Line: "tg cloud stop -i last", Description: "Stop the machine you last operated on"},
+		examples.Example{Line: "tg cloud stop --id-file instances.txt", Description: "Review and stop every instance listed in a file"},
+		examples.Example{Line: "tg cloud stop", Description: "Pick the running instances to stop on the terminal"},
+	)
+	examples.Register("cloud terminate",
+		examples.Example{Line: "tg cloud terminate -i INSTANCE_ID", Description: "Terminate a cloud instance"},
+		examples.Example{Line: "tg cloud terminate --id-file instances.txt -y", Description: "Terminate every listed instance without the confirmation prompt"},
+		examples.Example{Line: "tg cloud terminate -i INSTANCE_ID --param force=true", Description: "Pass a tgcloud option tg has no flag for as a query parameter"},
+	)
+	examples.Register("cloud archive",
+		examples.Example{Line: "tg cloud archive -i INSTANCE_ID", Description: "Archive a cloud instance"},
+		examples.Example{Line: "tg cloud archive -i INSTANCE_ID -y", Description: "Archive without the confirmation prompt"},
+		examples.Example{Line: "tg cloud archive -i INSTANCE_ID --param snapshot=true", Description: "Add a query parameter to the archive request"},
+	)
+	examples.Register("cloud unarchive",
+		examples.Example{Line: "tg cloud unarchive -i INSTANCE_ID", Description: "Restore an archived instance"},
+		examples.Example{Line: "tg cloud unarchive -i INSTANCE_ID -y --wait --wait-timeout 1h", Description: "Restore and wait until it is usable"},
+	)
+	examples.Register("cloud list",
+		examples.Example{Line: "tg cloud list", Description: "List active instances"},
+		examples.Example{Line: "tg cloud list --include-terminated -o json", Description: "List every instance, including terminated ones, as JSON"},
+		examples.Example{Line: "tg cloud list --columns name,state,id", Description: "Choose the table columns"},
+		examples.Example{Line: "tg cloud list --archived-only", Description: "Only show archived instances"},
+		examples.Example{Line: "tg cloud list --group-by state", Description: "One table per state, with counts"},
+		examples.Example{Line: "tg cloud list --state ready --older-than 7d", Description: "Find ready instances created more than a week ago"},
+		examples.Example{Line: "tg cloud list --stale -o json", Description: "Instances created over 7 days ago, as JSON"},
+		examples.Example{Line: "tg cloud list --state ready --count", Description: "Print how many instances are ready"},
+		examples.Example{Line: "tg cloud list --context customerB", Description: "List using another context's output preference"},
+		examples.Example{Line: "tg cloud list -o json --json-pretty", Description: "Indented JSON, for reading at the terminal"},
+		examples.Example{Line: "tg cloud list -o json --out-file solutions.json", Description: "Write the JSON list to a file, replaced only if the listing succeeds; errors and warnings stay on stderr"},
+	)
+	examples.Register("cloud apply",
+		examples.Example{Line: "tg cloud apply < plan.ndjson", Description: "Run a plan of start/stop/terminate lines and print one result per line"},
+		examples.Example{Line: "tg cloud apply -f plan.ndjson --dry-run", Description: "Check a plan and show what each line would do"},
+		examples.Example{Line: "tg cloud apply -f plan.ndjson --parallel 8 --fail-fast", Description: "Act on eight instances at a time and stop at the first failure"},
+	)
+	examples.Register("cloud wait",
+		examples.Example{Line: "tg cloud wait -i INSTANCE_ID", Description: "Block until an instance is running"},
+		examples.Example{Line: "tg cloud wait -i last --state stopped --timeout 10m", Description: "Wait up to 10 minutes for the last instance to stop"},
+	)
+	examples.Register("cloud create",
+		examples.Example{Line: "tg cloud create -i STARTER_KIT_ID", Description: "Create an instance from a starter kit"},
+	)
+	examples.Register("cloud export-inventory",
+		examples.Example{Line: "tg cloud export-inventory > inventory.json", Description: "Export every solution, keyed by name"},
+		examples.Example{Line: "tg cloud export-inventory --key id --tf-resource tgcloud_solution", Description: "Key by ID and write Terraform import blocks to imports.tf"},
+		examples.Example{Line: "tg cloud export-inventory --tf-resource tgcloud_solution --tf-format command", Description: "Write terraform import command lines to imports.sh"},
+	)
+
+	examples.Register("server gsql",
+		examples.Example{Line: "tg server gsql -a myserver", Description: "Open a GSQL shell on a saved alias"},
+		examples.Example{Line: "tg server gsql -u tigergraph -p secret --host http://server --gsPort 14240", Description: "Connect with explicit credentials"},
+		examples.Example{Line: "tg server gsql --no-alias --host http://10.0.0.5", Description: "Ignore the default alias and connect to another host"},
+		examples.Example{Line: "tg server gsql -a myserver --version-range 3.5.0-3.6.2", Description: "Only probe the GSQL versions you run"},
+		examples.Example{Line: "tg server gsql -a myserver --session-cache", Description: "Reuse the login from a previous invocation"},
+		examples.Example{Line: "tg server gsql -a myserver --logout", Description: "Forget the cached login"},
+		examples.Example{Line: "tg server gsql -a myserver --capture session.log", Description: "Record the session, statements and output, to a file"},
+		examples.Example{Line: "tg server gsql -a prod --allow-concurrent", Description: "Open a second shell to prod without the concurrent-session warning"},
+		examples.Example{Line: "tg server gsql -a myserver --no-login-check --cookie @session.json -c ls", Description: "Run a command with a session obtained elsewhere, without logging in"},
+		examples.Example{Line: "tg server gsql -a myserver --auto-scheme", Description: "Use https:// if the alias says http:// but the port speaks TLS"},
+		examples.Example{Line: "tg server gsql -a prod --prompt \"{alias}/{graph} > \"", Description: "Show the alias and current graph in the prompt"},
+		examples.Example{Line: "tg server gsql -a prod --init-file analytics.gsql --strict-init", Description: "Run SET and USE GRAPH statements after login, exiting if they fail"},
+		examples.Example{Line: "tg server gsql -a myserver -c ls", Description: "Run one GSQL command and exit"},
+		examples.Example{Line: "tg server gsql -a myserver --file schema.gsql", Description: "Run a file of GSQL and exit"},
+		examples.Example{Line: "tg server gsql -a prod --file - < loadjobs.gsql", Description: "Stream GSQL from stdin and exit"},
+		examples.Example{Line: "tg server gsql -a prod -f schema.gsql -f loadjobs.gsql -f queries.gsql --continue-on-error", Description: "Run several files in order in one session, going on past failures"},
+		examples.Example{Line: "tg server gsql -a myserver -c \"SHOW USER\" --format csv", Description: "Print the result tables as CSV; other output goes to stderr"},
+		examples.Example{Line: "tg server gsql -a myserver --file report.gsql --format tsv --out-prefix report", Description: "Write each result table to report1.tsv, report2.tsv, ..."},
+		examples.Example{Line: "tg server gsql -a myserver -c \"RUN QUERY everything()\" --max-response-size 512MB", Description: "Fail instead of reading more than 512MB of output"},
+	)
+	examples.Register("server ping",
+		examples.Example{Line: "tg server ping -a prod -c 5", Description: "Time five echo requests and show min/avg/max/p95 latency"},
+		examples.Example{Line: "tg server ping -a prod -o json", Description: "Print the latency summary as JSON for monitoring"},
+		examples.Example{Line: "tg server ping -a prod --strict --allow-warning deprecated-flag", Description: "Fail on any warning but deprecated flags, for CI"},
+	)
+	examples.Register("server backup",
+		examples.Example{Line: "tg server backup -a myserver -t ALL", Description: "Back up schema and data"},
+		examples.Example{Line: "tg server backup -a myserver -t SCHEMA", Description: "Back up the schema only"},
+		examples.Example{Line: "tg server backup -a myserver --events", Description: "Stream progress events on stdout, human output on stderr"},
+		examples.Example{Line: "tg server backup --local -t DATA --tag nightly", Description: "Run gbar backup on this TigerGraph node"},
+	)
+	examples.Register("server services",
+		examples.Example{Line: "tg server services --ops start", Description: "Start GPE, GSE and RESTPP"},
+		examples.Example{Line: "tg server services -a prod --ops stop", Description: "Stop the services of a saved alias"},
+		examples.Example{Line: "tg server services --ops ensure-started --wait-timeout 5m -o json", Description: "Start only what is down and wait for it"},
+		examples.Example{Line: "tg server services --local --ops stop", Description: "Stop the services with gadmin on this TigerGraph node"},
+		examples.Example{Line: "tg server services --ops ensure-started --trace", Description: "Export an OpenTelemetry trace of the run to OTEL_EXPORTER_OTLP_ENDPOINT"},
+	)
+	examples.Register("server clear-graph",
+		examples.Example{Line: "tg server clear-graph -a dev -g social", Description: "Delete all data of social, keeping its schema, after confirming"},
+		examples.Example{Line: "tg server clear-graph -a dev -g social --all-graphs -y", Description: "Clear a server with several graphs without the prompt"},
+	)
+	examples.Register("server install-dir",
+		examples.Example{Line: "tg server install-dir", Description: "Print the root of the TigerGraph installation on this machine"},
+		examples.Example{Line: "tg server install-dir -o json", Description: "Also show the app root and where the installation was found"},
+	)
+	examples.Register("server graphs",
+		examples.Example{Line: "tg server graphs -a prod", Description: "List the graphs on a server"},
+		examples.Example{Line: "tg server graphs -a prod --cache-ttl 30s -o json", Description: "Reuse the list for 30 seconds across runs, as JSON"},
+		examples.Example{Line: "tg server graphs -a prod --graph 'cust_*' --exclude-graph cust_test", Description: "List only the graphs a selection picks"},
+	)
+	examples.Register("server queries show",
+		examples.Example{Line: "tg server queries show friends -a dev -g social", Description: "Print an installed query"},
+		examples.Example{Line: "tg server queries show friends -a prod -g social --compare-file queries/friends.gsql", Description: "Show how the installed query differs from the repo; exits 1 on drift"},
+		examples.Example{Line: "tg server queries show friends -a prod -g social --compare-file queries/friends.gsql -o json", Description: "The differences as a JSON list of hunks"},
+	)
+	examples.Register("server query",
+		examples.Example{Line: "tg server query friends -a dev -g social --param p:VERTEX=Person:alice --param depth=2", Description: "Run an installed query with a vertex and an int parameter"},
+		examples.Example{Line: "tg server query lookup -a dev -g social --param zip:STRING=02134 --param ids:SET<INT>=7", Description: "Send 02134 as a string and ids as a set of one int"},
+	)
+
+	examples.Register("conf add",
+		examples.Example{Line: "tg conf add -a production -u tigergraph -p secret --host https://cluster.i.tgcloud.io -d", Description: "Save a server alias and make it the default"},
+	)
+	examples.Register("conf update",
+		examples.Example{Line: "tg conf update -a production --host https://cluster.i.tgcloud.io", Description: "Change an alias's host, keeping its other settings"},
+		examples.Example{Line: "tg conf update -a production --gsPort 443 --dry-run", Description: "Preview the change to config.yml without saving it"},
+	)
+	examples.Register("conf delete",
+		examples.Example{Line: "tg conf delete -a myserver", Description: "Move a server alias to the trash"},
+		examples.Example{Line: "tg conf delete -a myserver --purge", Description: "Remove a server alias permanently"},
+		examples.Example{Line: "tg conf delete -a myserver --dry-run", Description: "Show what deleting the alias would change in config.yml"},
+	)
+	examples.Register("conf restore",
+		examples.Example{Line: "tg conf restore -a myserver", Description: "Bring back an alias deleted in the last 30 days"},
+	)
+	examples.Register("conf list",
+		examples.Example{Line: "tg conf list", Description: "Show the configured aliases and tgcloud account"},
+		examples.Example{Line: "tg conf list --config-format toml", Description: "Use ~/.tgcli/config.toml instead of the YAML config"},
+		examples.Example{Line: "tg conf list --show-tokens", Description: "Also check whether the stored tgcloud token is still valid"},
+		examples.Example{Line: "tg conf list --trashed", Description: "Show deleted aliases and when they will be purged"},
+		examples.Example{Line: "tg conf list --sort host", Description: "Order aliases by host instead of name"},
+	)
+	examples.Register("conf tgcloud",
+		examples.Example{Line: "tg conf tgcloud -e user@domain.com -p secret", Description: "Verify and save tgcloud credentials"},
+		examples.Example{Line: "tg conf tgcloud --token - --validate", Description: "Store a tgcloud token read from stdin once tgcloud accepts it"},
+	)
+	examples.Register("context use",
+		examples.Example{Line: "tg context use customerA", Description: "Make customerA the current context"},
+		examples.Example{Line: "tg context use --unset", Description: "Go back to the top-level settings"},
+	)
+	examples.Register("context list",
+		examples.Example{Line: "tg context list", Description: "List contexts, marking the current one"},
+	)
+	examples.Register("context show",
+		examples.Example{Line: "tg context show", Description: "Show the current context's settings"},
+		examples.Example{Line: "tg context show customerB", Description: "Show another context without switching"},
+	)
+	examples.Register("context current",
+		examples.Example{Line: "tg context current", Description: "Print the current context name for scripts and prompts"},
+	)
+	examples.Register("conf doctor",
+		examples.Example{Line: "tg conf doctor", Description: "List configuration problems and proposed fixes"},
+		examples.Example{Line: "tg conf doctor --fix --only dangling-default", Description: "Apply one kind of fix"},
+		examples.Example{Line: "tg conf doctor -o json", Description: "Emit check results as JSON for monitoring"},
+	)
+
+	examples.Register("upgrade",
+		examples.Example{Line: "tg upgrade", Description: "Install the latest release after checking its signature"},
+		examples.Example{Line: "tg upgrade --version v0.2.0", Description: "Install a specific release"},
+		examples.Example{Line: "tg upgrade --restart", Description: "Start an interrupted download over instead of resuming it"},
+	)
+
+	examples.Register("history list",
+		examples.Example{Line: "tg history list --alias prod --since 30d", Description: "What was run against prod in the last 30 days"},
+		examples.Example{Line: "tg history list -o json", Description: "The whole history as JSON"},
+	)
+	examples.Register("history show",
+		examples.Example{Line: "tg history show 42", Description: "Show entry 42 with its flags and exit status"},
+		examples.Example{Line: "tg history show last", Description: "Show the last recorded command"},
+	)
+	examples.Register("history rerun",
+		examples.Example{Line: "tg history rerun 42", Description: "Run entry 42 again after confirmation"},
+		examples.Example{Line: "tg history rerun 42 -y -- --password secret", Description: "Rerun without the prompt, giving the password that was not stored"},
+	)
+	examples.Register("debug capture",
+		examples.Example{Line: "tg debug capture -- cloud list", Description: "Save the requests, responses and output of tg cloud list for a bug report"},
+		examples.Example{Line: "tg debug capture --review -- server ping -a prod", Description: "Capture, then list every captured URL to check before sharing"},
+	)
+	examples.Register("debug replay",
+		examples.Example{Line: "tg debug replay capture-20240301-120000.tar.gz", Description: "Reproduce a reported capture without the network"},
+	)
+	examples.Register("dev sandbox",
+		examples.Example{Line: "tg dev sandbox", Description: "Run a TigerGraph container and register the alias sandbox for it"},
+		examples.Example{Line: "tg dev sandbox --gs-port 24240 --rest-port 29000", Description: "Use other host ports when the defaults are taken"},
+		examples.Example{Line: "tg dev sandbox --destroy", Description: "Remove the sandbox container and its alias"},
+	)
+	examples.Register("plugin list",
+		examples.Example{Line: "tg plugin list", Description: "Show the tg-<name> plugins on PATH and their versions"},
+		examples.Example{Line: "tg plugin list -o json", Description: "List the plugins as JSON"},
+	)
+	examples.Register("docs gsql",
+		examples.Example{Line: "tg docs gsql accum", Description: "Show the accumulator types and how to declare them"},
+		examples.Example{Line: "tg docs gsql loading job --gsql-version 3.9", Description: "Show the loading job USING options for TigerGraph 3.x"},
+		examples.Example{Line: "tg docs gsql", Description: "List the topics"},
+	)
+
+	examples.Register("examples",
+		examples.Example{Line: "tg examples cloud list", Description: "Show the examples for a command"},
+	)
+}
+
+// applyExamples fills cobra's Example field from the registry for every
+// command in the tree.
+func applyExamples(root *cobra.Command) {
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		if registered := examples.For(commandPath(cmd)); len(registered) > 0 {
+			cmd.Example = examples.Format(registered)
+		}
+		for _, child := range cmd.Commands() {
+			walk(child)
+		}
+	}
+	walk(root)
+}
+
+// commandPath returns the path of cmd below the root, e.g. "cloud list".
+func commandPath(cmd *cobra.Command) string {
+	path := cmd.CommandPath()
+	if root := cmd.Root(); root != nil {
+		path = strings.TrimPrefix(strings.TrimPrefix(path, root.Name()), " ")
+	}
+	return path
+}
+
+func createExamplesCmd() *cobra.Command {
+	var examplesCmd = &cobra.Command{
+		Use:   "examples [command]",
+		Short: "Show usage examples for a command",
+		Run: func(cmd *cobra.Command, args []string) {
+			path := strings.Join(args, " ")
+			if path == "" {
+				fmt.Fprintln(helpers.Stdout(), "Commands with examples:")
+				for _, registered := range examples.Paths() {
+					fmt.Fprintf(helpers.Stdout(), "  %s\n", registered)
+				}
+				return
+			}
+
+			registered := examples.For(path)
+			if len(registered) == 0 {
+				fmt.Fprintf(helpers.Stdout(), "No examples for '%s'. Try: tg examples\n", path)
+				helpers.Fail(helpers.ExitFailure)
+				return
+			}
+			if examples.UseColor() {
+				fmt.Fprint(helpers.Stdout(), examples.Highlight(registered))
+			} else {
+				fmt.Fprintln(helpers.Stdout(), strings.TrimLeft(strings.ReplaceAll(examples.Format(registered), "\n  ", "\n"), " "))
+			}
+		},
+	}
+
+	// check only parses the examples; it runs none of them, so it catches
+	// renamed commands and flags but not examples that would fail.
+	var checkCmd = &cobra.Command{
+		Use:    "check",
+		Short:  "Check that every registered example still parses, without running any",
+		Hidden: true,
+		Args:   cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			failures := validateExamples()
+			for _, failure := range failures {
+				fmt.Fprintln(helpers.Stdout(), failure)
+			}
+			if len(failures) > 0 {
+				helpers.Exit(1)
+			}
+			fmt.Fprintln(helpers.Stdout(), "All examples parse")
+		},
+	}
+	examplesCmd.AddCommand(checkCmd)
+	return examplesCmd
+}
+
+// validateExamples resolves every registered example against a fresh
+// command tree and parses its flags without running it. It returns one
+// message per broken example.
+func validateExamples() []string {
+	var failures []string
+	for _, path := range examples.Paths() {
+		for _, example := range examples.For(path) {
+			if err := validateExample(path, example); err != nil {
+				failures = append(failures, fmt.Sprintf("%s: %q: %v", path, example.Line, err))
+			}
+		}
+	}
+	return failures
+}
+
+func validateExample(path string, example examples.Example) error {
+	args, err := examples.SplitArgs(example.Line)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 || args[0] != "tg" {
+		return fmt.Errorf("example must start with 'tg'")
+	}
+
+	root := newRootCmd()
+	cmd, rest, err := root.Find(args[1:])
+	if err != nil {
+		return err
+	}
+	if got := commandPath(cmd); got != path {
+		return fmt.Errorf("resolves to '%s', registered under '%s'", got, path)
+	}
+	if err := cmd.ParseFlags(rest); err != nil {
+		return err
+	}
+	return cmd.ValidateArgs(cmd.Flags().Args())
+}
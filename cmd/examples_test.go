@@ -0,0 +1,61 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/examples"
+)
+
+func TestRegisteredExamplesParse(t *testing.T) {
+	for _, failure := range validateExamples() {
+		t.Error(failure)
+	}
+}
+
+func TestEveryCommandHasExamples(t *testing.T) {
+	var walk func(cmd *cobra.Command)
+	walk = func(cmd *cobra.Command) {
+		if cmd.Runnable() && !cmd.Hidden && cmd.HasParent() && cmd.Name() != "help" {
+			if cmd.Example == "" {
+				t.Errorf("Command '%s' has no registered examples", commandPath(cmd))
+			}
+		}
+		for _, child := range cmd.Commands() {
+			walk(child)
+		}
+	}
+	walk(newRootCmd())
+}
+
+func TestValidateExampleRejectsBrokenLines(t *testing.T) {
+	tests := []struct {
+		path     string
+		line     string
+		expected string
+	}{
+		{"cloud list", "tgcli cloud list", "must start with 'tg'"},
+		{"cloud list", "tg cloud list --no-such-flag", "unknown flag"},
+		{"cloud list", "tg cloud start -i X", "registered under"},
+		{"cloud list", `tg cloud list --columns "name`, "unterminated quote"},
+	}
+
+	for _, tt := range tests {
+		err := validateExample(tt.path, examples.Example{Line: tt.line})
+		if err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("validateExample(%q) = %v, expected error containing %q", tt.line, err, tt.expected)
+		}
+	}
+}
+
+func TestCommandPath(t *testing.T) {
+	rootCmd := newRootCmd()
+	cmd, _, err := rootCmd.Find([]string{"conf", "doctor"})
+	if err != nil {
+		t.Fatalf("Failed to find conf doctor: %v", err)
+	}
+	if got := commandPath(cmd); got != "conf doctor" {
+		t.Errorf("Expected 'conf doctor', got '%s'", got)
+	}
+}
@@ -5,62 +5,217 @@ import (
 	"log"
 	"os"
 	"path/filepath"
+	"strings"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/capture"
 	"github.com/zrougamed/tgCli/internal/cloud"
 	"github.com/zrougamed/tgCli/internal/config"
+	"github.com/zrougamed/tgCli/internal/dev"
+	"github.com/zrougamed/tgCli/internal/docs"
 	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/history"
 	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/plugin"
 	"github.com/zrougamed/tgCli/internal/server"
+	"github.com/zrougamed/tgCli/internal/telemetry"
+	"github.com/zrougamed/tgCli/internal/upgrade"
 	"github.com/zrougamed/tgCli/pkg/constants"
 )
 
+// configFormat is set by --config-format. When empty the format is taken
+// from whichever config file exists.
+var configFormat string
+
+// outputFile is set by --out-file (or its older name --output-file);
+// redirectedOutput holds the command's output until it has run.
+var (
+	outputFile       string
+	redirectedOutput *helpers.OutFile
+)
+
+// traceRun is set by --trace.
+var traceRun bool
+
+// commandHistory records the command for tg history once it has run.
+var commandHistory *history.Recorder
+
+// strictRun and allowedWarnings are set by --strict and --allow-warning.
+var (
+	strictRun       bool
+	allowedWarnings []string
+)
+
 func init() {
 	var err error
-	constants.HomeDir, err = os.UserHomeDir()
+	constants.HomeDir, constants.ConfigDir, err = resolveConfigDir()
 	if err != nil {
-		log.Fatal("Unable to get user home directory:", err)
+		log.Printf("Warning: %v", err)
 	}
 
-	constants.ConfigDir = filepath.Join(constants.HomeDir, ".tgcli")
 	constants.ConfigFile = filepath.Join(constants.ConfigDir, "config.yml")
 	constants.CredsFile = filepath.Join(constants.ConfigDir, "creds.bank")
 
-	// Create config directory if it doesn't exist
+	// Create config directory if it doesn't exist. Commands that need
+	// stored state report their own errors if this fails.
 	if err := os.MkdirAll(constants.ConfigDir, 0755); err != nil {
-		log.Fatal("Unable to create config directory:", err)
+		log.Printf("Warning: unable to create config directory: %v", err)
 	}
 
-	// Initialize viper
-	viper.SetConfigName("config")
-	viper.SetConfigType("yaml")
-	viper.AddConfigPath(constants.ConfigDir)
-
 	// Set defaults
 	viper.SetDefault("tgcloud.user", "mail@domain.com")
 	viper.SetDefault("tgcloud.password", "")
 	viper.SetDefault("machines", make(map[string]models.MachineConfig))
 	viper.SetDefault("default", "")
+}
+
+// resolveConfigDir returns the home directory and the directory holding
+// config and credentials: $TGCLI_HOME when set, otherwise ~/.tgcli. When
+// there is no home directory it falls back to a per-user temporary
+// directory and returns an error describing the fallback.
+func resolveConfigDir() (string, string, error) {
+	homeDir, homeErr := os.UserHomeDir()
+	if override := os.Getenv("TGCLI_HOME"); override != "" {
+		return homeDir, override, nil
+	}
+	if homeErr == nil {
+		return homeDir, filepath.Join(homeDir, ".tgcli"), nil
+	}
 
-	// Try to read config file
-	if err := viper.ReadInConfig(); err != nil {
-		if _, ok := err.(viper.ConfigFileNotFoundError); ok {
-			// Config file not found, create default
-			helpers.CreateDefaultConfig(constants.ConfigFile)
-		} else {
-			log.Printf("Error reading config file: %v", err)
+	fallback := filepath.Join(os.TempDir(), fmt.Sprintf("tgcli-%d", os.Getuid()))
+	return "", fallback, fmt.Errorf("home directory unavailable (%v); using %s, set TGCLI_HOME to choose another location", homeErr, fallback)
+}
+
+// initConfig reads the config file once flags are parsed, creating a
+// default one in the selected format if none exists.
+func initConfig() {
+	configFile, err := helpers.FindConfigFile(constants.ConfigDir, configFormat)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	constants.ConfigFile = configFile
+
+	viper.SetConfigFile(configFile)
+	viper.SetConfigType(helpers.ConfigFormat(configFile))
+
+	if _, err := os.Stat(configFile); os.IsNotExist(err) {
+		helpers.CreateDefaultConfig(configFile)
+	} else if err := viper.ReadInConfig(); err != nil {
+		log.Printf("Error reading config file: %v", err)
+	}
+	if err := helpers.CheckFeatures(); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	helpers.LoadPasswords()
+
+	if baseURL := viper.GetString("tgcloud.base_url"); baseURL != "" {
+		constants.TGCLOUD_BASE_URL = strings.TrimRight(baseURL, "/")
+	}
+
+	if constants.Context != "" {
+		if _, err := helpers.LookupContext(constants.Context); err != nil {
+			fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+			helpers.Exit(1)
+		}
+	}
+
+	if outputFile != "" {
+		redirectedOutput, err = helpers.OpenOutFile(outputFile)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			helpers.Exit(1)
 		}
 	}
 }
 
+// commandArgs returns the arguments root runs with: args with the legacy
+// y/n forms of boolean flags rewritten. A plugin parses its own arguments,
+// so they are passed on as given.
+func commandArgs(root *cobra.Command, args []string) []string {
+	if cmd, _, err := root.Find(args); err == nil && cmd.GroupID == plugin.GroupID {
+		return args
+	}
+	return helpers.NormalizeLegacyBoolArgs(args)
+}
+
 func main() {
+	helpers.HoldWarnings()
 	helpers.GracefulShutdown()
-	availableVersion, err := helpers.CheckForUpdates()
+	cobra.OnInitialize(initConfig)
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs(commandArgs(rootCmd, os.Args[1:]))
+	err := rootCmd.Execute()
+	// Commands that never ran, such as --help, still show held warnings.
+	helpers.ConfigureWarnings(false, nil)
 	if err != nil {
-		log.Printf("Error checking for updates: %v", err)
-		availableVersion = "N/A"
+		redirectedOutput.Discard()
+		fmt.Fprintln(helpers.Stdout(), err)
+		helpers.Exit(1)
+	}
+	// Handlers report a failure with helpers.Fail and return.
+	if code := helpers.ExitStatus(); code != 0 {
+		redirectedOutput.Discard()
+		helpers.Exit(code)
+	}
+	if err := redirectedOutput.Commit(); err != nil {
+		fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", outputFile, err)
+		helpers.Exit(1)
 	}
+	capture.Flush(0)
+	commandHistory.Finish(0)
+	telemetry.Shutdown(0)
+}
+
+// checkAliasCollisions stops commands when the config file has aliases that
+// differ only by case, which viper merges into one entry unpredictably.
+// conf doctor still runs so it can report them.
+func checkAliasCollisions(cmd *cobra.Command) {
+	if cmd.CommandPath() == "tg conf doctor" {
+		return
+	}
+	if groups := helpers.ConfigAliasCollisions(constants.ConfigFile); len(groups) > 0 {
+		fmt.Fprintf(helpers.Stdout(), "Error: %s has aliases that differ only by case: %s. Aliases are case-insensitive; rename or remove all but one of each (see tg conf doctor)\n",
+			constants.ConfigFile, helpers.DescribeAliasCollisions(groups))
+		helpers.Exit(1)
+	}
+}
+
+// startTracing traces the run of cmd when an OTLP endpoint is set in the
+// environment and --trace or telemetry.traces asks for it.
+func startTracing(cmd *cobra.Command) {
+	if !traceRun && !viper.GetBool("telemetry.traces") {
+		return
+	}
+	exporter, ok := telemetry.FromEnv()
+	if !ok {
+		if traceRun {
+			helpers.Warn(helpers.WarnTraceDisabled, "--trace needs OTEL_EXPORTER_OTLP_ENDPOINT to be set; not tracing")
+		}
+		return
+	}
+	helpers.WrapTransport = telemetry.Transport
+	telemetry.Start(cmd.CommandPath(), exporter, telemetry.String("tg.command", cmd.CommandPath()))
+}
+
+// completeAliases offers the configured aliases for --alias.
+func completeAliases(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return helpers.ConfiguredAliases(), cobra.ShellCompDirectiveNoFileComp
+}
+
+// completeTrashedAliases offers the aliases tg conf restore can bring back.
+func completeTrashedAliases(cmd *cobra.Command, args []string, toComplete string) ([]string, cobra.ShellCompDirective) {
+	return helpers.SortedAliases(helpers.TrashedMachines()), cobra.ShellCompDirectiveNoFileComp
+}
+
+// checkForUpdates looks up the version tg version offers; tests replace it.
+var checkForUpdates = helpers.CheckForUpdates
+
+// newRootCmd assembles the full command tree.
+func newRootCmd() *cobra.Command {
 	var rootCmd = &cobra.Command{
 		Use:   "tg",
 		Short: "TigerGraph CLI tool for cloud and server management",
@@ -68,36 +223,73 @@ func main() {
 		Run: func(cmd *cobra.Command, args []string) {
 			cmd.Help()
 		},
+		PersistentPreRun: func(cmd *cobra.Command, args []string) {
+			if err := helpers.ConfigureWarnings(strictRun || viper.GetBool("strict"), allowedWarnings); err != nil {
+				fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+				helpers.Exit(1)
+			}
+			checkAliasCollisions(cmd)
+			startTracing(cmd)
+			capture.Start(cmd, args)
+			commandHistory = history.Begin(cmd, args)
+		},
 	}
 
 	// Add global flags
-	rootCmd.PersistentFlags().BoolVarP(&constants.Debug, "debug", "d", false, "Enable debug mode")
+	rootCmd.PersistentFlags().BoolVar(&constants.Debug, "debug", false, "Enable debug mode")
+	rootCmd.PersistentFlags().BoolVar(&constants.JSONPretty, "json-pretty", false, "Indent JSON output for reading; it is compact by default")
+	rootCmd.PersistentFlags().StringVar(&constants.Context, "context", "", "Context to use for this command instead of the current one")
+	rootCmd.PersistentFlags().StringVar(&outputFile, "out-file", "", "Write the command's output to this file instead of stdout, replacing it only if the command succeeds; diagnostics stay on stderr")
+	rootCmd.PersistentFlags().StringVar(&outputFile, "output-file", "", "Same as --out-file")
+	rootCmd.PersistentFlags().MarkHidden("output-file")
+	rootCmd.PersistentFlags().BoolVar(&strictRun, "strict", false, "Fail with exit code 4 on any warning, for CI (or set strict: true in the config)")
+	rootCmd.PersistentFlags().StringSliceVar(&allowedWarnings, "allow-warning", nil, "Warning ID that --strict lets through; repeat or separate with commas")
+	rootCmd.PersistentFlags().BoolVar(&traceRun, "trace", false, "Export an OpenTelemetry trace of this command to OTEL_EXPORTER_OTLP_ENDPOINT")
+	rootCmd.PersistentFlags().StringVar(&configFormat, "config-format", "", "Config file format (yaml/json/toml); detected from the existing config file by default")
 
 	// Add version command
 	var versionCmd = &cobra.Command{
 		Use:   "version",
 		Short: "Show version information",
 		Run: func(cmd *cobra.Command, args []string) {
-			fmt.Printf("TigerGraph CLI\n")
-			fmt.Printf("  Version Installed: %s\n", constants.VERSION_CLI)
-			fmt.Printf("  Version Available: %s\n", availableVersion)
-			fmt.Printf("Support:\n")
-			fmt.Printf("   TigerGraph Community: https://community.tigergraph.com\n")
-			fmt.Printf("   TigerGraph Discord: https://discord.gg/GkEmvDqB\n")
-			fmt.Printf("Copyright (c) 2014-2024 TigerGraph. All rights reserved.\n")
+			if short, _ := cmd.Flags().GetBool("short"); short {
+				fmt.Fprintln(helpers.Stdout(), constants.VERSION_CLI)
+				return
+			}
+			fmt.Fprintf(helpers.Stdout(), "TigerGraph CLI\n")
+			fmt.Fprintf(helpers.Stdout(), "  Version Installed: %s\n", constants.VERSION_CLI)
+			// Only tg version asks GitHub, and at most once a day.
+			availableVersion := checkForUpdates()
+			if availableVersion != "N/A" && availableVersion != constants.VERSION_CLI {
+				availableVersion += " (tg upgrade installs it)"
+			}
+			fmt.Fprintf(helpers.Stdout(), "  Version Available: %s\n", availableVersion)
+			fmt.Fprintf(helpers.Stdout(), "Support:\n")
+			fmt.Fprintf(helpers.Stdout(), "   TigerGraph Community: https://community.tigergraph.com\n")
+			fmt.Fprintf(helpers.Stdout(), "   TigerGraph Discord: https://discord.gg/GkEmvDqB\n")
+			fmt.Fprintf(helpers.Stdout(), "Copyright (c) 2014-2024 TigerGraph. All rights reserved.\n")
 		},
 	}
 
+	versionCmd.Flags().Bool("short", false, "Print only the installed version number, for scripts")
+
 	// Add subcommands
 	rootCmd.AddCommand(versionCmd)
 	rootCmd.AddCommand(createCloudCmd())
 	rootCmd.AddCommand(createServerCmd())
 	rootCmd.AddCommand(createConfCmd())
-
-	if err := rootCmd.Execute(); err != nil {
-		fmt.Println(err)
-		os.Exit(1)
-	}
+	rootCmd.AddCommand(createContextCmd())
+	rootCmd.AddCommand(createExamplesCmd())
+	rootCmd.AddCommand(createDocsCmd())
+	rootCmd.AddCommand(createHistoryCmd())
+	rootCmd.AddCommand(createDebugCmd())
+	rootCmd.AddCommand(createDevCmd())
+	rootCmd.AddCommand(createUpgradeCmd())
+	rootCmd.AddCommand(createPluginCmd())
+
+	applyExamples(rootCmd)
+	plugin.Register(rootCmd)
+	return rootCmd
 }
 
 func createCloudCmd() *cobra.Command {
@@ -115,35 +307,50 @@ func createCloudCmd() *cobra.Command {
 	}
 	loginCmd.Flags().StringP("email", "e", "", "Email address for tgcloud.io")
 	loginCmd.Flags().StringP("password", "p", "", "Password for tgcloud.io")
-	loginCmd.Flags().StringP("save", "s", "n", "Save credentials (y/n)")
+	loginCmd.Flags().BoolP("save", "s", false, "Save credentials to the config file")
 	loginCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
 
 	// Start command
 	var startCmd = &cobra.Command{
-		Use:   "start",
-		Short: "Start a tgcloud instance",
-		Run:   cloud.RunStart,
+		Use:     "start",
+		Short:   "Start a tgcloud instance",
+		PreRunE: cloud.RequireMachineSelection,
+		Run:     cloud.RunStart,
 	}
-	startCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID")
-	startCmd.MarkFlagRequired("id")
+	startCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID, @N for row N of the last list, or last")
+	startCmd.Flags().String("id-file", "", "File listing one machine ID or reference per line, to start them all")
+	startCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt of --id-file")
+	startCmd.MarkFlagsMutuallyExclusive("id", "id-file")
+	startCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	startCmd.Flags().StringArray("param", nil, "Extra query parameter for the tgcloud operation, as key=value; repeat for more")
 
 	// Stop command
 	var stopCmd = &cobra.Command{
-		Use:   "stop",
-		Short: "Stop a tgcloud instance",
-		Run:   cloud.RunStop,
+		Use:     "stop",
+		Short:   "Stop a tgcloud instance",
+		PreRunE: cloud.RequireMachineSelection,
+		Run:     cloud.RunStop,
 	}
-	stopCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID")
-	stopCmd.MarkFlagRequired("id")
+	stopCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID, @N for row N of the last list, or last")
+	stopCmd.Flags().String("id-file", "", "File listing one machine ID or reference per line, to stop them all")
+	stopCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt of --id-file")
+	stopCmd.MarkFlagsMutuallyExclusive("id", "id-file")
+	stopCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	stopCmd.Flags().StringArray("param", nil, "Extra query parameter for the tgcloud operation, as key=value; repeat for more")
 
 	// Terminate command
 	var terminateCmd = &cobra.Command{
-		Use:   "terminate",
-		Short: "Terminate a tgcloud instance",
-		Run:   cloud.RunTerminate,
+		Use:     "terminate",
+		Short:   "Terminate a tgcloud instance",
+		PreRunE: cloud.RequireMachineSelection,
+		Run:     cloud.RunTerminate,
 	}
-	terminateCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID")
-	terminateCmd.MarkFlagRequired("id")
+	terminateCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID, @N for row N of the last list, or last")
+	terminateCmd.Flags().String("id-file", "", "File listing one machine ID or reference per line, to terminate them all")
+	terminateCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt of --id-file")
+	terminateCmd.MarkFlagsMutuallyExclusive("id", "id-file")
+	terminateCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	terminateCmd.Flags().StringArray("param", nil, "Extra query parameter for the tgcloud operation, as key=value; repeat for more")
 
 	// Archive command
 	var archiveCmd = &cobra.Command{
@@ -151,8 +358,25 @@ func createCloudCmd() *cobra.Command {
 		Short: "Archive a tgcloud instance",
 		Run:   cloud.RunArchive,
 	}
-	archiveCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID")
+	archiveCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID, @N for row N of the last list, or last")
 	archiveCmd.MarkFlagRequired("id")
+	archiveCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt")
+	archiveCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	archiveCmd.Flags().StringArray("param", nil, "Extra query parameter for the tgcloud operation, as key=value; repeat for more")
+
+	// Unarchive command
+	var unarchiveCmd = &cobra.Command{
+		Use:   "unarchive",
+		Short: "Restore an archived tgcloud instance",
+		Run:   cloud.RunUnarchive,
+	}
+	unarchiveCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID, @N for row N of the last list, or last")
+	unarchiveCmd.MarkFlagRequired("id")
+	unarchiveCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt")
+	unarchiveCmd.Flags().Bool("wait", false, "Wait until the restore has finished")
+	unarchiveCmd.Flags().Duration("wait-timeout", 30*time.Minute, "How long --wait waits for the restore")
+	unarchiveCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	unarchiveCmd.Flags().StringArray("param", nil, "Extra query parameter for the tgcloud operation, as key=value; repeat for more")
 
 	// List command
 	var listCmd = &cobra.Command{
@@ -160,18 +384,68 @@ func createCloudCmd() *cobra.Command {
 		Short: "List all tgcloud instances",
 		Run:   cloud.RunList,
 	}
+	listCmd.Flags().Bool("include-terminated", false, "Also show terminated solutions")
 	listCmd.Flags().StringP("activeonly", "a", "y", "Hide terminated servers (y/n)")
+	listCmd.Flags().MarkDeprecated("activeonly", "use --include-terminated instead")
 	listCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+	listCmd.Flags().Bool("archived-only", false, "Only show archived solutions")
+	listCmd.Flags().String("group-by", "", "Group solutions by state or tag")
+	listCmd.Flags().String("columns", "", "Table columns: auto, or a list of id,shortid,name,tag,state,created")
+	listCmd.Flags().StringSlice("state", nil, "Only show solutions in these states, e.g. ready,stopped")
+	listCmd.Flags().String("older-than", "", "Only show solutions created at least this long ago, e.g. 7d, 2w or 36h")
+	listCmd.Flags().Bool("stale", false, "Shorthand for --older-than 7d")
+	listCmd.Flags().Bool("count", false, "Only print the number of matching solutions")
 
 	// Create command
 	var createCmd = &cobra.Command{
 		Use:   "create",
 		Short: "Create a tgcloud instance",
+		Long:  `Create a tgcloud instance from a starter kit and print its ID and state. Starter kit IDs are shown on tgcloud.io under Create Solution. Afterwards "last" refers to the new instance, e.g. tg cloud start -i last.`,
 		Run:   cloud.RunCreate,
 	}
-	createCmd.Flags().StringP("id", "i", "", "TGCloud Starter Kit")
+	createCmd.Flags().StringP("id", "i", "", "ID of the starter kit to create the instance from")
+
+	// Wait command
+	var waitCmd = &cobra.Command{
+		Use:   "wait",
+		Short: "Wait until a tgcloud instance reaches a state",
+		Long:  `Poll a tgcloud instance until it reaches --state, e.g. after tg cloud start. "running" also matches the "ready" state tgcloud reports. Exits with status 1 when --timeout elapses first.`,
+		Run:   cloud.RunWait,
+	}
+	waitCmd.Flags().StringP("id", "i", "", "TGCloud Machine ID, @N for row N of the last list, or last")
+	waitCmd.MarkFlagRequired("id")
+	waitCmd.Flags().String("state", "running", "State to wait for, e.g. running, stopped or archived")
+	waitCmd.Flags().Duration("timeout", 300*time.Second, "How long to wait before failing")
+	waitCmd.Flags().Duration("interval", 5*time.Second, "How often to check the state")
+	waitCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+
+	// Export inventory command
+	var exportInventoryCmd = &cobra.Command{
+		Use:   "export-inventory",
+		Short: "Export tgcloud solutions as JSON for infrastructure-as-code imports",
+		Run:   cloud.RunExportInventory,
+	}
+	exportInventoryCmd.Flags().String("key", "name", "Key solutions by name or id")
+	exportInventoryCmd.Flags().Bool("include-terminated", false, "Also export terminated solutions")
+	exportInventoryCmd.Flags().String("tf-resource", "", "Also write Terraform imports for this resource type, e.g. tgcloud_solution")
+	exportInventoryCmd.Flags().String("tf-format", "block", "Terraform import style: block (import {} blocks) or command (terraform import lines)")
+	exportInventoryCmd.Flags().String("tf-file", "", "File for the Terraform imports (default imports.tf, or imports.sh with --tf-format command)")
+
+	// Apply command
+	var applyCmd = &cobra.Command{
+		Use:   "apply",
+		Short: "Run a plan of instance operations read as NDJSON",
+		Long: `Read one action per line, e.g. {"action":"stop","id":"..."} or {"action":"start","name":"..."}, from stdin or --file and write one NDJSON result per line to stdout.
+
+Every line is checked before anything runs; malformed lines are reported with their line numbers. An unknown action or instance only fails its own line unless --fail-fast is given. The command exits 1 unless every line succeeded.`,
+		Run: cloud.RunApply,
+	}
+	applyCmd.Flags().StringP("file", "f", "", "Read the plan from this file instead of stdin")
+	applyCmd.Flags().Int("parallel", 4, "How many instances to act on at once")
+	applyCmd.Flags().Bool("dry-run", false, "Resolve every line and print the results without acting")
+	applyCmd.Flags().Bool("fail-fast", false, "Stop at the first line that fails; the remaining lines are skipped")
 
-	cloudCmd.AddCommand(loginCmd, startCmd, stopCmd, terminateCmd, archiveCmd, listCmd, createCmd)
+	cloudCmd.AddCommand(loginCmd, startCmd, stopCmd, terminateCmd, archiveCmd, unarchiveCmd, listCmd, waitCmd, createCmd, exportInventoryCmd, applyCmd)
 	return cloudCmd
 }
 
@@ -181,6 +455,8 @@ func createServerCmd() *cobra.Command {
 		Short: "TigerGraph Server operations",
 		Long:  `Manage TigerGraph server operations including GSQL, demos, algorithms, and services.`,
 	}
+	serverCmd.PersistentFlags().Bool("auto-scheme", false, "Switch to https:// (or http://) when the server only speaks the other scheme")
+	serverCmd.PersistentFlags().Bool("no-alias", false, "Connect with the connection flags as given instead of the default alias")
 
 	// GSQL command
 	var gsqlCmd = &cobra.Command{
@@ -189,10 +465,34 @@ func createServerCmd() *cobra.Command {
 		Run:   server.RunGSQL,
 	}
 	gsqlCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	gsqlCmd.RegisterFlagCompletionFunc("alias", completeAliases)
 	gsqlCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
 	gsqlCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
 	gsqlCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
 	gsqlCmd.Flags().String("gsPort", "14240", "GSQL Port")
+	gsqlCmd.Flags().Duration("probe-timeout", 5*time.Second, "Timeout for each login version probe")
+	gsqlCmd.Flags().Duration("probe-budget", 30*time.Second, "Overall time allowed for login version probing")
+	gsqlCmd.Flags().String("max-response-size", "1GB", "Stop reading a command's output after this much, e.g. 512MB (0 for no limit)")
+	gsqlCmd.Flags().String("version-range", "", "Only probe GSQL versions in this range, e.g. 3.5.0-3.6.2")
+	gsqlCmd.Flags().Bool("session-cache", false, "Reuse a cached login session and cache new ones")
+	gsqlCmd.Flags().Bool("logout", false, "Clear the cached login session and exit")
+	gsqlCmd.Flags().Bool("no-login-check", false, "Skip the login and version probe and run commands with the session given by --cookie or --token")
+	gsqlCmd.Flags().String("cookie", "", "GSQL session cookie JSON, or @file holding it, for --no-login-check")
+	gsqlCmd.Flags().String("token", "", "Bearer token to send instead of the password, for --no-login-check (or TG_GSQL_TOKEN)")
+	gsqlCmd.MarkFlagsMutuallyExclusive("no-login-check", "session-cache")
+	gsqlCmd.Flags().String("prompt", "", "Prompt template with {alias}, {graph}, {user} and {host}, e.g. \"{alias}/{graph} > \" (default \"GSQL > \", or gsql.prompt in the config)")
+	gsqlCmd.Flags().StringP("command", "c", "", "Run this GSQL command and exit instead of starting a terminal")
+	gsqlCmd.Flags().StringArrayP("file", "f", nil, "Run the GSQL in this file (- for stdin) and exit; repeat to run several files in order in one session")
+	gsqlCmd.Flags().Bool("fail-fast", false, "Stop at the first --file that fails, skipping the rest (the default)")
+	gsqlCmd.Flags().Bool("continue-on-error", false, "Run every --file even if one fails; the exit status is still 1")
+	gsqlCmd.Flags().String("format", "text", "Output format of --command/--file: text, csv or tsv (result tables only)")
+	gsqlCmd.Flags().String("init-file", "", "Run the GSQL in this file after login, before the interactive prompt, e.g. SET or USE GRAPH statements (default: gsql.init-file, or ~/.tgcli/gsqlrc if it exists; \"\" for none)")
+	gsqlCmd.Flags().Bool("allow-concurrent", false, "Skip the warning when another interactive session to the same alias is open")
+	gsqlCmd.Flags().String("capture", "", "Record the interactive session, statements and output, to this file")
+	gsqlCmd.Flags().Bool("strict-init", false, "Exit if the init file fails instead of warning")
+	gsqlCmd.Flags().String("out-prefix", "", "With --format csv/tsv, write each result table to <prefix>N.csv or .tsv")
+	gsqlCmd.MarkFlagsMutuallyExclusive("command", "file")
+	gsqlCmd.MarkFlagsMutuallyExclusive("fail-fast", "continue-on-error")
 
 	// Backup command
 	var backupCmd = &cobra.Command{
@@ -201,12 +501,16 @@ func createServerCmd() *cobra.Command {
 		Run:   server.RunBackup,
 	}
 	backupCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	backupCmd.RegisterFlagCompletionFunc("alias", completeAliases)
 	backupCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
 	backupCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
 	backupCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
 	backupCmd.Flags().String("gsPort", "14240", "GSQL Port")
 	backupCmd.Flags().String("restPort", "9000", "REST Port")
 	backupCmd.Flags().StringP("type", "t", "ALL", "Backup type (ALL/SCHEMA/DATA)")
+	backupCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	backupCmd.Flags().Bool("local", false, "Run gbar backup on this machine instead of going through the server API")
+	backupCmd.Flags().String("tag", "", "Backup tag for --local (default tgcli-<date>-<time>)")
 
 	// Services command
 	var servicesCmd = &cobra.Command{
@@ -214,13 +518,134 @@ func createServerCmd() *cobra.Command {
 		Short: "Start/Stop GPE/GSE/RESTPP Services",
 		Run:   server.RunServices,
 	}
+	servicesCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	servicesCmd.RegisterFlagCompletionFunc("alias", completeAliases)
 	servicesCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
 	servicesCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
 	servicesCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
 	servicesCmd.Flags().String("gsPort", "14240", "GSQL Port")
-	servicesCmd.Flags().String("ops", "start", "Operation (start/stop)")
-
-	serverCmd.AddCommand(gsqlCmd, backupCmd, servicesCmd)
+	servicesCmd.Flags().String("ops", "start", "Operation (start/stop/ensure-started/ensure-stopped)")
+	servicesCmd.Flags().Duration("wait-timeout", 2*time.Minute, "How long ensure-* operations wait for the desired state")
+	servicesCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+	servicesCmd.Flags().Bool("events", false, "Emit JSON Lines progress events on stdout; human output goes to stderr")
+	servicesCmd.Flags().Bool("local", false, "Run gadmin on this machine instead of going through the server API")
+
+	// Ping command
+	var pingCmd = &cobra.Command{
+		Use:   "ping",
+		Short: "Measure request latency to a TigerGraph server",
+		Long:  `Time repeated requests to the RESTPP echo endpoint and report min/avg/max/p95 latency, to tell network slowness from slow queries.`,
+		Run:   server.RunPing,
+	}
+	pingCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	pingCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	pingCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
+	pingCmd.Flags().String("restPort", "9000", "REST Port")
+	pingCmd.Flags().IntP("count", "c", 5, "Number of requests to send")
+	pingCmd.Flags().Duration("timeout", 5*time.Second, "How long to wait for each reply")
+	pingCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+
+	// Clear graph command
+	var clearGraphCmd = &cobra.Command{
+		Use:   "clear-graph",
+		Short: "Delete all data of a graph and keep its schema",
+		Long:  `Run CLEAR GRAPH STORE -HARD after confirmation, deleting all vertices and edges while keeping the schema. The graph store is shared, so when the server has other graphs --all-graphs is required. Aliases and hosts named like production (prod, production, eu-prod, prod-db.example.com, ...) are refused unless --allow-production is given.`,
+		Run:   server.RunClearGraph,
+	}
+	clearGraphCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	clearGraphCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	clearGraphCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
+	clearGraphCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
+	clearGraphCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
+	clearGraphCmd.Flags().String("gsPort", "14240", "GSQL Port")
+	clearGraphCmd.Flags().StringP("graph", "g", "", "Graph to clear")
+	clearGraphCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation")
+	clearGraphCmd.Flags().Bool("all-graphs", false, "Also clear the other graphs on the server, which share the graph store")
+	clearGraphCmd.Flags().Bool("allow-production", false, "Allow clearing an alias or host named like production")
+	clearGraphCmd.MarkFlagRequired("graph")
+
+	// Install dir command
+	var installDirCmd = &cobra.Command{
+		Use:   "install-dir",
+		Short: "Print the root of the TigerGraph installation on this machine",
+		Long:  `Find the TigerGraph installation on this machine, from ~tigergraph/.tg.cfg or else from the log path the server reports, and print its root. This is the installation --local commands use.`,
+		Run:   server.RunInstallDir,
+	}
+	installDirCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to ask for its log path")
+	installDirCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	installDirCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
+	installDirCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
+	installDirCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
+	installDirCmd.Flags().String("gsPort", "14240", "GSQL Port")
+	installDirCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+
+	// Query command
+	var queryCmd = &cobra.Command{
+		Use:   "query NAME",
+		Short: "Run an installed query",
+		Long:  `Run an installed query through RESTPP and print its JSON result. Parameters are given as --param name=value, or name:TYPE=value to send the value as TYPE instead of guessing it from how it looks. Giving a parameter more than once sends a list.`,
+		Args:  cobra.ExactArgs(1),
+		Run:   server.RunQuery,
+	}
+	queryCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	queryCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	queryCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
+	queryCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
+	queryCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
+	queryCmd.Flags().String("gsPort", "14240", "GSQL Port")
+	queryCmd.Flags().StringP("graph", "g", "", "Graph the query is installed on")
+	queryCmd.Flags().StringArray("param", nil, "Query parameter as name=value or name:TYPE=value, repeatable. TYPE is INT, UINT, FLOAT, DOUBLE, BOOL, STRING, DATETIME, VERTEX (value TYPE:ID) or VERTEX<T>, or SET<>, BAG<> or LIST<> of one of them")
+	queryCmd.Flags().Duration("timeout", 60*time.Second, "How long the query may run")
+	queryCmd.MarkFlagRequired("graph")
+
+	// Graphs command
+	var graphsCmd = &cobra.Command{
+		Use:   "graphs",
+		Short: "List the graphs on a server",
+		Long:  `List the graphs on a server, one per line. --cache-ttl (or gsql.cache_ttl in the config) keeps the list on disk and reuses it across runs for that long, keyed by alias, so scripts that ask repeatedly skip the login. --no-cache always asks the server. --graph and --exclude-graph (repeatable, globs like cust_* allowed) narrow the list; a pattern that matches no graph is an error.`,
+		Run:   server.RunGraphs,
+	}
+	graphsCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	graphsCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	graphsCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
+	graphsCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
+	graphsCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
+	graphsCmd.Flags().String("gsPort", "14240", "GSQL Port")
+	graphsCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+	graphsCmd.Flags().Duration("cache-ttl", 0, "Reuse a graph list cached on disk by an earlier run for this long, e.g. 30s (default: gsql.cache_ttl, or no disk cache)")
+	graphsCmd.Flags().Bool("no-cache", false, "Ask the server even if a cached list is available")
+	graphsCmd.Flags().StringArray("graph", nil, "Only list this graph; repeatable, globs like cust_* allowed")
+	graphsCmd.Flags().StringArray("exclude-graph", nil, "Leave out this graph; repeatable, globs allowed")
+	graphsCmd.MarkFlagsMutuallyExclusive("cache-ttl", "no-cache")
+
+	// Queries command
+	var queriesCmd = &cobra.Command{
+		Use:   "queries",
+		Short: "Inspect the queries installed on a server",
+	}
+	var queriesShowCmd = &cobra.Command{
+		Use:   "show NAME",
+		Short: "Show an installed query, or how it differs from a local file",
+		Long: `Print the definition of a query installed on a graph. With --compare-file, compare it with a local .gsql file instead and exit 0 when they match, 1 when they differ and 2 when the comparison could not be made, so CI can gate on drift.
+
+Both sides are normalized first: line endings become \n, tabs become spaces at 4-column stops, trailing whitespace and leading and trailing blank lines are dropped. Only the named query's CREATE statement, up to the brace that closes its body, is compared, with OR REPLACE ignored, so USE GRAPH and INSTALL QUERY lines and other queries in the file do not count.`,
+		Args: cobra.ExactArgs(1),
+		Run:  server.RunQueriesShow,
+	}
+	queriesShowCmd.Flags().StringP("alias", "a", "", "TigerGraph server alias to use")
+	queriesShowCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	queriesShowCmd.Flags().StringP("user", "u", "tigergraph", "TigerGraph user")
+	queriesShowCmd.Flags().StringP("password", "p", "tigergraph", "TigerGraph password")
+	queriesShowCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
+	queriesShowCmd.Flags().String("gsPort", "14240", "GSQL Port")
+	queriesShowCmd.Flags().StringP("graph", "g", "", "Graph the query is installed on")
+	queriesShowCmd.Flags().String("compare-file", "", "Local .gsql file to compare the installed query with")
+	queriesShowCmd.Flags().Int("context", 3, "Unchanged lines shown around each change with --compare-file")
+	queriesShowCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+	queriesShowCmd.MarkFlagRequired("graph")
+	queriesCmd.AddCommand(queriesShowCmd)
+
+	serverCmd.AddCommand(gsqlCmd, backupCmd, servicesCmd, pingCmd, clearGraphCmd, installDirCmd, queryCmd, graphsCmd, queriesCmd)
 	return serverCmd
 }
 
@@ -243,7 +668,24 @@ func createConfCmd() *cobra.Command {
 	addCmd.Flags().String("host", "http://127.0.0.1", "TigerGraph host")
 	addCmd.Flags().String("gsPort", "14240", "GSQL Port")
 	addCmd.Flags().String("restPort", "9000", "REST Port")
-	addCmd.Flags().StringP("default", "d", "n", "Set as default alias (y/n)")
+	addCmd.Flags().BoolP("default", "d", false, "Set as default alias")
+	addCmd.Flags().Bool("dry-run", false, "Print the change to the config file without saving it")
+
+	// Update command
+	var updateCmd = &cobra.Command{
+		Use:   "update",
+		Short: "Change fields of an existing server configuration",
+		Run:   config.RunConfUpdate,
+	}
+	updateCmd.Flags().StringP("alias", "a", "", "Server alias to update")
+	updateCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	updateCmd.Flags().StringP("user", "u", "", "TigerGraph user")
+	updateCmd.Flags().StringP("password", "p", "", "TigerGraph password")
+	updateCmd.Flags().String("host", "", "TigerGraph host")
+	updateCmd.Flags().String("gsPort", "", "GSQL Port")
+	updateCmd.Flags().String("restPort", "", "REST Port")
+	updateCmd.Flags().Bool("dry-run", false, "Print the change to the config file without saving it")
+	updateCmd.MarkFlagRequired("alias")
 
 	// Delete command
 	var deleteCmd = &cobra.Command{
@@ -252,14 +694,30 @@ func createConfCmd() *cobra.Command {
 		Run:   config.RunConfDelete,
 	}
 	deleteCmd.Flags().StringP("alias", "a", "", "Server alias to delete")
+	deleteCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	deleteCmd.Flags().Bool("purge", false, "Delete permanently instead of moving the alias to the trash")
+	deleteCmd.Flags().Bool("dry-run", false, "Print the change to the config file without saving it")
 	deleteCmd.MarkFlagRequired("alias")
 
+	// Restore command
+	var restoreCmd = &cobra.Command{
+		Use:   "restore",
+		Short: "Restore a deleted server configuration from the trash",
+		Run:   config.RunConfRestore,
+	}
+	restoreCmd.Flags().StringP("alias", "a", "", "Server alias to restore")
+	restoreCmd.RegisterFlagCompletionFunc("alias", completeTrashedAliases)
+	restoreCmd.MarkFlagRequired("alias")
+
 	// List command
 	var listCmd = &cobra.Command{
 		Use:   "list",
 		Short: "List all configurations",
 		Run:   config.RunConfList,
 	}
+	listCmd.Flags().Bool("show-tokens", false, "Check whether the stored tgcloud token is still valid")
+	listCmd.Flags().Bool("trashed", false, "List deleted aliases that can still be restored")
+	listCmd.Flags().String("sort", "name", "Order aliases by name or host")
 
 	// TGCloud command
 	var tgcloudCmd = &cobra.Command{
@@ -269,7 +727,214 @@ func createConfCmd() *cobra.Command {
 	}
 	tgcloudCmd.Flags().StringP("email", "e", "", "TGCloud email")
 	tgcloudCmd.Flags().StringP("password", "p", "", "TGCloud password")
+	tgcloudCmd.Flags().String("token", "", "Store this tgcloud bearer token without logging in; - reads it from stdin")
+	tgcloudCmd.Flags().Bool("validate", false, "With --token, check that tgcloud accepts the token before storing it")
+	tgcloudCmd.MarkFlagsMutuallyExclusive("token", "email")
+	tgcloudCmd.MarkFlagsMutuallyExclusive("token", "password")
+
+	// Doctor command
+	var doctorCmd = &cobra.Command{
+		Use:   "doctor",
+		Short: "Detect and repair common configuration problems",
+		Run:   config.RunConfDoctor,
+	}
+	doctorCmd.Flags().Bool("fix", false, "Apply the proposed fixes (the original file is backed up)")
+	doctorCmd.Flags().StringSlice("only", nil, "Only apply fixes for these problem IDs")
+	doctorCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
 
-	confCmd.AddCommand(addCmd, deleteCmd, listCmd, tgcloudCmd)
+	confCmd.AddCommand(addCmd, updateCmd, deleteCmd, restoreCmd, listCmd, tgcloudCmd, doctorCmd)
 	return confCmd
 }
+
+func createContextCmd() *cobra.Command {
+	var contextCmd = &cobra.Command{
+		Use:   "context",
+		Short: "Switch between named contexts",
+		Long: `A context bundles a cloud profile, a default server alias and output
+preferences under one name. Contexts are defined under contexts: in the config
+file; settings a context leaves empty fall back to the top-level ones.`,
+	}
+
+	var useCmd = &cobra.Command{
+		Use:   "use [name]",
+		Short: "Set the current context",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   config.RunContextUse,
+	}
+	useCmd.Flags().Bool("unset", false, "Clear the current context")
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the defined contexts",
+		Args:  cobra.NoArgs,
+		Run:   config.RunContextList,
+	}
+
+	var showCmd = &cobra.Command{
+		Use:   "show [name]",
+		Short: "Show a context's settings, the current one by default",
+		Args:  cobra.MaximumNArgs(1),
+		Run:   config.RunContextShow,
+	}
+
+	var currentCmd = &cobra.Command{
+		Use:   "current",
+		Short: "Print the current context name",
+		Args:  cobra.NoArgs,
+		Run:   config.RunContextCurrent,
+	}
+
+	contextCmd.AddCommand(useCmd, listCmd, showCmd, currentCmd)
+	return contextCmd
+}
+
+func createDocsCmd() *cobra.Command {
+	var docsCmd = &cobra.Command{
+		Use:   "docs",
+		Short: "Offline reference documentation",
+	}
+
+	var gsqlCmd = &cobra.Command{
+		Use:   "gsql [topic]",
+		Short: "Show the GSQL quick reference for a statement",
+		Long:  `Show the synopsis, options and an example of a GSQL statement from the reference built into tg, which needs no network access. Topics are matched loosely, so "accum", "post-accum" and "lodaing job" all find theirs. Without a topic, list them. The same reference is available as \help <statement> in tg server gsql.`,
+		Run:   docs.RunGSQL,
+	}
+	gsqlCmd.Flags().String("gsql-version", "", "TigerGraph version to show the reference for, e.g. 3.9 (default: the newest)")
+
+	docsCmd.AddCommand(gsqlCmd)
+	return docsCmd
+}
+
+func createHistoryCmd() *cobra.Command {
+	var historyCmd = &cobra.Command{
+		Use:   "history",
+		Short: "Commands run before, per alias",
+		Long:  `Every command tg runs, except interactive GSQL sessions and help, is recorded in ~/.tgcli/history.jsonl with its flags, alias, instance ID and exit status. Values of credential flags such as --password and --token are never stored. The newest history.size entries (1000 by default) are kept; history.enabled: false in the config turns recording off.`,
+	}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the recorded commands",
+		Args:  cobra.NoArgs,
+		Run:   history.RunList,
+	}
+	listCmd.Flags().StringP("alias", "a", "", "Only commands run against this alias")
+	listCmd.RegisterFlagCompletionFunc("alias", completeAliases)
+	listCmd.Flags().String("since", "", "Only commands run within this period, e.g. 30d, 2w or 12h")
+	listCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+
+	var showCmd = &cobra.Command{
+		Use:   "show N",
+		Short: "Show a recorded command in full",
+		Args:  cobra.ExactArgs(1),
+		Run:   history.RunShow,
+	}
+	showCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+
+	var rerunCmd = &cobra.Command{
+		Use:   "rerun N [-- ARGS...]",
+		Short: "Run a recorded command again",
+		Long:  `Run a recorded command again, after showing it and asking for confirmation. N is a number from tg history list, or last. Arguments after -- are added to the command; credentials that were not stored, such as --password, must be given again this way.`,
+		Args:  cobra.MinimumNArgs(1),
+		Run:   history.RunRerun,
+	}
+	rerunCmd.Flags().BoolP("yes", "y", false, "Skip the confirmation prompt")
+
+	historyCmd.AddCommand(listCmd, showCmd, rerunCmd)
+	return historyCmd
+}
+
+func createPluginCmd() *cobra.Command {
+	var pluginCmd = &cobra.Command{
+		Use:   "plugin",
+		Short: "External commands added to tg",
+		Long:  `An executable named tg-<name> on PATH runs as tg <name>, getting the arguments after its name unchanged. Its environment holds TGCLI_CONFIG, the config file tg resolved, TGCLI_ACTIVE_ALIAS, the alias used when none is given, and TGCLI_OUTPUT, the output format of the active context. Its exit status is tg's. Built-in commands always win over a plugin of the same name.`,
+	}
+
+	var listCmd = &cobra.Command{
+		Use:   "list",
+		Short: "List the plugins on PATH with their paths and versions",
+		Long:  `List the plugins on PATH. Each is called with --tgcli-plugin-info and may answer with a JSON object such as {"version": "1.2.0", "description": "Deploy a graph from git"} on stdout; the version reads unknown otherwise. Plugins a built-in command shadows are listed as shadowed, with a plugin-shadowed warning.`,
+		Args:  cobra.NoArgs,
+		Run:   plugin.RunList,
+	}
+	listCmd.Flags().StringP("output", "o", "stdout", "Output format (stdout/json)")
+
+	pluginCmd.AddCommand(listCmd)
+	return pluginCmd
+}
+
+func createDebugCmd() *cobra.Command {
+	var debugCmd = &cobra.Command{
+		Use:   "debug",
+		Short: "Tools for reporting and reproducing problems",
+	}
+
+	var captureCmd = &cobra.Command{
+		Use:   "capture -- COMMAND...",
+		Short: "Run a command and save its requests, responses and output for a bug report",
+		Long:  `Run a tg command and save what it sent and received, the config values it used, platform details and its output in ~/.tgcli/captures/capture-<time>.tar.gz. Passwords, tokens and cookies are removed from headers, URLs, bodies, config and output, but review the bundle before sharing it: --review lists every captured URL. Maintainers reproduce a capture with tg debug replay.`,
+		Args:  cobra.MinimumNArgs(1),
+		Run:   capture.RunCapture,
+	}
+	captureCmd.Flags().SetInterspersed(false)
+	captureCmd.Flags().Bool("review", false, "List every captured request and what else the bundle holds once it is saved")
+
+	var replayCmd = &cobra.Command{
+		Use:   "replay BUNDLE",
+		Short: "Run a captured command again, answering its requests from the capture",
+		Long:  `Run the command of a bundle saved by tg debug capture again, with the config it was captured with. No request reaches the network: each is answered with the recorded response for the same method and path. Flags whose values were not stored, such as --password, are left out.`,
+		Args:  cobra.ExactArgs(1),
+		Run:   capture.RunReplay,
+	}
+
+	debugCmd.AddCommand(captureCmd, replayCmd)
+	return debugCmd
+}
+
+func createDevCmd() *cobra.Command {
+	var devCmd = &cobra.Command{
+		Use:   "dev",
+		Short: "Tools for trying tg out and working on it",
+	}
+
+	var sandboxCmd = &cobra.Command{
+		Use:   "sandbox",
+		Short: "Run a disposable TigerGraph container and register an alias for it",
+		Long: `Pull and start the official TigerGraph image in Docker, wait until GSQL
+accepts a login and register the alias sandbox for it, with the image's
+default tigergraph/tigergraph credentials. Its ports are published on
+127.0.0.1 only. Running it again starts a stopped sandbox or keeps waiting
+for a slow one. --destroy removes the container and the alias.`,
+		Args: cobra.NoArgs,
+		Run:  dev.RunSandbox,
+	}
+	sandboxCmd.Flags().Bool("destroy", false, "Remove the sandbox container and its alias")
+	sandboxCmd.Flags().String("alias", "sandbox", "Alias to register the sandbox under")
+	sandboxCmd.Flags().String("name", "tgcli-sandbox", "Name of the Docker container")
+	sandboxCmd.Flags().String("image", "tigergraph/tigergraph:latest", "TigerGraph image to run")
+	sandboxCmd.Flags().Int("gs-port", 14240, "Host port for GSQL and GraphStudio")
+	sandboxCmd.Flags().Int("rest-port", 9000, "Host port for RESTPP")
+	sandboxCmd.Flags().Duration("timeout", 15*time.Minute, "How long to wait for GSQL to become ready")
+
+	devCmd.AddCommand(sandboxCmd)
+	return devCmd
+}
+
+func createUpgradeCmd() *cobra.Command {
+	var upgradeCmd = &cobra.Command{
+		Use:   "upgrade",
+		Short: "Replace tg with the latest signed release",
+		Long: `Download a tg release from GitHub and install it over the running binary.
+The release's checksums must be signed by a key built into tg, or a key it
+endorses, before the download is trusted. An interrupted download is resumed
+the next time unless --restart is given.`,
+		Args: cobra.NoArgs,
+		Run:  upgrade.RunUpgrade,
+	}
+	upgradeCmd.Flags().String("version", "", "Release to install, e.g. v0.2.0 (default: the latest)")
+	upgradeCmd.Flags().Bool("skip-signature", false, "Install without checking the release signature (asks for confirmation)")
+	upgradeCmd.Flags().Bool("restart", false, "Discard a partly downloaded release instead of resuming it")
+	return upgradeCmd
+}
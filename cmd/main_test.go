@@ -2,13 +2,17 @@ package main
 
 import (
 	"bytes"
+	"io"
 	"os"
 	"path/filepath"
+	"reflect"
 	"strings"
 	"testing"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/plugin"
 	"github.com/zrougamed/tgCli/pkg/constants"
 )
 
@@ -83,6 +87,37 @@ func TestInitialization(t *testing.T) {
 	}
 }
 
+func TestResolveConfigDir(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	t.Setenv("TGCLI_HOME", "")
+
+	homeDir, configDir, err := resolveConfigDir()
+	if err != nil || homeDir != home || configDir != filepath.Join(home, ".tgcli") {
+		t.Errorf("Expected %s/.tgcli, got %s (home %s, err %v)", home, configDir, homeDir, err)
+	}
+
+	override := filepath.Join(t.TempDir(), "state")
+	t.Setenv("TGCLI_HOME", override)
+	if _, configDir, err = resolveConfigDir(); err != nil || configDir != override {
+		t.Errorf("Expected TGCLI_HOME to win, got %s (%v)", configDir, err)
+	}
+
+	t.Setenv("HOME", "")
+	if _, configDir, err = resolveConfigDir(); err != nil || configDir != override {
+		t.Errorf("TGCLI_HOME should work without a home directory, got %s (%v)", configDir, err)
+	}
+
+	t.Setenv("TGCLI_HOME", "")
+	homeDir, configDir, err = resolveConfigDir()
+	if err == nil || !strings.Contains(err.Error(), "TGCLI_HOME") {
+		t.Errorf("Expected a warning about the fallback, got %v", err)
+	}
+	if homeDir != "" || !strings.HasPrefix(configDir, os.TempDir()) {
+		t.Errorf("Expected a temp dir fallback, got %s (home %q)", configDir, homeDir)
+	}
+}
+
 func TestRootCommand(t *testing.T) {
 	cleanup := setupMainTestEnvironment(t)
 	defer cleanup()
@@ -127,7 +162,7 @@ func TestCreateCloudCmd(t *testing.T) {
 	}
 
 	// Test subcommands
-	expectedSubcommands := []string{"login", "start", "stop", "terminate", "archive", "list", "create"}
+	expectedSubcommands := []string{"login", "start", "stop", "terminate", "archive", "unarchive", "list", "wait", "create", "export-inventory", "apply"}
 	commands := cloudCmd.Commands()
 
 	if len(commands) != len(expectedSubcommands) {
@@ -164,7 +199,7 @@ func TestCreateServerCmd(t *testing.T) {
 	}
 
 	// Test subcommands
-	expectedSubcommands := []string{"gsql", "backup", "services"}
+	expectedSubcommands := []string{"gsql", "backup", "services", "ping", "clear-graph", "install-dir", "query", "graphs", "queries"}
 	commands := serverCmd.Commands()
 
 	if len(commands) != len(expectedSubcommands) {
@@ -174,7 +209,7 @@ func TestCreateServerCmd(t *testing.T) {
 	for _, expected := range expectedSubcommands {
 		found := false
 		for _, cmd := range commands {
-			if cmd.Use == expected {
+			if cmd.Name() == expected {
 				found = true
 				break
 			}
@@ -201,7 +236,7 @@ func TestCreateConfCmd(t *testing.T) {
 	}
 
 	// Test subcommands
-	expectedSubcommands := []string{"add", "delete", "list", "tgcloud"}
+	expectedSubcommands := []string{"add", "update", "delete", "restore", "list", "tgcloud", "doctor"}
 	commands := confCmd.Commands()
 
 	if len(commands) != len(expectedSubcommands) {
@@ -222,6 +257,37 @@ func TestCreateConfCmd(t *testing.T) {
 	}
 }
 
+func TestCreateContextCmd(t *testing.T) {
+	cleanup := setupMainTestEnvironment(t)
+	defer cleanup()
+
+	contextCmd := createContextCmd()
+
+	if contextCmd.Use != "context" {
+		t.Error("Context command should use 'context'")
+	}
+
+	expectedSubcommands := []string{"use", "list", "show", "current"}
+	commands := contextCmd.Commands()
+
+	if len(commands) != len(expectedSubcommands) {
+		t.Errorf("Expected %d context subcommands, got %d", len(expectedSubcommands), len(commands))
+	}
+
+	for _, expected := range expectedSubcommands {
+		found := false
+		for _, cmd := range commands {
+			if cmd.Name() == expected {
+				found = true
+				break
+			}
+		}
+		if !found {
+			t.Errorf("Context subcommand '%s' not found", expected)
+		}
+	}
+}
+
 func TestCloudLoginCommandFlags(t *testing.T) {
 	cleanup := setupMainTestEnvironment(t)
 	defer cleanup()
@@ -416,21 +482,26 @@ func TestGlobalFlags(t *testing.T) {
 	cleanup := setupMainTestEnvironment(t)
 	defer cleanup()
 
-	var rootCmd = &cobra.Command{
-		Use: "tg",
-	}
-
-	// Add global flags
-	rootCmd.PersistentFlags().BoolVarP(&constants.Debug, "debug", "d", false, "Enable debug mode")
+	rootCmd := newRootCmd()
 
 	// Test that debug flag exists
 	debugFlag := rootCmd.PersistentFlags().Lookup("debug")
 	if debugFlag == nil {
-		t.Error("Root command should have debug flag")
+		t.Fatal("Root command should have debug flag")
 	}
 
-	if debugFlag.Shorthand != "d" {
-		t.Error("Debug flag should have shorthand 'd'")
+	// -d belongs to conf add --default; a global -d would collide with it
+	if debugFlag.Shorthand != "" {
+		t.Errorf("Debug flag should not have a shorthand, got '%s'", debugFlag.Shorthand)
+	}
+
+	// --output-file is the older name of --out-file
+	defer func() { outputFile = "" }()
+	for _, flag := range []string{"--out-file", "--output-file"} {
+		outputFile = ""
+		if err := rootCmd.PersistentFlags().Parse([]string{flag, "solutions.json"}); err != nil || outputFile != "solutions.json" {
+			t.Errorf("Expected %s to set the output file, got %q (%v)", flag, outputFile, err)
+		}
 	}
 }
 
@@ -814,3 +885,105 @@ func TestCommandCompletion(t *testing.T) {
 		}
 	}
 }
+
+func TestAliasCompletion(t *testing.T) {
+	cleanup := setupMainTestEnvironment(t)
+	defer cleanup()
+	defer viper.Reset()
+
+	for _, alias := range []string{"staging", "prod", "dev", "qa"} {
+		viper.Set("machines."+alias, map[string]interface{}{"host": "http://" + alias})
+	}
+	for i := 0; i < 5; i++ {
+		rootCmd := newRootCmd()
+		var out bytes.Buffer
+		rootCmd.SetOut(&out)
+		rootCmd.SetArgs([]string{"__complete", "server", "gsql", "-a", ""})
+		if err := rootCmd.Execute(); err != nil {
+			t.Fatalf("Completion failed: %v", err)
+		}
+		if !strings.HasPrefix(out.String(), "dev\nprod\nqa\nstaging\n:4\n") {
+			t.Fatalf("Expected the aliases in sorted order, got %q", out.String())
+		}
+	}
+}
+
+func TestLegacyYesNoFlags(t *testing.T) {
+	tests := []struct {
+		args     []string
+		flag     string
+		expected bool
+	}{
+		{[]string{"cloud", "login", "-s", "y"}, "save", true},
+		{[]string{"cloud", "login", "--save"}, "save", true},
+		{[]string{"cloud", "login", "-s", "n"}, "save", false},
+		{[]string{"conf", "add", "-a", "prod", "-d", "Y"}, "default", true},
+		{[]string{"conf", "add", "-a", "prod", "--default=no"}, "default", false},
+		{[]string{"conf", "add", "-a", "prod", "-d"}, "default", true},
+	}
+
+	oldStderr := os.Stderr
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stderr = devNull
+	defer func() {
+		os.Stderr = oldStderr
+		devNull.Close()
+	}()
+
+	for _, tt := range tests {
+		rootCmd := newRootCmd()
+		cmd, rest, err := rootCmd.Find(commandArgs(rootCmd, tt.args))
+		if err != nil {
+			t.Fatalf("Failed to find command for %v: %v", tt.args, err)
+		}
+		if err := cmd.ParseFlags(rest); err != nil {
+			t.Errorf("Failed to parse %v: %v", tt.args, err)
+			continue
+		}
+		if got := helpers.FlagEnabled(cmd, tt.flag); got != tt.expected {
+			t.Errorf("%v: --%s = %v, expected %v", tt.args, tt.flag, got, tt.expected)
+		}
+		if len(cmd.Flags().Args()) != 0 {
+			t.Errorf("%v: unexpected positional arguments %v", tt.args, cmd.Flags().Args())
+		}
+	}
+}
+
+func TestPluginArgsKept(t *testing.T) {
+	rootCmd := newRootCmd()
+	rootCmd.AddGroup(&cobra.Group{ID: plugin.GroupID, Title: "Plugin Commands:"})
+	rootCmd.AddCommand(plugin.Command(plugin.Plugin{Name: "myplugin", Path: "/usr/local/bin/tg-myplugin"}))
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	args := commandArgs(rootCmd, []string{"myplugin", "-d", "n", "--save", "y"})
+	w.Close()
+	os.Stderr = oldStderr
+	stderr, _ := io.ReadAll(r)
+
+	if !reflect.DeepEqual(args, []string{"myplugin", "-d", "n", "--save", "y"}) || len(stderr) != 0 {
+		t.Errorf("Expected a plugin's args to be passed on as given, got %q and %q", args, stderr)
+	}
+}
+
+func TestVersionShort(t *testing.T) {
+	cleanup := setupMainTestEnvironment(t)
+	defer cleanup()
+
+	// The version goes wherever command output goes, --out-file included.
+	path := filepath.Join(t.TempDir(), "version.txt")
+	outFile, err := helpers.OpenOutFile(path)
+	if err != nil {
+		t.Fatalf("OpenOutFile failed: %v", err)
+	}
+	rootCmd := newRootCmd()
+	rootCmd.SetArgs([]string{"version", "--short"})
+	if err := rootCmd.Execute(); err != nil {
+		t.Fatalf("version --short failed: %v", err)
+	}
+	outFile.Commit()
+	if out, _ := os.ReadFile(path); string(out) != constants.VERSION_CLI+"\n" {
+		t.Errorf("Expected only %q, got %q", constants.VERSION_CLI, out)
+	}
+}
@@ -0,0 +1,526 @@
+// Package capture records the HTTP traffic of a command for bug reports,
+// and plays a recording back so maintainers can reproduce the report.
+//
+// tg debug capture runs the command as a child process with CaptureDirEnv
+// naming a private directory. Start, called by every command, then records
+// each request and its response there, along with the command line and the
+// resolved config. The parent adds the command's output and platform
+// details, removes credentials (see sanitize) and packs it all into
+// ~/.tgcli/captures/capture-<time>.tar.gz:
+//
+//	capture-<time>/capture.json    Info: version, platform, command, exit code
+//	capture-<time>/config.json     Config: the config values the command saw
+//	capture-<time>/exchanges.json  []Exchange, in the order they were sent
+//	capture-<time>/output.txt      stdout and stderr, interleaved
+//
+// With ReplayEnv naming such a bundle, Start answers requests from its
+// exchanges instead of the network; tg debug replay sets that up.
+package capture
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/history"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// The environment variables that put a command in record or replay mode.
+const (
+	CaptureDirEnv = "TGCLI_CAPTURE_DIR"
+	ReplayEnv     = "TGCLI_REPLAY"
+)
+
+// formatVersion is the version of the bundle layout.
+const formatVersion = 1
+
+// maxBody is how much of each request and response body is kept.
+const maxBody = 1 << 20
+
+// Files the child writes to the capture directory. secretsFile holds the
+// credentials given as flags so they can be removed everywhere; it never
+// goes into the bundle.
+const (
+	invocationFile = "invocation.json"
+	configFile     = "config.json"
+	exchangesFile  = "exchanges.jsonl"
+	secretsFile    = "secrets.json"
+)
+
+// Exchange is one request and its response, or the error that ended it.
+type Exchange struct {
+	Method         string      `json:"method"`
+	URL            string      `json:"url"`
+	RequestHeader  http.Header `json:"requestHeader,omitempty"`
+	RequestBody    string      `json:"requestBody,omitempty"`
+	Status         int         `json:"status,omitempty"`
+	ResponseHeader http.Header `json:"responseHeader,omitempty"`
+	ResponseBody   string      `json:"responseBody,omitempty"`
+	// Truncated is set when a body was longer than maxBody.
+	Truncated  bool   `json:"truncated,omitempty"`
+	Error      string `json:"error,omitempty"`
+	DurationMs int64  `json:"durationMs"`
+}
+
+// Info describes a capture.
+type Info struct {
+	Version   int       `json:"version"`
+	Time      time.Time `json:"time"`
+	TgVersion string    `json:"tgVersion"`
+	OS        string    `json:"os"`
+	Arch      string    `json:"arch"`
+	GoVersion string    `json:"goVersion"`
+	// Command is the invocation after "tg", as tg history records it.
+	Command []string `json:"command"`
+	// Redacted names the flags whose values were left out of Command.
+	Redacted []string `json:"redacted,omitempty"`
+	Exit     int      `json:"exit"`
+}
+
+// Config is the configuration the command ran with.
+type Config struct {
+	File           string                 `json:"file"`
+	Context        string                 `json:"context,omitempty"`
+	TGCloudBaseURL string                 `json:"tgcloudBaseUrl"`
+	Settings       map[string]interface{} `json:"settings"`
+}
+
+// Bundle is everything a capture holds.
+type Bundle struct {
+	Info      Info
+	Config    Config
+	Exchanges []Exchange
+	Output    string
+}
+
+// invocation is what the child records about its command line.
+type invocation struct {
+	Args     []string `json:"args"`
+	Redacted []string `json:"redacted,omitempty"`
+}
+
+// Start puts the command in record mode when CaptureDirEnv is set, and in
+// replay mode when ReplayEnv is. The root command calls it before running
+// any command.
+func Start(cmd *cobra.Command, args []string) {
+	if dir := os.Getenv(CaptureDirEnv); dir != "" {
+		if err := startRecording(dir, cmd, args); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: starting the capture: %v\n", err)
+			helpers.Exit(1)
+		}
+	}
+	if bundle := os.Getenv(ReplayEnv); bundle != "" {
+		if err := startReplay(bundle); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: starting the replay: %v\n", err)
+			helpers.Exit(1)
+		}
+	}
+}
+
+// startRecording writes the command line, config and flag credentials of
+// cmd to dir, and records every request made from now on.
+func startRecording(dir string, cmd *cobra.Command, args []string) error {
+	argv, redacted := history.Invocation(cmd, args)
+	if err := writeJSON(filepath.Join(dir, invocationFile), invocation{Args: argv, Redacted: redacted}); err != nil {
+		return err
+	}
+	config := Config{
+		File:           constants.ConfigFile,
+		Context:        constants.Context,
+		TGCloudBaseURL: constants.TGCLOUD_BASE_URL,
+		Settings:       viper.AllSettings(),
+	}
+	if err := writeJSON(filepath.Join(dir, configFile), config); err != nil {
+		return err
+	}
+	if err := writeJSON(filepath.Join(dir, secretsFile), flagSecrets(cmd)); err != nil {
+		return err
+	}
+
+	r := &recorder{path: filepath.Join(dir, exchangesFile), pending: make(map[*recordedBody]bool)}
+	wrap := helpers.WrapTransport
+	helpers.WrapTransport = func(base http.RoundTripper) http.RoundTripper {
+		return wrap(&recordingTransport{base: base, recorder: r})
+	}
+	active = r
+	helpers.OnExit(Flush)
+	return nil
+}
+
+// flagSecrets returns the credentials given as flags: the values of flags
+// named like credentials and passwords in URLs.
+func flagSecrets(cmd *cobra.Command) []string {
+	var secrets []string
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		values := []string{flag.Value.String()}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			values = slice.GetSlice()
+		}
+		for _, value := range values {
+			if helpers.SensitiveName(flag.Name) {
+				secrets = append(secrets, value)
+			} else if password := urlPassword(value); password != "" {
+				secrets = append(secrets, password)
+			}
+		}
+	})
+	return secrets
+}
+
+func writeJSON(path string, v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// active is the recorder of this run, if it is being captured.
+var active *recorder
+
+// Flush records the exchanges whose response bodies were not read to the
+// end or closed, e.g. because the command exited early. It is registered
+// with helpers.OnExit and is also called when a command returns normally.
+func Flush(code int) {
+	if active != nil {
+		active.flush()
+	}
+}
+
+// recorder appends exchanges to the capture directory as JSON lines.
+type recorder struct {
+	path    string
+	mu      sync.Mutex
+	pending map[*recordedBody]bool
+}
+
+func (r *recorder) write(e Exchange) {
+	line, err := json.Marshal(e)
+	if err != nil {
+		return
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	file, err := os.OpenFile(r.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return
+	}
+	file.Write(append(line, '\n'))
+	file.Close()
+}
+
+func (r *recorder) flush() {
+	r.mu.Lock()
+	bodies := make([]*recordedBody, 0, len(r.pending))
+	for body := range r.pending {
+		bodies = append(bodies, body)
+	}
+	r.mu.Unlock()
+	for _, body := range bodies {
+		body.finish()
+	}
+}
+
+// recordingTransport records each request made through base.
+type recordingTransport struct {
+	base     http.RoundTripper
+	recorder *recorder
+}
+
+func (t *recordingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	e := Exchange{Method: req.Method, URL: req.URL.String(), RequestHeader: req.Header.Clone()}
+	if req.Body != nil && req.Body != http.NoBody {
+		data, err := io.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			return nil, err
+		}
+		e.RequestBody, e.Truncated = keep(data)
+		req = req.Clone(req.Context())
+		req.Body = io.NopCloser(bytes.NewReader(data))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		e.Error = err.Error()
+		e.DurationMs = time.Since(start).Milliseconds()
+		t.recorder.write(e)
+		return resp, err
+	}
+	e.Status, e.ResponseHeader = resp.StatusCode, resp.Header.Clone()
+	body := &recordedBody{ReadCloser: resp.Body, exchange: e, start: start, recorder: t.recorder}
+	t.recorder.mu.Lock()
+	t.recorder.pending[body] = true
+	t.recorder.mu.Unlock()
+	resp.Body = body
+	return resp, nil
+}
+
+// keep returns what is kept of a body and whether it was cut short.
+func keep(data []byte) (string, bool) {
+	if len(data) > maxBody {
+		return string(data[:maxBody]), true
+	}
+	return string(data), false
+}
+
+// recordedBody passes a response body through and records the exchange
+// once it has been read to the end or closed.
+type recordedBody struct {
+	io.ReadCloser
+	exchange Exchange
+	start    time.Time
+	recorder *recorder
+	mu       sync.Mutex
+	data     bytes.Buffer
+	done     bool
+}
+
+func (b *recordedBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.mu.Lock()
+	if room := maxBody - b.data.Len(); n > room {
+		b.data.Write(p[:room])
+		b.exchange.Truncated = true
+	} else {
+		b.data.Write(p[:n])
+	}
+	b.mu.Unlock()
+	if err == io.EOF {
+		b.finish()
+	}
+	return n, err
+}
+
+func (b *recordedBody) Close() error {
+	b.finish()
+	return b.ReadCloser.Close()
+}
+
+func (b *recordedBody) finish() {
+	b.mu.Lock()
+	if b.done {
+		b.mu.Unlock()
+		return
+	}
+	b.done = true
+	e := b.exchange
+	e.ResponseBody = b.data.String()
+	e.DurationMs = time.Since(b.start).Milliseconds()
+	b.mu.Unlock()
+
+	b.recorder.mu.Lock()
+	delete(b.recorder.pending, b)
+	b.recorder.mu.Unlock()
+	b.recorder.write(e)
+}
+
+// readExchanges returns the exchanges recorded in dir, in the order they
+// completed.
+func readExchanges(dir string) ([]Exchange, error) {
+	data, err := os.ReadFile(filepath.Join(dir, exchangesFile))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var exchanges []Exchange
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	for decoder.More() {
+		var e Exchange
+		if err := decoder.Decode(&e); err != nil {
+			return nil, err
+		}
+		exchanges = append(exchanges, e)
+	}
+	return exchanges, nil
+}
+
+// collect reads what the child recorded in dir into a bundle, adds info
+// and output, and removes credentials from all of it.
+func collect(dir string, info Info, output string) (*Bundle, error) {
+	var inv invocation
+	var secrets []string
+	b := &Bundle{Info: info, Output: output}
+	for name, v := range map[string]interface{}{invocationFile: &inv, configFile: &b.Config, secretsFile: &secrets} {
+		data, err := os.ReadFile(filepath.Join(dir, name))
+		if os.IsNotExist(err) {
+			// The command failed before it started, e.g. on a flag.
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(data, v); err != nil {
+			return nil, fmt.Errorf("reading %s: %v", name, err)
+		}
+	}
+	b.Info.Command, b.Info.Redacted = inv.Args, inv.Redacted
+
+	exchanges, err := readExchanges(dir)
+	if err != nil {
+		return nil, err
+	}
+	b.Exchanges = exchanges
+	sanitize(b, secrets)
+	return b, nil
+}
+
+// name is the directory a bundle's files are under, from its time.
+func (b *Bundle) name() string {
+	return "capture-" + b.Info.Time.Local().Format("20060102-150405")
+}
+
+// write packs the bundle as a .tar.gz into w.
+func (b *Bundle) write(w io.Writer) error {
+	exchanges := b.Exchanges
+	if exchanges == nil {
+		exchanges = []Exchange{}
+	}
+	files := []struct {
+		name string
+		v    interface{}
+	}{
+		{"capture.json", b.Info},
+		{"config.json", b.Config},
+		{"exchanges.json", exchanges},
+	}
+
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	add := func(name string, data []byte) error {
+		header := &tar.Header{Name: path.Join(b.name(), name), Mode: 0600, Size: int64(len(data)), ModTime: b.Info.Time}
+		if err := tw.WriteHeader(header); err != nil {
+			return err
+		}
+		_, err := tw.Write(data)
+		return err
+	}
+	for _, file := range files {
+		data, err := json.MarshalIndent(file.v, "", "  ")
+		if err != nil {
+			return err
+		}
+		if err := add(file.name, append(data, '\n')); err != nil {
+			return err
+		}
+	}
+	if err := add("output.txt", []byte(b.Output)); err != nil {
+		return err
+	}
+	if err := tw.Close(); err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// save writes the bundle to a new file in dir and returns its path.
+func (b *Bundle) save(dir string) (string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	base := filepath.Join(dir, b.name())
+	path := base + ".tar.gz"
+	for i := 2; ; i++ {
+		if _, err := os.Stat(path); os.IsNotExist(err) {
+			break
+		}
+		path = fmt.Sprintf("%s-%d.tar.gz", base, i)
+	}
+	var buf bytes.Buffer
+	if err := b.write(&buf); err != nil {
+		return "", err
+	}
+	return path, helpers.WriteFileAtomic(path, buf.Bytes(), 0600)
+}
+
+// Load reads a bundle written by tg debug capture.
+func Load(path string) (*Bundle, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a capture bundle: %v", path, err)
+	}
+	b := &Bundle{}
+	found := false
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", path, err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return nil, fmt.Errorf("reading %s: %v", path, err)
+		}
+		var v interface{}
+		switch filepath.Base(header.Name) {
+		case "capture.json":
+			v, found = &b.Info, true
+		case "config.json":
+			v = &b.Config
+		case "exchanges.json":
+			v = &b.Exchanges
+		case "output.txt":
+			b.Output = string(data)
+		}
+		if v != nil {
+			if err := json.Unmarshal(data, v); err != nil {
+				return nil, fmt.Errorf("reading %s in %s: %v", header.Name, path, err)
+			}
+		}
+	}
+	if !found {
+		return nil, fmt.Errorf("%s is not a capture bundle: it has no capture.json", path)
+	}
+	if b.Info.Version > formatVersion {
+		return nil, fmt.Errorf("%s was written by a newer tg (format %d); upgrade to read it", path, b.Info.Version)
+	}
+	return b, nil
+}
+
+// summary lists what a bundle holds, every URL first, for review before
+// it is shared.
+func (b *Bundle) summary() string {
+	var s strings.Builder
+	fmt.Fprintf(&s, "Command:  %s\n", strings.Join(append([]string{"tg"}, b.Info.Command...), " "))
+	fmt.Fprintf(&s, "Exit:     %d\n", b.Info.Exit)
+	fmt.Fprintf(&s, "Platform: tg %s, %s/%s, %s\n", b.Info.TgVersion, b.Info.OS, b.Info.Arch, b.Info.GoVersion)
+	if len(b.Info.Redacted) > 0 {
+		fmt.Fprintf(&s, "Not stored: --%s\n", strings.Join(b.Info.Redacted, ", --"))
+	}
+	fmt.Fprintf(&s, "Requests: %d\n", len(b.Exchanges))
+	for i, e := range b.Exchanges {
+		result := fmt.Sprint(e.Status)
+		if e.Error != "" {
+			result = "error: " + e.Error
+		}
+		fmt.Fprintf(&s, "  %3d  %-6s %s  %s\n", i+1, e.Method, e.URL, result)
+	}
+	fmt.Fprintf(&s, "Output:   %d lines\n", strings.Count(b.Output, "\n"))
+	return s.String()
+}
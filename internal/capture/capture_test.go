@@ -0,0 +1,316 @@
+package capture
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// writeChildFiles writes what a captured child leaves in dir.
+func writeChildFiles(t *testing.T, dir string, inv invocation, config Config, secrets []string, exchanges []Exchange) {
+	t.Helper()
+	for name, v := range map[string]interface{}{invocationFile: inv, configFile: config, secretsFile: secrets} {
+		if err := writeJSON(filepath.Join(dir, name), v); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := &recorder{path: filepath.Join(dir, exchangesFile)}
+	for _, e := range exchanges {
+		r.write(e)
+	}
+}
+
+// bundleText returns every file of a packed bundle, concatenated.
+func bundleText(t *testing.T, b *Bundle) string {
+	t.Helper()
+	var packed bytes.Buffer
+	if err := b.write(&packed); err != nil {
+		t.Fatalf("write failed: %v", err)
+	}
+	gz, err := gzip.NewReader(&packed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var text strings.Builder
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, _ := io.ReadAll(tr)
+		text.WriteString("== " + header.Name + "\n" + string(data) + "\n")
+	}
+	return text.String()
+}
+
+// TestSanitizePlantedSecrets plants a different secret in every place a
+// capture records, and checks that none of them, in any escaping, is left
+// in the bundle.
+func TestSanitizePlantedSecrets(t *testing.T) {
+	planted := map[string]string{
+		"flag password":           `p@ss w/rd"&1`,
+		"config password":         "machinePass42",
+		"config token":            "cfgToken-9f8e",
+		"authorization header":    "bearer.jwt.value",
+		"cookie header":           "cookieSession77",
+		"set-cookie header":       "setCookie88",
+		"custom token header":     "headerToken66",
+		"url password":            "urlPass55",
+		"query token":             "queryToken44",
+		"json request password":   "bodyPass33",
+		"form request secret":     "form secret/22",
+		"json response token":     "respIdToken11",
+		"nested response api key": "nestedKey00",
+		"gsql statement password": "gsqlPass99",
+	}
+	dir := t.TempDir()
+	writeChildFiles(t, dir,
+		invocation{Args: []string{"server", "gsql", "--alias=prod", "--password=***"}, Redacted: []string{"password"}},
+		Config{File: "/home/u/.tgcli/config.yml", TGCloudBaseURL: "https://api.tgcloud.io", Settings: map[string]interface{}{
+			"machines": map[string]interface{}{"prod": map[string]interface{}{"host": "https://prod", "password": planted["config password"]}},
+			"tgcloud":  map[string]interface{}{"user": "alice@example.com", "token": planted["config token"]},
+		}},
+		[]string{planted["flag password"]},
+		[]Exchange{
+			{
+				Method: "POST",
+				URL:    "https://admin:" + planted["url password"] + "@prod:14240/gsqlserver/gsql/login?token=" + planted["query token"],
+				RequestHeader: http.Header{
+					"Authorization": {"Bearer " + planted["authorization header"]},
+					"Cookie":        {"clientCommit=abc; session=" + planted["cookie header"]},
+					"X-Auth-Token":  {planted["custom token header"]},
+				},
+				RequestBody:    `{"username":"tigergraph","password":"` + planted["json request password"] + `"}`,
+				Status:         200,
+				ResponseHeader: http.Header{"Set-Cookie": {"session=" + planted["set-cookie header"] + "; Path=/; HttpOnly"}},
+				ResponseBody:   `{"idToken":"` + planted["json response token"] + `","data":{"apiKey":"` + planted["nested response api key"] + `"},"echo":"` + planted["url password"] + `"}`,
+			},
+			{
+				Method:       "POST",
+				URL:          "https://prod:14240/gsqlserver/gsql/file",
+				RequestBody:  "user=tigergraph&client_secret=" + url.QueryEscape(planted["form request secret"]),
+				Status:       401,
+				ResponseBody: "wrong password " + planted["flag password"] + " for token " + planted["json response token"],
+			},
+			{
+				Method:      "POST",
+				URL:         "https://prod:14240/gsqlserver/gsql/file",
+				RequestBody: "CREATE USER bob PASSWORD '" + planted["gsql statement password"] + "'",
+				Status:      200,
+			},
+			{
+				Method: "GET",
+				URL:    "https://prod:9000/echo",
+				Error:  `Get "https://prod:9000/echo?token=` + planted["query token"] + `": connection refused`,
+			},
+		})
+
+	output := "Logging in with " + planted["flag password"] + "\nsession " + planted["cookie header"] + "\n"
+	b, err := collect(dir, Info{Version: formatVersion, Time: time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)}, output)
+	if err != nil {
+		t.Fatalf("collect failed: %v", err)
+	}
+	text := bundleText(t, b)
+	for place, secret := range planted {
+		quoted, _ := json.Marshal(secret)
+		for _, form := range []string{secret, url.QueryEscape(secret), url.PathEscape(secret), string(quoted[1 : len(quoted)-1])} {
+			if strings.Contains(text, form) {
+				t.Errorf("The %s %q is still in the bundle", place, form)
+			}
+		}
+	}
+	if t.Failed() {
+		t.Logf("Bundle:\n%s", text)
+	}
+
+	// What is not a credential survives.
+	for _, kept := range []string{"alice@example.com", `"username\":\"tigergraph\"`, "https://prod:14240/gsqlserver/gsql/file", "--alias=prod", "CREATE USER bob PASSWORD '***'"} {
+		if !strings.Contains(text, kept) {
+			t.Errorf("Expected %q to be kept", kept)
+		}
+	}
+}
+
+func TestRecordingTransport(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.Write([]byte("got " + string(body)))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	r := &recorder{path: filepath.Join(dir, exchangesFile), pending: make(map[*recordedBody]bool)}
+	client := &http.Client{Transport: &recordingTransport{base: http.DefaultTransport, recorder: r}}
+
+	resp, err := client.Post(server.URL+"/a?x=1", "text/plain", strings.NewReader("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if string(body) != "got hello" {
+		t.Errorf("The request body did not reach the server: %q", body)
+	}
+
+	// A body that is never read is recorded by flush.
+	if _, err := client.Get(server.URL + "/b"); err != nil {
+		t.Fatal(err)
+	}
+	r.flush()
+	if _, err := client.Get("http://127.0.0.1:1/c"); err == nil {
+		t.Fatal("Expected the request to fail")
+	}
+
+	exchanges, err := readExchanges(dir)
+	if err != nil || len(exchanges) != 3 {
+		t.Fatalf("Expected three exchanges, got %+v (%v)", exchanges, err)
+	}
+	first := exchanges[0]
+	if first.Method != "POST" || first.URL != server.URL+"/a?x=1" || first.RequestBody != "hello" || first.Status != 200 ||
+		first.ResponseBody != "got hello" || first.ResponseHeader.Get("Content-Type") != "text/plain" {
+		t.Errorf("Unexpected first exchange %+v", first)
+	}
+	if exchanges[1].URL != server.URL+"/b" || exchanges[1].ResponseBody != "" {
+		t.Errorf("Unexpected unread exchange %+v", exchanges[1])
+	}
+	if exchanges[2].Error == "" || exchanges[2].Status != 0 {
+		t.Errorf("Expected the failed request to be recorded with its error, got %+v", exchanges[2])
+	}
+}
+
+func TestReplayTransport(t *testing.T) {
+	replay := newReplayTransport([]Exchange{
+		{Method: "GET", URL: "https://recorded/solution", Status: 200, ResponseBody: "pending", ResponseHeader: http.Header{"Content-Length": {"99"}}},
+		{Method: "GET", URL: "https://recorded/solution", Status: 200, ResponseBody: "ready"},
+		{Method: "POST", URL: "https://recorded/solution", Status: 500, ResponseBody: "no"},
+		{Method: "GET", URL: "https://recorded/solution/m1", Error: "connection reset"},
+	})
+	client := &http.Client{Transport: replay}
+	get := func(path string) (string, int, error) {
+		resp, err := client.Get("http://127.0.0.1:1" + path)
+		if err != nil {
+			return "", 0, err
+		}
+		defer resp.Body.Close()
+		body, _ := io.ReadAll(resp.Body)
+		return string(body), resp.StatusCode, nil
+	}
+
+	for _, expected := range []string{"pending", "ready", "ready"} {
+		if body, status, err := get("/solution"); err != nil || status != 200 || body != expected {
+			t.Errorf("Expected %s, got %q %d %v", expected, body, status, err)
+		}
+	}
+	resp, err := client.Post("http://127.0.0.1:1/solution", "application/json", strings.NewReader("{}"))
+	if err != nil || resp.StatusCode != 500 {
+		t.Errorf("Expected the recorded POST, got %v %v", resp, err)
+	}
+	if _, _, err := get("/solution/m1"); err == nil || !strings.Contains(err.Error(), "connection reset") {
+		t.Errorf("Expected the recorded error, got %v", err)
+	}
+	if _, _, err := get("/solution/m2"); err == nil || !strings.Contains(err.Error(), "no recorded response for GET /solution/m2") {
+		t.Errorf("Expected an unrecorded request to fail, got %v", err)
+	}
+}
+
+func TestSaveAndLoad(t *testing.T) {
+	dir := t.TempDir()
+	b := &Bundle{
+		Info:      Info{Version: formatVersion, Time: time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local), TgVersion: "1.2.3", OS: "linux", Arch: "amd64", GoVersion: "go1.24", Command: []string{"cloud", "list"}, Exit: 2},
+		Config:    Config{TGCloudBaseURL: "https://api.tgcloud.io", Settings: map[string]interface{}{"default": "prod"}},
+		Exchanges: []Exchange{{Method: "GET", URL: "https://api.tgcloud.io/solution", Status: 401}},
+		Output:    "You should re-login\n",
+	}
+	path, err := b.save(dir)
+	if err != nil || filepath.Base(path) != "capture-20240301-120000.tar.gz" {
+		t.Fatalf("save returned %s, %v", path, err)
+	}
+	if second, _ := b.save(dir); filepath.Base(second) != "capture-20240301-120000-2.tar.gz" {
+		t.Errorf("Expected a second capture in the same second to get its own file, got %s", second)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %v", info.Mode().Perm())
+	}
+
+	loaded, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if !reflect.DeepEqual(loaded.Info.Command, b.Info.Command) || loaded.Output != b.Output || len(loaded.Exchanges) != 1 || loaded.Config.Settings["default"] != "prod" {
+		t.Errorf("Unexpected bundle %+v", loaded)
+	}
+	summary := loaded.summary()
+	if !strings.Contains(summary, "Command:  tg cloud list") || !strings.Contains(summary, "GET    https://api.tgcloud.io/solution  401") {
+		t.Errorf("Unexpected summary:\n%s", summary)
+	}
+
+	if _, err := Load(filepath.Join(dir, "missing.tar.gz")); err == nil {
+		t.Error("Expected a missing bundle to fail")
+	}
+	notBundle := filepath.Join(dir, "notes.txt")
+	os.WriteFile(notBundle, []byte("hello"), 0600)
+	if _, err := Load(notBundle); err == nil || !strings.Contains(err.Error(), "not a capture bundle") {
+		t.Errorf("Expected a file that is not a bundle to be refused, got %v", err)
+	}
+}
+
+func TestReplayArgs(t *testing.T) {
+	info := Info{Command: []string{"server", "query", "--alias=prod", "--password=***", "friends", "--", "-x"}, Redacted: []string{"password"}}
+	expected := []string{"server", "query", "--alias=prod", "friends", "--", "-x"}
+	if got := replayArgs(info); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+}
+
+func TestRunCapture(t *testing.T) {
+	originalDir, originalRun, originalNow := constants.ConfigDir, runCommand, helpers.Now
+	defer func() { constants.ConfigDir, runCommand, helpers.Now = originalDir, originalRun, originalNow }()
+	constants.ConfigDir = t.TempDir()
+	helpers.Now = func() time.Time { return time.Date(2024, 3, 1, 12, 0, 0, 0, time.Local) }
+
+	var ran []string
+	runCommand = func(args, env []string, stdout, stderr io.Writer) (int, error) {
+		ran = args
+		dir := strings.TrimPrefix(env[0], CaptureDirEnv+"=")
+		writeChildFiles(t, dir, invocation{Args: args}, Config{}, nil,
+			[]Exchange{{Method: "GET", URL: "https://api.tgcloud.io/solution", Status: 200, RequestHeader: http.Header{"Authorization": {"Bearer abcdefgh"}}}})
+		io.WriteString(stdout, "listed\n")
+		io.WriteString(stderr, "token abcdefgh\n")
+		return 0, nil
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("review", false, "")
+	RunCapture(cmd, []string{"tg", "cloud", "list"})
+
+	if !reflect.DeepEqual(ran, []string{"cloud", "list"}) {
+		t.Errorf("Expected tg cloud list to run, ran %q", ran)
+	}
+	b, err := Load(filepath.Join(capturesDir(), "capture-20240301-120000.tar.gz"))
+	if err != nil {
+		t.Fatalf("Expected a saved capture: %v", err)
+	}
+	if b.Output != "listed\ntoken ***\n" || len(b.Exchanges) != 1 || b.Info.TgVersion != constants.VERSION_CLI {
+		t.Errorf("Unexpected capture %+v", b)
+	}
+}
@@ -0,0 +1,213 @@
+package capture
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"sync"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// runCommand runs tg with args and the extra environment variables env,
+// copying its output to stdout and stderr, and returns its exit code.
+// Tests replace it.
+var runCommand = func(args, env []string, stdout, stderr io.Writer) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	child := exec.Command(executable, args...)
+	child.Env = append(os.Environ(), env...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, stdout, stderr
+	err = child.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code > 0 {
+			return code, nil
+		}
+		return 1, nil
+	}
+	return 0, err
+}
+
+// capturesDir is where bundles are saved.
+func capturesDir() string {
+	return filepath.Join(constants.ConfigDir, "captures")
+}
+
+// lockedBuffer collects the command's stdout and stderr, which are copied
+// from two goroutines.
+type lockedBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *lockedBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func (b *lockedBuffer) String() string {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.String()
+}
+
+// RunCapture runs a tg command in record mode, saves what it sent,
+// received and printed as a bundle, and exits with the command's exit
+// code.
+func RunCapture(cmd *cobra.Command, args []string) {
+	review, _ := cmd.Flags().GetBool("review")
+	if len(args) > 0 && args[0] == "tg" {
+		args = args[1:]
+	}
+	if len(args) == 0 {
+		fmt.Fprintln(helpers.Stdout(), "Error: give the command to capture after --, e.g. tg debug capture -- cloud list")
+		helpers.Exit(1)
+	}
+	if args[0] == "debug" {
+		fmt.Fprintln(helpers.Stdout(), "Error: tg debug commands cannot be captured")
+		helpers.Exit(1)
+	}
+
+	dir, err := os.MkdirTemp("", "tgcli-capture-")
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	info := Info{
+		Version:   formatVersion,
+		Time:      helpers.Now(),
+		TgVersion: constants.VERSION_CLI,
+		OS:        runtime.GOOS,
+		Arch:      runtime.GOARCH,
+		GoVersion: runtime.Version(),
+	}
+	output := &lockedBuffer{}
+	info.Exit, err = runCommand(args, []string{CaptureDirEnv + "=" + dir}, io.MultiWriter(helpers.Stdout(), output), io.MultiWriter(os.Stderr, output))
+	if err != nil {
+		os.RemoveAll(dir)
+		fmt.Fprintf(helpers.Stdout(), "Error: running tg: %v\n", err)
+		helpers.Exit(1)
+	}
+
+	bundle, err := collect(dir, info, output.String())
+	os.RemoveAll(dir)
+	var path string
+	if err == nil {
+		path, err = bundle.save(capturesDir())
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: saving the capture: %v\n", err)
+		helpers.Exit(max(info.Exit, 1))
+	}
+
+	fmt.Fprintf(os.Stderr, "\nCapture saved to %s\n", path)
+	fmt.Fprintln(os.Stderr, "Credentials were removed, but it holds the command's requests, responses and output, which may include your data. Review it before sharing it.")
+	if review {
+		fmt.Fprint(os.Stderr, "\n"+bundle.summary())
+	} else {
+		fmt.Fprintln(os.Stderr, "Run with --review to list every captured URL.")
+	}
+	if info.Exit != 0 {
+		helpers.Exit(info.Exit)
+	}
+}
+
+// replayArgs returns the command line of a capture without the flags whose
+// values were not stored; replayed requests do not need credentials.
+func replayArgs(info Info) []string {
+	redacted := make(map[string]bool)
+	for _, name := range info.Redacted {
+		redacted[name] = true
+	}
+	var args []string
+	for i, arg := range info.Command {
+		if arg == "--" {
+			return append(args, info.Command[i:]...)
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if strings.HasPrefix(arg, "--") && redacted[name] {
+			continue
+		}
+		args = append(args, arg)
+	}
+	return args
+}
+
+// RunReplay runs the command of a capture again, with its recorded config
+// and its requests answered from the capture, and exits with its exit
+// code.
+func RunReplay(cmd *cobra.Command, args []string) {
+	path, err := filepath.Abs(args[0])
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	bundle, err := Load(path)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	if len(bundle.Info.Command) == 0 {
+		fmt.Fprintf(helpers.Stdout(), "Error: %s has no command to replay; it failed before running\n", path)
+		helpers.Exit(1)
+	}
+
+	// The command runs against a home of its own holding the recorded
+	// config and a placeholder tgcloud token.
+	home, err := os.MkdirTemp("", "tgcli-replay-")
+	if err == nil {
+		err = writeReplayHome(home, bundle.Config)
+	}
+	if err != nil {
+		os.RemoveAll(home)
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+
+	replayed := replayArgs(bundle.Info)
+	fmt.Fprintf(os.Stderr, "Replaying tg %s (exit %d when captured) with %d recorded requests\n",
+		strings.Join(replayed, " "), bundle.Info.Exit, len(bundle.Exchanges))
+	code, err := runCommand(replayed, []string{"TGCLI_HOME=" + home, ReplayEnv + "=" + path}, helpers.Stdout(), os.Stderr)
+	os.RemoveAll(home)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: running tg: %v\n", err)
+		helpers.Exit(1)
+	}
+	if code != 0 {
+		helpers.Exit(code)
+	}
+}
+
+// writeReplayHome writes config as the config file of a tg home in dir,
+// and a stored tgcloud token for its endpoint.
+func writeReplayHome(dir string, config Config) error {
+	settings := config.Settings
+	if settings == nil {
+		settings = map[string]interface{}{}
+	}
+	data, err := yaml.Marshal(settings)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(filepath.Join(dir, "config.yml"), data, 0600); err != nil {
+		return err
+	}
+	endpoint := config.TGCloudBaseURL
+	if endpoint == "" {
+		endpoint = constants.TGCLOUD_DEFAULT_BASE_URL
+	}
+	return helpers.WriteCredentials(filepath.Join(dir, "creds.bank"), "replayed-token", endpoint)
+}
@@ -0,0 +1,101 @@
+package capture
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// startReplay answers every request from now on from the exchanges of the
+// bundle at path.
+func startReplay(path string) error {
+	b, err := Load(path)
+	if err != nil {
+		return err
+	}
+	replay := newReplayTransport(b.Exchanges)
+	wrap := helpers.WrapTransport
+	helpers.WrapTransport = func(http.RoundTripper) http.RoundTripper {
+		return wrap(replay)
+	}
+	return nil
+}
+
+// replayTransport answers requests with recorded responses instead of
+// sending them. A request gets the first unused exchange with the same
+// method and path, so a command that polls sees the recorded responses in
+// order, and the last of them once they are used up. Hosts are not
+// compared, so a capture replays without the aliases it was made with.
+type replayTransport struct {
+	mu        sync.Mutex
+	exchanges []Exchange
+	used      []bool
+}
+
+func newReplayTransport(exchanges []Exchange) *replayTransport {
+	return &replayTransport{exchanges: exchanges, used: make([]bool, len(exchanges))}
+}
+
+func (t *replayTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Body != nil {
+		io.Copy(io.Discard, req.Body)
+		req.Body.Close()
+	}
+	e, ok := t.next(req.Method, req.URL.Path)
+	if !ok {
+		return nil, fmt.Errorf("no recorded response for %s %s", req.Method, req.URL.Path)
+	}
+	if e.Error != "" {
+		return nil, fmt.Errorf("%s", e.Error)
+	}
+	header := e.ResponseHeader.Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	// The body may have changed length when credentials were removed.
+	header.Del("Content-Length")
+	return &http.Response{
+		Status:        fmt.Sprintf("%d %s", e.Status, http.StatusText(e.Status)),
+		StatusCode:    e.Status,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        header,
+		Body:          io.NopCloser(strings.NewReader(e.ResponseBody)),
+		ContentLength: int64(len(e.ResponseBody)),
+		Request:       req,
+	}, nil
+}
+
+func (t *replayTransport) next(method, path string) (Exchange, bool) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	last := -1
+	for i, e := range t.exchanges {
+		if e.Method != method || exchangePath(e.URL) != path {
+			continue
+		}
+		if !t.used[i] {
+			t.used[i] = true
+			return e, true
+		}
+		last = i
+	}
+	if last < 0 {
+		return Exchange{}, false
+	}
+	return t.exchanges[last], true
+}
+
+func exchangePath(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil {
+		return ""
+	}
+	return u.Path
+}
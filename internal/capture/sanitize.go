@@ -0,0 +1,233 @@
+package capture
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// minSecret is the length below which a credential is not searched for
+// everywhere in the bundle: shorter values would match unrelated text. It
+// is still hidden where it was found, e.g. in a header or a URL.
+const minSecret = 4
+
+// sanitize removes credentials from everything in b. Values that are
+// credentials by their place, such as the Authorization and Cookie headers,
+// password fields of JSON bodies and config, sensitive query parameters and
+// passwords in URLs, are gathered first along with secrets, the
+// credentials given as flags. Those places are then replaced by ***, and
+// every other occurrence of the gathered values, e.g. a token echoed in a
+// response or printed by the command, is replaced too. GSQL sent to the
+// server is scrubbed like the shell's history, so the password of a
+// CREATE USER statement is hidden as well.
+func sanitize(b *Bundle, secrets []string) {
+	s := &scrubber{secrets: make(map[string]bool)}
+	statements, _ := helpers.ScrubPatterns()
+	for _, secret := range secrets {
+		s.add(secret)
+	}
+	mapStrings(b.Config.Settings, "", func(key, value string) string {
+		if helpers.SensitiveName(key) {
+			s.add(value)
+		}
+		return value
+	})
+	for _, e := range b.Exchanges {
+		s.addURL(e.URL)
+		s.addHeader(e.RequestHeader)
+		s.addHeader(e.ResponseHeader)
+		s.addBody(e.RequestBody)
+		s.addBody(e.ResponseBody)
+	}
+
+	for i := range b.Exchanges {
+		e := &b.Exchanges[i]
+		e.URL = s.scrub(helpers.Redact(e.URL))
+		s.redactHeader(e.RequestHeader)
+		s.redactHeader(e.ResponseHeader)
+		if isGSQLFile(e.URL) {
+			e.RequestBody = helpers.ScrubStatement(e.RequestBody, statements)
+		}
+		e.RequestBody = s.scrub(e.RequestBody)
+		e.ResponseBody = s.scrub(e.ResponseBody)
+		e.Error = s.scrub(helpers.Redact(e.Error))
+	}
+	if settings, ok := mapStrings(b.Config.Settings, "", s.redactField).(map[string]interface{}); ok {
+		b.Config.Settings = settings
+	}
+	b.Config.File = s.scrub(b.Config.File)
+	b.Config.TGCloudBaseURL = s.scrub(helpers.Redact(b.Config.TGCloudBaseURL))
+	for i, arg := range b.Info.Command {
+		b.Info.Command[i] = s.scrub(arg)
+	}
+	b.Output = s.scrub(b.Output)
+}
+
+// scrubber replaces known credentials wherever they appear.
+type scrubber struct {
+	secrets map[string]bool
+	sorted  []string
+}
+
+// add records a credential, along with the forms it takes escaped in a
+// URL or a JSON string.
+func (s *scrubber) add(value string) {
+	value = strings.TrimSpace(value)
+	if len(value) < minSecret {
+		return
+	}
+	quoted, _ := json.Marshal(value)
+	for _, form := range []string{value, url.QueryEscape(value), url.PathEscape(value), string(quoted[1 : len(quoted)-1])} {
+		s.secrets[form] = true
+	}
+	s.sorted = nil
+}
+
+// addURL records the password and the sensitive query parameters of raw.
+func (s *scrubber) addURL(raw string) {
+	s.add(urlPassword(raw))
+	if u, err := url.Parse(raw); err == nil {
+		s.addValues(u.Query())
+	}
+}
+
+func (s *scrubber) addValues(values url.Values) {
+	for name, list := range values {
+		if helpers.SensitiveName(name) {
+			for _, value := range list {
+				s.add(value)
+			}
+		}
+	}
+}
+
+// addHeader records the values of credential headers: all of the value,
+// the part after the scheme of "Bearer <token>", and the cookie values of
+// Cookie and Set-Cookie.
+func (s *scrubber) addHeader(header http.Header) {
+	for name, values := range header {
+		if !helpers.SensitiveName(name) {
+			continue
+		}
+		for _, value := range values {
+			s.add(value)
+			switch http.CanonicalHeaderKey(name) {
+			case "Cookie":
+				for _, cookie := range strings.Split(value, ";") {
+					_, v, _ := strings.Cut(cookie, "=")
+					s.add(v)
+				}
+			case "Set-Cookie":
+				cookie, _, _ := strings.Cut(value, ";")
+				_, v, _ := strings.Cut(cookie, "=")
+				s.add(v)
+			default:
+				if _, credentials, ok := strings.Cut(value, " "); ok {
+					s.add(credentials)
+				}
+			}
+		}
+	}
+}
+
+// addBody records the credential fields of a JSON or form-encoded body.
+func (s *scrubber) addBody(body string) {
+	trimmed := strings.TrimSpace(body)
+	var v interface{}
+	if (strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[")) && json.Unmarshal([]byte(trimmed), &v) == nil {
+		mapStrings(v, "", func(key, value string) string {
+			if helpers.SensitiveName(key) {
+				s.add(value)
+			}
+			return value
+		})
+		return
+	}
+	if values, err := url.ParseQuery(trimmed); err == nil {
+		s.addValues(values)
+	}
+}
+
+// scrub replaces every recorded credential in text, longest first so that
+// a secret containing another is replaced whole.
+func (s *scrubber) scrub(text string) string {
+	if s.sorted == nil {
+		for secret := range s.secrets {
+			s.sorted = append(s.sorted, secret)
+		}
+		sort.Slice(s.sorted, func(i, j int) bool {
+			if len(s.sorted[i]) != len(s.sorted[j]) {
+				return len(s.sorted[i]) > len(s.sorted[j])
+			}
+			return s.sorted[i] < s.sorted[j]
+		})
+	}
+	for _, secret := range s.sorted {
+		text = strings.ReplaceAll(text, secret, "***")
+	}
+	return text
+}
+
+// redactHeader replaces the values of credential headers by *** and
+// scrubs the others.
+func (s *scrubber) redactHeader(header http.Header) {
+	for name, values := range header {
+		for i, value := range values {
+			if helpers.SensitiveName(name) {
+				values[i] = "***"
+			} else {
+				values[i] = s.scrub(value)
+			}
+		}
+	}
+}
+
+// redactField replaces a config value named like a credential by *** and
+// scrubs the others.
+func (s *scrubber) redactField(key, value string) string {
+	if helpers.SensitiveName(key) && value != "" {
+		return "***"
+	}
+	return s.scrub(value)
+}
+
+// mapStrings calls fn on every string in v, a decoded JSON value, with the
+// key of the object field holding it, and returns v with the strings fn
+// returns. Strings in arrays get the key of the array.
+func mapStrings(v interface{}, key string, fn func(key, value string) string) interface{} {
+	switch v := v.(type) {
+	case string:
+		return fn(key, v)
+	case map[string]interface{}:
+		for k, value := range v {
+			v[k] = mapStrings(value, k, fn)
+		}
+	case []interface{}:
+		for i, value := range v {
+			v[i] = mapStrings(value, key, fn)
+		}
+	}
+	return v
+}
+
+// isGSQLFile reports whether raw is the GSQL server's file endpoint, whose
+// request body is the GSQL being run.
+func isGSQLFile(raw string) bool {
+	u, err := url.Parse(raw)
+	return err == nil && u.Path == constants.GSQL_PATH+constants.FILE_ENDPOINT
+}
+
+// urlPassword returns the password in the user info of a URL, if any.
+func urlPassword(raw string) string {
+	u, err := url.Parse(raw)
+	if err != nil || u.User == nil {
+		return ""
+	}
+	password, _ := u.User.Password()
+	return password
+}
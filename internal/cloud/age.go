@@ -0,0 +1,68 @@
+package cloud
+
+import (
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// staleAge is the --older-than that --stale stands for.
+const staleAge = 7 * 24 * time.Hour
+
+// createdAtLayouts are the timestamp layouts tgcloud has used for CreatedAt.
+var createdAtLayouts = []string{time.RFC3339Nano, "2006-01-02 15:04:05", "2006-01-02T15:04:05"}
+
+// machineCreatedAt parses the CreatedAt of a machine.
+func machineCreatedAt(machine models.Machine) (time.Time, bool) {
+	for _, layout := range createdAtLayouts {
+		if created, err := time.Parse(layout, machine.CreatedAt); err == nil {
+			return created, true
+		}
+	}
+	return time.Time{}, false
+}
+
+// olderThan keeps the machines created at least age before now. Machines
+// whose creation time cannot be read are left out and returned separately
+// so callers can say so rather than drop them silently.
+func olderThan(machines []models.Machine, age time.Duration, now time.Time) (kept, unknown []models.Machine) {
+	for _, machine := range machines {
+		created, ok := machineCreatedAt(machine)
+		if !ok {
+			unknown = append(unknown, machine)
+			continue
+		}
+		if now.Sub(created) >= age {
+			kept = append(kept, machine)
+		}
+	}
+	return kept, unknown
+}
+
+// matchesState reports whether machine is in one of states, ignoring case.
+// An empty list matches every state.
+func matchesState(machine models.Machine, states []string) bool {
+	if len(states) == 0 {
+		return true
+	}
+	for _, state := range states {
+		if strings.EqualFold(machine.State, state) {
+			return true
+		}
+	}
+	return false
+}
+
+// listAge resolves --older-than and --stale into a minimum age, or zero
+// when neither was given.
+func listAge(olderThanFlag string, stale bool) (time.Duration, error) {
+	if olderThanFlag != "" {
+		return helpers.ParseAge(olderThanFlag)
+	}
+	if stale {
+		return staleAge, nil
+	}
+	return 0, nil
+}
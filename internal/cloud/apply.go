@@ -0,0 +1,386 @@
+package cloud
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// tg cloud apply reads a plan of machine operations as NDJSON, one object
+// per line, and writes one NDJSON result per plan line, in plan order.
+//
+// Input, schema version 1:
+//
+//	action  start, stop, terminate, archive or unarchive
+//	id      instance ID, @N or last
+//	name    solution name
+//
+// Each line needs an action and an id or a name; other fields are
+// rejected. Output, schema version 1, in this field order:
+//
+//	v       applySchemaVersion
+//	line    plan line number
+//	action  the requested action
+//	id      resolved instance ID, when known
+//	name    solution name, when known
+//	state   state before the action, when known
+//	status  ok, error, skipped or planned (--dry-run)
+//	error   why the action failed or was skipped
+//
+// Fields are only ever added within a schema version.
+const applySchemaVersion = 1
+
+const (
+	applyOK      = "ok"
+	applyError   = "error"
+	applySkipped = "skipped"
+	applyPlanned = "planned"
+)
+
+// applyStep is one line of a plan.
+type applyStep struct {
+	Action string `json:"action"`
+	ID     string `json:"id"`
+	Name   string `json:"name"`
+}
+
+// applyResult is the outcome of one plan line.
+type applyResult struct {
+	V      int    `json:"v"`
+	Line   int    `json:"line"`
+	Action string `json:"action"`
+	ID     string `json:"id,omitempty"`
+	Name   string `json:"name,omitempty"`
+	State  string `json:"state,omitempty"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// applyEntry is a plan line resolved against the solution list.
+type applyEntry struct {
+	Line    int
+	Step    applyStep
+	Machine models.Machine
+	Err     error
+}
+
+type applyOptions struct {
+	Parallel int
+	DryRun   bool
+	FailFast bool
+}
+
+// planError lists the malformed lines of a plan.
+type planError struct {
+	Lines []string
+}
+
+func (e *planError) Error() string {
+	return fmt.Sprintf("the plan has %d invalid lines, nothing was run:\n  %s", len(e.Lines), strings.Join(e.Lines, "\n  "))
+}
+
+// parsePlan reads every line of a plan and reports all malformed lines at
+// once. Blank lines are skipped. Whether an action is known, and whether
+// its instance exists, is decided per line later.
+func parsePlan(r io.Reader) ([]applyEntry, error) {
+	var entries []applyEntry
+	var invalid []string
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+		var step applyStep
+		decoder := json.NewDecoder(strings.NewReader(text))
+		decoder.DisallowUnknownFields()
+		err := decoder.Decode(&step)
+		switch {
+		case err != nil:
+			invalid = append(invalid, fmt.Sprintf("line %d: %s", line, describeDecodeError(err)))
+		case decoder.More():
+			invalid = append(invalid, fmt.Sprintf("line %d: more than one JSON value", line))
+		case step.Action == "":
+			invalid = append(invalid, fmt.Sprintf("line %d: missing action", line))
+		case step.ID == "" && step.Name == "":
+			invalid = append(invalid, fmt.Sprintf("line %d: missing id or name", line))
+		default:
+			entries = append(entries, applyEntry{Line: line, Step: step})
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(invalid) > 0 {
+		return nil, &planError{Lines: invalid}
+	}
+	if len(entries) == 0 {
+		return nil, errors.New("the plan has no actions")
+	}
+	return entries, nil
+}
+
+// describeDecodeError phrases a JSON decoding error without Go type names.
+func describeDecodeError(err error) string {
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &typeErr) && typeErr.Field == "":
+		return "expected a JSON object, got " + typeErr.Value
+	case errors.As(err, &typeErr):
+		return fmt.Sprintf("%s must be a string, got %s", typeErr.Field, typeErr.Value)
+	case strings.HasPrefix(err.Error(), "json: "):
+		return strings.TrimPrefix(err.Error(), "json: ")
+	default:
+		return "invalid JSON: " + err.Error()
+	}
+}
+
+// resolvePlan finds the instance of every entry. Problems with one line,
+// such as an unknown action or instance, are recorded on that entry.
+func resolvePlan(entries []applyEntry, machines []models.Machine) {
+	byID := make(map[string]models.Machine, len(machines))
+	byName := make(map[string][]models.Machine)
+	for _, machine := range machines {
+		byID[machine.ID] = machine
+		byName[machine.Name] = append(byName[machine.Name], machine)
+	}
+
+	for i := range entries {
+		entry := &entries[i]
+		var problems []string
+		if _, ok := machineStates[entry.Step.Action]; !ok {
+			problems = append(problems, fmt.Sprintf("unknown action %q", entry.Step.Action))
+		}
+
+		var fromID, fromName *models.Machine
+		if entry.Step.ID != "" {
+			id, err := resolveMachineRef(entry.Step.ID)
+			if err != nil {
+				problems = append(problems, err.Error())
+			} else if machine, ok := byID[id]; ok {
+				fromID = &machine
+			} else {
+				problems = append(problems, fmt.Sprintf("instance %s not found", entry.Step.ID))
+			}
+		}
+		if entry.Step.Name != "" {
+			switch named := byName[entry.Step.Name]; len(named) {
+			case 0:
+				problems = append(problems, fmt.Sprintf("no solution is named %q", entry.Step.Name))
+			case 1:
+				fromName = &named[0]
+			default:
+				problems = append(problems, fmt.Sprintf("%d solutions are named %q; use the id", len(named), entry.Step.Name))
+			}
+		}
+
+		switch {
+		case fromID != nil && fromName != nil && fromID.ID != fromName.ID:
+			problems = append(problems, fmt.Sprintf("id %s and name %q refer to different instances", entry.Step.ID, entry.Step.Name))
+		case fromID != nil:
+			entry.Machine = *fromID
+		case fromName != nil:
+			entry.Machine = *fromName
+		}
+		if len(problems) > 0 {
+			entry.Err = errors.New(strings.Join(problems, "; "))
+		}
+	}
+}
+
+func (e applyEntry) result(status string, err error) applyResult {
+	result := applyResult{
+		V:      applySchemaVersion,
+		Line:   e.Line,
+		Action: e.Step.Action,
+		ID:     e.Machine.ID,
+		Name:   e.Machine.Name,
+		State:  e.Machine.State,
+		Status: status,
+	}
+	if err != nil {
+		result.Error = err.Error()
+	}
+	return result
+}
+
+// resultWriter writes results in plan order however they complete.
+type resultWriter struct {
+	mu      sync.Mutex
+	w       io.Writer
+	results []*applyResult
+	next    int
+}
+
+func (rw *resultWriter) set(index int, result applyResult) {
+	rw.mu.Lock()
+	defer rw.mu.Unlock()
+	rw.results[index] = &result
+	for rw.next < len(rw.results) && rw.results[rw.next] != nil {
+		data, _ := json.Marshal(rw.results[rw.next])
+		rw.w.Write(append(data, '\n'))
+		rw.next++
+	}
+}
+
+// executePlan runs the resolved entries on a pool of opts.Parallel
+// workers. Entries for the same instance run one after another in plan
+// order; different instances run concurrently. It returns how many
+// entries did not succeed.
+func executePlan(entries []applyEntry, opts applyOptions, out io.Writer, run func(applyEntry) error) int {
+	rw := &resultWriter{w: out, results: make([]*applyResult, len(entries))}
+
+	failed := 0
+	for _, entry := range entries {
+		if entry.Err != nil {
+			failed++
+		}
+	}
+	if opts.DryRun || (opts.FailFast && failed > 0) {
+		for i, entry := range entries {
+			switch {
+			case entry.Err != nil:
+				rw.set(i, entry.result(applyError, entry.Err))
+			case opts.DryRun:
+				rw.set(i, entry.result(applyPlanned, nil))
+			default:
+				failed++
+				rw.set(i, entry.result(applySkipped, errors.New("not run: another line of the plan has an error (--fail-fast)")))
+			}
+		}
+		return failed
+	}
+
+	// Group the entries into chains, one per instance, in plan order.
+	var chains [][]int
+	chainOf := make(map[string]int)
+	for i, entry := range entries {
+		if entry.Err != nil {
+			rw.set(i, entry.result(applyError, entry.Err))
+			continue
+		}
+		c, ok := chainOf[entry.Machine.ID]
+		if !ok {
+			c = len(chains)
+			chainOf[entry.Machine.ID] = c
+			chains = append(chains, nil)
+		}
+		chains[c] = append(chains[c], i)
+	}
+
+	var mu sync.Mutex
+	stopped := false
+	work := make(chan []int)
+	var wg sync.WaitGroup
+	for w := 0; w < opts.Parallel; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for chain := range work {
+				for _, i := range chain {
+					mu.Lock()
+					skip := stopped
+					mu.Unlock()
+					if skip {
+						mu.Lock()
+						failed++
+						mu.Unlock()
+						rw.set(i, entries[i].result(applySkipped, errors.New("not run: another action failed (--fail-fast)")))
+						continue
+					}
+					if err := run(entries[i]); err != nil {
+						mu.Lock()
+						failed++
+						stopped = stopped || opts.FailFast
+						mu.Unlock()
+						rw.set(i, entries[i].result(applyError, err))
+						continue
+					}
+					rw.set(i, entries[i].result(applyOK, nil))
+				}
+			}
+		}()
+	}
+	for _, chain := range chains {
+		work <- chain
+	}
+	close(work)
+	wg.Wait()
+	return failed
+}
+
+// applyPlan reads a plan from in and writes its results to out. It
+// returns how many lines did not succeed.
+func applyPlan(in io.Reader, out io.Writer, opts applyOptions) (int, error) {
+	if opts.Parallel < 1 {
+		return 0, fmt.Errorf("--parallel must be at least 1")
+	}
+	entries, err := parsePlan(in)
+	if err != nil {
+		return 0, err
+	}
+
+	bearerToken, err := getBearerToken()
+	if err != nil {
+		return 0, err
+	}
+	machines, status, err := fetchMachines(bearerToken)
+	if status == 401 {
+		return 0, fmt.Errorf("tgcloud rejected the token, please re-login%s", expiredTokenHint(bearerToken))
+	}
+	if err != nil {
+		return 0, err
+	}
+	resolvePlan(entries, machines)
+
+	client := helpers.NewHTTPClient(30 * time.Second)
+	return executePlan(entries, opts, out, func(entry applyEntry) error {
+		_, err := requestMachineOperation(client, bearerToken, entry.Step.Action, entry.Machine.ID, nil)
+		return err
+	}), nil
+}
+
+// RunApply runs a plan of machine operations read from --file or stdin.
+// Results go to stdout as NDJSON; errors that stop the whole plan go to
+// stderr. It exits 1 unless every line succeeded.
+func RunApply(cmd *cobra.Command, args []string) {
+	file, _ := cmd.Flags().GetString("file")
+	parallel, _ := cmd.Flags().GetInt("parallel")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	failFast, _ := cmd.Flags().GetBool("fail-fast")
+
+	var in io.Reader = os.Stdin
+	if file != "" && file != "-" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		in = bytes.NewReader(data)
+	}
+
+	failed, err := applyPlan(in, helpers.Stdout(), applyOptions{Parallel: parallel, DryRun: dryRun, FailFast: failFast})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if failed > 0 {
+		helpers.Fail(helpers.ExitFailure)
+	}
+}
@@ -0,0 +1,227 @@
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/outputtest"
+)
+
+// applyPlanInput exercises every per-line outcome. Line 3 is blank.
+var applyPlanInput = strings.Join([]string{
+	`{"action":"stop","id":"a1b2c3d4-0000-1111-2222-333344445555"}`,
+	`{"action":"start","name":"staging-cluster-with-a-long-name"}`,
+	``,
+	`{"action":"reboot","name":"production"}`,
+	`{"action":"stop","id":"not-an-instance"}`,
+	`{"action":"stop","id":"a1b2c3d4-0000-1111-2222-333344445555","name":"cold-storage"}`,
+	`{"action":"unarchive","id":"c3d4e5f6-0000-1111-2222-333344445555","name":"cold-storage"}`,
+}, "\n")
+
+// useApplyCloud serves the Machines fixtures and records the operations
+// requested; operations on cold-storage fail.
+func useApplyCloud(t *testing.T) *[]string {
+	var mu sync.Mutex
+	calls := []string{}
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/solution" {
+			result, _ := json.Marshal(map[string]interface{}{"Error": false, "Result": outputtest.Machines()})
+			w.Write(result)
+			return
+		}
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		if strings.HasSuffix(r.URL.Path, "c3d4e5f6-0000-1111-2222-333344445555") {
+			w.WriteHeader(http.StatusInternalServerError)
+			w.Write([]byte(`{"Message":"restore quota exceeded"}`))
+			return
+		}
+		w.Write([]byte(`{"Message":"ok"}`))
+	}))
+	t.Cleanup(mockServer.Close)
+	useMockCloud(t, mockServer.URL)
+	return &calls
+}
+
+func TestApplyGolden(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	calls := useApplyCloud(t)
+
+	var out bytes.Buffer
+	failed, err := applyPlan(strings.NewReader(applyPlanInput), &out, applyOptions{Parallel: 1})
+	if err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	if failed != 4 {
+		t.Errorf("Expected 4 failed lines, got %d", failed)
+	}
+	outputtest.AssertGolden(t, "apply_results", out.Bytes())
+
+	expected := []string{
+		"POST /solution/stop/a1b2c3d4-0000-1111-2222-333344445555",
+		"POST /solution/start/b2c3d4e5-0000-1111-2222-333344445555",
+		"POST /solution/unarchive/c3d4e5f6-0000-1111-2222-333344445555",
+	}
+	if strings.Join(*calls, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected calls %v, got %v", expected, *calls)
+	}
+}
+
+func TestApplyDryRunGolden(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	calls := useApplyCloud(t)
+
+	var out bytes.Buffer
+	if _, err := applyPlan(strings.NewReader(applyPlanInput), &out, applyOptions{Parallel: 4, DryRun: true}); err != nil {
+		t.Fatalf("applyPlan: %v", err)
+	}
+	outputtest.AssertGolden(t, "apply_dry_run", out.Bytes())
+	if len(*calls) != 0 {
+		t.Errorf("--dry-run should not act, got %v", *calls)
+	}
+}
+
+func TestApplyInvalidPlanGolden(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	calls := useApplyCloud(t)
+
+	plan := strings.Join([]string{
+		`{"action":"stop","id":"a1b2c3d4-0000-1111-2222-333344445555"}`,
+		`{"action":"stop","id":`,
+		`{"action":"stop"}`,
+		`{"id":"a1b2c3d4-0000-1111-2222-333344445555"}`,
+		`{"action":"stop","id":"x","force":true}`,
+		`["stop","x"]`,
+		`{"action":"stop","id":42}`,
+		`{"action":"stop","id":"x"} {"action":"start","id":"x"}`,
+	}, "\n")
+	var out bytes.Buffer
+	_, err := applyPlan(strings.NewReader(plan), &out, applyOptions{Parallel: 1})
+	if err == nil {
+		t.Fatal("Expected the plan to be rejected")
+	}
+	outputtest.AssertGolden(t, "apply_invalid", []byte(err.Error()+"\n"))
+	if out.Len() != 0 || len(*calls) != 0 {
+		t.Errorf("Nothing should run or be printed for an invalid plan, got %v:\n%s", *calls, out.String())
+	}
+
+	if _, err := applyPlan(strings.NewReader("\n\n"), &out, applyOptions{Parallel: 1}); err == nil || err.Error() != "the plan has no actions" {
+		t.Errorf("Expected an empty plan to be rejected, got %v", err)
+	}
+}
+
+func TestApplyFailFast(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+	calls := useApplyCloud(t)
+
+	statuses := func(out string) string {
+		var got []string
+		for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+			var result applyResult
+			json.Unmarshal([]byte(line), &result)
+			got = append(got, fmt.Sprintf("%d:%s", result.Line, result.Status))
+		}
+		return strings.Join(got, ",")
+	}
+
+	// A line that cannot be resolved stops the plan before anything runs.
+	var out bytes.Buffer
+	failed, _ := applyPlan(strings.NewReader(applyPlanInput), &out, applyOptions{Parallel: 4, FailFast: true})
+	if got := statuses(out.String()); got != "1:skipped,2:skipped,4:error,5:error,6:error,7:skipped" {
+		t.Errorf("Unexpected results %s", got)
+	}
+	if failed != 6 || len(*calls) != 0 {
+		t.Errorf("Expected 6 failures and no calls, got %d and %v", failed, *calls)
+	}
+
+	// An operation that fails keeps later lines from starting.
+	plan := strings.Join([]string{
+		`{"action":"start","name":"production"}`,
+		`{"action":"unarchive","name":"cold-storage"}`,
+		`{"action":"stop","name":"staging-cluster-with-a-long-name"}`,
+	}, "\n")
+	out.Reset()
+	failed, _ = applyPlan(strings.NewReader(plan), &out, applyOptions{Parallel: 1, FailFast: true})
+	if got := statuses(out.String()); got != "1:ok,2:error,3:skipped" {
+		t.Errorf("Unexpected results %s", got)
+	}
+	if failed != 2 || len(*calls) != 2 {
+		t.Errorf("Expected 2 failures and 2 calls, got %d and %v", failed, *calls)
+	}
+}
+
+func TestExecutePlanParallel(t *testing.T) {
+	var entries []applyEntry
+	for i := 0; i < 8; i++ {
+		id := fmt.Sprintf("m%d", i%4)
+		entries = append(entries, applyEntry{Line: i + 1, Step: applyStep{Action: "stop", ID: id}, Machine: models.Machine{ID: id}})
+	}
+
+	var mu sync.Mutex
+	running, peak := 0, 0
+	var order []int
+	run := func(entry applyEntry) error {
+		mu.Lock()
+		running++
+		if running > peak {
+			peak = running
+		}
+		order = append(order, entry.Line)
+		mu.Unlock()
+		// Earlier lines take longer, so they complete out of order.
+		time.Sleep(time.Duration(10-entry.Line) * time.Millisecond)
+		mu.Lock()
+		running--
+		mu.Unlock()
+		if entry.Line == 8 {
+			return errors.New("boom")
+		}
+		return nil
+	}
+
+	var out bytes.Buffer
+	if failed := executePlan(entries, applyOptions{Parallel: 2}, &out, run); failed != 1 {
+		t.Errorf("Expected 1 failure, got %d", failed)
+	}
+	if peak > 2 {
+		t.Errorf("At most 2 actions should run at once, saw %d", peak)
+	}
+
+	// Lines for the same instance run in plan order.
+	position := make(map[int]int)
+	for i, line := range order {
+		position[line] = i
+	}
+	for line := 1; line <= 4; line++ {
+		if position[line] > position[line+4] {
+			t.Errorf("Line %d ran before line %d on the same instance: %v", line+4, line, order)
+		}
+	}
+
+	// Results come out in plan order.
+	var lines []string
+	for i, text := range strings.Split(strings.TrimSpace(out.String()), "\n") {
+		var result applyResult
+		if err := json.Unmarshal([]byte(text), &result); err != nil || result.Line != i+1 {
+			t.Fatalf("Result %d out of order: %s", i+1, text)
+		}
+		lines = append(lines, result.Status)
+	}
+	if strings.Join(lines, ",") != "ok,ok,ok,ok,ok,ok,ok,error" {
+		t.Errorf("Unexpected statuses %v", lines)
+	}
+}
@@ -0,0 +1,265 @@
+package cloud
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/events"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/tui"
+)
+
+// bulkVerbs is how the pre-flight summary describes each bulk action.
+var bulkVerbs = map[string]string{
+	"start":     "started",
+	"stop":      "stopped",
+	"terminate": "terminated",
+}
+
+// bulkTarget is one instance a bulk operation acts on.
+type bulkTarget struct {
+	Ref     string
+	Machine models.Machine
+}
+
+// readIDFile reads instance IDs, or @N and last references, one per line.
+// Blank lines and lines starting with # are skipped.
+func readIDFile(path string) ([]string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var refs []string
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		refs = append(refs, line)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	if len(refs) == 0 {
+		return nil, fmt.Errorf("%s lists no instances", path)
+	}
+	return refs, nil
+}
+
+// resolveBulkTargets resolves every reference and looks it up in the
+// solution list, so the summary can show names and states. An unknown ID
+// fails the whole operation before anything is touched; an instance listed
+// twice is only acted on once.
+func resolveBulkTargets(refs []string, machines []models.Machine) ([]bulkTarget, error) {
+	byID := make(map[string]models.Machine, len(machines))
+	for _, machine := range machines {
+		byID[machine.ID] = machine
+	}
+
+	var targets []bulkTarget
+	seen := make(map[string]bool)
+	for _, ref := range refs {
+		id, err := resolveMachineRef(ref)
+		if err != nil {
+			return nil, err
+		}
+		machine, ok := byID[id]
+		if !ok {
+			return nil, fmt.Errorf("instance %s not found in your tgcloud solutions", ref)
+		}
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		targets = append(targets, bulkTarget{Ref: ref, Machine: machine})
+	}
+	return targets, nil
+}
+
+// formatBulkSummary renders the pre-flight summary of a bulk operation:
+// every instance that will be affected, with its current state.
+func formatBulkSummary(action string, targets []bulkTarget) string {
+	var b strings.Builder
+	noun := "instances"
+	if len(targets) == 1 {
+		noun = "instance"
+	}
+	fmt.Fprintf(&b, "%d %s will be %s:\n", len(targets), noun, bulkVerbs[action])
+	for _, target := range targets {
+		name := target.Machine.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		fmt.Fprintf(&b, "  %-10s %-30s %s  [%s]\n", action, name, target.Machine.ID, target.Machine.State)
+	}
+	return b.String()
+}
+
+// runBulkOperation applies action to every instance in --id-file after a
+// single confirmation, which --yes skips.
+func runBulkOperation(cmd *cobra.Command, action string, params url.Values, emitter *events.Emitter) {
+	idFile, _ := cmd.Flags().GetString("id-file")
+	yes, _ := cmd.Flags().GetBool("yes")
+
+	refs, err := readIDFile(idFile)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	machines, ok := bulkMachines(emitter)
+	if !ok {
+		return
+	}
+	targets, err := resolveBulkTargets(refs, machines)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	// Without --yes the summary goes with the question, to the terminal.
+	summary := emitter.Out()
+	if !yes {
+		summary = emitter.Prompt()
+	}
+	fmt.Fprint(summary, formatBulkSummary(action, targets))
+	if !yes && !confirm(emitter.Prompt(), fmt.Sprintf("%s %d instances?", strings.ToUpper(action[:1])+action[1:], len(targets))) {
+		fmt.Fprintf(emitter.Out(), "Bulk %s cancelled\n", action)
+		emitter.Fail(fmt.Errorf("bulk %s cancelled", action))
+		helpers.Fail(helpers.ExitCancelled)
+		return
+	}
+	applyBulk(action, targets, params, emitter)
+}
+
+// selectorTerminal is where runSelectedOperation shows its selector.
+var selectorTerminal = tui.Open
+
+// RequireMachineSelection stops start, stop and terminate without --id or
+// --id-file, unless there is a terminal to pick the instances on.
+func RequireMachineSelection(cmd *cobra.Command, args []string) error {
+	if cmd.Flags().Changed("id") || cmd.Flags().Changed("id-file") {
+		return nil
+	}
+	if _, ok := selectorTerminal(); !ok {
+		return fmt.Errorf("at least one of the flags in the group [id id-file] is required")
+	}
+	return nil
+}
+
+// selectable reports whether action makes sense for machine: stopping a
+// machine that is running, starting a stopped one, and terminating any
+// that is not terminated yet.
+func selectable(action string, machine models.Machine) bool {
+	state := strings.ToLower(machine.State)
+	switch action {
+	case "start":
+		return state == "stopped"
+	case "stop":
+		return state != "stopped" && state != "terminated" && !isArchived(state)
+	default:
+		return state != "terminated"
+	}
+}
+
+// runSelectedOperation lets the user pick the instances to apply action to
+// on the terminal, then applies it to them. Confirming the selection is
+// the confirmation; picking none cancels.
+func runSelectedOperation(action string, params url.Values, emitter *events.Emitter) {
+	terminal, ok := selectorTerminal()
+	if !ok {
+		err := fmt.Errorf("at least one of the flags in the group [id id-file] is required")
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	machines, ok := bulkMachines(emitter)
+	if !ok {
+		return
+	}
+	var candidates []models.Machine
+	var rows []string
+	for _, machine := range machines {
+		if !selectable(action, machine) {
+			continue
+		}
+		name := machine.Name
+		if name == "" {
+			name = "(unnamed)"
+		}
+		candidates = append(candidates, machine)
+		rows = append(rows, fmt.Sprintf("%-30s %-15s %s", name, machine.Tag, machineState(machine)))
+	}
+	if len(candidates) == 0 {
+		fmt.Fprintf(emitter.Out(), "No instances to %s\n", action)
+		return
+	}
+
+	picked, err := tui.Select(terminal, fmt.Sprintf("Select the instances to %s", action), rows, true)
+	if err != nil && !errors.Is(err, tui.ErrCancelled) {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	// Picking nothing is a choice rather than a declined confirmation, so
+	// it exits 0.
+	if len(picked) == 0 {
+		fmt.Fprintf(emitter.Out(), "Bulk %s cancelled: no instances selected\n", action)
+		return
+	}
+	targets := make([]bulkTarget, len(picked))
+	for i, index := range picked {
+		targets[i] = bulkTarget{Ref: candidates[index].ID, Machine: candidates[index]}
+	}
+	fmt.Fprint(emitter.Out(), formatBulkSummary(action, targets))
+	applyBulk(action, targets, params, emitter)
+}
+
+// bulkMachines lists the solutions a bulk operation picks from.
+func bulkMachines(emitter *events.Emitter) ([]models.Machine, bool) {
+	fail := func(err error) ([]models.Machine, bool) {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return nil, false
+	}
+	bearerToken, err := getBearerToken()
+	if err != nil {
+		return fail(err)
+	}
+	machines, status, err := fetchMachines(bearerToken)
+	if status == 401 {
+		return fail(fmt.Errorf("tgcloud rejected the token, please re-login%s", expiredTokenHint(bearerToken)))
+	}
+	if err != nil {
+		return fail(err)
+	}
+	return machines, true
+}
+
+// applyBulk applies action to every target. Failures do not stop the run;
+// they are counted in the final tally.
+func applyBulk(action string, targets []bulkTarget, params url.Values, emitter *events.Emitter) {
+	failed := 0
+	for _, target := range targets {
+		fmt.Fprintf(emitter.Out(), "%s %s (%s)\n", action, target.Machine.Name, target.Machine.ID)
+		if err := performMachineOperation(action, target.Machine.ID, params, emitter); err != nil {
+			failed++
+		}
+	}
+	fmt.Fprintf(emitter.Out(), "%d of %d instances %s\n", len(targets)-failed, len(targets), bulkVerbs[action])
+}
@@ -0,0 +1,251 @@
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/outputtest"
+	"github.com/zrougamed/tgCli/internal/tui"
+)
+
+func TestReadIDFile(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "ids.txt")
+	os.WriteFile(path, []byte("# staging boxes\nm1\n\n  m2  \n# m3\n@1\n"), 0644)
+
+	refs, err := readIDFile(path)
+	if err != nil {
+		t.Fatalf("readIDFile failed: %v", err)
+	}
+	if strings.Join(refs, ",") != "m1,m2,@1" {
+		t.Errorf("Unexpected refs %v", refs)
+	}
+
+	os.WriteFile(path, []byte("# nothing here\n"), 0644)
+	if _, err := readIDFile(path); err == nil {
+		t.Error("Expected an error for a file without instances")
+	}
+	if _, err := readIDFile(filepath.Join(dir, "missing.txt")); err == nil {
+		t.Error("Expected an error for a missing file")
+	}
+}
+
+func TestResolveBulkTargets(t *testing.T) {
+	machines := outputtest.Machines()
+
+	targets, err := resolveBulkTargets([]string{machines[1].ID, machines[0].ID, machines[1].ID}, machines)
+	if err != nil {
+		t.Fatalf("resolveBulkTargets failed: %v", err)
+	}
+	if len(targets) != 2 || targets[0].Machine.Name != "staging-cluster-with-a-long-name" || targets[1].Machine.Name != "production" {
+		t.Errorf("Expected each instance once in file order, got %+v", targets)
+	}
+
+	if _, err := resolveBulkTargets([]string{machines[0].ID, "typo"}, machines); err == nil || !strings.Contains(err.Error(), "typo") {
+		t.Errorf("Expected an unknown ID to fail the whole run, got %v", err)
+	}
+}
+
+func TestFormatBulkSummary(t *testing.T) {
+	machines := outputtest.Machines()
+	summary := formatBulkSummary("terminate", []bulkTarget{{Machine: machines[0]}, {Machine: machines[1]}})
+	expected := "2 instances will be terminated:\n" +
+		"  terminate  production                     a1b2c3d4-0000-1111-2222-333344445555  [ready]\n" +
+		"  terminate  staging-cluster-with-a-long-name b2c3d4e5-0000-1111-2222-333344445555  [stopped]\n"
+	if summary != expected {
+		t.Errorf("Unexpected summary:\n%s", summary)
+	}
+	if summary := formatBulkSummary("start", []bulkTarget{{Machine: machines[1]}}); !strings.HasPrefix(summary, "1 instance will be started:\n") {
+		t.Errorf("Unexpected summary:\n%s", summary)
+	}
+}
+
+func TestRunBulkOperation(t *testing.T) {
+	tempDir, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	machines := outputtest.Machines()
+	var mu sync.Mutex
+	var calls []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/solution" {
+			result, _ := json.Marshal(map[string]interface{}{"Error": false, "Result": machines})
+			w.Write(result)
+			return
+		}
+		mu.Lock()
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		mu.Unlock()
+		w.Write([]byte(`{"Message":"ok"}`))
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	idFile := filepath.Join(tempDir, "ids.txt")
+	os.WriteFile(idFile, []byte(machines[0].ID+"\n"+machines[1].ID+"\n"), 0644)
+
+	original := confirmInput
+	defer func() { confirmInput = original }()
+
+	cmd := newMachineCmd("")
+	cmd.Flags().String("id-file", idFile, "")
+
+	confirmInput = strings.NewReader("n\n")
+	out := captureStdout(func() { RunTerminate(cmd, nil) })
+	if !strings.Contains(out, "2 instances will be terminated:") || !strings.Contains(out, "production") || !strings.Contains(out, "cancelled") {
+		t.Errorf("Expected the summary and a cancellation:\n%s", out)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("Declining should touch nothing, got %v", calls)
+	}
+
+	cmd.Flags().Set("yes", "true")
+	out = captureStdout(func() { RunTerminate(cmd, nil) })
+	if strings.Contains(out, "[y/N]") || !strings.Contains(out, "2 of 2 instances terminated") {
+		t.Errorf("--yes should terminate without prompting:\n%s", out)
+	}
+	expected := "DELETE /solution/destroy/" + machines[0].ID + ",DELETE /solution/destroy/" + machines[1].ID
+	if strings.Join(calls, ",") != expected {
+		t.Errorf("Unexpected calls %v", calls)
+	}
+
+	// With --events stdout carries nothing but the events.
+	calls = nil
+	cmd.Flags().Bool("events", true, "")
+	out = captureStdout(func() { RunTerminate(cmd, nil) })
+	assertEventLines(t, out)
+	if strings.Join(calls, ",") != expected {
+		t.Errorf("Unexpected calls with --events %v", calls)
+	}
+	cmd.Flags().Set("events", "false")
+
+	// A bad line aborts before anything is touched.
+	calls = nil
+	os.WriteFile(idFile, []byte(machines[0].ID+"\nnot-an-instance\n"), 0644)
+	out = captureStdout(func() { RunTerminate(cmd, nil) })
+	if !strings.Contains(out, "not-an-instance not found") || len(calls) != 0 {
+		t.Errorf("Expected the unknown ID to abort the run, got calls %v:\n%s", calls, out)
+	}
+}
+
+// scriptedTerminal plays keys to the instance selector.
+type scriptedTerminal struct {
+	io.Reader
+	screen bytes.Buffer
+}
+
+func (t *scriptedTerminal) Write(p []byte) (int, error) { return t.screen.Write(p) }
+func (t *scriptedTerminal) MakeRaw() (func(), error)    { return func() {}, nil }
+
+// withTerminal makes the selector read keys, or sees no terminal when keys
+// is nil.
+func withTerminal(t *testing.T, keys *string) {
+	original := selectorTerminal
+	t.Cleanup(func() { selectorTerminal = original })
+	selectorTerminal = func() (tui.Terminal, bool) {
+		if keys == nil {
+			return nil, false
+		}
+		return &scriptedTerminal{Reader: strings.NewReader(*keys)}, true
+	}
+}
+
+func TestSelectable(t *testing.T) {
+	machines := outputtest.Machines()
+	for action, expected := range map[string]string{
+		"stop":      "production",
+		"start":     "staging-cluster-with-a-long-name",
+		"terminate": "production,staging-cluster-with-a-long-name,cold-storage",
+	} {
+		var names []string
+		for _, machine := range machines {
+			if selectable(action, machine) {
+				names = append(names, machine.Name)
+			}
+		}
+		if strings.Join(names, ",") != expected {
+			t.Errorf("%s: expected %s, got %v", action, expected, names)
+		}
+	}
+}
+
+func TestRequireMachineSelection(t *testing.T) {
+	cmd := newMachineCmd("")
+	cmd.Flags().String("id-file", "", "")
+
+	withTerminal(t, nil)
+	if err := RequireMachineSelection(cmd, nil); err == nil || err.Error() != "at least one of the flags in the group [id id-file] is required" {
+		t.Errorf("Expected the required flag error without a terminal, got %v", err)
+	}
+	keys := ""
+	withTerminal(t, &keys)
+	if err := RequireMachineSelection(cmd, nil); err != nil {
+		t.Errorf("Expected the selector to stand in for --id on a terminal, got %v", err)
+	}
+	withTerminal(t, nil)
+	cmd.Flags().Set("id", "m1")
+	if err := RequireMachineSelection(cmd, nil); err != nil {
+		t.Errorf("Expected --id to be enough, got %v", err)
+	}
+}
+
+func TestRunSelectedOperation(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	machines := outputtest.Machines()
+	var calls []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/solution" {
+			result, _ := json.Marshal(map[string]interface{}{"Error": false, "Result": machines})
+			w.Write(result)
+			return
+		}
+		calls = append(calls, r.Method+" "+r.URL.Path)
+		w.Write([]byte(`{"Message":"ok"}`))
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	// The selector lists production, staging and cold-storage, sorted by
+	// name: cold-storage, production, staging.
+	keys := " \x1b[B\x1b[B \r"
+	withTerminal(t, &keys)
+	out := captureStdout(func() { RunTerminate(newMachineCmd(""), nil) })
+	expected := "DELETE /solution/destroy/" + machines[2].ID + ",DELETE /solution/destroy/" + machines[1].ID
+	if strings.Join(calls, ",") != expected || !strings.Contains(out, "2 instances will be terminated:") || !strings.Contains(out, "2 of 2 instances terminated") {
+		t.Errorf("Expected the two picked instances to be terminated, got calls %v:\n%s", calls, out)
+	}
+
+	calls = nil
+	keys = "\r"
+	status := helpers.ExitStatus()
+	out = captureStdout(func() { RunTerminate(newMachineCmd(""), nil) })
+	if len(calls) != 0 || !strings.Contains(out, "Bulk terminate cancelled: no instances selected") {
+		t.Errorf("Expected picking nothing to cancel, got calls %v:\n%s", calls, out)
+	}
+	if status == 0 && helpers.ExitStatus() != 0 {
+		t.Errorf("Expected picking nothing to exit 0, got %d", helpers.ExitStatus())
+	}
+
+	keys = "\x1b"
+	out = captureStdout(func() { RunStop(newMachineCmd(""), nil) })
+	if len(calls) != 0 || !strings.Contains(out, "Bulk stop cancelled") {
+		t.Errorf("Expected Esc to cancel, got calls %v:\n%s", calls, out)
+	}
+
+	withTerminal(t, nil)
+	out = captureStdout(func() { RunStop(newMachineCmd(""), nil) })
+	if len(calls) != 0 || !strings.Contains(out, "is required") {
+		t.Errorf("Expected the required flag error without a terminal, got calls %v:\n%s", calls, out)
+	}
+}
@@ -7,15 +7,20 @@ import (
 	"fmt"
 	"io"
 	"net/http"
+	"net/url"
 	"os"
+	"regexp"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/events"
 	"github.com/zrougamed/tgCli/internal/helpers"
 	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/telemetry"
 	"github.com/zrougamed/tgCli/pkg/constants"
 	"golang.org/x/term"
 )
@@ -23,8 +28,8 @@ import (
 func RunLogin(cmd *cobra.Command, args []string) {
 	email, _ := cmd.Flags().GetString("email")
 	password, _ := cmd.Flags().GetString("password")
-	save, _ := cmd.Flags().GetString("save")
-	output, _ := cmd.Flags().GetString("output")
+	save := helpers.FlagEnabled(cmd, "save")
+	output := helpers.OutputFormat(cmd)
 
 	// Get credentials if not provided
 	if email == "" {
@@ -38,11 +43,12 @@ func RunLogin(cmd *cobra.Command, args []string) {
 		fmt.Print("What is your tgcloud password? ")
 		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
 		if err != nil {
-			fmt.Printf("Error reading password: %v\n", err)
+			fmt.Fprintf(helpers.Stdout(), "Error reading password: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
 			return
 		}
 		password = string(bytePassword)
-		fmt.Println() // New line after password input
+		fmt.Fprintln(helpers.Stdout()) // New line after password input
 	}
 
 	// Login request
@@ -53,29 +59,34 @@ func RunLogin(cmd *cobra.Command, args []string) {
 
 	jsonData, err := json.Marshal(loginData)
 	if err != nil {
-		fmt.Printf("Error marshaling login data: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error marshaling login data: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
-	fmt.Println("Logging into your account...")
+	fmt.Fprintln(helpers.Stdout(), "Logging into your account...")
 
-	resp, err := http.Post(constants.TIGERTOOL_URL+"/login", "application/json", bytes.NewBuffer(jsonData))
+	client := helpers.NewHTTPClient(30 * time.Second)
+	resp, err := client.Post(constants.TIGERTOOL_URL+"/login", "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("Error making login request: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error making login request: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error reading response: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
 	if resp.StatusCode == 200 {
 		var loginResp models.TGCloudResponse
 		if err := json.Unmarshal(body, &loginResp); err != nil {
-			fmt.Printf("Error parsing response: %v\n", err)
+			fmt.Fprintf(helpers.Stdout(), "Error parsing response: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
 			return
 		}
 
@@ -86,202 +97,861 @@ func RunLogin(cmd *cobra.Command, args []string) {
 				bearerToken := tokenParts[1]
 
 				// Save token to file
-				if err := os.WriteFile(constants.CredsFile, []byte(bearerToken), 0600); err != nil {
-					fmt.Printf("Error saving credentials: %v\n", err)
+				if err := storeLoginToken(bearerToken); err != nil {
+					fmt.Fprintf(helpers.Stdout(), "Error saving credentials: %v\n", err)
+					helpers.Fail(helpers.ExitFailure)
 					return
 				}
 
 				// Save credentials to config if requested
-				if save == "y" {
+				if save {
 					viper.Set("tgcloud.user", email)
 					viper.Set("tgcloud.password", password)
 					if err := helpers.SaveConfig(); err != nil {
-						fmt.Printf("Error saving config: %v\n", err)
+						fmt.Fprintf(helpers.Stdout(), "Error saving config: %v\n", err)
+						helpers.Fail(helpers.ExitFailure)
 					}
 				}
 
 				if output == "json" {
-					fmt.Printf(`{"error":false,"message":"Login successful","token":"%s"}`, bearerToken)
+					fmt.Fprint(helpers.Stdout(), helpers.JSONOutput(formatLoginJSON(bearerToken)))
 				} else {
-					fmt.Println("Login Successful! 😊")
+					fmt.Fprintln(helpers.Stdout(), "Login Successful! 😊")
 				}
 			}
 		}
 	} else {
+		helpers.Fail(helpers.ExitFailure)
 		if output == "json" {
-			fmt.Printf(`{"error":true,"message":"Login failed"}`)
+			fmt.Fprint(helpers.Stdout(), helpers.JSONOutput(formatLoginJSON("")))
 		} else {
-			fmt.Printf("Error logging in: %s\n", string(body))
+			fmt.Fprintf(helpers.Stdout(), "Error logging in: %s\n", string(body))
 		}
 	}
 }
 
 func RunStart(cmd *cobra.Command, args []string) {
-	id, _ := cmd.Flags().GetString("id")
-	performMachineOperation("start", id)
+	runMachineCommand(cmd, "start")
 }
 
 func RunStop(cmd *cobra.Command, args []string) {
-	id, _ := cmd.Flags().GetString("id")
-	performMachineOperation("stop", id)
+	runMachineCommand(cmd, "stop")
 }
 
 func RunTerminate(cmd *cobra.Command, args []string) {
-	id, _ := cmd.Flags().GetString("id")
-	performMachineOperation("terminate", id)
+	runMachineCommand(cmd, "terminate")
+}
+
+// runMachineCommand applies action to the instance given with --id, to
+// every instance in --id-file, or without either to the instances picked
+// on the terminal.
+func runMachineCommand(cmd *cobra.Command, action string) {
+	withEvents, _ := cmd.Flags().GetBool("events")
+	emitter := events.Start(withEvents)
+	defer emitter.Finish()
+	params, err := operationParams(cmd, emitter)
+	if err != nil {
+		return
+	}
+	if idFile, _ := cmd.Flags().GetString("id-file"); idFile != "" {
+		runBulkOperation(cmd, action, params, emitter)
+		return
+	}
+	if ref, _ := cmd.Flags().GetString("id"); ref == "" {
+		runSelectedOperation(action, params, emitter)
+		return
+	}
+	id, err := machineIDFlag(cmd, emitter)
+	if err != nil {
+		return
+	}
+	performMachineOperation(action, id, params, emitter)
 }
 
 func RunArchive(cmd *cobra.Command, args []string) {
-	id, _ := cmd.Flags().GetString("id")
-	performMachineOperation("archive", id)
+	yes, _ := cmd.Flags().GetBool("yes")
+	withEvents, _ := cmd.Flags().GetBool("events")
+	emitter := events.Start(withEvents)
+	defer emitter.Finish()
+	params, err := operationParams(cmd, emitter)
+	if err != nil {
+		return
+	}
+	id, err := machineIDFlag(cmd, emitter)
+	if err != nil {
+		return
+	}
+
+	if !yes && !confirm(emitter.Prompt(), fmt.Sprintf("Archive %s? Archiving detaches its compute.", id)) {
+		fmt.Fprintln(emitter.Out(), "Archive cancelled")
+		emitter.Fail(fmt.Errorf("archive cancelled"))
+		helpers.Fail(helpers.ExitCancelled)
+		return
+	}
+	performMachineOperation("archive", id, params, emitter)
+}
+
+func RunUnarchive(cmd *cobra.Command, args []string) {
+	yes, _ := cmd.Flags().GetBool("yes")
+	wait, _ := cmd.Flags().GetBool("wait")
+	waitTimeout, _ := cmd.Flags().GetDuration("wait-timeout")
+	withEvents, _ := cmd.Flags().GetBool("events")
+	emitter := events.Start(withEvents)
+	defer emitter.Finish()
+	params, err := operationParams(cmd, emitter)
+	if err != nil {
+		return
+	}
+	id, err := machineIDFlag(cmd, emitter)
+	if err != nil {
+		return
+	}
+
+	if !yes && !confirm(emitter.Prompt(), fmt.Sprintf("Restore %s from archive? This can take a long time.", id)) {
+		fmt.Fprintln(emitter.Out(), "Unarchive cancelled")
+		emitter.Fail(fmt.Errorf("unarchive cancelled"))
+		helpers.Fail(helpers.ExitCancelled)
+		return
+	}
+	if err := performMachineOperation("unarchive", id, params, emitter); err != nil || !wait {
+		return
+	}
+
+	span := telemetry.StartSpan("cloud.wait", telemetry.String("tg.machine.id", id))
+	err = waitForRestore(id, waitTimeout, emitter)
+	span.Finish(err)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+	}
+}
+
+// paramKey is what --param accepts as a query parameter name.
+var paramKey = regexp.MustCompile(`^[A-Za-z][A-Za-z0-9_.-]*$`)
+
+// operationParams reads the repeatable --param key=value flag: query
+// parameters appended to the operation URL, for tgcloud options such as
+// force-terminate that tg has no flag for. A key given twice is sent
+// twice.
+func operationParams(cmd *cobra.Command, emitter *events.Emitter) (url.Values, error) {
+	flags, _ := cmd.Flags().GetStringArray("param")
+	params, err := parseOperationParams(flags)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+	}
+	return params, err
+}
+
+func parseOperationParams(flags []string) (url.Values, error) {
+	if len(flags) == 0 {
+		return nil, nil
+	}
+	params := make(url.Values)
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		key = strings.TrimSpace(key)
+		if !ok || key == "" {
+			return nil, fmt.Errorf("--param %s: expected key=value", flag)
+		}
+		if !paramKey.MatchString(key) {
+			return nil, fmt.Errorf("--param %s: invalid key %q (letters, digits, '_', '.' and '-', starting with a letter)", flag, key)
+		}
+		if strings.ContainsAny(value, "\r\n") {
+			return nil, fmt.Errorf("--param %s: the value cannot span lines", key)
+		}
+		params.Add(key, value)
+	}
+	return params, nil
+}
+
+// machineIDFlag resolves the --id flag, which may also be an @N or "last"
+// reference.
+func machineIDFlag(cmd *cobra.Command, emitter *events.Emitter) (string, error) {
+	ref, _ := cmd.Flags().GetString("id")
+	id, err := resolveMachineRef(ref)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return "", err
+	}
+	if id != ref {
+		fmt.Fprintf(emitter.Out(), "Resolved %s to %s\n", ref, id)
+	}
+	return id, nil
 }
 
 func RunList(cmd *cobra.Command, args []string) {
-	activeOnly, _ := cmd.Flags().GetString("activeonly")
-	output, _ := cmd.Flags().GetString("output")
+	archivedOnly, _ := cmd.Flags().GetBool("archived-only")
+	groupBy, _ := cmd.Flags().GetString("group-by")
+	output := helpers.OutputFormat(cmd)
+	columnsSpec, _ := cmd.Flags().GetString("columns")
+	states, _ := cmd.Flags().GetStringSlice("state")
+	olderThanFlag, _ := cmd.Flags().GetString("older-than")
+	stale, _ := cmd.Flags().GetBool("stale")
+	count, _ := cmd.Flags().GetBool("count")
+
+	withTerminated, err := includeTerminated(cmd)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: --activeonly: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	minAge, err := listAge(olderThanFlag, stale)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: --older-than: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	if groupBy != "" && machineGroupKeys[groupBy] == nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: unknown --group-by %q (expected state or tag)\n", groupBy)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	columns, err := resolveColumns(columnsSpec, terminalWidth())
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
 
 	bearerToken, err := getBearerToken()
 	if err != nil {
-		fmt.Printf("Error getting bearer token: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error getting bearer token: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
-	req, err := http.NewRequest("GET", constants.TGCLOUD_BASE_URL+"/solution", nil)
+	all, status, err := fetchMachines(bearerToken)
+	if status == 401 {
+		hint := expiredTokenHint(bearerToken)
+		if output == "json" {
+			result, _ := json.Marshal(map[string]interface{}{"error": true, "message": "Re-Login to tgcloud" + hint})
+			fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(result)))
+		} else {
+			fmt.Fprintln(helpers.Stdout(), "You should re-login using 'tg cloud login'"+hint)
+		}
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
 	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
+		if output == "json" {
+			result, _ := json.Marshal(map[string]interface{}{"error": true, "message": err.Error()})
+			fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(result)))
+		} else {
+			fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		}
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	var machines []models.Machine
+	for _, machine := range all {
+		if !withTerminated && machine.State == "terminated" {
+			continue
+		}
+		if archivedOnly && !isArchived(machine.State) {
+			continue
+		}
+		if !matchesState(machine, states) {
+			continue
+		}
+		machines = append(machines, machine)
+	}
+	if minAge > 0 {
+		var unknown []models.Machine
+		machines, unknown = olderThan(machines, minAge, helpers.Now())
+		for _, machine := range unknown {
+			helpers.Warn(helpers.WarnUnreadableCreated, "skipping %s: unreadable creation time %q", machine.Name, machine.CreatedAt)
+		}
+	}
+
+	// --count is for scripts and monitoring: just the number, which leaves
+	// the @N references of the last full listing alone.
+	if count {
+		fmt.Fprintln(helpers.Stdout(), len(machines))
 		return
 	}
 
+	// Grouped output shows machines group by group; @N follows that order.
+	var groups []machineGroup
+	if groupBy != "" {
+		groups = groupMachines(machines, groupBy)
+		machines = machines[:0]
+		for _, group := range groups {
+			machines = append(machines, group.Machines...)
+		}
+	}
+	rememberListed(machines)
+
+	switch {
+	case groupBy != "" && output == "json":
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(formatMachineGroupsJSON(groups)))
+	case groupBy != "":
+		fmt.Fprint(helpers.Stdout(), formatMachineGroups("tgcloud solutions", groupBy, groups, columns...))
+	case output == "json":
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(formatMachineListJSON(machines)))
+	default:
+		printMachineTable("tgcloud solutions", machines, columns...)
+	}
+}
+
+// includeTerminated resolves --include-terminated, falling back to the
+// deprecated --activeonly y/n flag when only that one was given. A value
+// --activeonly does not understand is an error rather than a guess.
+func includeTerminated(cmd *cobra.Command) (bool, error) {
+	flags := cmd.Flags()
+	if flag := flags.Lookup("include-terminated"); flag != nil && flag.Changed {
+		include, _ := flags.GetBool("include-terminated")
+		return include, nil
+	}
+	if flag := flags.Lookup("activeonly"); flag != nil && flag.Changed {
+		activeOnly, err := helpers.ParseYesNo(flag.Value.String())
+		if err != nil {
+			return false, err
+		}
+		return !activeOnly, nil
+	}
+	include, _ := flags.GetBool("include-terminated")
+	return include, nil
+}
+
+// fetchMachines lists every solution on the account, sorted by name so
+// listings and @N references do not depend on the order tgcloud sends. The
+// HTTP status is returned so callers can tell an expired login from other
+// failures.
+func fetchMachines(bearerToken string) ([]models.Machine, int, error) {
+	result, status, err := fetchSolutions(bearerToken)
+	if err != nil {
+		return nil, status, err
+	}
+	var machines []models.Machine
+	if err := json.Unmarshal(result, &machines); err != nil {
+		return nil, status, fmt.Errorf("unable to parse response: %v", err)
+	}
+	sortMachines(machines)
+	return machines, status, nil
+}
+
+// sortMachines orders machines by name, then ID.
+func sortMachines(machines []models.Machine) {
+	sort.SliceStable(machines, func(i, j int) bool {
+		if machines[i].Name != machines[j].Name {
+			return machines[i].Name < machines[j].Name
+		}
+		return machines[i].ID < machines[j].ID
+	})
+}
+
+// newCloudRequest builds an authenticated tgcloud request.
+func newCloudRequest(method, path, bearerToken string) (*http.Request, error) {
+	req, err := http.NewRequest(method, constants.TGCLOUD_BASE_URL+path, nil)
+	if err != nil {
+		return nil, err
+	}
 	req.Header.Set("Authorization", "Bearer "+bearerToken)
 	req.Header.Set("Content-Type", "application/json")
 	req.Header.Set("Accept", "application/json")
+	return req, nil
+}
+
+// fetchSolutions returns the raw Result of GET /solution, with every field
+// tgcloud sends for each solution.
+func fetchSolutions(bearerToken string) (json.RawMessage, int, error) {
+	client := helpers.NewHTTPClient(30 * time.Second)
+	req, err := newCloudRequest("GET", "/solution", bearerToken)
+	if err != nil {
+		return nil, 0, err
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("Error making request: %v\n", err)
-		return
+		return nil, 0, err
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return
+		return nil, resp.StatusCode, err
+	}
+	if resp.StatusCode != 200 {
+		return nil, resp.StatusCode, fmt.Errorf("tgcloud returned status %d", resp.StatusCode)
 	}
 
-	if resp.StatusCode == 200 {
-		var response struct {
-			Error  bool             `json:"Error"`
-			Result []models.Machine `json:"Result"`
-		}
+	var response struct {
+		Error   bool            `json:"Error"`
+		Message string          `json:"Message"`
+		Result  json.RawMessage `json:"Result"`
+	}
+	if err := json.Unmarshal(body, &response); err != nil {
+		return nil, resp.StatusCode, fmt.Errorf("unable to parse response: %v", err)
+	}
+	if response.Error {
+		return nil, resp.StatusCode, fmt.Errorf("tgcloud error: %s", response.Message)
+	}
+	if len(response.Result) == 0 || string(response.Result) == "null" {
+		return json.RawMessage("[]"), resp.StatusCode, nil
+	}
+	return response.Result, resp.StatusCode, nil
+}
 
-		if err := json.Unmarshal(body, &response); err != nil {
-			fmt.Printf("Error parsing response: %v\n", err)
-			return
-		}
+func isArchived(state string) bool {
+	return strings.EqualFold(state, "archived")
+}
 
-		if !response.Error {
-			var machines []models.Machine
-			for _, machine := range response.Result {
-				if activeOnly == "y" && machine.State == "terminated" {
-					continue
-				}
-				machines = append(machines, machine)
-			}
+// machinePollInterval is how often --wait checks the solution state.
+var machinePollInterval = 15 * time.Second
 
-			if output == "json" {
-				result, _ := json.Marshal(map[string]interface{}{
-					"error":  false,
-					"result": machines,
-				})
-				fmt.Println(string(result))
-			} else {
-				printMachineTable("tgcloud solutions", machines)
-			}
-		}
-	} else if resp.StatusCode == 401 {
-		if output == "json" {
-			fmt.Println(`{"error":true,"message":"Re-Login to tgcloud"}`)
-		} else {
-			fmt.Println("You should re-login using 'tg cloud login'")
-		}
+// waitForRestore polls until the solution has left the archived state and
+// is no longer transitioning (e.g. "unarchiving"), or the timeout elapses.
+func waitForRestore(machineID string, timeout time.Duration, emitter *events.Emitter) error {
+	bearerToken, err := getBearerToken()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(emitter.Out(), "Waiting for %s to be restored...\n", machineID)
+	timeout = helpers.BoundWait(timeout)
+	state, done, err := pollMachineState(bearerToken, machineID, timeout, machinePollInterval, emitter, func(state string) (bool, error) {
+		return !isArchived(state) && !strings.HasSuffix(strings.ToLower(state), "ing"), nil
+	})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("timed out after %s waiting for %s to be restored (status: %s)", timeout, machineID, state)
 	}
+	fmt.Fprintf(emitter.Out(), "%s restored (%s)\n", machineID, state)
+	return nil
 }
 
-func RunCreate(cmd *cobra.Command, args []string) {
-	fmt.Println("tgcli Create Machine: 🚧 Work in progress 🚧 will be in next release 🙏 🚀 !")
+// confirmInput is where confirmation answers are read from.
+var confirmInput io.Reader = os.Stdin
+
+// confirm asks a yes/no question; anything but y/yes declines.
+func confirm(prompt io.Writer, question string) bool {
+	fmt.Fprintf(prompt, "%s [y/N] ", question)
+	answer, _ := bufio.NewReader(confirmInput).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
 }
 
-func performMachineOperation(action, machineID string) {
+// RunCreate creates an instance from the starter kit given with --id.
+func RunCreate(cmd *cobra.Command, args []string) {
+	kitID, _ := cmd.Flags().GetString("id")
+	kitID = strings.TrimSpace(kitID)
+	if kitID == "" {
+		fmt.Fprintln(helpers.Stdout(), "Error: give the starter kit to create the instance from, e.g. tg cloud create -i STARTER_KIT_ID")
+		fmt.Fprintln(helpers.Stdout(), "Starter kit IDs are shown on tgcloud.io when you create a solution: open Create Solution and copy the ID of the kit you want.")
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
 	bearerToken, err := getBearerToken()
 	if err != nil {
-		fmt.Printf("Error getting bearer token: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error getting bearer token: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
+	machine, err := requestCreate(helpers.NewHTTPClient(30*time.Second), bearerToken, kitID)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Created instance %s from starter kit %s\n", machine.ID, kitID)
+	if machine.State != "" {
+		fmt.Fprintf(helpers.Stdout(), "State: %s\n", machine.State)
+	}
+	rememberLast(machine.ID)
+}
 
-	client := &http.Client{Timeout: 30 * time.Second}
+// requestCreate asks tgcloud to create an instance from the starter kit
+// kitID and returns the new instance.
+func requestCreate(client *http.Client, bearerToken, kitID string) (models.Machine, error) {
+	payload, err := json.Marshal(map[string]string{"starterKitId": kitID})
+	if err != nil {
+		return models.Machine{}, err
+	}
+	req, err := newCloudRequest("POST", "/solution/create", bearerToken)
+	if err != nil {
+		return models.Machine{}, fmt.Errorf("creating request: %v", err)
+	}
+	// GetBody lets the client send the body again after a redirect.
+	req.GetBody = func() (io.ReadCloser, error) { return io.NopCloser(bytes.NewReader(payload)), nil }
+	req.Body, _ = req.GetBody()
+	req.ContentLength = int64(len(payload))
 
-	var req *http.Request
-	if action == "terminate" {
-		req, err = http.NewRequest("DELETE", constants.TGCLOUD_BASE_URL+"/solution/destroy/"+machineID, nil)
-	} else {
-		req, err = http.NewRequest("POST", constants.TGCLOUD_BASE_URL+"/solution/"+action+"/"+machineID, nil)
+	resp, err := client.Do(req)
+	if err != nil {
+		return models.Machine{}, fmt.Errorf("making request: %v", err)
 	}
+	defer resp.Body.Close()
 
+	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error creating request: %v\n", err)
-		return
+		return models.Machine{}, fmt.Errorf("reading response: %v", err)
 	}
 
-	req.Header.Set("Authorization", "Bearer "+bearerToken)
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Accept", "application/json")
+	switch resp.StatusCode {
+	case 200, 201:
+	case 401:
+		return models.Machine{}, fmt.Errorf("tgcloud rejected the token, please re-login%s", expiredTokenHint(bearerToken))
+	default:
+		return models.Machine{}, fmt.Errorf("tgcloud returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	var response models.TGCloudResponse
+	if err := json.Unmarshal(body, &response); err != nil {
+		return models.Machine{}, fmt.Errorf("parsing response: %v", err)
+	}
+	if response.Error {
+		return models.Machine{}, fmt.Errorf("tgcloud could not create the instance: %s", response.Message)
+	}
+	var machine models.Machine
+	if result, err := json.Marshal(response.Result); err == nil {
+		json.Unmarshal(result, &machine)
+	}
+	if machine.ID == "" {
+		return models.Machine{}, fmt.Errorf("tgcloud did not return the new instance's ID: %s", strings.TrimSpace(string(body)))
+	}
+	return machine, nil
+}
+
+// machineStates maps an operation to the event emitted once tgcloud
+// accepts it.
+var machineStates = map[string]string{
+	"start":     "machine.started",
+	"stop":      "machine.stopped",
+	"terminate": "machine.terminated",
+	"archive":   "machine.archived",
+	"unarchive": "machine.unarchived",
+}
+
+func performMachineOperation(action, machineID string, params url.Values, emitter *events.Emitter) error {
+	bearerToken, err := getBearerToken()
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error getting bearer token: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return err
+	}
+
+	emitter.Emit("machine.requested", map[string]interface{}{"id": machineID, "action": action})
+	message, err := requestMachineOperation(helpers.NewHTTPClient(30*time.Second), bearerToken, action, machineID, params)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return err
+	}
+	if message != "" {
+		fmt.Fprintf(emitter.Out(), "tgcloud response: %s\n", message)
+	}
+	emitter.Emit(machineStates[action], map[string]interface{}{"id": machineID, "message": message})
+	rememberLast(machineID)
+	return nil
+}
+
+// requestMachineOperation asks tgcloud to apply action to a machine and
+// returns tgcloud's message. params, which may be nil, are added to the
+// URL's query string. It prints nothing, so it is safe to call from
+// several goroutines and from commands with their own output format.
+func requestMachineOperation(client *http.Client, bearerToken, action, machineID string, params url.Values) (string, error) {
+	method, path := "POST", "/solution/"+action+"/"+machineID
+	if action == "terminate" {
+		method, path = "DELETE", "/solution/destroy/"+machineID
+	}
+	if len(params) > 0 {
+		path += "?" + params.Encode()
+	}
+	req, err := newCloudRequest(method, path, bearerToken)
+	if err != nil {
+		return "", fmt.Errorf("creating request: %v", err)
+	}
 
 	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("Error making request: %v\n", err)
-		return
+		return "", fmt.Errorf("making request: %v", err)
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
-		return
+		return "", fmt.Errorf("reading response: %v", err)
 	}
 
-	if resp.StatusCode == 200 {
-		var response map[string]interface{}
-		if err := json.Unmarshal(body, &response); err == nil {
-			if message, ok := response["Message"].(string); ok {
-				fmt.Printf("tgcloud response: %s\n", message)
-			}
+	switch resp.StatusCode {
+	case 200:
+		var response struct {
+			Message string
 		}
-	} else if resp.StatusCode == 401 {
-		fmt.Println("tgcloud response: Please re-login")
-	} else {
-		fmt.Printf("Error: %s\n", string(body))
+		json.Unmarshal(body, &response)
+		return response.Message, nil
+	case 401:
+		return "", fmt.Errorf("tgcloud rejected the token, please re-login%s", expiredTokenHint(bearerToken))
+	default:
+		return "", fmt.Errorf("tgcloud returned status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
 	}
 }
 
 func getBearerToken() (string, error) {
-	data, err := os.ReadFile(constants.CredsFile)
+	token, endpoint, err := helpers.ReadCredentials(constants.CredsFile)
 	if err != nil {
 		return "", fmt.Errorf("bearer token not found, please login first")
 	}
-	return string(data), nil
+	if !sameEndpoint(endpoint, constants.TGCLOUD_BASE_URL) {
+		return "", fmt.Errorf("stored token was issued for %s but you are targeting %s; run tg cloud login", endpoint, constants.TGCLOUD_BASE_URL)
+	}
+	warnClockSkew(token)
+	return token, nil
+}
+
+func sameEndpoint(a, b string) bool {
+	return strings.EqualFold(strings.TrimRight(a, "/"), strings.TrimRight(b, "/"))
+}
+
+// machineColumn describes one column of the machine table.
+type machineColumn struct {
+	Header string
+	Width  int
+	Value  func(models.Machine) string
+}
+
+var machineColumns = map[string]machineColumn{
+	"id":      {"ID", 15, func(m models.Machine) string { return m.ID }},
+	"shortid": {"ID", 8, func(m models.Machine) string { return shortID(m.ID) }},
+	"name":    {"Machine", 20, func(m models.Machine) string { return m.Name }},
+	"tag":     {"Solution", 15, func(m models.Machine) string { return m.Tag }},
+	"state":   {"Status", 10, machineState},
+	"created": {"Created", 25, func(m models.Machine) string { return m.CreatedAt }},
+}
+
+var (
+	defaultColumns = []string{"id", "name", "tag", "state"}
+	narrowColumns  = []string{"name", "state"}
+	wideColumns    = []string{"shortid", "name", "tag", "state", "created"}
+)
+
+// machineState renders archived solutions distinctly so they stand out
+// from stopped ones.
+func machineState(m models.Machine) string {
+	if isArchived(m.State) {
+		return "[archived]"
+	}
+	return m.State
+}
+
+func shortID(id string) string {
+	if len(id) <= 8 {
+		return id
+	}
+	return id[:8]
+}
+
+// terminalWidth returns the width of stdout, or 0 when it is not a terminal.
+func terminalWidth() int {
+	width, _, err := term.GetSize(int(os.Stdout.Fd()))
+	if err != nil {
+		return 0
+	}
+	return width
+}
+
+// resolveColumns turns a --columns value into the list of columns to render.
+// "auto" picks a layout for the given terminal width; an empty value keeps
+// the classic layout.
+func resolveColumns(spec string, width int) ([]string, error) {
+	spec = strings.TrimSpace(strings.ToLower(spec))
+	switch spec {
+	case "":
+		return defaultColumns, nil
+	case "auto":
+		switch {
+		case width <= 0:
+			return defaultColumns, nil
+		case width < 70:
+			return narrowColumns, nil
+		case width >= 120:
+			return wideColumns, nil
+		default:
+			return defaultColumns, nil
+		}
+	}
+
+	var columns []string
+	for _, key := range strings.Split(spec, ",") {
+		key = strings.TrimSpace(key)
+		if key == "" {
+			continue
+		}
+		if _, ok := machineColumns[key]; !ok {
+			return nil, fmt.Errorf("unknown column %q (available: id, shortid, name, tag, state, created)", key)
+		}
+		columns = append(columns, key)
+	}
+	if len(columns) == 0 {
+		return nil, fmt.Errorf("no columns selected")
+	}
+	return columns, nil
 }
 
-func printMachineTable(title string, machines []models.Machine) {
-	fmt.Printf("\n%s\n", title)
-	fmt.Println(strings.Repeat("=", len(title)))
-	fmt.Printf("%-15s %-20s %-15s %-10s\n", "ID", "Machine", "Solution", "Status")
-	fmt.Println(strings.Repeat("-", 65))
+func printMachineTable(title string, machines []models.Machine, columns ...string) {
+	fmt.Fprint(helpers.Stdout(), formatMachineTable(title, machines, 1, columns...))
+}
 
+// formatMachineTable renders machines as a table with the given columns,
+// or defaultColumns when none are given. The rows are numbered from first
+// with the @N reference that picks them.
+func formatMachineTable(title string, machines []models.Machine, first int, columns ...string) string {
+	if len(columns) == 0 {
+		columns = defaultColumns
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "\n%s\n", title)
+	b.WriteString(strings.Repeat("=", len(title)) + "\n")
+
+	refWidth := max(len("Ref"), len(fmt.Sprintf("@%d", first+len(machines)-1)))
+	headers := make([]string, len(columns)+1)
+	headers[0] = fmt.Sprintf("%-*s", refWidth, "Ref")
+	lineWidth := refWidth + 1
+	for i, key := range columns {
+		column := machineColumns[key]
+		headers[i+1] = fmt.Sprintf("%-*s", column.Width, column.Header)
+		lineWidth += column.Width + 1
+	}
+	b.WriteString(strings.Join(headers, " ") + "\n")
+	b.WriteString(strings.Repeat("-", lineWidth+1) + "\n")
+
+	for n, machine := range machines {
+		cells := make([]string, len(columns)+1)
+		cells[0] = fmt.Sprintf("%-*s", refWidth, fmt.Sprintf("@%d", first+n))
+		for i, key := range columns {
+			column := machineColumns[key]
+			cells[i+1] = fmt.Sprintf("%-*s", column.Width, column.Value(machine))
+		}
+		b.WriteString(strings.Join(cells, " ") + "\n")
+	}
+	b.WriteString("\n")
+	return b.String()
+}
+
+// formatMachineListJSON renders the JSON document printed by list -o json.
+// Each machine carries the ordinal an @N reference resolves to.
+func formatMachineListJSON(machines []models.Machine) string {
+	result, _ := json.Marshal(map[string]interface{}{
+		"error":  false,
+		"result": numberMachines(machines),
+	})
+	return string(result)
+}
+
+// machineGroupKeys are the fields --group-by accepts.
+var machineGroupKeys = map[string]func(models.Machine) string{
+	"state": func(m models.Machine) string { return m.State },
+	"tag":   func(m models.Machine) string { return m.Tag },
+}
+
+// machineGroup is the set of machines sharing one --group-by value.
+type machineGroup struct {
+	Key      string
+	Machines []models.Machine
+}
+
+// groupMachines splits machines by the given key, keeping their order
+// within each group. Groups are sorted by key; an empty value is grouped
+// under "(none)".
+func groupMachines(machines []models.Machine, groupBy string) []machineGroup {
+	keyOf := machineGroupKeys[groupBy]
+	index := make(map[string]int)
+	var groups []machineGroup
 	for _, machine := range machines {
-		fmt.Printf("%-15s %-20s %-15s %-10s\n",
-			machine.ID, machine.Name, machine.Tag, machine.State)
+		key := keyOf(machine)
+		if key == "" {
+			key = "(none)"
+		}
+		i, ok := index[key]
+		if !ok {
+			i = len(groups)
+			index[key] = i
+			groups = append(groups, machineGroup{Key: key})
+		}
+		groups[i].Machines = append(groups[i].Machines, machine)
+	}
+	sort.SliceStable(groups, func(i, j int) bool { return groups[i].Key < groups[j].Key })
+	return groups
+}
+
+// formatMachineGroups renders one sub-table per group, titled with the
+// group key and its count.
+func formatMachineGroups(title, groupBy string, groups []machineGroup, columns ...string) string {
+	if len(groups) == 0 {
+		return formatMachineTable(title, nil, 1, columns...)
+	}
+	// The references run on across the groups, as in the JSON output.
+	var b strings.Builder
+	first := 1
+	for _, group := range groups {
+		groupTitle := fmt.Sprintf("%s - %s: %s (%d)", title, groupBy, group.Key, len(group.Machines))
+		b.WriteString(formatMachineTable(groupTitle, group.Machines, first, columns...))
+		first += len(group.Machines)
+	}
+	return b.String()
+}
+
+// formatMachineGroupsJSON renders list -o json with the result nested by
+// group key. Ordinals run across the groups in order.
+func formatMachineGroupsJSON(groups []machineGroup) string {
+	nested := make(map[string][]listedMachine, len(groups))
+	ordinal := 0
+	for _, group := range groups {
+		listed := numberMachines(group.Machines)
+		for i := range listed {
+			listed[i].Ordinal += ordinal
+		}
+		ordinal += len(listed)
+		nested[group.Key] = listed
+	}
+	result, _ := json.Marshal(map[string]interface{}{
+		"error":  false,
+		"result": nested,
+	})
+	return string(result)
+}
+
+// loginResult is the JSON document printed by login -o json.
+type loginResult struct {
+	Error   bool   `json:"error"`
+	Message string `json:"message"`
+	Token   string `json:"token,omitempty"`
+}
+
+// storeLoginToken saves a token tgcloud just issued to the credentials
+// file and warns when the local clock disagrees with tgcloud's.
+func storeLoginToken(bearerToken string) error {
+	obtainedAt := helpers.Now()
+	if err := helpers.WriteLoginCredentials(constants.CredsFile, bearerToken, constants.TGCLOUD_BASE_URL, obtainedAt); err != nil {
+		return err
+	}
+	if skew, ok := clockSkew(bearerToken, obtainedAt); ok {
+		warnSkew(skew)
+	}
+	return nil
+}
+
+// formatLoginJSON renders the login outcome. An empty token means the
+// login failed.
+func formatLoginJSON(token string) string {
+	result := loginResult{Error: true, Message: "Login failed"}
+	if token != "" {
+		result = loginResult{Message: "Login successful", Token: token}
 	}
-	fmt.Println()
+	data, _ := json.Marshal(result)
+	return string(data)
 }
@@ -1,14 +1,24 @@
 package cloud
 
 import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/events"
+	"github.com/zrougamed/tgCli/internal/helpers"
 	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/outputtest"
 	"github.com/zrougamed/tgCli/pkg/constants"
 )
 
@@ -21,9 +31,12 @@ func setupTestEnvironment(t *testing.T) (string, func()) {
 	// Set test constants
 	originalCredsFile := constants.CredsFile
 	constants.CredsFile = filepath.Join(tempDir, "test_creds.bank")
+	originalRefsFile := machineRefsFile
+	machineRefsFile = filepath.Join(tempDir, "machine_refs.json")
 
 	cleanup := func() {
 		constants.CredsFile = originalCredsFile
+		machineRefsFile = originalRefsFile
 		os.RemoveAll(tempDir)
 		viper.Reset()
 	}
@@ -79,10 +92,75 @@ func TestPrintMachineTable(t *testing.T) {
 }
 
 func TestRunCreate(t *testing.T) {
-	cmd := &cobra.Command{}
-	cmd.Flags().String("id", "", "")
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
 
-	RunCreate(cmd, []string{})
+	var requests []string
+	status := http.StatusOK
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, r.Method+" "+r.URL.Path+" "+r.Header.Get("Authorization")+" "+string(body))
+		w.WriteHeader(status)
+		switch status {
+		case http.StatusOK:
+			w.Write([]byte(`{"Error":false,"Message":"","Result":{"ID":"m-new","State":"initializing"}}`))
+		case http.StatusBadRequest:
+			w.Write([]byte(`{"Error":true,"Message":"unknown starter kit"}`))
+		}
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	out := captureStdout(func() { RunCreate(newMachineCmd(""), nil) })
+	if !strings.Contains(out, "give the starter kit") || !strings.Contains(out, "Create Solution") || len(requests) != 0 {
+		t.Errorf("Expected a missing kit to be explained without a request, got %v:\n%s", requests, out)
+	}
+
+	out = captureStdout(func() { RunCreate(newMachineCmd("kit-graph-analytics"), nil) })
+	if len(requests) != 1 || requests[0] != `POST /solution/create Bearer token {"starterKitId":"kit-graph-analytics"}` {
+		t.Errorf("Unexpected requests %q", requests)
+	}
+	if out != "Created instance m-new from starter kit kit-graph-analytics\nState: initializing\n" {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	if id, err := resolveMachineRef("last"); err != nil || id != "m-new" {
+		t.Errorf("Expected the new instance to be last, got %q (%v)", id, err)
+	}
+
+	status = http.StatusUnauthorized
+	if out := captureStdout(func() { RunCreate(newMachineCmd("kit-graph-analytics"), nil) }); !strings.Contains(out, "Error: tgcloud rejected the token, please re-login") {
+		t.Errorf("Expected the re-login hint, got:\n%s", out)
+	}
+	status = http.StatusBadRequest
+	if out := captureStdout(func() { RunCreate(newMachineCmd("nope"), nil) }); !strings.Contains(out, "tgcloud returned status 400") {
+		t.Errorf("Expected the status to be reported, got:\n%s", out)
+	}
+}
+
+func TestRequestCreateResponses(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	var response string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(response))
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	for _, test := range []struct {
+		response string
+		err      string
+	}{
+		{`{"Error":true,"Message":"quota exceeded"}`, "tgcloud could not create the instance: quota exceeded"},
+		{`{"Error":false,"Result":{}}`, "tgcloud did not return the new instance's ID"},
+		{`not json`, "parsing response"},
+	} {
+		response = test.response
+		if _, err := requestCreate(mockServer.Client(), "token", "kit"); err == nil || !strings.Contains(err.Error(), test.err) {
+			t.Errorf("%s: expected %q, got %v", test.response, test.err, err)
+		}
+	}
 }
 
 func TestCloudCommandFlags(t *testing.T) {
@@ -446,3 +524,708 @@ func TestCommandFlagDefaults(t *testing.T) {
 		})
 	}
 }
+
+func TestResolveColumns(t *testing.T) {
+	testCases := []struct {
+		spec     string
+		width    int
+		expected []string
+		wantErr  bool
+	}{
+		{"", 200, defaultColumns, false},
+		{"auto", 0, defaultColumns, false},
+		{"auto", 50, narrowColumns, false},
+		{"auto", 100, defaultColumns, false},
+		{"auto", 160, wideColumns, false},
+		{"name,state,id", 80, []string{"name", "state", "id"}, false},
+		{" Name , STATE ", 80, []string{"name", "state"}, false},
+		{"name,bogus", 80, nil, true},
+		{",", 80, nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.spec, func(t *testing.T) {
+			columns, err := resolveColumns(tc.spec, tc.width)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for spec %q", tc.spec)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(columns, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v, got %v", tc.expected, columns)
+			}
+		})
+	}
+}
+
+func TestPrintMachineTableColumns(t *testing.T) {
+	machines := []models.Machine{
+		{ID: "0123456789abcdef", Name: "prod", Tag: "enterprise", State: "running", CreatedAt: "2024-01-01T00:00:00Z"},
+	}
+
+	var output bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	printMachineTable("Wide", machines, wideColumns...)
+
+	w.Close()
+	os.Stdout = oldStdout
+	output.ReadFrom(r)
+
+	outputStr := output.String()
+	if !strings.Contains(outputStr, "01234567 ") || strings.Contains(outputStr, "0123456789abcdef") {
+		t.Error("Wide layout should show the shortened ID")
+	}
+	if !strings.Contains(outputStr, "Created") || !strings.Contains(outputStr, "2024-01-01T00:00:00Z") {
+		t.Error("Wide layout should include the Created column")
+	}
+}
+
+func TestGetBearerTokenEndpointMismatch(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	defer func() { constants.TGCLOUD_BASE_URL = originalBaseURL }()
+
+	if err := helpers.WriteCredentials(constants.CredsFile, "prod_token", "https://tgcloud.io/api"); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+
+	constants.TGCLOUD_BASE_URL = "https://tgcloud.io/api/"
+	if token, err := getBearerToken(); err != nil || token != "prod_token" {
+		t.Errorf("Trailing slash should not cause a mismatch, got %q (%v)", token, err)
+	}
+
+	constants.TGCLOUD_BASE_URL = "https://staging.tgcloud.io/api"
+	_, err := getBearerToken()
+	if err == nil {
+		t.Fatal("Expected endpoint mismatch error")
+	}
+	expected := "stored token was issued for https://tgcloud.io/api but you are targeting https://staging.tgcloud.io/api; run tg cloud login"
+	if err.Error() != expected {
+		t.Errorf("Expected %q, got %q", expected, err.Error())
+	}
+}
+
+func TestGetBearerTokenLegacyFileAgainstCustomEndpoint(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	defer func() { constants.TGCLOUD_BASE_URL = originalBaseURL }()
+
+	if err := os.WriteFile(constants.CredsFile, []byte("legacy_token"), 0600); err != nil {
+		t.Fatalf("Failed to write token: %v", err)
+	}
+
+	constants.TGCLOUD_BASE_URL = "https://staging.tgcloud.io/api"
+	if _, err := getBearerToken(); err == nil || !strings.Contains(err.Error(), "run tg cloud login") {
+		t.Errorf("Legacy token should be refused against a non-default endpoint, got %v", err)
+	}
+}
+
+func TestPerformMachineOperationEvents(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/solution/start/m1" {
+			w.Write([]byte(`{"Message":"Starting"}`))
+			return
+		}
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	defer func() { constants.TGCLOUD_BASE_URL = originalBaseURL }()
+	constants.TGCLOUD_BASE_URL = mockServer.URL
+
+	if err := helpers.WriteCredentials(constants.CredsFile, "token", mockServer.URL); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+
+	run := func(action, id string) string {
+		var buf bytes.Buffer
+		emitter := events.New(&buf)
+
+		oldStdout := os.Stdout
+		_, w, _ := os.Pipe()
+		os.Stdout = w
+		performMachineOperation(action, id, nil, emitter)
+		w.Close()
+		os.Stdout = oldStdout
+
+		emitter.Finish()
+		return buf.String()
+	}
+
+	output := run("start", "m1")
+	for _, expected := range []string{`"event":"machine.requested"`, `"event":"machine.started"`, `"message":"Starting"`, `"status":"ok"`} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %s in events:\n%s", expected, output)
+		}
+	}
+
+	output = run("stop", "m1")
+	if !strings.Contains(output, `"status":"error"`) || strings.Contains(output, "machine.stopped") {
+		t.Errorf("Expected an error result for a rejected token, got:\n%s", output)
+	}
+}
+
+// captureStdout runs fn and returns what it printed.
+func captureStdout(fn func()) string {
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+// mockArchiveCloud serves /solution with a machine that stays "unarchiving"
+// for a number of polls after /solution/unarchive is called.
+func mockArchiveCloud(t *testing.T, state *string, pollsUntilReady int) *httptest.Server {
+	t.Helper()
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/solution/unarchive/m1":
+			*state = "unarchiving"
+			w.Write([]byte(`{"Message":"Restoring"}`))
+		case "/solution/archive/m1":
+			*state = "archived"
+			w.Write([]byte(`{"Message":"Archiving"}`))
+		case "/solution":
+			if *state == "unarchiving" {
+				if pollsUntilReady == 0 {
+					*state = "stopped"
+				}
+				pollsUntilReady--
+			}
+			fmt.Fprintf(w, `{"Error":false,"Result":[{"ID":"m1","Name":"one","State":%q},{"ID":"m2","Name":"two","State":"ready"}]}`, *state)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+}
+
+func useMockCloud(t *testing.T, url string) {
+	t.Helper()
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	constants.TGCLOUD_BASE_URL = url
+	t.Cleanup(func() { constants.TGCLOUD_BASE_URL = originalBaseURL })
+
+	if err := helpers.WriteCredentials(constants.CredsFile, "token", url); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+}
+
+func newMachineCmd(id string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("id", id, "")
+	cmd.Flags().Bool("yes", false, "")
+	cmd.Flags().Bool("wait", false, "")
+	cmd.Flags().Duration("wait-timeout", time.Second, "")
+	return cmd
+}
+
+func TestConfirm(t *testing.T) {
+	original := confirmInput
+	defer func() { confirmInput = original }()
+
+	for answer, expected := range map[string]bool{"y\n": true, "YES\n": true, "n\n": false, "\n": false, "": false} {
+		confirmInput = strings.NewReader(answer)
+		var result bool
+		captureStdout(func() { result = confirm(os.Stdout, "Proceed?") })
+		if result != expected {
+			t.Errorf("confirm with answer %q = %v, expected %v", answer, result, expected)
+		}
+	}
+}
+
+func TestRunArchiveConfirmation(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	state := "stopped"
+	mockServer := mockArchiveCloud(t, &state, 0)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	original := confirmInput
+	defer func() { confirmInput = original }()
+
+	confirmInput = strings.NewReader("n\n")
+	output := captureStdout(func() { RunArchive(newMachineCmd("m1"), []string{}) })
+	if !strings.Contains(output, "detaches its compute") || !strings.Contains(output, "cancelled") || state != "stopped" {
+		t.Errorf("Declining should cancel the archive, got state %s:\n%s", state, output)
+	}
+
+	cmd := newMachineCmd("m1")
+	cmd.Flags().Set("yes", "true")
+	output = captureStdout(func() { RunArchive(cmd, []string{}) })
+	if state != "archived" || strings.Contains(output, "[y/N]") {
+		t.Errorf("--yes should archive without prompting, got state %s:\n%s", state, output)
+	}
+}
+
+func TestRunArchiveEventsPrompt(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	state := "stopped"
+	mockServer := mockArchiveCloud(t, &state, 0)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	original := confirmInput
+	defer func() { confirmInput = original }()
+	confirmInput = strings.NewReader("y\n")
+
+	cmd := newMachineCmd("m1")
+	cmd.Flags().Bool("events", true, "")
+	output := captureStdout(func() { RunArchive(cmd, []string{}) })
+	assertEventLines(t, output)
+	if state != "archived" {
+		t.Errorf("Expected the confirmed archive to run, got state %s", state)
+	}
+}
+
+// assertEventLines fails unless every line of out is a JSON event.
+func assertEventLines(t *testing.T, out string) {
+	t.Helper()
+	for _, line := range strings.Split(strings.TrimSpace(out), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Errorf("Expected only events on stdout, got %q", line)
+		}
+	}
+}
+
+func TestRunArchivePromptWithOutFile(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	state := "stopped"
+	mockServer := mockArchiveCloud(t, &state, 0)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	original := confirmInput
+	defer func() { confirmInput = original }()
+	confirmInput = strings.NewReader("y\n")
+
+	path := filepath.Join(t.TempDir(), "archive.txt")
+	out, err := helpers.OpenOutFile(path)
+	if err != nil {
+		t.Fatalf("OpenOutFile failed: %v", err)
+	}
+	terminal := captureStdout(func() { RunArchive(newMachineCmd("m1"), []string{}) })
+	out.Commit()
+
+	// The question stays on the terminal while the result goes to the file.
+	data, _ := os.ReadFile(path)
+	if !strings.Contains(terminal, "Archive m1? Archiving detaches its compute. [y/N] ") || strings.Contains(string(data), "[y/N]") {
+		t.Errorf("Expected the prompt on the terminal only, got terminal %q and file %q", terminal, data)
+	}
+	if state != "archived" || !strings.Contains(string(data), "tgcloud response: Archiving") {
+		t.Errorf("Expected the result in the file, got state %s and file %q", state, data)
+	}
+}
+
+func TestRunUnarchiveWait(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	originalInterval := machinePollInterval
+	machinePollInterval = time.Millisecond
+	defer func() { machinePollInterval = originalInterval }()
+
+	state := "archived"
+	mockServer := mockArchiveCloud(t, &state, 2)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	cmd := newMachineCmd("m1")
+	cmd.Flags().Set("yes", "true")
+	cmd.Flags().Set("wait", "true")
+	output := captureStdout(func() { RunUnarchive(cmd, []string{}) })
+
+	for _, expected := range []string{"tgcloud response: Restoring", "status: unarchiving", "m1 restored (stopped)"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+}
+
+func TestWaitForRestoreTimeout(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	originalInterval := machinePollInterval
+	machinePollInterval = time.Millisecond
+	defer func() { machinePollInterval = originalInterval }()
+
+	state := "unarchiving"
+	mockServer := mockArchiveCloud(t, &state, 1000)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	var err error
+	captureStdout(func() { err = waitForRestore("m1", 10*time.Millisecond, nil) })
+	if err == nil || !strings.Contains(err.Error(), "timed out") {
+		t.Errorf("Expected timeout, got %v", err)
+	}
+
+	captureStdout(func() { err = waitForRestore("missing", time.Second, nil) })
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
+
+func TestRunListArchivedOnly(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	state := "archived"
+	mockServer := mockArchiveCloud(t, &state, 0)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("activeonly", "y", "")
+	cmd.Flags().Bool("archived-only", true, "")
+	cmd.Flags().String("output", "json", "")
+	cmd.Flags().String("columns", "", "")
+
+	var response struct {
+		Result []models.Machine `json:"result"`
+	}
+	output := captureStdout(func() { RunList(cmd, []string{}) })
+	if err := json.Unmarshal([]byte(output), &response); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, output)
+	}
+	if len(response.Result) != 1 || response.Result[0].ID != "m1" {
+		t.Errorf("Expected only the archived machine, got %+v", response.Result)
+	}
+
+	cmd.Flags().Set("output", "stdout")
+	if output := captureStdout(func() { RunList(cmd, []string{}) }); !strings.Contains(output, "[archived]") {
+		t.Errorf("Archived machines should be rendered distinctly:\n%s", output)
+	}
+}
+
+func TestIncludeTerminated(t *testing.T) {
+	tests := []struct {
+		name     string
+		args     []string
+		expected bool
+		wantErr  bool
+	}{
+		{"default hides terminated", nil, false, false},
+		{"include-terminated", []string{"--include-terminated"}, true, false},
+		{"deprecated activeonly n", []string{"--activeonly", "n"}, true, false},
+		{"deprecated activeonly N", []string{"--activeonly", "N"}, true, false},
+		{"deprecated activeonly no", []string{"-a", "no"}, true, false},
+		{"deprecated activeonly y", []string{"-a", "y"}, false, false},
+		{"deprecated activeonly YES", []string{"-a", "YES"}, false, false},
+		{"deprecated activeonly garbage", []string{"-a", "maybe"}, false, true},
+		{"include-terminated wins", []string{"-a", "y", "--include-terminated"}, true, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cmd := &cobra.Command{}
+			cmd.Flags().Bool("include-terminated", false, "")
+			cmd.Flags().StringP("activeonly", "a", "y", "")
+			if err := cmd.ParseFlags(tt.args); err != nil {
+				t.Fatalf("Failed to parse flags: %v", err)
+			}
+			got, err := includeTerminated(cmd)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("includeTerminated(%v) error = %v, wantErr %v", tt.args, err, tt.wantErr)
+			}
+			if got != tt.expected {
+				t.Errorf("includeTerminated(%v) = %v, expected %v", tt.args, got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestFormatMachineTableGolden(t *testing.T) {
+	machines := outputtest.Machines()
+	outputtest.AssertGolden(t, "machine_table_default", []byte(formatMachineTable("tgcloud solutions", machines, 1)))
+	outputtest.AssertGolden(t, "machine_table_narrow", []byte(formatMachineTable("tgcloud solutions", machines, 1, narrowColumns...)))
+	outputtest.AssertGolden(t, "machine_table_wide", []byte(formatMachineTable("tgcloud solutions", machines, 1, wideColumns...)))
+	outputtest.AssertGolden(t, "machine_table_empty", []byte(formatMachineTable("tgcloud solutions", nil, 1)))
+}
+
+func TestFormatMachineListJSONGolden(t *testing.T) {
+	outputtest.AssertGolden(t, "machine_list_json", []byte(formatMachineListJSON(outputtest.Machines())))
+	outputtest.AssertGolden(t, "machine_list_json_empty", []byte(formatMachineListJSON(nil)))
+}
+
+func TestFormatLoginJSONGolden(t *testing.T) {
+	outputtest.AssertGolden(t, "login_json_success", []byte(formatLoginJSON(outputtest.LoginToken)))
+	outputtest.AssertGolden(t, "login_json_failure", []byte(formatLoginJSON("")))
+}
+
+func TestGroupMachines(t *testing.T) {
+	machines := append(outputtest.Machines(), models.Machine{ID: "e5", Name: "untagged", State: "ready"})
+
+	groups := groupMachines(machines, "state")
+	var keys []string
+	for _, group := range groups {
+		keys = append(keys, fmt.Sprintf("%s=%d", group.Key, len(group.Machines)))
+	}
+	if got := strings.Join(keys, ","); got != "archived=1,ready=2,stopped=1,terminated=1" {
+		t.Errorf("Unexpected state groups: %s", got)
+	}
+	if groups[1].Machines[0].Name != "production" || groups[1].Machines[1].Name != "untagged" {
+		t.Error("Machines should keep their order within a group")
+	}
+
+	groups = groupMachines(machines, "tag")
+	if groups[0].Key != "(none)" || groups[0].Machines[0].Name != "untagged" {
+		t.Errorf("Empty tags should be grouped under (none), got %+v", groups[0])
+	}
+}
+
+func TestFormatMachineGroupsGolden(t *testing.T) {
+	groups := groupMachines(outputtest.Machines(), "tag")
+	outputtest.AssertGolden(t, "machine_groups_tag", []byte(formatMachineGroups("tgcloud solutions", "tag", groups)))
+	outputtest.AssertGolden(t, "machine_groups_json", []byte(formatMachineGroupsJSON(groups)))
+}
+
+func TestOlderThan(t *testing.T) {
+	now := time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC)
+	machines := append(outputtest.Machines(), models.Machine{Name: "mystery", State: "ready", CreatedAt: "last tuesday"})
+
+	kept, unknown := olderThan(machines, 10*24*time.Hour, now)
+	var names []string
+	for _, machine := range kept {
+		names = append(names, machine.Name)
+	}
+	if strings.Join(names, ",") != "production,cold-storage,old" {
+		t.Errorf("Unexpected machines kept: %v", names)
+	}
+	if len(unknown) != 1 || unknown[0].Name != "mystery" {
+		t.Errorf("Expected the unparseable machine to be reported, got %+v", unknown)
+	}
+
+	if kept, _ := olderThan(machines, 0, now); len(kept) != 4 {
+		t.Errorf("A zero age should keep every dated machine, got %d", len(kept))
+	}
+}
+
+func TestRunListStateAndAge(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := json.Marshal(map[string]interface{}{"Error": false, "Result": outputtest.Machines()})
+		w.Write(result)
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time { return time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC) }
+	defer func() { helpers.Now = oldNow }()
+
+	run := func(states []string, olderThan string) []models.Machine {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("include-terminated", false, "")
+		cmd.Flags().String("output", "json", "")
+		cmd.Flags().String("columns", "", "")
+		cmd.Flags().StringSlice("state", states, "")
+		cmd.Flags().String("older-than", olderThan, "")
+		cmd.Flags().Bool("stale", false, "")
+
+		var response struct {
+			Result []models.Machine `json:"result"`
+		}
+		out := captureStdout(func() { RunList(cmd, []string{}) })
+		if err := json.Unmarshal([]byte(out), &response); err != nil {
+			t.Fatalf("Invalid JSON output: %v\n%s", err, out)
+		}
+		return response.Result
+	}
+
+	names := func(machines []models.Machine) string {
+		var names []string
+		for _, machine := range machines {
+			names = append(names, machine.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	tests := []struct {
+		states    []string
+		olderThan string
+		expected  string
+	}{
+		{nil, "", "cold-storage,production,staging-cluster-with-a-long-name"},
+		{[]string{"READY"}, "", "production"},
+		{[]string{"ready", "stopped"}, "", "production,staging-cluster-with-a-long-name"},
+		{nil, "10d", "cold-storage,production"},
+		{[]string{"stopped"}, "10d", ""},
+		{[]string{"ready"}, "3w", "production"},
+		{[]string{"ready"}, "1000w", ""},
+	}
+	for _, tt := range tests {
+		if got := names(run(tt.states, tt.olderThan)); got != tt.expected {
+			t.Errorf("--state %v --older-than %q: got %q, want %q", tt.states, tt.olderThan, got, tt.expected)
+		}
+	}
+}
+
+func TestRunListCount(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, _ := json.Marshal(map[string]interface{}{"Error": false, "Result": outputtest.Machines()})
+		w.Write(result)
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time { return time.Date(2024, 2, 10, 0, 0, 0, 0, time.UTC) }
+	defer func() { helpers.Now = oldNow }()
+
+	tests := []struct {
+		states            []string
+		olderThan         string
+		includeTerminated bool
+		output            string
+		expected          string
+	}{
+		{nil, "", false, "stdout", "3\n"},
+		{nil, "", true, "stdout", "4\n"},
+		{[]string{"ready"}, "", false, "json", "1\n"},
+		{[]string{"ready", "stopped"}, "", false, "stdout", "2\n"},
+		{nil, "10d", false, "stdout", "2\n"},
+		{[]string{"stopped"}, "10d", false, "stdout", "0\n"},
+	}
+	for _, tt := range tests {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("include-terminated", tt.includeTerminated, "")
+		cmd.Flags().String("output", tt.output, "")
+		cmd.Flags().String("columns", "", "")
+		cmd.Flags().StringSlice("state", tt.states, "")
+		cmd.Flags().String("older-than", tt.olderThan, "")
+		cmd.Flags().Bool("stale", false, "")
+		cmd.Flags().Bool("count", true, "")
+
+		if got := captureStdout(func() { RunList(cmd, []string{}) }); got != tt.expected {
+			t.Errorf("--state %v --older-than %q --include-terminated=%v: got %q, want %q",
+				tt.states, tt.olderThan, tt.includeTerminated, got, tt.expected)
+		}
+	}
+}
+
+func TestListingsAreSorted(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	// tgcloud's order changes from one request to the next.
+	requests := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		machines := outputtest.Machines()
+		if requests%2 == 0 {
+			for i, j := 0, len(machines)-1; i < j; i, j = i+1, j-1 {
+				machines[i], machines[j] = machines[j], machines[i]
+			}
+		}
+		result, _ := json.Marshal(map[string]interface{}{"Error": false, "Result": machines})
+		w.Write(result)
+	}))
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	list := func() string {
+		cmd := &cobra.Command{}
+		cmd.Flags().Bool("include-terminated", true, "")
+		cmd.Flags().String("output", "stdout", "")
+		cmd.Flags().String("columns", "", "")
+		return captureStdout(func() { RunList(cmd, []string{}) })
+	}
+	if first, second := list(), list(); first != second {
+		t.Errorf("list output differs between runs:\n%s\n---\n%s", first, second)
+	}
+
+	out := list()
+	if !(strings.Index(out, "cold-storage") < strings.Index(out, "old ") &&
+		strings.Index(out, "old ") < strings.Index(out, "production") &&
+		strings.Index(out, "production") < strings.Index(out, "staging-cluster")) {
+		t.Errorf("Expected machines sorted by name:\n%s", out)
+	}
+}
+
+func TestParseOperationParams(t *testing.T) {
+	params, err := parseOperationParams([]string{"force=true", "note=a b&c=d", "tag=x", "tag=y", "empty="})
+	if err != nil {
+		t.Fatalf("parseOperationParams failed: %v", err)
+	}
+	if expected := "empty=&force=true&note=a+b%26c%3Dd&tag=x&tag=y"; params.Encode() != expected {
+		t.Errorf("Expected %s, got %s", expected, params.Encode())
+	}
+	if params, err := parseOperationParams(nil); params != nil || err != nil {
+		t.Errorf("Expected no parameters, got %v, %v", params, err)
+	}
+
+	for flag, expected := range map[string]string{
+		"force":     "expected key=value",
+		"=true":     "expected key=value",
+		"a b=1":     "invalid key",
+		"1st=1":     "invalid key",
+		"x&y=1":     "invalid key",
+		"note=a\nb": "cannot span lines",
+	} {
+		if _, err := parseOperationParams([]string{flag}); err == nil || !strings.Contains(err.Error(), expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", flag, expected, err)
+		}
+	}
+}
+
+func TestRequestMachineOperationParams(t *testing.T) {
+	var requests []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests = append(requests, r.Method+" "+r.URL.RequestURI())
+		w.Write([]byte(`{"Message":"ok"}`))
+	}))
+	defer mockServer.Close()
+
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	defer func() { constants.TGCLOUD_BASE_URL = originalBaseURL }()
+	constants.TGCLOUD_BASE_URL = mockServer.URL
+
+	params, _ := parseOperationParams([]string{"force=true", "reason=clean up"})
+	requestMachineOperation(mockServer.Client(), "token", "terminate", "m1", params)
+	requestMachineOperation(mockServer.Client(), "token", "archive", "m1", params)
+	requestMachineOperation(mockServer.Client(), "token", "start", "m1", nil)
+
+	expected := []string{
+		"DELETE /solution/destroy/m1?force=true&reason=clean+up",
+		"POST /solution/archive/m1?force=true&reason=clean+up",
+		"POST /solution/start/m1",
+	}
+	if strings.Join(requests, "\n") != strings.Join(expected, "\n") {
+		t.Errorf("Expected requests %q, got %q", expected, requests)
+	}
+}
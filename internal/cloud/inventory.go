@@ -0,0 +1,243 @@
+package cloud
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// inventoryVersion is bumped whenever the export-inventory document changes
+// incompatibly.
+const inventoryVersion = 1
+
+// Inventory is the document printed by export-inventory:
+//
+//	{
+//	  "version": 1,
+//	  "keyBy": "name",
+//	  "solutions": {
+//	    "<name or ID>": {
+//	      "id": "...", "name": "...", "tag": "...", "state": "...", "createdAt": "...",
+//	      "attributes": { every other field tgcloud returns, minus credentials }
+//	    }
+//	  }
+//	}
+//
+// Solutions are keyed by a stable identifier so the document diffs cleanly
+// between exports.
+type Inventory struct {
+	Version   int                          `json:"version"`
+	KeyBy     string                       `json:"keyBy"`
+	Solutions map[string]InventorySolution `json:"solutions"`
+}
+
+// InventorySolution is one solution in the inventory.
+type InventorySolution struct {
+	ID         string                 `json:"id"`
+	Name       string                 `json:"name"`
+	Tag        string                 `json:"tag"`
+	State      string                 `json:"state"`
+	CreatedAt  string                 `json:"createdAt"`
+	Attributes map[string]interface{} `json:"attributes"`
+}
+
+// inventoryFields are the API fields lifted to the top of each solution.
+var inventoryFields = map[string]bool{"ID": true, "Name": true, "Tag": true, "State": true, "CreatedAt": true}
+
+// credentialKey matches attribute names that hold credentials. They are
+// dropped at any depth.
+var credentialKey = regexp.MustCompile(`(?i)password|passwd|secret|token|credential|api_?key|private_?key`)
+
+// terraformName matches the characters a Terraform resource name may hold.
+var terraformName = regexp.MustCompile(`[^A-Za-z0-9_-]`)
+
+func RunExportInventory(cmd *cobra.Command, args []string) {
+	keyBy, _ := cmd.Flags().GetString("key")
+	withTerminated, _ := cmd.Flags().GetBool("include-terminated")
+	tfResource, _ := cmd.Flags().GetString("tf-resource")
+	tfFormat, _ := cmd.Flags().GetString("tf-format")
+	tfFile, _ := cmd.Flags().GetString("tf-file")
+
+	fail := func(format string, a ...interface{}) {
+		fmt.Fprintf(os.Stderr, "Error: "+format+"\n", a...)
+		helpers.Exit(1)
+	}
+
+	if keyBy != "name" && keyBy != "id" {
+		fail("unknown --key %q (expected name or id)", keyBy)
+	}
+	if tfFormat != "block" && tfFormat != "command" {
+		fail("unknown --tf-format %q (expected block or command)", tfFormat)
+	}
+
+	bearerToken, err := getBearerToken()
+	if err != nil {
+		fail("getting bearer token: %v", err)
+	}
+	result, status, err := fetchSolutions(bearerToken)
+	if status == 401 {
+		fail("you should re-login using 'tg cloud login'%s", expiredTokenHint(bearerToken))
+	}
+	if err != nil {
+		fail("%v", err)
+	}
+
+	inventory, err := buildInventory(result, keyBy, withTerminated)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if tfResource != "" {
+		if tfFile == "" {
+			tfFile = "imports.tf"
+			if tfFormat == "command" {
+				tfFile = "imports.sh"
+			}
+		}
+		imports, err := formatTerraformImports(inventory, tfResource, tfFormat)
+		if err != nil {
+			fail("%v", err)
+		}
+		if err := os.WriteFile(tfFile, []byte(imports), 0644); err != nil {
+			fail("writing %s: %v", tfFile, err)
+		}
+		fmt.Fprintf(os.Stderr, "Wrote %d Terraform imports to %s\n", len(inventory.Solutions), tfFile)
+	}
+
+	fmt.Fprint(helpers.Stdout(), formatInventory(inventory))
+}
+
+// buildInventory normalizes the raw solution list. Terminated solutions are
+// left out unless withTerminated is set, and keying by name fails when a
+// name is empty or shared, since the key would not be stable.
+func buildInventory(result json.RawMessage, keyBy string, withTerminated bool) (Inventory, error) {
+	// Numbers are kept as tgcloud wrote them rather than as float64.
+	decoder := json.NewDecoder(bytes.NewReader(result))
+	decoder.UseNumber()
+	var raw []map[string]interface{}
+	if err := decoder.Decode(&raw); err != nil {
+		return Inventory{}, fmt.Errorf("unable to parse solutions: %v", err)
+	}
+
+	inventory := Inventory{Version: inventoryVersion, KeyBy: keyBy, Solutions: make(map[string]InventorySolution)}
+	for _, fields := range raw {
+		solution := InventorySolution{Attributes: make(map[string]interface{})}
+		for key, value := range fields {
+			if inventoryFields[key] {
+				text, _ := value.(string)
+				switch key {
+				case "ID":
+					solution.ID = text
+				case "Name":
+					solution.Name = text
+				case "Tag":
+					solution.Tag = text
+				case "State":
+					solution.State = text
+				case "CreatedAt":
+					solution.CreatedAt = text
+				}
+				continue
+			}
+			if credentialKey.MatchString(key) {
+				continue
+			}
+			solution.Attributes[key] = withoutCredentials(value)
+		}
+		if !withTerminated && solution.State == "terminated" {
+			continue
+		}
+
+		key := solution.ID
+		if keyBy == "name" {
+			key = solution.Name
+			if key == "" {
+				return Inventory{}, fmt.Errorf("solution %s has no name; use --key id", solution.ID)
+			}
+		}
+		if other, ok := inventory.Solutions[key]; ok {
+			return Inventory{}, fmt.Errorf("solutions %s and %s share the %s %q; use --key id", other.ID, solution.ID, keyBy, key)
+		}
+		inventory.Solutions[key] = solution
+	}
+	return inventory, nil
+}
+
+// withoutCredentials drops credential fields from nested attributes.
+func withoutCredentials(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		cleaned := make(map[string]interface{}, len(v))
+		for key, nested := range v {
+			if !credentialKey.MatchString(key) {
+				cleaned[key] = withoutCredentials(nested)
+			}
+		}
+		return cleaned
+	case []interface{}:
+		cleaned := make([]interface{}, len(v))
+		for i, nested := range v {
+			cleaned[i] = withoutCredentials(nested)
+		}
+		return cleaned
+	}
+	return value
+}
+
+// formatInventory renders the inventory as indented JSON. Map keys are
+// sorted, so the output is stable.
+func formatInventory(inventory Inventory) string {
+	result, _ := json.MarshalIndent(inventory, "", "  ")
+	return string(result) + "\n"
+}
+
+// formatTerraformImports renders one import per solution, as Terraform 1.5
+// import {} blocks or as terraform import command lines. Resource names are
+// derived from the inventory keys.
+func formatTerraformImports(inventory Inventory, resource, format string) (string, error) {
+	keys := make([]string, 0, len(inventory.Solutions))
+	for key := range inventory.Solutions {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	used := make(map[string]string)
+	for _, key := range keys {
+		name := terraformResourceName(key)
+		if other, ok := used[name]; ok {
+			return "", fmt.Errorf("%q and %q both map to the Terraform name %s; use --key id", other, key, name)
+		}
+		used[name] = key
+
+		address := resource + "." + name
+		id := inventory.Solutions[key].ID
+		if format == "command" {
+			fmt.Fprintf(&b, "terraform import %s %s\n", address, id)
+			continue
+		}
+		if b.Len() > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "import {\n  to = %s\n  id = %q\n}\n", address, id)
+	}
+	return b.String(), nil
+}
+
+// terraformResourceName turns an inventory key into a valid Terraform
+// resource name: unsupported characters become underscores and a leading
+// digit or hyphen gets an underscore prefix.
+func terraformResourceName(key string) string {
+	name := terraformName.ReplaceAllString(key, "_")
+	if name == "" || !(name[0] == '_' || (name[0] >= 'A' && name[0] <= 'Z') || (name[0] >= 'a' && name[0] <= 'z')) {
+		name = "_" + name
+	}
+	return name
+}
@@ -0,0 +1,122 @@
+package cloud
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/outputtest"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// syntheticSolutions serves the hand-written solution list and returns its
+// Result.
+func syntheticSolutions(t *testing.T) json.RawMessage {
+	t.Helper()
+	_, cleanup := setupTestEnvironment(t)
+	t.Cleanup(cleanup)
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(outputtest.SolutionListResponse))
+	}))
+	t.Cleanup(mockServer.Close)
+
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	t.Cleanup(func() { constants.TGCLOUD_BASE_URL = originalBaseURL })
+	constants.TGCLOUD_BASE_URL = mockServer.URL
+	if err := helpers.WriteCredentials(constants.CredsFile, "token", mockServer.URL); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+
+	result, _, err := fetchSolutions("token")
+	if err != nil {
+		t.Fatalf("fetchSolutions failed: %v", err)
+	}
+	return result
+}
+
+func TestInventoryGolden(t *testing.T) {
+	result := syntheticSolutions(t)
+
+	byName, err := buildInventory(result, "name", false)
+	if err != nil {
+		t.Fatalf("buildInventory failed: %v", err)
+	}
+	outputtest.AssertGolden(t, "inventory_by_name", []byte(formatInventory(byName)))
+
+	byID, err := buildInventory(result, "id", true)
+	if err != nil {
+		t.Fatalf("buildInventory failed: %v", err)
+	}
+	outputtest.AssertGolden(t, "inventory_by_id", []byte(formatInventory(byID)))
+
+	blocks, err := formatTerraformImports(byName, "tgcloud_solution", "block")
+	if err != nil {
+		t.Fatalf("formatTerraformImports failed: %v", err)
+	}
+	outputtest.AssertGolden(t, "inventory_tf_blocks", []byte(blocks))
+
+	commands, err := formatTerraformImports(byID, "tgcloud_solution", "command")
+	if err != nil {
+		t.Fatalf("formatTerraformImports failed: %v", err)
+	}
+	outputtest.AssertGolden(t, "inventory_tf_commands", []byte(commands))
+}
+
+func TestInventoryExcludesCredentials(t *testing.T) {
+	inventory, err := buildInventory(syntheticSolutions(t), "name", true)
+	if err != nil {
+		t.Fatalf("buildInventory failed: %v", err)
+	}
+	rendered := formatInventory(inventory)
+	for _, secret := range []string{"s3cret", "bk_abc", "hunter2", "Password", "Token"} {
+		if strings.Contains(rendered, secret) {
+			t.Errorf("Inventory should not contain %q", secret)
+		}
+	}
+	if !strings.Contains(rendered, `"Schedule": "0 2 * * *"`) {
+		t.Error("Non-credential nested attributes should be kept")
+	}
+}
+
+func TestInventoryKeyConflicts(t *testing.T) {
+	tests := []struct {
+		name    string
+		result  string
+		errText string
+	}{
+		{"shared name", `[{"ID":"1","Name":"dup"},{"ID":"2","Name":"dup"}]`, `share the name "dup"; use --key id`},
+		{"empty name", `[{"ID":"1","Name":""}]`, "solution 1 has no name; use --key id"},
+	}
+	for _, tt := range tests {
+		if _, err := buildInventory(json.RawMessage(tt.result), "name", false); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.name, tt.errText, err)
+		}
+	}
+
+	inventory, err := buildInventory(json.RawMessage(`[{"ID":"1","Name":"a.b"},{"ID":"2","Name":"a_b"}]`), "name", false)
+	if err != nil {
+		t.Fatalf("buildInventory failed: %v", err)
+	}
+	if _, err := formatTerraformImports(inventory, "tgcloud_solution", "block"); err == nil {
+		t.Error("Expected an error when two keys map to the same Terraform name")
+	}
+}
+
+func TestTerraformResourceName(t *testing.T) {
+	for key, expected := range map[string]string{
+		"production":   "production",
+		"cold-storage": "cold-storage",
+		"team a/prod":  "team_a_prod",
+		"1st":          "_1st",
+		"-x":           "_-x",
+		"":             "_",
+	} {
+		if got := terraformResourceName(key); got != expected {
+			t.Errorf("terraformResourceName(%q) = %q, expected %q", key, got, expected)
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package cloud
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// Machine-taking commands accept "@N" for row N of the most recent
+// `tg cloud list` and "last" for the machine most recently operated on.
+// Both are resolved from a state file next to the config, written to
+// machineRefsFile when set.
+var machineRefsFile string
+
+// defaultRefMaxAge is how long a list or last operation stays usable as a
+// reference unless tgcloud.ref_max_age says otherwise.
+const defaultRefMaxAge = time.Hour
+
+// listedMachine is a machine together with its row in the list output.
+type listedMachine struct {
+	Ordinal int `json:"ordinal"`
+	models.Machine
+}
+
+type machineRefs struct {
+	ListedAt time.Time       `json:"listedAt"`
+	Listed   []listedMachine `json:"listed"`
+	LastID   string          `json:"lastId,omitempty"`
+	LastAt   time.Time       `json:"lastAt"`
+}
+
+func machineRefsPath() string {
+	if machineRefsFile != "" {
+		return machineRefsFile
+	}
+	return filepath.Join(constants.ConfigDir, "machine_refs.json")
+}
+
+// loadMachineRefs returns the saved references; a missing file yields an
+// empty set.
+func loadMachineRefs() (machineRefs, error) {
+	var refs machineRefs
+	data, err := os.ReadFile(machineRefsPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return refs, nil
+	}
+	if err != nil {
+		return refs, err
+	}
+	if err := json.Unmarshal(data, &refs); err != nil {
+		return machineRefs{}, fmt.Errorf("invalid machine reference state %s: %v", machineRefsPath(), err)
+	}
+	return refs, nil
+}
+
+func saveMachineRefs(refs machineRefs) error {
+	data, err := json.MarshalIndent(refs, "", "  ")
+	if err != nil {
+		return err
+	}
+	return helpers.WriteFileAtomic(machineRefsPath(), data, 0600)
+}
+
+// numberMachines assigns ordinals, starting at 1, in display order.
+func numberMachines(machines []models.Machine) []listedMachine {
+	var listed []listedMachine
+	for i, machine := range machines {
+		listed = append(listed, listedMachine{Ordinal: i + 1, Machine: machine})
+	}
+	return listed
+}
+
+// rememberListed records machines, in display order, as the targets of
+// @N references.
+func rememberListed(machines []models.Machine) error {
+	refs, _ := loadMachineRefs()
+	refs.ListedAt = time.Now()
+	refs.Listed = numberMachines(machines)
+	return saveMachineRefs(refs)
+}
+
+// rememberLast records id as the target of the "last" reference.
+func rememberLast(id string) error {
+	refs, _ := loadMachineRefs()
+	refs.LastID = id
+	refs.LastAt = time.Now()
+	return saveMachineRefs(refs)
+}
+
+func refMaxAge() time.Duration {
+	if value := viper.GetString("tgcloud.ref_max_age"); value != "" {
+		if age, err := time.ParseDuration(value); err == nil && age > 0 {
+			return age
+		}
+	}
+	return defaultRefMaxAge
+}
+
+// resolveMachineRef turns "@N" or "last" into a machine ID. Anything else
+// is returned unchanged.
+func resolveMachineRef(ref string) (string, error) {
+	if ref != "last" && !strings.HasPrefix(ref, "@") {
+		return ref, nil
+	}
+
+	refs, err := loadMachineRefs()
+	if err != nil {
+		return "", err
+	}
+	maxAge := refMaxAge()
+
+	if ref == "last" {
+		if refs.LastID == "" {
+			return "", fmt.Errorf("no machine has been operated on yet, so 'last' cannot be resolved")
+		}
+		if age := time.Since(refs.LastAt); age > maxAge {
+			return "", fmt.Errorf("'last' refers to an operation %s ago, older than the %s limit; pass the machine ID", age.Round(time.Second), maxAge)
+		}
+		return refs.LastID, nil
+	}
+
+	ordinal, err := strconv.Atoi(strings.TrimPrefix(ref, "@"))
+	if err != nil || ordinal < 1 {
+		return "", fmt.Errorf("invalid machine reference %q (expected @1, @2, ...)", ref)
+	}
+	if refs.ListedAt.IsZero() {
+		return "", fmt.Errorf("no previous list to resolve %s; run tg cloud list first", ref)
+	}
+	if age := time.Since(refs.ListedAt); age > maxAge {
+		return "", fmt.Errorf("%s refers to a list from %s ago, older than the %s limit; run tg cloud list again", ref, age.Round(time.Second), maxAge)
+	}
+	if ordinal > len(refs.Listed) {
+		return "", fmt.Errorf("%s is out of range; the last list had %d machines", ref, len(refs.Listed))
+	}
+	return refs.Listed[ordinal-1].ID, nil
+}
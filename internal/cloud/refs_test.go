@@ -0,0 +1,149 @@
+package cloud
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func TestResolveMachineRefPassthrough(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	for _, ref := range []string{"a1b2c3d4", "", "lastly"} {
+		if got, err := resolveMachineRef(ref); err != nil || got != ref {
+			t.Errorf("resolveMachineRef(%q) = %q, %v; expected it unchanged", ref, got, err)
+		}
+	}
+}
+
+func TestResolveMachineRefOrdinal(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	if _, err := resolveMachineRef("@1"); err == nil || !strings.Contains(err.Error(), "run tg cloud list first") {
+		t.Errorf("Expected missing list error, got %v", err)
+	}
+
+	if err := rememberListed([]models.Machine{{ID: "m1"}, {ID: "m2"}}); err != nil {
+		t.Fatalf("rememberListed failed: %v", err)
+	}
+
+	tests := []struct {
+		ref      string
+		expected string
+		errText  string
+	}{
+		{"@1", "m1", ""},
+		{"@2", "m2", ""},
+		{"@3", "", "out of range; the last list had 2 machines"},
+		{"@0", "", "invalid machine reference"},
+		{"@x", "", "invalid machine reference"},
+	}
+	for _, tt := range tests {
+		got, err := resolveMachineRef(tt.ref)
+		if tt.errText != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("resolveMachineRef(%q): expected error containing %q, got %v", tt.ref, tt.errText, err)
+			}
+			continue
+		}
+		if err != nil || got != tt.expected {
+			t.Errorf("resolveMachineRef(%q) = %q, %v; expected %q", tt.ref, got, err, tt.expected)
+		}
+	}
+}
+
+func TestResolveMachineRefStale(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	stale := machineRefs{
+		ListedAt: time.Now().Add(-2 * time.Hour),
+		Listed:   numberMachines([]models.Machine{{ID: "m1"}}),
+		LastID:   "m1",
+		LastAt:   time.Now().Add(-2 * time.Hour),
+	}
+	if err := saveMachineRefs(stale); err != nil {
+		t.Fatalf("saveMachineRefs failed: %v", err)
+	}
+
+	for _, ref := range []string{"@1", "last"} {
+		if _, err := resolveMachineRef(ref); err == nil || !strings.Contains(err.Error(), "older than the 1h0m0s limit") {
+			t.Errorf("resolveMachineRef(%q): expected stale error, got %v", ref, err)
+		}
+	}
+
+	viper.Set("tgcloud.ref_max_age", "3h")
+	for _, ref := range []string{"@1", "last"} {
+		if got, err := resolveMachineRef(ref); err != nil || got != "m1" {
+			t.Errorf("resolveMachineRef(%q) with a 3h limit = %q, %v", ref, got, err)
+		}
+	}
+}
+
+func TestResolveMachineRefLast(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	if _, err := resolveMachineRef("last"); err == nil || !strings.Contains(err.Error(), "cannot be resolved") {
+		t.Errorf("Expected error before any operation, got %v", err)
+	}
+
+	rememberListed([]models.Machine{{ID: "m1"}})
+	if err := rememberLast("m9"); err != nil {
+		t.Fatalf("rememberLast failed: %v", err)
+	}
+	if got, err := resolveMachineRef("last"); err != nil || got != "m9" {
+		t.Errorf("Expected last to resolve to m9, got %q, %v", got, err)
+	}
+	if got, _ := resolveMachineRef("@1"); got != "m1" {
+		t.Error("Recording the last machine should keep the listed ones")
+	}
+}
+
+func TestMachineReferencesAcrossCommands(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	state := "ready"
+	mockServer := mockArchiveCloud(t, &state, 0)
+	defer mockServer.Close()
+	useMockCloud(t, mockServer.URL)
+
+	listCmd := &cobra.Command{}
+	listCmd.Flags().String("output", "json", "")
+	listCmd.Flags().String("columns", "", "")
+
+	var response struct {
+		Result []listedMachine `json:"result"`
+	}
+	output := captureStdout(func() { RunList(listCmd, []string{}) })
+	if err := json.Unmarshal([]byte(output), &response); err != nil {
+		t.Fatalf("Invalid JSON output: %v\n%s", err, output)
+	}
+	if len(response.Result) != 2 || response.Result[0].Ordinal != 1 || response.Result[1].Ordinal != 2 {
+		t.Fatalf("Expected ordinals 1 and 2 in list output, got %+v", response.Result)
+	}
+
+	archiveCmd := newMachineCmd("@1")
+	archiveCmd.Flags().Set("yes", "true")
+	output = captureStdout(func() { RunArchive(archiveCmd, []string{}) })
+	if !strings.Contains(output, "Resolved @1 to m1") || state != "archived" {
+		t.Errorf("Expected @1 to archive m1, got state %q:\n%s", state, output)
+	}
+
+	if got, err := resolveMachineRef("last"); err != nil || got != "m1" {
+		t.Errorf("Expected last to be m1 after archiving it, got %q, %v", got, err)
+	}
+
+	output = captureStdout(func() { RunArchive(newMachineCmd("@5"), []string{}) })
+	if !strings.Contains(output, "out of range") {
+		t.Errorf("Expected an out of range error:\n%s", output)
+	}
+}
@@ -0,0 +1,179 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// CheckToken reports on the stored tgcloud token: whether there is one,
+// whether it was issued for the configured endpoint and whether tgcloud
+// still accepts it. The expiry is included when the token carries one.
+func CheckToken() models.TokenStatus {
+	token, endpoint, err := helpers.ReadCredentials(constants.CredsFile)
+	if err != nil || strings.TrimSpace(token) == "" {
+		return models.TokenStatus{Status: models.TokenMissing}
+	}
+	obtainedAt, _ := tokenObtainedAt()
+	return InspectToken(token, endpoint, obtainedAt)
+}
+
+// InspectToken reports on token, issued by endpoint, the way CheckToken
+// does for the stored one. obtainedAt is when a login obtained the token;
+// it is zero when that is unknown, as for a token given on the command
+// line, and a rejection then comes without a clock hint.
+func InspectToken(token, endpoint string, obtainedAt time.Time) models.TokenStatus {
+	status := models.TokenStatus{Endpoint: endpoint}
+	if expiresAt, ok := tokenExpiry(token); ok {
+		status.ExpiresAt = &expiresAt
+	}
+	if !sameEndpoint(endpoint, constants.TGCLOUD_BASE_URL) {
+		status.Status = models.TokenOtherEndpoint
+		return status
+	}
+	if status.ExpiresAt != nil && helpers.Now().After(*status.ExpiresAt) {
+		status.Status = models.TokenExpired
+		return status
+	}
+
+	// Listing solutions is the cheapest authenticated call tgcloud offers.
+	_, code, err := fetchMachines(token)
+	switch {
+	case code == 401:
+		status.Status = models.TokenExpired
+		status.Detail = "rejected by tgcloud"
+		if !obtainedAt.IsZero() {
+			status.Detail += rejectionHint(token, obtainedAt)
+		}
+	case err != nil:
+		status.Status = models.TokenUnknown
+		status.Detail = err.Error()
+	default:
+		status.Status = models.TokenValid
+	}
+	return status
+}
+
+// maxClockSkew is how far the local clock may drift from tgcloud's before
+// it is worth a warning; beyond it, expiry checks on either side misfire.
+const maxClockSkew = 2 * time.Minute
+
+// freshTokenWindow is how recently a token must have been obtained for a
+// rejection as expired to point at the clock rather than the token.
+const freshTokenWindow = 10 * time.Minute
+
+// tokenClaims are the JWT claims tgcli reads.
+type tokenClaims struct {
+	Exp int64 `json:"exp"`
+	Iat int64 `json:"iat"`
+}
+
+// parseTokenClaims decodes the claims of a JWT without verifying it.
+func parseTokenClaims(token string) (tokenClaims, bool) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return tokenClaims{}, false
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return tokenClaims{}, false
+	}
+	var claims tokenClaims
+	if json.Unmarshal(payload, &claims) != nil {
+		return tokenClaims{}, false
+	}
+	return claims, true
+}
+
+// tokenExpiry returns the exp claim of a JWT without verifying it.
+func tokenExpiry(token string) (time.Time, bool) {
+	claims, ok := parseTokenClaims(token)
+	if !ok || claims.Exp == 0 {
+		return time.Time{}, false
+	}
+	return time.Unix(claims.Exp, 0).UTC(), true
+}
+
+// clockSkew estimates how far the local clock is ahead of tgcloud's from
+// the iat claim of a token obtained at obtainedAt, local time. A negative
+// skew means the local clock is behind.
+func clockSkew(token string, obtainedAt time.Time) (time.Duration, bool) {
+	claims, ok := parseTokenClaims(token)
+	if !ok || claims.Iat == 0 {
+		return 0, false
+	}
+	return obtainedAt.Sub(time.Unix(claims.Iat, 0)), true
+}
+
+// describeSkew renders a skew as e.g. "about 1h5m0s ahead of tgcloud's".
+func describeSkew(skew time.Duration) string {
+	direction := "ahead of"
+	if skew < 0 {
+		direction = "behind"
+		skew = -skew
+	}
+	return fmt.Sprintf("about %s %s tgcloud's", skew.Round(time.Second), direction)
+}
+
+// clockSkewWarning returns the warning for a skew beyond maxClockSkew, or
+// an empty string.
+func clockSkewWarning(skew time.Duration) string {
+	if skew <= maxClockSkew && skew >= -maxClockSkew {
+		return ""
+	}
+	return fmt.Sprintf("your system clock is %s, so tokens may be treated as expired. Sync it with NTP (e.g. sudo timedatectl set-ntp true) and log in again.", describeSkew(skew))
+}
+
+// warnSkew warns about a skew beyond maxClockSkew.
+func warnSkew(skew time.Duration) {
+	if warning := clockSkewWarning(skew); warning != "" {
+		helpers.Warn(helpers.WarnClockSkew, "%s", warning)
+	}
+}
+
+// tokenObtainedAt returns when a login obtained the stored token, by the
+// local clock. Imported tokens have no such time, so clock checks skip them.
+func tokenObtainedAt() (time.Time, bool) {
+	return helpers.CredentialsObtainedAt(constants.CredsFile)
+}
+
+// warnClockSkew prints a warning on stderr when the stored token shows the
+// local clock is skewed.
+func warnClockSkew(token string) {
+	obtainedAt, ok := tokenObtainedAt()
+	if !ok {
+		return
+	}
+	if skew, ok := clockSkew(token, obtainedAt); ok {
+		warnSkew(skew)
+	}
+}
+
+// expiredTokenHint explains a rejection of the stored token when logging in
+// again is unlikely to help; see rejectionHint.
+func expiredTokenHint(token string) string {
+	obtainedAt, ok := tokenObtainedAt()
+	if !ok {
+		return ""
+	}
+	return rejectionHint(token, obtainedAt)
+}
+
+// rejectionHint explains a rejection of a token a login obtained at
+// obtainedAt: the clock is skewed, or the token was obtained moments ago.
+// It returns an empty string otherwise.
+func rejectionHint(token string, obtainedAt time.Time) string {
+	if skew, ok := clockSkew(token, obtainedAt); ok && clockSkewWarning(skew) != "" {
+		return fmt.Sprintf(" (your system clock is %s, which makes tokens look expired; sync it with NTP before logging in again)", describeSkew(skew))
+	}
+	if helpers.Now().Sub(obtainedAt) < freshTokenWindow {
+		return " (the token was obtained moments ago; if this repeats right after logging in, check that your system clock is correct)"
+	}
+	return ""
+}
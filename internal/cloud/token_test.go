@@ -0,0 +1,225 @@
+package cloud
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// testJWT builds an unsigned JWT with the given exp claim.
+func testJWT(exp time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"user","exp":%d}`, exp.Unix())))
+	return "eyJhbGciOiJIUzI1NiJ9." + payload + ".signature"
+}
+
+// issuedJWT builds an unsigned JWT issued at iat by tgcloud's clock.
+func issuedJWT(iat time.Time) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf(`{"sub":"user","iat":%d,"exp":%d}`, iat.Unix(), iat.Add(time.Hour).Unix())))
+	return "eyJhbGciOiJIUzI1NiJ9." + payload + ".signature"
+}
+
+func TestCheckToken(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Header.Get("Authorization") {
+		case "Bearer good":
+			w.Write([]byte(`{"Error":false,"Result":[]}`))
+		case "Bearer broken":
+			w.WriteHeader(http.StatusInternalServerError)
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+		}
+	}))
+	defer mockServer.Close()
+
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	defer func() { constants.TGCLOUD_BASE_URL = originalBaseURL }()
+	constants.TGCLOUD_BASE_URL = mockServer.URL
+
+	if status := CheckToken(); status.Status != models.TokenMissing {
+		t.Errorf("Expected a missing token, got %+v", status)
+	}
+
+	future := time.Now().Add(2 * time.Hour).Truncate(time.Second)
+	tests := []struct {
+		name     string
+		token    string
+		endpoint string
+		expected string
+	}{
+		{"accepted", "good", mockServer.URL, models.TokenValid},
+		{"rejected", "revoked", mockServer.URL, models.TokenExpired},
+		{"server error", "broken", mockServer.URL, models.TokenUnknown},
+		{"other endpoint", "good", "https://tgcloud.io/api", models.TokenOtherEndpoint},
+		// An exp in the past is trusted without asking tgcloud.
+		{"expired claim", testJWT(time.Now().Add(-time.Hour)), mockServer.URL, models.TokenExpired},
+	}
+	for _, tt := range tests {
+		if err := helpers.WriteCredentials(constants.CredsFile, tt.token, tt.endpoint); err != nil {
+			t.Fatalf("Failed to write credentials: %v", err)
+		}
+		if status := CheckToken(); status.Status != tt.expected {
+			t.Errorf("%s: expected %s, got %+v", tt.name, tt.expected, status)
+		}
+	}
+
+	// tgcloud decides validity; the exp claim only supplies the expiry.
+	if err := helpers.WriteCredentials(constants.CredsFile, testJWT(future), mockServer.URL); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+	status := CheckToken()
+	if status.Status != models.TokenExpired || status.ExpiresAt == nil || !status.ExpiresAt.Equal(future) {
+		t.Errorf("Expected a rejected token with its expiry, got %+v", status)
+	}
+}
+
+func TestTokenExpiry(t *testing.T) {
+	exp := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	if got, ok := tokenExpiry(testJWT(exp)); !ok || !got.Equal(exp) {
+		t.Errorf("Expected %s, got %s (%v)", exp, got, ok)
+	}
+	for _, token := range []string{"opaque_token", "a.!!!.c", "a." + base64.RawURLEncoding.EncodeToString([]byte(`{"sub":"x"}`)) + ".c"} {
+		if _, ok := tokenExpiry(token); ok {
+			t.Errorf("Expected no expiry for %q", token)
+		}
+	}
+}
+
+func TestClockSkew(t *testing.T) {
+	iat := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		obtainedAt time.Time
+		skew       time.Duration
+		warns      bool
+	}{
+		{iat.Add(5 * time.Second), 5 * time.Second, false},
+		{iat.Add(2 * time.Minute), 2 * time.Minute, false},
+		{iat.Add(3 * time.Minute), 3 * time.Minute, true},
+		{iat.Add(-time.Hour), -time.Hour, true},
+	}
+	for _, tt := range tests {
+		skew, ok := clockSkew(issuedJWT(iat), tt.obtainedAt)
+		if !ok || skew != tt.skew {
+			t.Errorf("Expected a skew of %s, got %s (%v)", tt.skew, skew, ok)
+		}
+		if warning := clockSkewWarning(skew); (warning != "") != tt.warns {
+			t.Errorf("Skew %s: unexpected warning %q", skew, warning)
+		}
+	}
+
+	if _, ok := clockSkew(testJWT(iat), iat); ok {
+		t.Error("A token without iat gives no skew")
+	}
+	if warning := clockSkewWarning(-time.Hour); !strings.Contains(warning, "about 1h0m0s behind tgcloud's") || !strings.Contains(warning, "NTP") {
+		t.Errorf("Unexpected warning %q", warning)
+	}
+	if warning := clockSkewWarning(90 * time.Minute); !strings.Contains(warning, "about 1h30m0s ahead of tgcloud's") {
+		t.Errorf("Unexpected warning %q", warning)
+	}
+}
+
+func TestExpiredTokenHint(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time { return clock }
+	defer func() { helpers.Now = oldNow }()
+
+	store := func(token string, obtainedAt time.Time) {
+		t.Helper()
+		if err := helpers.WriteLoginCredentials(constants.CredsFile, token, constants.TGCLOUD_BASE_URL, obtainedAt); err != nil {
+			t.Fatalf("Failed to write credentials: %v", err)
+		}
+	}
+
+	// Obtained a day ago with clocks in sync: plainly expired.
+	token := issuedJWT(clock.Add(-24 * time.Hour))
+	store(token, clock.Add(-24*time.Hour))
+	if hint := expiredTokenHint(token); hint != "" {
+		t.Errorf("Expected no hint, got %q", hint)
+	}
+
+	// Obtained a minute ago: the clock is the likely culprit.
+	token = testJWT(clock.Add(time.Hour))
+	store(token, clock.Add(-time.Minute))
+	if hint := expiredTokenHint(token); !strings.Contains(hint, "obtained moments ago") {
+		t.Errorf("Expected the fresh token hint, got %q", hint)
+	}
+
+	// The local clock was two hours ahead when the token was saved.
+	token = issuedJWT(clock.Add(-3 * time.Hour))
+	store(token, clock.Add(-time.Hour))
+	if hint := expiredTokenHint(token); !strings.Contains(hint, "about 2h0m0s ahead of tgcloud's") {
+		t.Errorf("Expected the skew hint, got %q", hint)
+	}
+
+	// An imported token was not obtained by a login, so when it was issued
+	// says nothing about the clock, however recently the file was written.
+	token = issuedJWT(clock.Add(-3 * time.Hour))
+	if err := helpers.WriteCredentials(constants.CredsFile, token, constants.TGCLOUD_BASE_URL); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+	if hint := expiredTokenHint(token); hint != "" {
+		t.Errorf("Expected no hint for an imported token, got %q", hint)
+	}
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	warnClockSkew(token)
+	w.Close()
+	os.Stderr = oldStderr
+	if stderr, _ := io.ReadAll(r); len(stderr) != 0 {
+		t.Errorf("Expected no skew warning for an imported token, got %q", stderr)
+	}
+}
+
+func TestInspectTokenHint(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time { return clock }
+	defer func() { helpers.Now = oldNow }()
+
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+	}))
+	defer mockServer.Close()
+	originalBaseURL := constants.TGCLOUD_BASE_URL
+	defer func() { constants.TGCLOUD_BASE_URL = originalBaseURL }()
+	constants.TGCLOUD_BASE_URL = mockServer.URL
+
+	// The stored token was obtained moments ago, which says nothing about
+	// another token being checked.
+	if err := helpers.WriteLoginCredentials(constants.CredsFile, "stored", mockServer.URL, clock.Add(-time.Minute)); err != nil {
+		t.Fatalf("Failed to write credentials: %v", err)
+	}
+	token := testJWT(clock.Add(time.Hour))
+	if status := InspectToken(token, mockServer.URL, time.Time{}); status.Status != models.TokenExpired || status.Detail != "rejected by tgcloud" {
+		t.Errorf("Expected a rejection without a hint, got %+v", status)
+	}
+	if status := InspectToken(token, mockServer.URL, clock.Add(-time.Minute)); !strings.Contains(status.Detail, "obtained moments ago") {
+		t.Errorf("Expected the fresh token hint, got %+v", status)
+	}
+
+	// The exp claim is checked against helpers.Now.
+	helpers.Now = func() time.Time { return clock.Add(2 * time.Hour) }
+	if status := InspectToken(token, mockServer.URL, time.Time{}); status.Status != models.TokenExpired || status.Detail != "" {
+		t.Errorf("Expected the exp claim to expire the token by the test clock, got %+v", status)
+	}
+}
@@ -0,0 +1,120 @@
+package cloud
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/events"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/telemetry"
+)
+
+// RunWait blocks until the instance given with --id reaches --state, and
+// fails when --timeout elapses first.
+func RunWait(cmd *cobra.Command, args []string) {
+	target, _ := cmd.Flags().GetString("state")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	interval, _ := cmd.Flags().GetDuration("interval")
+	withEvents, _ := cmd.Flags().GetBool("events")
+	emitter := events.Start(withEvents)
+	defer emitter.Finish()
+
+	target = strings.TrimSpace(target)
+	if target == "" || interval <= 0 {
+		err := fmt.Errorf("--state must not be empty and --interval must be positive")
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	id, err := machineIDFlag(cmd, emitter)
+	if err != nil {
+		return
+	}
+
+	span := telemetry.StartSpan("cloud.wait", telemetry.String("tg.machine.id", id))
+	err = waitForState(id, target, timeout, interval, emitter)
+	span.Finish(err)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
+	}
+}
+
+// waitForState polls until the solution is in target, which "running" also
+// matches as tgcloud's "ready". A terminated solution never gets there, so
+// it ends the wait at once.
+func waitForState(machineID, target string, timeout, interval time.Duration, emitter *events.Emitter) error {
+	bearerToken, err := getBearerToken()
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(emitter.Out(), "Waiting for %s to be %s...\n", machineID, target)
+	timeout = helpers.BoundWait(timeout)
+	state, done, err := pollMachineState(bearerToken, machineID, timeout, interval, emitter, func(state string) (bool, error) {
+		if stateMatches(state, target) {
+			return true, nil
+		}
+		if strings.EqualFold(state, "terminated") {
+			return false, fmt.Errorf("%s was terminated and will not become %s", machineID, target)
+		}
+		return false, nil
+	})
+	if err != nil {
+		return err
+	}
+	if !done {
+		return fmt.Errorf("timed out after %s waiting for %s to be %s (status: %s)", timeout, machineID, target, state)
+	}
+	fmt.Fprintf(emitter.Out(), "%s is %s\n", machineID, state)
+	return nil
+}
+
+func stateMatches(state, target string) bool {
+	if strings.EqualFold(state, target) {
+		return true
+	}
+	return strings.EqualFold(target, "running") && strings.EqualFold(state, "ready")
+}
+
+// pollMachineState fetches the state of the solution every interval,
+// printing and emitting each change, until done accepts it, done fails or
+// timeout elapses. It returns the last state seen and whether done
+// accepted it.
+func pollMachineState(bearerToken, machineID string, timeout, interval time.Duration, emitter *events.Emitter, done func(state string) (bool, error)) (string, bool, error) {
+	deadline := time.Now().Add(timeout)
+	lastState := ""
+	for {
+		machines, _, err := fetchMachines(bearerToken)
+		if err != nil {
+			return lastState, false, err
+		}
+
+		state := ""
+		for _, machine := range machines {
+			if machine.ID == machineID {
+				state = machine.State
+				break
+			}
+		}
+		if state == "" {
+			return lastState, false, fmt.Errorf("solution %s not found", machineID)
+		}
+		if state != lastState {
+			fmt.Fprintf(emitter.Out(), "  status: %s\n", state)
+			emitter.Emit("machine.state", map[string]interface{}{"id": machineID, "state": state})
+			lastState = state
+		}
+		if ok, err := done(state); ok || err != nil {
+			return state, ok, err
+		}
+		if time.Now().After(deadline) {
+			return state, false, nil
+		}
+		time.Sleep(interval)
+	}
+}
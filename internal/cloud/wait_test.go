@@ -0,0 +1,63 @@
+package cloud
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+// mockStateCloud reports m1 in each of states in turn, staying in the last.
+func mockStateCloud(t *testing.T, states ...string) {
+	t.Helper()
+	polls := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		state := states[min(polls, len(states)-1)]
+		polls++
+		fmt.Fprintf(w, `{"Error":false,"Result":[{"ID":"m1","Name":"one","State":%q}]}`, state)
+	}))
+	t.Cleanup(server.Close)
+	useMockCloud(t, server.URL)
+}
+
+func TestWaitForState(t *testing.T) {
+	_, cleanup := setupTestEnvironment(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		states []string
+		target string
+		err    string
+		output []string
+	}{
+		{"running matches ready", []string{"stopped", "starting", "ready"}, "running", "", []string{"status: stopped", "status: starting", "m1 is ready"}},
+		{"other case", []string{"Stopping", "Stopped"}, "stopped", "", []string{"m1 is Stopped"}},
+		{"times out", []string{"starting"}, "running", "timed out after 20ms waiting for m1 to be running (status: starting)", nil},
+		{"terminated", []string{"stopping", "terminated"}, "running", "m1 was terminated and will not become running", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			mockStateCloud(t, test.states...)
+			var err error
+			output := captureStdout(func() { err = waitForState("m1", test.target, 20*time.Millisecond, time.Millisecond, nil) })
+			if test.err == "" && err != nil || test.err != "" && (err == nil || err.Error() != test.err) {
+				t.Errorf("Expected error %q, got %v", test.err, err)
+			}
+			for _, expected := range test.output {
+				if !strings.Contains(output, expected) {
+					t.Errorf("Expected %q in output:\n%s", expected, output)
+				}
+			}
+		})
+	}
+
+	mockStateCloud(t, "ready")
+	var err error
+	captureStdout(func() { err = waitForState("missing", "running", time.Second, time.Millisecond, nil) })
+	if err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected not found error, got %v", err)
+	}
+}
@@ -0,0 +1,37 @@
+package config
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// renderCheckResults prints health check results as a table, or as a JSON
+// array when output is "json".
+func renderCheckResults(results []models.CheckResult, output string) {
+	if results == nil {
+		results = []models.CheckResult{}
+	}
+
+	if output == "json" {
+		data, _ := json.MarshalIndent(results, "", "  ")
+		fmt.Fprintln(helpers.Stdout(), string(data))
+		return
+	}
+
+	nameWidth := len("CHECK")
+	for _, result := range results {
+		if len(result.Name) > nameWidth {
+			nameWidth = len(result.Name)
+		}
+	}
+
+	fmt.Fprintf(helpers.Stdout(), "%-*s %-6s %s\n", nameWidth, "CHECK", "STATUS", "DETAIL")
+	fmt.Fprintln(helpers.Stdout(), strings.Repeat("-", nameWidth+8+len("DETAIL")))
+	for _, result := range results {
+		fmt.Fprintf(helpers.Stdout(), "%-*s %-6s %s\n", nameWidth, result.Name, result.Status, result.Detail)
+	}
+}
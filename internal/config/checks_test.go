@@ -0,0 +1,61 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func captureRender(results []models.CheckResult, output string) string {
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	renderCheckResults(results, output)
+
+	w.Close()
+	os.Stdout = oldStdout
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+func TestRenderCheckResultsJSON(t *testing.T) {
+	results := []models.CheckResult{
+		{Name: "dangling-default", Status: models.CheckWarn, Detail: "default alias \"gone\" does not exist"},
+		{Name: "unreachable-host", Status: models.CheckFail, Detail: "machines.prod is unreachable"},
+	}
+
+	var decoded []models.CheckResult
+	if err := json.Unmarshal([]byte(captureRender(results, "json")), &decoded); err != nil {
+		t.Fatalf("Invalid JSON: %v", err)
+	}
+	if len(decoded) != 2 || decoded[1] != results[1] {
+		t.Errorf("Unexpected results: %+v", decoded)
+	}
+
+	if output := strings.TrimSpace(captureRender(nil, "json")); output != "[]" {
+		t.Errorf("Expected empty array, got %s", output)
+	}
+}
+
+func TestRenderCheckResultsTable(t *testing.T) {
+	output := captureRender([]models.CheckResult{
+		{Name: "file-permissions", Status: models.CheckPass, Detail: "ok"},
+	}, "stdout")
+
+	lines := strings.Split(strings.TrimSpace(output), "\n")
+	if len(lines) != 3 {
+		t.Fatalf("Expected header, rule and one row, got:\n%s", output)
+	}
+	if !strings.HasPrefix(lines[0], "CHECK") || !strings.Contains(lines[0], "STATUS") {
+		t.Errorf("Unexpected header: %s", lines[0])
+	}
+	if !strings.HasPrefix(lines[2], "file-permissions pass   ok") {
+		t.Errorf("Unexpected row: %q", lines[2])
+	}
+}
@@ -6,14 +6,15 @@ import (
 	"encoding/json"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
+	"sort"
 	"strings"
 	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/cloud"
 	"github.com/zrougamed/tgCli/internal/helpers"
 	"github.com/zrougamed/tgCli/internal/models"
 	"github.com/zrougamed/tgCli/pkg/constants"
@@ -27,7 +28,8 @@ func RunConfAdd(cmd *cobra.Command, args []string) {
 	host, _ := cmd.Flags().GetString("host")
 	gsPort, _ := cmd.Flags().GetString("gsPort")
 	restPort, _ := cmd.Flags().GetString("restPort")
-	defaultFlag, _ := cmd.Flags().GetString("default")
+	makeDefault := helpers.FlagEnabled(cmd, "default")
+	defaultGiven := cmd.Flags().Changed("default")
 
 	reader := bufio.NewReader(os.Stdin)
 
@@ -39,14 +41,17 @@ func RunConfAdd(cmd *cobra.Command, args []string) {
 	}
 
 	if alias == "" {
-		fmt.Println("Alias is required")
+		fmt.Fprintln(helpers.Stdout(), "Alias is required")
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
-	// Check if alias already exists
+	// Check if alias already exists. Aliases are case-insensitive, so
+	// Prod would replace prod.
 	machines := viper.GetStringMap("machines")
-	if _, exists := machines[alias]; exists {
-		fmt.Printf("Alias '%s' already exists\n", alias)
+	if _, exists := machines[helpers.AliasKey(alias)]; exists {
+		fmt.Fprintf(helpers.Stdout(), "Alias '%s' already exists (aliases are case-insensitive)\n", alias)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
@@ -75,7 +80,7 @@ func RunConfAdd(cmd *cobra.Command, args []string) {
 		if err == nil && len(bytePassword) > 0 {
 			password = string(bytePassword)
 		}
-		fmt.Println() // New line after password input
+		fmt.Fprintln(helpers.Stdout()) // New line after password input
 	}
 
 	if gsPort == "14240" {
@@ -96,13 +101,10 @@ func RunConfAdd(cmd *cobra.Command, args []string) {
 		}
 	}
 
-	if defaultFlag == "n" {
+	if !makeDefault && !defaultGiven {
 		fmt.Print("Would you like to set this machine as default? (y/n) [n] ")
 		input, _ := reader.ReadString('\n')
-		input = strings.TrimSpace(input)
-		if input == "y" || input == "Y" {
-			defaultFlag = "y"
-		}
+		makeDefault, _ = helpers.ParseYesNo(input)
 	}
 
 	// Save the configuration
@@ -114,19 +116,86 @@ func RunConfAdd(cmd *cobra.Command, args []string) {
 		RestPort: restPort,
 	}
 
-	viper.Set(fmt.Sprintf("machines.%s", alias), machineConfig)
+	viper.Set(fmt.Sprintf("machines.%s", helpers.AliasKey(alias)), machineConfig)
 
-	if defaultFlag == "y" {
+	if makeDefault {
 		viper.Set("default", alias)
-		fmt.Printf("Setting up the alias %s as default: success\n", alias)
 	}
 
-	if err := helpers.SaveConfig(); err != nil {
-		fmt.Printf("Error saving config: %v\n", err)
+	if saved, err := saveConfig(cmd); err != nil || !saved {
+		if err != nil {
+			fmt.Fprintf(helpers.Stdout(), "Error saving config: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+		}
 		return
 	}
 
-	fmt.Printf("Saving alias %s: success\n", alias)
+	if makeDefault {
+		fmt.Fprintf(helpers.Stdout(), "Setting up the alias %s as default: success\n", alias)
+	}
+	fmt.Fprintf(helpers.Stdout(), "Saving alias %s: success\n", alias)
+}
+
+func RunConfUpdate(cmd *cobra.Command, args []string) {
+	alias, _ := cmd.Flags().GetString("alias")
+
+	updated, saved, err := updateAlias(cmd, alias)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if len(updated) == 0 {
+		fmt.Fprintln(helpers.Stdout(), "Nothing to update. Pass --host, --user, --password, --gsPort or --restPort")
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if !saved {
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Updating alias %s (%s): success\n", alias, strings.Join(updated, ", "))
+}
+
+// updateAlias applies the flags given on the command line to an existing
+// alias and returns the names of the fields it changed and whether the
+// config was written, which it is not with --dry-run.
+func updateAlias(cmd *cobra.Command, alias string) ([]string, bool, error) {
+	key := "machines." + helpers.AliasKey(alias)
+	if alias == "" || !viper.IsSet(key) {
+		return nil, false, fmt.Errorf("alias %q not found. Try: tg conf list", alias)
+	}
+
+	var machine models.MachineConfig
+	if err := viper.UnmarshalKey(key, &machine); err != nil {
+		return nil, false, err
+	}
+
+	var updated []string
+	for _, field := range []struct {
+		flag  string
+		value *string
+	}{
+		{"host", &machine.Host},
+		{"user", &machine.User},
+		{"password", &machine.Password},
+		{"gsPort", &machine.GSPort},
+		{"restPort", &machine.RestPort},
+	} {
+		if cmd.Flags().Changed(field.flag) {
+			*field.value, _ = cmd.Flags().GetString(field.flag)
+			updated = append(updated, field.flag)
+		}
+	}
+	if len(updated) == 0 {
+		return nil, false, nil
+	}
+
+	viper.Set(key, machine)
+	saved, err := saveConfig(cmd)
+	if err != nil {
+		return nil, false, fmt.Errorf("saving config: %v", err)
+	}
+	return updated, saved, nil
 }
 
 func RunConfDelete(cmd *cobra.Command, args []string) {
@@ -140,96 +209,209 @@ func RunConfDelete(cmd *cobra.Command, args []string) {
 	}
 
 	if alias == "" {
-		fmt.Println("Alias is required")
+		fmt.Fprintln(helpers.Stdout(), "Alias is required")
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
+	alias = helpers.AliasKey(alias)
 	machines := viper.GetStringMap("machines")
 	if _, exists := machines[alias]; !exists {
-		fmt.Println("Alias not found!")
+		fmt.Fprintln(helpers.Stdout(), "Alias not found!")
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
 	// Check if it's the default alias
 	defaultAlias := viper.GetString("default")
-	if defaultAlias == alias {
+	if helpers.AliasKey(defaultAlias) == alias {
 		reader := bufio.NewReader(os.Stdin)
 		fmt.Print("⚠️  You are about to delete the default alias, proceed? (y/n) ")
 		confirm, _ := reader.ReadString('\n')
 		confirm = strings.TrimSpace(strings.ToLower(confirm))
 
 		if confirm != "y" && confirm != "yes" {
-			fmt.Println("Aborting...")
+			fmt.Fprintln(helpers.Stdout(), "Aborting...")
+			helpers.Fail(helpers.ExitCancelled)
 			return
 		}
 
 		viper.Set("default", "")
 	}
 
-	// Delete the machine configuration
+	// Unless purged, the alias goes to the trash so it can be restored.
+	purge, _ := cmd.Flags().GetBool("purge")
+	if !purge {
+		trashAlias(alias)
+	}
 	delete(machines, alias)
 	viper.Set("machines", machines)
 
-	if err := helpers.SaveConfig(); err != nil {
-		fmt.Printf("Error saving config: %v\n", err)
+	if saved, err := saveConfig(cmd); err != nil || !saved {
+		if err != nil {
+			fmt.Fprintf(helpers.Stdout(), "Error saving config: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+		}
 		return
 	}
 
-	fmt.Println("Alias deleted!")
+	if purge {
+		fmt.Fprintln(helpers.Stdout(), "Alias deleted!")
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Alias deleted! Restore it within %d days with: tg conf restore --alias %s\n", int(helpers.TrashRetention.Hours()/24), alias)
 }
 
+// checkToken reports on the stored tgcloud token; tests replace it.
+var checkToken = cloud.CheckToken
+
+// inspectToken reports on a token before it is stored; tests replace it.
+var inspectToken = cloud.InspectToken
+
 func RunConfList(cmd *cobra.Command, args []string) {
-	fmt.Println("======= TGCloud Account ======")
+	if trashed, _ := cmd.Flags().GetBool("trashed"); trashed {
+		fmt.Fprint(helpers.Stdout(), formatTrashList(helpers.TrashedMachines()))
+		return
+	}
+	sortBy, _ := cmd.Flags().GetString("sort")
+	if sortBy == "" {
+		sortBy = "name"
+	}
+	if confListSorts[sortBy] == nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: unknown --sort %q (expected name or host)\n", sortBy)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	var token *models.TokenStatus
+	if showTokens, _ := cmd.Flags().GetBool("show-tokens"); showTokens {
+		status := checkToken()
+		token = &status
+	}
+	fmt.Fprint(helpers.Stdout(), formatConfList(loadConfig(), token, sortBy))
+}
 
-	tgcloudUser := viper.GetString("tgcloud.user")
-	tgcloudPassword := viper.GetString("tgcloud.password")
+// confListSorts are the orders tg conf list --sort accepts. Each reports
+// whether alias a comes before alias b; ties fall back to the name.
+var confListSorts = map[string]func(machines map[string]models.MachineConfig, a, b string) bool{
+	"name": func(machines map[string]models.MachineConfig, a, b string) bool {
+		return a < b
+	},
+	"host": func(machines map[string]models.MachineConfig, a, b string) bool {
+		if machines[a].Host != machines[b].Host {
+			return machines[a].Host < machines[b].Host
+		}
+		return a < b
+	},
+}
+
+// loadConfig reads the configuration viper currently holds. Default is the
+// alias in effect, which the active context may override.
+func loadConfig() models.Config {
+	var cfg models.Config
+	cfg.TGCloud.User = viper.GetString("tgcloud.user")
+	cfg.TGCloud.Password = viper.GetString("tgcloud.password")
+	cfg.Default = helpers.DefaultAlias()
+	if err := viper.UnmarshalKey("machines", &cfg.Machines); err != nil {
+		cfg.Machines = nil
+	}
+	return cfg
+}
+
+// formatConfList renders the tgcloud account and every alias, in the
+// order of sortBy, with passwords masked. The token status is included
+// when given.
+func formatConfList(cfg models.Config, token *models.TokenStatus, sortBy string) string {
+	var b strings.Builder
+	b.WriteString("======= TGCloud Account ======\n")
 
-	if tgcloudUser == "mail@domain.com" || tgcloudUser == "" {
-		fmt.Println("tgcloud user not set. Use: tg conf tgcloud")
+	if cfg.TGCloud.User == "mail@domain.com" || cfg.TGCloud.User == "" {
+		b.WriteString("tgcloud user not set. Use: tg conf tgcloud\n")
 	} else {
-		fmt.Printf("tgcloud username: %s\n", tgcloudUser)
-		fmt.Printf("tgcloud password: %s\n", maskPassword(tgcloudPassword))
+		fmt.Fprintf(&b, "tgcloud username: %s\n", cfg.TGCloud.User)
+		fmt.Fprintf(&b, "tgcloud password: %s\n", maskPassword(cfg.TGCloud.Password))
+	}
+	if token != nil {
+		fmt.Fprintf(&b, "tgcloud token: %s\n", formatTokenStatus(*token))
 	}
 
-	fmt.Println("======= TigerGraph Instances ======")
+	b.WriteString("======= TigerGraph Instances ======\n")
 
-	machines := viper.GetStringMap("machines")
-	defaultAlias := viper.GetString("default")
+	if len(cfg.Machines) == 0 {
+		b.WriteString("No conf available. Use: tg conf add\n")
+		return b.String()
+	}
 
-	if len(machines) > 0 {
-		for alias, machineData := range machines {
-			defaultTag := ""
-			if defaultAlias == alias {
-				defaultTag = " (default)"
-			}
+	aliases := helpers.SortedAliases(cfg.Machines)
+	if less := confListSorts[sortBy]; less != nil {
+		sort.SliceStable(aliases, func(i, j int) bool { return less(cfg.Machines, aliases[i], aliases[j]) })
+	}
 
-			fmt.Printf("Machine: alias = %s%s\n", alias, defaultTag)
+	for _, alias := range aliases {
+		machine := cfg.Machines[alias]
+		defaultTag := ""
+		if helpers.AliasKey(cfg.Default) == alias {
+			defaultTag = " (default)"
+		}
 
-			if machineMap, ok := machineData.(map[string]interface{}); ok {
-				if host, ok := machineMap["host"].(string); ok {
-					fmt.Printf("   host: %s\n", host)
-				}
-				if user, ok := machineMap["user"].(string); ok {
-					fmt.Printf("   user: %s\n", user)
-				}
-				if password, ok := machineMap["password"].(string); ok {
-					fmt.Printf("   password: %s\n", maskPassword(password))
-				}
-				if gsPort, ok := machineMap["gsPort"].(string); ok {
-					fmt.Printf("   GSQL Port: %s\n", gsPort)
-				}
-				if restPort, ok := machineMap["restPort"].(string); ok {
-					fmt.Printf("   REST Port: %s\n", restPort)
-				}
+		fmt.Fprintf(&b, "Machine: alias = %s%s\n", alias, defaultTag)
+		for _, field := range []struct{ label, value string }{
+			{"host", machine.Host},
+			{"user", machine.User},
+			{"password", maskPassword(machine.Password)},
+			{"GSQL Port", machine.GSPort},
+			{"REST Port", machine.RestPort},
+		} {
+			if field.value != "" {
+				fmt.Fprintf(&b, "   %s: %s\n", field.label, field.value)
 			}
-			fmt.Println()
 		}
-	} else {
-		fmt.Println("No conf available. Use: tg conf add")
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// formatTokenStatus describes a token status in one line, pointing at
+// tg cloud login when a new token is needed.
+func formatTokenStatus(token models.TokenStatus) string {
+	expiry := ""
+	if token.ExpiresAt != nil {
+		expiry = token.ExpiresAt.UTC().Format("2006-01-02 15:04 UTC")
 	}
+
+	switch token.Status {
+	case models.TokenMissing:
+		return "missing. Use: tg cloud login"
+	case models.TokenValid:
+		if expiry != "" {
+			return fmt.Sprintf("valid (expires %s)", expiry)
+		}
+		return "valid"
+	case models.TokenExpired:
+		detail := token.Detail
+		if detail == "" && expiry != "" {
+			detail = "expired " + expiry
+		}
+		if detail != "" {
+			return fmt.Sprintf("expired (%s). Use: tg cloud login", detail)
+		}
+		return "expired. Use: tg cloud login"
+	case models.TokenOtherEndpoint:
+		return fmt.Sprintf("issued for %s, not the configured endpoint. Use: tg cloud login", token.Endpoint)
+	}
+	return fmt.Sprintf("present, validity unknown (%s)", token.Detail)
 }
 
 func RunConfTGCloud(cmd *cobra.Command, args []string) {
+	if cmd.Flags().Changed("token") {
+		token, _ := cmd.Flags().GetString("token")
+		validate, _ := cmd.Flags().GetBool("validate")
+		if err := installToken(token, validate, os.Stdin); err != nil {
+			fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+		}
+		return
+	}
+
 	email, _ := cmd.Flags().GetString("email")
 	password, _ := cmd.Flags().GetString("password")
 
@@ -245,20 +427,22 @@ func RunConfTGCloud(cmd *cobra.Command, args []string) {
 		fmt.Print("What is your tgcloud password? ")
 		bytePassword, err := term.ReadPassword(int(syscall.Stdin))
 		if err != nil {
-			fmt.Printf("Error reading password: %v\n", err)
+			fmt.Fprintf(helpers.Stdout(), "Error reading password: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
 			return
 		}
 		password = string(bytePassword)
-		fmt.Println() // New line after password input
+		fmt.Fprintln(helpers.Stdout()) // New line after password input
 	}
 
 	if email == "" || password == "" {
-		fmt.Println("Email and password are required")
+		fmt.Fprintln(helpers.Stdout(), "Email and password are required")
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
 	// Test credentials
-	fmt.Println("Trying your credentials...")
+	fmt.Fprintln(helpers.Stdout(), "Trying your credentials...")
 
 	loginData := map[string]string{
 		"username": email,
@@ -267,28 +451,32 @@ func RunConfTGCloud(cmd *cobra.Command, args []string) {
 
 	jsonData, err := json.Marshal(loginData)
 	if err != nil {
-		fmt.Printf("Error marshaling login data: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error marshaling login data: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
-	client := &http.Client{Timeout: 30 * time.Second}
+	client := helpers.NewHTTPClient(30 * time.Second)
 	resp, err := client.Post(constants.TIGERTOOL_URL+"/login", "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("Error making login request: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error making login request: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 	defer resp.Body.Close()
 
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
-		fmt.Printf("Error reading response: %v\n", err)
+		fmt.Fprintf(helpers.Stdout(), "Error reading response: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 
 	if resp.StatusCode == 200 {
 		var loginResp models.TGCloudResponse
 		if err := json.Unmarshal(body, &loginResp); err != nil {
-			fmt.Printf("Error parsing response: %v\n", err)
+			fmt.Fprintf(helpers.Stdout(), "Error parsing response: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
 			return
 		}
 
@@ -298,8 +486,9 @@ func RunConfTGCloud(cmd *cobra.Command, args []string) {
 			if len(tokenParts) >= 2 {
 				bearerToken := tokenParts[1]
 
-				if err := os.WriteFile(constants.CredsFile, []byte(bearerToken), 0600); err != nil {
-					fmt.Printf("Error saving credentials: %v\n", err)
+				if err := helpers.WriteLoginCredentials(constants.CredsFile, bearerToken, constants.TGCLOUD_BASE_URL, helpers.Now()); err != nil {
+					fmt.Fprintf(helpers.Stdout(), "Error saving credentials: %v\n", err)
+					helpers.Fail(helpers.ExitFailure)
 					return
 				}
 
@@ -308,17 +497,59 @@ func RunConfTGCloud(cmd *cobra.Command, args []string) {
 				viper.Set("tgcloud.password", password)
 
 				if err := helpers.SaveConfig(); err != nil {
-					fmt.Printf("Error saving config: %v\n", err)
+					fmt.Fprintf(helpers.Stdout(), "Error saving config: %v\n", err)
+					helpers.Fail(helpers.ExitFailure)
 					return
 				}
 
-				fmt.Println("Login Successful! 😊")
-				fmt.Println("Credentials saved to configuration")
+				fmt.Fprintln(helpers.Stdout(), "Login Successful! 😊")
+				fmt.Fprintln(helpers.Stdout(), "Credentials saved to configuration")
 			}
 		}
 	} else {
-		fmt.Printf("Error logging in: %s\n", string(body))
+		fmt.Fprintf(helpers.Stdout(), "Error logging in: %s\n", string(body))
+		helpers.Fail(helpers.ExitFailure)
+	}
+}
+
+// installToken stores a tgcloud bearer token obtained elsewhere, such as
+// the web UI or a CI secret, without logging in. A token of "-" is read
+// from stdin. With validate, tgcloud is asked first and a token it does not
+// accept is not stored.
+func installToken(token string, validate bool, stdin io.Reader) error {
+	if token == "-" {
+		data, err := io.ReadAll(stdin)
+		if err != nil {
+			return fmt.Errorf("reading the token from stdin: %v", err)
+		}
+		token = string(data)
+	}
+	token = strings.TrimSpace(token)
+	// The Authorization header form is accepted as copied.
+	if fields := strings.Fields(token); len(fields) == 2 && strings.EqualFold(fields[0], "bearer") {
+		token = fields[1]
+	}
+	if token == "" {
+		return fmt.Errorf("the token is empty")
+	}
+
+	if validate {
+		status := inspectToken(token, constants.TGCLOUD_BASE_URL, time.Time{})
+		switch status.Status {
+		case models.TokenValid:
+		case models.TokenUnknown:
+			return fmt.Errorf("could not validate the token: %s; leave out --validate to store it anyway", status.Detail)
+		default:
+			return fmt.Errorf("tgcloud does not accept the token: %s", strings.TrimSuffix(formatTokenStatus(status), ". Use: tg cloud login"))
+		}
+		fmt.Fprintf(helpers.Stdout(), "tgcloud token: %s\n", formatTokenStatus(status))
+	}
+
+	if err := helpers.WriteCredentials(constants.CredsFile, token, constants.TGCLOUD_BASE_URL); err != nil {
+		return fmt.Errorf("saving the token: %v", err)
 	}
+	fmt.Fprintf(helpers.Stdout(), "Token saved to %s\n", constants.CredsFile)
+	return nil
 }
 
 func maskPassword(password string) string {
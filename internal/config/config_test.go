@@ -10,10 +10,13 @@ import (
 	"path/filepath"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
 	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/outputtest"
 	"github.com/zrougamed/tgCli/pkg/constants"
 )
 
@@ -542,3 +545,371 @@ func TestComplexConfigurationScenario(t *testing.T) {
 		}
 	}
 }
+
+func TestFormatConfListGolden(t *testing.T) {
+	outputtest.AssertGolden(t, "conf_list", []byte(formatConfList(outputtest.Config(), nil, "name")))
+	outputtest.AssertGolden(t, "conf_list_empty", []byte(formatConfList(models.Config{}, nil, "name")))
+
+	expiresAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	token := &models.TokenStatus{Status: models.TokenValid, ExpiresAt: &expiresAt}
+	outputtest.AssertGolden(t, "conf_list_tokens", []byte(formatConfList(outputtest.Config(), token, "name")))
+}
+
+func TestFormatConfListSort(t *testing.T) {
+	cfg := models.Config{Machines: map[string]models.MachineConfig{
+		"alpha": {Host: "https://zeta.example.com"},
+		"beta":  {Host: "https://eta.example.com"},
+		"gamma": {Host: "https://eta.example.com"},
+		"delta": {Host: "http://10.0.0.1"},
+	}}
+	order := func(list string) []string {
+		var aliases []string
+		for _, line := range strings.Split(list, "\n") {
+			if alias, ok := strings.CutPrefix(line, "Machine: alias = "); ok {
+				aliases = append(aliases, alias)
+			}
+		}
+		return aliases
+	}
+
+	for sortBy, expected := range map[string]string{
+		"name": "alpha beta delta gamma",
+		"host": "delta beta gamma alpha",
+	} {
+		for i := 0; i < 5; i++ {
+			if got := strings.Join(order(formatConfList(cfg, nil, sortBy)), " "); got != expected {
+				t.Fatalf("--sort %s: got %s, expected %s", sortBy, got, expected)
+			}
+		}
+	}
+}
+
+func TestFormatTokenStatus(t *testing.T) {
+	expiresAt := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		token    models.TokenStatus
+		expected string
+	}{
+		{models.TokenStatus{Status: models.TokenMissing}, "missing. Use: tg cloud login"},
+		{models.TokenStatus{Status: models.TokenValid}, "valid"},
+		{models.TokenStatus{Status: models.TokenValid, ExpiresAt: &expiresAt}, "valid (expires 2026-03-01 12:00 UTC)"},
+		{models.TokenStatus{Status: models.TokenExpired, ExpiresAt: &expiresAt}, "expired (expired 2026-03-01 12:00 UTC). Use: tg cloud login"},
+		{models.TokenStatus{Status: models.TokenExpired, Detail: "rejected by tgcloud"}, "expired (rejected by tgcloud). Use: tg cloud login"},
+		{models.TokenStatus{Status: models.TokenOtherEndpoint, Endpoint: "https://staging.tgcloud.io/api"}, "issued for https://staging.tgcloud.io/api, not the configured endpoint. Use: tg cloud login"},
+		{models.TokenStatus{Status: models.TokenUnknown, Detail: "connection refused"}, "present, validity unknown (connection refused)"},
+	}
+	for _, tt := range tests {
+		if got := formatTokenStatus(tt.token); got != tt.expected {
+			t.Errorf("formatTokenStatus(%+v) = %q, expected %q", tt.token, got, tt.expected)
+		}
+	}
+}
+
+func TestLoadConfigAfterReload(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	configFile := filepath.Join(tempDir, "test_config.yml")
+	content := "default: prod\nmachines:\n  prod:\n    host: http://prod\n    gsport: \"14240\"\n"
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	cfg := loadConfig()
+	if cfg.Machines["prod"].GSPort != "14240" || cfg.Default != "prod" {
+		t.Errorf("Unexpected config after reload: %+v", cfg)
+	}
+}
+
+func TestUpdateAlias(t *testing.T) {
+	_, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	viper.Set("machines.prod", map[string]interface{}{
+		"host":     "http://prod",
+		"user":     "admin",
+		"password": "secret",
+		"gsPort":   "14240",
+		"restPort": "9000",
+	})
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		for _, flag := range []string{"host", "user", "password", "gsPort", "restPort"} {
+			cmd.Flags().String(flag, "", "")
+		}
+		cmd.Flags().Parse(args)
+		return cmd
+	}
+
+	updated, saved, err := updateAlias(newCmd("--host", "https://prod", "--gsPort", "443"), "prod")
+	if err != nil || !saved || strings.Join(updated, ",") != "host,gsPort" {
+		t.Fatalf("updateAlias = %v, %v, %v", updated, saved, err)
+	}
+
+	var machine models.MachineConfig
+	viper.UnmarshalKey("machines.prod", &machine)
+	expected := models.MachineConfig{Host: "https://prod", User: "admin", Password: "secret", GSPort: "443", RestPort: "9000"}
+	if machine != expected {
+		t.Errorf("Expected only the given fields to change, got %+v", machine)
+	}
+
+	if updated, _, err := updateAlias(newCmd(), "prod"); err != nil || len(updated) != 0 {
+		t.Errorf("Expected nothing to update, got %v, %v", updated, err)
+	}
+	if _, _, err := updateAlias(newCmd("--host", "http://x"), "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("Expected a missing alias error, got %v", err)
+	}
+}
+
+func TestConfAddDeleteKeepComments(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	configFile := filepath.Join(tempDir, "test_config.yml")
+	content := `# Managed in my dotfiles repo.
+configVersion: 1
+default: prod # the cluster I use most
+tgcloud:
+  user: user@example.com
+  password: ""
+machines:
+  # Production, ask ops before touching it.
+  prod:
+    host: https://prod
+    user: admin
+    password: secret
+    gsPort: "14240"
+    restPort: "9000"
+  # Scratch box, safe to delete.
+  scratch:
+    host: http://scratch
+    user: tigergraph
+    password: tigergraph
+    gsPort: "14240"
+    restPort: "9000"
+`
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("alias", "staging", "")
+	cmd.Flags().String("user", "stage", "")
+	cmd.Flags().String("password", "stagepass", "")
+	cmd.Flags().String("host", "http://staging", "")
+	cmd.Flags().String("gsPort", "14241", "")
+	cmd.Flags().String("restPort", "9001", "")
+	cmd.Flags().String("default", "n", "")
+	captureStdout(func() { RunConfAdd(cmd, nil) })
+
+	data, _ := os.ReadFile(configFile)
+	for _, expected := range []string{
+		"# Managed in my dotfiles repo.\nconfigVersion: 1\ndefault: prod # the cluster I use most\n",
+		"  # Production, ask ops before touching it.\n  prod:\n",
+		"  # Scratch box, safe to delete.\n  scratch:\n",
+		"  staging:\n    host: http://staging\n",
+	} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q after adding an alias:\n%s", expected, data)
+		}
+	}
+
+	// Each command runs in a fresh process.
+	viper.Reset()
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to reread config: %v", err)
+	}
+	cmd = &cobra.Command{}
+	cmd.Flags().String("alias", "scratch", "")
+	cmd.Flags().Bool("purge", true, "")
+	captureStdout(func() { RunConfDelete(cmd, nil) })
+
+	data, _ = os.ReadFile(configFile)
+	if strings.Contains(string(data), "scratch") {
+		t.Errorf("Expected the deleted alias and its comment to be gone:\n%s", data)
+	}
+	for _, expected := range []string{"# Managed in my dotfiles repo.", "# the cluster I use most", "# Production, ask ops before touching it.\n  prod:\n", "  staging:\n"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %q after deleting an alias:\n%s", expected, data)
+		}
+	}
+}
+
+func captureStdout(fn func()) string {
+	var buf bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+	buf.ReadFrom(r)
+	return buf.String()
+}
+
+func TestConfListIsSorted(t *testing.T) {
+	_, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	for _, alias := range []string{"staging", "prod", "dev", "qa", "analytics", "zeta"} {
+		viper.Set("machines."+alias, map[string]interface{}{"host": "http://" + alias})
+	}
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("show-tokens", false, "")
+	cmd.Flags().Bool("trashed", false, "")
+
+	first := captureStdout(func() { RunConfList(cmd, nil) })
+	for i := 0; i < 5; i++ {
+		if out := captureStdout(func() { RunConfList(cmd, nil) }); out != first {
+			t.Fatalf("conf list output differs between runs:\n%s\n---\n%s", first, out)
+		}
+	}
+	last := -1
+	for _, alias := range []string{"analytics", "dev", "prod", "qa", "staging", "zeta"} {
+		index := strings.Index(first, "alias = "+alias)
+		if index < last {
+			t.Errorf("Expected aliases sorted alphabetically:\n%s", first)
+		}
+		last = index
+	}
+}
+
+func TestLookupIgnoringCaseIsStable(t *testing.T) {
+	machines := map[string]map[string]interface{}{"prod": {}, "PROD": {}, "Prod": {}}
+	keys := map[string]interface{}{"gsport": 1, "GSPORT": 2, "gsPort": 3}
+	for i := 0; i < 20; i++ {
+		if alias, _ := lookupMachineAlias(machines, "pRoD"); alias != "PROD" {
+			t.Fatalf("lookupMachineAlias = %q, expected the first sorted match", alias)
+		}
+		if key, _ := lookupKey(keys, "GsPort"); key != "GSPORT" {
+			t.Fatalf("lookupKey = %q, expected the first sorted match", key)
+		}
+	}
+}
+
+func TestAliasesAreCaseInsensitive(t *testing.T) {
+	dir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+	viper.SetConfigFile(filepath.Join(dir, "config.yml"))
+	viper.Set("machines.prod", map[string]interface{}{"host": "http://prod", "user": "tigergraph"})
+	viper.Set("default", "Prod")
+
+	newCmd := func(alias string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("alias", alias, "")
+		cmd.Flags().String("user", "admin", "")
+		cmd.Flags().String("password", "secret", "")
+		cmd.Flags().String("host", "http://other", "")
+		cmd.Flags().String("gsPort", "14241", "")
+		cmd.Flags().String("restPort", "9001", "")
+		cmd.Flags().String("default", "n", "")
+		cmd.Flags().Bool("purge", true, "")
+		return cmd
+	}
+
+	output := captureStdout(func() { RunConfAdd(newCmd("Prod"), nil) })
+	if !strings.Contains(output, "Alias 'Prod' already exists (aliases are case-insensitive)") {
+		t.Errorf("Expected Prod to be refused next to prod, got %q", output)
+	}
+	if host := viper.GetString("machines.prod.host"); host != "http://prod" {
+		t.Errorf("prod should be untouched, got host %q", host)
+	}
+
+	if !strings.Contains(formatConfList(loadConfig(), nil, "name"), "alias = prod (default)") {
+		t.Errorf("Expected the default to match regardless of case:\n%s", formatConfList(loadConfig(), nil, "name"))
+	}
+
+	cmd := newCmd("PROD")
+	cmd.Flags().Set("host", "http://prod2")
+	updated, _, err := updateAlias(cmd, "PROD")
+	var machine models.MachineConfig
+	viper.UnmarshalKey("machines.prod", &machine)
+	if err != nil || len(updated) != 1 || machine.Host != "http://prod2" {
+		t.Errorf("Expected PROD to update prod, got %v, %v, %+v", updated, err, machine)
+	}
+
+	// Deleting the default asks first, whatever the case.
+	oldStdin := os.Stdin
+	r, w, _ := os.Pipe()
+	w.Write([]byte("y\n"))
+	w.Close()
+	os.Stdin = r
+	output = captureStdout(func() { RunConfDelete(newCmd("pRoD"), nil) })
+	os.Stdin = oldStdin
+	if !strings.Contains(output, "delete the default alias") || viper.IsSet("machines.prod") || viper.GetString("default") != "" {
+		t.Errorf("Expected pRoD to delete prod and clear the default, got %q", output)
+	}
+}
+
+func TestDoctorReportsAliasCollisions(t *testing.T) {
+	doc := &configDoc{Data: map[string]interface{}{
+		"machines": map[string]interface{}{
+			"Prod": map[string]interface{}{"host": "http://a"},
+			"prod": map[string]interface{}{"host": "http://b"},
+			"dev":  map[string]interface{}{"host": "http://c"},
+		},
+	}}
+	problems := checkAliasCollisions(doc)
+	if len(problems) != 1 || problems[0].Message != "aliases Prod and prod differ only by case" || problems[0].apply != nil {
+		t.Errorf("Expected one manual problem, got %+v", problems)
+	}
+}
+
+func TestInstallToken(t *testing.T) {
+	_, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+	var inspected []string
+	originalInspect := inspectToken
+	inspectToken = func(token, endpoint string, obtainedAt time.Time) models.TokenStatus {
+		inspected = append(inspected, token)
+		switch token {
+		case "good":
+			return models.TokenStatus{Status: models.TokenValid}
+		case "revoked":
+			return models.TokenStatus{Status: models.TokenExpired, Detail: "rejected by tgcloud"}
+		}
+		return models.TokenStatus{Status: models.TokenUnknown, Detail: "connection refused"}
+	}
+	defer func() { inspectToken = originalInspect }()
+
+	stored := func() string {
+		token, endpoint, err := helpers.ReadCredentials(constants.CredsFile)
+		if err != nil {
+			return ""
+		}
+		if endpoint != constants.TGCLOUD_BASE_URL {
+			t.Errorf("Expected the configured endpoint, got %q", endpoint)
+		}
+		return token
+	}
+
+	if err := installToken("Bearer  from-ui \n", false, nil); err != nil || stored() != "from-ui" || len(inspected) != 0 {
+		t.Errorf("Expected the token stored without a probe, got %q (%v, probed %q)", stored(), err, inspected)
+	}
+	if err := installToken("-", true, strings.NewReader("good\n")); err != nil || stored() != "good" {
+		t.Errorf("Expected the validated token from stdin, got %q (%v)", stored(), err)
+	}
+	for token, expected := range map[string]string{
+		"revoked": "tgcloud does not accept the token: expired (rejected by tgcloud)",
+		"offline": "could not validate the token: connection refused",
+		"  ":      "the token is empty",
+	} {
+		err := installToken(token, true, nil)
+		if err == nil || !strings.HasPrefix(err.Error(), expected) {
+			t.Errorf("Expected %q for %q, got %v", expected, token, err)
+		}
+	}
+	if stored() != "good" {
+		t.Errorf("Expected rejected tokens not to replace the stored one, got %q", stored())
+	}
+}
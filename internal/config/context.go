@@ -0,0 +1,149 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func RunContextUse(cmd *cobra.Command, args []string) {
+	unset, _ := cmd.Flags().GetBool("unset")
+
+	name, err := useContext(args, unset)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if name == "" {
+		fmt.Fprintln(helpers.Stdout(), "Cleared the current context; top-level settings apply")
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Switched to context %q\n", name)
+}
+
+// useContext records the current context in the config and returns its
+// canonical name, empty when the current context was cleared.
+func useContext(args []string, unset bool) (string, error) {
+	var name string
+	switch {
+	case unset && len(args) > 0:
+		return "", fmt.Errorf("a context name cannot be combined with --unset")
+	case unset:
+	case len(args) == 0:
+		return "", fmt.Errorf("a context name is required (or --unset to clear it)")
+	default:
+		name = strings.ToLower(args[0])
+		if _, err := helpers.LookupContext(name); err != nil {
+			return "", err
+		}
+	}
+
+	viper.Set("currentContext", name)
+	if err := helpers.SaveConfig(); err != nil {
+		return "", fmt.Errorf("saving config: %v", err)
+	}
+	return name, nil
+}
+
+func RunContextList(cmd *cobra.Command, args []string) {
+	fmt.Fprint(helpers.Stdout(), formatContextList(helpers.Contexts(), helpers.CurrentContextName()))
+}
+
+// formatContextList renders one row per context, sorted by name, marking
+// the current one.
+func formatContextList(contexts map[string]models.Context, current string) string {
+	if len(contexts) == 0 {
+		return "No contexts defined. Add them under contexts: in the config file\n"
+	}
+
+	names := make([]string, 0, len(contexts))
+	nameWidth := len("NAME")
+	for name := range contexts {
+		names = append(names, name)
+		if len(name) > nameWidth {
+			nameWidth = len(name)
+		}
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "  %-*s %-12s %-16s %s\n", nameWidth, "NAME", "PROFILE", "DEFAULT ALIAS", "OUTPUT")
+	for _, name := range names {
+		ctx := contexts[name]
+		marker := " "
+		if strings.EqualFold(name, current) {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %-*s %-12s %-16s %s\n", marker, nameWidth, name,
+			orDash(ctx.Profile), orDash(ctx.DefaultAlias), orDash(ctx.Output))
+	}
+	return b.String()
+}
+
+func RunContextShow(cmd *cobra.Command, args []string) {
+	current := helpers.CurrentContextName()
+	name := current
+	if len(args) > 0 {
+		name = args[0]
+	}
+	if name == "" {
+		fmt.Fprintln(helpers.Stdout(), "No current context. Use: tg context use <name>")
+		return
+	}
+
+	ctx, err := helpers.LookupContext(name)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	fmt.Fprint(helpers.Stdout(), formatContext(strings.ToLower(name), ctx, strings.EqualFold(name, current)))
+}
+
+// formatContext renders the settings of one context. Unset fields are
+// reported as inherited from the top-level settings.
+func formatContext(name string, ctx models.Context, current bool) string {
+	var b strings.Builder
+	currentTag := ""
+	if current {
+		currentTag = " (current)"
+	}
+	fmt.Fprintf(&b, "Context: %s%s\n", name, currentTag)
+	for _, field := range []struct{ label, value string }{
+		{"profile", ctx.Profile},
+		{"default alias", ctx.DefaultAlias},
+		{"output", ctx.Output},
+	} {
+		value := field.value
+		if value == "" {
+			value = "(inherited)"
+		}
+		fmt.Fprintf(&b, "   %s: %s\n", field.label, value)
+	}
+	return b.String()
+}
+
+// RunContextCurrent prints only the current context name so scripts and
+// prompts can consume it. It exits non-zero when no context is selected.
+func RunContextCurrent(cmd *cobra.Command, args []string) {
+	name := helpers.CurrentContextName()
+	if name == "" {
+		fmt.Fprintln(os.Stderr, "No current context")
+		helpers.Exit(1)
+	}
+	fmt.Fprintln(helpers.Stdout(), name)
+}
+
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
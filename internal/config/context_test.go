@@ -0,0 +1,116 @@
+package config
+
+import (
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func setContexts() {
+	viper.Set("contexts", map[string]interface{}{
+		"customerA": map[string]interface{}{"profile": "work", "defaultAlias": "prod", "output": "json"},
+		"customerB": map[string]interface{}{"output": "stdout"},
+	})
+}
+
+func TestUseContext(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+	setContexts()
+
+	name, err := useContext([]string{"CustomerA"}, false)
+	if err != nil || name != "customera" {
+		t.Fatalf("useContext = %q, %v", name, err)
+	}
+
+	viper.Reset()
+	viper.SetConfigFile(filepath.Join(tempDir, "test_config.yml"))
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Saved config cannot be read back: %v", err)
+	}
+	if got := viper.GetString("currentContext"); got != "customera" {
+		t.Errorf("Expected currentContext to be saved, got %q", got)
+	}
+	if got := viper.GetString("contexts.customera.defaultAlias"); got != "prod" {
+		t.Errorf("Expected contexts to survive the save, got %v", viper.Get("contexts"))
+	}
+
+	if name, err := useContext(nil, true); err != nil || name != "" || viper.GetString("currentContext") != "" {
+		t.Errorf("Expected --unset to clear the current context, got %q, %v", name, err)
+	}
+}
+
+func TestUseContextErrors(t *testing.T) {
+	_, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+	setContexts()
+	viper.Set("currentContext", "customerb")
+
+	tests := []struct {
+		args    []string
+		unset   bool
+		errText string
+	}{
+		{nil, false, "a context name is required"},
+		{[]string{"customerA"}, true, "cannot be combined with --unset"},
+		{[]string{"gone"}, false, `context "gone" not found`},
+	}
+	for _, tt := range tests {
+		if _, err := useContext(tt.args, tt.unset); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("useContext(%v, %v): expected error containing %q, got %v", tt.args, tt.unset, tt.errText, err)
+		}
+	}
+	if got := viper.GetString("currentContext"); got != "customerb" {
+		t.Errorf("A failed use should keep the current context, got %q", got)
+	}
+}
+
+func TestFormatContextList(t *testing.T) {
+	contexts := map[string]models.Context{
+		"customera": {Profile: "work", DefaultAlias: "prod", Output: "json"},
+		"customerb": {Output: "stdout"},
+	}
+
+	got := formatContextList(contexts, "CustomerA")
+	expected := "  NAME      PROFILE      DEFAULT ALIAS    OUTPUT\n" +
+		"* customera work         prod             json\n" +
+		"  customerb -            -                stdout\n"
+	if got != expected {
+		t.Errorf("Unexpected list:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	if got := formatContextList(nil, ""); !strings.Contains(got, "No contexts defined") {
+		t.Errorf("Expected a hint when no contexts exist, got %q", got)
+	}
+}
+
+func TestFormatContext(t *testing.T) {
+	got := formatContext("customerb", models.Context{Output: "stdout"}, true)
+	expected := "Context: customerb (current)\n" +
+		"   profile: (inherited)\n" +
+		"   default alias: (inherited)\n" +
+		"   output: stdout\n"
+	if got != expected {
+		t.Errorf("Unexpected context:\n%s\nexpected:\n%s", got, expected)
+	}
+}
+
+func TestConfListUsesContextDefault(t *testing.T) {
+	_, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+	setContexts()
+	viper.Set("machines.prod", map[string]interface{}{"host": "http://prod"})
+	viper.Set("machines.dev", map[string]interface{}{"host": "http://dev"})
+	viper.Set("default", "dev")
+
+	if got := loadConfig().Default; got != "dev" {
+		t.Errorf("Without a context the top-level default applies, got %q", got)
+	}
+	viper.Set("currentContext", "customerA")
+	if got := loadConfig().Default; got != "prod" {
+		t.Errorf("Expected the context's default alias, got %q", got)
+	}
+}
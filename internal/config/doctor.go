@@ -0,0 +1,593 @@
+package config
+
+import (
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// configDoc is the raw view of the config file the doctor works on. Unlike
+// viper it preserves key casing, so legacy spellings can be detected.
+type configDoc struct {
+	Data   map[string]interface{}
+	Mode   os.FileMode
+	Format string
+}
+
+// doctorProblem is one detected issue. Problems without an apply function
+// have to be fixed by hand following Manual.
+type doctorProblem struct {
+	ID      string
+	Message string
+	Fix     string
+	Manual  string
+	apply   func(*configDoc) error
+}
+
+// doctorCheck is a named check. Status is the result status reported when
+// the check finds problems.
+type doctorCheck struct {
+	Name   string
+	Status string
+	Run    func(*configDoc) []doctorProblem
+}
+
+// doctorFixers detect problems that can be repaired automatically.
+var doctorFixers = []doctorCheck{
+	{"missing-config-version", models.CheckWarn, checkConfigVersion},
+	{"legacy-port-keys", models.CheckWarn, checkLegacyPortKeys},
+	{"int-port", models.CheckWarn, checkIntPorts},
+	{"host-trailing-slash", models.CheckWarn, checkHostTrailingSlash},
+	{"dangling-default", models.CheckWarn, checkDanglingDefault},
+	{"file-permissions", models.CheckWarn, checkFilePermissions},
+}
+
+// doctorDiagnostics detect problems that need manual intervention.
+var doctorDiagnostics = []doctorCheck{
+	{"unknown-key", models.CheckWarn, checkUnknownKeys},
+	{"alias-case-collision", models.CheckFail, checkAliasCollisions},
+	{"unreachable-host", models.CheckFail, checkUnreachableHosts},
+}
+
+var doctorDialTimeout = 2 * time.Second
+
+// probeHost checks that something is listening at address.
+var probeHost = func(address string) error {
+	conn, err := net.DialTimeout("tcp", address, doctorDialTimeout)
+	if err != nil {
+		return err
+	}
+	return conn.Close()
+}
+
+var (
+	knownTopLevelKeys = []string{"configVersion", "tgcloud", "machines", "default", "contexts", "currentContext", "trash", "gsql", "telemetry", "strict", "max_wait", "history", "requiresFeatures"}
+	knownTGCloudKeys  = []string{"user", "password", "base_url", "ref_max_age"}
+	knownMachineKeys  = []string{"host", "user", "password", "gsPort", "restPort"}
+)
+
+func RunConfDoctor(cmd *cobra.Command, args []string) {
+	fix, _ := cmd.Flags().GetBool("fix")
+	only, _ := cmd.Flags().GetStringSlice("only")
+	output := helpers.OutputFormat(cmd)
+
+	if output == "json" && fix {
+		if cmd.Flags().Changed("output") {
+			fmt.Fprintln(helpers.Stdout(), "Error: --output json cannot be combined with --fix")
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		// A context's output preference does not apply to --fix.
+		output = "stdout"
+	}
+
+	configFile := helpers.ConfigFilePath()
+	doc, err := loadConfigDoc(configFile)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error reading config: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	problems, results := diagnoseConfig(doc)
+	if output == "json" {
+		renderCheckResults(results, output)
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Config doctor: %s\n", configFile)
+	renderCheckResults(results, output)
+
+	fixable := selectProblems(problems, only)
+	if len(fixable) == 0 {
+		return
+	}
+	if !fix {
+		fmt.Fprintln(helpers.Stdout(), "Run 'tg conf doctor --fix' to apply the proposed fixes")
+		return
+	}
+
+	fixed, err := applyDoctorFixes(doc, fixable)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Config left untouched: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	before, _ := helpers.MarshalConfig(doc.Format, doc.Data)
+	after, _ := helpers.MarshalConfig(fixed.Format, fixed.Data)
+	fmt.Fprintln(helpers.Stdout(), "Changes:")
+	for _, line := range helpers.DiffLines(string(before), string(after)) {
+		if !strings.HasPrefix(line, "  ") {
+			fmt.Fprintf(helpers.Stdout(), "  %s\n", line)
+		}
+	}
+	if fixed.Mode != doc.Mode {
+		fmt.Fprintf(helpers.Stdout(), "  file mode %04o -> %04o\n", doc.Mode, fixed.Mode)
+	}
+
+	backup, err := writeConfigDoc(configFile, fixed)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error writing config: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Backup of the original config: %s\n", backup)
+
+	if err := viper.ReadInConfig(); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error reloading config: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if err := helpers.CheckFeatures(); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	helpers.LoadPasswords()
+	fmt.Fprintf(helpers.Stdout(), "Applied %d fix(es)\n", len(fixable))
+}
+
+func loadConfigDoc(configFile string) (*configDoc, error) {
+	info, err := os.Stat(configFile)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &configDoc{Mode: info.Mode().Perm(), Format: helpers.ConfigFormat(configFile)}
+	if err := helpers.UnmarshalConfig(doc.Format, data, &doc.Data); err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", strings.ToUpper(doc.Format), err)
+	}
+	if doc.Data == nil {
+		doc.Data = make(map[string]interface{})
+	}
+	return doc, nil
+}
+
+// writeConfigDoc backs up the current file and replaces it with doc,
+// returning the backup path.
+func writeConfigDoc(configFile string, doc *configDoc) (string, error) {
+	data, err := helpers.MarshalConfig(doc.Format, doc.Data)
+	if err != nil {
+		return "", err
+	}
+
+	original, err := os.ReadFile(configFile)
+	if err != nil {
+		return "", err
+	}
+	backup := fmt.Sprintf("%s.bak.%s", configFile, time.Now().Format("20060102-150405"))
+	if err := os.WriteFile(backup, original, 0600); err != nil {
+		return "", fmt.Errorf("unable to back up config: %v", err)
+	}
+
+	if err := os.WriteFile(configFile, data, doc.Mode); err != nil {
+		return backup, err
+	}
+	return backup, os.Chmod(configFile, doc.Mode)
+}
+
+// diagnoseConfig runs every check and returns the problems found along with
+// one result per problem, or a single pass result for a clean check.
+func diagnoseConfig(doc *configDoc) ([]doctorProblem, []models.CheckResult) {
+	var problems []doctorProblem
+	var results []models.CheckResult
+	for _, check := range append(append([]doctorCheck{}, doctorFixers...), doctorDiagnostics...) {
+		found := check.Run(doc)
+		if len(found) == 0 {
+			results = append(results, models.CheckResult{Name: check.Name, Status: models.CheckPass, Detail: "ok"})
+			continue
+		}
+		for _, problem := range found {
+			results = append(results, models.CheckResult{Name: check.Name, Status: check.Status, Detail: problemDetail(problem)})
+		}
+		problems = append(problems, found...)
+	}
+	return problems, results
+}
+
+func problemDetail(problem doctorProblem) string {
+	if problem.apply != nil {
+		return fmt.Sprintf("%s (fix: %s)", problem.Message, problem.Fix)
+	}
+	return fmt.Sprintf("%s (manual: %s)", problem.Message, problem.Manual)
+}
+
+// selectProblems returns the fixable problems, restricted to the given IDs
+// when any are provided.
+func selectProblems(problems []doctorProblem, only []string) []doctorProblem {
+	var selected []doctorProblem
+	for _, problem := range problems {
+		if problem.apply == nil {
+			continue
+		}
+		if len(only) > 0 && !containsString(only, problem.ID) {
+			continue
+		}
+		selected = append(selected, problem)
+	}
+	return selected
+}
+
+// applyDoctorFixes applies the fixes to a copy of doc and re-runs the fixers
+// on the result. The copy is returned only when every selected problem is
+// gone, so callers never persist a half-repaired config.
+func applyDoctorFixes(doc *configDoc, problems []doctorProblem) (*configDoc, error) {
+	fixed, err := cloneConfigDoc(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, problem := range problems {
+		if err := problem.apply(fixed); err != nil {
+			return nil, fmt.Errorf("fix %s failed: %v", problem.ID, err)
+		}
+	}
+
+	selected := make(map[string]bool)
+	for _, problem := range problems {
+		selected[problem.ID] = true
+	}
+	for _, check := range doctorFixers {
+		for _, remaining := range check.Run(fixed) {
+			if selected[remaining.ID] {
+				return nil, fmt.Errorf("fix %s did not resolve: %s", remaining.ID, remaining.Message)
+			}
+		}
+	}
+
+	if _, err := helpers.MarshalConfig(fixed.Format, fixed.Data); err != nil {
+		return nil, fmt.Errorf("fixed config cannot be serialized: %v", err)
+	}
+	return fixed, nil
+}
+
+func cloneConfigDoc(doc *configDoc) (*configDoc, error) {
+	data, err := yaml.Marshal(doc.Data)
+	if err != nil {
+		return nil, err
+	}
+	clone := &configDoc{Mode: doc.Mode, Format: doc.Format}
+	if err := yaml.Unmarshal(data, &clone.Data); err != nil {
+		return nil, err
+	}
+	if clone.Data == nil {
+		clone.Data = make(map[string]interface{})
+	}
+	return clone, nil
+}
+
+// docMachines returns the machine entries keyed by alias, plus the aliases
+// in sorted order.
+func docMachines(doc *configDoc) (map[string]map[string]interface{}, []string) {
+	machines := make(map[string]map[string]interface{})
+	raw, _ := doc.Data["machines"].(map[string]interface{})
+	for alias, entry := range raw {
+		if machine, ok := entry.(map[string]interface{}); ok {
+			machines[alias] = machine
+		}
+	}
+
+	return machines, helpers.SortedAliases(machines)
+}
+
+// lookupKey finds key in m ignoring case and returns the actual spelling.
+// When several spellings match, the first in sorted order wins.
+func lookupKey(m map[string]interface{}, key string) (string, bool) {
+	if _, ok := m[key]; ok {
+		return key, true
+	}
+	for _, existing := range sortedKeys(m) {
+		if strings.EqualFold(existing, key) {
+			return existing, true
+		}
+	}
+	return "", false
+}
+
+func docMachine(doc *configDoc, alias string) (map[string]interface{}, error) {
+	machines, _ := docMachines(doc)
+	machine, ok := machines[alias]
+	if !ok {
+		return nil, fmt.Errorf("alias %s no longer present", alias)
+	}
+	return machine, nil
+}
+
+func checkConfigVersion(doc *configDoc) []doctorProblem {
+	if _, ok := doc.Data["configVersion"]; ok {
+		return nil
+	}
+	return []doctorProblem{{
+		ID:      "missing-config-version",
+		Message: "configVersion is not set",
+		Fix:     fmt.Sprintf("set configVersion: %d", constants.CONFIG_VERSION),
+		apply: func(d *configDoc) error {
+			if existing, ok := lookupKey(d.Data, "configVersion"); ok {
+				delete(d.Data, existing)
+			}
+			d.Data["configVersion"] = constants.CONFIG_VERSION
+			return nil
+		},
+	}}
+}
+
+func checkLegacyPortKeys(doc *configDoc) []doctorProblem {
+	var problems []doctorProblem
+	machines, aliases := docMachines(doc)
+	for _, alias := range aliases {
+		for _, canonical := range []string{"gsPort", "restPort"} {
+			actual, ok := lookupKey(machines[alias], canonical)
+			if !ok || actual == canonical {
+				continue
+			}
+			alias, actual, canonical := alias, actual, canonical
+			problems = append(problems, doctorProblem{
+				ID:      "legacy-port-keys",
+				Message: fmt.Sprintf("machines.%s uses legacy key %q", alias, actual),
+				Fix:     fmt.Sprintf("rename to %q", canonical),
+				apply: func(d *configDoc) error {
+					machine, err := docMachine(d, alias)
+					if err != nil {
+						return err
+					}
+					value, ok := machine[actual]
+					if !ok {
+						return nil
+					}
+					delete(machine, actual)
+					if _, exists := machine[canonical]; !exists {
+						machine[canonical] = value
+					}
+					return nil
+				},
+			})
+		}
+	}
+	return problems
+}
+
+func checkIntPorts(doc *configDoc) []doctorProblem {
+	var problems []doctorProblem
+	machines, aliases := docMachines(doc)
+	for _, alias := range aliases {
+		for _, canonical := range []string{"gsPort", "restPort"} {
+			actual, ok := lookupKey(machines[alias], canonical)
+			if !ok {
+				continue
+			}
+			value := machines[alias][actual]
+			if _, isString := value.(string); isString || value == nil {
+				continue
+			}
+			alias, canonical := alias, canonical
+			problems = append(problems, doctorProblem{
+				ID:      "int-port",
+				Message: fmt.Sprintf("machines.%s.%s is stored as a number (%v)", alias, actual, value),
+				Fix:     fmt.Sprintf("store it as the string \"%v\"", value),
+				apply: func(d *configDoc) error {
+					machine, err := docMachine(d, alias)
+					if err != nil {
+						return err
+					}
+					key, ok := lookupKey(machine, canonical)
+					if !ok {
+						return nil
+					}
+					machine[key] = fmt.Sprintf("%v", machine[key])
+					return nil
+				},
+			})
+		}
+	}
+	return problems
+}
+
+func checkHostTrailingSlash(doc *configDoc) []doctorProblem {
+	var problems []doctorProblem
+	machines, aliases := docMachines(doc)
+	for _, alias := range aliases {
+		host, _ := machines[alias]["host"].(string)
+		if !strings.HasSuffix(host, "/") {
+			continue
+		}
+		alias, trimmed := alias, strings.TrimRight(host, "/")
+		problems = append(problems, doctorProblem{
+			ID:      "host-trailing-slash",
+			Message: fmt.Sprintf("machines.%s.host has a trailing slash (%s)", alias, host),
+			Fix:     fmt.Sprintf("use %q", trimmed),
+			apply: func(d *configDoc) error {
+				machine, err := docMachine(d, alias)
+				if err != nil {
+					return err
+				}
+				machine["host"] = trimmed
+				return nil
+			},
+		})
+	}
+	return problems
+}
+
+func checkDanglingDefault(doc *configDoc) []doctorProblem {
+	defaultAlias, _ := doc.Data["default"].(string)
+	if defaultAlias == "" {
+		return nil
+	}
+	machines, _ := docMachines(doc)
+	if _, ok := lookupMachineAlias(machines, defaultAlias); ok {
+		return nil
+	}
+	return []doctorProblem{{
+		ID:      "dangling-default",
+		Message: fmt.Sprintf("default alias %q does not exist", defaultAlias),
+		Fix:     "clear the default alias",
+		apply: func(d *configDoc) error {
+			d.Data["default"] = ""
+			return nil
+		},
+	}}
+}
+
+func lookupMachineAlias(machines map[string]map[string]interface{}, alias string) (string, bool) {
+	for _, existing := range helpers.SortedAliases(machines) {
+		if strings.EqualFold(existing, alias) {
+			return existing, true
+		}
+	}
+	return "", false
+}
+
+func checkFilePermissions(doc *configDoc) []doctorProblem {
+	if runtime.GOOS == "windows" || doc.Mode&0077 == 0 {
+		return nil
+	}
+	return []doctorProblem{{
+		ID:      "file-permissions",
+		Message: fmt.Sprintf("config file is readable by other users (mode %04o)", doc.Mode),
+		Fix:     "restrict the file to mode 0600",
+		apply: func(d *configDoc) error {
+			d.Mode = 0600
+			return nil
+		},
+	}}
+}
+
+func checkUnknownKeys(doc *configDoc) []doctorProblem {
+	var problems []doctorProblem
+	unknown := func(path string) doctorProblem {
+		return doctorProblem{
+			ID:      "unknown-key",
+			Message: fmt.Sprintf("unknown key %s", path),
+			Manual:  "remove or rename the key in " + helpers.ConfigFilePath(),
+		}
+	}
+
+	for _, key := range sortedKeys(doc.Data) {
+		if !containsFold(knownTopLevelKeys, key) {
+			problems = append(problems, unknown(key))
+		}
+	}
+	if tgcloud, ok := doc.Data["tgcloud"].(map[string]interface{}); ok {
+		for _, key := range sortedKeys(tgcloud) {
+			if !containsFold(knownTGCloudKeys, key) {
+				problems = append(problems, unknown("tgcloud."+key))
+			}
+		}
+	}
+	machines, aliases := docMachines(doc)
+	for _, alias := range aliases {
+		for _, key := range sortedKeys(machines[alias]) {
+			if !containsFold(knownMachineKeys, key) {
+				problems = append(problems, unknown(fmt.Sprintf("machines.%s.%s", alias, key)))
+			}
+		}
+	}
+	return problems
+}
+
+// checkAliasCollisions finds aliases that differ only by case, which
+// viper merges into one entry.
+func checkAliasCollisions(doc *configDoc) []doctorProblem {
+	var problems []doctorProblem
+	_, aliases := docMachines(doc)
+	for _, group := range helpers.AliasCollisions(aliases) {
+		problems = append(problems, doctorProblem{
+			ID:      "alias-case-collision",
+			Message: fmt.Sprintf("aliases %s differ only by case", helpers.DescribeAliasCollisions([][]string{group})),
+			Manual:  "aliases are case-insensitive; rename or remove all but one of them in " + helpers.ConfigFilePath(),
+		})
+	}
+	return problems
+}
+
+func checkUnreachableHosts(doc *configDoc) []doctorProblem {
+	var problems []doctorProblem
+	machines, aliases := docMachines(doc)
+	for _, alias := range aliases {
+		host, _ := machines[alias]["host"].(string)
+		if host == "" {
+			continue
+		}
+		port := "14240"
+		if key, ok := lookupKey(machines[alias], "gsPort"); ok {
+			port = fmt.Sprintf("%v", machines[alias][key])
+		}
+
+		hostname := host
+		if parsed, err := url.Parse(host); err == nil && parsed.Hostname() != "" {
+			hostname = parsed.Hostname()
+		}
+		address := net.JoinHostPort(hostname, port)
+		if err := probeHost(address); err != nil {
+			problems = append(problems, doctorProblem{
+				ID:      "unreachable-host",
+				Message: fmt.Sprintf("machines.%s is unreachable at %s: %v", alias, address, err),
+				Manual:  "check that the server is running and the host/gsPort are correct, then update the alias",
+			})
+		}
+	}
+	return problems
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+func containsString(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
+
+func containsFold(values []string, value string) bool {
+	for _, v := range values {
+		if strings.EqualFold(v, value) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,396 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+	"gopkg.in/yaml.v3"
+)
+
+func parseDoc(t *testing.T, content string) *configDoc {
+	t.Helper()
+	doc := &configDoc{Mode: 0600}
+	if err := yaml.Unmarshal([]byte(content), &doc.Data); err != nil {
+		t.Fatalf("Invalid test YAML: %v", err)
+	}
+	if doc.Data == nil {
+		doc.Data = make(map[string]interface{})
+	}
+	return doc
+}
+
+func applyAll(t *testing.T, doc *configDoc, problems []doctorProblem) *configDoc {
+	t.Helper()
+	fixed, err := applyDoctorFixes(doc, problems)
+	if err != nil {
+		t.Fatalf("applyDoctorFixes failed: %v", err)
+	}
+	return fixed
+}
+
+func machineOf(doc *configDoc, alias string) map[string]interface{} {
+	machines, _ := docMachines(doc)
+	return machines[alias]
+}
+
+func TestCheckConfigVersion(t *testing.T) {
+	doc := parseDoc(t, "default: \"\"\n")
+	problems := checkConfigVersion(doc)
+	if len(problems) != 1 || problems[0].ID != "missing-config-version" {
+		t.Fatalf("Expected missing-config-version, got %+v", problems)
+	}
+
+	fixed := applyAll(t, doc, problems)
+	if fixed.Data["configVersion"] != 1 {
+		t.Errorf("Expected configVersion 1, got %v", fixed.Data["configVersion"])
+	}
+	if len(checkConfigVersion(parseDoc(t, "configVersion: 1\n"))) != 0 {
+		t.Error("configVersion present should not be reported")
+	}
+}
+
+func TestCheckLegacyPortKeys(t *testing.T) {
+	doc := parseDoc(t, "machines:\n  prod:\n    host: http://prod\n    gsport: \"14240\"\n    restport: \"9000\"\n")
+	problems := checkLegacyPortKeys(doc)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 legacy key problems, got %d", len(problems))
+	}
+
+	machine := machineOf(applyAll(t, doc, problems), "prod")
+	if machine["gsPort"] != "14240" || machine["restPort"] != "9000" {
+		t.Errorf("Ports were not renamed: %v", machine)
+	}
+	if _, ok := machine["gsport"]; ok {
+		t.Error("Legacy key should be removed")
+	}
+}
+
+func TestCheckIntPorts(t *testing.T) {
+	doc := parseDoc(t, "machines:\n  prod:\n    gsPort: 14240\n    restPort: \"9000\"\n")
+	problems := checkIntPorts(doc)
+	if len(problems) != 1 || problems[0].ID != "int-port" {
+		t.Fatalf("Expected one int-port problem, got %+v", problems)
+	}
+
+	machine := machineOf(applyAll(t, doc, problems), "prod")
+	if machine["gsPort"] != "14240" {
+		t.Errorf("Expected string port, got %#v", machine["gsPort"])
+	}
+}
+
+func TestCheckIntPortsWithLegacyKey(t *testing.T) {
+	doc := parseDoc(t, "machines:\n  prod:\n    gsport: 14240\n")
+	problems := append(checkLegacyPortKeys(doc), checkIntPorts(doc)...)
+
+	machine := machineOf(applyAll(t, doc, problems), "prod")
+	if machine["gsPort"] != "14240" {
+		t.Errorf("Expected renamed string port, got %v", machine)
+	}
+}
+
+func TestCheckHostTrailingSlash(t *testing.T) {
+	doc := parseDoc(t, "machines:\n  prod:\n    host: https://prod.example.com//\n")
+	problems := checkHostTrailingSlash(doc)
+	if len(problems) != 1 {
+		t.Fatalf("Expected one problem, got %d", len(problems))
+	}
+
+	machine := machineOf(applyAll(t, doc, problems), "prod")
+	if machine["host"] != "https://prod.example.com" {
+		t.Errorf("Expected trimmed host, got %v", machine["host"])
+	}
+}
+
+func TestCheckDanglingDefault(t *testing.T) {
+	doc := parseDoc(t, "default: gone\nmachines:\n  prod:\n    host: http://prod\n")
+	problems := checkDanglingDefault(doc)
+	if len(problems) != 1 {
+		t.Fatalf("Expected one problem, got %d", len(problems))
+	}
+
+	fixed := applyAll(t, doc, problems)
+	if fixed.Data["default"] != "" {
+		t.Errorf("Expected default to be cleared, got %v", fixed.Data["default"])
+	}
+
+	if len(checkDanglingDefault(parseDoc(t, "default: Prod\nmachines:\n  prod: {host: x}\n"))) != 0 {
+		t.Error("Default alias matching case-insensitively should not be reported")
+	}
+}
+
+func TestCheckFilePermissions(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("file modes are not enforced on windows")
+	}
+	doc := parseDoc(t, "default: \"\"\n")
+	doc.Mode = 0644
+
+	problems := checkFilePermissions(doc)
+	if len(problems) != 1 {
+		t.Fatalf("Expected one problem, got %d", len(problems))
+	}
+	if fixed := applyAll(t, doc, problems); fixed.Mode != 0600 {
+		t.Errorf("Expected mode 0600, got %04o", fixed.Mode)
+	}
+}
+
+func TestCheckUnknownKeys(t *testing.T) {
+	doc := parseDoc(t, "configVersion: 1\nfoo: bar\ntgcloud:\n  user: x\n  token: y\nmachines:\n  prod:\n    host: h\n    gsport: \"1\"\n    colour: blue\n")
+	problems := checkUnknownKeys(doc)
+
+	var messages []string
+	for _, problem := range problems {
+		if problem.apply != nil {
+			t.Error("Unknown keys must not be fixed automatically")
+		}
+		messages = append(messages, problem.Message)
+	}
+	joined := strings.Join(messages, "\n")
+	for _, expected := range []string{"foo", "tgcloud.token", "machines.prod.colour"} {
+		if !strings.Contains(joined, expected) {
+			t.Errorf("Expected unknown key %s to be reported, got:\n%s", expected, joined)
+		}
+	}
+	if strings.Contains(joined, "gsport") {
+		t.Error("Legacy port keys are not unknown keys")
+	}
+}
+
+func TestCheckUnreachableHosts(t *testing.T) {
+	original := probeHost
+	defer func() { probeHost = original }()
+
+	var probed []string
+	probeHost = func(address string) error {
+		probed = append(probed, address)
+		if strings.HasPrefix(address, "down") {
+			return errors.New("connection refused")
+		}
+		return nil
+	}
+
+	doc := parseDoc(t, "machines:\n  a:\n    host: https://down.example.com\n    gsPort: \"14240\"\n  b:\n    host: http://up.example.com\n")
+	problems := checkUnreachableHosts(doc)
+	if len(problems) != 1 || !strings.Contains(problems[0].Message, "down.example.com:14240") {
+		t.Errorf("Expected the down host to be reported, got %+v", problems)
+	}
+	if problems[0].apply != nil || problems[0].Manual == "" {
+		t.Error("Unreachable hosts need manual instructions")
+	}
+	if strings.Join(probed, ",") != "down.example.com:14240,up.example.com:14240" {
+		t.Errorf("Unexpected probe order: %v", probed)
+	}
+}
+
+func TestApplyDoctorFixesRejectsFailingFix(t *testing.T) {
+	doc := parseDoc(t, "default: gone\n")
+	problems := []doctorProblem{
+		checkDanglingDefault(doc)[0],
+		{ID: "broken", apply: func(*configDoc) error { return errors.New("boom") }},
+	}
+
+	if _, err := applyDoctorFixes(doc, problems); err == nil || !strings.Contains(err.Error(), "broken") {
+		t.Errorf("Expected failing fix to abort, got %v", err)
+	}
+	if doc.Data["default"] != "gone" {
+		t.Error("The original document must not be modified")
+	}
+}
+
+func TestApplyDoctorFixesRejectsIneffectiveFix(t *testing.T) {
+	doc := parseDoc(t, "default: gone\n")
+	problems := []doctorProblem{{ID: "dangling-default", apply: func(*configDoc) error { return nil }}}
+
+	if _, err := applyDoctorFixes(doc, problems); err == nil || !strings.Contains(err.Error(), "did not resolve") {
+		t.Errorf("Expected unresolved fix to abort, got %v", err)
+	}
+}
+
+func newDoctorCmd(fix bool) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("fix", fix, "")
+	cmd.Flags().StringSlice("only", nil, "")
+	cmd.Flags().StringP("output", "o", "stdout", "")
+	return cmd
+}
+
+func runDoctorCapture(cmd *cobra.Command) string {
+	var output bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	RunConfDoctor(cmd, []string{})
+
+	w.Close()
+	os.Stdout = oldStdout
+	output.ReadFrom(r)
+	return output.String()
+}
+
+func TestRunConfDoctorFix(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	original := probeHost
+	defer func() { probeHost = original }()
+	probeHost = func(string) error { return nil }
+
+	configFile := filepath.Join(tempDir, "test_config.yml")
+	content := "default: gone\nmachines:\n  prod:\n    host: http://prod/\n    gsport: 14240\n"
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	viper.ReadInConfig()
+
+	// Without --fix the file is only diagnosed.
+	outputStr := runDoctorCapture(newDoctorCmd(false))
+	if !strings.Contains(outputStr, "dangling-default") || !strings.Contains(outputStr, "--fix") {
+		t.Errorf("Expected diagnosis output, got:\n%s", outputStr)
+	}
+	if data, _ := os.ReadFile(configFile); string(data) != content {
+		t.Error("Config must be untouched without --fix")
+	}
+
+	outputStr = runDoctorCapture(newDoctorCmd(true))
+	if !strings.Contains(outputStr, "Backup of the original config") {
+		t.Errorf("Expected backup notice, got:\n%s", outputStr)
+	}
+
+	doc, err := loadConfigDoc(configFile)
+	if err != nil {
+		t.Fatalf("Failed to load fixed config: %v", err)
+	}
+	for _, check := range doctorFixers {
+		if remaining := check.Run(doc); len(remaining) > 0 {
+			t.Errorf("Problems remain after --fix: %+v", remaining)
+		}
+	}
+
+	backups, _ := filepath.Glob(configFile + ".bak.*")
+	if len(backups) != 1 {
+		t.Fatalf("Expected one backup, got %v", backups)
+	}
+	if data, _ := os.ReadFile(backups[0]); string(data) != content {
+		t.Error("Backup should contain the original config")
+	}
+}
+
+func TestLoadConfigDocFormats(t *testing.T) {
+	original := probeHost
+	defer func() { probeHost = original }()
+	probeHost = func(string) error { return nil }
+
+	dir := t.TempDir()
+	files := map[string]string{
+		"config.json": `{"default": "gone", "machines": {"prod": {"host": "http://prod/", "gsPort": 14240}}}`,
+		"config.toml": "default = 'gone'\n[machines.prod]\nhost = 'http://prod/'\ngsPort = 14240\n",
+	}
+
+	for name, content := range files {
+		configFile := filepath.Join(dir, name)
+		if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+
+		doc, err := loadConfigDoc(configFile)
+		if err != nil {
+			t.Fatalf("%s: loadConfigDoc failed: %v", name, err)
+		}
+		if len(checkIntPorts(doc)) != 1 || len(checkDanglingDefault(doc)) != 1 {
+			t.Errorf("%s: expected int-port and dangling-default problems", name)
+		}
+
+		problems, _ := diagnoseConfig(doc)
+		fixed := applyAll(t, doc, selectProblems(problems, nil))
+		if _, err := writeConfigDoc(configFile, fixed); err != nil {
+			t.Fatalf("%s: writeConfigDoc failed: %v", name, err)
+		}
+
+		reloaded, err := loadConfigDoc(configFile)
+		if err != nil {
+			t.Fatalf("%s: fixed config cannot be loaded: %v", name, err)
+		}
+		if machineOf(reloaded, "prod")["gsPort"] != "14240" {
+			t.Errorf("%s: expected the port fix to be written in the same format, got %v", name, reloaded.Data)
+		}
+	}
+}
+
+func TestDiagnoseConfigResults(t *testing.T) {
+	original := probeHost
+	defer func() { probeHost = original }()
+	probeHost = func(string) error { return errors.New("connection refused") }
+
+	doc := parseDoc(t, "configVersion: 1\ndefault: gone\nmachines:\n  prod:\n    host: http://prod\n")
+	problems, results := diagnoseConfig(doc)
+	if len(problems) != 2 {
+		t.Fatalf("Expected 2 problems, got %+v", problems)
+	}
+
+	statuses := make(map[string]string)
+	for _, result := range results {
+		statuses[result.Name] = result.Status
+	}
+	expected := map[string]string{
+		"missing-config-version": models.CheckPass,
+		"dangling-default":       models.CheckWarn,
+		"unreachable-host":       models.CheckFail,
+	}
+	for name, status := range expected {
+		if statuses[name] != status {
+			t.Errorf("Expected %s to be %s, got %q", name, status, statuses[name])
+		}
+	}
+	if len(results) != len(doctorFixers)+len(doctorDiagnostics) {
+		t.Errorf("Expected one result per check, got %d", len(results))
+	}
+}
+
+func TestRunConfDoctorJSON(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	original := probeHost
+	defer func() { probeHost = original }()
+	probeHost = func(string) error { return nil }
+
+	configFile := filepath.Join(tempDir, "test_config.yml")
+	if err := os.WriteFile(configFile, []byte("configVersion: 1\ndefault: gone\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	viper.ReadInConfig()
+
+	cmd := newDoctorCmd(false)
+	cmd.Flags().Set("output", "json")
+	outputStr := runDoctorCapture(cmd)
+
+	var results []models.CheckResult
+	if err := json.Unmarshal([]byte(outputStr), &results); err != nil {
+		t.Fatalf("Expected JSON output, got %v:\n%s", err, outputStr)
+	}
+	found := false
+	for _, result := range results {
+		if result.Name == "dangling-default" {
+			found = result.Status == models.CheckWarn && strings.Contains(result.Detail, "gone")
+		}
+	}
+	if !found {
+		t.Errorf("Expected a dangling-default warning, got %+v", results)
+	}
+
+	cmd = newDoctorCmd(true)
+	cmd.Flags().Set("output", "json")
+	if outputStr := runDoctorCapture(cmd); !strings.Contains(outputStr, "cannot be combined") {
+		t.Errorf("Expected --fix with JSON to be rejected, got:\n%s", outputStr)
+	}
+}
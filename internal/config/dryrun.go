@@ -0,0 +1,80 @@
+package config
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// dryRunContext is how many unchanged lines are shown around a change.
+const dryRunContext = 2
+
+// passwordLine matches a password entry in YAML, JSON or TOML, capturing
+// the key and the value.
+var passwordLine = regexp.MustCompile(`^(\s*"?password"?\s*[:=]\s*)(.*?)(,?)$`)
+
+// saveConfig writes the config, or with --dry-run prints what writing it
+// would change in the config file instead. It reports whether the config
+// was written.
+func saveConfig(cmd *cobra.Command) (bool, error) {
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); !dryRun {
+		return true, helpers.SaveConfig()
+	}
+	before, after, err := helpers.PendingConfig()
+	if err != nil {
+		return false, err
+	}
+	fmt.Fprint(helpers.Stdout(), formatConfigDiff(helpers.ConfigFilePath(), string(before), string(after)))
+	return false, nil
+}
+
+// formatConfigDiff renders the changes between two versions of the config
+// file, with a little context around each and passwords masked.
+func formatConfigDiff(configFile, before, after string) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Dry run: changes to %s (nothing saved)\n", configFile)
+	if before == after {
+		b.WriteString("  no changes\n")
+		return b.String()
+	}
+
+	diff := helpers.DiffLines(before, after)
+	shown := make([]bool, len(diff))
+	for i, line := range diff {
+		if strings.HasPrefix(line, "  ") {
+			continue
+		}
+		for j := i - dryRunContext; j <= i+dryRunContext; j++ {
+			if j >= 0 && j < len(diff) {
+				shown[j] = true
+			}
+		}
+	}
+	for i, line := range diff {
+		if !shown[i] {
+			if i == 0 || shown[i-1] {
+				b.WriteString("  ...\n")
+			}
+			continue
+		}
+		fmt.Fprintf(&b, "  %s\n", maskPasswordLine(line))
+	}
+	return b.String()
+}
+
+// maskPasswordLine masks the value of a diff line holding a password.
+func maskPasswordLine(line string) string {
+	prefix, content := line[:2], line[2:]
+	match := passwordLine.FindStringSubmatch(content)
+	if match == nil {
+		return line
+	}
+	value, quote := match[2], ""
+	if len(value) >= 2 && (value[0] == '"' || value[0] == '\'') && value[len(value)-1] == value[0] {
+		value, quote = value[1:len(value)-1], value[:1]
+	}
+	return prefix + match[1] + quote + maskPassword(value) + quote + match[3]
+}
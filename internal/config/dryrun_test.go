@@ -0,0 +1,103 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestConfDryRun(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	configFile := filepath.Join(tempDir, "test_config.yml")
+	content := `configVersion: 1
+default: prod
+machines:
+  prod:
+    host: https://prod
+    user: admin
+    password: secret
+    gsPort: "14240"
+    restPort: "9000"
+`
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	rereadConfig(t, configFile)
+
+	add := &cobra.Command{}
+	for flag, value := range map[string]string{"alias": "staging", "user": "stage", "password": "stagepass", "host": "http://staging", "gsPort": "14241", "restPort": "9001", "default": "n"} {
+		add.Flags().String(flag, value, "")
+	}
+	add.Flags().Bool("dry-run", true, "")
+	out := captureStdout(func() { RunConfAdd(add, nil) })
+	for _, expected := range []string{"Dry run: changes to " + configFile, "+   staging:\n", "+     host: http://staging\n", "+     password: s*******s\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in the add preview:\n%s", expected, out)
+		}
+	}
+	if strings.Contains(out, "stagepass") || strings.Contains(out, "success") {
+		t.Errorf("Expected a masked password and no success message:\n%s", out)
+	}
+
+	rereadConfig(t, configFile)
+	update := &cobra.Command{}
+	update.Flags().String("alias", "prod", "")
+	update.Flags().String("password", "", "")
+	update.Flags().Bool("dry-run", true, "")
+	update.Flags().Parse([]string{"--password", "hunter22"})
+	out = captureStdout(func() { RunConfUpdate(update, nil) })
+	if !strings.Contains(out, "-     password: s****t\n  +     password: h******2\n") {
+		t.Errorf("Expected the masked password change in the update preview:\n%s", out)
+	}
+
+	rereadConfig(t, configFile)
+	del := &cobra.Command{}
+	del.Flags().String("alias", "prod", "")
+	del.Flags().Bool("purge", true, "")
+	del.Flags().Bool("dry-run", true, "")
+	confirmDelete := os.Stdin
+	r, w, _ := os.Pipe()
+	w.WriteString("y\n")
+	w.Close()
+	os.Stdin = r
+	out = captureStdout(func() { RunConfDelete(del, nil) })
+	os.Stdin = confirmDelete
+	for _, expected := range []string{"- default: prod\n", "+ default: \"\"\n", "-   prod:\n"} {
+		if !strings.Contains(out, expected) {
+			t.Errorf("Expected %q in the delete preview:\n%s", expected, out)
+		}
+	}
+
+	if data, _ := os.ReadFile(configFile); string(data) != content {
+		t.Errorf("Expected --dry-run to leave the config untouched, got:\n%s", data)
+	}
+}
+
+func TestFormatConfigDiff(t *testing.T) {
+	before := "a: 1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng: 7\n"
+	after := "a: 1\nb: 2\nc: 3\nd: 4\ne: 5\nf: 6\ng: 8\n"
+	expected := "Dry run: changes to config.yml (nothing saved)\n  ...\n    e: 5\n    f: 6\n  - g: 7\n  + g: 8\n"
+	if got := formatConfigDiff("config.yml", before, after); got != expected {
+		t.Errorf("formatConfigDiff =\n%s\nexpected\n%s", got, expected)
+	}
+	if got := formatConfigDiff("config.yml", before, before); !strings.HasSuffix(got, "  no changes\n") {
+		t.Errorf("Expected no changes, got %q", got)
+	}
+
+	for line, expected := range map[string]string{
+		`-     password: secret`:    `-     password: s****t`,
+		`+   "password": "secret",`: `+   "password": "s****t",`,
+		`+ password = 'abc'`:        `+ password = '***'`,
+		`  user: admin`:             `  user: admin`,
+		`-     password: ""`:        `-     password: ""`,
+	} {
+		if got := maskPasswordLine(line); got != expected {
+			t.Errorf("maskPasswordLine(%q) = %q, expected %q", line, got, expected)
+		}
+	}
+}
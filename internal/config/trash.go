@@ -0,0 +1,77 @@
+package config
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// trashAlias copies alias into the trash section, stamped with the
+// deletion time. A previously trashed alias of the same name is replaced.
+func trashAlias(alias string) {
+	var machine models.MachineConfig
+	viper.UnmarshalKey("machines."+alias, &machine)
+
+	trash := helpers.TrashedMachines()
+	trash[alias] = models.TrashedMachine{
+		MachineConfig: machine,
+		DeletedAt:     helpers.Now().UTC().Format(time.RFC3339),
+	}
+	viper.Set("trash", trash)
+}
+
+// restoreAlias moves alias from the trash back to the live aliases. It
+// refuses when a live alias with that name has been added since.
+func restoreAlias(alias string) error {
+	trash := helpers.TrashedMachines()
+	entry, ok := trash[alias]
+	if !ok {
+		return fmt.Errorf("alias %s is not in the trash. See: tg conf list --trashed", alias)
+	}
+	if _, exists := viper.GetStringMap("machines")[alias]; exists {
+		return fmt.Errorf("an alias named %s exists again; delete or rename it first", alias)
+	}
+
+	delete(trash, alias)
+	viper.Set("trash", trash)
+	viper.Set("machines."+alias, entry.MachineConfig)
+	return helpers.SaveConfig()
+}
+
+func RunConfRestore(cmd *cobra.Command, args []string) {
+	alias, _ := cmd.Flags().GetString("alias")
+	if err := restoreAlias(helpers.AliasKey(alias)); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	fmt.Fprintf(helpers.Stdout(), "Alias %s restored\n", alias)
+}
+
+// formatTrashList renders the trashed aliases, sorted by name, with when
+// they were deleted and when they will be purged.
+func formatTrashList(trash map[string]models.TrashedMachine) string {
+	if len(trash) == 0 {
+		return "Trash is empty\n"
+	}
+
+	var b strings.Builder
+	b.WriteString("======= Trashed Aliases ======\n")
+	for _, alias := range helpers.SortedAliases(trash) {
+		entry := trash[alias]
+		purge := "never (unreadable deletion time)"
+		if purgeAt, ok := helpers.TrashPurgeTime(entry); ok {
+			purge = purgeAt.UTC().Format("2006-01-02 15:04 UTC")
+		}
+		fmt.Fprintf(&b, "Machine: alias = %s\n", alias)
+		fmt.Fprintf(&b, "   host: %s\n", entry.Host)
+		fmt.Fprintf(&b, "   deleted: %s\n", entry.DeletedAt)
+		fmt.Fprintf(&b, "   purged after: %s\n", purge)
+	}
+	return b.String()
+}
@@ -0,0 +1,169 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// rereadConfig simulates the next command starting a fresh process.
+func rereadConfig(t *testing.T, configFile string) {
+	t.Helper()
+	viper.Reset()
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to reread config: %v", err)
+	}
+}
+
+func TestTrashLifecycle(t *testing.T) {
+	tempDir, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+	configFile := filepath.Join(tempDir, "test_config.yml")
+
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time { return clock }
+	defer func() { helpers.Now = oldNow }()
+
+	content := `configVersion: 1
+default: prod
+machines:
+  prod:
+    host: https://prod
+    user: admin
+    password: secret
+    gsPort: "14240"
+    restPort: "9000"
+  scratch:
+    host: http://scratch
+    user: tigergraph
+    password: tigergraph
+    gsPort: "14240"
+    restPort: "9000"
+`
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	rereadConfig(t, configFile)
+
+	// Delete moves the alias to the trash.
+	cmd := &cobra.Command{}
+	cmd.Flags().String("alias", "scratch", "")
+	out := captureStdout(func() { RunConfDelete(cmd, nil) })
+	if !strings.Contains(out, "tg conf restore --alias scratch") {
+		t.Errorf("Expected a restore hint, got %q", out)
+	}
+
+	rereadConfig(t, configFile)
+	if _, ok := viper.GetStringMap("machines")["scratch"]; ok {
+		t.Error("Trashed alias should not be a live alias")
+	}
+	trash := helpers.TrashedMachines()
+	if trash["scratch"].Host != "http://scratch" || trash["scratch"].DeletedAt != "2026-03-01T12:00:00Z" {
+		t.Errorf("Unexpected trash entry: %+v", trash["scratch"])
+	}
+
+	list := &cobra.Command{}
+	list.Flags().Bool("trashed", true, "")
+	out = captureStdout(func() { RunConfList(list, nil) })
+	if !strings.Contains(out, "alias = scratch") || !strings.Contains(out, "purged after: 2026-03-31 12:00 UTC") {
+		t.Errorf("Expected the trashed alias in the listing, got:\n%s", out)
+	}
+	if strings.Contains(out, "alias = prod") {
+		t.Errorf("Live aliases should not be listed with --trashed:\n%s", out)
+	}
+
+	// Restore is refused while a live alias has the name.
+	viper.Set("machines.scratch", models.MachineConfig{Host: "http://other"})
+	if err := restoreAlias("scratch"); err == nil || !strings.Contains(err.Error(), "exists again") {
+		t.Errorf("Expected restore to be refused, got %v", err)
+	}
+
+	// Once it is gone, restore brings the original back.
+	rereadConfig(t, configFile)
+	clock = clock.Add(10 * 24 * time.Hour)
+	if err := restoreAlias("scratch"); err != nil {
+		t.Fatalf("restoreAlias failed: %v", err)
+	}
+	rereadConfig(t, configFile)
+	if host := viper.GetString("machines.scratch.host"); host != "http://scratch" {
+		t.Errorf("Expected the restored alias, got host %q", host)
+	}
+	if _, ok := helpers.TrashedMachines()["scratch"]; ok {
+		t.Error("Restored alias should have left the trash")
+	}
+	if err := restoreAlias("scratch"); err == nil {
+		t.Error("Restoring twice should fail")
+	}
+
+	// A trashed alias is purged by the first save after 30 days.
+	cmd = &cobra.Command{}
+	cmd.Flags().String("alias", "scratch", "")
+	captureStdout(func() { RunConfDelete(cmd, nil) })
+	rereadConfig(t, configFile)
+
+	clock = clock.Add(29 * 24 * time.Hour)
+	if err := helpers.SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	rereadConfig(t, configFile)
+	if _, ok := helpers.TrashedMachines()["scratch"]; !ok {
+		t.Fatal("Alias should still be in the trash after 29 days")
+	}
+
+	clock = clock.Add(2 * 24 * time.Hour)
+	if err := helpers.SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	rereadConfig(t, configFile)
+	if _, ok := helpers.TrashedMachines()["scratch"]; ok {
+		t.Error("Alias should be purged after 31 days")
+	}
+	if err := restoreAlias("scratch"); err == nil {
+		t.Error("A purged alias cannot be restored")
+	}
+}
+
+func TestRunConfDeletePurge(t *testing.T) {
+	_, cleanup := setupConfigTestEnvironment(t)
+	defer cleanup()
+
+	viper.Set("machines.testserver", map[string]string{"host": "http://testhost"})
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("alias", "testserver", "")
+	cmd.Flags().Bool("purge", true, "")
+	out := captureStdout(func() { RunConfDelete(cmd, nil) })
+
+	if strings.TrimSpace(out) != "Alias deleted!" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	if len(helpers.TrashedMachines()) != 0 {
+		t.Error("A purged alias should not go to the trash")
+	}
+}
+
+func TestFormatTrashList(t *testing.T) {
+	if got := formatTrashList(nil); got != "Trash is empty\n" {
+		t.Errorf("Unexpected empty listing %q", got)
+	}
+
+	got := formatTrashList(map[string]models.TrashedMachine{
+		"b": {MachineConfig: models.MachineConfig{Host: "http://b"}, DeletedAt: "garbage"},
+		"a": {MachineConfig: models.MachineConfig{Host: "http://a"}, DeletedAt: "2026-01-01T00:00:00Z"},
+	})
+	expected := "======= Trashed Aliases ======\n" +
+		"Machine: alias = a\n   host: http://a\n   deleted: 2026-01-01T00:00:00Z\n   purged after: 2026-01-31 00:00 UTC\n" +
+		"Machine: alias = b\n   host: http://b\n   deleted: garbage\n   purged after: never (unreadable deletion time)\n"
+	if got != expected {
+		t.Errorf("Unexpected listing:\n%s", got)
+	}
+}
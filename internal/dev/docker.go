@@ -0,0 +1,105 @@
+package dev
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// dockerClient is the part of Docker the sandbox uses; tests replace
+// docker with a fake.
+type dockerClient interface {
+	// Check returns an error when Docker is not installed or its daemon
+	// cannot be reached.
+	Check() error
+	Pull(image string) error
+	// State returns the status of the container called name, such as
+	// "running" or "exited", or "" when there is no such container.
+	State(name string) (string, error)
+	Run(container sandboxContainer) error
+	Start(name string) error
+	Exec(name, user string, command ...string) error
+	Remove(name string) error
+}
+
+// sandboxContainer describes the container to create.
+type sandboxContainer struct {
+	Name  string
+	Image string
+	// Ports maps host ports, bound on 127.0.0.1 only, to container ports.
+	Ports map[int]int
+}
+
+// dockerCLI drives the docker command.
+type dockerCLI struct{}
+
+var docker dockerClient = dockerCLI{}
+
+func (dockerCLI) Check() error {
+	if _, err := exec.LookPath("docker"); err != nil {
+		return errors.New("docker was not found on PATH; install Docker (https://docs.docker.com/get-docker/) to use the sandbox")
+	}
+	if _, err := dockerOutput("info", "--format", "{{.ServerVersion}}"); err != nil {
+		return fmt.Errorf("the Docker daemon is not reachable; start Docker and try again (%v)", err)
+	}
+	return nil
+}
+
+// Pull shows docker's progress, since the first pull of the image takes a
+// while.
+func (dockerCLI) Pull(image string) error {
+	cmd := exec.Command("docker", "pull", image)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("docker pull %s failed: %v", image, err)
+	}
+	return nil
+}
+
+func (dockerCLI) State(name string) (string, error) {
+	return dockerOutput("ps", "--all", "--filter", "name=^/"+name+"$", "--format", "{{.State}}")
+}
+
+func (dockerCLI) Run(container sandboxContainer) error {
+	args := []string{"run", "--detach", "--name", container.Name, "--ulimit", "nofile=1000000:1000000"}
+	for hostPort, containerPort := range container.Ports {
+		args = append(args, "--publish", fmt.Sprintf("127.0.0.1:%d:%d", hostPort, containerPort))
+	}
+	_, err := dockerOutput(append(args, container.Image)...)
+	return err
+}
+
+func (dockerCLI) Start(name string) error {
+	_, err := dockerOutput("start", name)
+	return err
+}
+
+func (dockerCLI) Exec(name, user string, command ...string) error {
+	_, err := dockerOutput(append([]string{"exec", "--user", user, name}, command...)...)
+	return err
+}
+
+func (dockerCLI) Remove(name string) error {
+	_, err := dockerOutput("rm", "--force", name)
+	return err
+}
+
+// dockerOutput runs docker with args and returns its trimmed output. A
+// failure carries what docker printed to stderr.
+func dockerOutput(args ...string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command("docker", args...)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	if err := cmd.Run(); err != nil {
+		if message := strings.TrimSpace(stderr.String()); message != "" {
+			return "", fmt.Errorf("docker %s: %s", args[0], message)
+		}
+		return "", fmt.Errorf("docker %s: %v", args[0], err)
+	}
+	return strings.TrimSpace(stdout.String()), nil
+}
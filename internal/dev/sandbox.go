@@ -0,0 +1,212 @@
+package dev
+
+import (
+	"fmt"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/server"
+)
+
+// The sandbox is the official TigerGraph image with its default
+// credentials. Its ports are published on 127.0.0.1 only, since anyone
+// who can reach them can log in.
+const (
+	sandboxHost     = "http://127.0.0.1"
+	sandboxUser     = "tigergraph"
+	sandboxPassword = "tigergraph"
+	// containerGSPort and containerRestPort are the ports TigerGraph
+	// listens on inside the container.
+	containerGSPort   = 14240
+	containerRestPort = 9000
+)
+
+var (
+	// waitForGSQL is the readiness check; tests replace it.
+	waitForGSQL = server.WaitForGSQL
+	portFree    = defaultPortFree
+)
+
+// sandboxOptions are the flags of tg dev sandbox.
+type sandboxOptions struct {
+	Alias    string
+	Name     string
+	Image    string
+	GSPort   int
+	RestPort int
+	Timeout  time.Duration
+}
+
+func (o sandboxOptions) machine() models.MachineConfig {
+	return models.MachineConfig{
+		Host:     sandboxHost,
+		User:     sandboxUser,
+		Password: sandboxPassword,
+		GSPort:   strconv.Itoa(o.GSPort),
+		RestPort: strconv.Itoa(o.RestPort),
+	}
+}
+
+// RunSandbox starts a TigerGraph container to try tg against and registers
+// an alias for it, or with --destroy removes both again.
+func RunSandbox(cmd *cobra.Command, args []string) {
+	destroy, _ := cmd.Flags().GetBool("destroy")
+	var options sandboxOptions
+	options.Alias, _ = cmd.Flags().GetString("alias")
+	options.Name, _ = cmd.Flags().GetString("name")
+	options.Image, _ = cmd.Flags().GetString("image")
+	options.GSPort, _ = cmd.Flags().GetInt("gs-port")
+	options.RestPort, _ = cmd.Flags().GetInt("rest-port")
+	options.Timeout, _ = cmd.Flags().GetDuration("timeout")
+
+	run := startSandbox
+	if destroy {
+		run = destroySandbox
+	}
+	if err := run(options); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+	}
+}
+
+// startSandbox creates the container, or starts it again when it exists,
+// waits until GSQL accepts a login and then registers the alias.
+func startSandbox(options sandboxOptions) error {
+	if options.GSPort == options.RestPort {
+		return fmt.Errorf("--gs-port and --rest-port must differ")
+	}
+	if err := docker.Check(); err != nil {
+		return err
+	}
+	if existing, ok := aliasMachine(options.Alias); ok && existing != options.machine() {
+		return fmt.Errorf("alias %s already exists and does not point at the sandbox; pass --alias to register the sandbox under another name", options.Alias)
+	}
+
+	state, err := docker.State(options.Name)
+	if err != nil {
+		return err
+	}
+	switch state {
+	case "running":
+		fmt.Fprintf(helpers.Stdout(), "Sandbox container %s is already running\n", options.Name)
+	case "":
+		for _, port := range []int{options.GSPort, options.RestPort} {
+			if !portFree(port) {
+				return fmt.Errorf("port %d is already in use; stop what listens on it or pass --gs-port and --rest-port to use other ports", port)
+			}
+		}
+		fmt.Fprintf(helpers.Stdout(), "Pulling %s...\n", options.Image)
+		if err := docker.Pull(options.Image); err != nil {
+			return err
+		}
+		fmt.Fprintf(helpers.Stdout(), "Starting container %s...\n", options.Name)
+		err := docker.Run(sandboxContainer{
+			Name:  options.Name,
+			Image: options.Image,
+			Ports: map[int]int{options.GSPort: containerGSPort, options.RestPort: containerRestPort},
+		})
+		if err != nil {
+			return err
+		}
+		startServices(options.Name)
+	default:
+		fmt.Fprintf(helpers.Stdout(), "Starting container %s (%s)...\n", options.Name, state)
+		if err := docker.Start(options.Name); err != nil {
+			return err
+		}
+		startServices(options.Name)
+	}
+
+	fmt.Fprintf(helpers.Stdout(), "Waiting up to %s for GSQL to become ready; the first start takes a few minutes...\n", options.Timeout)
+	gsqlHost := fmt.Sprintf("%s:%d", sandboxHost, options.GSPort)
+	if err := waitForGSQL(gsqlHost, sandboxUser, sandboxPassword, options.Timeout); err != nil {
+		return fmt.Errorf("%v\nThe container is still running: see docker logs %s, or run tg dev sandbox again to keep waiting", err, options.Name)
+	}
+
+	viper.Set("machines."+helpers.AliasKey(options.Alias), options.machine())
+	if err := helpers.SaveConfig(); err != nil {
+		return fmt.Errorf("the sandbox is ready but the alias could not be saved: %v", err)
+	}
+
+	alias := options.Alias
+	fmt.Fprintf(helpers.Stdout(), "\nThe sandbox is ready as alias %s. Try:\n", alias)
+	fmt.Fprintf(helpers.Stdout(), "  tg server ping -a %s\n", alias)
+	fmt.Fprintf(helpers.Stdout(), "  tg server graphs -a %s\n", alias)
+	fmt.Fprintf(helpers.Stdout(), "  tg server gsql -a %s\n", alias)
+	fmt.Fprintln(helpers.Stdout(), "Remove it with:")
+	fmt.Fprintln(helpers.Stdout(), "  tg dev sandbox --destroy")
+	return nil
+}
+
+// startServices asks gadmin to start TigerGraph, which some releases of
+// the image leave to the user. Releases that start it themselves are
+// fine either way, so a failure is reported and the wait goes on.
+func startServices(name string) {
+	if err := docker.Exec(name, sandboxUser, "bash", "-lc", "gadmin start all"); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Could not run gadmin start all (%v); waiting for the container to start TigerGraph itself\n", err)
+	}
+}
+
+// destroySandbox removes the container and the alias. An alias that no
+// longer points at the sandbox's ports is left alone.
+func destroySandbox(options sandboxOptions) error {
+	if err := docker.Check(); err != nil {
+		return err
+	}
+	state, err := docker.State(options.Name)
+	if err != nil {
+		return err
+	}
+	if state == "" {
+		fmt.Fprintf(helpers.Stdout(), "No sandbox container %s to remove\n", options.Name)
+	} else {
+		if err := docker.Remove(options.Name); err != nil {
+			return err
+		}
+		fmt.Fprintf(helpers.Stdout(), "Removed container %s\n", options.Name)
+	}
+
+	existing, ok := aliasMachine(options.Alias)
+	switch {
+	case !ok:
+		return nil
+	case existing != options.machine():
+		fmt.Fprintf(helpers.Stdout(), "Left alias %s in place: it does not point at the sandbox\n", options.Alias)
+		return nil
+	}
+	machines := viper.GetStringMap("machines")
+	delete(machines, helpers.AliasKey(options.Alias))
+	viper.Set("machines", machines)
+	if helpers.AliasKey(viper.GetString("default")) == helpers.AliasKey(options.Alias) {
+		viper.Set("default", "")
+	}
+	if err := helpers.SaveConfig(); err != nil {
+		return fmt.Errorf("error saving config: %v", err)
+	}
+	fmt.Fprintf(helpers.Stdout(), "Removed alias %s\n", options.Alias)
+	return nil
+}
+
+// aliasMachine returns the machine alias is configured with, if any.
+func aliasMachine(alias string) (models.MachineConfig, bool) {
+	key := "machines." + helpers.AliasKey(alias)
+	var machine models.MachineConfig
+	if !viper.IsSet(key) || viper.UnmarshalKey(key, &machine) != nil {
+		return machine, false
+	}
+	return machine, true
+}
+
+func defaultPortFree(port int) bool {
+	listener, err := net.Listen("tcp", fmt.Sprintf("127.0.0.1:%d", port))
+	if err != nil {
+		return false
+	}
+	listener.Close()
+	return true
+}
@@ -0,0 +1,43 @@
+//go:build integration
+
+package dev
+
+import (
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/server"
+)
+
+// TestSandboxIntegration starts the real TigerGraph container, which pulls
+// a multi-gigabyte image and takes minutes:
+//
+//	go test -tags integration -run TestSandboxIntegration -timeout 30m ./internal/dev
+func TestSandboxIntegration(t *testing.T) {
+	if err := docker.Check(); err != nil {
+		t.Skipf("Docker is not available: %v", err)
+	}
+	setupSandbox(t, dockerCLI{})
+	waitForGSQL, portFree = server.WaitForGSQL, defaultPortFree
+
+	options := testOptions
+	options.Name = fmt.Sprintf("tgcli-sandbox-test-%d", os.Getpid())
+	options.GSPort, options.RestPort = 24240, 29000
+	options.Timeout = 20 * time.Minute
+	t.Cleanup(func() { docker.Remove(options.Name) })
+
+	if err := startSandbox(options); err != nil {
+		t.Fatalf("startSandbox failed: %v", err)
+	}
+	if _, ok := aliasMachine(options.Alias); !ok {
+		t.Error("Expected the sandbox alias to be registered")
+	}
+	if err := destroySandbox(options); err != nil {
+		t.Fatalf("destroySandbox failed: %v", err)
+	}
+	if state, _ := docker.State(options.Name); state != "" {
+		t.Errorf("Expected the container to be gone, it is %s", state)
+	}
+}
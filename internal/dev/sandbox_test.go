@@ -0,0 +1,206 @@
+package dev
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// fakeDocker records the calls the sandbox makes.
+type fakeDocker struct {
+	checkErr error
+	state    string
+	execErr  error
+	calls    []string
+	run      sandboxContainer
+}
+
+func (d *fakeDocker) Check() error { return d.checkErr }
+
+func (d *fakeDocker) Pull(image string) error {
+	d.calls = append(d.calls, "pull "+image)
+	return nil
+}
+
+func (d *fakeDocker) State(name string) (string, error) { return d.state, nil }
+
+func (d *fakeDocker) Run(container sandboxContainer) error {
+	d.calls = append(d.calls, "run "+container.Name)
+	d.run = container
+	d.state = "running"
+	return nil
+}
+
+func (d *fakeDocker) Start(name string) error {
+	d.calls = append(d.calls, "start "+name)
+	d.state = "running"
+	return nil
+}
+
+func (d *fakeDocker) Exec(name, user string, command ...string) error {
+	d.calls = append(d.calls, "exec "+strings.Join(command, " "))
+	return d.execErr
+}
+
+func (d *fakeDocker) Remove(name string) error {
+	d.calls = append(d.calls, "rm "+name)
+	d.state = ""
+	return nil
+}
+
+// setupSandbox installs client and a config file, and makes every port free
+// and GSQL ready at once unless the test says otherwise.
+func setupSandbox(t *testing.T, client dockerClient) string {
+	t.Helper()
+	originalDocker, originalWait, originalPortFree := docker, waitForGSQL, portFree
+	docker = client
+	waitForGSQL = func(host, user, password string, timeout time.Duration) error { return nil }
+	portFree = func(int) bool { return true }
+	t.Cleanup(func() { docker, waitForGSQL, portFree = originalDocker, originalWait, originalPortFree })
+
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(configFile, []byte("default: \"\"\nmachines: {}\n"), 0600)
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func captureStdout(fn func()) string {
+	original := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	fn()
+	w.Close()
+	os.Stdout = original
+	output, _ := io.ReadAll(r)
+	return string(output)
+}
+
+var testOptions = sandboxOptions{Alias: "sandbox", Name: "tgcli-sandbox", Image: "tigergraph/tigergraph:latest", GSPort: 14240, RestPort: 9000, Timeout: time.Minute}
+
+func TestStartSandbox(t *testing.T) {
+	fake := &fakeDocker{}
+	setupSandbox(t, fake)
+	var waited string
+	waitForGSQL = func(host, user, password string, timeout time.Duration) error {
+		waited = host + " " + user + " " + password
+		return nil
+	}
+
+	var err error
+	output := captureStdout(func() { err = startSandbox(testOptions) })
+	if err != nil {
+		t.Fatalf("startSandbox failed: %v", err)
+	}
+	expected := []string{"pull tigergraph/tigergraph:latest", "run tgcli-sandbox", "exec bash -lc gadmin start all"}
+	if !reflect.DeepEqual(fake.calls, expected) {
+		t.Errorf("Expected %v, got %v", expected, fake.calls)
+	}
+	if !reflect.DeepEqual(fake.run.Ports, map[int]int{14240: 14240, 9000: 9000}) {
+		t.Errorf("Unexpected ports %v", fake.run.Ports)
+	}
+	if waited != "http://127.0.0.1:14240 tigergraph tigergraph" {
+		t.Errorf("Expected to wait for the published GSQL port, waited for %q", waited)
+	}
+	if machine, ok := aliasMachine("sandbox"); !ok || machine != testOptions.machine() {
+		t.Errorf("Expected the sandbox alias to be registered, got %+v", machine)
+	}
+	if !strings.Contains(output, "tg server gsql -a sandbox") {
+		t.Errorf("Expected next steps in the output:\n%s", output)
+	}
+
+	// Running it again re-registers nothing new and touches no container.
+	fake.calls = nil
+	captureStdout(func() { err = startSandbox(testOptions) })
+	if err != nil || len(fake.calls) != 0 {
+		t.Errorf("Expected a running sandbox to be reused, got %v (%v)", fake.calls, err)
+	}
+
+	fake.state, fake.calls = "exited", nil
+	captureStdout(func() { err = startSandbox(testOptions) })
+	if err != nil || !reflect.DeepEqual(fake.calls, []string{"start tgcli-sandbox", "exec bash -lc gadmin start all"}) {
+		t.Errorf("Expected a stopped sandbox to be started, got %v (%v)", fake.calls, err)
+	}
+}
+
+func TestStartSandboxFailures(t *testing.T) {
+	tests := []struct {
+		name     string
+		setup    func(fake *fakeDocker)
+		expected string
+	}{
+		{"no docker", func(fake *fakeDocker) { fake.checkErr = errors.New("docker was not found on PATH") }, "docker was not found"},
+		{"port in use", func(*fakeDocker) { portFree = func(port int) bool { return port != 9000 } }, "port 9000 is already in use"},
+		{"alias taken", func(*fakeDocker) {
+			viper.Set("machines.sandbox", models.MachineConfig{Host: "http://10.0.0.5", GSPort: "14240", RestPort: "9000"})
+		}, "alias sandbox already exists"},
+		{"slow start", func(*fakeDocker) {
+			waitForGSQL = func(string, string, string, time.Duration) error { return errors.New("GSQL was not ready after 1m0s") }
+		}, "not ready after 1m0s\nThe container is still running: see docker logs tgcli-sandbox"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			fake := &fakeDocker{}
+			setupSandbox(t, fake)
+			test.setup(fake)
+			var err error
+			captureStdout(func() { err = startSandbox(testOptions) })
+			if err == nil || !strings.Contains(err.Error(), test.expected) {
+				t.Errorf("Expected %q, got %v", test.expected, err)
+			}
+			if _, ok := aliasMachine("sandbox"); ok && test.name != "alias taken" {
+				t.Error("Expected no alias for a sandbox that did not start")
+			}
+		})
+	}
+
+	// A failing gadmin does not stop the wait.
+	fake := &fakeDocker{execErr: errors.New("gadmin: command not found")}
+	setupSandbox(t, fake)
+	var err error
+	output := captureStdout(func() { err = startSandbox(testOptions) })
+	if err != nil || !strings.Contains(output, "Could not run gadmin start all") {
+		t.Errorf("Expected gadmin's failure to be reported and the start to go on, got %v:\n%s", err, output)
+	}
+}
+
+func TestDestroySandbox(t *testing.T) {
+	fake := &fakeDocker{state: "running"}
+	configFile := setupSandbox(t, fake)
+	viper.Set("machines.sandbox", testOptions.machine())
+	viper.Set("machines.prod", models.MachineConfig{Host: "http://10.0.0.5", GSPort: "14240"})
+	viper.Set("default", "sandbox")
+
+	var err error
+	captureStdout(func() { err = destroySandbox(testOptions) })
+	if err != nil || !reflect.DeepEqual(fake.calls, []string{"rm tgcli-sandbox"}) {
+		t.Fatalf("Expected the container to be removed, got %v (%v)", fake.calls, err)
+	}
+	data, _ := os.ReadFile(configFile)
+	if strings.Contains(string(data), "sandbox") || !strings.Contains(string(data), "prod") {
+		t.Errorf("Expected only the sandbox alias and default to be removed:\n%s", data)
+	}
+
+	// Nothing left to remove is not an error, and a reused alias stays.
+	viper.Set("machines.sandbox", models.MachineConfig{Host: "http://10.0.0.6", GSPort: "14240"})
+	fake.calls = nil
+	output := captureStdout(func() { err = destroySandbox(testOptions) })
+	if err != nil || len(fake.calls) != 0 {
+		t.Errorf("Expected nothing to be removed, got %v (%v)", fake.calls, err)
+	}
+	if !strings.Contains(output, "No sandbox container tgcli-sandbox") || !strings.Contains(output, "Left alias sandbox in place") {
+		t.Errorf("Unexpected output:\n%s", output)
+	}
+}
@@ -0,0 +1,295 @@
+package docs
+
+import (
+	"embed"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/examples"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// The GSQL quick reference is embedded so it works without network
+// access. gsql/<major>/ holds the topics for a TigerGraph major version
+// that are new or differ from the previous one; a version's reference is
+// its own directory laid over those of older majors.
+//
+// A topic file is a header of "title:" and "aliases:" lines, then "---"
+// and the text, kept within 78 columns.
+//
+//go:embed gsql
+var content embed.FS
+
+// Topic is one entry of the reference, named after its file.
+type Topic struct {
+	Name    string
+	Title   string
+	Aliases []string
+	Body    string
+}
+
+// Reference is the GSQL quick reference for one TigerGraph major version.
+type Reference struct {
+	Major  int
+	Topics []Topic
+}
+
+// majors returns the major versions with a directory, oldest first.
+func majors() []int {
+	entries, _ := fs.ReadDir(content, "gsql")
+	var found []int
+	for _, entry := range entries {
+		if major, err := strconv.Atoi(entry.Name()); err == nil && entry.IsDir() {
+			found = append(found, major)
+		}
+	}
+	sort.Ints(found)
+	return found
+}
+
+// ForVersion returns the reference for a TigerGraph version such as
+// "3.6.2" or "4". A major without its own directory gets the newest older
+// one, and an empty version the newest of all.
+func ForVersion(version string) (*Reference, error) {
+	available := majors()
+	major := available[len(available)-1]
+	if version = strings.TrimPrefix(strings.TrimSpace(version), "v"); version != "" {
+		requested, err := strconv.Atoi(strings.SplitN(version, ".", 2)[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid TigerGraph version %q", version)
+		}
+		major = available[0]
+		for _, candidate := range available {
+			if candidate <= requested {
+				major = candidate
+			}
+		}
+	}
+
+	byName := make(map[string]Topic)
+	for _, candidate := range available {
+		if candidate > major {
+			break
+		}
+		dir := path.Join("gsql", strconv.Itoa(candidate))
+		entries, err := fs.ReadDir(content, dir)
+		if err != nil {
+			return nil, err
+		}
+		for _, entry := range entries {
+			data, err := fs.ReadFile(content, path.Join(dir, entry.Name()))
+			if err != nil {
+				return nil, err
+			}
+			topic, err := parseTopic(strings.TrimSuffix(entry.Name(), ".txt"), string(data))
+			if err != nil {
+				return nil, fmt.Errorf("%s/%s: %v", dir, entry.Name(), err)
+			}
+			byName[topic.Name] = topic
+		}
+	}
+
+	ref := &Reference{Major: major}
+	for _, name := range sortedNames(byName) {
+		ref.Topics = append(ref.Topics, byName[name])
+	}
+	return ref, nil
+}
+
+func sortedNames(topics map[string]Topic) []string {
+	names := make([]string, 0, len(topics))
+	for name := range topics {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func parseTopic(name, data string) (Topic, error) {
+	header, body, ok := strings.Cut(data, "\n---\n")
+	if !ok {
+		return Topic{}, fmt.Errorf("missing --- after the header")
+	}
+	topic := Topic{Name: name, Body: strings.TrimRight(body, "\n")}
+	for _, line := range strings.Split(header, "\n") {
+		key, value, _ := strings.Cut(line, ":")
+		switch strings.TrimSpace(key) {
+		case "title":
+			topic.Title = strings.TrimSpace(value)
+		case "aliases":
+			for _, alias := range strings.Split(value, ",") {
+				if alias = strings.TrimSpace(alias); alias != "" {
+					topic.Aliases = append(topic.Aliases, alias)
+				}
+			}
+		default:
+			return Topic{}, fmt.Errorf("unknown header line %q", line)
+		}
+	}
+	if topic.Title == "" {
+		return Topic{}, fmt.Errorf("missing title")
+	}
+	return topic, nil
+}
+
+// normalize folds case, and hyphens and underscores into spaces, so
+// "post-accum", "POST ACCUM" and "post_accum" are the same topic.
+func normalize(s string) string {
+	s = strings.NewReplacer("-", " ", "_", " ").Replace(strings.ToLower(s))
+	return strings.Join(strings.Fields(s), " ")
+}
+
+// keys returns the normalized names a topic is found by.
+func (t Topic) keys() []string {
+	keys := []string{normalize(t.Name), normalize(t.Title)}
+	for _, alias := range t.Aliases {
+		keys = append(keys, normalize(alias))
+	}
+	return keys
+}
+
+// Lookup finds the topic for query. An exact name, title or alias wins;
+// otherwise a topic one of whose keys starts with or contains query, and
+// failing that the closest key within a typo or two. A query that fits
+// several topics equally is an error naming them.
+func (r *Reference) Lookup(query string) (Topic, error) {
+	q := normalize(query)
+	if q == "" {
+		return Topic{}, fmt.Errorf("no topic given")
+	}
+
+	for _, topic := range r.Topics {
+		for _, key := range topic.keys() {
+			if key == q {
+				return topic, nil
+			}
+		}
+	}
+
+	var partial []Topic
+	for _, topic := range r.Topics {
+		for _, key := range topic.keys() {
+			if strings.HasPrefix(key, q) || (len(q) >= 3 && strings.Contains(key, q)) {
+				partial = append(partial, topic)
+				break
+			}
+		}
+	}
+	if len(partial) > 0 {
+		return r.single(query, partial)
+	}
+
+	maxDistance := max(1, len(q)/4)
+	best := maxDistance + 1
+	var closest []Topic
+	for _, topic := range r.Topics {
+		distance := maxDistance + 1
+		for _, key := range topic.keys() {
+			distance = min(distance, levenshtein(key, q))
+		}
+		if distance < best {
+			best, closest = distance, []Topic{topic}
+		} else if distance == best && distance <= maxDistance {
+			closest = append(closest, topic)
+		}
+	}
+	if len(closest) > 0 {
+		return r.single(query, closest)
+	}
+	return Topic{}, fmt.Errorf("no GSQL %d.x topic matches %q", r.Major, query)
+}
+
+func (r *Reference) single(query string, topics []Topic) (Topic, error) {
+	if len(topics) == 1 {
+		return topics[0], nil
+	}
+	names := make([]string, len(topics))
+	for i, topic := range topics {
+		names[i] = topic.Name
+	}
+	return Topic{}, fmt.Errorf("%q matches several topics: %s", query, strings.Join(names, ", "))
+}
+
+// levenshtein returns the edit distance between a and b.
+func levenshtein(a, b string) int {
+	ra, rb := []rune(a), []rune(b)
+	previous := make([]int, len(rb)+1)
+	current := make([]int, len(rb)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+	for i := 1; i <= len(ra); i++ {
+		current[0] = i
+		for j := 1; j <= len(rb); j++ {
+			cost := 1
+			if ra[i-1] == rb[j-1] {
+				cost = 0
+			}
+			current[j] = min(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+		previous, current = current, previous
+	}
+	return previous[len(rb)]
+}
+
+const (
+	colorReset = "\033[0m"
+	colorBold  = "\033[1m"
+	colorDim   = "\033[2m"
+)
+
+// Render formats a topic for the terminal, with its title and section
+// headings in bold when color is set.
+func (r *Reference) Render(topic Topic, color bool) string {
+	var b strings.Builder
+	if color {
+		fmt.Fprintf(&b, "%s%s%s  %s(GSQL %d.x)%s\n\n", colorBold, topic.Title, colorReset, colorDim, r.Major, colorReset)
+	} else {
+		fmt.Fprintf(&b, "%s  (GSQL %d.x)\n\n", topic.Title, r.Major)
+	}
+	for _, line := range strings.Split(topic.Body, "\n") {
+		if color && strings.HasSuffix(line, ":") && !strings.HasPrefix(line, " ") {
+			line = colorBold + line + colorReset
+		}
+		b.WriteString(line + "\n")
+	}
+	return b.String()
+}
+
+// List formats the topics of the reference, one per line.
+func (r *Reference) List() string {
+	width := 0
+	for _, topic := range r.Topics {
+		width = max(width, len(topic.Name))
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "GSQL %d.x topics:\n", r.Major)
+	for _, topic := range r.Topics {
+		fmt.Fprintf(&b, "  %-*s  %s\n", width, topic.Name, topic.Title)
+	}
+	return b.String()
+}
+
+func RunGSQL(cmd *cobra.Command, args []string) {
+	version, _ := cmd.Flags().GetString("gsql-version")
+	ref, err := ForVersion(version)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	if len(args) == 0 {
+		Page(ref.List())
+		return
+	}
+	topic, err := ref.Lookup(strings.Join(args, " "))
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v. Try: tg docs gsql\n", err)
+		helpers.Exit(1)
+	}
+	Page(ref.Render(topic, examples.UseColor()))
+}
@@ -0,0 +1,157 @@
+package docs
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/zrougamed/tgCli/internal/outputtest"
+)
+
+func TestForVersion(t *testing.T) {
+	tests := []struct {
+		version string
+		major   int
+	}{
+		{"", 4},
+		{"3.6.2", 3},
+		{"v3", 3},
+		{"4.1.0", 4},
+		{"5.0", 4},
+		{"2.6", 3},
+	}
+	for _, tt := range tests {
+		ref, err := ForVersion(tt.version)
+		if err != nil || ref.Major != tt.major {
+			t.Errorf("%q: expected the %d.x reference, got %+v (%v)", tt.version, tt.major, ref, err)
+		}
+	}
+	if _, err := ForVersion("latest"); err == nil {
+		t.Error("Expected an invalid version to be an error")
+	}
+
+	three, _ := ForVersion("3")
+	four, _ := ForVersion("4")
+	if _, err := three.Lookup("opencypher"); err == nil {
+		t.Error("Expected 4.x topics to be left out of the 3.x reference")
+	}
+	if topic, err := four.Lookup("accum"); err != nil || !strings.Contains(topic.Body, "HeapAccum") {
+		t.Errorf("Expected 4.x to inherit unchanged 3.x topics, got %v", err)
+	}
+	threeSelect, _ := three.Lookup("select")
+	fourSelect, _ := four.Lookup("select")
+	if threeSelect.Body == fourSelect.Body || !strings.Contains(fourSelect.Body, "(s:Person)-[e:Follows]->(t)") {
+		t.Error("Expected 4.x to replace the 3.x SELECT topic")
+	}
+}
+
+func TestTopicsAreWellFormed(t *testing.T) {
+	for _, version := range []string{"3", "4"} {
+		ref, err := ForVersion(version)
+		if err != nil {
+			t.Fatalf("Failed to load the %s.x reference: %v", version, err)
+		}
+		keys := make(map[string]string)
+		for _, topic := range ref.Topics {
+			if !strings.Contains(topic.Body, "Example:") {
+				t.Errorf("%s.x %s has no example", version, topic.Name)
+			}
+			for i, line := range strings.Split(topic.Body, "\n") {
+				if utf8.RuneCountInString(line) > 78 {
+					t.Errorf("%s.x %s line %d is longer than 78 columns", version, topic.Name, i+1)
+				}
+			}
+			for _, key := range topic.keys() {
+				if other, ok := keys[key]; ok && other != topic.Name {
+					t.Errorf("%s.x: %q names both %s and %s", version, key, other, topic.Name)
+				}
+				keys[key] = topic.Name
+			}
+		}
+	}
+}
+
+func TestLookup(t *testing.T) {
+	ref, _ := ForVersion("3")
+	tests := []struct {
+		query    string
+		expected string
+	}{
+		{"select", "select"},
+		{"SELECT", "select"},
+		{"post-accum", "select"},
+		{"POST_ACCUM", "select"},
+		{"create loading job", "loading-job"},
+		{"using", "loading-job"},
+		{"heap", "accum"},
+		{"schema", "schema-change-job"},
+		{"selct", "select"},
+		{"lodaing job", "loading-job"},
+		{"acum", "accum"},
+	}
+	for _, tt := range tests {
+		if topic, err := ref.Lookup(tt.query); err != nil || topic.Name != tt.expected {
+			t.Errorf("%q: expected %s, got %q (%v)", tt.query, tt.expected, topic.Name, err)
+		}
+	}
+
+	if _, err := ref.Lookup("create"); err == nil || !strings.Contains(err.Error(), "create-edge, create-query, create-vertex") {
+		t.Errorf("Expected an ambiguous query to name the topics, got %v", err)
+	}
+	if _, err := ref.Lookup("xyzzy"); err == nil || err.Error() != `no GSQL 3.x topic matches "xyzzy"` {
+		t.Errorf("Expected no match, got %v", err)
+	}
+	if _, err := ref.Lookup("  "); err == nil {
+		t.Error("Expected an empty query to be an error")
+	}
+}
+
+func TestRenderGolden(t *testing.T) {
+	ref, _ := ForVersion("3")
+	topic, _ := ref.Lookup("install query")
+	outputtest.AssertGolden(t, "docs_install_query", []byte(ref.Render(topic, false)))
+	outputtest.AssertGolden(t, "docs_install_query_color", []byte(ref.Render(topic, true)))
+	outputtest.AssertGolden(t, "docs_topics", []byte(ref.List()))
+}
+
+func capturePage(t *testing.T, text string) string {
+	t.Helper()
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+	Page(text)
+	w.Close()
+	os.Stdout = oldStdout
+	var out bytes.Buffer
+	out.ReadFrom(r)
+	return out.String()
+}
+
+func TestPage(t *testing.T) {
+	oldHeight := terminalHeight
+	defer func() { terminalHeight = oldHeight }()
+	text := "one\ntwo\nthree\n"
+
+	terminalHeight = func() (int, bool) { return 0, false }
+	t.Setenv("PAGER", "false")
+	if got := capturePage(t, text); got != text {
+		t.Errorf("Expected text to be printed when stdout is not a terminal, got %q", got)
+	}
+
+	terminalHeight = func() (int, bool) { return 24, true }
+	if got := capturePage(t, text); got != text {
+		t.Errorf("Expected text that fits to be printed, got %q", got)
+	}
+
+	terminalHeight = func() (int, bool) { return 2, true }
+	t.Setenv("PAGER", "cat")
+	if got := capturePage(t, text); got != text {
+		t.Errorf("Expected long text to go through the pager, got %q", got)
+	}
+	t.Setenv("PAGER", "tg-no-such-pager")
+	if got := capturePage(t, text); got != text {
+		t.Errorf("Expected text to be printed without a pager, got %q", got)
+	}
+}
@@ -0,0 +1,57 @@
+package docs
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"golang.org/x/term"
+)
+
+// terminalHeight returns the height of the terminal stdout is on, or false
+// when it is not a terminal; tests replace it.
+var terminalHeight = func() (int, bool) {
+	fd := int(os.Stdout.Fd())
+	if !term.IsTerminal(fd) {
+		return 0, false
+	}
+	_, height, err := term.GetSize(fd)
+	return height, err == nil
+}
+
+// pagerCommand returns $PAGER split into its arguments, falling back to
+// more on Windows and less elsewhere. less quits at once on text that
+// turns out to fit and keeps colors.
+func pagerCommand() []string {
+	if pager := strings.Fields(os.Getenv("PAGER")); len(pager) > 0 {
+		return pager
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"more"}
+	}
+	return []string{"less", "-FRX"}
+}
+
+// Page prints text, through the pager when stdout is a terminal too short
+// to show it at once. Without a working pager, or with --out-file, the text
+// is printed as is.
+func Page(text string) {
+	height, ok := terminalHeight()
+	if !ok || helpers.StdoutRedirected() || strings.Count(text, "\n") < height {
+		fmt.Fprint(helpers.Stdout(), text)
+		return
+	}
+	pager := pagerCommand()
+	c := exec.Command(pager[0], pager[1:]...)
+	c.Stdin = strings.NewReader(text)
+	c.Stdout = os.Stdout
+	c.Stderr = os.Stderr
+	if err := c.Start(); err != nil {
+		fmt.Fprint(helpers.Stdout(), text)
+		return
+	}
+	c.Wait()
+}
@@ -0,0 +1,305 @@
+// Package download fetches large artifacts over HTTP in ranged chunks so an
+// interrupted transfer can pick up where it stopped.
+//
+// While a download is in progress the data lives in <dest>.partial next to
+// a <dest>.partial.json sidecar recording how many bytes have been written
+// and synced. A later call for the same destination resumes from that
+// offset. The file is only renamed to dest once its checksum matches.
+package download
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/telemetry"
+)
+
+const (
+	defaultChunkSize  = 8 << 20
+	defaultMaxRetries = 5
+)
+
+// retryDelay is the pause before retrying a failed chunk request.
+var retryDelay = time.Second
+
+// Options controls a download. The zero value is usable.
+type Options struct {
+	Client *http.Client
+	// ChunkSize is the size of each range request.
+	ChunkSize int64
+	// Digest is the expected SHA-256 of the whole file, as hex with an
+	// optional "sha256:" prefix. When empty the checksum is not verified.
+	Digest string
+	// Restart discards any partial download instead of resuming it.
+	Restart bool
+	// MaxRetries is how many failed chunk requests in a row are retried
+	// before giving up, defaulting to 5; a negative value disables retries.
+	// The partial file is kept for a later resume.
+	MaxRetries int
+	// Progress, when set, is called after every write with the bytes on
+	// disk and the total size.
+	Progress func(done, total int64)
+}
+
+// state is the sidecar written next to the partial file.
+type state struct {
+	URL    string `json:"url"`
+	Size   int64  `json:"size"`
+	Offset int64  `json:"offset"`
+	ETag   string `json:"etag,omitempty"`
+}
+
+// errChanged reports that the remote file no longer matches the partial
+// download, which then has to start over.
+var errChanged = errors.New("remote file changed since the download started")
+
+// PartialPath returns where the in-progress data for dest is kept.
+func PartialPath(dest string) string {
+	return dest + ".partial"
+}
+
+func statePath(dest string) string {
+	return PartialPath(dest) + ".json"
+}
+
+// File downloads url to dest, resuming a previous partial download of the
+// same url when one exists.
+func File(url, dest string, opts Options) error {
+	span := telemetry.StartSpan("download", telemetry.String("url.full", url), telemetry.String("file.path", dest))
+	err := fetchFile(url, dest, opts)
+	if info, statErr := os.Stat(dest); err == nil && statErr == nil {
+		span.SetAttributes(telemetry.Int("file.size", info.Size()))
+	}
+	span.Finish(err)
+	return err
+}
+
+func fetchFile(url, dest string, opts Options) error {
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	if opts.ChunkSize <= 0 {
+		opts.ChunkSize = defaultChunkSize
+	}
+	if opts.MaxRetries < 0 {
+		opts.MaxRetries = 0
+	} else if opts.MaxRetries == 0 {
+		opts.MaxRetries = defaultMaxRetries
+	}
+
+	if opts.Restart {
+		if err := discard(dest); err != nil {
+			return err
+		}
+	}
+
+	st := loadState(dest)
+	if st.URL != url {
+		if err := discard(dest); err != nil {
+			return err
+		}
+		st = state{URL: url, Size: -1}
+	}
+
+	file, err := os.OpenFile(PartialPath(dest), os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	// Anything past the recorded offset may be a torn write.
+	if err := file.Truncate(st.Offset); err != nil {
+		return err
+	}
+
+	failures := 0
+	for st.Size < 0 || st.Offset < st.Size {
+		err := fetchChunk(file, &st, dest, opts)
+		if err == nil {
+			failures = 0
+			continue
+		}
+
+		if errors.Is(err, errChanged) {
+			st = state{URL: url, Size: -1}
+			if err := file.Truncate(0); err != nil {
+				return err
+			}
+		}
+		failures++
+		if failures > opts.MaxRetries {
+			return fmt.Errorf("download interrupted at %d of %d bytes, run again to resume: %v", st.Offset, st.Size, err)
+		}
+		time.Sleep(retryDelay)
+	}
+
+	if err := file.Close(); err != nil {
+		return err
+	}
+	if err := verify(PartialPath(dest), opts.Digest); err != nil {
+		discard(dest)
+		return err
+	}
+	if err := os.Rename(PartialPath(dest), dest); err != nil {
+		return err
+	}
+	return os.Remove(statePath(dest))
+}
+
+// fetchChunk requests the next range, appends it to file and records the
+// new offset once the data is synced.
+func fetchChunk(file *os.File, st *state, dest string, opts Options) error {
+	req, err := http.NewRequest("GET", st.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Range", fmt.Sprintf("bytes=%d-%d", st.Offset, st.Offset+opts.ChunkSize-1))
+
+	resp, err := opts.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	etag := resp.Header.Get("ETag")
+	if st.ETag != "" && etag != "" && etag != st.ETag {
+		return errChanged
+	}
+
+	var start, expected int64
+	switch resp.StatusCode {
+	case http.StatusPartialContent:
+		var total int64
+		start, expected, total, err = parseContentRange(resp.Header.Get("Content-Range"))
+		if err != nil {
+			return err
+		}
+		if start != st.Offset {
+			return fmt.Errorf("server returned range starting at %d, expected %d", start, st.Offset)
+		}
+		st.Size = total
+	case http.StatusOK:
+		// The server ignored the range and sent the whole file.
+		if st.Offset > 0 {
+			if err := file.Truncate(0); err != nil {
+				return err
+			}
+			st.Offset = 0
+		}
+		expected = resp.ContentLength
+		st.Size = resp.ContentLength
+	case http.StatusRequestedRangeNotSatisfiable:
+		return errChanged
+	default:
+		return fmt.Errorf("download failed with status: %d", resp.StatusCode)
+	}
+	st.ETag = etag
+
+	if _, err := file.Seek(st.Offset, io.SeekStart); err != nil {
+		return err
+	}
+	written, err := io.Copy(&progressWriter{w: file, done: st.Offset, total: st.Size, report: opts.Progress}, resp.Body)
+	if err == nil && expected >= 0 && written != expected {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return err
+	}
+	if st.Size < 0 {
+		// Unknown length: the single response was the whole file.
+		st.Size = st.Offset + written
+	}
+
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	st.Offset += written
+	return saveState(dest, *st)
+}
+
+// parseContentRange parses "bytes start-end/total", returning the start,
+// the length of the range and the total size.
+func parseContentRange(header string) (int64, int64, int64, error) {
+	var start, end, total int64
+	if _, err := fmt.Sscanf(header, "bytes %d-%d/%d", &start, &end, &total); err != nil {
+		return 0, 0, 0, fmt.Errorf("invalid Content-Range %q", header)
+	}
+	return start, end - start + 1, total, nil
+}
+
+func verify(path, digest string) error {
+	if digest == "" {
+		return nil
+	}
+	expected := strings.ToLower(strings.TrimPrefix(digest, "sha256:"))
+
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	hash := sha256.New()
+	if _, err := io.Copy(hash, file); err != nil {
+		return err
+	}
+	if actual := hex.EncodeToString(hash.Sum(nil)); actual != expected {
+		return fmt.Errorf("checksum mismatch: expected sha256:%s, got sha256:%s", expected, actual)
+	}
+	return nil
+}
+
+func loadState(dest string) state {
+	var st state
+	data, err := os.ReadFile(statePath(dest))
+	if err != nil || json.Unmarshal(data, &st) != nil {
+		return state{}
+	}
+	if info, err := os.Stat(PartialPath(dest)); err != nil || info.Size() < st.Offset {
+		return state{}
+	}
+	return st
+}
+
+func saveState(dest string, st state) error {
+	data, err := json.Marshal(st)
+	if err != nil {
+		return err
+	}
+	return helpers.WriteFileAtomic(statePath(dest), data, 0600)
+}
+
+// discard removes the partial file and its sidecar.
+func discard(dest string) error {
+	for _, path := range []string{PartialPath(dest), statePath(dest)} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+type progressWriter struct {
+	w      io.Writer
+	done   int64
+	total  int64
+	report func(done, total int64)
+}
+
+func (p *progressWriter) Write(data []byte) (int, error) {
+	n, err := p.w.Write(data)
+	p.done += int64(n)
+	if p.report != nil {
+		p.report(p.done, p.total)
+	}
+	return n, err
+}
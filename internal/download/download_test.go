@@ -0,0 +1,258 @@
+package download
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// flakyServer serves content with range support and drops the connection
+// once when a response crosses one of the drop offsets.
+type flakyServer struct {
+	mu       sync.Mutex
+	content  []byte
+	etag     string
+	drops    []int64
+	requests []string
+}
+
+func newFlakyServer(t *testing.T, size int, drops ...int64) (*flakyServer, *httptest.Server) {
+	t.Helper()
+	content := make([]byte, size)
+	rand.New(rand.NewSource(int64(size))).Read(content)
+	flaky := &flakyServer{content: content, etag: `"v1"`, drops: drops}
+	server := httptest.NewServer(flaky)
+	t.Cleanup(server.Close)
+	return flaky, server
+}
+
+func (f *flakyServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rangeHeader := r.Header.Get("Range")
+	f.requests = append(f.requests, rangeHeader)
+
+	var start, end int64
+	if _, err := fmt.Sscanf(rangeHeader, "bytes=%d-%d", &start, &end); err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	if start >= int64(len(f.content)) {
+		w.WriteHeader(http.StatusRequestedRangeNotSatisfiable)
+		return
+	}
+	if end >= int64(len(f.content)) {
+		end = int64(len(f.content)) - 1
+	}
+	body := f.content[start : end+1]
+
+	cut := -1
+	for i, drop := range f.drops {
+		if drop > start && drop <= end {
+			cut = int(drop - start)
+			f.drops = append(f.drops[:i], f.drops[i+1:]...)
+			break
+		}
+	}
+
+	w.Header().Set("ETag", f.etag)
+	w.Header().Set("Content-Range", fmt.Sprintf("bytes %d-%d/%d", start, end, len(f.content)))
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(http.StatusPartialContent)
+	if cut < 0 {
+		w.Write(body)
+		return
+	}
+
+	w.Write(body[:cut])
+	w.(http.Flusher).Flush()
+	conn, _, err := w.(http.Hijacker).Hijack()
+	if err == nil {
+		conn.Close()
+	}
+}
+
+func (f *flakyServer) digest() string {
+	sum := sha256.Sum256(f.content)
+	return "sha256:" + hex.EncodeToString(sum[:])
+}
+
+func (f *flakyServer) takeRequests() []string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	requests := f.requests
+	f.requests = nil
+	return requests
+}
+
+func withoutRetryDelay(t *testing.T) {
+	original := retryDelay
+	retryDelay = 0
+	t.Cleanup(func() { retryDelay = original })
+}
+
+func assertDownloaded(t *testing.T, dest string, expected []byte) {
+	t.Helper()
+	data, err := os.ReadFile(dest)
+	if err != nil {
+		t.Fatalf("Downloaded file missing: %v", err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatalf("Downloaded content differs (%d bytes, expected %d)", len(data), len(expected))
+	}
+	for _, leftover := range []string{PartialPath(dest), statePath(dest)} {
+		if _, err := os.Stat(leftover); !os.IsNotExist(err) {
+			t.Errorf("%s should be removed after a successful download", leftover)
+		}
+	}
+}
+
+func TestFileDownloadsInChunks(t *testing.T) {
+	flaky, server := newFlakyServer(t, 10000)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	var lastDone, lastTotal int64
+	err := File(server.URL, dest, Options{
+		ChunkSize: 1000,
+		Digest:    flaky.digest(),
+		Progress:  func(done, total int64) { lastDone, lastTotal = done, total },
+	})
+	if err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+
+	assertDownloaded(t, dest, flaky.content)
+	if requests := flaky.takeRequests(); len(requests) != 10 || requests[9] != "bytes=9000-9999" {
+		t.Errorf("Expected ten 1000-byte range requests, got %v", requests)
+	}
+	if lastDone != 10000 || lastTotal != 10000 {
+		t.Errorf("Expected final progress 10000/10000, got %d/%d", lastDone, lastTotal)
+	}
+}
+
+func TestFileRetriesDroppedConnections(t *testing.T) {
+	withoutRetryDelay(t)
+	flaky, server := newFlakyServer(t, 10000, 2500, 7001)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	if err := File(server.URL, dest, Options{ChunkSize: 1000, Digest: flaky.digest()}); err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+
+	assertDownloaded(t, dest, flaky.content)
+	requests := strings.Join(flaky.takeRequests(), ",")
+	for _, expected := range []string{"bytes=2000-2999,bytes=2000-2999", "bytes=7000-7999,bytes=7000-7999"} {
+		if !strings.Contains(requests, expected) {
+			t.Errorf("Expected the dropped chunk to be retried (%s), got %s", expected, requests)
+		}
+	}
+}
+
+func TestFileResumesAcrossInvocations(t *testing.T) {
+	flaky, server := newFlakyServer(t, 10000, 4500)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+	opts := Options{ChunkSize: 1000, Digest: flaky.digest(), MaxRetries: -1}
+
+	err := File(server.URL, dest, opts)
+	if err == nil || !strings.Contains(err.Error(), "run again to resume") {
+		t.Fatalf("Expected an interrupted download, got %v", err)
+	}
+
+	var st state
+	data, _ := os.ReadFile(statePath(dest))
+	if err := json.Unmarshal(data, &st); err != nil || st.Offset != 4000 || st.Size != 10000 {
+		t.Fatalf("Expected the sidecar to record offset 4000 of 10000, got %+v (%v)", st, err)
+	}
+	flaky.takeRequests()
+
+	if err := File(server.URL, dest, opts); err != nil {
+		t.Fatalf("Resumed download failed: %v", err)
+	}
+	assertDownloaded(t, dest, flaky.content)
+	if requests := flaky.takeRequests(); requests[0] != "bytes=4000-4999" {
+		t.Errorf("Expected the download to resume at 4000, got %v", requests)
+	}
+}
+
+func TestFileDiscardsTornWrites(t *testing.T) {
+	flaky, server := newFlakyServer(t, 5000)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	// Two verified chunks followed by bytes that were never recorded.
+	partial := append(append([]byte{}, flaky.content[:2000]...), []byte("garbage")...)
+	os.WriteFile(PartialPath(dest), partial, 0600)
+	saveState(dest, state{URL: server.URL, Size: 5000, Offset: 2000, ETag: flaky.etag})
+
+	if err := File(server.URL, dest, Options{ChunkSize: 1000, Digest: flaky.digest()}); err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	assertDownloaded(t, dest, flaky.content)
+	if requests := flaky.takeRequests(); requests[0] != "bytes=2000-2999" {
+		t.Errorf("Expected the download to resume at 2000, got %v", requests)
+	}
+}
+
+func TestFileRestartDiscardsPartial(t *testing.T) {
+	flaky, server := newFlakyServer(t, 5000, 3500)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	File(server.URL, dest, Options{ChunkSize: 1000, MaxRetries: -1})
+	flaky.takeRequests()
+
+	if err := File(server.URL, dest, Options{ChunkSize: 1000, Restart: true}); err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	assertDownloaded(t, dest, flaky.content)
+	if requests := flaky.takeRequests(); len(requests) != 5 || requests[0] != "bytes=0-999" {
+		t.Errorf("Expected --restart to download from the beginning, got %v", requests)
+	}
+}
+
+func TestFileRemoteChanged(t *testing.T) {
+	withoutRetryDelay(t)
+	flaky, server := newFlakyServer(t, 5000, 3500)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	File(server.URL, dest, Options{ChunkSize: 1000, MaxRetries: -1})
+
+	flaky.mu.Lock()
+	flaky.content = bytes.Repeat([]byte("n"), 6000)
+	flaky.etag = `"v2"`
+	flaky.mu.Unlock()
+	flaky.takeRequests()
+
+	if err := File(server.URL, dest, Options{ChunkSize: 1000, Digest: flaky.digest()}); err != nil {
+		t.Fatalf("File failed: %v", err)
+	}
+	assertDownloaded(t, dest, flaky.content)
+	if requests := flaky.takeRequests(); requests[1] != "bytes=0-999" {
+		t.Errorf("Expected a changed file to be fetched from the start, got %v", requests)
+	}
+}
+
+func TestFileChecksumMismatch(t *testing.T) {
+	_, server := newFlakyServer(t, 3000)
+	dest := filepath.Join(t.TempDir(), "backup.tar.gz")
+
+	err := File(server.URL, dest, Options{ChunkSize: 1000, Digest: "sha256:" + strings.Repeat("0", 64)})
+	if err == nil || !strings.Contains(err.Error(), "checksum mismatch") {
+		t.Fatalf("Expected a checksum mismatch, got %v", err)
+	}
+	for _, path := range []string{dest, PartialPath(dest), statePath(dest)} {
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s should not exist after a failed verification", path)
+		}
+	}
+}
@@ -0,0 +1,166 @@
+// Package events emits machine-readable progress for long-running commands
+// as JSON Lines on stdout.
+//
+// Every event is one JSON object on its own line with these fields:
+//
+//	v          schema version (SchemaVersion)
+//	event      event name, e.g. "machine.started"
+//	elapsedMs  milliseconds since the command started
+//
+// in that order, followed by event specific fields sorted by name. The last
+// line of a run is always a "result" event with "status" set to "ok" or
+// "error" and, on error, a "message".
+//
+// Event names in schema version 1:
+//
+//	auth.succeeded      host
+//	backup.path         path
+//	machine.requested   id, action
+//	machine.<state>     id, message (started/stopped/terminated/archived/unarchived)
+//	machine.state       id, state
+//	services.requested  ops, services
+//	service.state       name, status
+//	service.done        name, action, status
+//	result              status, message
+//
+// Fields are only ever added within a schema version; renaming or removing
+// one bumps SchemaVersion.
+package events
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// SchemaVersion is the version of the event format documented above.
+const SchemaVersion = 1
+
+// now is replaced in tests to make elapsedMs deterministic.
+var now = time.Now
+
+// Emitter writes events. A nil *Emitter is valid and discards everything,
+// so commands can emit unconditionally.
+type Emitter struct {
+	mu       sync.Mutex
+	w        io.Writer
+	start    time.Time
+	err      error
+	finished bool
+}
+
+// New returns an emitter writing to w.
+func New(w io.Writer) *Emitter {
+	return &Emitter{w: w, start: now()}
+}
+
+// Start returns nil when enabled is false. Otherwise it returns an emitter
+// on stdout; human-readable output then goes to Out, so it does not mix
+// with the events. A run cut short by helpers.Exit, including by a signal,
+// still ends with its result event.
+func Start(enabled bool) *Emitter {
+	if !enabled {
+		return nil
+	}
+	e := New(helpers.Stdout())
+	helpers.OnExit(func(code int) {
+		if sig := helpers.StopSignal(); sig != nil {
+			e.Fail(fmt.Errorf("stopped by signal: %v", sig))
+		} else if code != 0 {
+			e.Fail(fmt.Errorf("exited with status %d", code))
+		}
+		e.Finish()
+	})
+	return e
+}
+
+// Out returns where a command writes its human-readable output: stderr
+// while events are emitted and helpers.Stdout() otherwise.
+func (e *Emitter) Out() io.Writer {
+	if e == nil {
+		return helpers.Stdout()
+	}
+	return os.Stderr
+}
+
+// Prompt returns where a command asks its questions: stderr while events
+// are emitted and the terminal otherwise, never an --out-file.
+func (e *Emitter) Prompt() io.Writer {
+	if e == nil {
+		return os.Stdout
+	}
+	return os.Stderr
+}
+
+// Emit writes one event with the given fields.
+func (e *Emitter) Emit(name string, fields map[string]interface{}) {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	nameJSON, _ := json.Marshal(name)
+	var b bytes.Buffer
+	fmt.Fprintf(&b, `{"v":%d,"event":%s,"elapsedMs":%d`, SchemaVersion, nameJSON, now().Sub(e.start).Milliseconds())
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		if key != "v" && key != "event" && key != "elapsedMs" {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		value, err := json.Marshal(fields[key])
+		if err != nil {
+			value, _ = json.Marshal(fmt.Sprintf("%v", fields[key]))
+		}
+		keyJSON, _ := json.Marshal(key)
+		fmt.Fprintf(&b, ",%s:%s", keyJSON, value)
+	}
+	b.WriteString("}\n")
+
+	e.w.Write(b.Bytes())
+}
+
+// Fail records err as the outcome reported by Finish. The first failure
+// wins.
+func (e *Emitter) Fail(err error) {
+	if e == nil || err == nil {
+		return
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.err == nil {
+		e.err = err
+	}
+}
+
+// Finish emits the terminal result event. Only the first call does
+// anything.
+func (e *Emitter) Finish() {
+	if e == nil {
+		return
+	}
+	e.mu.Lock()
+	err, finished := e.err, e.finished
+	e.finished = true
+	e.mu.Unlock()
+	if finished {
+		return
+	}
+
+	if err != nil {
+		e.Emit("result", map[string]interface{}{"status": "error", "message": err.Error()})
+	} else {
+		e.Emit("result", map[string]interface{}{"status": "ok"})
+	}
+}
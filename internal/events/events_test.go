@@ -0,0 +1,158 @@
+package events
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/outputtest"
+)
+
+// withClock makes elapsedMs advance by step on every reading.
+func withClock(t *testing.T, step time.Duration) {
+	t.Helper()
+	original := now
+	current := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	now = func() time.Time {
+		reading := current
+		current = current.Add(step)
+		return reading
+	}
+	t.Cleanup(func() { now = original })
+}
+
+// TestSchemaGolden covers every documented event. A diff here means the
+// schema changed and SchemaVersion or the package docs need attention.
+func TestSchemaGolden(t *testing.T) {
+	withClock(t, 250*time.Millisecond)
+
+	var buf bytes.Buffer
+	e := New(&buf)
+	e.Emit("auth.succeeded", map[string]interface{}{"host": "http://127.0.0.1:14240"})
+	e.Emit("backup.path", map[string]interface{}{"path": "/home/tigergraph"})
+	e.Emit("machine.requested", map[string]interface{}{"id": "x", "action": "start"})
+	e.Emit("machine.started", map[string]interface{}{"id": "x", "message": "Starting"})
+	e.Emit("services.requested", map[string]interface{}{"ops": "start", "services": []string{"gpe", "gse", "restpp"}})
+	e.Emit("service.state", map[string]interface{}{"name": "gpe", "status": "Online"})
+	e.Emit("service.done", map[string]interface{}{"name": "gpe", "action": "started now", "status": "Online"})
+	e.Emit("machine.state", map[string]interface{}{"id": "x", "state": "unarchiving"})
+	e.Finish()
+
+	outputtest.AssertGolden(t, "events_schema", buf.Bytes())
+}
+
+func TestResultErrorGolden(t *testing.T) {
+	withClock(t, time.Second)
+
+	var buf bytes.Buffer
+	e := New(&buf)
+	e.Fail(errors.New("authentication failed with status: 401"))
+	e.Fail(errors.New("later failures are ignored"))
+	e.Finish()
+
+	outputtest.AssertGolden(t, "events_result_error", buf.Bytes())
+}
+
+func TestNilEmitter(t *testing.T) {
+	var e *Emitter
+	e.Emit("anything", nil)
+	e.Fail(errors.New("ignored"))
+	e.Finish()
+
+	if Start(false) != nil {
+		t.Error("Start(false) should return a nil emitter")
+	}
+}
+
+func TestStartKeepsHumanOutputOffStdout(t *testing.T) {
+	original := os.Stdout
+	defer func() { os.Stdout = original }()
+
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	if out := (*Emitter)(nil).Out(); out != os.Stdout {
+		t.Error("Without events, human output should go to stdout")
+	}
+	if prompt := (*Emitter)(nil).Prompt(); prompt != os.Stdout {
+		t.Error("Without events, prompts should go to stdout")
+	}
+	e := Start(true)
+	if e.Out() != os.Stderr {
+		t.Error("Human output should go to stderr while events are enabled")
+	}
+	if e.Prompt() != os.Stderr {
+		t.Error("Prompts should go to stderr while events are enabled")
+	}
+	if os.Stdout != w {
+		t.Error("Start should leave os.Stdout alone")
+	}
+	e.Finish()
+
+	w.Close()
+	var buf bytes.Buffer
+	buf.ReadFrom(r)
+	if !bytes.Contains(buf.Bytes(), []byte(`"event":"result"`)) {
+		t.Errorf("Expected result event on stdout, got %q", buf.String())
+	}
+}
+
+func TestFinishOnce(t *testing.T) {
+	var buf bytes.Buffer
+	e := New(&buf)
+	e.Finish()
+	e.Fail(errors.New("too late"))
+	e.Finish()
+	if lines := strings.Count(buf.String(), "\n"); lines != 1 || strings.Contains(buf.String(), "too late") {
+		t.Errorf("Expected a single success result, got %q", buf.String())
+	}
+}
+
+// TestResultOnSignal checks that a wait loop stopped by a closed terminal
+// still ends its stream with a result event.
+func TestResultOnSignal(t *testing.T) {
+	if os.Getenv("TG_TEST_EVENTS_CHILD") != "" {
+		e := Start(true)
+		helpers.GracefulShutdown()
+		e.Emit("machine.state", map[string]interface{}{"id": "x", "state": "unarchiving"})
+		time.Sleep(time.Minute)
+		helpers.Exit(0)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not delivered this way on Windows")
+	}
+
+	child := exec.Command(os.Args[0], "-test.run=^TestResultOnSignal$")
+	child.Env = append(os.Environ(), "TG_TEST_EVENTS_CHILD=1")
+	stdout, _ := child.StdoutPipe()
+	if err := child.Start(); err != nil {
+		t.Fatalf("Failed to start the child: %v", err)
+	}
+	lines := bufio.NewScanner(stdout)
+	if !lines.Scan() || !strings.Contains(lines.Text(), `"machine.state"`) {
+		child.Process.Kill()
+		t.Fatalf("Expected the first event, got %q", lines.Text())
+	}
+	child.Process.Signal(syscall.SIGHUP)
+
+	var rest []string
+	for lines.Scan() {
+		rest = append(rest, lines.Text())
+	}
+	err := child.Wait()
+	var exitErr *exec.ExitError
+	if !errors.As(err, &exitErr) || exitErr.ExitCode() != 129 {
+		t.Errorf("Expected exit code 129, got %v", err)
+	}
+	if len(rest) != 1 || !strings.Contains(rest[0], `"message":"stopped by signal: hangup","status":"error"`) {
+		t.Errorf("Expected a single error result, got %q", rest)
+	}
+}
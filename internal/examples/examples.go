@@ -0,0 +1,154 @@
+package examples
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"golang.org/x/term"
+)
+
+// Example is one documented invocation of a command.
+type Example struct {
+	Line        string
+	Description string
+}
+
+var registry = make(map[string][]Example)
+
+// Register records examples for the command at path, e.g. "cloud list".
+func Register(path string, examples ...Example) {
+	registry[path] = append(registry[path], examples...)
+}
+
+// For returns the examples registered for path.
+func For(path string) []Example {
+	return registry[path]
+}
+
+// Paths returns every command path with registered examples, sorted.
+func Paths() []string {
+	paths := make([]string, 0, len(registry))
+	for path := range registry {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// Format renders examples for cobra's Example field.
+func Format(examples []Example) string {
+	lines := make([]string, 0, len(examples)*2)
+	for i, example := range examples {
+		if i > 0 {
+			lines = append(lines, "")
+		}
+		lines = append(lines, "  # "+example.Description, "  "+example.Line)
+	}
+	return strings.Join(lines, "\n")
+}
+
+const (
+	colorReset   = "\033[0m"
+	colorDim     = "\033[2m"
+	colorBold    = "\033[1m"
+	colorCyan    = "\033[36m"
+	colorYellow  = "\033[33m"
+	colorMagenta = "\033[35m"
+)
+
+// Highlight renders examples with ANSI colors: descriptions dimmed, the
+// program bold, subcommands cyan, flags yellow and quoted values magenta.
+func Highlight(examples []Example) string {
+	var b strings.Builder
+	for i, example := range examples {
+		if i > 0 {
+			b.WriteString("\n")
+		}
+		fmt.Fprintf(&b, "%s# %s%s\n", colorDim, example.Description, colorReset)
+
+		args, err := SplitArgs(example.Line)
+		if err != nil {
+			b.WriteString(example.Line + "\n")
+			continue
+		}
+		inFlags := false
+		for j, arg := range args {
+			if j > 0 {
+				b.WriteString(" ")
+			}
+			display := quoteArg(arg)
+			switch {
+			case j == 0:
+				b.WriteString(colorBold + display + colorReset)
+			case strings.HasPrefix(arg, "-"):
+				inFlags = true
+				b.WriteString(colorYellow + display + colorReset)
+			case !inFlags:
+				b.WriteString(colorCyan + display + colorReset)
+			case display != arg:
+				b.WriteString(colorMagenta + display + colorReset)
+			default:
+				b.WriteString(display)
+			}
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// UseColor reports whether stdout should receive ANSI colors.
+func UseColor() bool {
+	if os.Getenv("NO_COLOR") != "" {
+		return false
+	}
+	return !helpers.StdoutRedirected() && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+func quoteArg(arg string) string {
+	if arg == "" || strings.ContainsAny(arg, " \t'\"") {
+		return fmt.Sprintf("%q", arg)
+	}
+	return arg
+}
+
+// SplitArgs splits a command line into arguments, honouring single and
+// double quotes.
+func SplitArgs(line string) ([]string, error) {
+	var args []string
+	var current strings.Builder
+	var quote rune
+	inArg := false
+
+	for _, r := range line {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			} else {
+				current.WriteRune(r)
+			}
+		case r == '"' || r == '\'':
+			quote = r
+			inArg = true
+		case r == ' ' || r == '\t':
+			if inArg {
+				args = append(args, current.String())
+				current.Reset()
+				inArg = false
+			}
+		default:
+			current.WriteRune(r)
+			inArg = true
+		}
+	}
+	if quote != 0 {
+		return nil, fmt.Errorf("unterminated quote in %q", line)
+	}
+	if inArg {
+		args = append(args, current.String())
+	}
+	return args, nil
+}
@@ -0,0 +1,87 @@
+package examples
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func withRegistry(t *testing.T) {
+	t.Helper()
+	original := registry
+	registry = make(map[string][]Example)
+	t.Cleanup(func() { registry = original })
+}
+
+func TestRegistry(t *testing.T) {
+	withRegistry(t)
+
+	Register("cloud list", Example{Line: "tg cloud list", Description: "List"})
+	Register("cloud list", Example{Line: "tg cloud list -o json", Description: "JSON"})
+	Register("version", Example{Line: "tg version", Description: "Version"})
+
+	if got := len(For("cloud list")); got != 2 {
+		t.Errorf("Expected 2 examples for cloud list, got %d", got)
+	}
+	if For("missing") != nil {
+		t.Error("Unregistered paths should have no examples")
+	}
+	if got := Paths(); !reflect.DeepEqual(got, []string{"cloud list", "version"}) {
+		t.Errorf("Unexpected paths: %v", got)
+	}
+}
+
+func TestFormat(t *testing.T) {
+	formatted := Format([]Example{
+		{Line: "tg cloud list", Description: "List"},
+		{Line: "tg cloud list -o json", Description: "JSON"},
+	})
+	expected := "  # List\n  tg cloud list\n\n  # JSON\n  tg cloud list -o json"
+	if formatted != expected {
+		t.Errorf("Unexpected format:\n%q\nexpected:\n%q", formatted, expected)
+	}
+}
+
+func TestHighlight(t *testing.T) {
+	highlighted := Highlight([]Example{{Line: `tg conf add -a "my server"`, Description: "Add"}})
+
+	for _, expected := range []string{
+		colorDim + "# Add" + colorReset,
+		colorBold + "tg" + colorReset,
+		colorCyan + "conf" + colorReset,
+		colorYellow + "-a" + colorReset,
+		colorMagenta + `"my server"` + colorReset,
+	} {
+		if !strings.Contains(highlighted, expected) {
+			t.Errorf("Expected %q in highlighted output:\n%q", expected, highlighted)
+		}
+	}
+}
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+	}{
+		{"tg cloud list", []string{"tg", "cloud", "list"}},
+		{"tg  conf\tlist ", []string{"tg", "conf", "list"}},
+		{`tg conf add -a "my server"`, []string{"tg", "conf", "add", "-a", "my server"}},
+		{`tg conf add -p 'it"s'`, []string{"tg", "conf", "add", "-p", `it"s`}},
+		{`tg conf add -p ""`, []string{"tg", "conf", "add", "-p", ""}},
+	}
+
+	for _, tt := range tests {
+		got, err := SplitArgs(tt.line)
+		if err != nil {
+			t.Errorf("SplitArgs(%q) failed: %v", tt.line, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, tt.expected) {
+			t.Errorf("SplitArgs(%q) = %q, expected %q", tt.line, got, tt.expected)
+		}
+	}
+
+	if _, err := SplitArgs(`tg conf add -a "open`); err == nil {
+		t.Error("Expected error for unterminated quote")
+	}
+}
@@ -0,0 +1,75 @@
+package helpers
+
+import (
+	"maps"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// Aliases, like contexts, are matched without regard to case: viper
+// lowercases every key it reads, so "Prod" and "prod" name the same
+// machine. AliasKey gives the key an alias is stored and looked up under.
+func AliasKey(alias string) string {
+	return strings.ToLower(alias)
+}
+
+// SortedAliases returns the aliases of machines in sorted order. Go
+// randomizes map iteration, so everything that lists aliases goes through
+// it to print them the same way on every run.
+func SortedAliases[V any](machines map[string]V) []string {
+	return slices.Sorted(maps.Keys(machines))
+}
+
+// ConfiguredAliases returns the aliases of the config, sorted.
+func ConfiguredAliases() []string {
+	return SortedAliases(viper.GetStringMap("machines"))
+}
+
+// AliasCollisions returns the names that differ only by case, in groups.
+// Each group and the list of groups are sorted.
+func AliasCollisions(names []string) [][]string {
+	byKey := make(map[string][]string)
+	for _, name := range names {
+		byKey[AliasKey(name)] = append(byKey[AliasKey(name)], name)
+	}
+	var groups [][]string
+	for _, group := range byKey {
+		if len(group) > 1 {
+			sort.Strings(group)
+			groups = append(groups, group)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool { return groups[i][0] < groups[j][0] })
+	return groups
+}
+
+// ConfigAliasCollisions reads the aliases of configFile as they are
+// written, which viper cannot do, and returns those that differ only by
+// case. A missing or unreadable file has none.
+func ConfigAliasCollisions(configFile string) [][]string {
+	data, err := os.ReadFile(configFile)
+	if err != nil {
+		return nil
+	}
+	var doc map[string]interface{}
+	if err := UnmarshalConfig(ConfigFormat(configFile), data, &doc); err != nil {
+		return nil
+	}
+	machines, _ := doc["machines"].(map[string]interface{})
+	return AliasCollisions(SortedAliases(machines))
+}
+
+// DescribeAliasCollisions lists groups for an error message, e.g.
+// "Prod and prod; QA, Qa and qa".
+func DescribeAliasCollisions(groups [][]string) string {
+	described := make([]string, 0, len(groups))
+	for _, group := range groups {
+		last := len(group) - 1
+		described = append(described, strings.Join(group[:last], ", ")+" and "+group[last])
+	}
+	return strings.Join(described, "; ")
+}
@@ -0,0 +1,61 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestAliasCollisions(t *testing.T) {
+	groups := AliasCollisions([]string{"qa", "prod", "Prod", "dev", "QA", "Qa"})
+	expected := [][]string{{"Prod", "prod"}, {"QA", "Qa", "qa"}}
+	if !reflect.DeepEqual(groups, expected) {
+		t.Errorf("AliasCollisions = %v, expected %v", groups, expected)
+	}
+	if got := DescribeAliasCollisions(groups); got != "Prod and prod; QA, Qa and qa" {
+		t.Errorf("Unexpected description %q", got)
+	}
+	if groups := AliasCollisions([]string{"prod", "staging"}); len(groups) != 0 {
+		t.Errorf("Expected no collisions, got %v", groups)
+	}
+	if AliasKey("Prod") != "prod" {
+		t.Errorf("AliasKey should lowercase, got %q", AliasKey("Prod"))
+	}
+}
+
+func TestSortedAliases(t *testing.T) {
+	machines := map[string]int{"staging": 1, "prod": 2, "dev": 3, "Prod": 4}
+	for i := 0; i < 5; i++ {
+		if got := SortedAliases(machines); !reflect.DeepEqual(got, []string{"Prod", "dev", "prod", "staging"}) {
+			t.Fatalf("SortedAliases = %v", got)
+		}
+	}
+	if got := SortedAliases(map[string]interface{}{}); len(got) != 0 {
+		t.Errorf("Expected no aliases, got %v", got)
+	}
+}
+
+func TestConfigAliasCollisions(t *testing.T) {
+	dir := t.TempDir()
+	for name, content := range map[string]string{
+		"config.yml":  "machines:\n  Prod:\n    host: http://a\n  prod:\n    host: http://b\n  dev:\n    host: http://c\n",
+		"config.json": `{"machines": {"Prod": {"host": "http://a"}, "PROD": {"host": "http://b"}}}`,
+		"config.toml": "[machines.Prod]\nhost = \"http://a\"\n[machines.prod]\nhost = \"http://b\"\n",
+	} {
+		path := filepath.Join(dir, name)
+		os.WriteFile(path, []byte(content), 0600)
+		if groups := ConfigAliasCollisions(path); len(groups) != 1 || len(groups[0]) != 2 {
+			t.Errorf("%s: expected one colliding pair, got %v", name, groups)
+		}
+	}
+
+	clean := filepath.Join(dir, "clean.yml")
+	os.WriteFile(clean, []byte("machines:\n  prod:\n    host: http://a\n"), 0600)
+	if groups := ConfigAliasCollisions(clean); groups != nil {
+		t.Errorf("Expected no collisions, got %v", groups)
+	}
+	if groups := ConfigAliasCollisions(filepath.Join(dir, "missing.yml")); groups != nil {
+		t.Errorf("A missing file has no collisions, got %v", groups)
+	}
+}
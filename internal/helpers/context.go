@@ -0,0 +1,111 @@
+package helpers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// Contexts returns the named contexts from the config. Viper lowercases
+// map keys, so names are matched case-insensitively.
+func Contexts() map[string]models.Context {
+	contexts := make(map[string]models.Context)
+	if err := viper.UnmarshalKey("contexts", &contexts); err != nil {
+		return map[string]models.Context{}
+	}
+	return contexts
+}
+
+// ContextNames returns the configured context names, sorted.
+func ContextNames() []string {
+	contexts := Contexts()
+	names := make([]string, 0, len(contexts))
+	for name := range contexts {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupContext returns the named context.
+func LookupContext(name string) (models.Context, error) {
+	ctx, ok := Contexts()[strings.ToLower(name)]
+	if !ok {
+		return models.Context{}, fmt.Errorf("context %q not found (available: %s)", name, describeContextNames())
+	}
+	return ctx, nil
+}
+
+func describeContextNames() string {
+	if names := ContextNames(); len(names) > 0 {
+		return strings.Join(names, ", ")
+	}
+	return "none"
+}
+
+// CurrentContextName returns the context in effect: --context when given,
+// otherwise currentContext from the config. It is empty when none is set.
+func CurrentContextName() string {
+	if constants.Context != "" {
+		return constants.Context
+	}
+	return viper.GetString("currentContext")
+}
+
+// ActiveContext returns the context in effect. ok is false when no context
+// is selected or the selected one no longer exists, in which case callers
+// use the top-level settings.
+func ActiveContext() (string, models.Context, bool) {
+	name := CurrentContextName()
+	if name == "" {
+		return "", models.Context{}, false
+	}
+	ctx, err := LookupContext(name)
+	if err != nil {
+		return name, models.Context{}, false
+	}
+	return name, ctx, true
+}
+
+// DefaultAlias returns the alias used when none is given: the active
+// context's defaultAlias, falling back to the top-level default.
+func DefaultAlias() string {
+	if _, ctx, ok := ActiveContext(); ok && ctx.DefaultAlias != "" {
+		return ctx.DefaultAlias
+	}
+	return viper.GetString("default")
+}
+
+// OutputFormat returns the command's --output value. An explicit flag wins,
+// then the active context's output, then the flag default.
+func OutputFormat(cmd *cobra.Command) string {
+	output, _ := cmd.Flags().GetString("output")
+	if cmd.Flags().Changed("output") {
+		return output
+	}
+	if _, ctx, ok := ActiveContext(); ok && ctx.Output != "" {
+		return ctx.Output
+	}
+	return output
+}
+
+// JSONOutput returns a JSON document the way commands print it: compact,
+// which suits pipes, or indented when --json-pretty is set. Anything that
+// is not valid JSON is returned unchanged.
+func JSONOutput(data string) string {
+	if !constants.JSONPretty {
+		return data
+	}
+	var b bytes.Buffer
+	if err := json.Indent(&b, []byte(data), "", "  "); err != nil {
+		return data
+	}
+	return b.String()
+}
@@ -0,0 +1,138 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// setupContexts loads a config with two contexts and a top-level default.
+func setupContexts(t *testing.T, current string) {
+	t.Helper()
+	viper.Reset()
+	originalContext := constants.Context
+	t.Cleanup(func() {
+		viper.Reset()
+		constants.Context = originalContext
+	})
+	constants.Context = ""
+
+	viper.Set("default", "local")
+	viper.Set("contexts", map[string]interface{}{
+		"customerA": map[string]interface{}{"profile": "work", "defaultAlias": "custA-prod", "output": "json"},
+		"customerB": map[string]interface{}{"profile": "personal"},
+	})
+	if current != "" {
+		viper.Set("currentContext", current)
+	}
+}
+
+func newOutputCmd(args ...string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().StringP("output", "o", "stdout", "")
+	cmd.Flags().Parse(args)
+	return cmd
+}
+
+func TestResolutionWithoutContexts(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	viper.Set("default", "local")
+
+	if name, _, ok := ActiveContext(); ok || name != "" {
+		t.Errorf("Expected no active context, got %q", name)
+	}
+	if got := DefaultAlias(); got != "local" {
+		t.Errorf("Expected the top-level default, got %q", got)
+	}
+	if got := OutputFormat(newOutputCmd()); got != "stdout" {
+		t.Errorf("Expected the flag default, got %q", got)
+	}
+	if got := OutputFormat(newOutputCmd("-o", "json")); got != "json" {
+		t.Errorf("Expected the explicit flag, got %q", got)
+	}
+}
+
+func TestResolutionPrecedence(t *testing.T) {
+	tests := []struct {
+		name     string
+		current  string
+		override string
+		args     []string
+		alias    string
+		output   string
+	}{
+		{name: "no current context", alias: "local", output: "stdout"},
+		{name: "current context", current: "customerA", alias: "custA-prod", output: "json"},
+		{name: "current context is case-insensitive", current: "CUSTOMERA", alias: "custA-prod", output: "json"},
+		{name: "flag beats context", current: "customerA", args: []string{"-o", "stdout"}, alias: "custA-prod", output: "stdout"},
+		{name: "empty fields inherit", current: "customerB", alias: "local", output: "stdout"},
+		{name: "override beats current", current: "customerA", override: "customerB", alias: "local", output: "stdout"},
+		{name: "override without current", override: "customerA", alias: "custA-prod", output: "json"},
+		{name: "missing context falls back", current: "gone", alias: "local", output: "stdout"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setupContexts(t, tt.current)
+			constants.Context = tt.override
+
+			if got := DefaultAlias(); got != tt.alias {
+				t.Errorf("DefaultAlias() = %q, expected %q", got, tt.alias)
+			}
+			if got := OutputFormat(newOutputCmd(tt.args...)); got != tt.output {
+				t.Errorf("OutputFormat() = %q, expected %q", got, tt.output)
+			}
+		})
+	}
+}
+
+func TestActiveContext(t *testing.T) {
+	setupContexts(t, "customerA")
+
+	name, ctx, ok := ActiveContext()
+	if !ok || name != "customerA" || ctx.Profile != "work" {
+		t.Errorf("Unexpected active context %q %+v %v", name, ctx, ok)
+	}
+
+	viper.Set("currentContext", "gone")
+	if name, _, ok := ActiveContext(); ok || name != "gone" {
+		t.Errorf("A missing context should be reported as inactive, got %q %v", name, ok)
+	}
+}
+
+func TestLookupContext(t *testing.T) {
+	setupContexts(t, "")
+
+	if ctx, err := LookupContext("CustomerA"); err != nil || ctx.DefaultAlias != "custA-prod" {
+		t.Errorf("Expected a case-insensitive match, got %+v, %v", ctx, err)
+	}
+	_, err := LookupContext("gone")
+	if err == nil || !strings.Contains(err.Error(), "available: customera, customerb") {
+		t.Errorf("Expected the available contexts in the error, got %v", err)
+	}
+	if names := ContextNames(); len(names) != 2 || names[0] != "customera" {
+		t.Errorf("Unexpected context names %v", names)
+	}
+}
+
+func TestJSONOutput(t *testing.T) {
+	defer func() { constants.JSONPretty = false }()
+	document := `{"error":false,"result":[{"ID":"1"}]}`
+
+	constants.JSONPretty = false
+	if got := JSONOutput(document); got != document {
+		t.Errorf("Expected compact JSON by default, got %s", got)
+	}
+	constants.JSONPretty = true
+	expected := "{\n  \"error\": false,\n  \"result\": [\n    {\n      \"ID\": \"1\"\n    }\n  ]\n}"
+	if got := JSONOutput(document); got != expected {
+		t.Errorf("Expected indented JSON, got %s", got)
+	}
+	if got := JSONOutput("not json"); got != "not json" {
+		t.Errorf("Expected invalid JSON to pass through, got %s", got)
+	}
+}
@@ -0,0 +1,108 @@
+package helpers
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// A config that uses a setting older releases do not understand lists it
+// under requiresFeatures, with the release that introduced it, e.g.
+//
+//	requiresFeatures:
+//	  - contexts>=0.2.0
+//
+// Releases from this one on refuse to load a config listing a feature they
+// do not know, rather than ignoring its settings. A release older than the
+// check itself still ignores the list.
+const featuresKey = "requiresFeatures"
+
+// Feature is a config setting that needs a release at least Since to be
+// understood.
+type Feature struct {
+	Name  string
+	Since string
+	// Used reports whether the loaded config uses the feature.
+	Used func() bool
+}
+
+// Features are the config features this release supports.
+var Features = []Feature{
+	{Name: "contexts", Since: "0.2.0", Used: func() bool {
+		return len(Contexts()) > 0 || viper.GetString("currentContext") != ""
+	}},
+	{Name: "encrypted-passwords", Since: "0.2.0", Used: configHasPasswords},
+}
+
+// requiredFeature is one entry of requiresFeatures. since is empty when the
+// entry does not say which release introduced the feature.
+type requiredFeature struct {
+	name  string
+	since string
+}
+
+func parseRequiredFeature(entry string) requiredFeature {
+	name, since, _ := strings.Cut(strings.TrimSpace(entry), ">=")
+	return requiredFeature{name: strings.ToLower(strings.TrimSpace(name)), since: strings.TrimSpace(since)}
+}
+
+func (f requiredFeature) String() string {
+	if f.since == "" {
+		return f.name
+	}
+	return f.name + ">=" + f.since
+}
+
+func supportedFeature(name string) bool {
+	for _, feature := range Features {
+		if feature.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// CheckFeatures returns an error naming every feature in the loaded config's
+// requiresFeatures that this release does not support.
+func CheckFeatures() error {
+	var problems []string
+	for _, entry := range viper.GetStringSlice(featuresKey) {
+		required := parseRequiredFeature(entry)
+		if required.name == "" || supportedFeature(required.name) {
+			continue
+		}
+		if required.since != "" && CompareVersions(required.since, constants.VERSION_CLI) > 0 {
+			problems = append(problems, fmt.Sprintf("'%s' which requires tgCli >= %s", required.name, required.since))
+		} else {
+			problems = append(problems, fmt.Sprintf("'%s' which this tgCli does not support", required.name))
+		}
+	}
+	if len(problems) == 0 {
+		return nil
+	}
+	return fmt.Errorf("this config uses %s — you are running %s", strings.Join(problems, ", and "), constants.VERSION_CLI)
+}
+
+// recordFeatures adds the features the config uses to requiresFeatures.
+// Entries are never dropped, so those written by newer releases survive.
+func recordFeatures() {
+	entries := viper.GetStringSlice(featuresKey)
+	listed := make(map[string]bool)
+	for _, entry := range entries {
+		listed[parseRequiredFeature(entry).name] = true
+	}
+	added := false
+	for _, feature := range Features {
+		if !listed[feature.Name] && feature.Used() {
+			entries = append(entries, requiredFeature{name: feature.Name, since: feature.Since}.String())
+			added = true
+		}
+	}
+	if added {
+		sort.Strings(entries)
+		viper.Set(featuresKey, entries)
+	}
+}
@@ -0,0 +1,74 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// loadConfig reads contents as the config file, the way tg does at startup.
+func loadConfig(t *testing.T, contents string) string {
+	t.Helper()
+	viper.Reset()
+	t.Cleanup(viper.Reset)
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	if err := os.WriteFile(configFile, []byte(contents), 0600); err != nil {
+		t.Fatal(err)
+	}
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	return configFile
+}
+
+func TestCheckFeatures(t *testing.T) {
+	tests := []struct {
+		name     string
+		config   string
+		expected string
+	}{
+		{"no list", "default: prod\n", ""},
+		{"supported", "requiresFeatures:\n  - contexts>=0.2.0\n", ""},
+		{"supported without a version", "requiresFeatures: [Contexts]\n", ""},
+		{"from the future", "requiresFeatures:\n  - contexts>=0.2.0\n  - encryption>=0.3.0\n",
+			"this config uses 'encryption' which requires tgCli >= 0.3.0 — you are running 0.1.1"},
+		{"several", "requiresFeatures: [encryption>=0.3.0, profiles>=0.4.0]\n",
+			"this config uses 'encryption' which requires tgCli >= 0.3.0, and 'profiles' which requires tgCli >= 0.4.0 — you are running 0.1.1"},
+		{"no version", "requiresFeatures: [encryption]\n",
+			"this config uses 'encryption' which this tgCli does not support — you are running 0.1.1"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			loadConfig(t, test.config)
+			err := CheckFeatures()
+			if test.expected == "" && err != nil || test.expected != "" && (err == nil || err.Error() != test.expected) {
+				t.Errorf("Expected %q, got %v", test.expected, err)
+			}
+		})
+	}
+}
+
+func TestSaveConfigRecordsFeatures(t *testing.T) {
+	configFile := loadConfig(t, "default: prod\nrequiresFeatures:\n  - encryption>=0.3.0\n")
+
+	if err := SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(configFile)
+	if strings.Contains(string(data), "contexts") {
+		t.Errorf("Expected no contexts entry before contexts are used:\n%s", data)
+	}
+
+	viper.Set("currentContext", "customer-a")
+	if err := SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ = os.ReadFile(configFile)
+	if !strings.Contains(string(data), "requiresFeatures:\n    - contexts>=0.2.0\n    - encryption>=0.3.0\n") {
+		t.Errorf("Expected contexts to be recorded next to the newer entry:\n%s", data)
+	}
+}
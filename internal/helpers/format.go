@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// ConfigFormats lists the supported config formats in the order a config
+// file is looked for when no format is requested.
+var ConfigFormats = []string{"yaml", "json", "toml"}
+
+// configExtensions maps each format to the file extensions it is read from.
+// The first extension is the one new files are created with.
+var configExtensions = map[string][]string{
+	"yaml": {".yml", ".yaml"},
+	"json": {".json"},
+	"toml": {".toml"},
+}
+
+// ConfigFormat returns the format of a config file from its extension,
+// defaulting to yaml.
+func ConfigFormat(path string) string {
+	ext := strings.ToLower(filepath.Ext(path))
+	for format, extensions := range configExtensions {
+		for _, candidate := range extensions {
+			if ext == candidate {
+				return format
+			}
+		}
+	}
+	return "yaml"
+}
+
+// FindConfigFile returns the config file to use in dir. With an empty
+// format the first existing config.* file wins, falling back to config.yml.
+// With a format, only files of that format are considered and a missing
+// one is named config.<ext>.
+func FindConfigFile(dir, format string) (string, error) {
+	formats := ConfigFormats
+	if format != "" {
+		format = strings.ToLower(format)
+		if format == "yml" {
+			format = "yaml"
+		}
+		if configExtensions[format] == nil {
+			return "", fmt.Errorf("unsupported config format %q (expected %s)", format, strings.Join(ConfigFormats, ", "))
+		}
+		formats = []string{format}
+	}
+
+	for _, candidate := range formats {
+		for _, ext := range configExtensions[candidate] {
+			path := filepath.Join(dir, "config"+ext)
+			if _, err := os.Stat(path); err == nil {
+				return path, nil
+			}
+		}
+	}
+	return filepath.Join(dir, "config"+configExtensions[formats[0]][0]), nil
+}
+
+// MarshalConfig encodes a config document in the given format, yaml when
+// empty. Values are first normalized through YAML so that structs are
+// written with their yaml field names whatever the output format.
+func MarshalConfig(format string, value interface{}) ([]byte, error) {
+	if format == "yaml" || format == "" {
+		return yaml.Marshal(value)
+	}
+
+	generic, err := genericConfig(value)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	switch format {
+	case "json":
+		data, err = json.MarshalIndent(generic, "", "  ")
+		if err != nil {
+			return nil, err
+		}
+		return append(data, '\n'), nil
+	case "toml":
+		return toml.Marshal(generic)
+	}
+	return nil, fmt.Errorf("unsupported config format %q", format)
+}
+
+// genericConfig turns value into plain maps, slices and scalars, with the
+// keys its yaml tags name.
+func genericConfig(value interface{}) (map[string]interface{}, error) {
+	data, err := yaml.Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	var generic map[string]interface{}
+	if err := yaml.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	if generic == nil {
+		generic = make(map[string]interface{})
+	}
+	return generic, nil
+}
+
+// UnmarshalConfig decodes a config document in the given format, yaml when
+// empty. JSON is decoded with the YAML parser, which accepts it and keeps
+// integers as integers rather than floats.
+func UnmarshalConfig(format string, data []byte, value *map[string]interface{}) error {
+	switch format {
+	case "", "yaml", "json":
+		return yaml.Unmarshal(data, value)
+	case "toml":
+		return toml.Unmarshal(data, value)
+	}
+	return fmt.Errorf("unsupported config format %q", format)
+}
@@ -0,0 +1,122 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func TestConfigFormat(t *testing.T) {
+	tests := map[string]string{
+		"config.yml":  "yaml",
+		"config.YAML": "yaml",
+		"config.json": "json",
+		"config.toml": "toml",
+		"config":      "yaml",
+	}
+	for path, expected := range tests {
+		if got := ConfigFormat(path); got != expected {
+			t.Errorf("ConfigFormat(%q) = %q, expected %q", path, got, expected)
+		}
+	}
+}
+
+func TestFindConfigFile(t *testing.T) {
+	dir := t.TempDir()
+
+	if got, _ := FindConfigFile(dir, ""); got != filepath.Join(dir, "config.yml") {
+		t.Errorf("Expected config.yml when nothing exists, got %s", got)
+	}
+	if got, _ := FindConfigFile(dir, "TOML"); got != filepath.Join(dir, "config.toml") {
+		t.Errorf("Expected config.toml for an explicit format, got %s", got)
+	}
+	if _, err := FindConfigFile(dir, "xml"); err == nil || !strings.Contains(err.Error(), "unsupported config format") {
+		t.Errorf("Expected unsupported format error, got %v", err)
+	}
+
+	os.WriteFile(filepath.Join(dir, "config.json"), []byte("{}"), 0600)
+	if got, _ := FindConfigFile(dir, ""); got != filepath.Join(dir, "config.json") {
+		t.Errorf("Expected the existing config.json to be detected, got %s", got)
+	}
+
+	os.WriteFile(filepath.Join(dir, "config.yaml"), []byte(""), 0600)
+	if got, _ := FindConfigFile(dir, ""); got != filepath.Join(dir, "config.yaml") {
+		t.Errorf("Expected yaml to win over json, got %s", got)
+	}
+	if got, _ := FindConfigFile(dir, "json"); got != filepath.Join(dir, "config.json") {
+		t.Errorf("Expected an explicit format to pick config.json, got %s", got)
+	}
+}
+
+func TestMarshalConfigRoundTrip(t *testing.T) {
+	config := map[string]interface{}{
+		"configVersion": 1,
+		"tgcloud":       models.TGCloudConfig{User: "user@domain.com"},
+		"machines": map[string]interface{}{
+			"prod": models.MachineConfig{Host: "http://prod", GSPort: "14240"},
+		},
+		"default": "prod",
+	}
+
+	for _, format := range ConfigFormats {
+		data, err := MarshalConfig(format, config)
+		if err != nil {
+			t.Fatalf("%s: MarshalConfig failed: %v", format, err)
+		}
+		if !strings.Contains(string(data), "gsPort") {
+			t.Errorf("%s: expected yaml field names in output:\n%s", format, data)
+		}
+
+		var decoded map[string]interface{}
+		if err := UnmarshalConfig(format, data, &decoded); err != nil {
+			t.Fatalf("%s: UnmarshalConfig failed: %v\n%s", format, err, data)
+		}
+		if decoded["default"] != "prod" {
+			t.Errorf("%s: unexpected default %v", format, decoded["default"])
+		}
+		switch version := decoded["configVersion"].(type) {
+		case int, int64:
+		default:
+			t.Errorf("%s: configVersion should decode as an integer, got %T", format, version)
+		}
+		machines, _ := decoded["machines"].(map[string]interface{})
+		prod, _ := machines["prod"].(map[string]interface{})
+		if prod["host"] != "http://prod" {
+			t.Errorf("%s: unexpected machines %v", format, decoded["machines"])
+		}
+	}
+
+	if _, err := MarshalConfig("xml", config); err == nil {
+		t.Error("Expected an error for an unsupported format")
+	}
+}
+
+func TestSaveConfigKeepsFormat(t *testing.T) {
+	for _, name := range []string{"config.json", "config.toml"} {
+		configFile := filepath.Join(t.TempDir(), name)
+
+		viper.Reset()
+		viper.SetConfigFile(configFile)
+		if err := CreateDefaultConfig(configFile); err != nil {
+			t.Fatalf("%s: CreateDefaultConfig failed: %v", name, err)
+		}
+		viper.Set("machines.prod", map[string]interface{}{"host": "http://prod", "gsPort": "14240"})
+		if err := SaveConfig(); err != nil {
+			t.Fatalf("%s: SaveConfig failed: %v", name, err)
+		}
+
+		viper.Reset()
+		viper.SetConfigFile(configFile)
+		if err := viper.ReadInConfig(); err != nil {
+			t.Fatalf("%s: saved config cannot be read back: %v", name, err)
+		}
+		if viper.GetString("machines.prod.gsport") != "14240" || viper.GetString("tgcloud.user") != "mail@domain.com" {
+			t.Errorf("%s: unexpected settings after reload: %v", name, viper.AllSettings())
+		}
+	}
+	viper.Reset()
+}
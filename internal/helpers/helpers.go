@@ -1,18 +1,44 @@
 package helpers
 
 import (
+	"bytes"
+	"encoding/json"
 	"fmt"
 	"log"
+	"math"
 	"os"
 	"os/signal"
+	"path/filepath"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync/atomic"
 	"syscall"
+	"time"
+	"unicode/utf8"
 
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
 	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+	"gopkg.in/yaml.v3"
 )
 
+// canonicalKeys maps the lowercased keys viper hands back to the camelCase
+// spelling written to the config file.
+var canonicalKeys = map[string]string{
+	"configversion":    "configVersion",
+	"gsport":           "gsPort",
+	"restport":         "restPort",
+	"defaultalias":     "defaultAlias",
+	"currentcontext":   "currentContext",
+	"deletedat":        "deletedAt",
+	"requiresfeatures": "requiresFeatures",
+}
+
 func CreateDefaultConfig(configFile string) error {
 	defaultConfig := models.Config{
+		ConfigVersion: constants.CONFIG_VERSION,
 		TGCloud: models.TGCloudConfig{
 			User:     "mail@domain.com",
 			Password: "",
@@ -21,32 +47,526 @@ func CreateDefaultConfig(configFile string) error {
 		Default:  "",
 	}
 
+	viper.Set("configVersion", defaultConfig.ConfigVersion)
 	viper.Set("tgcloud", defaultConfig.TGCloud)
 	viper.Set("machines", defaultConfig.Machines)
 	viper.Set("default", defaultConfig.Default)
 
-	if err := viper.WriteConfigAs(configFile); err != nil {
+	if err := writeConfigFile(configFile); err != nil {
 		log.Printf("Error creating default config: %v", err)
 		return fmt.Errorf("unable to create default config file: %w", err)
 	}
 	return nil
 }
 
+// SaveConfig writes the current settings to the config file, purging
+// trashed aliases past TrashRetention and recording the features in use on
+// the way.
 func SaveConfig() error {
-	return viper.WriteConfig()
+	purgeTrash()
+	recordFeatures()
+	configFile := ConfigFilePath()
+	if configFile == "" {
+		return viper.WriteConfig()
+	}
+	if err := writeConfigFile(configFile); err != nil {
+		return err
+	}
+	reportEncryptedPasswords()
+	return nil
+}
+
+// ConfigFilePath returns the config file in use, falling back to the
+// default location when viper has not resolved one yet.
+func ConfigFilePath() string {
+	if configFile := viper.ConfigFileUsed(); configFile != "" {
+		return configFile
+	}
+	return constants.ConfigFile
+}
+
+// PendingConfig returns the config file as it is now and as SaveConfig
+// would write it, without writing anything. before is empty when the file
+// does not exist yet.
+func PendingConfig() (before, after []byte, err error) {
+	purgeTrash()
+	recordFeatures()
+	configFile := ConfigFilePath()
+	before, err = os.ReadFile(configFile)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, nil, err
+	}
+	after, err = renderConfigFile(configFile, false)
+	return before, after, err
+}
+
+// writeConfigFile writes the current viper settings to configFile with
+// owner-only permissions.
+func writeConfigFile(configFile string) error {
+	data, err := renderConfigFile(configFile, true)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(configFile, data, 0600); err != nil {
+		return err
+	}
+	return os.Chmod(configFile, 0600)
+}
+
+// renderConfigFile serializes the current viper settings in the format of
+// configFile, with canonical key spelling and passwords encrypted;
+// createKey lets it create the password key. An existing YAML file is
+// updated in place, keeping its comments and key order; it is only
+// rewritten from scratch when it cannot be parsed.
+func renderConfigFile(configFile string, createKey bool) ([]byte, error) {
+	format := ConfigFormat(configFile)
+	settings := viper.AllSettings()
+	if trash := reflect.ValueOf(settings["trash"]); trash.Kind() == reflect.Map && trash.Len() == 0 {
+		// An emptied trash is left out rather than written as {}.
+		delete(settings, "trash")
+	}
+	var config yaml.Node
+	if err := config.Encode(canonicalizeKeys(settings)); err != nil {
+		return nil, err
+	}
+	if err := encryptPasswords(&config, createKey); err != nil {
+		return nil, err
+	}
+	data, err := MarshalConfig(format, &config)
+	if err != nil {
+		return nil, err
+	}
+	if format == "yaml" {
+		if existing, err := os.ReadFile(configFile); err == nil {
+			if merged, err := mergeYAMLConfig(existing, data); err == nil {
+				data = merged
+			}
+		}
+	}
+	return data, nil
+}
+
+// canonicalizeKeys restores the camelCase spelling of known keys in nested
+// maps. Struct values are left alone; their yaml tags already carry it.
+func canonicalizeKeys(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			if canonical, ok := canonicalKeys[key]; ok {
+				key = canonical
+			}
+			result[key] = canonicalizeKeys(item)
+		}
+		return result
+	case map[string]string:
+		result := make(map[string]interface{}, len(typed))
+		for key, item := range typed {
+			if canonical, ok := canonicalKeys[key]; ok {
+				key = canonical
+			}
+			result[key] = item
+		}
+		return result
+	}
+	return value
+}
+
+// WriteCredentials stores the bearer token together with the endpoint that
+// issued it. The password key already in the file is kept. The token is
+// recorded without the time it was obtained, as for an imported token.
+func WriteCredentials(path, token, endpoint string) error {
+	return storeCredentials(path, models.Credentials{Token: token, Endpoint: endpoint})
+}
+
+// WriteLoginCredentials stores a token a login just obtained, with the
+// local time it was obtained at, which clock skew checks compare with the
+// token's issue time.
+func WriteLoginCredentials(path, token, endpoint string, obtainedAt time.Time) error {
+	return storeCredentials(path, models.Credentials{Token: token, Endpoint: endpoint, ObtainedAt: &obtainedAt})
+}
+
+func storeCredentials(path string, creds models.Credentials) error {
+	if existing, err := readCredentialsFile(path); err == nil {
+		creds.Key = existing.Key
+	}
+	return writeCredentialsFile(path, creds)
+}
+
+// CredentialsObtainedAt returns when the stored token was obtained by a
+// login, by the local clock. It reports false for imported and migrated
+// tokens, whose origin is unknown.
+func CredentialsObtainedAt(path string) (time.Time, bool) {
+	creds, err := readCredentialsFile(path)
+	if err != nil || creds.ObtainedAt == nil {
+		return time.Time{}, false
+	}
+	return *creds.ObtainedAt, true
+}
+
+func writeCredentialsFile(path string, creds models.Credentials) error {
+	data, err := json.Marshal(creds)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// ReadCredentials returns the stored bearer token and its issuing endpoint.
+// Files written by older versions contain only the raw token; those are
+// migrated in place to the envelope format, attributed to the default
+// tgcloud endpoint since that was the only one older versions could target.
+// A file that only holds the password key has no token, which is reported
+// as os.ErrNotExist.
+func ReadCredentials(path string) (string, string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", err
+	}
+	creds, ok := parseCredentials(data)
+	if !ok {
+		token := string(data)
+		if utf8.Valid(data) {
+			if err := WriteCredentials(path, token, constants.TGCLOUD_DEFAULT_BASE_URL); err != nil {
+				log.Printf("Unable to migrate credentials file: %v", err)
+			}
+		}
+		return token, constants.TGCLOUD_DEFAULT_BASE_URL, nil
+	}
+	if creds.Endpoint == "" {
+		return "", "", fmt.Errorf("%s holds no tgcloud token: %w", path, os.ErrNotExist)
+	}
+	return creds.Token, creds.Endpoint, nil
+}
+
+// readCredentialsFile returns the envelope in path. A raw token written by
+// an older version is returned as the token of the default endpoint.
+func readCredentialsFile(path string) (models.Credentials, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return models.Credentials{}, err
+	}
+	if creds, ok := parseCredentials(data); ok {
+		return creds, nil
+	}
+	return models.Credentials{Token: string(data), Endpoint: constants.TGCLOUD_DEFAULT_BASE_URL}, nil
+}
+
+// parseCredentials decodes the envelope format: an endpoint with its
+// token, a password key, or both.
+func parseCredentials(data []byte) (models.Credentials, bool) {
+	var creds models.Credentials
+	if !bytes.HasPrefix(bytes.TrimSpace(data), []byte("{")) || json.Unmarshal(data, &creds) != nil {
+		return creds, false
+	}
+	return creds, creds.Endpoint != "" || creds.Key != ""
+}
+
+// WriteFileAtomic writes data to a temporary file next to path and renames
+// it into place, so concurrent readers and writers never see a partial
+// file. The parent directory is created if needed.
+func WriteFileAtomic(path string, data []byte, perm os.FileMode) error {
+	dir := filepath.Dir(path)
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(dir, filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(perm); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
 }
 
+// stopSignal is the signal GracefulShutdown is ending the process for.
+var stopSignal atomic.Value
+
+// GracefulShutdown ends the process through Exit on Ctrl-C, SIGTERM or
+// SIGHUP. SIGHUP arrives when the terminal closes, and Windows reports a
+// closed console as SIGTERM, so a --wait loop left without a terminal stops
+// polling instead of running on unattended. The exit code is the shell's
+// 128 plus the signal number: 130 for Ctrl-C, 129 for a hangup.
 func GracefulShutdown() {
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM, syscall.SIGHUP)
 	go func() {
-		<-c
-		fmt.Println("\nTerminating tgcli, Good Bye!")
-		os.Exit(0)
+		sig := <-c
+		stopSignal.Store(sig)
+		if sig != syscall.SIGHUP {
+			// After a hangup there is no terminal left to say goodbye to.
+			fmt.Fprintln(os.Stderr, "\nTerminating tgcli, Good Bye!")
+		}
+		Exit(signalExitCode(sig))
 	}()
 }
 
-func CheckForUpdates() (string, error) {
-	// For now, just placeholder
-	return "N/A", nil
+func signalExitCode(sig os.Signal) int {
+	if number, ok := sig.(syscall.Signal); ok {
+		return 128 + int(number)
+	}
+	return 130
+}
+
+// StopSignal returns the signal the process is exiting for, or nil, for
+// exit hooks that record how a run ended.
+func StopSignal() os.Signal {
+	sig, _ := stopSignal.Load().(os.Signal)
+	return sig
+}
+
+// Exit codes of a command that did not succeed, besides ExitWarning and
+// the 128 plus signal number of an interrupted one.
+const (
+	ExitFailure = 1
+	// ExitCancelled is the code of a command the user declined at a
+	// prompt, so scripts can tell it from a failure.
+	ExitCancelled = 3
+)
+
+// exitStatus is the code set by Fail.
+var exitStatus atomic.Int32
+
+// Fail sets the code tg exits with once the command returns. Handlers
+// report a failure and call Fail rather than Exit, so that they still
+// return to their callers, including tests. The first code set wins.
+func Fail(code int) {
+	exitStatus.CompareAndSwap(0, int32(code))
+}
+
+// ExitStatus returns the code set by Fail, or 0 when the command has not
+// failed.
+func ExitStatus() int {
+	return int(exitStatus.Load())
+}
+
+// exitHooks run before Exit ends the process.
+var exitHooks []func(code int)
+
+// OnExit registers fn to run, with the exit code, when Exit is called.
+func OnExit(fn func(code int)) {
+	exitHooks = append(exitHooks, fn)
+}
+
+// Exit runs the OnExit hooks, the latest first as deferred calls do, and
+// exits with code. Commands call it rather than os.Exit so that work such
+// as exporting traces is not lost.
+func Exit(code int) {
+	hooks := exitHooks
+	exitHooks = nil
+	for i := len(hooks) - 1; i >= 0; i-- {
+		hooks[i](code)
+	}
+	os.Exit(code)
+}
+
+// DiffLines returns a line diff between before and after. Unchanged lines are
+// prefixed with two spaces, removed lines with "- " and added lines with "+ ".
+func DiffLines(before, after string) []string {
+	a := strings.Split(strings.TrimRight(before, "\n"), "\n")
+	b := strings.Split(strings.TrimRight(after, "\n"), "\n")
+
+	// Longest common subsequence table, filled from the end.
+	lcs := make([][]int, len(a)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				lcs[i][j] = lcs[i+1][j]
+			} else {
+				lcs[i][j] = lcs[i][j+1]
+			}
+		}
+	}
+
+	var diff []string
+	i, j := 0, 0
+	for i < len(a) && j < len(b) {
+		switch {
+		case a[i] == b[j]:
+			diff = append(diff, "  "+a[i])
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			diff = append(diff, "- "+a[i])
+			i++
+		default:
+			diff = append(diff, "+ "+b[j])
+			j++
+		}
+	}
+	for ; i < len(a); i++ {
+		diff = append(diff, "- "+a[i])
+	}
+	for ; j < len(b); j++ {
+		diff = append(diff, "+ "+b[j])
+	}
+	return diff
+}
+
+// CompareVersions compares dotted numeric versions such as "3.6.2",
+// returning -1, 0 or 1. A leading "v" is ignored and missing components
+// count as zero.
+func CompareVersions(a, b string) int {
+	pa := strings.Split(strings.TrimPrefix(a, "v"), ".")
+	pb := strings.Split(strings.TrimPrefix(b, "v"), ".")
+	for i := 0; i < len(pa) || i < len(pb); i++ {
+		var na, nb int
+		if i < len(pa) {
+			na, _ = strconv.Atoi(pa[i])
+		}
+		if i < len(pb) {
+			nb, _ = strconv.Atoi(pb[i])
+		}
+		if na != nb {
+			if na < nb {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// ParseYesNo parses a boolean flag value. Besides true/false it accepts the
+// y/n and yes/no spellings older releases used, in any case.
+func ParseYesNo(value string) (bool, error) {
+	switch strings.ToLower(strings.TrimSpace(value)) {
+	case "y", "yes", "true", "t", "1":
+		return true, nil
+	case "n", "no", "false", "f", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean value %q (expected true/false)", value)
+}
+
+// byteUnits are the suffixes ParseByteSize accepts, in powers of 1024.
+var byteUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TB", 1 << 40}, {"GB", 1 << 30}, {"MB", 1 << 20}, {"KB", 1 << 10}, {"B", 1},
+}
+
+// ParseAge parses an age or look-back period such as --older-than. On
+// top of Go durations such as 36h it accepts whole days and weeks: 7d, 2w.
+func ParseAge(value string) (time.Duration, error) {
+	value = strings.TrimSpace(value)
+	for suffix, unit := range map[string]time.Duration{"d": 24 * time.Hour, "w": 7 * 24 * time.Hour} {
+		if count, ok := strings.CutSuffix(value, suffix); ok {
+			n, err := strconv.Atoi(count)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid age %q (expected e.g. 7d, 2w or 36h)", value)
+			}
+			return time.Duration(n) * unit, nil
+		}
+	}
+	age, err := time.ParseDuration(value)
+	if err != nil || age < 0 {
+		return 0, fmt.Errorf("invalid age %q (expected e.g. 7d, 2w or 36h)", value)
+	}
+	return age, nil
+}
+
+// ParseByteSize parses a size such as 512MB, 1GB or 4096. KB, MB, GB and
+// TB are powers of 1024; the suffix is case-insensitive and the KiB
+// spelling is accepted too.
+func ParseByteSize(value string) (int64, error) {
+	text := strings.ToUpper(strings.TrimSpace(value))
+	text = strings.Replace(text, "IB", "B", 1)
+	multiplier := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(text, unit.suffix) {
+			text = strings.TrimSpace(strings.TrimSuffix(text, unit.suffix))
+			multiplier = unit.size
+			break
+		}
+	}
+	n, err := strconv.ParseInt(text, 10, 64)
+	if err != nil || n < 0 || n > math.MaxInt64/multiplier {
+		return 0, fmt.Errorf("invalid size %q (expected e.g. 512MB or 1GB)", value)
+	}
+	return n * multiplier, nil
+}
+
+// FormatByteSize formats size with the largest unit that divides it, e.g.
+// 1GB or 1536KB.
+func FormatByteSize(size int64) string {
+	for _, unit := range byteUnits {
+		if size >= unit.size && size%unit.size == 0 {
+			return fmt.Sprintf("%d%s", size/unit.size, unit.suffix)
+		}
+	}
+	return fmt.Sprintf("%dB", size)
+}
+
+// FlagEnabled reports whether the named flag is on. It works for boolean
+// flags as well as legacy y/n string flags.
+func FlagEnabled(cmd *cobra.Command, name string) bool {
+	flag := cmd.Flags().Lookup(name)
+	if flag == nil {
+		return false
+	}
+	enabled, _ := ParseYesNo(flag.Value.String())
+	return enabled
+}
+
+// legacyBoolFlags are boolean flags that used to take a y/n argument.
+var legacyBoolFlags = map[string]bool{
+	"-s": true, "--save": true,
+	"-d": true, "--default": true,
+}
+
+// NormalizeLegacyBoolArgs rewrites the old "--save y" / "-d n" forms of
+// flags that are now booleans into "--save=true" / "-d=false", so existing
+// scripts keep working. A warning is printed to stderr for each rewrite.
+func NormalizeLegacyBoolArgs(args []string) []string {
+	normalized := make([]string, 0, len(args))
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--" {
+			return append(normalized, args[i:]...)
+		}
+
+		name, value, hasValue := strings.Cut(arg, "=")
+		if !legacyBoolFlags[name] {
+			normalized = append(normalized, arg)
+			continue
+		}
+		if !hasValue && i+1 < len(args) && isYesNo(args[i+1]) {
+			value, hasValue = args[i+1], true
+			i++
+		}
+		if hasValue && isYesNo(value) {
+			enabled, _ := ParseYesNo(value)
+			Warn(WarnDeprecatedFlag, "'%s %s' is deprecated, use '%s' or '%s=false'", name, value, name, name)
+			arg = fmt.Sprintf("%s=%t", name, enabled)
+		}
+		normalized = append(normalized, arg)
+	}
+	return normalized
+}
+
+func isYesNo(value string) bool {
+	switch strings.ToLower(value) {
+	case "y", "n", "yes", "no":
+		return true
+	}
+	return false
 }
@@ -4,10 +4,13 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 
+	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
 )
 
 func TestCreateDefaultConfig(t *testing.T) {
@@ -174,33 +177,6 @@ func TestGracefulShutdownSignalHandling(t *testing.T) {
 	t.Log("GracefulShutdown signal handler setup completed without issues")
 }
 
-func TestCheckForUpdates(t *testing.T) {
-	// Test the placeholder implementation
-	version, err := CheckForUpdates()
-
-	if err != nil {
-		t.Errorf("CheckForUpdates returned error: %v", err)
-	}
-
-	if version != "N/A" {
-		t.Errorf("Expected 'N/A', got '%s'", version)
-	}
-}
-
-func TestCheckForUpdatesConsistency(t *testing.T) {
-	// Test that multiple calls return consistent results
-	version1, err1 := CheckForUpdates()
-	version2, err2 := CheckForUpdates()
-
-	if err1 != err2 {
-		t.Error("CheckForUpdates should return consistent errors")
-	}
-
-	if version1 != version2 {
-		t.Error("CheckForUpdates should return consistent versions")
-	}
-}
-
 // Helper function to test viper configuration
 func setupTestViper(t *testing.T) (string, func()) {
 	tempDir, err := os.MkdirTemp("", "tgcli_test")
@@ -349,17 +325,273 @@ func TestGracefulShutdownMultipleCalls(t *testing.T) {
 	time.Sleep(10 * time.Millisecond)
 }
 
-func TestHelperFunctionsSafety(t *testing.T) {
-	// Test that helper functions can be called without side effects
+func TestCredentialsRoundTrip(t *testing.T) {
+	tempDir := t.TempDir()
+	credsFile := filepath.Join(tempDir, "creds.bank")
+
+	if err := WriteCredentials(credsFile, "abc123", "https://staging.tgcloud.io/api"); err != nil {
+		t.Fatalf("WriteCredentials failed: %v", err)
+	}
+
+	token, endpoint, err := ReadCredentials(credsFile)
+	if err != nil {
+		t.Fatalf("ReadCredentials failed: %v", err)
+	}
+	if token != "abc123" || endpoint != "https://staging.tgcloud.io/api" {
+		t.Errorf("Unexpected credentials: token=%q endpoint=%q", token, endpoint)
+	}
+
+	info, _ := os.Stat(credsFile)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600 permissions, got %v", info.Mode().Perm())
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "nested", "state.json")
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			if err := WriteFileAtomic(path, []byte(strings.Repeat("x", 1000*(i+1))), 0600); err != nil {
+				t.Errorf("WriteFileAtomic failed: %v", err)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read file: %v", err)
+	}
+	if len(data)%1000 != 0 || strings.Trim(string(data), "x") != "" {
+		t.Errorf("File contains a partial write (%d bytes)", len(data))
+	}
+	info, _ := os.Stat(path)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600 permissions, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Temporary files were left behind: %d entries", len(entries))
+	}
+}
+
+func TestReadCredentialsMigratesPlainToken(t *testing.T) {
+	tempDir := t.TempDir()
+	credsFile := filepath.Join(tempDir, "creds.bank")
+
+	if err := os.WriteFile(credsFile, []byte("legacy_token"), 0600); err != nil {
+		t.Fatalf("Failed to write legacy token: %v", err)
+	}
+
+	token, endpoint, err := ReadCredentials(credsFile)
+	if err != nil {
+		t.Fatalf("ReadCredentials failed: %v", err)
+	}
+	if token != "legacy_token" {
+		t.Errorf("Expected legacy token to be returned as-is, got %q", token)
+	}
+	if endpoint != constants.TGCLOUD_DEFAULT_BASE_URL {
+		t.Errorf("Legacy token should be attributed to the default endpoint, got %q", endpoint)
+	}
+
+	data, _ := os.ReadFile(credsFile)
+	if !strings.Contains(string(data), `"endpoint"`) {
+		t.Errorf("Legacy file should have been migrated to the envelope format, got %s", data)
+	}
+
+	token, _, err = ReadCredentials(credsFile)
+	if err != nil || token != "legacy_token" {
+		t.Errorf("Migrated file should still yield the token, got %q (%v)", token, err)
+	}
+}
+
+func TestDiffLines(t *testing.T) {
+	diff := DiffLines("a\nb\nc\n", "a\nc\nd\n")
+	expected := []string{"  a", "- b", "  c", "+ d"}
+	if strings.Join(diff, "|") != strings.Join(expected, "|") {
+		t.Errorf("Expected %v, got %v", expected, diff)
+	}
+}
+
+func TestSaveConfigCanonicalKeys(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	content := "configversion: 1\nmachines:\n  prod:\n    host: http://prod\n    gsport: \"14240\"\n    restport: \"9000\"\n"
+	if err := os.WriteFile(configFile, []byte(content), 0644); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
 
-	// Test CheckForUpdates multiple times
-	for i := 0; i < 3; i++ {
-		version, err := CheckForUpdates()
-		if err != nil {
-			t.Errorf("CheckForUpdates call %d failed: %v", i+1, err)
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+
+	if err := SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(configFile)
+	for _, expected := range []string{"configVersion:", "gsPort:", "restPort:"} {
+		if !strings.Contains(string(data), expected) {
+			t.Errorf("Expected %s in saved config:\n%s", expected, data)
+		}
+	}
+
+	info, _ := os.Stat(configFile)
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600 permissions, got %04o", info.Mode().Perm())
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	testCases := []struct {
+		a, b     string
+		expected int
+	}{
+		{"3.6.2", "3.6.2", 0},
+		{"3.6.2", "3.6.10", -1},
+		{"3.10.0", "3.9.9", 1},
+		{"v0.2.0", "0.1.1", 1},
+		{"3.6", "3.6.0", 0},
+	}
+	for _, tc := range testCases {
+		if got := CompareVersions(tc.a, tc.b); got != tc.expected {
+			t.Errorf("CompareVersions(%q, %q) = %d, expected %d", tc.a, tc.b, got, tc.expected)
+		}
+	}
+}
+
+func TestParseYesNo(t *testing.T) {
+	for _, value := range []string{"y", "Y", "yes", "YES", "true", "1"} {
+		if enabled, err := ParseYesNo(value); err != nil || !enabled {
+			t.Errorf("ParseYesNo(%q) = %v, %v; expected true", value, enabled, err)
+		}
+	}
+	for _, value := range []string{"n", "No", "false", "0", "", " n\n"} {
+		if enabled, err := ParseYesNo(value); err != nil || enabled {
+			t.Errorf("ParseYesNo(%q) = %v, %v; expected false", value, enabled, err)
+		}
+	}
+	if _, err := ParseYesNo("maybe"); err == nil {
+		t.Error("Expected error for an unrecognized value")
+	}
+}
+
+func TestParseAge(t *testing.T) {
+	tests := []struct {
+		value    string
+		expected time.Duration
+		wantErr  bool
+	}{
+		{"7d", 7 * 24 * time.Hour, false},
+		{"2w", 14 * 24 * time.Hour, false},
+		{"36h", 36 * time.Hour, false},
+		{"90m", 90 * time.Minute, false},
+		{"0d", 0, false},
+		{"-1d", 0, true},
+		{"1.5d", 0, true},
+		{"week", 0, true},
+		{"", 0, true},
+	}
+	for _, tt := range tests {
+		age, err := ParseAge(tt.value)
+		if (err != nil) != tt.wantErr || age != tt.expected {
+			t.Errorf("ParseAge(%q) = %v, %v; want %v, error %v", tt.value, age, err, tt.expected, tt.wantErr)
+		}
+	}
+}
+
+func TestParseByteSize(t *testing.T) {
+	for value, expected := range map[string]int64{
+		"0":       0,
+		"4096":    4096,
+		"512MB":   512 << 20,
+		"1gb":     1 << 30,
+		"1 GiB":   1 << 30,
+		"64KB":    64 << 10,
+		"2TB":     2 << 40,
+		"100B":    100,
+		" 10mb\n": 10 << 20,
+	} {
+		if got, err := ParseByteSize(value); err != nil || got != expected {
+			t.Errorf("ParseByteSize(%q) = %d, %v; expected %d", value, got, err, expected)
 		}
-		if version != "N/A" {
-			t.Errorf("CheckForUpdates call %d returned unexpected version: %s", i+1, version)
+	}
+	for _, value := range []string{"", "GB", "-1MB", "1.5GB", "10PB", "9999999999TB"} {
+		if _, err := ParseByteSize(value); err == nil {
+			t.Errorf("Expected an error for %q", value)
 		}
 	}
+	for size, expected := range map[int64]string{1 << 30: "1GB", 1536 << 10: "1536KB", 100: "100B", 0: "0B"} {
+		if got := FormatByteSize(size); got != expected {
+			t.Errorf("FormatByteSize(%d) = %q, expected %q", size, got, expected)
+		}
+	}
+}
+
+func TestFlagEnabled(t *testing.T) {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("save", false, "")
+	cmd.Flags().String("default", "Y", "")
+
+	if FlagEnabled(cmd, "save") {
+		t.Error("Unset bool flag should be disabled")
+	}
+	cmd.Flags().Set("save", "true")
+	if !FlagEnabled(cmd, "save") {
+		t.Error("Bool flag set to true should be enabled")
+	}
+	if !FlagEnabled(cmd, "default") {
+		t.Error("Legacy string flag with Y should be enabled")
+	}
+	if FlagEnabled(cmd, "missing") {
+		t.Error("Missing flag should be disabled")
+	}
+}
+
+func TestNormalizeLegacyBoolArgs(t *testing.T) {
+	tests := []struct {
+		args     []string
+		expected []string
+	}{
+		{[]string{"cloud", "login", "-s", "y"}, []string{"cloud", "login", "-s=true"}},
+		{[]string{"conf", "add", "-a", "n", "--default", "N"}, []string{"conf", "add", "-a", "n", "--default=false"}},
+		{[]string{"conf", "add", "--default=yes"}, []string{"conf", "add", "--default=true"}},
+		{[]string{"cloud", "login", "--save", "-o", "json"}, []string{"cloud", "login", "--save", "-o", "json"}},
+		{[]string{"conf", "add", "--default=true"}, []string{"conf", "add", "--default=true"}},
+		{[]string{"conf", "add", "--", "-d", "y"}, []string{"conf", "add", "--", "-d", "y"}},
+	}
+
+	oldStderr := os.Stderr
+	devNull, _ := os.OpenFile(os.DevNull, os.O_WRONLY, 0)
+	os.Stderr = devNull
+	defer func() {
+		os.Stderr = oldStderr
+		devNull.Close()
+	}()
+
+	for _, tt := range tests {
+		got := NormalizeLegacyBoolArgs(tt.args)
+		if strings.Join(got, " ") != strings.Join(tt.expected, " ") {
+			t.Errorf("NormalizeLegacyBoolArgs(%v) = %v, expected %v", tt.args, got, tt.expected)
+		}
+	}
+}
+
+func TestFail(t *testing.T) {
+	exitStatus.Store(0)
+	t.Cleanup(func() { exitStatus.Store(0) })
+
+	if code := ExitStatus(); code != 0 {
+		t.Fatalf("Expected 0 before any failure, got %d", code)
+	}
+	Fail(ExitCancelled)
+	Fail(ExitFailure)
+	if code := ExitStatus(); code != ExitCancelled {
+		t.Errorf("Expected the first code %d to win, got %d", ExitCancelled, code)
+	}
 }
@@ -0,0 +1,88 @@
+package helpers
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// maxRedirects matches the limit net/http applies by default.
+const maxRedirects = 10
+
+// credentialHeaders are the headers net/http may drop on a redirect.
+var credentialHeaders = []string{"Authorization", "Cookie"}
+
+// WrapTransport wraps the transport of every client NewHTTPClient returns.
+// Tracing replaces it to record each request.
+var WrapTransport = func(base http.RoundTripper) http.RoundTripper { return base }
+
+// NewHTTPClient returns a client with the given timeout that follows
+// redirects with FollowRedirect.
+func NewHTTPClient(timeout time.Duration) *http.Client {
+	return &http.Client{Timeout: timeout, Transport: WrapTransport(http.DefaultTransport), CheckRedirect: FollowRedirect}
+}
+
+// FollowRedirect is a CheckRedirect policy that keeps credentials on
+// redirects within the same origin, including an http to https upgrade of
+// the same host, and re-attaches them if net/http dropped them. When a
+// redirect to another origin loses them it warns instead of failing later
+// with an unexplained authentication error.
+func FollowRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+	original := via[0]
+
+	if sameOrigin(original.URL, req.URL) {
+		for _, header := range credentialHeaders {
+			if value := original.Header.Get(header); value != "" && req.Header.Get(header) == "" {
+				req.Header.Set(header, value)
+			}
+		}
+		return nil
+	}
+
+	var dropped []string
+	for _, header := range credentialHeaders {
+		if original.Header.Get(header) != "" && req.Header.Get(header) == "" {
+			dropped = append(dropped, header)
+		}
+	}
+	if len(dropped) > 0 {
+		headers := "the " + dropped[0] + " header was"
+		if len(dropped) > 1 {
+			headers = "the " + strings.Join(dropped, " and ") + " headers were"
+		}
+		Warn(WarnCrossOriginRedirect, "%s redirected to %s; %s not forwarded to the other host, so the request may fail to authenticate",
+			origin(original.URL), origin(req.URL), headers)
+	}
+	return nil
+}
+
+// sameOrigin reports whether to is on the same host and port as from. An
+// upgrade from http to https on the same host counts as the same origin.
+func sameOrigin(from, to *url.URL) bool {
+	if !strings.EqualFold(from.Hostname(), to.Hostname()) {
+		return false
+	}
+	if from.Scheme == to.Scheme {
+		return effectivePort(from) == effectivePort(to)
+	}
+	return from.Scheme == "http" && to.Scheme == "https"
+}
+
+func effectivePort(u *url.URL) string {
+	if port := u.Port(); port != "" {
+		return port
+	}
+	if u.Scheme == "https" {
+		return "443"
+	}
+	return "80"
+}
+
+func origin(u *url.URL) string {
+	return u.Scheme + "://" + u.Host
+}
@@ -0,0 +1,102 @@
+package helpers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestSameOrigin(t *testing.T) {
+	tests := []struct {
+		from, to string
+		expected bool
+	}{
+		{"http://db:14240/a", "http://db:14240/b", true},
+		{"https://db/a", "https://DB:443/b", true},
+		{"http://db:14240/a", "https://db:14240/a", true},
+		{"http://db/a", "https://db/a", true},
+		{"https://db/a", "http://db/a", false},
+		{"http://db:14240/a", "http://db:9000/a", false},
+		{"https://api.tgcloud.io/a", "https://gateway.tgcloud.io/a", false},
+	}
+	for _, tt := range tests {
+		from, _ := http.NewRequest("GET", tt.from, nil)
+		to, _ := http.NewRequest("GET", tt.to, nil)
+		if got := sameOrigin(from.URL, to.URL); got != tt.expected {
+			t.Errorf("sameOrigin(%s, %s) = %v, expected %v", tt.from, tt.to, got, tt.expected)
+		}
+	}
+}
+
+func TestFollowRedirect(t *testing.T) {
+	warnings := useWarningOutput(t)
+
+	original, _ := http.NewRequest("GET", "http://db:14240/api", nil)
+	original.Header.Set("Authorization", "Bearer token")
+	original.Header.Set("Cookie", "session=1")
+
+	upgraded, _ := http.NewRequest("GET", "https://db:14240/api", nil)
+	if err := FollowRedirect(upgraded, []*http.Request{original}); err != nil {
+		t.Fatalf("FollowRedirect failed: %v", err)
+	}
+	if upgraded.Header.Get("Authorization") != "Bearer token" || upgraded.Header.Get("Cookie") != "session=1" {
+		t.Errorf("Expected credentials on a same-origin redirect, got %v", upgraded.Header)
+	}
+
+	elsewhere, _ := http.NewRequest("GET", "https://gateway:443/api", nil)
+	if err := FollowRedirect(elsewhere, []*http.Request{original}); err != nil {
+		t.Fatalf("FollowRedirect failed: %v", err)
+	}
+	if elsewhere.Header.Get("Authorization") != "" {
+		t.Error("Credentials must not be added on a cross-origin redirect")
+	}
+	if !strings.Contains(warnings.String(), "http://db:14240 redirected to https://gateway:443; the Authorization and Cookie headers were not forwarded") {
+		t.Errorf("Expected a cross-origin warning, got %q", warnings.String())
+	}
+
+	via := make([]*http.Request, maxRedirects)
+	for i := range via {
+		via[i] = original
+	}
+	if err := FollowRedirect(upgraded, via); err == nil {
+		t.Error("Expected an error after too many redirects")
+	}
+}
+
+func TestFollowRedirectReattachesAfterGateway(t *testing.T) {
+	warnings := useWarningOutput(t)
+
+	var gotAuth string
+	origin := httptest.NewServer(nil)
+	defer origin.Close()
+	gateway := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, origin.URL+"/done", http.StatusFound)
+	}))
+	defer gateway.Close()
+	// The gateway is reached through another host name, so net/http drops
+	// the credentials on the way there and does not restore them after.
+	gatewayURL := strings.Replace(gateway.URL, "127.0.0.1", "localhost", 1)
+	origin.Config.Handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/start" {
+			http.Redirect(w, r, gatewayURL+"/login", http.StatusFound)
+			return
+		}
+		gotAuth = r.Header.Get("Authorization")
+	})
+
+	req, _ := http.NewRequest("GET", origin.URL+"/start", nil)
+	req.Header.Set("Authorization", "Bearer token")
+	resp, err := NewHTTPClient(0).Do(req)
+	if err != nil {
+		t.Fatalf("Request failed: %v", err)
+	}
+	resp.Body.Close()
+
+	if gotAuth != "Bearer token" {
+		t.Errorf("Expected the credentials back on the original origin, got %q", gotAuth)
+	}
+	if !strings.Contains(warnings.String(), "redirected to http://localhost:") {
+		t.Errorf("Expected a warning for the gateway hop, got %q", warnings.String())
+	}
+}
@@ -0,0 +1,136 @@
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// discardedTail is how much of a failed command's output Discard replays
+// on stderr, enough for the error message that usually ends it.
+const discardedTail = 4096
+
+// OutFile receives a command's output in place of stdout. Output goes to a
+// temporary file next to the destination, which replaces the destination
+// only when the command succeeds, so a failure never leaves a truncated
+// file behind.
+type OutFile struct {
+	path string
+	file *os.File
+	done bool
+}
+
+// redirected is the OutFile in effect, if any.
+var redirected *OutFile
+
+// Stdout returns where commands write their output: the --out-file while
+// one is open, os.Stdout otherwise. Prompts are written to os.Stdout
+// itself, so they stay on the terminal while the output goes to the file.
+func Stdout() io.Writer {
+	if StdoutRedirected() {
+		return redirected.file
+	}
+	return os.Stdout
+}
+
+// OpenOutFile makes Stdout a temporary file that Commit renames to path,
+// so a command's output lands in the file while stderr keeps the
+// diagnostics. Exit commits it on a zero exit code and discards it
+// otherwise.
+func OpenOutFile(path string) (*OutFile, error) {
+	mode := os.FileMode(0644)
+	if info, err := os.Stat(path); err == nil {
+		if !info.Mode().IsRegular() {
+			return nil, fmt.Errorf("unable to open output file: %s is not a regular file", path)
+		}
+		mode = info.Mode().Perm()
+	}
+	file, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".tmp-*")
+	if err != nil {
+		return nil, fmt.Errorf("unable to open output file: %v", err)
+	}
+	if err := file.Chmod(mode); err != nil {
+		file.Close()
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("unable to open output file: %v", err)
+	}
+
+	out := &OutFile{path: path, file: file}
+	redirected = out
+	OnExit(func(code int) {
+		if code == 0 {
+			if err := out.Commit(); err != nil {
+				fmt.Fprintf(os.Stderr, "Error writing %s: %v\n", path, err)
+			}
+			return
+		}
+		out.Discard()
+	})
+	return out, nil
+}
+
+// StdoutRedirected reports whether output is going to a file, for commands
+// that cannot work without a terminal.
+func StdoutRedirected() bool {
+	return redirected != nil && !redirected.done
+}
+
+// restore points Stdout back at the terminal. It reports false when the
+// file was already committed or discarded.
+func (o *OutFile) restore() bool {
+	if o == nil || o.done {
+		return false
+	}
+	o.done = true
+	if redirected == o {
+		redirected = nil
+	}
+	return true
+}
+
+// Commit restores Stdout and moves the output into place.
+func (o *OutFile) Commit() error {
+	if !o.restore() {
+		return nil
+	}
+	if err := o.file.Close(); err != nil {
+		os.Remove(o.file.Name())
+		return err
+	}
+	if err := os.Rename(o.file.Name(), o.path); err != nil {
+		os.Remove(o.file.Name())
+		return err
+	}
+	return nil
+}
+
+// Discard restores Stdout and deletes the output, leaving the destination
+// as it was. The end of the output, which usually holds the error, is
+// shown on stderr.
+func (o *OutFile) Discard() {
+	if !o.restore() {
+		return
+	}
+	defer os.Remove(o.file.Name())
+	defer o.file.Close()
+
+	fmt.Fprintf(os.Stderr, "Command failed; %s was left unchanged\n", o.path)
+	size, err := o.file.Seek(0, io.SeekEnd)
+	if err != nil || size == 0 {
+		return
+	}
+	start := max(size-discardedTail, 0)
+	tail := make([]byte, size-start)
+	if _, err := o.file.ReadAt(tail, start); err != nil {
+		return
+	}
+	text := string(tail)
+	if start > 0 {
+		if i := strings.IndexByte(text, '\n'); i >= 0 {
+			text = text[i+1:]
+		}
+	}
+	fmt.Fprint(os.Stderr, text)
+}
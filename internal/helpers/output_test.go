@@ -0,0 +1,130 @@
+package helpers
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOpenOutFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.json")
+	if err := os.WriteFile(path, []byte("stale content that is longer\n"), 0640); err != nil {
+		t.Fatalf("Failed to write file: %v", err)
+	}
+
+	stdout := os.Stdout
+	out, err := OpenOutFile(path)
+	if err != nil {
+		t.Fatalf("OpenOutFile failed: %v", err)
+	}
+	if !StdoutRedirected() || Stdout() == os.Stdout {
+		t.Error("Expected stdout to be reported as redirected")
+	}
+	if os.Stdout != stdout {
+		t.Error("Expected os.Stdout to stay on the terminal for prompts")
+	}
+	fmt.Fprintln(Stdout(), `{"error":false}`)
+	if data, _ := os.ReadFile(path); string(data) != "stale content that is longer\n" {
+		t.Errorf("Expected the file to be untouched until the command ends, got %q", data)
+	}
+	if err := out.Commit(); err != nil {
+		t.Fatalf("Commit failed: %v", err)
+	}
+
+	if Stdout() != os.Stdout || StdoutRedirected() {
+		t.Error("Expected stdout to be restored")
+	}
+	if data, _ := os.ReadFile(path); string(data) != "{\"error\":false}\n" {
+		t.Errorf("Expected the output to replace the file, got %q", data)
+	}
+	if info, _ := os.Stat(path); info.Mode().Perm() != 0640 {
+		t.Errorf("Expected the file mode to be kept, got %v", info.Mode().Perm())
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected no temporary file to be left, got %d entries", len(entries))
+	}
+
+	if _, err := OpenOutFile(filepath.Join(t.TempDir(), "missing", "out.json")); err == nil {
+		t.Error("Expected an error for a file in a missing directory")
+	}
+	if _, err := OpenOutFile(t.TempDir()); err == nil {
+		t.Error("Expected an error for a directory")
+	}
+}
+
+func TestDiscardKeepsFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "out.csv")
+	os.WriteFile(path, []byte("id,name\n1,prod\n"), 0644)
+
+	out, err := OpenOutFile(path)
+	if err != nil {
+		t.Fatalf("OpenOutFile failed: %v", err)
+	}
+	fmt.Fprintln(Stdout(), "id,name")
+	out.Discard()
+	out.Discard()
+	if err := out.Commit(); err != nil {
+		t.Errorf("Commit after Discard should do nothing, got %v", err)
+	}
+
+	if data, _ := os.ReadFile(path); string(data) != "id,name\n1,prod\n" {
+		t.Errorf("Expected the original file to survive, got %q", data)
+	}
+	if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+		t.Errorf("Expected the temporary file to be removed, got %d entries", len(entries))
+	}
+}
+
+// TestExitDiscardsOutput runs a command that fails halfway in a child
+// process, since Exit ends the process.
+func TestExitDiscardsOutput(t *testing.T) {
+	if path := os.Getenv("TG_TEST_OUT_FILE"); path != "" {
+		if _, err := OpenOutFile(path); err != nil {
+			os.Exit(3)
+		}
+		fmt.Fprintln(Stdout(), `[{"id":"1"},`)
+		fmt.Fprintln(Stdout(), "Error: connection reset")
+		code := 1
+		if os.Getenv("TG_TEST_EXIT_OK") != "" {
+			code = 0
+		}
+		Exit(code)
+	}
+
+	for _, test := range []struct {
+		name     string
+		ok       bool
+		expected string
+	}{
+		{"failure", false, "[]\n"},
+		{"success", true, "[{\"id\":\"1\"},\nError: connection reset\n"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "solutions.json")
+			os.WriteFile(path, []byte("[]\n"), 0644)
+
+			child := exec.Command(os.Args[0], "-test.run=^TestExitDiscardsOutput$")
+			child.Env = append(os.Environ(), "TG_TEST_OUT_FILE="+path)
+			if test.ok {
+				child.Env = append(child.Env, "TG_TEST_EXIT_OK=1")
+			}
+			stderr, _ := child.CombinedOutput()
+
+			if data, _ := os.ReadFile(path); string(data) != test.expected {
+				t.Errorf("Expected %q in the file, got %q", test.expected, data)
+			}
+			if entries, _ := os.ReadDir(filepath.Dir(path)); len(entries) != 1 {
+				t.Errorf("Expected no temporary file to be left, got %d entries", len(entries))
+			}
+			if test.ok {
+				return
+			}
+			if !strings.Contains(string(stderr), "left unchanged") || !strings.Contains(string(stderr), "Error: connection reset") {
+				t.Errorf("Expected the failure to be reported on stderr, got %q", stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,294 @@
+package helpers
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+	"gopkg.in/yaml.v3"
+)
+
+// Passwords in the config file are encrypted with AES-256-GCM under a key
+// kept in creds.bank, and written as enc:v1:<base64 of nonce and sealed
+// password>. They are decrypted when the config is read and encrypted
+// again when it is written, so everything in between sees plaintext.
+const encryptedPrefix = "enc:v1:"
+
+// passwordSections are the config sections whose entries hold a password.
+var passwordSections = []string{"machines", "trash"}
+
+// passwordKeys caches the key of one credentials file. sealed maps each
+// password decrypted under it to the ciphertext it was read as, so an
+// unchanged password is written back byte for byte instead of with a new
+// nonce, which would show up in every --dry-run diff.
+var passwordKeys struct {
+	path   string
+	key    []byte
+	sealed map[string]string
+}
+
+// plaintextPasswords is set when the config read held a plaintext
+// password, which the next SaveConfig encrypts.
+var plaintextPasswords bool
+
+// errNoPasswordKey is returned when creds.bank holds no key to decrypt with.
+var errNoPasswordKey = errors.New("no password key")
+
+// passwordKeyFile returns the file the key is kept in: creds.bank, or,
+// when CredsFile is not set, as in tests that only set up a config, the
+// creds.bank next to the config file.
+func passwordKeyFile() string {
+	if constants.CredsFile != "" {
+		return constants.CredsFile
+	}
+	return filepath.Join(filepath.Dir(ConfigFilePath()), "creds.bank")
+}
+
+// passwordKey returns the key, creating it when create is set and there is
+// none yet.
+func passwordKey(create bool) ([]byte, error) {
+	path := passwordKeyFile()
+	if passwordKeys.path == path && passwordKeys.key != nil {
+		return passwordKeys.key, nil
+	}
+	creds, err := readCredentialsFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if creds.Key != "" {
+		key, err := base64.StdEncoding.DecodeString(creds.Key)
+		if err != nil || len(key) != 32 {
+			return nil, fmt.Errorf("the password key in %s is damaged", path)
+		}
+		cachePasswordKey(path, key)
+		return key, nil
+	}
+	if !create {
+		return nil, fmt.Errorf("%w in %s", errNoPasswordKey, path)
+	}
+
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return nil, err
+	}
+	creds.Key = base64.StdEncoding.EncodeToString(key)
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return nil, err
+	}
+	if err := writeCredentialsFile(path, creds); err != nil {
+		return nil, fmt.Errorf("unable to store the password key: %v", err)
+	}
+	cachePasswordKey(path, key)
+	return key, nil
+}
+
+func cachePasswordKey(path string, key []byte) {
+	passwordKeys.path = path
+	passwordKeys.key = key
+	passwordKeys.sealed = make(map[string]string)
+}
+
+// EncryptPassword returns password encrypted for the config file. Empty
+// and already encrypted values are returned as they are.
+func EncryptPassword(password string) (string, error) {
+	if password == "" || strings.HasPrefix(password, encryptedPrefix) {
+		return password, nil
+	}
+	key, err := passwordKey(true)
+	if err != nil {
+		return "", err
+	}
+	if sealed, ok := passwordKeys.sealed[password]; ok {
+		return sealed, nil
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	nonce := make([]byte, gcm.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := encryptedPrefix + base64.StdEncoding.EncodeToString(gcm.Seal(nonce, nonce, []byte(password), nil))
+	passwordKeys.sealed[password] = sealed
+	return sealed, nil
+}
+
+// DecryptPassword returns the plaintext of a value from the config file.
+// A value without the enc:v1: prefix is a plaintext password and is
+// returned as it is.
+func DecryptPassword(value string) (string, error) {
+	if !strings.HasPrefix(value, encryptedPrefix) {
+		return value, nil
+	}
+	key, err := passwordKey(false)
+	if err != nil {
+		return "", err
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encryptedPrefix))
+	if err != nil {
+		return "", fmt.Errorf("malformed encrypted password")
+	}
+	gcm, err := newGCM(key)
+	if err != nil {
+		return "", err
+	}
+	if len(data) < gcm.NonceSize() {
+		return "", fmt.Errorf("malformed encrypted password")
+	}
+	plain, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], nil)
+	if err != nil {
+		return "", fmt.Errorf("the password was encrypted with another key than the one in %s", passwordKeys.path)
+	}
+	passwordKeys.sealed[string(plain)] = value
+	return string(plain), nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+// LoadPasswords decrypts the passwords of the config just read. One that
+// cannot be decrypted, such as a config copied without its creds.bank, is
+// reported and left encrypted, so saving the config does not lose it.
+// Plaintext passwords are left for the next command that saves the config
+// to encrypt, so reading the config never writes it.
+func LoadPasswords() {
+	plaintextPasswords = false
+	decrypt := func(where, value string) string {
+		switch {
+		case value == "":
+		case !strings.HasPrefix(value, encryptedPrefix):
+			plaintextPasswords = true
+		default:
+			plain, err := DecryptPassword(value)
+			if err != nil {
+				Warn(WarnConfigPassword, "cannot decrypt the password of %s: %v", where, err)
+				return value
+			}
+			return plain
+		}
+		return value
+	}
+
+	tgcloud := viper.GetStringMap("tgcloud")
+	if value, ok := tgcloud["password"].(string); ok {
+		if plain := decrypt("tgcloud", value); plain != value {
+			tgcloud["password"] = plain
+			viper.Set("tgcloud", tgcloud)
+		}
+	}
+	for _, section := range passwordSections {
+		entries := viper.GetStringMap(section)
+		changed := false
+		for name, entry := range entries {
+			fields, ok := entry.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			value, _ := fields["password"].(string)
+			if plain := decrypt(section+"."+name, value); plain != value {
+				fields["password"] = plain
+				changed = true
+			}
+		}
+		if changed {
+			viper.Set(section, entries)
+		}
+	}
+}
+
+// reportEncryptedPasswords tells the user once that saving the config
+// encrypted the plaintext passwords it was read with.
+func reportEncryptedPasswords() {
+	if !plaintextPasswords {
+		return
+	}
+	plaintextPasswords = false
+	fmt.Fprintf(os.Stderr, "Encrypted the passwords in %s; the key is in %s\n", ConfigFilePath(), passwordKeyFile())
+}
+
+// encryptPasswords encrypts the passwords of config, the config as it is
+// about to be written. Without create, as for a --dry-run preview, no key
+// is created and passwords stay as they are when there is none.
+func encryptPasswords(config *yaml.Node, create bool) error {
+	if !create {
+		if _, err := passwordKey(false); err != nil {
+			return nil
+		}
+	}
+	var err error
+	eachPassword(config, func(value *yaml.Node) {
+		if err != nil {
+			return
+		}
+		var sealed string
+		if sealed, err = EncryptPassword(value.Value); err != nil {
+			err = fmt.Errorf("cannot encrypt passwords: %v", err)
+			return
+		}
+		value.Value = sealed
+	})
+	return err
+}
+
+// eachPassword calls fn with every password in config: the tgcloud one and
+// that of each machine, trashed or not.
+func eachPassword(config *yaml.Node, fn func(value *yaml.Node)) {
+	password := func(entry *yaml.Node) {
+		if value := yamlMappingValue(entry, "password"); value != nil && value.Kind == yaml.ScalarNode {
+			fn(value)
+		}
+	}
+	password(yamlMappingValue(config, "tgcloud"))
+	for _, section := range passwordSections {
+		entries := yamlMappingValue(config, section)
+		if entries == nil || entries.Kind != yaml.MappingNode {
+			continue
+		}
+		for i := 1; i < len(entries.Content); i += 2 {
+			password(entries.Content[i])
+		}
+	}
+}
+
+// yamlMappingValue returns the value of key in mapping, or nil.
+func yamlMappingValue(mapping *yaml.Node, key string) *yaml.Node {
+	if mapping == nil || mapping.Kind != yaml.MappingNode {
+		return nil
+	}
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value == key {
+			return mapping.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// configHasPasswords reports whether the config as it would be saved holds
+// a password, which is then written encrypted.
+func configHasPasswords() bool {
+	var config yaml.Node
+	if err := config.Encode(canonicalizeKeys(viper.AllSettings())); err != nil {
+		return false
+	}
+	found := false
+	eachPassword(&config, func(value *yaml.Node) {
+		if value.Value != "" {
+			found = true
+		}
+	})
+	return found
+}
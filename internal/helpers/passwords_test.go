@@ -0,0 +1,155 @@
+package helpers
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// useCredsFile points CredsFile at a fresh path for the test.
+func useCredsFile(t *testing.T) string {
+	t.Helper()
+	original := constants.CredsFile
+	constants.CredsFile = filepath.Join(t.TempDir(), "creds.bank")
+	t.Cleanup(func() { constants.CredsFile = original })
+	return constants.CredsFile
+}
+
+const plaintextConfig = `tgcloud:
+  user: me@example.com
+  password: cloud-secret
+machines:
+  # Production
+  prod:
+    host: https://prod
+    user: admin
+    password: prod-secret
+    gsPort: "14240"
+    restPort: "9000"
+trash:
+  old:
+    host: http://old
+    user: tigergraph
+    password: old-secret
+    gsPort: "14240"
+    restPort: "9000"
+    deletedAt: "2999-01-01T00:00:00Z"
+`
+
+func TestSaveConfigEncryptsPlaintext(t *testing.T) {
+	credsFile := useCredsFile(t)
+	if err := WriteCredentials(credsFile, "token", "https://tgcloud.io/api"); err != nil {
+		t.Fatal(err)
+	}
+	configFile := loadConfig(t, plaintextConfig)
+
+	// Reading the config leaves it as it is; saving it encrypts them.
+	LoadPasswords()
+	if data, _ := os.ReadFile(configFile); string(data) != plaintextConfig {
+		t.Errorf("Expected reading the config not to rewrite it:\n%s", data)
+	}
+	if _, _, err := PendingConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configFile); string(data) != plaintextConfig {
+		t.Errorf("Expected a preview not to rewrite the config:\n%s", data)
+	}
+	if err := SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	data, _ := os.ReadFile(configFile)
+	for _, secret := range []string{"cloud-secret", "prod-secret", "old-secret"} {
+		if strings.Contains(string(data), secret) {
+			t.Errorf("Expected %s to be encrypted:\n%s", secret, data)
+		}
+	}
+	if strings.Count(string(data), "password: "+encryptedPrefix) != 3 || !strings.Contains(string(data), "# Production\n") {
+		t.Errorf("Expected three encrypted passwords and the comments kept:\n%s", data)
+	}
+	if !strings.Contains(string(data), "encrypted-passwords>=0.2.0") {
+		t.Errorf("Expected the feature to be recorded:\n%s", data)
+	}
+	if viper.GetString("machines.prod.password") != "prod-secret" {
+		t.Errorf("Expected the loaded config to keep the plaintext, got %q", viper.GetString("machines.prod.password"))
+	}
+	if token, _, err := ReadCredentials(credsFile); err != nil || token != "token" {
+		t.Errorf("Expected the token to survive the key, got %q (%v)", token, err)
+	}
+
+	// A later run decrypts them, and saving writes them back unchanged.
+	viper.Reset()
+	viper.SetConfigFile(configFile)
+	viper.ReadInConfig()
+	LoadPasswords()
+	for key, expected := range map[string]string{"tgcloud.password": "cloud-secret", "machines.prod.password": "prod-secret", "trash.old.password": "old-secret", "machines.prod.host": "https://prod"} {
+		if value := viper.GetString(key); value != expected {
+			t.Errorf("Expected %s to be %q, got %q", key, expected, value)
+		}
+	}
+	if err := SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if saved, _ := os.ReadFile(configFile); string(saved) != string(data) {
+		t.Errorf("Expected an unchanged config to be written back as it was:\n%s\nvs\n%s", data, saved)
+	}
+}
+
+func TestLoadPasswordsWithoutKey(t *testing.T) {
+	useCredsFile(t)
+	out := useWarningOutput(t)
+	sealed := encryptedPrefix + "bm90IGEgcmVhbCBwYXNzd29yZCBhdCBhbGw="
+	configFile := loadConfig(t, "machines:\n  prod:\n    host: https://prod\n    password: "+sealed+"\n")
+
+	LoadPasswords()
+	if !strings.Contains(out.String(), "cannot decrypt the password of machines.prod: no password key in ") || !strings.HasSuffix(out.String(), "[config-password]\n") {
+		t.Errorf("Expected a config-password warning, got %q", out)
+	}
+
+	// Saving keeps the password it could not read, and a preview creates
+	// no key.
+	if _, _, err := PendingConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(constants.CredsFile); !os.IsNotExist(err) {
+		t.Errorf("Expected a preview to create no key, got %v", err)
+	}
+	if err := SaveConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := os.ReadFile(configFile); !strings.Contains(string(data), sealed) {
+		t.Errorf("Expected the encrypted password to be kept:\n%s", data)
+	}
+}
+
+func TestPasswordKeyInCredentials(t *testing.T) {
+	credsFile := useCredsFile(t)
+	loadConfig(t, "")
+
+	sealed, err := EncryptPassword("secret")
+	if err != nil || !strings.HasPrefix(sealed, encryptedPrefix) {
+		t.Fatalf("Expected an encrypted password, got %q (%v)", sealed, err)
+	}
+	if _, _, err := ReadCredentials(credsFile); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected a file with only the key to hold no token, got %v", err)
+	}
+	if info, _ := os.Stat(credsFile); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected 0600 permissions, got %v", info.Mode().Perm())
+	}
+
+	// Logging in keeps the key.
+	if err := WriteCredentials(credsFile, "token", "https://tgcloud.io/api"); err != nil {
+		t.Fatal(err)
+	}
+	passwordKeys.key = nil
+	if plain, err := DecryptPassword(sealed); err != nil || plain != "secret" {
+		t.Errorf("Expected the key to survive a login, got %q (%v)", plain, err)
+	}
+	if plain, err := DecryptPassword("plain"); err != nil || plain != "plain" {
+		t.Errorf("Expected a plaintext password as it is, got %q (%v)", plain, err)
+	}
+}
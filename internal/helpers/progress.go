@@ -0,0 +1,65 @@
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"time"
+)
+
+const progressBarWidth = 30
+
+// ProgressBar redraws a single terminal line as progress is reported.
+type ProgressBar struct {
+	w       io.Writer
+	started time.Time
+	drawn   int
+}
+
+// NewProgressBar returns a bar drawn on w, which should be a terminal.
+func NewProgressBar(w io.Writer) *ProgressBar {
+	return &ProgressBar{w: w}
+}
+
+// Update redraws the bar at percent, followed by detail, such as the steps
+// done, and the time left estimated from the rate so far.
+func (b *ProgressBar) Update(percent int, detail string) {
+	now := Now()
+	if b.started.IsZero() {
+		b.started = now
+	}
+	if percent > 100 {
+		percent = 100
+	}
+	filled := progressBarWidth * percent / 100
+	line := fmt.Sprintf("[%s%s] %3d%%", strings.Repeat("#", filled), strings.Repeat("-", progressBarWidth-filled), percent)
+	if detail != "" {
+		line += " " + detail
+	}
+	if eta := b.eta(now, percent); eta != "" {
+		line += "  ETA " + eta
+	}
+	padding := ""
+	if len(line) < b.drawn {
+		padding = strings.Repeat(" ", b.drawn-len(line))
+	}
+	fmt.Fprintf(b.w, "\r%s%s", line, padding)
+	b.drawn = len(line)
+}
+
+func (b *ProgressBar) eta(now time.Time, percent int) string {
+	elapsed := now.Sub(b.started)
+	if percent <= 0 || percent >= 100 || elapsed <= 0 {
+		return ""
+	}
+	remaining := elapsed * time.Duration(100-percent) / time.Duration(percent)
+	return remaining.Round(time.Second).String()
+}
+
+// Finish ends the bar's line so other output starts on a fresh one.
+func (b *ProgressBar) Finish() {
+	if b.drawn > 0 {
+		fmt.Fprintln(b.w)
+		b.drawn = 0
+	}
+}
@@ -0,0 +1,32 @@
+package helpers
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestProgressBar(t *testing.T) {
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldNow := Now
+	Now = func() time.Time { return clock }
+	defer func() { Now = oldNow }()
+
+	var buf bytes.Buffer
+	bar := NewProgressBar(&buf)
+	bar.Update(0, "(0/4)")
+	clock = clock.Add(10 * time.Second)
+	bar.Update(25, "(1/4)")
+	clock = clock.Add(30 * time.Second)
+	bar.Update(100, "(4/4)")
+	bar.Finish()
+	bar.Finish()
+
+	expected := "\r[------------------------------]   0% (0/4)" +
+		"\r[#######-----------------------]  25% (1/4)  ETA 30s" +
+		"\r[##############################] 100% (4/4)         " +
+		"\n"
+	if buf.String() != expected {
+		t.Errorf("Unexpected bar output:\n%q\nwant:\n%q", buf.String(), expected)
+	}
+}
@@ -0,0 +1,69 @@
+package helpers
+
+import (
+	"net/url"
+	"strings"
+)
+
+// sensitiveParams are query parameters whose values Redact hides.
+var sensitiveParams = []string{"password", "passwd", "secret", "token", "apikey", "api_key", "key", "signature", "sig", "credential", "cookie", "authorization"}
+
+// Redact hides credentials in a value that is about to be shown or
+// recorded: the password of a URL's user info and the values of
+// sensitive query parameters. A value that does not parse as a URL but
+// has user info is cut down to what follows the "@".
+func Redact(value string) string {
+	u, err := url.Parse(value)
+	if err != nil {
+		if at := strings.LastIndex(value, "@"); at >= 0 {
+			return "***" + value[at:]
+		}
+		return value
+	}
+	changed := false
+	if u.RawQuery != "" {
+		query := u.Query()
+		for name := range query {
+			if SensitiveName(name) {
+				query.Set(name, "***")
+				changed = true
+			}
+		}
+		if changed {
+			u.RawQuery = query.Encode()
+		}
+	}
+	if _, hasPassword := u.User.Password(); !hasPassword && !changed {
+		return value
+	}
+	return u.Redacted()
+}
+
+// RedactFlag hides credentials in a flag value that is about to be
+// recorded: all of it for a flag named like a credential, such as
+// --password or --token, and what Redact hides otherwise. redacted tells
+// whether anything was hidden.
+func RedactFlag(name, value string) (string, bool) {
+	if SensitiveName(name) {
+		return "***", true
+	}
+	hidden := Redact(value)
+	return hidden, hidden != value
+}
+
+// SensitiveName reports whether a parameter, flag, header or field called
+// name holds a credential, such as password, api_key, X-Auth-Token or
+// idToken.
+func SensitiveName(name string) bool {
+	lower := strings.ToLower(name)
+	for _, sensitive := range sensitiveParams {
+		if lower == sensitive || strings.HasSuffix(lower, "_"+sensitive) || strings.HasSuffix(lower, "-"+sensitive) {
+			return true
+		}
+		// camelCase, e.g. accessToken or apiKey.
+		if strings.HasSuffix(name, strings.ToUpper(sensitive[:1])+sensitive[1:]) {
+			return true
+		}
+	}
+	return false
+}
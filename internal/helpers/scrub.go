@@ -0,0 +1,73 @@
+package helpers
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/spf13/viper"
+)
+
+// credentialStatements are the statements whose literals are scrubbed
+// before they are recorded. gsql.history_scrub adds more.
+// A continuation backslash at the end of a line counts as whitespace.
+var credentialStatements = []string{
+	`(?i)\b(create|alter|drop)(\s|\\\n)+user\b`,
+	`(?i)\b(create|alter)(\s|\\\n)+secret\b`,
+	`(?i)\b(set|alter)(\s|\\\n)+password\b`,
+	`(?i)\bpassword(\s|\\\n)*[=:]`,
+}
+
+// quotedLiteral matches a single- or double-quoted string.
+var quotedLiteral = regexp.MustCompile(`'(?:[^'\\]|\\.)*'|"(?:[^"\\]|\\.)*"`)
+
+// credentialValue matches an unquoted value after a password or token
+// keyword, e.g. the hunter2 in "PASSWORD = hunter2".
+var credentialValue = regexp.MustCompile(`(?i)(\b(?:password|token)(?:\s|\\\n)*(?:[=:](?:\s|\\\n)*)?)([^\s'";,()=:\\]+)`)
+
+// credentialKeywords may follow PASSWORD without being its value, as in
+// "SET PASSWORD TO '...'".
+var credentialKeywords = map[string]bool{"to": true, "with": true, "as": true}
+
+// ScrubPatterns compiles the credential statements and the patterns in
+// gsql.history_scrub. A pattern that does not compile is skipped and
+// reported in the returned errors.
+func ScrubPatterns() ([]*regexp.Regexp, []error) {
+	var patterns []*regexp.Regexp
+	var errs []error
+	for _, pattern := range append(credentialStatements, viper.GetStringSlice("gsql.history_scrub")...) {
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("ignoring gsql.history_scrub pattern %q: %v", pattern, err))
+			continue
+		}
+		patterns = append(patterns, re)
+	}
+	return patterns, errs
+}
+
+// ScrubStatement returns statement with its string literals and credential
+// values replaced by *** when it matches one of patterns. Other statements
+// are returned unchanged.
+func ScrubStatement(statement string, patterns []*regexp.Regexp) string {
+	matched := false
+	for _, pattern := range patterns {
+		if pattern.MatchString(statement) {
+			matched = true
+			break
+		}
+	}
+	if !matched {
+		return statement
+	}
+	statement = quotedLiteral.ReplaceAllStringFunc(statement, func(literal string) string {
+		return literal[:1] + "***" + literal[:1]
+	})
+	return credentialValue.ReplaceAllStringFunc(statement, func(match string) string {
+		parts := credentialValue.FindStringSubmatch(match)
+		if credentialKeywords[strings.ToLower(parts[2])] {
+			return match
+		}
+		return parts[1] + "***"
+	})
+}
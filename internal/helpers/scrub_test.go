@@ -0,0 +1,49 @@
+package helpers
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+func TestScrubStatement(t *testing.T) {
+	viper.Set("gsql.history_scrub", []string{`(?i)^\s*run\s+query\s+login\b`})
+	defer viper.Set("gsql.history_scrub", nil)
+	patterns, errs := ScrubPatterns()
+	if len(errs) != 0 {
+		t.Fatalf("Expected the patterns to compile, got %v", errs)
+	}
+	for _, tc := range []struct {
+		name      string
+		statement string
+		expected  string
+	}{
+		{"create user", "CREATE USER alice WITH PASSWORD 'hunter2'", "CREATE USER alice WITH PASSWORD '***'"},
+		{"alter user", `alter user bob password = "s3cr3t"`, `alter user bob password = "***"`},
+		{"unquoted", "ALTER USER bob PASSWORD = hunter2", "ALTER USER bob PASSWORD = ***"},
+		{"create secret", "CREATE SECRET s1 'abc123'", "CREATE SECRET s1 '***'"},
+		{"set password", "SET PASSWORD TO 'hunter2'", "SET PASSWORD TO '***'"},
+		{"escaped quote", `CREATE USER a PASSWORD 'it\'s'`, `CREATE USER a PASSWORD '***'`},
+		{"split lines", "CREATE USER alice\n  PASSWORD\n  'hunter2'", "CREATE USER alice\n  PASSWORD\n  '***'"},
+		{"continuation", "CREATE \\\nUSER alice \\\nPASSWORD hunter2", "CREATE \\\nUSER alice \\\nPASSWORD ***"},
+		{"configured", `RUN QUERY login("hunter2")`, `RUN QUERY login("***")`},
+		{"other statement", "SELECT * FROM Person WHERE name == 'password'", "SELECT * FROM Person WHERE name == 'password'"},
+		{"show users", "SHOW USER", "SHOW USER"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			if got := ScrubStatement(tc.statement, patterns); got != tc.expected {
+				t.Errorf("ScrubStatement(%q) = %q, want %q", tc.statement, got, tc.expected)
+			}
+		})
+	}
+}
+
+func TestScrubPatternsInvalid(t *testing.T) {
+	viper.Set("gsql.history_scrub", []string{"(unclosed"})
+	defer viper.Set("gsql.history_scrub", nil)
+	patterns, errs := ScrubPatterns()
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), `ignoring gsql.history_scrub pattern "(unclosed"`) || len(patterns) != len(credentialStatements) {
+		t.Errorf("Expected the bad pattern to be skipped, got %v and %d patterns", errs, len(patterns))
+	}
+}
@@ -0,0 +1,48 @@
+package helpers
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// TrashRetention is how long a deleted alias stays restorable.
+const TrashRetention = 30 * 24 * time.Hour
+
+// Now is the clock trash timestamps are taken from; tests replace it.
+var Now = time.Now
+
+// TrashedMachines returns the deleted aliases in the trash section.
+func TrashedMachines() map[string]models.TrashedMachine {
+	var trash map[string]models.TrashedMachine
+	if err := viper.UnmarshalKey("trash", &trash); err != nil || trash == nil {
+		return map[string]models.TrashedMachine{}
+	}
+	return trash
+}
+
+// TrashPurgeTime returns when a trashed alias is purged. ok is false when
+// its deletion time cannot be read, in which case it is never purged.
+func TrashPurgeTime(entry models.TrashedMachine) (time.Time, bool) {
+	deletedAt, err := time.Parse(time.RFC3339, entry.DeletedAt)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return deletedAt.Add(TrashRetention), true
+}
+
+// purgeTrash drops trashed aliases older than TrashRetention.
+func purgeTrash() {
+	trash := TrashedMachines()
+	purged := false
+	for alias, entry := range trash {
+		if purgeAt, ok := TrashPurgeTime(entry); ok && !Now().Before(purgeAt) {
+			delete(trash, alias)
+			purged = true
+		}
+	}
+	if purged {
+		viper.Set("trash", trash)
+	}
+}
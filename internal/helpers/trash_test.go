@@ -0,0 +1,43 @@
+package helpers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func TestPurgeTrash(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	clock := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	oldNow := Now
+	Now = func() time.Time { return clock }
+	defer func() { Now = oldNow }()
+
+	viper.Set("trash", map[string]models.TrashedMachine{
+		"old":     {DeletedAt: clock.Add(-TrashRetention).Format(time.RFC3339)},
+		"recent":  {DeletedAt: clock.Add(-TrashRetention + time.Minute).Format(time.RFC3339)},
+		"garbled": {DeletedAt: "yesterday"},
+	})
+	purgeTrash()
+
+	trash := TrashedMachines()
+	if _, ok := trash["old"]; ok {
+		t.Error("Entry deleted 30 days ago should be purged")
+	}
+	if _, ok := trash["recent"]; !ok {
+		t.Error("Entry younger than 30 days should be kept")
+	}
+	if _, ok := trash["garbled"]; !ok {
+		t.Error("Entry with an unreadable deletion time should be kept")
+	}
+
+	clock = clock.Add(time.Minute)
+	purgeTrash()
+	if _, ok := TrashedMachines()["recent"]; ok {
+		t.Error("Entry should be purged once it reaches 30 days")
+	}
+}
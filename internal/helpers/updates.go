@@ -0,0 +1,115 @@
+package helpers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// latestReleaseURL is where the latest release is looked up; tests point
+// it at a local server.
+var latestReleaseURL = "https://api.github.com/repos/zrougamed/tgCli/releases/latest"
+
+// updateCheckTTL is how long a looked-up release is reused before GitHub
+// is asked again, which keeps tg version well inside the API rate limit.
+const updateCheckTTL = 24 * time.Hour
+
+// failedCheckTTL is how long a failed lookup is remembered, so that tg
+// version offline waits for GitHub once an hour rather than on every run.
+const failedCheckTTL = time.Hour
+
+// updateCheck is the cache of the last lookup. Error is set instead of
+// Latest when the lookup failed.
+type updateCheck struct {
+	CheckedAt time.Time `json:"checkedAt"`
+	Latest    string    `json:"latest,omitempty"`
+	Error     string    `json:"error,omitempty"`
+}
+
+// CheckForUpdates returns the version there is to install: the latest
+// release, or the installed version when it is as new or newer, as for a
+// development build. It returns "N/A" when the latest release cannot be
+// looked up, such as offline.
+func CheckForUpdates() string {
+	latest, err := latestRelease()
+	if err != nil {
+		return "N/A"
+	}
+	if CompareVersions(latest, constants.VERSION_CLI) <= 0 {
+		return constants.VERSION_CLI
+	}
+	return latest
+}
+
+// latestRelease returns the version of the latest release, from the cache
+// in the config directory while it is fresh and from GitHub otherwise. A
+// failed lookup is cached too, for failedCheckTTL.
+func latestRelease() (string, error) {
+	if constants.ConfigDir == "" {
+		return fetchLatestRelease()
+	}
+	cacheFile := filepath.Join(constants.ConfigDir, "update-check.json")
+	var cached updateCheck
+	if data, err := os.ReadFile(cacheFile); err == nil && json.Unmarshal(data, &cached) == nil {
+		// A check dated in the future, from a clock that was wrong, is stale.
+		age := time.Since(cached.CheckedAt)
+		if cached.Latest != "" && age >= 0 && age < updateCheckTTL {
+			return cached.Latest, nil
+		}
+		if cached.Error != "" && age >= 0 && age < failedCheckTTL {
+			return "", fmt.Errorf("%s", cached.Error)
+		}
+	}
+
+	latest, err := fetchLatestRelease()
+	check := updateCheck{CheckedAt: time.Now(), Latest: latest}
+	if err != nil {
+		check.Error = err.Error()
+	}
+	// A cache that cannot be written only means asking again next time.
+	data, _ := json.Marshal(check)
+	os.WriteFile(cacheFile, data, 0600)
+	return latest, err
+}
+
+// fetchLatestRelease asks GitHub for the tag of the latest release and
+// returns it as a version number.
+func fetchLatestRelease() (string, error) {
+	req, err := http.NewRequest("GET", latestReleaseURL, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "tg/"+constants.VERSION_CLI)
+	resp, err := NewHTTPClient(5 * time.Second).Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("GET %s: status %d", latestReleaseURL, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return "", err
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.Unmarshal(data, &release); err != nil {
+		return "", fmt.Errorf("unexpected response from %s", latestReleaseURL)
+	}
+	version := strings.TrimPrefix(release.TagName, "v")
+	if version == "" || !unicode.IsDigit(rune(version[0])) {
+		return "", fmt.Errorf("the latest release has no version tag: %q", release.TagName)
+	}
+	return version, nil
+}
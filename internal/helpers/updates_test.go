@@ -0,0 +1,83 @@
+package helpers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// useReleaseServer answers the latest release lookup with tag, or fails it
+// when tag is empty, and counts the lookups.
+func useReleaseServer(t *testing.T, tag string) *int {
+	t.Helper()
+	lookups := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		lookups++
+		if tag == "" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]string{"tag_name": tag})
+	}))
+	t.Cleanup(server.Close)
+	originalURL, originalDir := latestReleaseURL, constants.ConfigDir
+	latestReleaseURL, constants.ConfigDir = server.URL, t.TempDir()
+	t.Cleanup(func() { latestReleaseURL, constants.ConfigDir = originalURL, originalDir })
+	return &lookups
+}
+
+func TestCheckForUpdates(t *testing.T) {
+	lookups := useReleaseServer(t, "v0.10.1")
+	if version := CheckForUpdates(); version != "0.10.1" {
+		t.Errorf("Expected the latest release, got %q", version)
+	}
+
+	// The release is cached for a day.
+	if version := CheckForUpdates(); version != "0.10.1" || *lookups != 1 {
+		t.Errorf("Expected the cached release without another lookup, got %q after %d lookups", version, *lookups)
+	}
+	cacheFile := filepath.Join(constants.ConfigDir, "update-check.json")
+	stale, _ := json.Marshal(updateCheck{CheckedAt: time.Now().Add(-25 * time.Hour), Latest: "0.9.0"})
+	os.WriteFile(cacheFile, stale, 0600)
+	if version := CheckForUpdates(); version != "0.10.1" || *lookups != 2 {
+		t.Errorf("Expected a stale cache to be looked up again, got %q after %d lookups", version, *lookups)
+	}
+}
+
+func TestCheckForUpdatesUpToDate(t *testing.T) {
+	useReleaseServer(t, "v0.1.0")
+	if version := CheckForUpdates(); version != constants.VERSION_CLI {
+		t.Errorf("Expected the installed version when it is as new, got %q", version)
+	}
+}
+
+func TestCheckForUpdatesUnavailable(t *testing.T) {
+	lookups := useReleaseServer(t, "")
+	if version := CheckForUpdates(); version != "N/A" {
+		t.Errorf("Expected N/A when the lookup fails, got %q", version)
+	}
+
+	// The failure is cached for an hour, so offline runs do not wait on
+	// GitHub every time.
+	if version := CheckForUpdates(); version != "N/A" || *lookups != 1 {
+		t.Errorf("Expected the cached failure without another lookup, got %q after %d lookups", version, *lookups)
+	}
+	cacheFile := filepath.Join(constants.ConfigDir, "update-check.json")
+	stale, _ := json.Marshal(updateCheck{CheckedAt: time.Now().Add(-2 * time.Hour), Error: "offline"})
+	os.WriteFile(cacheFile, stale, 0600)
+	if version := CheckForUpdates(); version != "N/A" || *lookups != 2 {
+		t.Errorf("Expected a stale failure to be looked up again, got %q after %d lookups", version, *lookups)
+	}
+
+	os.Remove(cacheFile)
+	latestReleaseURL = "http://127.0.0.1:1/releases/latest"
+	if version := CheckForUpdates(); version != "N/A" {
+		t.Errorf("Expected N/A when GitHub cannot be reached, got %q", version)
+	}
+}
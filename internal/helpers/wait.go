@@ -0,0 +1,25 @@
+package helpers
+
+import (
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+// DefaultMaxWait bounds every polling loop, whatever its --wait-timeout,
+// so a run nobody is watching any more stops eventually even if no signal
+// reaches it. max_wait in the config changes the bound.
+const DefaultMaxWait = 4 * time.Hour
+
+// MaxWait returns the bound on polling loops: max_wait, or DefaultMaxWait.
+func MaxWait() time.Duration {
+	if limit := viper.GetDuration("max_wait"); limit > 0 {
+		return limit
+	}
+	return DefaultMaxWait
+}
+
+// BoundWait caps a wait timeout at MaxWait.
+func BoundWait(timeout time.Duration) time.Duration {
+	return min(timeout, MaxWait())
+}
@@ -0,0 +1,91 @@
+package helpers
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/spf13/viper"
+)
+
+func TestBoundWait(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	if got := BoundWait(10 * time.Minute); got != 10*time.Minute {
+		t.Errorf("Expected a short wait to be kept, got %v", got)
+	}
+	if got := BoundWait(24 * time.Hour); got != DefaultMaxWait {
+		t.Errorf("Expected %v, got %v", DefaultMaxWait, got)
+	}
+
+	viper.Set("max_wait", "5m")
+	if got := BoundWait(10 * time.Minute); got != 5*time.Minute {
+		t.Errorf("Expected max_wait to cap the wait at 5m, got %v", got)
+	}
+}
+
+func TestGracefulShutdownExitCodes(t *testing.T) {
+	if os.Getenv("TG_TEST_SIGNAL_CHILD") != "" {
+		OnExit(func(code int) {
+			fmt.Printf("hook ran with %d after %v\n", code, StopSignal())
+		})
+		GracefulShutdown()
+		fmt.Println("ready")
+		time.Sleep(time.Minute)
+		Exit(0)
+	}
+	if runtime.GOOS == "windows" {
+		t.Skip("signals are not delivered this way on Windows")
+	}
+
+	for _, test := range []struct {
+		signal  syscall.Signal
+		code    int
+		goodbye bool
+	}{
+		{syscall.SIGHUP, 129, false},
+		{syscall.SIGINT, 130, true},
+		{syscall.SIGTERM, 143, true},
+	} {
+		t.Run(test.signal.String(), func(t *testing.T) {
+			child := exec.Command(os.Args[0], "-test.run=^TestGracefulShutdownExitCodes$")
+			child.Env = append(os.Environ(), "TG_TEST_SIGNAL_CHILD=1")
+			var stderr strings.Builder
+			child.Stderr = &stderr
+			stdout, _ := child.StdoutPipe()
+			if err := child.Start(); err != nil {
+				t.Fatalf("Failed to start the child: %v", err)
+			}
+			lines := bufio.NewScanner(stdout)
+			if !lines.Scan() || lines.Text() != "ready" {
+				child.Process.Kill()
+				t.Fatalf("Child did not get ready: %q", lines.Text())
+			}
+			child.Process.Signal(test.signal)
+
+			var output strings.Builder
+			for lines.Scan() {
+				output.WriteString(lines.Text() + "\n")
+			}
+			err := child.Wait()
+			var exitErr *exec.ExitError
+			if !errors.As(err, &exitErr) || exitErr.ExitCode() != test.code {
+				t.Errorf("Expected exit code %d, got %v", test.code, err)
+			}
+			if expected := fmt.Sprintf("hook ran with %d after %v\n", test.code, test.signal); output.String() != expected {
+				t.Errorf("Expected %q, got %q", expected, output.String())
+			}
+			if strings.Contains(stderr.String(), "Good Bye") != test.goodbye {
+				t.Errorf("Unexpected goodbye message state for %v: %q", test.signal, stderr.String())
+			}
+		})
+	}
+}
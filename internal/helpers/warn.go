@@ -0,0 +1,147 @@
+package helpers
+
+import (
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+)
+
+// ExitWarning is the exit code of a command that --strict stopped on a
+// warning.
+const ExitWarning = 4
+
+// Warning IDs. They are stable, since scripts name them in
+// --allow-warning; add new ones rather than renaming.
+const (
+	WarnDeprecatedFlag      = "deprecated-flag"
+	WarnAliasOverridesFlags = "alias-overrides-flags"
+	WarnCrossOriginRedirect = "cross-origin-redirect"
+	WarnClockSkew           = "clock-skew"
+	WarnUnreadableCreated   = "unreadable-creation-time"
+	WarnEnvAlias            = "env-alias"
+	WarnLocalConfig         = "local-config"
+	WarnSessionCache        = "session-cache"
+	WarnSessionState        = "session-state"
+	WarnHistory             = "history"
+	WarnCommandHistory      = "command-history"
+	WarnNoResultTables      = "no-result-tables"
+	WarnTraceDisabled       = "trace-disabled"
+	WarnInitFile            = "init-file"
+	WarnPluginShadowed      = "plugin-shadowed"
+	WarnConcurrentSession   = "concurrent-session"
+	WarnCapture             = "capture"
+	WarnConfigPassword      = "config-password"
+)
+
+// Warnings describes every warning ID, for --allow-warning and the docs.
+var Warnings = map[string]string{
+	WarnDeprecatedFlag:      "a deprecated flag form such as --flag y was used",
+	WarnAliasOverridesFlags: "connection flags were ignored because --alias sets them",
+	WarnCrossOriginRedirect: "a redirect to another host dropped the credentials",
+	WarnClockSkew:           "the system clock is too far from tgcloud's",
+	WarnUnreadableCreated:   "a solution was skipped for an unreadable creation time",
+	WarnEnvAlias:            "an alias defined in the environment is invalid",
+	WarnLocalConfig:         "a local TigerGraph config file could not be read",
+	WarnSessionCache:        "a GSQL session could not be cached",
+	WarnSessionState:        "GSQL session state could not be read or saved",
+	WarnHistory:             "GSQL history could not be written or a scrub pattern is invalid",
+	WarnCommandHistory:      "the command history of tg history could not be written",
+	WarnNoResultTables:      "a GSQL result held no tables to convert",
+	WarnTraceDisabled:       "--trace was given without an OTLP endpoint",
+	WarnInitFile:            "the GSQL init file could not be read or failed",
+	WarnPluginShadowed:      "a plugin has the name of a built-in command and never runs",
+	WarnConcurrentSession:   "another interactive GSQL session to the same alias is open",
+	WarnCapture:             "the --capture transcript of a GSQL session could not be written",
+	WarnConfigPassword:      "a password in the config could not be decrypted or encrypted",
+}
+
+// WarningIDs returns the IDs of Warnings, sorted.
+func WarningIDs() []string {
+	return slices.Sorted(maps.Keys(Warnings))
+}
+
+// warningOutput returns where warnings are written, stderr at the time of
+// the warning; warningExit ends a strict run. Both are replaced in tests.
+var (
+	warningOutput = func() io.Writer { return os.Stderr }
+	warningExit   = Exit
+)
+
+// warningPolicy is set by ConfigureWarnings. While held, warnings wait in
+// pending for it. Warn is called from worker goroutines, such as those of
+// tg cloud apply, so the policy is read and changed under its lock.
+var warningPolicy struct {
+	sync.Mutex
+	held    bool
+	strict  bool
+	allowed map[string]bool
+	pending [][2]string
+}
+
+// HoldWarnings keeps warnings back until ConfigureWarnings, so that those
+// issued before flags are parsed also follow --strict.
+func HoldWarnings() {
+	warningPolicy.Lock()
+	defer warningPolicy.Unlock()
+	warningPolicy.held = true
+}
+
+// ConfigureWarnings sets whether warnings stop the command, and which IDs
+// are allowed to pass anyway. Warnings held until now are issued. It
+// fails on an unknown ID.
+func ConfigureWarnings(strict bool, allowed []string) error {
+	allowedIDs := make(map[string]bool)
+	for _, id := range allowed {
+		id = strings.TrimSpace(id)
+		if _, ok := Warnings[id]; !ok {
+			return fmt.Errorf("unknown warning %q in --allow-warning (known: %s)", id, strings.Join(WarningIDs(), ", "))
+		}
+		allowedIDs[id] = true
+	}
+	warningPolicy.Lock()
+	warningPolicy.held = false
+	warningPolicy.strict = strict
+	warningPolicy.allowed = allowedIDs
+	pending := warningPolicy.pending
+	warningPolicy.pending = nil
+	warningPolicy.Unlock()
+
+	for _, warning := range pending {
+		issueWarning(warning[0], warning[1])
+	}
+	return nil
+}
+
+// Warn reports a condition the command can carry on from. The ID is shown
+// so it can be allowed under --strict, where any other warning ends the
+// command with ExitWarning.
+func Warn(id, format string, args ...interface{}) {
+	message := fmt.Sprintf(format, args...)
+	warningPolicy.Lock()
+	if warningPolicy.held {
+		warningPolicy.pending = append(warningPolicy.pending, [2]string{id, message})
+		warningPolicy.Unlock()
+		return
+	}
+	warningPolicy.Unlock()
+	issueWarning(id, message)
+}
+
+// issueWarning prints a warning, or ends a strict run. The lock is not held
+// while it does, since ending the run calls the exit handlers.
+func issueWarning(id, message string) {
+	warningPolicy.Lock()
+	fatal := warningPolicy.strict && !warningPolicy.allowed[id]
+	warningPolicy.Unlock()
+	if fatal {
+		fmt.Fprintf(warningOutput(), "Error: %s [%s]\n", message, id)
+		fmt.Fprintf(warningOutput(), "--strict turns warnings into errors; pass --allow-warning %s to accept this one\n", id)
+		warningExit(ExitWarning)
+		return
+	}
+	fmt.Fprintf(warningOutput(), "Warning: %s [%s]\n", message, id)
+}
@@ -0,0 +1,137 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// useWarningOutput captures warnings and strict exits, and restores the
+// default policy afterwards.
+func useWarningOutput(t *testing.T) *bytes.Buffer {
+	t.Helper()
+	var buf bytes.Buffer
+	originalOutput, originalExit := warningOutput, warningExit
+	warningOutput = func() io.Writer { return &buf }
+	warningExit = func(code int) { fmt.Fprintf(&buf, "exit %d\n", code) }
+	t.Cleanup(func() {
+		warningOutput, warningExit = originalOutput, originalExit
+		ConfigureWarnings(false, nil)
+	})
+	return &buf
+}
+
+func TestStrictWarnings(t *testing.T) {
+	crossOrigin := func() {
+		original, _ := http.NewRequest("GET", "http://db:14240/api", nil)
+		original.Header.Set("Authorization", "Bearer token")
+		elsewhere, _ := http.NewRequest("GET", "https://gateway:443/api", nil)
+		FollowRedirect(elsewhere, []*http.Request{original})
+	}
+	deprecated := func() { NormalizeLegacyBoolArgs([]string{"--default", "y"}) }
+
+	for _, test := range []struct {
+		name    string
+		id      string
+		trigger func()
+	}{
+		{"deprecated flag", WarnDeprecatedFlag, deprecated},
+		{"cross-origin redirect", WarnCrossOriginRedirect, crossOrigin},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			out := useWarningOutput(t)
+
+			ConfigureWarnings(false, nil)
+			test.trigger()
+			if !strings.HasPrefix(out.String(), "Warning: ") || !strings.HasSuffix(out.String(), "["+test.id+"]\n") {
+				t.Errorf("Expected a warning tagged %s, got %q", test.id, out)
+			}
+
+			out.Reset()
+			ConfigureWarnings(true, nil)
+			test.trigger()
+			if !strings.HasPrefix(out.String(), "Error: ") || !strings.Contains(out.String(), "--allow-warning "+test.id) || !strings.HasSuffix(out.String(), "exit 4\n") {
+				t.Errorf("Expected --strict to fail with exit code 4, got %q", out)
+			}
+
+			out.Reset()
+			if err := ConfigureWarnings(true, []string{WarnHistory, test.id}); err != nil {
+				t.Fatalf("ConfigureWarnings failed: %v", err)
+			}
+			test.trigger()
+			if !strings.HasPrefix(out.String(), "Warning: ") || strings.Contains(out.String(), "exit") {
+				t.Errorf("Expected an allowed warning to pass, got %q", out)
+			}
+		})
+	}
+}
+
+func TestHeldWarnings(t *testing.T) {
+	out := useWarningOutput(t)
+
+	HoldWarnings()
+	NormalizeLegacyBoolArgs([]string{"--default", "n"})
+	if out.Len() != 0 {
+		t.Fatalf("Expected the warning to be held, got %q", out)
+	}
+	ConfigureWarnings(true, nil)
+	if !strings.Contains(out.String(), "[deprecated-flag]") || !strings.HasSuffix(out.String(), "exit 4\n") {
+		t.Errorf("Expected the held warning to follow --strict, got %q", out)
+	}
+}
+
+func TestAllowUnknownWarning(t *testing.T) {
+	useWarningOutput(t)
+	if err := ConfigureWarnings(true, []string{"clock-skw"}); err == nil || !strings.Contains(err.Error(), "clock-skew") {
+		t.Errorf("Expected an unknown ID to be refused with the known ones, got %v", err)
+	}
+}
+
+// syncBuffer is a buffer warnings can be written to from several
+// goroutines.
+type syncBuffer struct {
+	mu  sync.Mutex
+	buf bytes.Buffer
+}
+
+func (b *syncBuffer) Write(p []byte) (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.buf.Write(p)
+}
+
+func TestConcurrentWarnings(t *testing.T) {
+	useWarningOutput(t)
+	var out syncBuffer
+	warningOutput = func() io.Writer { return &out }
+
+	// Workers warn while the policy is being set, as when tg cloud apply
+	// runs its actions in parallel.
+	HoldWarnings()
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			Warn(WarnClockSkew, "worker %d", i)
+		}(i)
+	}
+	ConfigureWarnings(false, nil)
+	wg.Wait()
+
+	if lines := strings.Count(out.buf.String(), "[clock-skew]\n"); lines != 20 {
+		t.Errorf("Expected 20 warnings, got %d:\n%s", lines, out.buf.String())
+	}
+}
+
+func TestWarningIDs(t *testing.T) {
+	ids := WarningIDs()
+	if len(ids) != len(Warnings) || !slices.IsSorted(ids) {
+		t.Errorf("Expected every warning ID, sorted, got %v", ids)
+	}
+}
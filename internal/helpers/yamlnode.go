@@ -0,0 +1,142 @@
+package helpers
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// mergeYAMLConfig applies desired, a full config document, onto existing,
+// the file as the user left it. Keys keep their order and spelling, values
+// that did not change keep their comments and style, new keys are appended
+// and keys missing from desired are removed. It fails when existing is not
+// a YAML mapping, in which case callers rewrite the file from scratch.
+func mergeYAMLConfig(existing, desired []byte) ([]byte, error) {
+	var current, wanted yaml.Node
+	if err := yaml.Unmarshal(existing, &current); err != nil {
+		return nil, err
+	}
+	if err := yaml.Unmarshal(desired, &wanted); err != nil {
+		return nil, err
+	}
+	if len(current.Content) == 0 || current.Content[0].Kind != yaml.MappingNode {
+		return nil, fmt.Errorf("config file is not a YAML mapping")
+	}
+	if len(wanted.Content) == 0 {
+		return nil, fmt.Errorf("nothing to write")
+	}
+
+	mergeYAMLNode(current.Content[0], wanted.Content[0])
+
+	var b bytes.Buffer
+	encoder := yaml.NewEncoder(&b)
+	encoder.SetIndent(yamlIndent(existing))
+	if err := encoder.Encode(&current); err != nil {
+		return nil, err
+	}
+	if err := encoder.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+// mergeYAMLNode updates current in place to hold the value of wanted.
+func mergeYAMLNode(current, wanted *yaml.Node) {
+	if current.Kind == yaml.MappingNode && wanted.Kind == yaml.MappingNode {
+		mergeYAMLMapping(current, wanted)
+		return
+	}
+	if sameYAMLValue(current, wanted) {
+		return
+	}
+	headComment, lineComment, footComment := current.HeadComment, current.LineComment, current.FootComment
+	*current = *wanted
+	current.HeadComment, current.LineComment, current.FootComment = headComment, lineComment, footComment
+}
+
+// mergeYAMLMapping merges two mapping nodes key by key. Keys are matched
+// exactly first and then ignoring case, since viper lowercases every key
+// it reads; the user's spelling is kept except for the canonical keys.
+func mergeYAMLMapping(current, wanted *yaml.Node) {
+	matched := make(map[int]bool)
+	var content []*yaml.Node
+	for i := 0; i+1 < len(current.Content); i += 2 {
+		key, value := current.Content[i], current.Content[i+1]
+		j := findYAMLKey(wanted, key.Value, matched)
+		if j < 0 {
+			// Removed; its comments go with it.
+			continue
+		}
+		matched[j] = true
+		if wantedKey := wanted.Content[j].Value; canonicalKeys[strings.ToLower(wantedKey)] == wantedKey {
+			// Known keys are written in their canonical spelling.
+			key.Value = wantedKey
+		}
+		mergeYAMLNode(value, wanted.Content[j+1])
+		content = append(content, key, value)
+	}
+	for j := 0; j+1 < len(wanted.Content); j += 2 {
+		if !matched[j] {
+			content = append(content, wanted.Content[j], wanted.Content[j+1])
+		}
+	}
+	if len(current.Content) == 0 && len(content) > 0 {
+		// An empty map is written as {}; once it has entries it is written
+		// in block style like the rest of the file.
+		current.Style &^= yaml.FlowStyle
+	}
+	current.Content = content
+}
+
+// findYAMLKey returns the index of key in mapping, ignoring keys already
+// matched, or -1.
+func findYAMLKey(mapping *yaml.Node, key string, matched map[int]bool) int {
+	fold := -1
+	for j := 0; j+1 < len(mapping.Content); j += 2 {
+		if matched[j] {
+			continue
+		}
+		candidate := mapping.Content[j].Value
+		if candidate == key {
+			return j
+		}
+		if fold < 0 && strings.EqualFold(candidate, key) {
+			fold = j
+		}
+	}
+	return fold
+}
+
+// sameYAMLValue reports whether two nodes hold the same data, whatever
+// their style or comments.
+func sameYAMLValue(a, b *yaml.Node) bool {
+	if a.Kind != b.Kind || len(a.Content) != len(b.Content) {
+		return false
+	}
+	if a.Kind == yaml.ScalarNode {
+		return a.ShortTag() == b.ShortTag() && a.Value == b.Value
+	}
+	for i := range a.Content {
+		if !sameYAMLValue(a.Content[i], b.Content[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// yamlIndent returns the indentation the file already uses for nested
+// keys, defaulting to the four spaces yaml.Marshal writes.
+func yamlIndent(data []byte) int {
+	for _, line := range strings.Split(string(data), "\n") {
+		trimmed := strings.TrimLeft(line, " ")
+		if trimmed == "" || trimmed == line || strings.HasPrefix(trimmed, "#") || strings.HasPrefix(trimmed, "- ") {
+			continue
+		}
+		if indent := len(line) - len(trimmed); indent >= 2 && indent <= 8 {
+			return indent
+		}
+	}
+	return 4
+}
@@ -0,0 +1,146 @@
+package helpers
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+func TestMergeYAMLConfig(t *testing.T) {
+	existing := `# top comment
+default: prod # inline
+machines:
+  # keep me
+  Prod:
+    host: http://prod
+    gsport: 14240
+  old:
+    host: http://old
+zzz: last
+`
+	desired := `configVersion: 1
+default: prod
+machines:
+  new:
+    host: http://new
+  prod:
+    host: https://prod
+    gsPort: 14240
+zzz: last
+`
+	merged, err := mergeYAMLConfig([]byte(existing), []byte(desired))
+	if err != nil {
+		t.Fatalf("mergeYAMLConfig failed: %v", err)
+	}
+
+	expected := `# top comment
+default: prod # inline
+machines:
+  # keep me
+  Prod:
+    host: https://prod
+    gsPort: 14240
+  new:
+    host: http://new
+zzz: last
+configVersion: 1
+`
+	if string(merged) != expected {
+		t.Errorf("Unexpected merge:\n%s\nexpected:\n%s", merged, expected)
+	}
+}
+
+func TestMergeYAMLConfigKeepsComments(t *testing.T) {
+	existing := "machines:\n    prod:\n        host: http://prod # primary\n"
+	desired := "machines:\n    prod:\n        host: http://other\n"
+	merged, err := mergeYAMLConfig([]byte(existing), []byte(desired))
+	if err != nil {
+		t.Fatalf("mergeYAMLConfig failed: %v", err)
+	}
+	if string(merged) != "machines:\n    prod:\n        host: http://other # primary\n" {
+		t.Errorf("Expected the changed value to keep its comment and indentation, got:\n%s", merged)
+	}
+}
+
+func TestMergeYAMLConfigRejectsNonMapping(t *testing.T) {
+	for _, existing := range []string{"", "- a\n- b\n", "key: [unclosed\n"} {
+		if _, err := mergeYAMLConfig([]byte(existing), []byte("default: prod\n")); err == nil {
+			t.Errorf("Expected %q to be rejected", existing)
+		}
+	}
+}
+
+func TestSaveConfigKeepsComments(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	content := "# my tgcli config\ndefault: prod\nmachines:\n  # production\n  prod:\n    host: http://prod\n"
+	if err := os.WriteFile(configFile, []byte(content), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatalf("Failed to read config: %v", err)
+	}
+	viper.Set("default", "dev")
+	if err := SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(configFile)
+	expected := "# my tgcli config\ndefault: dev\nmachines:\n  # production\n  prod:\n    host: http://prod\n"
+	if string(data) != expected {
+		t.Errorf("Unexpected config:\n%s\nexpected:\n%s", data, expected)
+	}
+
+	// A file that is not a YAML mapping is rewritten from scratch.
+	if err := os.WriteFile(configFile, []byte("- not a mapping\n"), 0600); err != nil {
+		t.Fatalf("Failed to write config: %v", err)
+	}
+	if err := SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+	if data, _ := os.ReadFile(configFile); !strings.Contains(string(data), "default: dev") {
+		t.Errorf("Expected a full rewrite, got:\n%s", data)
+	}
+}
+
+func TestSaveConfigAddsMachineToNewConfig(t *testing.T) {
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	useCredsFile(t)
+	viper.Reset()
+	defer viper.Reset()
+	viper.SetConfigFile(configFile)
+	if err := CreateDefaultConfig(configFile); err != nil {
+		t.Fatalf("CreateDefaultConfig failed: %v", err)
+	}
+
+	// As tg conf add -a prod does: the empty machines map gets an entry.
+	viper.Set("machines.prod", models.MachineConfig{Host: "http://prod", User: "tigergraph", GSPort: "14240", RestPort: "9000"})
+	if err := SaveConfig(); err != nil {
+		t.Fatalf("SaveConfig failed: %v", err)
+	}
+
+	data, _ := os.ReadFile(configFile)
+	expected := `configVersion: 1
+default: ""
+machines:
+    prod:
+        host: http://prod
+        user: tigergraph
+        password: ""
+        gsPort: "14240"
+        restPort: "9000"
+tgcloud:
+    user: mail@domain.com
+    password: ""
+`
+	if string(data) != expected {
+		t.Errorf("Unexpected config:\n%s\nexpected:\n%s", data, expected)
+	}
+}
@@ -0,0 +1,285 @@
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// confirmInput is where rerun reads its confirmation from.
+var confirmInput io.Reader = os.Stdin
+
+// runCommand runs tg with args and returns its exit code; tests replace it.
+var runCommand = func(args []string) (int, error) {
+	executable, err := os.Executable()
+	if err != nil {
+		return 0, err
+	}
+	child := exec.Command(executable, args...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, helpers.Stdout(), os.Stderr
+	err = child.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		return exitErr.ExitCode(), nil
+	}
+	return 0, err
+}
+
+// filter keeps the entries against alias, ignoring case, and those
+// recorded at or after since. An empty alias or zero since keeps all.
+func filter(entries []Entry, alias string, since time.Time) []Entry {
+	var kept []Entry
+	for _, entry := range entries {
+		if alias != "" && !strings.EqualFold(entry.Alias, alias) {
+			continue
+		}
+		if !since.IsZero() && entry.Time.Before(since) {
+			continue
+		}
+		kept = append(kept, entry)
+	}
+	return kept
+}
+
+// resolve finds the entry ref names: its number, or "last" for the newest.
+func resolve(entries []Entry, ref string) (Entry, error) {
+	if len(entries) == 0 {
+		return Entry{}, fmt.Errorf("the history is empty")
+	}
+	if ref == "last" {
+		return entries[len(entries)-1], nil
+	}
+	n, err := strconv.Atoi(strings.TrimPrefix(ref, "#"))
+	if err != nil || n < 1 {
+		return Entry{}, fmt.Errorf("invalid history entry %q (expected a number from tg history list, or last)", ref)
+	}
+	for _, entry := range entries {
+		if entry.N == n {
+			return entry, nil
+		}
+	}
+	if n < entries[0].N {
+		return Entry{}, fmt.Errorf("entry %d has been pruned; the oldest kept is %d", n, entries[0].N)
+	}
+	return Entry{}, fmt.Errorf("no history entry %d; the newest is %d", n, entries[len(entries)-1].N)
+}
+
+// rerunArgs returns the arguments to run entry again with, extra added at
+// the end. Flags whose values were not stored are left out, and must be
+// among extra.
+func rerunArgs(entry Entry, extra []string) ([]string, error) {
+	if len(entry.Redacted) > 0 && len(extra) == 0 {
+		flags := make([]string, len(entry.Redacted))
+		for i, name := range entry.Redacted {
+			flags[i] = "--" + name
+		}
+		return nil, fmt.Errorf("the value of %s was not stored; pass it again after --, e.g. tg history rerun %d -- %s ...",
+			strings.Join(flags, ", "), entry.N, flags[0])
+	}
+	redacted := make(map[string]bool)
+	for _, name := range entry.Redacted {
+		redacted[name] = true
+	}
+	var args []string
+	for _, arg := range entry.Args {
+		if arg == "--" {
+			break
+		}
+		name, _, _ := strings.Cut(strings.TrimPrefix(arg, "--"), "=")
+		if strings.HasPrefix(arg, "--") && redacted[name] {
+			continue
+		}
+		args = append(args, arg)
+	}
+	args = append(args, extra...)
+	if positional := positionalArgs(entry.Args); len(positional) > 0 {
+		args = append(append(args, "--"), positional...)
+	}
+	return args, nil
+}
+
+// positionalArgs returns the args of an invocation that follow "--".
+func positionalArgs(argv []string) []string {
+	for i, arg := range argv {
+		if arg == "--" {
+			return argv[i+1:]
+		}
+	}
+	return nil
+}
+
+// shownArgs returns args with the credentials among them hidden, for
+// echoing a command that is about to run.
+func shownArgs(args []string) []string {
+	patterns, _ := helpers.ScrubPatterns()
+	shown := make([]string, len(args))
+	for i, arg := range args {
+		if name, value, ok := strings.Cut(arg, "="); ok && strings.HasPrefix(name, "--") {
+			value, _ = scrubValue(strings.TrimPrefix(name, "--"), value, patterns)
+			shown[i] = name + "=" + value
+			continue
+		}
+		shown[i] = helpers.ScrubStatement(arg, patterns)
+	}
+	return shown
+}
+
+// commandLine renders args as a tg command line to paste into a shell.
+func commandLine(args []string) string {
+	quoted := []string{"tg"}
+	for _, arg := range args {
+		quoted = append(quoted, shellQuote(arg))
+	}
+	return strings.Join(quoted, " ")
+}
+
+func shellQuote(arg string) string {
+	if arg != "" && !strings.ContainsAny(arg, " \t\n'\"\\$`*?[]{}()<>|&;#~!") {
+		return arg
+	}
+	return "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+}
+
+// formatList renders entries as a table, oldest first.
+func formatList(entries []Entry) string {
+	if len(entries) == 0 {
+		return "No commands recorded\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%5s  %-16s  %-12s  %4s  %s\n", "#", "WHEN", "ALIAS", "EXIT", "COMMAND")
+	for _, entry := range entries {
+		alias := entry.Alias
+		if alias == "" {
+			alias = "-"
+		}
+		fmt.Fprintf(&b, "%5d  %-16s  %-12s  %4d  %s\n", entry.N, entry.Time.Local().Format("2006-01-02 15:04"), alias, entry.Exit, commandLine(entry.Args))
+	}
+	return b.String()
+}
+
+// formatEntry renders one entry in full.
+func formatEntry(entry Entry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "#%d  %s\n", entry.N, entry.Time.Local().Format(time.RFC3339))
+	fmt.Fprintf(&b, "  %s\n", commandLine(entry.Args))
+	if entry.Alias != "" {
+		fmt.Fprintf(&b, "Alias:       %s\n", entry.Alias)
+	}
+	if entry.ID != "" {
+		fmt.Fprintf(&b, "ID:          %s\n", entry.ID)
+	}
+	fmt.Fprintf(&b, "Exit status: %d\n", entry.Exit)
+	if len(entry.Redacted) > 0 {
+		fmt.Fprintf(&b, "Not stored:  --%s\n", strings.Join(entry.Redacted, ", --"))
+	}
+	return b.String()
+}
+
+// loadOrFail loads the history, or reports why it cannot and sets the
+// exit code.
+func loadOrFail() ([]Entry, bool) {
+	entries, err := load()
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: reading the command history: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return nil, false
+	}
+	return entries, true
+}
+
+func RunList(cmd *cobra.Command, args []string) {
+	alias, _ := cmd.Flags().GetString("alias")
+	sinceFlag, _ := cmd.Flags().GetString("since")
+	output := helpers.OutputFormat(cmd)
+
+	var since time.Time
+	if sinceFlag != "" {
+		age, err := helpers.ParseAge(sinceFlag)
+		if err != nil {
+			fmt.Fprintf(helpers.Stdout(), "Error: --since: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		since = helpers.Now().Add(-age)
+	}
+
+	loaded, ok := loadOrFail()
+	if !ok {
+		return
+	}
+	entries := filter(loaded, alias, since)
+	if output == "json" {
+		encoded, _ := json.Marshal(append([]Entry{}, entries...))
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(encoded)))
+		return
+	}
+	fmt.Fprint(helpers.Stdout(), formatList(entries))
+}
+
+func RunShow(cmd *cobra.Command, args []string) {
+	entries, ok := loadOrFail()
+	if !ok {
+		return
+	}
+	entry, err := resolve(entries, args[0])
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if helpers.OutputFormat(cmd) == "json" {
+		encoded, _ := json.Marshal(entry)
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(encoded)))
+		return
+	}
+	fmt.Fprint(helpers.Stdout(), formatEntry(entry))
+}
+
+// RunRerun runs a recorded command again after confirmation, and exits
+// with its exit code. Arguments after the entry number are added to it.
+func RunRerun(cmd *cobra.Command, args []string) {
+	yes, _ := cmd.Flags().GetBool("yes")
+	entries, ok := loadOrFail()
+	if !ok {
+		return
+	}
+	entry, err := resolve(entries, args[0])
+	if err == nil {
+		args, err = rerunArgs(entry, args[1:])
+	}
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	fmt.Println(commandLine(shownArgs(args)))
+	if !yes {
+		fmt.Print("Run it again? (y/n) [n] ")
+		answer, _ := bufio.NewReader(confirmInput).ReadString('\n')
+		if ok, _ := helpers.ParseYesNo(answer); !ok {
+			fmt.Fprintln(helpers.Stdout(), "Rerun cancelled")
+			helpers.Fail(helpers.ExitCancelled)
+			return
+		}
+	}
+	code, err := runCommand(args)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if code != 0 {
+		helpers.Fail(code)
+	}
+}
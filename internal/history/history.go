@@ -0,0 +1,259 @@
+// Package history remembers the commands tg has run, so that "what did I
+// run against prod last month?" has an answer and the command can be run
+// again.
+//
+// Every finished command is appended to historyFile, ~/.tgcli/history.jsonl
+// by default, as one JSON object per line. Entries are numbered in the
+// order they were recorded, and keep their number once older ones are
+// pruned. Once the file holds more than history.size entries
+// (defaultSize) the oldest are dropped; history.enabled: false in the
+// config stops recording. Values of flags named like credentials, such as
+// --password and --token, passwords in URLs and the literals of credential
+// statements, such as a --command that runs ALTER USER, are never written.
+package history
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+var historyFile string
+
+const defaultSize = 1000
+
+// unrecorded are the commands, by their first word after tg, that are not
+// worth recording: reading the history itself, help and documentation,
+// and tg debug, whose command records itself when it runs.
+var unrecorded = map[string]bool{
+	"history": true, "help": true, "completion": true, "__complete": true, "__completeNoDesc": true,
+	"examples": true, "docs": true, "version": true, "debug": true,
+}
+
+// Entry is one recorded command.
+type Entry struct {
+	N       int       `json:"n"`
+	Time    time.Time `json:"time"`
+	Command string    `json:"command"`
+	// Args is the invocation after "tg", flags in their long form.
+	Args  []string `json:"args"`
+	Alias string   `json:"alias,omitempty"`
+	ID    string   `json:"id,omitempty"`
+	Exit  int      `json:"exit"`
+	// Redacted names the flags whose values were not stored.
+	Redacted []string `json:"redacted,omitempty"`
+}
+
+func historyPath() string {
+	if historyFile != "" {
+		return historyFile
+	}
+	return filepath.Join(constants.ConfigDir, "history.jsonl")
+}
+
+// enabled reports whether commands are recorded.
+func enabled() bool {
+	return !viper.IsSet("history.enabled") || viper.GetBool("history.enabled")
+}
+
+// size returns how many entries are kept.
+func size() int {
+	if viper.IsSet("history.size") {
+		return viper.GetInt("history.size")
+	}
+	return defaultSize
+}
+
+// Recorder records one command when it ends.
+type Recorder struct {
+	entry Entry
+	done  bool
+}
+
+// Begin starts recording cmd, run with the positional args, and returns
+// nil for a command that is not recorded. The entry is written by Finish,
+// which helpers.Exit also calls with its exit code.
+func Begin(cmd *cobra.Command, args []string) *Recorder {
+	path := strings.Fields(cmd.CommandPath())[1:]
+	// Commands that parse their own flags, such as plugins, are not
+	// recorded: tg cannot tell which of their arguments are credentials.
+	if !enabled() || size() <= 0 || len(path) == 0 || unrecorded[path[0]] || isInteractive(cmd) || cmd.DisableFlagParsing {
+		return nil
+	}
+	argv, redacted := Invocation(cmd, args)
+	r := &Recorder{entry: Entry{
+		Time:     helpers.Now().UTC(),
+		Command:  strings.Join(path, " "),
+		Args:     argv,
+		Alias:    flagValue(cmd, "alias"),
+		ID:       flagValue(cmd, "id"),
+		Redacted: redacted,
+	}}
+	helpers.OnExit(r.Finish)
+	return r
+}
+
+// isInteractive reports whether cmd is a GSQL terminal session rather
+// than a command that runs and exits.
+func isInteractive(cmd *cobra.Command) bool {
+	if cmd.CommandPath() != "tg server gsql" {
+		return false
+	}
+	return !cmd.Flags().Changed("command") && !cmd.Flags().Changed("file")
+}
+
+func flagValue(cmd *cobra.Command, name string) string {
+	if flag := cmd.Flags().Lookup(name); flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	return ""
+}
+
+// Finish writes the entry with the command's exit code. Only the first
+// call does anything. A history that cannot be written is a warning.
+func (r *Recorder) Finish(code int) {
+	if r == nil || r.done {
+		return
+	}
+	r.done = true
+	r.entry.Exit = code
+	if err := appendEntry(r.entry); err != nil {
+		helpers.Warn(helpers.WarnCommandHistory, "could not write the command history: %v", err)
+	}
+}
+
+// Invocation rebuilds the arguments of cmd after "tg": its path, the
+// flags given, in their long form and sorted, and the positional args.
+// Credentials are replaced by *** and their flags returned as redacted.
+func Invocation(cmd *cobra.Command, args []string) (argv, redacted []string) {
+	argv = strings.Fields(cmd.CommandPath())[1:]
+	patterns, _ := helpers.ScrubPatterns()
+	cmd.Flags().Visit(func(flag *pflag.Flag) {
+		values := []string{flag.Value.String()}
+		if slice, ok := flag.Value.(pflag.SliceValue); ok {
+			values = slice.GetSlice()
+		}
+		hidden := false
+		for _, value := range values {
+			if flag.Value.Type() == "bool" && value == "true" {
+				argv = append(argv, "--"+flag.Name)
+				continue
+			}
+			value, wasHidden := scrubValue(flag.Name, value, patterns)
+			hidden = hidden || wasHidden
+			argv = append(argv, "--"+flag.Name+"="+value)
+		}
+		if hidden {
+			redacted = append(redacted, flag.Name)
+		}
+	})
+	for _, arg := range args {
+		if strings.HasPrefix(arg, "-") {
+			argv = append(argv, "--")
+			break
+		}
+	}
+	return append(argv, args...), redacted
+}
+
+// scrubValue hides the credentials in a flag value: those RedactFlag
+// finds, and the literals of a credential statement, such as the password
+// in --command "ALTER USER bob PASSWORD 'hunter2'".
+func scrubValue(name, value string, patterns []*regexp.Regexp) (string, bool) {
+	if hidden, ok := helpers.RedactFlag(name, value); ok {
+		return hidden, true
+	}
+	scrubbed := helpers.ScrubStatement(value, patterns)
+	return scrubbed, scrubbed != value
+}
+
+// load returns the recorded entries, oldest first. Lines that cannot be
+// read are skipped.
+func load() ([]Entry, error) {
+	data, err := os.ReadFile(historyPath())
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []Entry
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	scanner.Buffer(nil, 1<<20)
+	for scanner.Scan() {
+		var entry Entry
+		if json.Unmarshal(scanner.Bytes(), &entry) == nil && entry.N > 0 {
+			entries = append(entries, entry)
+		}
+	}
+	return entries, scanner.Err()
+}
+
+// appendEntry numbers entry after the last one and adds it. When the
+// history is over its size, it is rewritten with only the newest entries.
+func appendEntry(entry Entry) error {
+	entries, err := load()
+	if err != nil {
+		return err
+	}
+	entry.N = 1
+	if len(entries) > 0 {
+		entry.N = entries[len(entries)-1].N + 1
+	}
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	if entries = append(entries, entry); len(entries) > size() {
+		return writeEntries(prune(entries, size()))
+	}
+	if err := os.MkdirAll(filepath.Dir(historyPath()), 0700); err != nil {
+		return err
+	}
+	// A single appended line is not interleaved with one written by a
+	// concurrent run.
+	file, err := os.OpenFile(historyPath(), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// prune keeps the newest keep entries.
+func prune(entries []Entry, keep int) []Entry {
+	if len(entries) <= keep {
+		return entries
+	}
+	return entries[len(entries)-keep:]
+}
+
+// writeEntries replaces the history with entries, atomically so a
+// concurrent reader never sees half of it.
+func writeEntries(entries []Entry) error {
+	var b bytes.Buffer
+	for _, entry := range entries {
+		line, err := json.Marshal(entry)
+		if err != nil {
+			return err
+		}
+		b.Write(append(line, '\n'))
+	}
+	return helpers.WriteFileAtomic(historyPath(), b.Bytes(), 0600)
+}
@@ -1,23 +1,44 @@
 package models
 
+import "time"
+
 // Config represents the application configuration
 type Config struct {
-	TGCloud  TGCloudConfig            `mapstructure:"tgcloud"`
-	Machines map[string]MachineConfig `mapstructure:"machines"`
-	Default  string                   `mapstructure:"default"`
+	ConfigVersion  int                       `mapstructure:"configVersion" yaml:"configVersion"`
+	TGCloud        TGCloudConfig             `mapstructure:"tgcloud" yaml:"tgcloud"`
+	Machines       map[string]MachineConfig  `mapstructure:"machines" yaml:"machines"`
+	Default        string                    `mapstructure:"default" yaml:"default"`
+	Contexts       map[string]Context        `mapstructure:"contexts" yaml:"contexts,omitempty"`
+	CurrentContext string                    `mapstructure:"currentContext" yaml:"currentContext,omitempty"`
+	Trash          map[string]TrashedMachine `mapstructure:"trash" yaml:"trash,omitempty"`
+}
+
+// Context bundles the settings used together when working against one
+// environment. Empty fields fall back to the top-level settings.
+type Context struct {
+	Profile      string `mapstructure:"profile" yaml:"profile,omitempty"`
+	DefaultAlias string `mapstructure:"defaultAlias" yaml:"defaultAlias,omitempty"`
+	Output       string `mapstructure:"output" yaml:"output,omitempty"`
 }
 
 type TGCloudConfig struct {
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
+	User     string `mapstructure:"user" yaml:"user"`
+	Password string `mapstructure:"password" yaml:"password"`
 }
 
 type MachineConfig struct {
-	Host     string `mapstructure:"host"`
-	User     string `mapstructure:"user"`
-	Password string `mapstructure:"password"`
-	GSPort   string `mapstructure:"gsPort"`
-	RestPort string `mapstructure:"restPort"`
+	Host     string `mapstructure:"host" yaml:"host"`
+	User     string `mapstructure:"user" yaml:"user"`
+	Password string `mapstructure:"password" yaml:"password"`
+	GSPort   string `mapstructure:"gsPort" yaml:"gsPort"`
+	RestPort string `mapstructure:"restPort" yaml:"restPort"`
+}
+
+// TrashedMachine is a deleted alias, kept in the trash section of the
+// config until it is restored or purged. DeletedAt is RFC 3339.
+type TrashedMachine struct {
+	MachineConfig `mapstructure:",squash" yaml:",inline"`
+	DeletedAt     string `mapstructure:"deletedAt" yaml:"deletedAt"`
 }
 
 // GSQLCookie represents GSQL session cookies
@@ -39,6 +60,36 @@ type TGCloudResponse struct {
 	Token   string      `json:"token,omitempty"`
 }
 
+// Credentials is the envelope stored in creds.bank. Endpoint records the
+// tgcloud base URL the token was issued for. Key is the base64 AES key the
+// passwords in the config file are encrypted with; it outlives the token.
+// ObtainedAt is the local time a login obtained the token; imported tokens
+// have none.
+type Credentials struct {
+	Token      string     `json:"token"`
+	Endpoint   string     `json:"endpoint"`
+	Key        string     `json:"key,omitempty"`
+	ObtainedAt *time.Time `json:"obtainedAt,omitempty"`
+}
+
+// Token statuses
+const (
+	TokenMissing       = "missing"
+	TokenValid         = "valid"
+	TokenExpired       = "expired"
+	TokenOtherEndpoint = "other-endpoint"
+	TokenUnknown       = "unknown"
+)
+
+// TokenStatus describes the stored tgcloud token. It never holds the token
+// itself.
+type TokenStatus struct {
+	Status    string     `json:"status"`
+	Endpoint  string     `json:"endpoint,omitempty"`
+	ExpiresAt *time.Time `json:"expiresAt,omitempty"`
+	Detail    string     `json:"detail,omitempty"`
+}
+
 // Machine represents a TigerGraph Cloud instance
 type Machine struct {
 	ID        string `json:"ID"`
@@ -47,3 +98,17 @@ type Machine struct {
 	State     string `json:"State"`
 	CreatedAt string `json:"CreatedAt"`
 }
+
+// Check result statuses
+const (
+	CheckPass = "pass"
+	CheckWarn = "warn"
+	CheckFail = "fail"
+)
+
+// CheckResult is the outcome of one health check
+type CheckResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Detail string `json:"detail"`
+}
@@ -377,3 +377,17 @@ func TestEmptyStructs(t *testing.T) {
 		t.Error("Empty Machine should have empty ID")
 	}
 }
+
+func TestCheckResultJSON(t *testing.T) {
+	result := CheckResult{Name: "unreachable-host", Status: CheckFail, Detail: "connection refused"}
+
+	data, err := json.Marshal(result)
+	if err != nil {
+		t.Fatalf("Failed to marshal CheckResult: %v", err)
+	}
+
+	expected := `{"name":"unreachable-host","status":"fail","detail":"connection refused"}`
+	if string(data) != expected {
+		t.Errorf("Expected %s, got %s", expected, string(data))
+	}
+}
@@ -0,0 +1,102 @@
+package outputtest
+
+import "github.com/zrougamed/tgCli/internal/models"
+
+// Machines returns the canonical tgcloud solutions: one per state the
+// renderers treat differently, plus a name too long for its column.
+func Machines() []models.Machine {
+	return []models.Machine{
+		{ID: "a1b2c3d4-0000-1111-2222-333344445555", Name: "production", Tag: "enterprise", State: "ready", CreatedAt: "2024-01-15T10:30:00Z"},
+		{ID: "b2c3d4e5-0000-1111-2222-333344445555", Name: "staging-cluster-with-a-long-name", Tag: "starter", State: "stopped", CreatedAt: "2024-02-01T08:00:00Z"},
+		{ID: "c3d4e5f6-0000-1111-2222-333344445555", Name: "cold-storage", Tag: "enterprise", State: "archived", CreatedAt: "2023-11-30T23:59:59Z"},
+		{ID: "d4e5f6a7-0000-1111-2222-333344445555", Name: "old", Tag: "free", State: "terminated", CreatedAt: "2023-06-01T00:00:00Z"},
+	}
+}
+
+// Config returns the canonical configuration with a tgcloud account, a
+// default alias and aliases whose names sort differently from insertion.
+func Config() models.Config {
+	return models.Config{
+		ConfigVersion: 1,
+		TGCloud:       models.TGCloudConfig{User: "user@example.com", Password: "s3cretpass"},
+		Machines: map[string]models.MachineConfig{
+			"prod": {Host: "https://prod.i.tgcloud.io", User: "admin", Password: "prodpass", GSPort: "14240", RestPort: "9000"},
+			"dev":  {Host: "http://127.0.0.1", User: "tigergraph", Password: "tg", GSPort: "14240", RestPort: "9000"},
+		},
+		Default: "prod",
+	}
+}
+
+// LoginToken is the canonical bearer token returned by a tgcloud login.
+const LoginToken = "eyJhbGciOiJIUzI1NiJ9.test.signature"
+
+// SolutionListResponse is a GET /solution response for the Machines
+// fixtures. It is synthetic, written by hand rather than recorded from
+// tgcloud: the detail fields and credentials next to the listed ones are
+// stand-ins for what the API may include, so the export can be tested
+// against fields it has to drop.
+const SolutionListResponse = `{
+  "Error": false,
+  "Message": "",
+  "Result": [
+    {
+      "ID": "a1b2c3d4-0000-1111-2222-333344445555",
+      "Name": "production",
+      "Tag": "enterprise",
+      "State": "ready",
+      "CreatedAt": "2024-01-15T10:30:00Z",
+      "Region": "us-east-1",
+      "CloudProvider": "AWS",
+      "InstanceType": "TG.C8.M64",
+      "DiskSize": 100,
+      "Version": "3.9.3",
+      "Domain": "production.i.tgcloud.io",
+      "Settings": {"HighAvailability": true, "Replicas": 2, "AdminPassword": "s3cret", "Backup": {"Enabled": true, "Schedule": "0 2 * * *", "AccessToken": "bk_abc"}},
+      "Tags": ["billing:core", "team:graph"],
+      "InitialPassword": "hunter2"
+    },
+    {
+      "ID": "b2c3d4e5-0000-1111-2222-333344445555",
+      "Name": "staging-cluster-with-a-long-name",
+      "Tag": "starter",
+      "State": "stopped",
+      "CreatedAt": "2024-02-01T08:00:00Z",
+      "Region": "us-west-2",
+      "CloudProvider": "AWS",
+      "InstanceType": "TG.C4.M32",
+      "DiskSize": 50,
+      "Version": "3.9.1",
+      "Domain": "staging.i.tgcloud.io",
+      "Settings": {"HighAvailability": false, "Replicas": 1},
+      "Tags": []
+    },
+    {
+      "ID": "c3d4e5f6-0000-1111-2222-333344445555",
+      "Name": "cold-storage",
+      "Tag": "enterprise",
+      "State": "archived",
+      "CreatedAt": "2023-11-30T23:59:59Z",
+      "Region": "eu-west-1",
+      "CloudProvider": "GCP",
+      "InstanceType": "TG.C8.M64",
+      "DiskSize": 500,
+      "Version": "3.6.0",
+      "Domain": "cold-storage.i.tgcloud.io",
+      "Settings": {"HighAvailability": false, "Replicas": 1},
+      "Tags": null
+    },
+    {
+      "ID": "d4e5f6a7-0000-1111-2222-333344445555",
+      "Name": "old",
+      "Tag": "free",
+      "State": "terminated",
+      "CreatedAt": "2023-06-01T00:00:00Z",
+      "Region": "us-east-1",
+      "CloudProvider": "AWS",
+      "InstanceType": "TG.FREE",
+      "DiskSize": 10,
+      "Version": "3.5.0",
+      "Domain": "old.i.tgcloud.io"
+    }
+  ]
+}`
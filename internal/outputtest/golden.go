@@ -0,0 +1,51 @@
+// Package outputtest holds the golden-file harness for rendered command
+// output and the canonical fixtures every formatter is tested against. It
+// is for tests only; nothing outside _test.go files imports it.
+//
+// Formatters are pure functions over data; their tests render the fixtures
+// and compare the bytes with testdata/<name>.golden in this directory. Run
+//
+//	make test-update-golden
+//
+// (or UPDATE_GOLDEN=1 go test on the packages using the harness) to rewrite
+// the golden files after an intended change, and review the diff.
+package outputtest
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+// update rewrites the golden files instead of only comparing with them. It
+// is read from the environment rather than a flag, so importing the
+// package registers nothing.
+var update = os.Getenv("UPDATE_GOLDEN") != ""
+
+// GoldenPath returns the path of the named golden file.
+func GoldenPath(name string) string {
+	_, file, _, _ := runtime.Caller(0)
+	return filepath.Join(filepath.Dir(file), "testdata", name+".golden")
+}
+
+// AssertGolden fails t when got differs from the named golden file. With
+// UPDATE_GOLDEN set the file is rewritten first.
+func AssertGolden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := GoldenPath(name)
+	if update {
+		if err := os.WriteFile(path, got, 0644); err != nil {
+			t.Fatalf("Failed to update golden file: %v", err)
+		}
+	}
+
+	expected, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Failed to read golden file (run make test-update-golden to create it): %v", err)
+	}
+	if !bytes.Equal(got, expected) {
+		t.Errorf("Output differs from %s (run make test-update-golden to accept):\n got:\n%s\nwant:\n%s", path, got, expected)
+	}
+}
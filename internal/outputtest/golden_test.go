@@ -0,0 +1,30 @@
+package outputtest
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGoldenPath(t *testing.T) {
+	path := GoldenPath("machine_table_default")
+	if !strings.HasSuffix(path, "internal/outputtest/testdata/machine_table_default.golden") {
+		t.Errorf("Unexpected golden path: %s", path)
+	}
+}
+
+func TestFixtures(t *testing.T) {
+	states := make(map[string]bool)
+	for _, machine := range Machines() {
+		states[machine.State] = true
+	}
+	for _, state := range []string{"ready", "stopped", "archived", "terminated"} {
+		if !states[state] {
+			t.Errorf("Machine fixtures should cover state %s", state)
+		}
+	}
+
+	config := Config()
+	if _, ok := config.Machines[config.Default]; !ok {
+		t.Error("Config fixture default alias should exist")
+	}
+}
@@ -0,0 +1,316 @@
+// Package plugin extends tg with external commands, the way kubectl does:
+// an executable named tg-<name> on PATH runs as tg <name>.
+//
+// A plugin gets the arguments after its name unchanged, tg's own flags
+// included, and the settings tg resolved in its environment (see Env). It
+// may answer InfoFlag with a JSON Info so that tg plugin list can show its
+// version. Built-in commands always win over a plugin of the same name.
+package plugin
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// Prefix starts the file name of every plugin.
+const Prefix = "tg-"
+
+// InfoFlag is the only argument of the handshake call tg plugin list makes
+// to each plugin.
+const InfoFlag = "--tgcli-plugin-info"
+
+// GroupID groups the plugin commands in tg --help.
+const GroupID = "plugins"
+
+// Environment variables tg sets for a plugin.
+const (
+	ConfigEnv = "TGCLI_CONFIG"
+	AliasEnv  = "TGCLI_ACTIVE_ALIAS"
+	OutputEnv = "TGCLI_OUTPUT"
+)
+
+// handshakeTimeout bounds the handshake call, so a plugin that ignores
+// InfoFlag and waits for input does not hang tg plugin list.
+var handshakeTimeout = 3 * time.Second
+
+// Plugin is an executable found on PATH.
+type Plugin struct {
+	Name string `json:"name"`
+	Path string `json:"path"`
+	// Version and Description come from the handshake; HandshakeError
+	// says why there are none.
+	Version        string `json:"version,omitempty"`
+	Description    string `json:"description,omitempty"`
+	HandshakeError string `json:"handshakeError,omitempty"`
+	// Shadowed is set when a built-in command has the plugin's name, so
+	// the plugin never runs.
+	Shadowed bool `json:"shadowed,omitempty"`
+}
+
+// Info is what a plugin prints on stdout when called with InfoFlag, e.g.
+// {"version": "1.2.0", "description": "Deploy a graph from git"}.
+type Info struct {
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+// Discover returns the plugins in the directories of pathList, which is
+// formatted like $PATH, sorted by name. When two directories hold the same
+// plugin, the first wins, as it would for the shell.
+func Discover(pathList string) []Plugin {
+	seen := make(map[string]bool)
+	var plugins []Plugin
+	for _, dir := range filepath.SplitList(pathList) {
+		if dir == "" {
+			dir = "."
+		}
+		entries, err := os.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, entry := range entries {
+			name, ok := pluginName(entry.Name())
+			if !ok || seen[name] {
+				continue
+			}
+			path := filepath.Join(dir, entry.Name())
+			if !isExecutable(path) {
+				continue
+			}
+			seen[name] = true
+			plugins = append(plugins, Plugin{Name: name, Path: path})
+		}
+	}
+	sort.Slice(plugins, func(i, j int) bool { return plugins[i].Name < plugins[j].Name })
+	return plugins
+}
+
+// pluginName returns the command name of the plugin file, e.g. deploy-graph
+// for tg-deploy-graph, or false if file is not a plugin.
+func pluginName(file string) (string, bool) {
+	if runtime.GOOS == "windows" {
+		ext := strings.ToLower(filepath.Ext(file))
+		if ext != ".exe" && ext != ".bat" && ext != ".cmd" {
+			return "", false
+		}
+		file = strings.TrimSuffix(file, filepath.Ext(file))
+	}
+	name, ok := strings.CutPrefix(file, Prefix)
+	if !ok || name == "" || strings.HasPrefix(name, "-") || strings.ContainsAny(name, " \t") {
+		return "", false
+	}
+	return name, true
+}
+
+// isExecutable reports whether path is a regular file, following links,
+// that may be executed.
+func isExecutable(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil || !info.Mode().IsRegular() {
+		return false
+	}
+	return runtime.GOOS == "windows" || info.Mode().Perm()&0111 != 0
+}
+
+// Handshake calls p with InfoFlag and returns the Info it prints.
+func Handshake(p Plugin) (Info, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), handshakeTimeout)
+	defer cancel()
+	child := exec.CommandContext(ctx, p.Path, InfoFlag)
+	var stdout bytes.Buffer
+	child.Stdout = &stdout
+	// Processes the plugin started may keep stdout open after it is killed.
+	child.WaitDelay = time.Second
+	if err := child.Run(); err != nil {
+		if ctx.Err() != nil {
+			return Info{}, fmt.Errorf("no answer to %s within %s", InfoFlag, handshakeTimeout)
+		}
+		return Info{}, fmt.Errorf("%s failed: %v", InfoFlag, err)
+	}
+	var info Info
+	if err := json.Unmarshal(stdout.Bytes(), &info); err != nil {
+		return Info{}, fmt.Errorf("%s did not print plugin info JSON", InfoFlag)
+	}
+	return info, nil
+}
+
+// Env returns the variables that tell a plugin what tg resolved: the config
+// file in use, the alias commands use when none is given, and the output
+// format of the active context. Empty values are set too, so a plugin does
+// not pick them up from an outer tg.
+func Env() []string {
+	output := "stdout"
+	if _, ctx, ok := helpers.ActiveContext(); ok && ctx.Output != "" {
+		output = ctx.Output
+	}
+	return []string{
+		ConfigEnv + "=" + constants.ConfigFile,
+		AliasEnv + "=" + helpers.DefaultAlias(),
+		OutputEnv + "=" + output,
+	}
+}
+
+// runPlugin runs the plugin at path with args and the extra environment
+// variables env, connected to tg's stdin, stdout and stderr, and returns
+// its exit code. Tests replace it.
+var runPlugin = func(path string, args, env []string) (int, error) {
+	child := exec.Command(path, args...)
+	child.Env = append(os.Environ(), env...)
+	child.Stdin, child.Stdout, child.Stderr = os.Stdin, helpers.Stdout(), os.Stderr
+	err := child.Run()
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) {
+		if code := exitErr.ExitCode(); code > 0 {
+			return code, nil
+		}
+		// Killed by a signal.
+		return 1, nil
+	}
+	return 0, err
+}
+
+// commandLine returns the arguments tg was run with. Tests replace it.
+var commandLine = func() []string { return os.Args[1:] }
+
+// Command returns the command that runs p. Flags of tg placed before the
+// plugin name are rejected, as tg does not parse a plugin's arguments and
+// would otherwise pass them on as the plugin's own.
+func Command(p Plugin) *cobra.Command {
+	return &cobra.Command{
+		Use:                p.Name,
+		Short:              "Plugin at " + p.Path,
+		GroupID:            GroupID,
+		DisableFlagParsing: true,
+		Run: func(cmd *cobra.Command, args []string) {
+			if leading := beforeName(commandLine(), p.Name); len(leading) > 0 {
+				fmt.Fprintf(helpers.Stdout(), "Error: flags cannot be placed before a plugin name: %s; put them after %s if the plugin takes them\n", strings.Join(leading, " "), p.Name)
+				helpers.Exit(1)
+			}
+			code, err := runPlugin(p.Path, args, Env())
+			if err != nil {
+				fmt.Fprintf(helpers.Stdout(), "Error: running plugin %s: %v\n", p.Name, err)
+				helpers.Exit(1)
+			}
+			if code != 0 {
+				helpers.Exit(code)
+			}
+		},
+	}
+}
+
+// beforeName returns the arguments in line before name.
+func beforeName(line []string, name string) []string {
+	for i, arg := range line {
+		if arg == name {
+			return line[:i]
+		}
+	}
+	return nil
+}
+
+// builtins returns the names and aliases of root's commands that are not
+// plugins, with those cobra adds itself.
+func builtins(root *cobra.Command) map[string]bool {
+	names := map[string]bool{"help": true, "completion": true}
+	for _, cmd := range root.Commands() {
+		if cmd.GroupID == GroupID {
+			continue
+		}
+		names[cmd.Name()] = true
+		for _, alias := range cmd.Aliases {
+			names[alias] = true
+		}
+	}
+	return names
+}
+
+// Register adds a command to root for every plugin on $PATH that no
+// built-in command shadows.
+func Register(root *cobra.Command) {
+	plugins := Discover(os.Getenv("PATH"))
+	if len(plugins) == 0 {
+		return
+	}
+	root.AddGroup(&cobra.Group{ID: GroupID, Title: "Plugin Commands:"})
+	builtin := builtins(root)
+	for _, p := range plugins {
+		if !builtin[p.Name] {
+			root.AddCommand(Command(p))
+		}
+	}
+}
+
+// list discovers the plugins for root, marks the shadowed ones and asks
+// the others for their info.
+func list(root *cobra.Command, pathList string) []Plugin {
+	plugins := Discover(pathList)
+	builtin := builtins(root)
+	for i := range plugins {
+		p := &plugins[i]
+		if builtin[p.Name] {
+			p.Shadowed = true
+			continue
+		}
+		info, err := Handshake(*p)
+		if err != nil {
+			p.HandshakeError = err.Error()
+			continue
+		}
+		p.Version, p.Description = info.Version, info.Description
+	}
+	return plugins
+}
+
+// formatList renders plugins as a table.
+func formatList(plugins []Plugin) string {
+	if len(plugins) == 0 {
+		return "No plugins found; put an executable named tg-<name> on PATH to add tg <name>\n"
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%-20s  %-10s  %s\n", "NAME", "VERSION", "PATH")
+	for _, p := range plugins {
+		version := p.Version
+		switch {
+		case p.Shadowed:
+			version = "shadowed"
+		case version == "":
+			version = "unknown"
+		}
+		fmt.Fprintf(&b, "%-20s  %-10s  %s\n", p.Name, version, p.Path)
+		if p.Description != "" {
+			fmt.Fprintf(&b, "%-20s  %-10s  %s\n", "", "", p.Description)
+		}
+	}
+	return b.String()
+}
+
+// RunList shows the plugins on PATH with their paths and versions, and
+// warns about those a built-in command shadows.
+func RunList(cmd *cobra.Command, args []string) {
+	plugins := list(cmd.Root(), os.Getenv("PATH"))
+	for _, p := range plugins {
+		if p.Shadowed {
+			helpers.Warn(helpers.WarnPluginShadowed, "plugin %s is never run: tg %s is a built-in command", p.Path, p.Name)
+		}
+	}
+	if helpers.OutputFormat(cmd) == "json" {
+		encoded, _ := json.Marshal(append([]Plugin{}, plugins...))
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(encoded)))
+		return
+	}
+	fmt.Fprint(helpers.Stdout(), formatList(plugins))
+}
@@ -0,0 +1,222 @@
+package plugin
+
+import (
+	"bytes"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// writePlugin writes a shell script named tg-<name> into dir.
+func writePlugin(t *testing.T, dir, name, script string) string {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake plugins are shell scripts")
+	}
+	path := filepath.Join(dir, Prefix+name)
+	if err := os.WriteFile(path, []byte("#!/bin/sh\n"+script+"\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+// infoScript answers the handshake with info and otherwise runs rest.
+func infoScript(info, rest string) string {
+	return `if [ "$1" = "` + InfoFlag + `" ]; then echo '` + info + `'; exit 0; fi` + "\n" + rest
+}
+
+func TestDiscover(t *testing.T) {
+	first, second := t.TempDir(), t.TempDir()
+	deploy := writePlugin(t, first, "deploy-graph", "exit 0")
+	writePlugin(t, second, "deploy-graph", "exit 0")
+	lint := writePlugin(t, second, "lint", "exit 0")
+	os.WriteFile(filepath.Join(first, "tg-notes"), []byte("not executable"), 0644)
+	os.WriteFile(filepath.Join(first, "tg-"), []byte("#!/bin/sh\n"), 0755)
+	os.WriteFile(filepath.Join(first, "other"), []byte("#!/bin/sh\n"), 0755)
+	os.Mkdir(filepath.Join(first, "tg-dir"), 0755)
+	os.Symlink(lint, filepath.Join(first, "tg-lint-link"))
+
+	pathList := strings.Join([]string{first, filepath.Join(first, "missing"), second}, string(os.PathListSeparator))
+	expected := []Plugin{
+		{Name: "deploy-graph", Path: deploy},
+		{Name: "lint", Path: lint},
+		{Name: "lint-link", Path: filepath.Join(first, "tg-lint-link")},
+	}
+	if got := Discover(pathList); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %+v, got %+v", expected, got)
+	}
+}
+
+func TestHandshake(t *testing.T) {
+	dir := t.TempDir()
+	original := handshakeTimeout
+	handshakeTimeout = 500 * time.Millisecond
+	defer func() { handshakeTimeout = original }()
+
+	for _, test := range []struct {
+		name     string
+		script   string
+		expected Info
+		err      string
+	}{
+		{"answers", infoScript(`{"version": "1.2.0", "description": "Deploy a graph"}`, "exit 1"), Info{Version: "1.2.0", Description: "Deploy a graph"}, ""},
+		{"not json", "echo usage: deploy", Info{}, "did not print plugin info JSON"},
+		{"fails", "exit 2", Info{}, "failed: exit status 2"},
+		{"hangs", "sleep 5", Info{}, "no answer to --tgcli-plugin-info within 500ms"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			path := writePlugin(t, dir, strings.ReplaceAll(test.name, " ", "-"), test.script)
+			info, err := Handshake(Plugin{Name: test.name, Path: path})
+			if info != test.expected {
+				t.Errorf("Expected %+v, got %+v", test.expected, info)
+			}
+			if test.err == "" && err != nil || test.err != "" && (err == nil || !strings.Contains(err.Error(), test.err)) {
+				t.Errorf("Expected error %q, got %v", test.err, err)
+			}
+		})
+	}
+}
+
+func TestEnv(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	originalFile := constants.ConfigFile
+	constants.ConfigFile = "/home/me/.tgcli/config.yml"
+	defer func() { constants.ConfigFile = originalFile }()
+
+	viper.Set("default", "prod")
+	expected := []string{"TGCLI_CONFIG=/home/me/.tgcli/config.yml", "TGCLI_ACTIVE_ALIAS=prod", "TGCLI_OUTPUT=stdout"}
+	if got := Env(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected %q, got %q", expected, got)
+	}
+
+	viper.Set("currentContext", "customer-a")
+	viper.Set("contexts", map[string]interface{}{"customer-a": map[string]interface{}{"defaultAlias": "staging", "output": "json"}})
+	expected = []string{"TGCLI_CONFIG=/home/me/.tgcli/config.yml", "TGCLI_ACTIVE_ALIAS=staging", "TGCLI_OUTPUT=json"}
+	if got := Env(); !reflect.DeepEqual(got, expected) {
+		t.Errorf("Expected the context's settings %q, got %q", expected, got)
+	}
+}
+
+// newRoot returns a root command with a built-in cloud command.
+func newRoot() *cobra.Command {
+	root := &cobra.Command{Use: "tg"}
+	root.AddCommand(&cobra.Command{Use: "cloud", Aliases: []string{"tgcloud"}, Run: func(*cobra.Command, []string) {}})
+	return root
+}
+
+func TestRegister(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "deploy-graph", "exit 0")
+	writePlugin(t, dir, "cloud", "exit 0")
+	writePlugin(t, dir, "tgcloud", "exit 0")
+	writePlugin(t, dir, "help", "exit 0")
+	t.Setenv("PATH", dir)
+
+	root := newRoot()
+	Register(root)
+	var names []string
+	for _, cmd := range root.Commands() {
+		if cmd.GroupID == GroupID {
+			names = append(names, cmd.Name())
+		}
+	}
+	if !reflect.DeepEqual(names, []string{"deploy-graph"}) {
+		t.Errorf("Expected only the plugin no built-in shadows, got %q", names)
+	}
+	if cmd, _, _ := root.Find([]string{"cloud"}); cmd.GroupID == GroupID {
+		t.Error("Expected tg cloud to stay the built-in command")
+	}
+}
+
+func TestList(t *testing.T) {
+	dir := t.TempDir()
+	writePlugin(t, dir, "deploy-graph", infoScript(`{"version": "1.2.0", "description": "Deploy a graph"}`, "exit 0"))
+	writePlugin(t, dir, "lint", "echo lint")
+	writePlugin(t, dir, "cloud", infoScript(`{"version": "9.9.9"}`, "exit 0"))
+
+	plugins := list(newRoot(), dir)
+	if len(plugins) != 3 {
+		t.Fatalf("Expected three plugins, got %+v", plugins)
+	}
+	if p := plugins[0]; p.Name != "cloud" || !p.Shadowed || p.Version != "" {
+		t.Errorf("Expected cloud to be shadowed and not called, got %+v", p)
+	}
+	if p := plugins[1]; p.Version != "1.2.0" || p.Description != "Deploy a graph" {
+		t.Errorf("Expected the handshake info, got %+v", p)
+	}
+	if p := plugins[2]; p.HandshakeError == "" {
+		t.Errorf("Expected the failed handshake to be kept, got %+v", p)
+	}
+
+	table := formatList(plugins)
+	for _, expected := range []string{
+		"cloud                 shadowed    " + filepath.Join(dir, "tg-cloud"),
+		"deploy-graph          1.2.0       " + filepath.Join(dir, "tg-deploy-graph") + "\n" + strings.Repeat(" ", 34) + "Deploy a graph\n",
+		"lint                  unknown     ",
+	} {
+		if !strings.Contains(table, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, table)
+		}
+	}
+	if !strings.HasPrefix(formatList(nil), "No plugins found") {
+		t.Errorf("Expected a hint without plugins, got %q", formatList(nil))
+	}
+}
+
+func TestBeforeName(t *testing.T) {
+	if got := beforeName([]string{"deploy-graph", "--context", "x"}, "deploy-graph"); len(got) != 0 {
+		t.Errorf("Expected nothing before the name, got %q", got)
+	}
+	if got := beforeName([]string{"--context", "x", "deploy-graph", "-a", "prod"}, "deploy-graph"); !reflect.DeepEqual(got, []string{"--context", "x"}) {
+		t.Errorf("Expected the flags before the name, got %q", got)
+	}
+}
+
+// TestPluginCommand runs a plugin through its command in a child process,
+// since the plugin's exit status ends tg.
+func TestPluginCommand(t *testing.T) {
+	if dir := os.Getenv("TG_TEST_PLUGIN_DIR"); dir != "" {
+		constants.ConfigFile = filepath.Join(dir, "config.yml")
+		viper.Set("default", "prod")
+		line := strings.Fields(os.Getenv("TG_TEST_PLUGIN_ARGS"))
+		commandLine = func() []string { return line }
+		cmd := Command(Plugin{Name: "deploy-graph", Path: filepath.Join(dir, "tg-deploy-graph")})
+		cmd.Run(cmd, line[len(beforeName(line, "deploy-graph"))+1:])
+		os.Exit(0)
+	}
+
+	dir := t.TempDir()
+	writePlugin(t, dir, "deploy-graph", `echo "args: $*"; echo "$TGCLI_CONFIG $TGCLI_ACTIVE_ALIAS $TGCLI_OUTPUT"; exit ${EXIT_WITH:-0}`)
+	for _, test := range []struct {
+		name     string
+		args     string
+		exit     string
+		code     int
+		expected string
+	}{
+		{"passes args and env", "deploy-graph --alias staging -- x", "0", 0, "args: --alias staging -- x\n" + filepath.Join(dir, "config.yml") + " prod stdout\n"},
+		{"passes the exit status", "deploy-graph", "3", 3, "args: \n"},
+		{"rejects flags before the name", "--context x deploy-graph", "0", 1, "Error: flags cannot be placed before a plugin name: --context x"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			child := exec.Command(os.Args[0], "-test.run=^TestPluginCommand$")
+			child.Env = append(os.Environ(), "TG_TEST_PLUGIN_DIR="+dir, "TG_TEST_PLUGIN_ARGS="+test.args, "EXIT_WITH="+test.exit)
+			var output bytes.Buffer
+			child.Stdout, child.Stderr = &output, &output
+			child.Run()
+			if child.ProcessState.ExitCode() != test.code || !strings.Contains(output.String(), test.expected) {
+				t.Errorf("Expected exit code %d and %q, got %d: %s", test.code, test.expected, child.ProcessState.ExitCode(), output.String())
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// transcript records an interactive session for --capture: each prompt
+// with the statement typed at it, the output the server sent back and what
+// tg printed itself, such as the \graphs list and \history.
+// Statements are scrubbed like the history, so passwords typed into
+// CREATE USER and the like are written as ***. A nil transcript records
+// nothing.
+type transcript struct {
+	file  *os.File
+	scrub []*regexp.Regexp
+	// lineOpen is set while the last output did not end a line, so the
+	// next prompt starts on a line of its own.
+	lineOpen bool
+	warned   bool
+}
+
+// openTranscript creates path, replacing an earlier transcript, and
+// writes a header naming host. The file is private to the user, since the
+// output may hold data the statements were not scrubbed of.
+func openTranscript(path, host string) (*transcript, error) {
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	t := &transcript{file: file}
+	t.write(fmt.Sprintf("# tg server gsql session with %s, started %s\n", helpers.Redact(host), time.Now().Format(time.RFC3339)))
+	return t, nil
+}
+
+// input records statement as typed at prompt.
+func (t *transcript) input(prompt, statement string) {
+	if t == nil {
+		return
+	}
+	if t.lineOpen {
+		t.write("\n")
+	}
+	t.write(prompt + helpers.ScrubStatement(statement, t.scrub) + "\n")
+}
+
+// echo records a statement shown back to the user, scrubbed like input.
+func (t *transcript) echo(statement string) {
+	if t == nil {
+		return
+	}
+	t.output(helpers.ScrubStatement(statement, t.scrub) + "\n")
+}
+
+// Write records p as output, so the session's own messages can be teed
+// to the transcript.
+func (t *transcript) Write(p []byte) (int, error) {
+	t.output(string(p))
+	return len(p), nil
+}
+
+// output records data as the server sent it.
+func (t *transcript) output(data string) {
+	if t == nil || data == "" {
+		return
+	}
+	t.write(data)
+	t.lineOpen = !strings.HasSuffix(data, "\n")
+}
+
+// write warns once when the transcript cannot be written; the session
+// goes on without it.
+func (t *transcript) write(data string) {
+	if _, err := t.file.WriteString(data); err != nil && !t.warned {
+		helpers.Warn(helpers.WarnCapture, "could not write the transcript %s: %v", t.file.Name(), err)
+		t.warned = true
+	}
+}
+
+func (t *transcript) close() {
+	if t == nil {
+		return
+	}
+	if t.lineOpen {
+		t.write("\n")
+		t.lineOpen = false
+	}
+	t.file.Close()
+}
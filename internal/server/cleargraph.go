@@ -0,0 +1,163 @@
+package server
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// clearGraphCommand deletes all vertices and edges but keeps the schema.
+// It acts on the whole graph store, not on a single graph.
+const clearGraphCommand = "CLEAR GRAPH STORE -HARD"
+
+// confirmInput is where confirmation answers are read from.
+var confirmInput io.Reader = os.Stdin
+
+// errClearGraphCancelled is returned when the confirmation is declined.
+var errClearGraphCancelled = errors.New("clear-graph cancelled")
+
+// productionName matches alias and host names that look like production,
+// such as prod, production, eu-prod-2 or prod-db.example.com.
+var productionName = regexp.MustCompile(`(?i)(^|[^a-z])prod(uction)?($|[^a-z])`)
+
+// clearGraphOptions is what RunClearGraph reads from its flags.
+type clearGraphOptions struct {
+	Alias           string
+	Host            string
+	Graph           string
+	Yes             bool
+	AllGraphs       bool
+	AllowProduction bool
+}
+
+// isProductionName reports whether destructive commands should refuse an
+// alias or host called name without --allow-production.
+func isProductionName(name string) bool {
+	return productionName.MatchString(name)
+}
+
+// checkProduction refuses a production alias, or a production host however
+// it was given, unless --allow-production was given.
+func checkProduction(opts clearGraphOptions) error {
+	if opts.AllowProduction {
+		return nil
+	}
+	if isProductionName(opts.Alias) {
+		return fmt.Errorf("%s looks like a production alias; pass --allow-production to clear it anyway", opts.Alias)
+	}
+	if isProductionName(opts.Host) {
+		return fmt.Errorf("%s looks like a production host; pass --allow-production to clear it anyway", opts.Host)
+	}
+	return nil
+}
+
+// clearGraph empties the graph store of a logged-in session after checking
+// that only opts.Graph is affected, or that --all-graphs accepts the
+// others, and asking for confirmation on stderr.
+func clearGraph(session *GSQLSession, opts clearGraphOptions) error {
+	graphs, err := session.listGraphs()
+	if err != nil {
+		return err
+	}
+	var others []string
+	found := false
+	for _, graph := range graphs {
+		if graph == opts.Graph {
+			found = true
+		} else {
+			others = append(others, graph)
+		}
+	}
+	if !found {
+		return fmt.Errorf("graph %q not found (available: %s)", opts.Graph, strings.Join(graphs, ", "))
+	}
+	if len(others) > 0 && !opts.AllGraphs {
+		return fmt.Errorf("%s clears every graph, and this server also has %s; pass --all-graphs to clear them too", clearGraphCommand, strings.Join(others, ", "))
+	}
+
+	target := opts.Alias
+	if target == "" {
+		target = session.Host
+	}
+	cleared := append([]string{opts.Graph}, others...)
+	fmt.Fprintf(os.Stderr, "This deletes all vertices and edges of %s on %s. The schema is kept.\n", strings.Join(cleared, ", "), target)
+	if !opts.Yes {
+		fmt.Fprint(os.Stderr, "Continue? (y/n) [n] ")
+		answer, _ := bufio.NewReader(confirmInput).ReadString('\n')
+		if ok, _ := helpers.ParseYesNo(answer); !ok {
+			return errClearGraphCancelled
+		}
+	}
+
+	started := helpers.Now()
+	if err := session.executeCommand(clearGraphCommand); err != nil {
+		return err
+	}
+	fmt.Fprintf(helpers.Stdout(), "Cleared %s in %s\n", strings.Join(cleared, ", "), helpers.Now().Sub(started).Round(100*time.Millisecond))
+	return nil
+}
+
+// RunClearGraph deletes the data of a graph and keeps its schema.
+func RunClearGraph(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
+	user, _ := cmd.Flags().GetString("user")
+	password, _ := cmd.Flags().GetString("password")
+	host, _ := cmd.Flags().GetString("host")
+	gsPort, _ := cmd.Flags().GetString("gsPort")
+	opts := clearGraphOptions{Alias: alias}
+	opts.Graph, _ = cmd.Flags().GetString("graph")
+	opts.Yes, _ = cmd.Flags().GetBool("yes")
+	opts.AllGraphs, _ = cmd.Flags().GetBool("all-graphs")
+	opts.AllowProduction, _ = cmd.Flags().GetBool("allow-production")
+
+	if !graphName.MatchString(opts.Graph) {
+		fmt.Fprintln(helpers.Stdout(), "Error: --graph needs a graph name")
+		helpers.Exit(1)
+	}
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fmt.Fprintf(helpers.Stdout(), "Alias %s not found. Try: tg conf list\n", alias)
+			helpers.Exit(1)
+		}
+		warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
+		host = machineConfig.Host
+		user = machineConfig.User
+		password = machineConfig.Password
+		gsPort = machineConfig.GSPort
+	}
+	opts.Host = host
+	if err := checkProduction(opts); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+
+	session := &GSQLSession{
+		Alias:    alias,
+		Host:     fmt.Sprintf("%s:%s", host, gsPort),
+		User:     user,
+		Password: password,
+		Client:   newServerClient(cmd, alias, 10*time.Minute),
+	}
+	if err := session.login(); err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error logging in: %v\n", err)
+		helpers.Exit(1)
+	}
+	if err := clearGraph(session, opts); errors.Is(err, errClearGraphCancelled) {
+		fmt.Fprintln(helpers.Stdout(), "Clear-graph cancelled")
+		helpers.Fail(helpers.ExitCancelled)
+		return
+	} else if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+}
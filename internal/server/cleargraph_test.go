@@ -0,0 +1,129 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+func TestIsProductionName(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"prod":                        true,
+		"Production":                  true,
+		"eu-prod-2":                   true,
+		"prod_backup":                 true,
+		"https://prod-db.example.com": true,
+		"dev":                         false,
+		"":                            false,
+		"product":                     false,
+		"reproduce":                   false,
+		"https://products.example.io": false,
+	} {
+		if got := isProductionName(name); got != expected {
+			t.Errorf("isProductionName(%q) = %v, want %v", name, got, expected)
+		}
+	}
+
+	if err := checkProduction(clearGraphOptions{Alias: "prod"}); err == nil || !strings.Contains(err.Error(), "--allow-production") {
+		t.Errorf("Expected prod to be refused, got %v", err)
+	}
+	if err := checkProduction(clearGraphOptions{Alias: "prod", AllowProduction: true}); err != nil {
+		t.Errorf("--allow-production should allow prod, got %v", err)
+	}
+	// A production host is refused when given with --host, or behind an
+	// alias that does not look like one.
+	for _, alias := range []string{"", "staging"} {
+		err := checkProduction(clearGraphOptions{Alias: alias, Host: "prod-db"})
+		if err == nil || !strings.Contains(err.Error(), "prod-db looks like a production host") {
+			t.Errorf("Expected the prod-db host to be refused with alias %q, got %v", alias, err)
+		}
+	}
+	if err := checkProduction(clearGraphOptions{Alias: "staging", Host: "https://staging.example.com"}); err != nil {
+		t.Errorf("Expected staging to be allowed, got %v", err)
+	}
+}
+
+// clearGraphServer answers SHOW GRAPH with graphs and records the other
+// commands it receives.
+func clearGraphServer(t *testing.T, graphs string) (*GSQLSession, *[]string) {
+	var commands []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "SHOW GRAPH") {
+			w.Write([]byte(graphs + "__GSQL__RETURN__CODE__,0\n"))
+			return
+		}
+		commands = append(commands, string(body))
+		w.Write([]byte("Successfully cleared graph store.\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	t.Cleanup(server.Close)
+	return &GSQLSession{Host: server.URL, Client: server.Client()}, &commands
+}
+
+func TestClearGraph(t *testing.T) {
+	original := confirmInput
+	defer func() { confirmInput = original }()
+	clock := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time {
+		clock = clock.Add(1500 * time.Millisecond)
+		return clock
+	}
+	defer func() { helpers.Now = oldNow }()
+
+	session, commands := clearGraphServer(t, "  - Graph social(Person:v, Friend:e)\n")
+	opts := clearGraphOptions{Alias: "dev", Graph: "social"}
+
+	confirmInput = strings.NewReader("n\n")
+	var err error
+	var output string
+	stderr := captureStderr(func() {
+		output = captureOutput(func() { err = clearGraph(session, opts) })
+	})
+	if err != errClearGraphCancelled || len(*commands) != 0 {
+		t.Errorf("Declining should clear nothing, got %v and %v", err, *commands)
+	}
+	if stderr != "This deletes all vertices and edges of social on dev. The schema is kept.\nContinue? (y/n) [n] " || output != "" {
+		t.Errorf("Expected the prompt on stderr only, got stderr %q and stdout %q", stderr, output)
+	}
+
+	confirmInput = strings.NewReader("y\n")
+	captureStderr(func() {
+		output = captureOutput(func() { err = clearGraph(session, opts) })
+	})
+	if err != nil || strings.Join(*commands, ",") != clearGraphCommand {
+		t.Errorf("Expected %s to run, got %v and %v", clearGraphCommand, err, *commands)
+	}
+	if !strings.Contains(output, "Cleared social in 1.5s\n") {
+		t.Errorf("Expected the duration to be reported:\n%s", output)
+	}
+
+	opts.Graph = "missing"
+	if err := clearGraph(session, opts); err == nil || !strings.Contains(err.Error(), `graph "missing" not found (available: social)`) {
+		t.Errorf("Expected an unknown graph to be refused, got %v", err)
+	}
+}
+
+func TestClearGraphSharedStore(t *testing.T) {
+	session, commands := clearGraphServer(t, "  - Graph social(Person:v)\n  - Graph cust_acme(Account:v)\n")
+
+	err := clearGraph(session, clearGraphOptions{Alias: "dev", Graph: "social", Yes: true})
+	if err == nil || !strings.Contains(err.Error(), "also has cust_acme; pass --all-graphs") || len(*commands) != 0 {
+		t.Errorf("Expected the other graph to block clearing, got %v and %v", err, *commands)
+	}
+
+	output := captureStderr(func() {
+		err = clearGraph(session, clearGraphOptions{Alias: "dev", Graph: "social", Yes: true, AllGraphs: true})
+	})
+	if err != nil || len(*commands) != 1 {
+		t.Errorf("--all-graphs should clear the store, got %v and %v", err, *commands)
+	}
+	if !strings.Contains(output, "of social, cust_acme on dev") || strings.Contains(output, "Continue?") {
+		t.Errorf("Expected every affected graph to be named without a prompt:\n%s", output)
+	}
+}
@@ -0,0 +1,319 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"unicode"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// gsqlFormats are the values --format accepts.
+var gsqlFormats = map[string]bool{"text": true, "csv": true, "tsv": true}
+
+// stdinScript is the --file that stands for standard input.
+const stdinScript = "-"
+
+// scriptInput is what --file - reads; tests replace it.
+var scriptInput io.Reader = os.Stdin
+
+// gsqlScript is GSQL to run and exit: the --command, or one --file. The
+// GSQL is text when it is set and read from file otherwise.
+type gsqlScript struct {
+	file string // "" for --command
+	text string
+}
+
+// name is how messages refer to the script.
+func (s gsqlScript) name() string {
+	switch s.file {
+	case "":
+		return "command"
+	case stdinScript:
+		return "stdin"
+	}
+	return s.file
+}
+
+// open returns the GSQL of the script, or nil when there is none. A file
+// is streamed to the server rather than read into memory, so a script of
+// generated loading statements can be as large as the server takes. The
+// GSQL of --command and of a file can be rewound to be sent again; that
+// read from stdin cannot.
+func (s gsqlScript) open() (io.ReadCloser, error) {
+	if s.text != "" {
+		return nopSeekCloser{strings.NewReader(s.text)}, nil
+	}
+	switch s.file {
+	case "":
+		return nil, nil
+	case stdinScript:
+		reader := bufio.NewReader(scriptInput)
+		if _, err := skipSpace(reader); err != nil {
+			return nil, ignoreEOF(err)
+		}
+		return io.NopCloser(reader), nil
+	}
+
+	file, err := os.Open(s.file)
+	if err != nil {
+		return nil, err
+	}
+	offset, err := skipSpace(bufio.NewReader(file))
+	if err == nil {
+		_, err = file.Seek(offset, io.SeekStart)
+	}
+	if err != nil {
+		file.Close()
+		return nil, ignoreEOF(err)
+	}
+	return file, nil
+}
+
+// skipSpace reads past the leading whitespace of reader and returns how
+// many bytes it took, or io.EOF when there is nothing else.
+func skipSpace(reader *bufio.Reader) (int64, error) {
+	var offset int64
+	for {
+		r, size, err := reader.ReadRune()
+		if err != nil {
+			return offset, err
+		}
+		if !unicode.IsSpace(r) {
+			return offset, reader.UnreadRune()
+		}
+		offset += int64(size)
+	}
+}
+
+// ignoreEOF turns the io.EOF of a blank script into no error.
+func ignoreEOF(err error) error {
+	if err == io.EOF {
+		return nil
+	}
+	return err
+}
+
+// nopSeekCloser is io.NopCloser for a reader that can also be rewound.
+type nopSeekCloser struct{ io.ReadSeeker }
+
+func (nopSeekCloser) Close() error { return nil }
+
+// singleCommands returns the GSQL given with --command or in each --file
+// in order, or nothing for an interactive session. Every file is checked
+// before anything runs, so a missing one fails early; - reads standard
+// input, once. An empty --command, such as an unset variable in a script,
+// is an error rather than a terminal session nobody is there to type into.
+func singleCommands(cmd *cobra.Command) ([]gsqlScript, error) {
+	command, _ := cmd.Flags().GetString("command")
+	files, _ := cmd.Flags().GetStringArray("file")
+	if command != "" && len(files) > 0 {
+		return nil, fmt.Errorf("--command and --file cannot be combined")
+	}
+	if command = strings.TrimSpace(command); command != "" {
+		return []gsqlScript{{text: command}}, nil
+	}
+	if cmd.Flags().Changed("command") {
+		return nil, fmt.Errorf("--command is empty")
+	}
+	var scripts []gsqlScript
+	stdin := false
+	for _, file := range files {
+		if file == stdinScript {
+			if stdin {
+				return nil, fmt.Errorf("--file - can only be given once")
+			}
+			stdin = true
+		} else if err := checkScriptFile(file); err != nil {
+			var pathErr *fs.PathError
+			if errors.As(err, &pathErr) {
+				err = pathErr.Err
+			}
+			return nil, fmt.Errorf("cannot read --file %s: %v", file, err)
+		}
+		scripts = append(scripts, gsqlScript{file: file})
+	}
+	return scripts, nil
+}
+
+// checkScriptFile reports why file cannot be run as a script.
+func checkScriptFile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	if info.IsDir() {
+		return fmt.Errorf("is a directory")
+	}
+	return nil
+}
+
+// runScripts runs scripts in order in the session, so a USE GRAPH in one
+// file holds for the next. It stops at the first that fails unless
+// continueOnError, and returns how many failed.
+func (s *GSQLSession) runScripts(scripts []gsqlScript, format, outPrefix string, data io.Writer, continueOnError bool) int {
+	failed := 0
+	for i, script := range scripts {
+		if len(scripts) > 1 {
+			fmt.Fprintf(os.Stderr, "Running %s\n", script.name())
+		}
+		body, err := script.open()
+		if err == nil && body == nil {
+			continue
+		}
+		if err == nil {
+			err = s.runSingleCommand(body, format, outPrefix, data)
+			body.Close()
+		}
+		if err == nil {
+			continue
+		}
+		// The server's own error output has already been printed.
+		var gsqlErr *GSQLError
+		if !errors.As(err, &gsqlErr) {
+			fmt.Fprintf(os.Stderr, "Error executing %s: %v\n", script.name(), err)
+		}
+		failed++
+		if !continueOnError && i < len(scripts)-1 {
+			fmt.Fprintf(os.Stderr, "Stopped after %s failed; %d more not run (--continue-on-error runs them)\n", script.name(), len(scripts)-1-i)
+			break
+		}
+	}
+	if failed > 0 && len(scripts) > 1 && continueOnError {
+		fmt.Fprintf(os.Stderr, "%d of %d files failed\n", failed, len(scripts))
+	}
+	return failed
+}
+
+// runSingleCommand runs the GSQL read from body and writes its output.
+// With format "text" the output streams as in an interactive session. With
+// "csv" or "tsv" the result tables are written to data, or to numbered
+// files when outPrefix is set, and everything else goes to stderr so the
+// data stays clean. Tables are numbered across the commands of a session.
+func (s *GSQLSession) runSingleCommand(body io.Reader, format, outPrefix string, data io.Writer) error {
+	if format == "text" {
+		return s.retryResumed(body, s.executeScript)
+	}
+
+	var output string
+	err := s.retryResumed(body, func(body io.Reader) error {
+		var err error
+		output, err = s.query(body)
+		return err
+	})
+	if err != nil {
+		var gsqlErr *GSQLError
+		if errors.As(err, &gsqlErr) {
+			fmt.Fprintln(os.Stderr, gsqlErr.Message)
+		}
+		return err
+	}
+
+	tables, text := parseGSQLOutput(output)
+	for _, line := range text {
+		fmt.Fprintln(os.Stderr, line)
+	}
+	if len(tables) == 0 {
+		helpers.Warn(helpers.WarnNoResultTables, "the output holds no result tables")
+		return nil
+	}
+
+	for _, table := range tables {
+		s.tablesWritten++
+		if outPrefix != "" {
+			path := fmt.Sprintf("%s%d.%s", outPrefix, s.tablesWritten, format)
+			if err := writeTableFile(path, table, format); err != nil {
+				return err
+			}
+			fmt.Fprintf(os.Stderr, "Wrote %d rows to %s\n", len(table.Rows), path)
+			continue
+		}
+		if s.tablesWritten > 1 {
+			fmt.Fprintln(data)
+		}
+		if err := writeDelimited(data, table, format); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeTableFile writes one table to path.
+func writeTableFile(path string, table GSQLTable, format string) error {
+	file, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	if err := writeDelimited(file, table, format); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// executeScript runs the GSQL read from body like executeCommand, noting
+// the USE statements on the way past, since the script is not kept.
+func (s *GSQLSession) executeScript(body io.Reader) error {
+	var uses graphTracker
+	if err := s.execute(io.TeeReader(body, &uses)); err != nil {
+		return err
+	}
+	uses.flush()
+	s.trackGraph(uses.last)
+	return nil
+}
+
+// maxTrackedLine bounds the lines graphTracker looks at; a USE statement
+// is short, and a longer line is data.
+const maxTrackedLine = 4096
+
+// graphTracker keeps the last USE statement among the lines written to it.
+type graphTracker struct {
+	line []byte
+	skip bool // the current line is too long to be a USE statement
+	last string
+}
+
+func (g *graphTracker) Write(p []byte) (int, error) {
+	n := len(p)
+	for len(p) > 0 {
+		end := bytes.IndexByte(p, '\n')
+		chunk := p
+		if end >= 0 {
+			chunk = p[:end]
+		}
+		if !g.skip {
+			if len(g.line)+len(chunk) > maxTrackedLine {
+				g.line, g.skip = g.line[:0], true
+			} else {
+				g.line = append(g.line, chunk...)
+			}
+		}
+		if end < 0 {
+			break
+		}
+		g.flush()
+		p = p[end+1:]
+	}
+	return n, nil
+}
+
+// flush ends the current line.
+func (g *graphTracker) flush() {
+	if !g.skip && useGraph.Match(g.line) {
+		g.last = string(g.line)
+	}
+	g.line, g.skip = g.line[:0], false
+}
@@ -0,0 +1,172 @@
+package server
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSingleCommands(t *testing.T) {
+	dir := t.TempDir()
+	schema := filepath.Join(dir, "schema.gsql")
+	queries := filepath.Join(dir, "queries.gsql")
+	os.WriteFile(schema, []byte("USE GRAPH social\n"), 0600)
+	os.WriteFile(queries, []byte("\nINSTALL QUERY ALL\n"), 0600)
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().StringP("command", "c", "", "")
+		cmd.Flags().StringArrayP("file", "f", nil, "")
+		if err := cmd.Flags().Parse(args); err != nil {
+			t.Fatal(err)
+		}
+		return cmd
+	}
+
+	scripts, err := singleCommands(newCmd("-f", schema, "--file", queries))
+	expected := []gsqlScript{{file: schema}, {file: queries}}
+	if err != nil || !reflect.DeepEqual(scripts, expected) {
+		t.Errorf("Expected the files in order, got %+v (%v)", scripts, err)
+	}
+	scripts, _ = singleCommands(newCmd("-c", " ls "))
+	if !reflect.DeepEqual(scripts, []gsqlScript{{text: "ls"}}) {
+		t.Errorf("Expected the command, got %+v", scripts)
+	}
+	if scripts, _ := singleCommands(newCmd()); len(scripts) != 0 {
+		t.Errorf("Expected nothing for an interactive session, got %+v", scripts)
+	}
+	if _, err := singleCommands(newCmd("-c", "  ")); err == nil || err.Error() != "--command is empty" {
+		t.Errorf("Expected an empty command to fail instead of starting a terminal, got %v", err)
+	}
+	missing := filepath.Join(dir, "missing.gsql")
+	if _, err := singleCommands(newCmd("-f", schema, "-f", missing)); err == nil || !strings.HasPrefix(err.Error(), "cannot read --file "+missing+": ") {
+		t.Errorf("Expected a missing file to fail before anything runs, got %v", err)
+	}
+	if _, err := singleCommands(newCmd("-f", dir)); err == nil || !strings.HasPrefix(err.Error(), "cannot read --file "+dir+": ") {
+		t.Errorf("Expected a directory to be rejected, got %v", err)
+	}
+	if _, err := singleCommands(newCmd("-c", "ls", "-f", schema)); err == nil {
+		t.Error("Expected --command and --file to be rejected together")
+	}
+	scripts, err = singleCommands(newCmd("-f", schema, "-f", "-"))
+	if err != nil || !reflect.DeepEqual(scripts, []gsqlScript{{file: schema}, {file: "-"}}) {
+		t.Errorf("Expected - to stand for stdin, got %+v (%v)", scripts, err)
+	}
+	if _, err := singleCommands(newCmd("-f", "-", "-f", "-")); err == nil || err.Error() != "--file - can only be given once" {
+		t.Errorf("Expected stdin to be read once, got %v", err)
+	}
+}
+
+func TestRunScriptsStreamsFiles(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		w.Write([]byte("__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	blank := filepath.Join(dir, "blank.gsql")
+	os.WriteFile(blank, []byte("\n  \n"), 0600)
+	// A long line of data on the way does not hide the USE statements.
+	schema := filepath.Join(dir, "schema.gsql")
+	script := "\nUSE GRAPH social\nINSERT INTO Person VALUES (\"" + strings.Repeat("x", 3*maxTrackedLine) + "\")\nUSE GRAPH  work ;\nls\n"
+	os.WriteFile(schema, []byte(script), 0600)
+	original := scriptInput
+	scriptInput = strings.NewReader("  \nINSTALL QUERY ALL")
+	t.Cleanup(func() { scriptInput = original })
+
+	session := &GSQLSession{Host: server.URL, Client: server.Client()}
+	var failed int
+	stderr := captureStderr(func() {
+		captureOutput(func() {
+			failed = session.runScripts([]gsqlScript{{file: blank}, {file: schema}, {file: "-"}}, "text", "", io.Discard, false)
+		})
+	})
+	expected := []string{strings.TrimPrefix(script, "\n"), "INSTALL QUERY ALL"}
+	if failed != 0 || !reflect.DeepEqual(received, expected) {
+		t.Errorf("Expected the blank file skipped and the others sent as they are, got %d failed and %.80q", failed, received)
+	}
+	if !strings.Contains(stderr, "Running stdin\n") {
+		t.Errorf("Expected stdin to be named:\n%s", stderr)
+	}
+	if session.Graph != "work" {
+		t.Errorf("Expected the last USE statement to hold, got %q", session.Graph)
+	}
+}
+
+func TestRunScripts(t *testing.T) {
+	var received []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received = append(received, string(body))
+		if strings.Contains(string(body), "nope") {
+			w.Write([]byte("Semantic Check Fails: The graph nope does not exist.\n__GSQL__RETURN__CODE__,1\n"))
+			return
+		}
+		w.Write([]byte("__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer server.Close()
+	scripts := []gsqlScript{
+		{file: "schema.gsql", text: "USE GRAPH social"},
+		{file: "loadjobs.gsql", text: "USE GRAPH nope"},
+		{file: "queries.gsql", text: "INSTALL QUERY ALL"},
+	}
+
+	run := func(continueOnError bool) (*GSQLSession, int, string) {
+		received = nil
+		session := &GSQLSession{Host: server.URL, Client: server.Client()}
+		var failed int
+		stderr := captureStderr(func() {
+			captureOutput(func() { failed = session.runScripts(scripts, "text", "", io.Discard, continueOnError) })
+		})
+		return session, failed, stderr
+	}
+
+	session, failed, stderr := run(false)
+	if failed != 1 || !reflect.DeepEqual(received, []string{"USE GRAPH social", "USE GRAPH nope"}) {
+		t.Errorf("Expected to stop after the failing file, got %d failed and %q", failed, received)
+	}
+	if !strings.Contains(stderr, "Running loadjobs.gsql\n") || !strings.Contains(stderr, "Stopped after loadjobs.gsql failed; 1 more not run") {
+		t.Errorf("Expected the files and the stop to be reported:\n%s", stderr)
+	}
+	if session.Graph != "social" {
+		t.Errorf("Expected the graph of the first file to hold, got %q", session.Graph)
+	}
+
+	_, failed, stderr = run(true)
+	if failed != 1 || len(received) != 3 {
+		t.Errorf("Expected every file to run, got %d failed and %q", failed, received)
+	}
+	if !strings.Contains(stderr, "1 of 3 files failed") {
+		t.Errorf("Expected a summary of the failures:\n%s", stderr)
+	}
+}
+
+func TestRunScriptsNumbersTablesAcrossFiles(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("+------+\n| Name |\n+------+\n| a    |\n+------+\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer server.Close()
+	session := &GSQLSession{Host: server.URL, Client: server.Client()}
+	prefix := filepath.Join(t.TempDir(), "report")
+
+	var data bytes.Buffer
+	captureStderr(func() {
+		session.runScripts([]gsqlScript{{file: "a.gsql", text: "ls"}, {file: "b.gsql", text: "ls"}}, "csv", prefix, &data, false)
+	})
+	for _, name := range []string{"report1.csv", "report2.csv"} {
+		if _, err := os.Stat(filepath.Join(filepath.Dir(prefix), name)); err != nil {
+			t.Errorf("Expected %s: %v", name, err)
+		}
+	}
+}
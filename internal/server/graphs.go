@@ -0,0 +1,247 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// graphLine matches a graph in the output of SHOW GRAPH *, e.g.
+// "  - Graph social(Person:v, Friend:e)".
+var graphLine = regexp.MustCompile(`^\s*- Graph (\w+)\(`)
+
+// GraphSelection is the set of graphs given with --graph and
+// --exclude-graph. Both accept shell globs such as cust_*.
+type GraphSelection struct {
+	Include []string
+	Exclude []string
+}
+
+// graphSelectionFlags reads --graph and --exclude-graph.
+func graphSelectionFlags(cmd *cobra.Command) GraphSelection {
+	include, _ := cmd.Flags().GetStringArray("graph")
+	exclude, _ := cmd.Flags().GetStringArray("exclude-graph")
+	return GraphSelection{Include: include, Exclude: exclude}
+}
+
+// Empty reports whether no graph was selected or excluded, in which case
+// commands operate on every graph.
+func (g GraphSelection) Empty() bool {
+	return len(g.Include) == 0 && len(g.Exclude) == 0
+}
+
+// Resolve applies the selection to the graphs in the catalog and returns
+// the chosen ones, sorted. With no --graph every graph is chosen before
+// exclusions apply. A pattern that matches no graph is an error, so a typo
+// is caught before any work starts, as is a selection that leaves nothing.
+func (g GraphSelection) Resolve(available []string) ([]string, error) {
+	include := g.Include
+	if len(include) == 0 {
+		include = []string{"*"}
+	}
+
+	selected := make(map[string]bool)
+	for _, pattern := range include {
+		matches, err := matchGraphs(pattern, available)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range matches {
+			selected[name] = true
+		}
+	}
+	for _, pattern := range g.Exclude {
+		matches, err := matchGraphs(pattern, available)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range matches {
+			delete(selected, name)
+		}
+	}
+
+	if len(selected) == 0 {
+		return nil, fmt.Errorf("no graphs left after --exclude-graph")
+	}
+	graphs := make([]string, 0, len(selected))
+	for name := range selected {
+		graphs = append(graphs, name)
+	}
+	sort.Strings(graphs)
+	return graphs, nil
+}
+
+// matchGraphs returns the graphs matching pattern, or an error naming the
+// available graphs when none does.
+func matchGraphs(pattern string, available []string) ([]string, error) {
+	var matches []string
+	for _, name := range available {
+		ok, err := path.Match(pattern, name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid graph pattern %q: %v", pattern, err)
+		}
+		if ok {
+			matches = append(matches, name)
+		}
+	}
+	if len(matches) == 0 {
+		known := "none"
+		if len(available) > 0 {
+			sorted := append([]string(nil), available...)
+			sort.Strings(sorted)
+			known = strings.Join(sorted, ", ")
+		}
+		return nil, fmt.Errorf("graph %q not found (available: %s)", pattern, known)
+	}
+	return matches, nil
+}
+
+// parseGraphList extracts the graph names from the output of SHOW GRAPH *.
+func parseGraphList(output string) []string {
+	var graphs []string
+	for _, line := range strings.Split(output, "\n") {
+		if match := graphLine.FindStringSubmatch(line); match != nil {
+			graphs = append(graphs, match[1])
+		}
+	}
+	return graphs
+}
+
+// listGraphs enumerates the graphs in the catalog.
+func (s *GSQLSession) listGraphs() ([]string, error) {
+	output, err := s.queryCommand("SHOW GRAPH *")
+	if err != nil {
+		return nil, fmt.Errorf("listing graphs: %v", err)
+	}
+	return parseGraphList(output), nil
+}
+
+// graphName matches the graph names \use accepts.
+var graphName = regexp.MustCompile(`^\w+$`)
+
+// isGraphCommand reports whether line is a \graphs or \use meta-command.
+func isGraphCommand(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && (fields[0] == `\graphs` || fields[0] == `\use`)
+}
+
+// runGraphCommand handles \graphs, which lists the graphs and marks the
+// current one, and \use <graph>, which runs USE GRAPH (or USE GLOBAL for
+// \use global) so the session and prompt follow it.
+func (s *GSQLSession) runGraphCommand(line string) error {
+	fields := strings.Fields(line)
+	if fields[0] == `\graphs` {
+		graphs, err := s.listGraphs()
+		if err != nil {
+			return err
+		}
+		fmt.Fprint(s.out(), formatGraphList(graphs, s.Graph))
+		return nil
+	}
+
+	if len(fields) != 2 || !graphName.MatchString(fields[1]) {
+		return fmt.Errorf(`usage: \use <graph>, or \use global`)
+	}
+	if strings.EqualFold(fields[1], "global") {
+		return s.executeCommand("USE GLOBAL")
+	}
+	return s.executeCommand("USE GRAPH " + fields[1])
+}
+
+// formatGraphList renders the graphs for \graphs, marking current with *.
+func formatGraphList(graphs []string, current string) string {
+	if len(graphs) == 0 {
+		return "No graphs defined\n"
+	}
+	sorted := append([]string(nil), graphs...)
+	sort.Strings(sorted)
+	var b strings.Builder
+	for _, graph := range sorted {
+		marker := " "
+		if graph == current {
+			marker = "*"
+		}
+		fmt.Fprintf(&b, "%s %s\n", marker, graph)
+	}
+	return b.String()
+}
+
+// RunGraphs lists the graphs on a server, one per line. The list may come
+// from the response cache; see cachedFetch. --graph and --exclude-graph
+// narrow it to the selection, so a pattern can be checked before use.
+func RunGraphs(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
+	user, _ := cmd.Flags().GetString("user")
+	password, _ := cmd.Flags().GetString("password")
+	host, _ := cmd.Flags().GetString("host")
+	gsPort, _ := cmd.Flags().GetString("gsPort")
+	output := helpers.OutputFormat(cmd)
+	ttl, noCache := responseCacheSettings(cmd)
+	selection := graphSelectionFlags(cmd)
+
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fmt.Fprintf(os.Stderr, "Alias %s not found. Try: tg conf list\n", alias)
+			helpers.Exit(1)
+		}
+		warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
+		host, user, password, gsPort = machineConfig.Host, machineConfig.User, machineConfig.Password, machineConfig.GSPort
+	}
+	fullHost := fmt.Sprintf("%s:%s", host, gsPort)
+
+	key := responseCacheKey(alias, user, fullHost, "graphs")
+	data, fetchedAt, err := cachedFetch(key, ttl, noCache, func() ([]byte, error) {
+		session := &GSQLSession{
+			Alias:    alias,
+			Host:     fullHost,
+			User:     user,
+			Password: password,
+			Client:   newServerClient(cmd, alias, 60*time.Second),
+			// The login's welcome message is not part of the list.
+			Messages: os.Stderr,
+		}
+		if err := session.login(); err != nil {
+			return nil, fmt.Errorf("logging in: %v", err)
+		}
+		graphs, err := session.listGraphs()
+		if err != nil {
+			return nil, err
+		}
+		sort.Strings(graphs)
+		return json.Marshal(graphs)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	var graphs []string
+	json.Unmarshal(data, &graphs)
+	if !selection.Empty() {
+		if graphs, err = selection.Resolve(graphs); err != nil {
+			fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+	}
+	if age := helpers.Now().Sub(fetchedAt); age >= time.Second {
+		fmt.Fprintf(os.Stderr, "Graph list cached %s ago; --no-cache fetches it again\n", age.Round(time.Second))
+	}
+
+	if output == "json" {
+		encoded, _ := json.Marshal(map[string]interface{}{"graphs": graphs, "fetchedAt": fetchedAt.UTC().Format(time.RFC3339)})
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(encoded)))
+		return
+	}
+	for _, graph := range graphs {
+		fmt.Fprintln(helpers.Stdout(), graph)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestGraphSelectionResolve(t *testing.T) {
+	available := []string{"social", "cust_acme", "cust_globex", "fraud"}
+
+	tests := []struct {
+		name      string
+		selection GraphSelection
+		expected  []string
+		errText   string
+	}{
+		{"everything", GraphSelection{}, []string{"cust_acme", "cust_globex", "fraud", "social"}, ""},
+		{"single graph", GraphSelection{Include: []string{"social"}}, []string{"social"}, ""},
+		{"glob", GraphSelection{Include: []string{"cust_*"}}, []string{"cust_acme", "cust_globex"}, ""},
+		{"overlapping includes", GraphSelection{Include: []string{"cust_*", "cust_acme"}}, []string{"cust_acme", "cust_globex"}, ""},
+		{"exclude only", GraphSelection{Exclude: []string{"cust_*"}}, []string{"fraud", "social"}, ""},
+		{"include and exclude", GraphSelection{Include: []string{"cust_*"}, Exclude: []string{"cust_globex"}}, []string{"cust_acme"}, ""},
+		{"unknown graph", GraphSelection{Include: []string{"socail"}}, nil, `graph "socail" not found (available: cust_acme, cust_globex, fraud, social)`},
+		{"unknown exclusion", GraphSelection{Exclude: []string{"nope_*"}}, nil, `graph "nope_*" not found`},
+		{"bad pattern", GraphSelection{Include: []string{"cust_["}}, nil, `invalid graph pattern "cust_["`},
+		{"nothing left", GraphSelection{Include: []string{"fraud"}, Exclude: []string{"f*"}}, nil, "no graphs left"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.selection.Resolve(available)
+			if tt.errText != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.errText) {
+					t.Errorf("Expected error containing %q, got %v", tt.errText, err)
+				}
+				return
+			}
+			if err != nil || !reflect.DeepEqual(got, tt.expected) {
+				t.Errorf("Resolve = %v (%v), expected %v", got, err, tt.expected)
+			}
+		})
+	}
+
+	if _, err := (GraphSelection{}).Resolve(nil); err == nil || !strings.Contains(err.Error(), "available: none") {
+		t.Errorf("Expected an error for an empty catalog, got %v", err)
+	}
+}
+
+func TestListGraphs(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("  - Graph social(Person:v, Friend:e)\n  - Graph cust_acme(Account:v)\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer server.Close()
+
+	session := &GSQLSession{Host: server.URL, Client: server.Client()}
+	graphs, err := session.listGraphs()
+	if err != nil || !reflect.DeepEqual(graphs, []string{"social", "cust_acme"}) {
+		t.Errorf("listGraphs = %v (%v)", graphs, err)
+	}
+}
+
+func TestGraphMetaCommands(t *testing.T) {
+	var commands []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		command := string(body)
+		commands = append(commands, command)
+		if strings.Contains(command, "SHOW GRAPH") {
+			w.Write([]byte("  - Graph social(Person:v, Friend:e)\n  - Graph cust_acme(Account:v)\n__GSQL__RETURN__CODE__,0\n"))
+			return
+		}
+		w.Write([]byte("Using graph 'social'\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer server.Close()
+
+	session := &GSQLSession{Host: server.URL, Client: server.Client()}
+	for _, line := range []string{`\graphs`, `\use social`, `\use`, "USE GRAPH social"} {
+		if got, expected := isGraphCommand(line), strings.HasPrefix(line, `\`); got != expected {
+			t.Errorf("isGraphCommand(%q) = %v", line, got)
+		}
+	}
+
+	if err := session.runGraphCommand(`\use social`); err != nil {
+		t.Fatalf("\\use social: %v", err)
+	}
+	if session.Graph != "social" {
+		t.Errorf("Expected \\use to switch the session graph, got %q", session.Graph)
+	}
+
+	output := captureOutput(func() {
+		if err := session.runGraphCommand(`\graphs`); err != nil {
+			t.Errorf("\\graphs: %v", err)
+		}
+	})
+	if !strings.Contains(output, "  cust_acme\n* social\n") {
+		t.Errorf("Expected the sorted graphs with the current one marked, got %q", output)
+	}
+
+	for _, line := range []string{`\use`, `\use a b`, `\use bad-name`} {
+		if err := session.runGraphCommand(line); err == nil || !strings.Contains(err.Error(), "usage") {
+			t.Errorf("%s: expected a usage error, got %v", line, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// gsqlReturnCode is the marker line the GSQL server ends a command's output
+// with, followed by the command's exit status.
+const gsqlReturnCode = "__GSQL__RETURN__CODE__"
+
+var returnCodePattern = regexp.MustCompile(gsqlReturnCode + `,(-?\d+)`)
+
+// gsqlErrorPrefixes maps the line prefixes of the GSQL error formats to the
+// kind of failure they report. Prefixes ending in a colon are stripped from
+// the message.
+var gsqlErrorPrefixes = []struct {
+	prefix string
+	kind   string
+}{
+	{"Semantic Check Fails:", "semantic"},
+	{"Semantic Check Error:", "semantic"},
+	{"Syntax Error:", "syntax"},
+	{"Encountered \"", "syntax"},
+	{"Runtime Error:", "runtime"},
+	{"Error:", "error"},
+	{"ERROR:", "error"},
+	{"Failed to ", "error"},
+}
+
+// GSQLError is a GSQL command the server reported as failed.
+type GSQLError struct {
+	// Code is the return code the server sent, 0 when it sent none.
+	Code int
+	// Kind is "syntax", "semantic", "runtime" or "error".
+	Kind    string
+	Message string
+}
+
+func (e *GSQLError) Error() string {
+	return fmt.Sprintf("GSQL %s error (code %d): %s", e.Kind, e.Code, e.Message)
+}
+
+// parseGSQLError extracts the failure from a command's output. It returns
+// nil when the command succeeded: the return code is 0 or absent and no
+// line matches a known error format.
+func parseGSQLError(output string) *GSQLError {
+	var scanner gsqlErrorScanner
+	scanner.write(output)
+	return scanner.result()
+}
+
+// maxScannedLine bounds how much of a single line gsqlErrorScanner holds
+// while waiting for its end. Error formats are recognized by how a line
+// starts, so the rest of a longer line is not needed.
+const maxScannedLine = 64 << 10
+
+// gsqlErrorScanner looks for the failure in a command's output as it
+// streams in, keeping only the line in progress, the return code and the
+// first error line rather than the whole output.
+type gsqlErrorScanner struct {
+	partial string
+	code    int
+	err     *GSQLError
+}
+
+// write scans the complete lines in data, holding back a line that
+// continues in the next chunk.
+func (sc *gsqlErrorScanner) write(data string) {
+	lines := strings.Split(sc.partial+data, "\n")
+	sc.partial = lines[len(lines)-1]
+	if len(sc.partial) > maxScannedLine {
+		sc.partial = sc.partial[:maxScannedLine]
+	}
+	for _, line := range lines[:len(lines)-1] {
+		sc.scanLine(line)
+	}
+}
+
+func (sc *gsqlErrorScanner) scanLine(line string) {
+	if match := returnCodePattern.FindStringSubmatch(line); match != nil && sc.code == 0 {
+		sc.code, _ = strconv.Atoi(match[1])
+	}
+	line = strings.TrimSpace(line)
+	if sc.err != nil || strings.HasPrefix(line, "__GSQL__") {
+		return
+	}
+	for _, format := range gsqlErrorPrefixes {
+		if !strings.HasPrefix(line, format.prefix) {
+			continue
+		}
+		message := line
+		if strings.HasSuffix(format.prefix, ":") {
+			message = strings.TrimSpace(strings.TrimPrefix(line, format.prefix))
+		}
+		sc.err = &GSQLError{Kind: format.kind, Message: message}
+		return
+	}
+}
+
+// result scans the last line and returns the failure, if any.
+func (sc *gsqlErrorScanner) result() *GSQLError {
+	sc.scanLine(sc.partial)
+	sc.partial = ""
+	if sc.err != nil {
+		sc.err.Code = sc.code
+		return sc.err
+	}
+	if sc.code != 0 {
+		return &GSQLError{Code: sc.code, Kind: "error", Message: "command failed"}
+	}
+	return nil
+}
+
+// errLoginExpired reports that the server no longer accepts the session's
+// cookie, typically after a period of inactivity, and answered a command
+// with a login challenge instead of its output.
+var errLoginExpired = errors.New("GSQL session expired, please reconnect")
+
+// loginPrompt matches the first line of the GSQL server's own answer to a
+// request whose session it no longer knows.
+var loginPrompt = regexp.MustCompile(`(?i)^(login failed|(your )?session (has )?expired|please (re-?)?log ?in)\b`)
+
+// isLoginChallenge reports whether resp, whose output starts with head, is
+// a login challenge rather than command output: a 401, a redirect to a
+// login page, or an HTML page or login prompt where GSQL sends plain text.
+func isLoginChallenge(resp *http.Response, head string) bool {
+	if resp.StatusCode == http.StatusUnauthorized {
+		return true
+	}
+	if resp.Request != nil && strings.Contains(strings.ToLower(resp.Request.URL.Path), "login") {
+		return true
+	}
+	head = strings.ToLower(strings.TrimSpace(head))
+	return strings.HasPrefix(head, "<!doctype html") || strings.HasPrefix(head, "<html") || loginPrompt.MatchString(head)
+}
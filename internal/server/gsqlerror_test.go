@@ -0,0 +1,179 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParseGSQLError(t *testing.T) {
+	tests := []struct {
+		name     string
+		output   string
+		expected *GSQLError
+	}{
+		{
+			name:   "success",
+			output: "The graph social is created.\n__GSQL__RETURN__CODE__,0\n",
+		},
+		{
+			name:   "success without return code",
+			output: "  - Graph social(Person:v, Friend:e)\n",
+		},
+		{
+			name: "semantic check",
+			output: "Semantic Check Fails: The vertex type Persn does not exist.\n" +
+				"The query didn't pass the semantic check\n__GSQL__RETURN__CODE__,1\n",
+			expected: &GSQLError{Code: 1, Kind: "semantic", Message: "The vertex type Persn does not exist."},
+		},
+		{
+			name: "syntax",
+			output: "Encountered \" <IDENTIFIER> \"SELCT \"\" at line 1, column 1.\n" +
+				"Was expecting one of:\n    \"abort\" ...\n__GSQL__RETURN__CODE__,1\n",
+			expected: &GSQLError{Code: 1, Kind: "syntax", Message: "Encountered \" <IDENTIFIER> \"SELCT \"\" at line 1, column 1."},
+		},
+		{
+			name:     "runtime",
+			output:   "Runtime Error: divider is zero\n__GSQL__RETURN__CODE__,2\n",
+			expected: &GSQLError{Code: 2, Kind: "runtime", Message: "divider is zero"},
+		},
+		{
+			name:     "failure without return code",
+			output:   "Failed to create vertex types: [Person].\n",
+			expected: &GSQLError{Kind: "error", Message: "Failed to create vertex types: [Person]."},
+		},
+		{
+			name:     "return code without message",
+			output:   "Some output\n__GSQL__RETURN__CODE__,3\n",
+			expected: &GSQLError{Code: 3, Kind: "error", Message: "command failed"},
+		},
+		{
+			name:   "error text inside results",
+			output: "{\n  \"error\": false,\n  \"message\": \"Error: not at line start\"\n}\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := parseGSQLError(tt.output)
+			if tt.expected == nil {
+				if got != nil {
+					t.Errorf("Expected no error, got %v", got)
+				}
+				return
+			}
+			if got == nil || *got != *tt.expected {
+				t.Errorf("parseGSQLError = %+v, expected %+v", got, tt.expected)
+			}
+		})
+	}
+}
+
+func TestGSQLErrorScannerChunks(t *testing.T) {
+	output := "Semantic Check Fails: The vertex type Persn does not exist.\n" +
+		"The query didn't pass the semantic check\n__GSQL__RETURN__CODE__,1\n"
+	expected := GSQLError{Code: 1, Kind: "semantic", Message: "The vertex type Persn does not exist."}
+
+	// Chunks may split any line, including the error and the return code.
+	for _, size := range []int{1, 7, 20} {
+		var scanner gsqlErrorScanner
+		for i := 0; i < len(output); i += size {
+			scanner.write(output[i:min(i+size, len(output))])
+		}
+		if got := scanner.result(); got == nil || *got != expected {
+			t.Errorf("%d-byte chunks: got %+v, expected %+v", size, got, expected)
+		}
+	}
+
+	// A long line without an end is held only up to maxScannedLine.
+	var scanner gsqlErrorScanner
+	scanner.write("Error: ")
+	for i := 0; i < 100; i++ {
+		scanner.write(strings.Repeat("x", 4096))
+	}
+	if len(scanner.partial) > maxScannedLine {
+		t.Errorf("Expected at most %d bytes held, got %d", maxScannedLine, len(scanner.partial))
+	}
+	if got := scanner.result(); got == nil || got.Kind != "error" {
+		t.Errorf("Expected the long error line to be reported, got %+v", got)
+	}
+}
+
+func TestGSQLErrorMessage(t *testing.T) {
+	err := &GSQLError{Code: 1, Kind: "semantic", Message: "The vertex type Persn does not exist."}
+	if got := err.Error(); got != "GSQL semantic error (code 1): The vertex type Persn does not exist." {
+		t.Errorf("Unexpected message %q", got)
+	}
+}
+
+func TestExecuteCommandReturnsGSQLError(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Semantic Check Fails: The vertex type Persn does not exist.\n"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("__GSQL__RETURN__CODE__,1\n"))
+	}))
+	defer mockServer.Close()
+
+	session := &GSQLSession{
+		Host:   mockServer.URL,
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+
+	err := session.executeCommand("INTERPRET QUERY () FOR GRAPH social { SELECT s FROM Persn:s; }")
+	var gsqlErr *GSQLError
+	if !errors.As(err, &gsqlErr) || gsqlErr.Code != 1 || gsqlErr.Kind != "semantic" {
+		t.Errorf("Expected a semantic GSQLError with code 1, got %v", err)
+	}
+}
+
+func TestExpiredSession(t *testing.T) {
+	for name, handler := range map[string]http.HandlerFunc{
+		"unauthorized": func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusUnauthorized)
+		},
+		"login page": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("<!DOCTYPE html>\n<html><head><title>GraphStudio</title></head><body>Sign in</body></html>\n"))
+		},
+		"redirect": func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/login" {
+				w.Write([]byte("Username:\n"))
+				return
+			}
+			http.Redirect(w, r, "/login", http.StatusFound)
+		},
+		"login prompt": func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte("Login failed: session not found, please login again.\n"))
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			mockServer := httptest.NewServer(handler)
+			defer mockServer.Close()
+			session := &GSQLSession{Host: mockServer.URL, Client: mockServer.Client()}
+
+			var err error
+			output := captureOutput(func() { err = session.executeCommand("ls") })
+			if !errors.Is(err, errLoginExpired) || output != "" {
+				t.Errorf("Expected errLoginExpired and no output, got %v and %q", err, output)
+			}
+			if _, err := session.queryCommand("ls"); !errors.Is(err, errLoginExpired) {
+				t.Errorf("Expected queryCommand to report errLoginExpired, got %v", err)
+			}
+		})
+	}
+
+	// Output that merely mentions logins is not a challenge.
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Login sessions for tigergraph: 2\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer mockServer.Close()
+	session := &GSQLSession{Host: mockServer.URL, Client: mockServer.Client()}
+	if _, err := session.queryCommand("SHOW USER"); err != nil {
+		t.Errorf("Expected ordinary output to pass, got %v", err)
+	}
+	if errLoginExpired.Error() != "GSQL session expired, please reconnect" {
+		t.Errorf("Unexpected message %q", errLoginExpired)
+	}
+}
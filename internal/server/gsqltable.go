@@ -0,0 +1,178 @@
+package server
+
+import (
+	"encoding/csv"
+	"io"
+	"regexp"
+	"strings"
+)
+
+// tableBorder matches the +----+----+ lines GSQL draws around tables and
+// between their header and body.
+var tableBorder = regexp.MustCompile(`^\s*\+(-+\+)+\s*$`)
+
+// GSQLTable is one result table parsed from GSQL's text output.
+type GSQLTable struct {
+	Header []string
+	Rows   [][]string
+}
+
+// parseGSQLOutput splits command output into the result tables it holds and
+// the remaining text, in order. Protocol lines (__GSQL__...) are dropped.
+//
+// A table starts at a border line and runs while lines start with | or +.
+// The first block between borders is the header. When the body has a
+// border between every row, each block is one row and the lines of a block
+// are cells wrapped over several lines, joined with a space; otherwise each
+// line is a row.
+func parseGSQLOutput(output string) ([]GSQLTable, []string) {
+	var tables []GSQLTable
+	var text []string
+
+	lines := strings.Split(strings.ReplaceAll(output, "\r\n", "\n"), "\n")
+	for i := 0; i < len(lines); i++ {
+		line := lines[i]
+		if strings.HasPrefix(strings.TrimSpace(line), "__GSQL__") {
+			continue
+		}
+		if !tableBorder.MatchString(line) {
+			if strings.TrimSpace(line) != "" {
+				text = append(text, line)
+			}
+			continue
+		}
+
+		end := i + 1
+		for end < len(lines) {
+			trimmed := strings.TrimSpace(lines[end])
+			if !strings.HasPrefix(trimmed, "|") && !strings.HasPrefix(trimmed, "+") {
+				break
+			}
+			end++
+		}
+		if table, ok := parseGSQLTable(lines[i:end]); ok {
+			tables = append(tables, table)
+		} else {
+			text = append(text, lines[i:end]...)
+		}
+		i = end - 1
+	}
+	return tables, text
+}
+
+// parseGSQLTable parses the lines of one bordered table.
+func parseGSQLTable(lines []string) (GSQLTable, bool) {
+	columns := borderColumns(lines[0])
+
+	// Split the lines into the blocks between borders.
+	var blocks [][][]string
+	var block [][]string
+	for _, line := range lines[1:] {
+		if tableBorder.MatchString(line) {
+			if len(block) > 0 {
+				blocks = append(blocks, block)
+			}
+			block = nil
+			continue
+		}
+		block = append(block, splitTableRow(line, columns))
+	}
+	if len(block) > 0 {
+		blocks = append(blocks, block)
+	}
+	if len(blocks) == 0 {
+		return GSQLTable{}, false
+	}
+
+	table := GSQLTable{Header: joinWrapped(blocks[0], len(columns)-1)}
+	body := blocks[1:]
+	if len(body) == 1 {
+		table.Rows = body[0]
+		return table, true
+	}
+	for _, rowLines := range body {
+		table.Rows = append(table.Rows, joinWrapped(rowLines, len(columns)-1))
+	}
+	return table, true
+}
+
+// borderColumns returns the rune offsets of the + separators of a border.
+func borderColumns(border string) []int {
+	var offsets []int
+	for i, r := range []rune(strings.TrimRight(border, " ")) {
+		if r == '+' {
+			offsets = append(offsets, i)
+		}
+	}
+	if len(offsets) < 2 {
+		return nil
+	}
+	return offsets
+}
+
+// splitTableRow splits a | delimited line into its trimmed cells. The line
+// is split on | when it has exactly one per column boundary; a cell holding
+// a | itself falls back to the border's column offsets.
+func splitTableRow(line string, columns []int) []string {
+	count := len(columns) - 1
+	trimmed := strings.TrimSpace(line)
+	parts := strings.Split(trimmed, "|")
+	if len(parts) == count+2 {
+		cells := make([]string, count)
+		for i := range cells {
+			cells[i] = strings.TrimSpace(parts[i+1])
+		}
+		return cells
+	}
+
+	runes := []rune(strings.TrimRight(line, " "))
+	cells := make([]string, count)
+	for i := range cells {
+		start, end := columns[i]+1, columns[i+1]
+		if i == count-1 {
+			end = len(runes) - 1
+		}
+		if start >= len(runes) {
+			break
+		}
+		if end > len(runes) {
+			end = len(runes)
+		}
+		if end > start {
+			cells[i] = strings.TrimSpace(string(runes[start:end]))
+		}
+	}
+	return cells
+}
+
+// joinWrapped joins the lines of a wrapped row cell by cell.
+func joinWrapped(lines [][]string, count int) []string {
+	cells := make([]string, count)
+	for _, line := range lines {
+		for i := 0; i < count && i < len(line); i++ {
+			if line[i] == "" {
+				continue
+			}
+			if cells[i] != "" {
+				cells[i] += " "
+			}
+			cells[i] += line[i]
+		}
+	}
+	return cells
+}
+
+// writeDelimited writes table as CSV or, with format "tsv", tab separated.
+func writeDelimited(w io.Writer, table GSQLTable, format string) error {
+	writer := csv.NewWriter(w)
+	if format == "tsv" {
+		writer.Comma = '\t'
+	}
+	if err := writer.Write(table.Header); err != nil {
+		return err
+	}
+	if err := writer.WriteAll(table.Rows); err != nil {
+		return err
+	}
+	return writer.Error()
+}
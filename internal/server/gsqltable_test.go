@@ -0,0 +1,152 @@
+package server
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/zrougamed/tgCli/internal/outputtest"
+)
+
+// readSample reads a sample of GSQL output from testdata. The samples are
+// synthetic, written by hand in the shape of GSQL's bordered tables rather
+// than captured from a server.
+func readSample(t *testing.T, name string) string {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatalf("Failed to read %s: %v", name, err)
+	}
+	return string(data)
+}
+
+func TestParseGSQLOutputSimple(t *testing.T) {
+	tables, text := parseGSQLOutput(readSample(t, "gsql_table_simple.txt"))
+	if len(tables) != 1 {
+		t.Fatalf("Expected one table, got %d", len(tables))
+	}
+	expected := GSQLTable{
+		Header: []string{"name", "age", "city"},
+		Rows:   [][]string{{"alice", "31", "Lyon"}, {"bob", "27", "Paris"}, {"charlie", "", "São Paulo"}},
+	}
+	if !reflect.DeepEqual(tables[0], expected) {
+		t.Errorf("Unexpected table %+v", tables[0])
+	}
+	if !reflect.DeepEqual(text, []string{"Using graph 'social'", "3 rows in set"}) {
+		t.Errorf("Protocol lines should be dropped and the rest kept, got %q", text)
+	}
+}
+
+func TestParseGSQLOutputWrapped(t *testing.T) {
+	tables, text := parseGSQLOutput(readSample(t, "gsql_table_wrapped.txt"))
+	if len(tables) != 1 || len(text) != 0 {
+		t.Fatalf("Expected one table and no text, got %d tables and %q", len(tables), text)
+	}
+	expected := [][]string{
+		{"etl_loader", "Used by the nightly ETL job to load customer data"},
+		{"报表_service", "季度报表服务"},
+		{"ünïcødé 🚀", `émoji and accents, with a "quoted" word, and commas`},
+	}
+	if !reflect.DeepEqual(tables[0].Rows, expected) {
+		t.Errorf("Unexpected rows %q", tables[0].Rows)
+	}
+}
+
+func TestParseGSQLOutputMultiple(t *testing.T) {
+	tables, text := parseGSQLOutput(readSample(t, "gsql_table_multiple.txt"))
+	if len(tables) != 2 {
+		t.Fatalf("Expected two tables, got %d", len(tables))
+	}
+	if !reflect.DeepEqual(tables[1].Rows, [][]string{{"works_at", "Person|Company"}, {"knows", "Person-Person"}}) {
+		t.Errorf("A | inside a cell should not split it, got %q", tables[1].Rows)
+	}
+	if !reflect.DeepEqual(text, []string{"Vertex types:", "Edge types:"}) {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func TestParseGSQLOutputNoTable(t *testing.T) {
+	tables, text := parseGSQLOutput("Successfully created graph social.\n+---+\n__GSQL__RETURN__CODE__,0\n")
+	if len(tables) != 0 {
+		t.Errorf("Expected no tables, got %+v", tables)
+	}
+	if len(text) != 2 {
+		t.Errorf("Expected the text lines back, got %q", text)
+	}
+}
+
+func TestWriteDelimitedGolden(t *testing.T) {
+	for _, tt := range []struct {
+		sample, format, golden string
+	}{
+		{"gsql_table_simple.txt", "csv", "gsql_csv_simple"},
+		{"gsql_table_wrapped.txt", "csv", "gsql_csv_wrapped"},
+		{"gsql_table_multiple.txt", "tsv", "gsql_tsv_multiple"},
+	} {
+		tables, _ := parseGSQLOutput(readSample(t, tt.sample))
+		var b bytes.Buffer
+		for i, table := range tables {
+			if i > 0 {
+				b.WriteString("\n")
+			}
+			if err := writeDelimited(&b, table, tt.format); err != nil {
+				t.Fatalf("writeDelimited failed: %v", err)
+			}
+		}
+		outputtest.AssertGolden(t, tt.golden, b.Bytes())
+	}
+}
+
+func TestRunSingleCommandCSV(t *testing.T) {
+	sample := readSample(t, "gsql_table_multiple.txt")
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(sample))
+	}))
+	defer server.Close()
+	session := &GSQLSession{Host: server.URL, Client: server.Client()}
+
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	var data bytes.Buffer
+	err := session.runSingleCommand(strings.NewReader("ls"), "csv", "", &data)
+	w.Close()
+	os.Stderr = oldStderr
+	var stderr bytes.Buffer
+	stderr.ReadFrom(r)
+
+	if err != nil {
+		t.Fatalf("runSingleCommand failed: %v", err)
+	}
+	expected := "Type,Count\nPerson,1200\nCompany,85\n\nType,Pattern\nworks_at,Person|Company\nknows,Person-Person\n"
+	if data.String() != expected {
+		t.Errorf("Unexpected data:\n%s", data.String())
+	}
+	if stderr.String() != "Vertex types:\nEdge types:\n" {
+		t.Errorf("Text around the tables should go to stderr, got %q", stderr.String())
+	}
+
+	// Tables are numbered across a session, so a fresh one starts at 1.
+	session = &GSQLSession{Host: server.URL, Client: server.Client()}
+	prefix := filepath.Join(t.TempDir(), "report")
+	captureOutput(func() {
+		os.Stderr, _ = os.Open(os.DevNull)
+		defer func() { os.Stderr = oldStderr }()
+		err = session.runSingleCommand(strings.NewReader("ls"), "tsv", prefix, &data)
+	})
+	if err != nil {
+		t.Fatalf("runSingleCommand failed: %v", err)
+	}
+	second, _ := os.ReadFile(prefix + "2.tsv")
+	if !strings.HasPrefix(string(second), "Type\tPattern\nworks_at\tPerson|Company\n") {
+		t.Errorf("Unexpected second file:\n%s", second)
+	}
+	if _, err := os.Stat(prefix + "1.tsv"); err != nil {
+		t.Errorf("Expected the first table in its own file: %v", err)
+	}
+}
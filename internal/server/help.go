@@ -0,0 +1,39 @@
+package server
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zrougamed/tgCli/internal/docs"
+	"github.com/zrougamed/tgCli/internal/examples"
+)
+
+func isHelpCommand(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && fields[0] == `\help`
+}
+
+// runHelpCommand handles \help, which lists the GSQL reference topics, and
+// \help <statement>, which shows one. The reference follows the version
+// the session logged in with.
+func (s *GSQLSession) runHelpCommand(line string) error {
+	ref, err := docs.ForVersion(s.Version)
+	if err != nil {
+		return err
+	}
+	query := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), `\help`))
+	if query == "" {
+		docs.Page(ref.List())
+		s.capture.output(ref.List())
+		return nil
+	}
+	topic, err := ref.Lookup(query)
+	if err != nil {
+		return fmt.Errorf(`%v; \help lists the topics`, err)
+	}
+	// The pager writes to the terminal itself; the transcript gets the
+	// topic without colors.
+	docs.Page(ref.Render(topic, examples.UseColor()))
+	s.capture.output(ref.Render(topic, false))
+	return nil
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHelpCommand(t *testing.T) {
+	session := &GSQLSession{Version: "3.6.2"}
+
+	out := captureOutput(func() { session.startInteractiveSession(strings.NewReader("\\help post-accum\nquit\n")) })
+	if !strings.Contains(out, "SELECT  (GSQL 3.x)") || !strings.Contains(out, "POST-ACCUM") {
+		t.Errorf("Expected the 3.x SELECT topic, got:\n%s", out)
+	}
+
+	out = captureOutput(func() { session.runHelpCommand(`\help`) })
+	if !strings.HasPrefix(out, "GSQL 3.x topics:") || !strings.Contains(out, "loading-job") {
+		t.Errorf("Expected the topic list, got:\n%s", out)
+	}
+
+	err := session.runHelpCommand(`\help opencypher`)
+	if err == nil || err.Error() != `no GSQL 3.x topic matches "opencypher"; \help lists the topics` {
+		t.Errorf("Expected 4.x topics to be missing on a 3.x server, got %v", err)
+	}
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// The interactive shell appends every statement it runs to historyFile,
+// ~/.tgcli/gsql_history by default, one entry per line; a statement of
+// several lines continues with a trailing backslash. Once the file holds
+// gsql.history_size entries (defaultHistorySize; 0 turns history off) it
+// is rotated to gsql_history.1, replacing the previous one.
+var historyFile string
+
+const (
+	defaultHistorySize = 1000
+	// historyShown is how many entries \history lists by default.
+	historyShown = 20
+)
+
+// gsqlHistory is the shell's persistent history.
+type gsqlHistory struct {
+	path  string
+	size  int
+	scrub []*regexp.Regexp
+}
+
+func historyPath() string {
+	if historyFile != "" {
+		return historyFile
+	}
+	return filepath.Join(constants.ConfigDir, "gsql_history")
+}
+
+// openHistory reads the history settings from the config. Patterns in
+// gsql.history_scrub that do not compile are reported and skipped.
+func openHistory() *gsqlHistory {
+	h := &gsqlHistory{path: historyPath(), size: defaultHistorySize}
+	if viper.IsSet("gsql.history_size") {
+		h.size = viper.GetInt("gsql.history_size")
+	}
+	var errs []error
+	h.scrub, errs = helpers.ScrubPatterns()
+	for _, err := range errs {
+		helpers.Warn(helpers.WarnHistory, "%v", err)
+	}
+	return h
+}
+
+// add appends statement, scrubbed, rotating the file when it is full.
+func (h *gsqlHistory) add(statement string) error {
+	if h == nil || h.size <= 0 {
+		return nil
+	}
+	statement = strings.TrimSpace(strings.ReplaceAll(statement, "\r\n", "\n"))
+	if statement == "" {
+		return nil
+	}
+	entries, err := h.entries()
+	if err != nil {
+		return err
+	}
+	if len(entries) >= h.size {
+		if err := os.Rename(h.path, h.path+".1"); err != nil {
+			return err
+		}
+	}
+	if err := os.MkdirAll(filepath.Dir(h.path), 0700); err != nil {
+		return err
+	}
+	file, err := os.OpenFile(h.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	// Files written before history was scrubbed may be more open.
+	os.Chmod(h.path, 0600)
+	entry := strings.ReplaceAll(helpers.ScrubStatement(statement, h.scrub), "\n", "\\\n")
+	if _, err := file.WriteString(entry + "\n"); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// entries returns the statements in the current history file, oldest
+// first.
+func (h *gsqlHistory) entries() ([]string, error) {
+	data, err := os.ReadFile(h.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var entries []string
+	var current []string
+	for _, line := range strings.Split(strings.TrimRight(string(data), "\n"), "\n") {
+		if strings.HasSuffix(line, `\`) {
+			current = append(current, strings.TrimSuffix(line, `\`))
+			continue
+		}
+		entries = append(entries, strings.Join(append(current, line), "\n"))
+		current = nil
+	}
+	return entries, nil
+}
+
+// clear removes the history and its rotated file.
+func (h *gsqlHistory) clear() error {
+	for _, path := range []string{h.path, h.path + ".1"} {
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+	return nil
+}
+
+// isHistoryCommand reports whether line is a \history meta-command.
+func isHistoryCommand(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && fields[0] == `\history`
+}
+
+// runHistoryCommand handles \history [N], which lists the last N entries,
+// and \history clear.
+func (s *GSQLSession) runHistoryCommand(line string) error {
+	if s.history == nil {
+		return fmt.Errorf("history is not kept for this session")
+	}
+	fields := strings.Fields(line)
+	if len(fields) > 2 {
+		return fmt.Errorf(`usage: \history [N] or \history clear`)
+	}
+
+	count := historyShown
+	if len(fields) == 2 {
+		if fields[1] == "clear" {
+			if err := s.history.clear(); err != nil {
+				return err
+			}
+			fmt.Fprintln(s.out(), "History cleared")
+			return nil
+		}
+		n, err := strconv.Atoi(fields[1])
+		if err != nil || n < 1 {
+			return fmt.Errorf(`usage: \history [N] or \history clear`)
+		}
+		count = n
+	}
+
+	entries, err := s.history.entries()
+	if err != nil {
+		return err
+	}
+	first := len(entries) - count
+	if first < 0 {
+		first = 0
+	}
+	for i := first; i < len(entries); i++ {
+		fmt.Fprintf(s.out(), "%5d  %s\n", i+1, strings.ReplaceAll(entries[i], "\n", "\n       "))
+	}
+	return nil
+}
+
+// remember adds statement to the session's history, warning once if the
+// history cannot be written.
+func (s *GSQLSession) remember(statement string) {
+	if err := s.history.add(statement); err != nil && !s.historyWarned {
+		helpers.Warn(helpers.WarnHistory, "could not write GSQL history: %v", err)
+		s.historyWarned = true
+	}
+}
@@ -0,0 +1,112 @@
+package server
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/viper"
+)
+
+// useHistory keeps the history in a temp dir with the given config.
+func useHistory(t *testing.T, size int, scrub ...string) *gsqlHistory {
+	t.Helper()
+	original := historyFile
+	historyFile = filepath.Join(t.TempDir(), "gsql_history")
+	t.Cleanup(func() { historyFile = original })
+	viper.Set("gsql.history_size", size)
+	viper.Set("gsql.history_scrub", scrub)
+	t.Cleanup(func() {
+		viper.Set("gsql.history_size", nil)
+		viper.Set("gsql.history_scrub", nil)
+	})
+	return openHistory()
+}
+
+func TestHistoryInvalidScrubPattern(t *testing.T) {
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+	h := useHistory(t, 10, "(unclosed")
+	w.Close()
+	os.Stderr = oldStderr
+	stderr, _ := io.ReadAll(r)
+	output := string(stderr)
+	if !strings.Contains(output, `ignoring gsql.history_scrub pattern "(unclosed"`) || len(h.scrub) == 0 {
+		t.Errorf("Expected the bad pattern to be skipped, got %q and %d patterns", output, len(h.scrub))
+	}
+}
+
+func TestHistoryAddAndRotate(t *testing.T) {
+	h := useHistory(t, 2)
+	for _, statement := range []string{"USE GRAPH social", "  \n", "CREATE USER alice PASSWORD 'x'\nGRANT ROLE r TO alice", "SHOW VERTEX *"} {
+		if err := h.add(statement); err != nil {
+			t.Fatalf("add(%q) failed: %v", statement, err)
+		}
+	}
+
+	entries, _ := h.entries()
+	if strings.Join(entries, "|") != "SHOW VERTEX *" {
+		t.Errorf("Expected a fresh file after rotating, got %q", entries)
+	}
+	rotated, err := os.ReadFile(h.path + ".1")
+	if err != nil || string(rotated) != "USE GRAPH social\nCREATE USER alice PASSWORD '***'\\\nGRANT ROLE r TO alice\n" {
+		t.Errorf("Unexpected rotated history %q (%v)", rotated, err)
+	}
+	if info, err := os.Stat(h.path); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the history to be 0600, got %v (%v)", info.Mode(), err)
+	}
+
+	// Older files are tightened on the next write.
+	os.Chmod(h.path, 0644)
+	h.add("SHOW EDGE *")
+	if info, _ := os.Stat(h.path); info.Mode().Perm() != 0600 {
+		t.Errorf("Expected the history to be made 0600, got %v", info.Mode())
+	}
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	h := useHistory(t, 0)
+	h.add("SHOW VERTEX *")
+	if _, err := os.Stat(h.path); !os.IsNotExist(err) {
+		t.Errorf("A history size of 0 should write nothing, got %v", err)
+	}
+}
+
+func TestHistoryCommand(t *testing.T) {
+	var received []string
+	session := mockCommandServer(t, &received)
+	session.history = useHistory(t, 100)
+
+	input := strings.Join([]string{
+		"USE GRAPH social",
+		"ALTER USER bob PASSWORD 'hunter2'",
+		`\history`,
+		`\history 1`,
+		`\history clear`,
+		`\history`,
+		`\history nope`,
+		"exit",
+	}, "\n") + "\n"
+	output := captureOutput(func() { session.startInteractiveSession(strings.NewReader(input)) })
+
+	if len(received) != 2 {
+		t.Errorf("Meta-commands should not be sent to the server, got %q", received)
+	}
+	for _, expected := range []string{
+		"    1  USE GRAPH social\n    2  ALTER USER bob PASSWORD '***'\nGSQL >     2  ALTER USER bob PASSWORD '***'\nGSQL > History cleared\n",
+		`usage: \history [N] or \history clear`,
+	} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in:\n%s", expected, output)
+		}
+	}
+	if strings.Contains(output, "hunter2") {
+		t.Errorf("The password should not be shown:\n%s", output)
+	}
+	if _, err := os.Stat(session.history.path); !os.IsNotExist(err) {
+		t.Errorf("Expected \\history clear to remove the file, got %v", err)
+	}
+}
@@ -0,0 +1,57 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// defaultInitFile is the init file read when neither --init-file nor
+// gsql.init-file names one. It is optional.
+func defaultInitFile() string {
+	return filepath.Join(constants.ConfigDir, "gsqlrc")
+}
+
+// initFilePath resolves the init file: --init-file, then gsql.init-file in
+// the config, then defaultInitFile. explicit reports whether it was named,
+// in which case it must exist. An empty --init-file turns it off.
+func initFilePath(cmd *cobra.Command) (path string, explicit bool) {
+	if flag := cmd.Flags().Lookup("init-file"); flag != nil && flag.Changed {
+		return flag.Value.String(), true
+	}
+	if path := viper.GetString("gsql.init-file"); path != "" {
+		return path, true
+	}
+	return defaultInitFile(), false
+}
+
+// runInitFile runs the GSQL in the file at path after login, before the
+// interactive prompt, without echoing its output, e.g. SET parameters or
+// USE GRAPH. A missing file is only an error when explicit.
+func (s *GSQLSession) runInitFile(path string, explicit bool) error {
+	if path == "" {
+		return nil
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) && !explicit {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	statements := strings.TrimSpace(string(data))
+	if statements == "" {
+		return nil
+	}
+	if _, err := s.queryCommand(statements); err != nil {
+		return fmt.Errorf("running init file %s: %w", path, err)
+	}
+	s.trackGraph(statements)
+	return nil
+}
@@ -0,0 +1,101 @@
+package server
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+func TestInitFilePath(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+	originalDir := constants.ConfigDir
+	constants.ConfigDir = "/home/me/.tgcli"
+	defer func() { constants.ConfigDir = originalDir }()
+
+	newCmd := func(args ...string) *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("init-file", "", "")
+		cmd.Flags().Parse(args)
+		return cmd
+	}
+
+	if path, explicit := initFilePath(newCmd()); path != "/home/me/.tgcli/gsqlrc" || explicit {
+		t.Errorf("Expected the optional default, got %q (explicit %v)", path, explicit)
+	}
+	viper.Set("gsql.init-file", "/etc/tg/gsqlrc")
+	if path, explicit := initFilePath(newCmd()); path != "/etc/tg/gsqlrc" || !explicit {
+		t.Errorf("Expected the configured file, got %q (explicit %v)", path, explicit)
+	}
+	if path, _ := initFilePath(newCmd("--init-file", "setup.gsql")); path != "setup.gsql" {
+		t.Errorf("Expected the flag to win, got %q", path)
+	}
+	if path, _ := initFilePath(newCmd("--init-file=")); path != "" {
+		t.Errorf("Expected an empty --init-file to turn it off, got %q", path)
+	}
+}
+
+func TestRunInitFile(t *testing.T) {
+	var commands []string
+	server := mockUseGraph(t, &commands)
+	session := &GSQLSession{Host: server.URL, Client: server.Client()}
+	dir := t.TempDir()
+	path := filepath.Join(dir, "gsqlrc")
+	os.WriteFile(path, []byte("\nSET json_api = \"v2\"\nUSE GRAPH social\n"), 0600)
+
+	var err error
+	output := captureOutput(func() { err = session.runInitFile(path, false) })
+	if err != nil {
+		t.Fatalf("runInitFile failed: %v", err)
+	}
+	if len(commands) != 1 || commands[0] != "SET json_api = \"v2\"\nUSE GRAPH social" {
+		t.Errorf("Expected the file to be sent as one command, got %q", commands)
+	}
+	if session.Graph != "social" {
+		t.Errorf("Expected USE GRAPH in the init file to set the graph, got %q", session.Graph)
+	}
+	if output != "" {
+		t.Errorf("Expected the init file to run quietly, got %q", output)
+	}
+
+	commands = nil
+	if err := session.runInitFile(filepath.Join(dir, "missing"), false); err != nil {
+		t.Errorf("A missing default init file should be skipped, got %v", err)
+	}
+	if err := session.runInitFile(filepath.Join(dir, "missing"), true); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("A missing named init file should fail, got %v", err)
+	}
+	os.WriteFile(path, []byte("  \n"), 0600)
+	if err := session.runInitFile(path, true); err != nil || len(commands) != 0 {
+		t.Errorf("An empty init file should send nothing, got %v and %q", err, commands)
+	}
+	if err := session.runInitFile("", true); err != nil {
+		t.Errorf("No init file should not fail, got %v", err)
+	}
+}
+
+func TestRunInitFileFails(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Semantic Check Fails: The graph nope does not exist.\n__GSQL__RETURN__CODE__,1\n"))
+	}))
+	defer server.Close()
+	session := &GSQLSession{Host: server.URL, Client: server.Client(), Graph: "social"}
+	path := filepath.Join(t.TempDir(), "gsqlrc")
+	os.WriteFile(path, []byte("USE GRAPH nope\n"), 0600)
+
+	err := session.runInitFile(path, false)
+	var gsqlErr *GSQLError
+	if !errors.As(err, &gsqlErr) {
+		t.Fatalf("Expected the GSQL error, got %v", err)
+	}
+	if session.Graph != "social" {
+		t.Errorf("A failed init file should keep the graph, got %q", session.Graph)
+	}
+}
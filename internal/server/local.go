@@ -0,0 +1,307 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"os/user"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/events"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// When tg runs on a TigerGraph node, --local drives gadmin and gbar
+// directly instead of going through the HTTP API. The installation is
+// found through the .tg.cfg the installer writes to the tigergraph user's
+// home, or else through the log path a server on this machine reports.
+
+// commandRunner runs the TigerGraph tools; tests replace localRunner with a
+// fake gadmin.
+type commandRunner interface {
+	LookPath(name string) (string, error)
+	Run(name string, args []string, stdout, stderr io.Writer) error
+}
+
+type execRunner struct{}
+
+func (execRunner) LookPath(name string) (string, error) {
+	return exec.LookPath(name)
+}
+
+func (execRunner) Run(name string, args []string, stdout, stderr io.Writer) error {
+	cmd := exec.Command(name, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = stdout
+	cmd.Stderr = stderr
+	return cmd.Run()
+}
+
+var (
+	localRunner commandRunner = execRunner{}
+	// tgConfigFiles lists where the installer's .tg.cfg may be.
+	tgConfigFiles = defaultTGConfigFiles
+)
+
+var errNoLocalInstall = errors.New("no TigerGraph installation found on this machine")
+
+// localInstall is a TigerGraph installation on this machine.
+type localInstall struct {
+	Root    string `json:"root"`
+	AppRoot string `json:"appRoot,omitempty"`
+	// Source is the .tg.cfg the installation was found through, or
+	// /api/log.
+	Source string `json:"source"`
+}
+
+func defaultTGConfigFiles() []string {
+	var files []string
+	if home, err := os.UserHomeDir(); err == nil {
+		files = append(files, filepath.Join(home, ".tg.cfg"))
+	}
+	if tigergraph, err := user.Lookup("tigergraph"); err == nil {
+		if file := filepath.Join(tigergraph.HomeDir, ".tg.cfg"); len(files) == 0 || files[0] != file {
+			files = append(files, file)
+		}
+	}
+	return files
+}
+
+// readTGConfig reads the installation described by a .tg.cfg file.
+func readTGConfig(path string) (*localInstall, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var config struct {
+		System struct {
+			AppRoot string `json:"AppRoot"`
+		} `json:"System"`
+	}
+	if err := json.Unmarshal(data, &config); err != nil || config.System.AppRoot == "" {
+		return nil, fmt.Errorf("%s has no System.AppRoot", path)
+	}
+	// AppRoot is <root>/app/<version>.
+	appRoot := filepath.Clean(config.System.AppRoot)
+	root := filepath.Dir(appRoot)
+	if filepath.Base(root) == "app" {
+		root = filepath.Dir(root)
+	}
+	return &localInstall{Root: root, AppRoot: appRoot, Source: path}, nil
+}
+
+// findLocalInstall looks for a .tg.cfg first. Failing that, and when probe
+// is given, it asks the server for its log path and accepts the
+// installation root that path points to if it exists here.
+func findLocalInstall(probe func() (string, error)) (*localInstall, error) {
+	for _, path := range tgConfigFiles() {
+		install, err := readTGConfig(path)
+		if err == nil {
+			return install, nil
+		}
+		if !errors.Is(err, os.ErrNotExist) {
+			helpers.Warn(helpers.WarnLocalConfig, "%v", err)
+		}
+	}
+	if probe != nil {
+		if root, err := probe(); err == nil && root != "" {
+			if info, err := os.Stat(root); err == nil && info.IsDir() {
+				return &localInstall{Root: root, Source: "/api/log"}, nil
+			}
+		}
+	}
+	return nil, errNoLocalInstall
+}
+
+// tool returns the path of a TigerGraph command-line tool.
+func (i *localInstall) tool(name string) (string, error) {
+	candidates := []string{filepath.Join(i.Root, "app", "cmd", name)}
+	if i.AppRoot != "" {
+		candidates = append(candidates, filepath.Join(i.AppRoot, "bin", name))
+	}
+	for _, path := range candidates {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			return path, nil
+		}
+	}
+	if path, err := localRunner.LookPath(name); err == nil {
+		return path, nil
+	}
+	return "", fmt.Errorf("%s not found in %s or on PATH", name, i.Root)
+}
+
+// checkAccess makes sure the current user may manage the installation;
+// gadmin and gbar need to write to it, so that is what is tried.
+func (i *localInstall) checkAccess() error {
+	probe, err := os.CreateTemp(i.Root, ".tgcli-access-*")
+	if err != nil {
+		name := "the current user"
+		if current, err := user.Current(); err == nil {
+			name = "user " + current.Username
+		}
+		return fmt.Errorf("%s cannot write to %s; run tg as the TigerGraph installation owner, e.g. sudo -u tigergraph tg ...", name, i.Root)
+	}
+	probe.Close()
+	os.Remove(probe.Name())
+	return nil
+}
+
+// runTool runs a TigerGraph tool of install with its output streamed to
+// out, and returns its exit code.
+func (i *localInstall) runTool(out io.Writer, name string, args ...string) (int, error) {
+	if err := i.checkAccess(); err != nil {
+		return 1, err
+	}
+	path, err := i.tool(name)
+	if err != nil {
+		return 1, err
+	}
+	err = localRunner.Run(path, args, out, os.Stderr)
+	var exited interface{ ExitCode() int }
+	switch {
+	case err == nil:
+		return 0, nil
+	case errors.As(err, &exited) && exited.ExitCode() > 0:
+		return exited.ExitCode(), fmt.Errorf("%s %s exited with status %d", name, strings.Join(args, " "), exited.ExitCode())
+	default:
+		return 1, fmt.Errorf("running %s: %v", name, err)
+	}
+}
+
+// fetchLogRoot asks the server where it writes its logs and returns the
+// installation root above the log directory, or "" when the server does
+// not say.
+func fetchLogRoot(client *http.Client, fullHost, cookie string) (string, error) {
+	req, _ := http.NewRequest("GET", fullHost+"/api/log", nil)
+	req.Header.Set("Cookie", cookie)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != 200 {
+		return "", nil
+	}
+
+	var logResp struct {
+		Error   bool `json:"error"`
+		Results []struct {
+			Path string `json:"path"`
+		} `json:"results"`
+	}
+	body, _ := io.ReadAll(resp.Body)
+	if err := json.Unmarshal(body, &logResp); err != nil || logResp.Error || len(logResp.Results) == 0 {
+		return "", nil
+	}
+	return strings.Split(logResp.Results[0].Path, "/log/")[0], nil
+}
+
+// logRootProbe returns a probe for findLocalInstall that logs in with the
+// command's connection flags.
+func logRootProbe(cmd *cobra.Command, alias, host, gsPort, user, password string) func() (string, error) {
+	return func() (string, error) {
+		fullHost := fmt.Sprintf("%s:%s", host, gsPort)
+		client := newServerClient(cmd, alias, 10*time.Second)
+		cookie, err := adminLogin(client, fullHost, user, password)
+		if err != nil {
+			return "", err
+		}
+		return fetchLogRoot(client, fullHost, cookie)
+	}
+}
+
+// RunInstallDir prints the root of the TigerGraph installation on this
+// machine.
+func RunInstallDir(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
+	user, _ := cmd.Flags().GetString("user")
+	password, _ := cmd.Flags().GetString("password")
+	host, _ := cmd.Flags().GetString("host")
+	gsPort, _ := cmd.Flags().GetString("gsPort")
+	output := helpers.OutputFormat(cmd)
+
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fmt.Fprintf(os.Stderr, "Alias %s not found. Try: tg conf list\n", alias)
+			helpers.Exit(1)
+		}
+		warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
+		host, user, password, gsPort = machineConfig.Host, machineConfig.User, machineConfig.Password, machineConfig.GSPort
+	}
+
+	install, err := findLocalInstall(logRootProbe(cmd, alias, host, gsPort, user, password))
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v (looked for ~tigergraph/.tg.cfg and asked %s:%s for its log path)\n", err, host, gsPort)
+		helpers.Exit(1)
+	}
+	if output == "json" {
+		data, _ := json.Marshal(install)
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(data)))
+		return
+	}
+	fmt.Fprintln(helpers.Stdout(), install.Root)
+}
+
+// runLocalServices starts or stops the managed services with gadmin and
+// returns its exit code.
+func runLocalServices(ops string, probe func() (string, error), emitter *events.Emitter) int {
+	if ops != "start" && ops != "stop" {
+		err := fmt.Errorf("--local supports --ops start and stop, not %s", ops)
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		return 1
+	}
+	install, err := findLocalInstall(probe)
+	if err != nil {
+		err = fmt.Errorf("--local: %v", err)
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		return 1
+	}
+
+	emitter.Emit("services.requested", map[string]interface{}{"ops": ops, "services": managedServices})
+	code, err := install.runTool(emitter.Out(), "gadmin", append([]string{ops}, managedServices...)...)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+	}
+	return code
+}
+
+// runLocalBackup runs gbar backup under tag and returns its exit code.
+// gbar always backs up the whole cluster.
+func runLocalBackup(tag, option string, probe func() (string, error), emitter *events.Emitter) int {
+	install, err := findLocalInstall(probe)
+	if err != nil {
+		err = fmt.Errorf("--local: %v", err)
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+		return 1
+	}
+	if tag == "" {
+		tag = "tgcli-" + helpers.Now().Format("20060102-150405")
+	}
+	emitter.Emit("backup.path", map[string]interface{}{"path": install.Root})
+
+	args := []string{"backup", "-t", tag}
+	if option != "" {
+		args = append(args, option)
+	}
+	fmt.Fprintf(emitter.Out(), "Backing up %s as %s\n", install.Root, tag)
+	code, err := install.runTool(emitter.Out(), "gbar", args...)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+		emitter.Fail(err)
+	}
+	return code
+}
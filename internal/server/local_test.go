@@ -0,0 +1,190 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// fakeRunner stands in for gadmin and gbar.
+type fakeRunner struct {
+	calls [][]string
+	exit  int
+}
+
+type fakeExit int
+
+func (e fakeExit) Error() string { return fmt.Sprintf("exit status %d", int(e)) }
+func (e fakeExit) ExitCode() int { return int(e) }
+
+func (f *fakeRunner) LookPath(name string) (string, error) {
+	return "", errors.New("not on PATH")
+}
+
+func (f *fakeRunner) Run(name string, args []string, stdout, stderr io.Writer) error {
+	f.calls = append(f.calls, append([]string{filepath.Base(name)}, args...))
+	fmt.Fprintf(stdout, "%s output\n", filepath.Base(name))
+	if f.exit != 0 {
+		return fakeExit(f.exit)
+	}
+	return nil
+}
+
+func useFakeRunner(t *testing.T) *fakeRunner {
+	runner := &fakeRunner{}
+	original := localRunner
+	localRunner = runner
+	t.Cleanup(func() { localRunner = original })
+	return runner
+}
+
+// useTGConfig points installation detection at a .tg.cfg in a temporary
+// directory, describing an installation with gadmin and gbar when
+// installed is true.
+func useTGConfig(t *testing.T, installed bool) string {
+	dir := t.TempDir()
+	root := filepath.Join(dir, "tigergraph")
+	cfg := filepath.Join(dir, ".tg.cfg")
+	original := tgConfigFiles
+	tgConfigFiles = func() []string { return []string{cfg} }
+	t.Cleanup(func() { tgConfigFiles = original })
+	if !installed {
+		return root
+	}
+
+	os.MkdirAll(filepath.Join(root, "app", "cmd"), 0755)
+	for _, tool := range []string{"gadmin", "gbar"} {
+		os.WriteFile(filepath.Join(root, "app", "cmd", tool), []byte("#!/bin/sh\n"), 0755)
+	}
+	data, _ := json.Marshal(map[string]interface{}{"System": map[string]string{"AppRoot": filepath.Join(root, "app", "3.9.3")}})
+	os.WriteFile(cfg, data, 0644)
+	return root
+}
+
+func TestFindLocalInstallFromTGConfig(t *testing.T) {
+	root := useTGConfig(t, true)
+
+	install, err := findLocalInstall(nil)
+	if err != nil {
+		t.Fatalf("findLocalInstall: %v", err)
+	}
+	if install.Root != root || install.AppRoot != filepath.Join(root, "app", "3.9.3") {
+		t.Errorf("Unexpected installation %+v", install)
+	}
+	if path, err := install.tool("gadmin"); err != nil || path != filepath.Join(root, "app", "cmd", "gadmin") {
+		t.Errorf("tool(gadmin) = %q, %v", path, err)
+	}
+}
+
+func TestFindLocalInstallFromLogPath(t *testing.T) {
+	root := useTGConfig(t, false)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"error":   false,
+			"results": []map[string]string{{"path": root + "/log/gsql/log.INFO"}},
+		})
+	}))
+	defer server.Close()
+	probe := func() (string, error) { return fetchLogRoot(server.Client(), server.URL, "") }
+
+	// The server's installation is not on this machine.
+	if _, err := findLocalInstall(probe); !errors.Is(err, errNoLocalInstall) {
+		t.Fatalf("Expected errNoLocalInstall, got %v", err)
+	}
+
+	os.MkdirAll(root, 0755)
+	install, err := findLocalInstall(probe)
+	if err != nil {
+		t.Fatalf("findLocalInstall: %v", err)
+	}
+	if install.Root != root || install.Source != "/api/log" {
+		t.Errorf("Unexpected installation %+v", install)
+	}
+}
+
+func TestRunLocalServices(t *testing.T) {
+	useTGConfig(t, true)
+	runner := useFakeRunner(t)
+
+	output := captureOutput(func() {
+		if code := runLocalServices("stop", nil, nil); code != 0 {
+			t.Errorf("Expected exit code 0, got %d", code)
+		}
+	})
+	if !reflect.DeepEqual(runner.calls, [][]string{{"gadmin", "stop", "gpe", "gse", "restpp"}}) {
+		t.Errorf("Unexpected calls %v", runner.calls)
+	}
+	if !strings.Contains(output, "gadmin output") {
+		t.Errorf("gadmin output should be streamed through, got %q", output)
+	}
+
+	// gadmin's exit code is passed on.
+	runner.exit = 3
+	output = captureOutput(func() {
+		if code := runLocalServices("start", nil, nil); code != 3 {
+			t.Errorf("Expected exit code 3, got %d", code)
+		}
+	})
+	if !strings.Contains(output, "gadmin start gpe gse restpp exited with status 3") {
+		t.Errorf("Expected the failure to be reported, got %q", output)
+	}
+
+	output = captureOutput(func() {
+		if code := runLocalServices("ensure-started", nil, nil); code != 1 {
+			t.Errorf("Expected exit code 1, got %d", code)
+		}
+	})
+	if !strings.Contains(output, "--local supports --ops start and stop") {
+		t.Errorf("Unexpected output %q", output)
+	}
+}
+
+func TestRunLocalWithoutInstallation(t *testing.T) {
+	useTGConfig(t, false)
+	runner := useFakeRunner(t)
+
+	output := captureOutput(func() {
+		if code := runLocalServices("start", nil, nil); code != 1 {
+			t.Errorf("Expected exit code 1, got %d", code)
+		}
+	})
+	if !strings.Contains(output, "no TigerGraph installation found on this machine") {
+		t.Errorf("Expected a clear error, got %q", output)
+	}
+	if len(runner.calls) != 0 {
+		t.Errorf("Nothing should run without an installation, got %v", runner.calls)
+	}
+}
+
+func TestRunLocalBackup(t *testing.T) {
+	useTGConfig(t, true)
+	runner := useFakeRunner(t)
+
+	oldNow := helpers.Now
+	helpers.Now = func() time.Time { return time.Date(2026, 3, 4, 5, 6, 7, 0, time.UTC) }
+	defer func() { helpers.Now = oldNow }()
+
+	captureOutput(func() {
+		runLocalBackup("", "-D", nil, nil)
+		runLocalBackup("nightly", "", nil, nil)
+	})
+	expected := [][]string{
+		{"gbar", "backup", "-t", "tgcli-20260304-050607", "-D"},
+		{"gbar", "backup", "-t", "nightly"},
+	}
+	if !reflect.DeepEqual(runner.calls, expected) {
+		t.Errorf("Expected %v, got %v", expected, runner.calls)
+	}
+}
@@ -0,0 +1,107 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+)
+
+// envGSQLToken supplies --token without putting it on the command line,
+// where other users can read it in the process list.
+const envGSQLToken = "TG_GSQL_TOKEN"
+
+// externalAuth reads the auth material for --no-login-check: --cookie,
+// the GSQL session cookie as JSON or @path of a file holding it, and
+// --token or TG_GSQL_TOKEN, sent as a bearer token instead of the
+// password. At least one is required, and neither is accepted without
+// --no-login-check.
+func externalAuth(cmd *cobra.Command) (noLoginCheck bool, cookie *models.GSQLCookie, token string, err error) {
+	noLoginCheck, _ = cmd.Flags().GetBool("no-login-check")
+	cookieFlag, _ := cmd.Flags().GetString("cookie")
+	token, _ = cmd.Flags().GetString("token")
+	if !noLoginCheck {
+		if cookieFlag != "" || token != "" {
+			return false, nil, "", errors.New("--cookie and --token need --no-login-check")
+		}
+		return false, nil, "", nil
+	}
+
+	if token == "" {
+		token = os.Getenv(envGSQLToken)
+	}
+	if cookieFlag != "" {
+		cookie, err = parseSessionCookie(cookieFlag)
+		if err != nil {
+			return true, nil, "", err
+		}
+	}
+	if cookie == nil && strings.TrimSpace(token) == "" {
+		return true, nil, "", fmt.Errorf("--no-login-check needs a session --cookie or a --token (or %s)", envGSQLToken)
+	}
+	return true, cookie, strings.TrimSpace(token), nil
+}
+
+// parseSessionCookie reads a --cookie value. The cookie must name the
+// client commit it was issued for, which is how the server checks
+// compatibility without a login.
+func parseSessionCookie(value string) (*models.GSQLCookie, error) {
+	data := []byte(value)
+	if path, ok := strings.CutPrefix(value, "@"); ok {
+		var err error
+		if data, err = os.ReadFile(path); err != nil {
+			return nil, fmt.Errorf("--cookie: %v", err)
+		}
+	}
+	var cookie models.GSQLCookie
+	if err := json.Unmarshal(data, &cookie); err != nil {
+		return nil, fmt.Errorf("--cookie is not a GSQL session cookie: %v", err)
+	}
+	if cookie.ClientCommit == "" {
+		return nil, errors.New("--cookie has no clientCommit")
+	}
+	return &cookie, nil
+}
+
+// useExternalAuth readies s to run commands with auth material obtained
+// elsewhere, in place of a login. The version is the one the cookie was
+// issued for when tg knows its commit; without a cookie it is the newest
+// of s.Versions, as the first login probe would try.
+func (s *GSQLSession) useExternalAuth(cookie *models.GSQLCookie, token string) {
+	s.Token = token
+	if cookie != nil {
+		s.Cookie = *cookie
+		s.Version = versionForCommit(cookie.ClientCommit)
+		return
+	}
+	versions := s.Versions
+	if len(versions) == 0 {
+		versions, _ = probeVersions("")
+	}
+	s.Version = versions[0]
+	s.Cookie = models.GSQLCookie{ClientCommit: versionCommits[s.Version], GShellTest: true}
+}
+
+// versionForCommit returns the newest known version built from commit,
+// or "" for an unknown one.
+func versionForCommit(commit string) string {
+	var versions []string
+	for version, versionCommit := range versionCommits {
+		if versionCommit == commit {
+			versions = append(versions, version)
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return helpers.CompareVersions(versions[i], versions[j]) > 0
+	})
+	if len(versions) == 0 {
+		return ""
+	}
+	return versions[0]
+}
@@ -0,0 +1,125 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func noLoginCmd(flags map[string]string) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("no-login-check", false, "")
+	cmd.Flags().String("cookie", "", "")
+	cmd.Flags().String("token", "", "")
+	for name, value := range flags {
+		cmd.Flags().Set(name, value)
+	}
+	return cmd
+}
+
+func TestExternalAuth(t *testing.T) {
+	cookieFile := filepath.Join(t.TempDir(), "cookie.json")
+	os.WriteFile(cookieFile, []byte(`{"clientCommit":"`+versionCommits["3.6.0"]+`","fromGsqlServer":true}`), 0600)
+	t.Setenv(envGSQLToken, "")
+
+	tests := []struct {
+		name    string
+		flags   map[string]string
+		env     string
+		token   string
+		version string
+		err     string
+	}{
+		{name: "no flags", flags: nil},
+		{name: "token without the flag", flags: map[string]string{"token": "abc"}, err: "--cookie and --token need --no-login-check"},
+		{name: "no auth material", flags: map[string]string{"no-login-check": "true"}, err: "needs a session --cookie or a --token (or TG_GSQL_TOKEN)"},
+		{name: "token", flags: map[string]string{"no-login-check": "true", "token": "abc"}, token: "abc"},
+		{name: "token from env", flags: map[string]string{"no-login-check": "true"}, env: "xyz", token: "xyz"},
+		{name: "cookie file", flags: map[string]string{"no-login-check": "true", "cookie": "@" + cookieFile}, version: "3.6.1"},
+		{name: "inline cookie", flags: map[string]string{"no-login-check": "true", "cookie": `{"clientCommit":"unknown"}`}, version: ""},
+		{name: "cookie without commit", flags: map[string]string{"no-login-check": "true", "cookie": `{"gShellTest":true}`}, err: "--cookie has no clientCommit"},
+		{name: "bad cookie", flags: map[string]string{"no-login-check": "true", "cookie": "session=abc"}, err: "--cookie is not a GSQL session cookie"},
+		{name: "missing cookie file", flags: map[string]string{"no-login-check": "true", "cookie": "@/nonexistent/cookie.json"}, err: "--cookie: open /nonexistent/cookie.json"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv(envGSQLToken, tt.env)
+			noLoginCheck, cookie, token, err := externalAuth(noLoginCmd(tt.flags))
+			if tt.err != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.err) {
+					t.Errorf("Expected an error containing %q, got %v", tt.err, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("externalAuth failed: %v", err)
+			}
+			if token != tt.token || noLoginCheck != (tt.flags["no-login-check"] == "true") {
+				t.Errorf("Expected token %q, got %q (no-login-check %v)", tt.token, token, noLoginCheck)
+			}
+			if cookie != nil {
+				session := &GSQLSession{}
+				session.useExternalAuth(cookie, token)
+				if session.Version != tt.version || session.Cookie != *cookie {
+					t.Errorf("Expected version %q from the cookie, got %q", tt.version, session.Version)
+				}
+			}
+		})
+	}
+}
+
+func TestRunGSQLNoLoginCheck(t *testing.T) {
+	cleanup := setupServerTestEnvironment(t)
+	defer cleanup()
+	t.Setenv(envGSQLToken, "")
+
+	// An init file prepares interactive sessions only.
+	initFile := filepath.Join(t.TempDir(), "gsqlrc")
+	os.WriteFile(initFile, []byte("USE GRAPH other\n"), 0600)
+	viper.Set("gsql.init-file", initFile)
+
+	logins, files := 0, 0
+	var auth, cookie, command string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gsqlserver/gsql/login":
+			logins++
+		case "/gsqlserver/gsql/file":
+			files++
+			body := make([]byte, 64)
+			n, _ := r.Body.Read(body)
+			auth, cookie, command = r.Header.Get("Authorization"), r.Header.Get("Cookie"), string(body[:n])
+			w.Write([]byte("Graph social\n"))
+		}
+	}))
+	defer mockServer.Close()
+	u, _ := url.Parse(mockServer.URL)
+
+	cmd := noLoginCmd(map[string]string{"no-login-check": "true", "token": "abc"})
+	cmd.Flags().String("host", "http://"+u.Hostname(), "")
+	cmd.Flags().String("gsPort", u.Port(), "")
+	cmd.Flags().String("max-response-size", "0", "")
+	cmd.Flags().String("command", "ls", "")
+
+	out := captureOutput(func() { RunGSQL(cmd, nil) })
+
+	if logins != 0 {
+		t.Errorf("Expected no login request, got %d", logins)
+	}
+	if files != 1 || auth != "Bearer abc" || command != "ls" {
+		t.Errorf("Expected only ls to be sent with the token, got %d requests, the last %q with %q", files, command, auth)
+	}
+	if !strings.Contains(cookie, `"clientCommit":"`+versionCommits["3.6.2"]+`"`) {
+		t.Errorf("Expected the newest version's commit in the cookie, got %s", cookie)
+	}
+	if !strings.Contains(out, "Graph social") {
+		t.Errorf("Expected the command's output, got %q", out)
+	}
+}
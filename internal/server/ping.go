@@ -0,0 +1,155 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// pingPath is the RESTPP endpoint ping times. It does no work on the
+// server, so its latency is mostly network and request handling.
+const pingPath = "/echo"
+
+// pingInterval is the pause between ping requests; tests shorten it.
+var pingInterval = time.Second
+
+// PingStats summarizes a ping run. Latencies are in milliseconds and only
+// cover the requests that got a response.
+type PingStats struct {
+	Target   string    `json:"target"`
+	Sent     int       `json:"sent"`
+	Received int       `json:"received"`
+	Failed   int       `json:"failed"`
+	MinMs    float64   `json:"minMs"`
+	AvgMs    float64   `json:"avgMs"`
+	MaxMs    float64   `json:"maxMs"`
+	P95Ms    float64   `json:"p95Ms"`
+	Samples  []float64 `json:"samplesMs"`
+}
+
+// pingOnce sends one echo request and returns how long the full response
+// took. Any HTTP response counts as a reply; its status is returned so a
+// rejected request can be told apart.
+func pingOnce(client *http.Client, target string) (time.Duration, int, error) {
+	start := time.Now()
+	resp, err := client.Get(target)
+	if err != nil {
+		return 0, 0, unwrapSchemeMismatch(err)
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+	return time.Since(start), resp.StatusCode, nil
+}
+
+// summarizePing computes the statistics over the latencies of the replies.
+// p95 uses the nearest-rank method, so it is always an observed sample.
+func summarizePing(target string, sent int, latencies []time.Duration) PingStats {
+	stats := PingStats{Target: target, Sent: sent, Received: len(latencies), Failed: sent - len(latencies), Samples: []float64{}}
+	if len(latencies) == 0 {
+		return stats
+	}
+
+	var total float64
+	for _, latency := range latencies {
+		ms := milliseconds(latency)
+		stats.Samples = append(stats.Samples, ms)
+		total += ms
+	}
+	sorted := append([]float64(nil), stats.Samples...)
+	sort.Float64s(sorted)
+
+	stats.MinMs = sorted[0]
+	stats.MaxMs = sorted[len(sorted)-1]
+	stats.AvgMs = math.Round(total/float64(len(sorted))*1000) / 1000
+	stats.P95Ms = sorted[int(math.Ceil(0.95*float64(len(sorted))))-1]
+	return stats
+}
+
+// milliseconds converts d to milliseconds, keeping microsecond precision.
+func milliseconds(d time.Duration) float64 {
+	return float64(d.Microseconds()) / 1000
+}
+
+// formatPingSummary renders the statistics printed after the replies.
+func formatPingSummary(stats PingStats) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "--- %s ping statistics ---\n", stats.Target)
+	fmt.Fprintf(&b, "%d requests sent, %d replies, %.0f%% failed\n", stats.Sent, stats.Received, 100*float64(stats.Failed)/float64(stats.Sent))
+	if stats.Received > 0 {
+		fmt.Fprintf(&b, "latency min/avg/max/p95 = %.3f/%.3f/%.3f/%.3f ms\n", stats.MinMs, stats.AvgMs, stats.MaxMs, stats.P95Ms)
+	}
+	return b.String()
+}
+
+func RunPing(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
+	host, _ := cmd.Flags().GetString("host")
+	restPort, _ := cmd.Flags().GetString("restPort")
+	count, _ := cmd.Flags().GetInt("count")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+	output := helpers.OutputFormat(cmd)
+
+	if count < 1 {
+		fmt.Fprintln(helpers.Stdout(), "Error: --count must be at least 1")
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fmt.Fprintf(helpers.Stdout(), "Alias %s not found. Try: tg conf list\n", alias)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		warnAliasOverrides(cmd, alias, "host")
+		host = machineConfig.Host
+		if machineConfig.RestPort != "" {
+			warnAliasOverrides(cmd, alias, "restPort")
+			restPort = machineConfig.RestPort
+		}
+	}
+
+	target := fmt.Sprintf("%s:%s%s", host, restPort, pingPath)
+	client := newServerClient(cmd, alias, timeout)
+
+	if output != "json" {
+		fmt.Fprintf(helpers.Stdout(), "PING %s\n", target)
+	}
+	var latencies []time.Duration
+	for i := 1; i <= count; i++ {
+		if i > 1 {
+			time.Sleep(pingInterval)
+		}
+		latency, status, err := pingOnce(client, target)
+		if err != nil {
+			if output != "json" {
+				fmt.Fprintf(helpers.Stdout(), "request %d: %v\n", i, err)
+			}
+			continue
+		}
+		latencies = append(latencies, latency)
+		if output != "json" {
+			fmt.Fprintf(helpers.Stdout(), "reply %d: status=%d time=%.3f ms\n", i, status, milliseconds(latency))
+		}
+	}
+
+	stats := summarizePing(target, count, latencies)
+	if output == "json" {
+		result, _ := json.Marshal(stats)
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(result)))
+	} else {
+		fmt.Fprint(helpers.Stdout(), formatPingSummary(stats))
+	}
+	if stats.Received == 0 {
+		helpers.Exit(1)
+	}
+}
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestSummarizePing(t *testing.T) {
+	var latencies []time.Duration
+	for ms := 1; ms <= 20; ms++ {
+		latencies = append(latencies, time.Duration(ms)*time.Millisecond)
+	}
+	stats := summarizePing("http://db:9000/echo", 22, latencies)
+
+	if stats.Sent != 22 || stats.Received != 20 || stats.Failed != 2 {
+		t.Errorf("Unexpected counts: %+v", stats)
+	}
+	if stats.MinMs != 1 || stats.MaxMs != 20 || stats.AvgMs != 10.5 || stats.P95Ms != 19 {
+		t.Errorf("Unexpected latencies: min=%v avg=%v max=%v p95=%v", stats.MinMs, stats.AvgMs, stats.MaxMs, stats.P95Ms)
+	}
+
+	single := summarizePing("t", 1, []time.Duration{1500 * time.Microsecond})
+	if single.MinMs != 1.5 || single.P95Ms != 1.5 {
+		t.Errorf("A single sample should be every statistic, got %+v", single)
+	}
+
+	none := summarizePing("t", 3, nil)
+	if none.Failed != 3 || none.Samples == nil {
+		t.Errorf("Expected three failures and an empty sample list, got %+v", none)
+	}
+}
+
+func TestFormatPingSummary(t *testing.T) {
+	stats := PingStats{Target: "http://db:9000/echo", Sent: 4, Received: 3, Failed: 1, MinMs: 1.2, AvgMs: 2, MaxMs: 3.1, P95Ms: 3.1}
+	expected := "--- http://db:9000/echo ping statistics ---\n" +
+		"4 requests sent, 3 replies, 25% failed\n" +
+		"latency min/avg/max/p95 = 1.200/2.000/3.100/3.100 ms\n"
+	if got := formatPingSummary(stats); got != expected {
+		t.Errorf("Unexpected summary:\n%s\nexpected:\n%s", got, expected)
+	}
+
+	if got := formatPingSummary(PingStats{Target: "t", Sent: 2, Failed: 2}); strings.Contains(got, "latency") {
+		t.Errorf("Expected no latency line without replies, got %q", got)
+	}
+}
+
+func newPingCmd(host, output string, count int) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().String("alias", "", "")
+	cmd.Flags().String("host", host, "")
+	cmd.Flags().String("restPort", "", "")
+	cmd.Flags().Int("count", count, "")
+	cmd.Flags().Duration("timeout", 5*time.Second, "")
+	cmd.Flags().String("output", output, "")
+	cmd.Flags().Bool("auto-scheme", false, "")
+	return cmd
+}
+
+func TestRunPing(t *testing.T) {
+	var paths []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		paths = append(paths, r.URL.Path)
+		w.Write([]byte(`{"error":false,"message":"Hello GSQL"}`))
+	}))
+	defer server.Close()
+
+	original := pingInterval
+	pingInterval = 0
+	defer func() { pingInterval = original }()
+
+	serverURL, _ := url.Parse(server.URL)
+	host, port := "http://"+serverURL.Hostname(), serverURL.Port()
+
+	cmd := newPingCmd(host, "json", 3)
+	cmd.Flags().Set("restPort", port)
+	output := captureOutput(func() { RunPing(cmd, nil) })
+
+	var stats PingStats
+	if err := json.Unmarshal([]byte(output), &stats); err != nil {
+		t.Fatalf("Expected a JSON summary, got %q: %v", output, err)
+	}
+	if stats.Sent != 3 || stats.Received != 3 || len(stats.Samples) != 3 || stats.Target != server.URL+"/echo" {
+		t.Errorf("Unexpected stats: %+v", stats)
+	}
+	if len(paths) != 3 || paths[0] != "/echo" {
+		t.Errorf("Expected three requests to /echo, got %v", paths)
+	}
+
+	cmd = newPingCmd(host, "stdout", 2)
+	cmd.Flags().Set("restPort", port)
+	output = captureOutput(func() { RunPing(cmd, nil) })
+	for _, expected := range []string{"PING " + server.URL + "/echo", "reply 1: status=200", "reply 2: status=200", "2 requests sent, 2 replies, 0% failed"} {
+		if !strings.Contains(output, expected) {
+			t.Errorf("Expected %q in output:\n%s", expected, output)
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package server
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"golang.org/x/term"
+)
+
+// progressLine matches the progress GSQL reports while installing queries,
+// e.g. "[=====     ] 50% (1/2)".
+var progressLine = regexp.MustCompile(`\[.*?\]\s*(\d+)%.*\((\d+)/(\d+)\)`)
+
+// stdoutIsTerminal decides whether progress is drawn as a bar; tests
+// replace it.
+var stdoutIsTerminal = func() bool {
+	return !helpers.StdoutRedirected() && term.IsTerminal(int(os.Stdout.Fd()))
+}
+
+// commandPrinter prints the output of a GSQL command as it streams in.
+// On a terminal, GSQL's repeated progress lines become one updating bar;
+// otherwise the server's output is passed through.
+type commandPrinter struct {
+	bar *helpers.ProgressBar
+}
+
+func newCommandPrinter() *commandPrinter {
+	if !stdoutIsTerminal() {
+		return &commandPrinter{}
+	}
+	return &commandPrinter{bar: helpers.NewProgressBar(os.Stdout)}
+}
+
+func (p *commandPrinter) print(data string) {
+	if p.bar == nil {
+		if progressLine.MatchString(data) {
+			fmt.Fprint(helpers.Stdout(), data) // Print progress inline
+		} else {
+			fmt.Fprint(helpers.Stdout(), strings.TrimSpace(data))
+			if !strings.HasSuffix(data, "\n") {
+				fmt.Fprintln(helpers.Stdout())
+			}
+		}
+		return
+	}
+
+	for _, segment := range strings.FieldsFunc(data, func(r rune) bool { return r == '\n' || r == '\r' }) {
+		if match := progressLine.FindStringSubmatch(segment); match != nil {
+			percent, _ := strconv.Atoi(match[1])
+			p.bar.Update(percent, fmt.Sprintf("(%s/%s)", match[2], match[3]))
+			continue
+		}
+		if segment = strings.TrimSpace(segment); segment != "" {
+			p.bar.Finish()
+			fmt.Fprintln(helpers.Stdout(), segment)
+		}
+	}
+}
+
+// finish ends a bar still being drawn.
+func (p *commandPrinter) finish() {
+	if p.bar != nil {
+		p.bar.Finish()
+	}
+}
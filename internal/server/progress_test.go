@@ -0,0 +1,50 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withTerminalStdout(t *testing.T, terminal bool) {
+	original := stdoutIsTerminal
+	stdoutIsTerminal = func() bool { return terminal }
+	t.Cleanup(func() { stdoutIsTerminal = original })
+}
+
+func TestExecuteCommandProgress(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for _, chunk := range []string{
+			"Start installing queries...\n",
+			"[=====               ] 25% (1/4)\r",
+			"[==========          ] 50% (2/4)\r[===============     ] 75% (3/4)\r",
+			"[====================] 100% (4/4)\n",
+			"Query installation finished.\n",
+		} {
+			w.Write([]byte(chunk))
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer mockServer.Close()
+	session := &GSQLSession{Host: mockServer.URL, Client: &http.Client{Timeout: 5 * time.Second}}
+
+	withTerminalStdout(t, true)
+	output := captureOutput(func() { session.executeCommand("INSTALL QUERY ALL") })
+	if strings.Count(output, "\r[") != 4 || strings.Contains(output, "=====") {
+		t.Errorf("Progress should be drawn as one updating bar:\n%q", output)
+	}
+	if !strings.HasPrefix(output, "Start installing queries...\n\r[") ||
+		!strings.Contains(output, "100% (4/4)") ||
+		!strings.HasSuffix(output, "\nQuery installation finished.\n") {
+		t.Errorf("Unexpected output:\n%q", output)
+	}
+
+	// Without a terminal the server's output is passed through.
+	withTerminalStdout(t, false)
+	output = captureOutput(func() { session.executeCommand("INSTALL QUERY ALL") })
+	if !strings.Contains(output, "[==========          ] 50% (2/4)\r[===============     ] 75% (3/4)\r") || strings.Contains(output, "#") {
+		t.Errorf("Expected raw progress output:\n%q", output)
+	}
+}
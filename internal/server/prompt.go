@@ -0,0 +1,58 @@
+package server
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+// defaultPrompt is the interactive prompt when none is configured.
+const defaultPrompt = "GSQL > "
+
+// useGraph matches the statements that change the current graph, e.g.
+// "USE GRAPH social" or "use global".
+var useGraph = regexp.MustCompile(`(?im)^\s*use\s+(?:graph\s+(\w+)|(global))\s*;?\s*$`)
+
+// promptTemplate resolves the prompt: --prompt, then gsql.prompt in the
+// config, then the default.
+func promptTemplate(cmd *cobra.Command) string {
+	if flag := cmd.Flags().Lookup("prompt"); flag != nil && flag.Changed {
+		return flag.Value.String()
+	}
+	if prompt := viper.GetString("gsql.prompt"); prompt != "" {
+		return prompt
+	}
+	return defaultPrompt
+}
+
+// prompt renders the prompt template. {alias} falls back to the host when
+// no alias was used and {graph} is "global" until a graph is selected.
+// Unknown placeholders are left as they are.
+func (s *GSQLSession) prompt() string {
+	template := s.Prompt
+	if template == "" {
+		template = defaultPrompt
+	}
+	alias := s.Alias
+	if alias == "" {
+		alias = s.Host
+	}
+	graph := s.Graph
+	if graph == "" {
+		graph = "global"
+	}
+	return strings.NewReplacer("{alias}", alias, "{graph}", graph, "{user}", s.User, "{host}", s.Host).Replace(template)
+}
+
+// trackGraph records the graph a successful command switched to. When a
+// command holds several USE statements the last one wins.
+func (s *GSQLSession) trackGraph(command string) {
+	matches := useGraph.FindAllStringSubmatch(command, -1)
+	if len(matches) == 0 {
+		return
+	}
+	last := matches[len(matches)-1]
+	s.Graph = last[1]
+}
@@ -0,0 +1,98 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+)
+
+func TestPromptTemplate(t *testing.T) {
+	viper.Reset()
+	defer viper.Reset()
+
+	newCmd := func() *cobra.Command {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("prompt", "", "")
+		return cmd
+	}
+
+	if got := promptTemplate(newCmd()); got != defaultPrompt {
+		t.Errorf("Expected the default prompt, got %q", got)
+	}
+
+	viper.Set("gsql.prompt", "{alias} > ")
+	if got := promptTemplate(newCmd()); got != "{alias} > " {
+		t.Errorf("Expected the configured prompt, got %q", got)
+	}
+
+	cmd := newCmd()
+	cmd.Flags().Set("prompt", "{user}@{host}$ ")
+	if got := promptTemplate(cmd); got != "{user}@{host}$ " {
+		t.Errorf("--prompt should win over the config, got %q", got)
+	}
+}
+
+func TestSessionPrompt(t *testing.T) {
+	session := &GSQLSession{Host: "http://10.0.0.5:14240", User: "tigergraph", Prompt: "{alias}/{graph} {unknown}> "}
+	if got := session.prompt(); got != "http://10.0.0.5:14240/global {unknown}> " {
+		t.Errorf("Unexpected prompt %q", got)
+	}
+
+	session.Alias = "prod"
+	session.Graph = "social"
+	if got := session.prompt(); got != "prod/social {unknown}> " {
+		t.Errorf("Unexpected prompt %q", got)
+	}
+
+	session.Prompt = ""
+	if got := session.prompt(); got != defaultPrompt {
+		t.Errorf("Expected the default prompt, got %q", got)
+	}
+}
+
+func TestTrackGraph(t *testing.T) {
+	session := &GSQLSession{}
+	for _, tt := range []struct {
+		command string
+		graph   string
+	}{
+		{"USE GRAPH social", "social"},
+		{"ls", "social"},
+		{"use graph Finance;", "Finance"},
+		{"USE GLOBAL", ""},
+		{"USE GRAPH a\nls\nUSE GRAPH b\n", "b"},
+		{"CREATE QUERY q() { PRINT \"use graph x\"; }", "b"},
+	} {
+		session.trackGraph(tt.command)
+		if session.Graph != tt.graph {
+			t.Errorf("After %q expected graph %q, got %q", tt.command, tt.graph, session.Graph)
+		}
+	}
+}
+
+func TestExecuteCommandTracksGraph(t *testing.T) {
+	failing := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if failing {
+			w.Write([]byte("Semantic Check Fails: The graph nope does not exist.\n__GSQL__RETURN__CODE__,1\n"))
+			return
+		}
+		w.Write([]byte("Using graph 'social'\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer server.Close()
+	session := &GSQLSession{Host: server.URL, Client: server.Client(), Alias: "prod", Prompt: "{alias}/{graph} > "}
+
+	captureOutput(func() { session.executeCommand("USE GRAPH social") })
+	if got := session.prompt(); got != "prod/social > " {
+		t.Errorf("Expected the prompt to follow USE GRAPH, got %q", got)
+	}
+
+	failing = true
+	captureOutput(func() { session.executeCommand("USE GRAPH nope") })
+	if session.Graph != "social" {
+		t.Errorf("A failed USE GRAPH should keep the graph, got %q", session.Graph)
+	}
+}
@@ -0,0 +1,390 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/examples"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// Exit codes of tg server queries show --compare-file besides 0 for a
+// match, as diff(1) uses them, so CI can tell drift from a failure to
+// check.
+const (
+	compareDifferent = 1
+	compareFailed    = 2
+)
+
+const (
+	diffRed   = "\033[31m"
+	diffGreen = "\033[32m"
+	diffCyan  = "\033[36m"
+	diffReset = "\033[0m"
+)
+
+// orReplace matches the OR REPLACE of a CREATE OR REPLACE statement, which
+// files use so they can be run again but the server does not print.
+var orReplace = regexp.MustCompile(`(?i)^(\s*CREATE)\s+OR\s+REPLACE\b`)
+
+// queryHeader matches the CREATE line of the query called name.
+func queryHeader(name string) *regexp.Regexp {
+	return regexp.MustCompile(`(?im)^[ \t]*CREATE\s+(OR\s+REPLACE\s+)?(DISTRIBUTED\s+)?QUERY\s+` + regexp.QuoteMeta(name) + `\s*\(`)
+}
+
+// normalizeQueryText puts a query in the form --compare-file compares:
+// line endings become \n, tabs are expanded to spaces at 4-column stops,
+// trailing whitespace is removed from every line, and blank lines at the
+// start and end are dropped. Indentation and blank lines inside the query
+// still count.
+func normalizeQueryText(text string) string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	lines := strings.Split(text, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRight(expandTabs(line, 4), " \t")
+	}
+	for len(lines) > 0 && lines[0] == "" {
+		lines = lines[1:]
+	}
+	for len(lines) > 0 && lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return strings.Join(lines, "\n")
+}
+
+// expandTabs replaces the tabs of line with spaces up to the next multiple
+// of width.
+func expandTabs(line string, width int) string {
+	if !strings.Contains(line, "\t") {
+		return line
+	}
+	var b strings.Builder
+	column := 0
+	for _, r := range line {
+		if r == '\t' {
+			spaces := width - column%width
+			b.WriteString(strings.Repeat(" ", spaces))
+			column += spaces
+			continue
+		}
+		b.WriteRune(r)
+		column++
+	}
+	return b.String()
+}
+
+// queryDefinition returns the CREATE QUERY statement of the query called
+// name in normalized text, from its CREATE to the brace that closes its
+// body, so other statements in a local file, such as "USE GRAPH" and
+// "INSTALL QUERY" or other queries, and the server's "Using graph" banner,
+// are not compared. OR REPLACE is dropped. It returns false when text does
+// not define the query.
+func queryDefinition(text, name string) (string, bool) {
+	header := queryHeader(name).FindStringIndex(text)
+	if header == nil {
+		return "", false
+	}
+	definition := text[header[0]:]
+	if end := queryBodyEnd(definition); end > 0 {
+		definition = definition[:end]
+	}
+	return orReplace.ReplaceAllString(definition, "$1"), true
+}
+
+// queryBodyEnd returns the offset just past the brace that closes the first
+// brace in text, skipping braces in strings and comments. It returns -1
+// when the body is not closed.
+func queryBodyEnd(text string) int {
+	depth := 0
+	for i := 0; i < len(text); i++ {
+		switch {
+		case text[i] == '"':
+			// Skip the string, honoring backslash escapes.
+			for i++; i < len(text) && text[i] != '"'; i++ {
+				if text[i] == '\\' {
+					i++
+				}
+			}
+		case text[i] == '#' || strings.HasPrefix(text[i:], "//"):
+			if newline := strings.IndexByte(text[i:], '\n'); newline >= 0 {
+				i += newline
+			} else {
+				return -1
+			}
+		case strings.HasPrefix(text[i:], "/*"):
+			end := strings.Index(text[i+2:], "*/")
+			if end < 0 {
+				return -1
+			}
+			i += end + 3
+		case text[i] == '{':
+			depth++
+		case text[i] == '}':
+			depth--
+			if depth == 0 {
+				return i + 1
+			}
+		}
+	}
+	return -1
+}
+
+// diffLine is one line of a hunk. Op is "context", "removed" (only on the
+// server) or "added" (only in the local file).
+type diffLine struct {
+	Op   string `json:"op"`
+	Text string `json:"text"`
+}
+
+// diffHunk is a run of changes with its context. Starts are 1-based line
+// numbers, as in a unified diff.
+type diffHunk struct {
+	ServerStart int        `json:"serverStart"`
+	ServerLines int        `json:"serverLines"`
+	LocalStart  int        `json:"localStart"`
+	LocalLines  int        `json:"localLines"`
+	Lines       []diffLine `json:"lines"`
+}
+
+// diffQueries compares two normalized queries and groups the changes into
+// hunks with up to context unchanged lines around them. Identical queries
+// give no hunks.
+func diffQueries(server, local string, context int) []diffHunk {
+	if server == local {
+		return nil
+	}
+	var lines []diffLine
+	if server == "" || local == "" {
+		// DiffLines sees an empty text as one empty line.
+		for _, line := range splitNonEmpty(server) {
+			lines = append(lines, diffLine{"removed", line})
+		}
+		for _, line := range splitNonEmpty(local) {
+			lines = append(lines, diffLine{"added", line})
+		}
+	} else {
+		for _, line := range helpers.DiffLines(server, local) {
+			op := map[string]string{"  ": "context", "- ": "removed", "+ ": "added"}[line[:2]]
+			lines = append(lines, diffLine{op, line[2:]})
+		}
+	}
+
+	// Mark the lines to show, then cut the runs of marked lines into
+	// hunks, tracking the line numbers on both sides.
+	shown := make([]bool, len(lines))
+	for i, line := range lines {
+		if line.Op == "context" {
+			continue
+		}
+		for j := max(0, i-context); j <= min(len(lines)-1, i+context); j++ {
+			shown[j] = true
+		}
+	}
+
+	var hunks []diffHunk
+	var current *diffHunk
+	serverLine, localLine := 1, 1
+	for i, line := range lines {
+		if shown[i] {
+			if current == nil {
+				hunks = append(hunks, diffHunk{ServerStart: serverLine, LocalStart: localLine})
+				current = &hunks[len(hunks)-1]
+			}
+			current.Lines = append(current.Lines, line)
+			if line.Op != "added" {
+				current.ServerLines++
+			}
+			if line.Op != "removed" {
+				current.LocalLines++
+			}
+		} else {
+			current = nil
+		}
+		if line.Op != "added" {
+			serverLine++
+		}
+		if line.Op != "removed" {
+			localLine++
+		}
+	}
+	for i := range hunks {
+		// An empty side starts before line 1, as in a unified diff.
+		if hunks[i].ServerLines == 0 {
+			hunks[i].ServerStart--
+		}
+		if hunks[i].LocalLines == 0 {
+			hunks[i].LocalStart--
+		}
+	}
+	return hunks
+}
+
+func splitNonEmpty(text string) []string {
+	if text == "" {
+		return nil
+	}
+	return strings.Split(text, "\n")
+}
+
+// formatQueryDiff renders hunks with the server and local line numbers in
+// aligned columns, removed lines in red and added lines in green when color
+// is set.
+func formatQueryDiff(serverName, localName string, hunks []diffHunk, color bool) string {
+	paint := func(code, text string) string {
+		if !color {
+			return text
+		}
+		return code + text + diffReset
+	}
+
+	width := 1
+	for _, hunk := range hunks {
+		width = max(width, len(fmt.Sprint(hunk.ServerStart+hunk.ServerLines)), len(fmt.Sprint(hunk.LocalStart+hunk.LocalLines)))
+	}
+
+	var b strings.Builder
+	b.WriteString(paint(diffRed, "--- "+serverName) + "\n")
+	b.WriteString(paint(diffGreen, "+++ "+localName) + "\n")
+	for _, hunk := range hunks {
+		b.WriteString(paint(diffCyan, fmt.Sprintf("@@ -%d,%d +%d,%d @@", hunk.ServerStart, hunk.ServerLines, hunk.LocalStart, hunk.LocalLines)) + "\n")
+		serverLine, localLine := max(hunk.ServerStart, 1), max(hunk.LocalStart, 1)
+		for _, line := range hunk.Lines {
+			serverNumber, localNumber := "", ""
+			if line.Op != "added" {
+				serverNumber = fmt.Sprint(serverLine)
+				serverLine++
+			}
+			if line.Op != "removed" {
+				localNumber = fmt.Sprint(localLine)
+				localLine++
+			}
+			text := fmt.Sprintf("%*s %*s ", width, serverNumber, width, localNumber)
+			switch line.Op {
+			case "removed":
+				b.WriteString(text + paint(diffRed, "- "+line.Text) + "\n")
+			case "added":
+				b.WriteString(text + paint(diffGreen, "+ "+line.Text) + "\n")
+			default:
+				b.WriteString(text + "  " + line.Text + "\n")
+			}
+		}
+	}
+	return b.String()
+}
+
+// showQuery returns the definition of an installed query.
+func (s *GSQLSession) showQuery(graph, name string) (string, error) {
+	output, err := s.queryCommand(fmt.Sprintf("USE GRAPH %s\nSHOW QUERY %s", graph, name))
+	if err != nil {
+		return "", fmt.Errorf("showing query %s: %v", name, err)
+	}
+	definition, ok := queryDefinition(normalizeQueryText(output), name)
+	if !ok {
+		return "", fmt.Errorf("query %s was not found on graph %s", name, graph)
+	}
+	return definition, nil
+}
+
+// RunQueriesShow prints an installed query, or with --compare-file how it
+// differs from a local file. A comparison that finds differences exits
+// with compareDifferent, and one that cannot be made with compareFailed.
+func RunQueriesShow(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
+	user, _ := cmd.Flags().GetString("user")
+	password, _ := cmd.Flags().GetString("password")
+	host, _ := cmd.Flags().GetString("host")
+	gsPort, _ := cmd.Flags().GetString("gsPort")
+	graph, _ := cmd.Flags().GetString("graph")
+	compareFile, _ := cmd.Flags().GetString("compare-file")
+	context, _ := cmd.Flags().GetInt("context")
+	output := helpers.OutputFormat(cmd)
+	name := args[0]
+
+	failCode := 1
+	if compareFile != "" {
+		failCode = compareFailed
+	}
+	fail := func(format string, a ...interface{}) {
+		fmt.Fprintf(os.Stderr, "Error: "+format+"\n", a...)
+		helpers.Exit(failCode)
+	}
+
+	if !graphName.MatchString(graph) {
+		fail("invalid graph name %q", graph)
+	}
+	if !graphName.MatchString(name) {
+		fail("invalid query name %q", name)
+	}
+	if context < 0 {
+		fail("--context must not be negative")
+	}
+	var local string
+	if compareFile != "" {
+		data, err := os.ReadFile(compareFile)
+		if err != nil {
+			fail("%v", err)
+		}
+		var ok bool
+		if local, ok = queryDefinition(normalizeQueryText(string(data)), name); !ok {
+			fail("%s does not define query %s", compareFile, name)
+		}
+	}
+
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fail("alias %s not found. Try: tg conf list", alias)
+		}
+		warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
+		host, user, password, gsPort = machineConfig.Host, machineConfig.User, machineConfig.Password, machineConfig.GSPort
+	}
+
+	session := &GSQLSession{
+		Alias:    alias,
+		Host:     fmt.Sprintf("%s:%s", host, gsPort),
+		User:     user,
+		Password: password,
+		Client:   newServerClient(cmd, alias, 60*time.Second),
+		// The login's welcome message is not part of the output.
+		Messages: os.Stderr,
+	}
+	if err := session.login(); err != nil {
+		fail("logging in: %v", err)
+	}
+	installed, err := session.showQuery(graph, name)
+	if err != nil {
+		fail("%v", err)
+	}
+
+	if compareFile == "" {
+		if output == "json" {
+			encoded, _ := json.Marshal(map[string]string{"query": name, "graph": graph, "text": installed})
+			fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(encoded)))
+			return
+		}
+		fmt.Fprintln(helpers.Stdout(), installed)
+		return
+	}
+
+	hunks := diffQueries(installed, local, context)
+	if output == "json" {
+		encoded, _ := json.Marshal(map[string]interface{}{
+			"query": name, "graph": graph, "file": compareFile,
+			"identical": len(hunks) == 0, "hunks": append([]diffHunk{}, hunks...),
+		})
+		fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(encoded)))
+	} else if len(hunks) == 0 {
+		fmt.Fprintf(helpers.Stdout(), "%s on graph %s matches %s\n", name, graph, compareFile)
+	} else {
+		fmt.Fprint(helpers.Stdout(), formatQueryDiff(fmt.Sprintf("%s (installed on %s)", name, graph), compareFile, hunks, examples.UseColor()))
+	}
+	if len(hunks) > 0 {
+		helpers.Exit(compareDifferent)
+	}
+}
@@ -0,0 +1,151 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNormalizeQueryText(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"crlf", "CREATE QUERY q() {\r\n  PRINT 1;\r\n}\r\n", "CREATE QUERY q() {\n  PRINT 1;\n}"},
+		{"lone cr", "a\rb", "a\nb"},
+		{"trailing whitespace", "CREATE QUERY q() { \t\n  PRINT 1;   \n}", "CREATE QUERY q() {\n  PRINT 1;\n}"},
+		{"tab indent", "\tPRINT 1;", "    PRINT 1;"},
+		{"tab stops", "ab\tc\t\td", "ab  c       d"},
+		{"surrounding blank lines", "\n \n\tx\n\n\ny\n\t\n", "    x\n\n\ny"},
+		{"empty", " \r\n\t\r\n", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := normalizeQueryText(tt.text); got != tt.expected {
+				t.Errorf("Expected %q, got %q", tt.expected, got)
+			}
+		})
+	}
+
+	tabs := "CREATE QUERY q() {\r\n\tPRINT 1;\t\r\n}\r\n"
+	spaces := "CREATE QUERY q() {\n    PRINT 1;\n}\n"
+	if normalizeQueryText(tabs) != normalizeQueryText(spaces) {
+		t.Errorf("Expected tab and space indentation to compare equal")
+	}
+}
+
+func TestQueryDefinition(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		expected string
+	}{
+		{"surrounding statements", "USE GRAPH social\n# friends of a person\nCREATE OR REPLACE QUERY q() FOR GRAPH social {\n  PRINT 1;\n}\nINSTALL QUERY q",
+			"CREATE QUERY q() FOR GRAPH social {\n  PRINT 1;\n}"},
+		{"other queries", "CREATE QUERY p() { PRINT 0; }\nCREATE QUERY q() {\n  PRINT 1;\n}\nCREATE QUERY r() {\n  PRINT 2;\n}",
+			"CREATE QUERY q() {\n  PRINT 1;\n}"},
+		{"prefix of another name", "CREATE QUERY q2() { PRINT 2; }\nCREATE QUERY q () { PRINT 1; }",
+			"CREATE QUERY q () { PRINT 1; }"},
+		{"nested blocks", "CREATE DISTRIBUTED QUERY q() {\n  IF true THEN\n    S = SELECT s FROM S:s ACCUM { };\n  END;\n}\nINSTALL QUERY q",
+			"CREATE DISTRIBUTED QUERY q() {\n  IF true THEN\n    S = SELECT s FROM S:s ACCUM { };\n  END;\n}"},
+		{"braces in strings and comments", "create or replace query q(STRING s = \"}\") {\n  // }\n  # }\n  /* } */\n  PRINT \"\\\"}\";\n}\nINSTALL QUERY q",
+			"create query q(STRING s = \"}\") {\n  // }\n  # }\n  /* } */\n  PRINT \"\\\"}\";\n}"},
+		{"unclosed body", "CREATE QUERY q() {\n  PRINT 1;", "CREATE QUERY q() {\n  PRINT 1;"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := queryDefinition(tt.text, "q")
+			if !ok || got != tt.expected {
+				t.Errorf("Expected %q, got %q (%v)", tt.expected, got, ok)
+			}
+		})
+	}
+
+	for _, text := range []string{"PRINT 1;", "CREATE QUERY other() { PRINT 1; }", "CREATE QUERY qq() { PRINT 1; }"} {
+		if got, ok := queryDefinition(text, "q"); ok {
+			t.Errorf("Expected no definition of q in %q, got %q", text, got)
+		}
+	}
+}
+
+func TestDiffQueries(t *testing.T) {
+	server := "a\nb\nc\nd\ne\nf\ng\nh"
+	local := "a\nB\nc\nd\ne\nf\ng\nh\ni"
+
+	if hunks := diffQueries(server, server, 3); hunks != nil {
+		t.Errorf("Expected no hunks for identical text, got %v", hunks)
+	}
+
+	hunks := diffQueries(server, local, 1)
+	encoded, _ := json.Marshal(hunks)
+	expected := `[{"serverStart":1,"serverLines":3,"localStart":1,"localLines":3,"lines":[{"op":"context","text":"a"},{"op":"removed","text":"b"},{"op":"added","text":"B"},{"op":"context","text":"c"}]},` +
+		`{"serverStart":8,"serverLines":1,"localStart":8,"localLines":2,"lines":[{"op":"context","text":"h"},{"op":"added","text":"i"}]}]`
+	if string(encoded) != expected {
+		t.Errorf("Unexpected hunks:\n%s", encoded)
+	}
+
+	// With more context the two changes share a hunk.
+	if hunks := diffQueries(server, local, 3); len(hunks) != 1 || hunks[0].ServerLines != 8 || hunks[0].LocalLines != 9 {
+		t.Errorf("Expected a single hunk, got %+v", hunks)
+	}
+
+	hunks = diffQueries("", "x\ny", 3)
+	if len(hunks) != 1 || hunks[0].ServerStart != 0 || hunks[0].LocalStart != 1 || len(hunks[0].Lines) != 2 {
+		t.Errorf("Unexpected hunks against an empty query: %+v", hunks)
+	}
+}
+
+func TestFormatQueryDiff(t *testing.T) {
+	server := strings.Repeat("x\n", 9) + "old\ny"
+	local := strings.Repeat("x\n", 9) + "new\ny"
+	got := formatQueryDiff("q (installed on social)", "q.gsql", diffQueries(server, local, 1), false)
+	expected := "--- q (installed on social)\n" +
+		"+++ q.gsql\n" +
+		"@@ -9,3 +9,3 @@\n" +
+		" 9  9   x\n" +
+		"10    - old\n" +
+		"   10 + new\n" +
+		"11 11   y\n"
+	if got != expected {
+		t.Errorf("Expected:\n%s\ngot:\n%s", expected, got)
+	}
+
+	colored := formatQueryDiff("q", "q.gsql", diffQueries("a", "b", 3), true)
+	if !strings.Contains(colored, diffRed+"- a"+diffReset) || !strings.Contains(colored, diffGreen+"+ b"+diffReset) {
+		t.Errorf("Expected colored lines, got %q", colored)
+	}
+}
+
+func TestShowQuery(t *testing.T) {
+	var command string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		command = string(body)
+		if strings.Contains(command, "missing") {
+			w.Write([]byte("Using graph 'social'\nQuery missing does not exist.\n__GSQL__RETURN__CODE__,0\n"))
+			return
+		}
+		w.Write([]byte("Using graph 'social'\r\nCREATE QUERY friends() FOR GRAPH social {\r\n\tPRINT 1;  \r\n}\r\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer mockServer.Close()
+
+	session := &GSQLSession{Host: mockServer.URL, Client: mockServer.Client()}
+	text, err := session.showQuery("social", "friends")
+	if err != nil {
+		t.Fatalf("showQuery failed: %v", err)
+	}
+	if command != "USE GRAPH social\nSHOW QUERY friends" {
+		t.Errorf("Unexpected command %q", command)
+	}
+	if text != "CREATE QUERY friends() FOR GRAPH social {\n    PRINT 1;\n}" {
+		t.Errorf("Unexpected query text %q", text)
+	}
+
+	if _, err := session.showQuery("social", "missing"); err == nil || !strings.Contains(err.Error(), "query missing was not found on graph social") {
+		t.Errorf("Expected a not found error, got %v", err)
+	}
+}
@@ -0,0 +1,248 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// queryPath runs an installed query through the /restpp proxy of the GSQL
+// port, which accepts the same credentials as GSQL.
+const queryPath = "/restpp/query/%s/%s"
+
+// scalarParamTypes are the types --param accepts, alone or as the element
+// type of SET<>, BAG<> and LIST<>.
+var scalarParamTypes = []string{"INT", "UINT", "FLOAT", "DOUBLE", "BOOL", "STRING", "DATETIME", "VERTEX"}
+
+// containerParamTypes hold every value given for a parameter.
+var containerParamTypes = []string{"SET", "BAG", "LIST"}
+
+// paramType is a parsed --param type. An empty Base is inferred from the
+// values.
+type paramType struct {
+	Base string
+	// Container is SET, BAG or LIST, or empty for a single value.
+	Container string
+	// VertexType is the T of VERTEX<T>.
+	VertexType string
+}
+
+// parseParamType reads a type such as INT, SET<DOUBLE> or
+// LIST<VERTEX<Person>>, case-insensitively.
+func parseParamType(spec string) (paramType, error) {
+	var t paramType
+	spec = strings.TrimSpace(spec)
+	upper := strings.ToUpper(spec)
+	for _, container := range containerParamTypes {
+		if upper == container {
+			return paramType{Container: container}, nil
+		}
+		if strings.HasPrefix(upper, container+"<") && strings.HasSuffix(upper, ">") {
+			t.Container = container
+			spec = spec[len(container)+1 : len(spec)-1]
+			upper = strings.ToUpper(spec)
+			break
+		}
+	}
+	if strings.HasPrefix(upper, "VERTEX<") && strings.HasSuffix(upper, ">") {
+		t.Base, t.VertexType = "VERTEX", strings.TrimSpace(spec[len("VERTEX<"):len(spec)-1])
+		return t, nil
+	}
+	for _, scalar := range scalarParamTypes {
+		if upper == scalar {
+			t.Base = scalar
+			return t, nil
+		}
+	}
+	return t, fmt.Errorf("unknown type %q (expected %s, or SET<>, BAG<> or LIST<> of them)", spec, strings.Join(scalarParamTypes, ", "))
+}
+
+// convertParam converts value to the JSON value RESTPP expects for base.
+func convertParam(t paramType, value string) (interface{}, error) {
+	switch t.Base {
+	case "INT":
+		return strconv.ParseInt(value, 10, 64)
+	case "UINT":
+		return strconv.ParseUint(value, 10, 64)
+	case "FLOAT", "DOUBLE":
+		return strconv.ParseFloat(value, 64)
+	case "BOOL":
+		return strconv.ParseBool(value)
+	case "VERTEX":
+		if t.VertexType != "" {
+			return map[string]string{"id": value, "type": t.VertexType}, nil
+		}
+		vertexType, id, ok := strings.Cut(value, ":")
+		if !ok || vertexType == "" {
+			return nil, fmt.Errorf("expected TYPE:ID, or declare the type as VERTEX<TYPE>")
+		}
+		return map[string]string{"id": id, "type": vertexType}, nil
+	}
+	return value, nil
+}
+
+// inferParamType picks the narrowest of INT, DOUBLE and BOOL that fits
+// every value, or STRING.
+func inferParamType(values []string) string {
+	for _, candidate := range []string{"INT", "DOUBLE", "BOOL"} {
+		fits := true
+		for _, value := range values {
+			if candidate == "BOOL" && value != "true" && value != "false" {
+				fits = false
+			} else if _, err := convertParam(paramType{Base: candidate}, value); err != nil {
+				fits = false
+			}
+		}
+		if fits {
+			return candidate
+		}
+	}
+	return "STRING"
+}
+
+// parseQueryParams turns --param flags of the form name[:TYPE]=value into
+// the JSON body of a query request. A parameter given more than once, or
+// declared as a SET, BAG or LIST, becomes an array. A type declared on
+// one occurrence applies to all of them.
+func parseQueryParams(flags []string) (map[string]interface{}, error) {
+	types := make(map[string]paramType)
+	declared := make(map[string]string)
+	values := make(map[string][]string)
+	var names []string
+
+	for _, flag := range flags {
+		key, value, ok := strings.Cut(flag, "=")
+		name, typeSpec, typed := strings.Cut(key, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("--param %s: expected name=value or name:TYPE=value", flag)
+		}
+		if typed {
+			t, err := parseParamType(typeSpec)
+			if err != nil {
+				return nil, fmt.Errorf("--param %s: %v", flag, err)
+			}
+			if previous, seen := declared[name]; seen && !strings.EqualFold(previous, typeSpec) {
+				return nil, fmt.Errorf("--param %s: %s was already declared as %s", flag, name, previous)
+			}
+			types[name], declared[name] = t, typeSpec
+		}
+		if _, seen := values[name]; !seen {
+			names = append(names, name)
+		}
+		values[name] = append(values[name], value)
+	}
+
+	params := make(map[string]interface{}, len(names))
+	for _, name := range names {
+		t := types[name]
+		if t.Base == "" {
+			t.Base = inferParamType(values[name])
+		}
+		var converted []interface{}
+		for _, value := range values[name] {
+			v, err := convertParam(t, value)
+			if err != nil {
+				if numErr, ok := err.(*strconv.NumError); ok {
+					err = numErr.Err
+				}
+				return nil, fmt.Errorf("--param %s=%s: not a valid %s: %v", name, value, t.Base, err)
+			}
+			converted = append(converted, v)
+		}
+		if t.Container != "" || len(converted) > 1 {
+			params[name] = converted
+		} else {
+			params[name] = converted[0]
+		}
+	}
+	return params, nil
+}
+
+// runQuery posts params to an installed query and returns the response
+// body.
+func runQuery(cmd *cobra.Command, alias, baseURL, user, password, graph, name string, params map[string]interface{}, timeout time.Duration) ([]byte, error) {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return nil, err
+	}
+	endpoint := baseURL + fmt.Sprintf(queryPath, url.PathEscape(graph), url.PathEscape(name))
+	req, err := http.NewRequest("POST", endpoint, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.SetBasicAuth(user, password)
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("GSQL-TIMEOUT", strconv.FormatInt(timeout.Milliseconds(), 10))
+
+	resp, err := newServerClient(cmd, alias, timeout+5*time.Second).Do(req)
+	if err != nil {
+		return nil, unwrapSchemeMismatch(err)
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+	}
+	if json.Unmarshal(data, &result) != nil {
+		if resp.StatusCode != 200 {
+			return nil, fmt.Errorf("query %s answered %s", name, resp.Status)
+		}
+		return nil, fmt.Errorf("query %s returned a response that is not JSON", name)
+	}
+	if result.Error || resp.StatusCode != 200 {
+		if result.Message == "" {
+			result.Message = resp.Status
+		}
+		return nil, fmt.Errorf("query %s failed: %s", name, result.Message)
+	}
+	return data, nil
+}
+
+func RunQuery(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
+	user, _ := cmd.Flags().GetString("user")
+	password, _ := cmd.Flags().GetString("password")
+	host, _ := cmd.Flags().GetString("host")
+	gsPort, _ := cmd.Flags().GetString("gsPort")
+	graph, _ := cmd.Flags().GetString("graph")
+	paramFlags, _ := cmd.Flags().GetStringArray("param")
+	timeout, _ := cmd.Flags().GetDuration("timeout")
+
+	params, err := parseQueryParams(paramFlags)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fmt.Fprintf(helpers.Stdout(), "Alias %s not found. Try: tg conf list\n", alias)
+			helpers.Exit(1)
+		}
+		warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
+		host, user, password, gsPort = machineConfig.Host, machineConfig.User, machineConfig.Password, machineConfig.GSPort
+	}
+
+	data, err := runQuery(cmd, alias, fmt.Sprintf("%s:%s", host, gsPort), user, password, graph, args[0], params, timeout)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Exit(1)
+	}
+	fmt.Fprintln(helpers.Stdout(), helpers.JSONOutput(string(bytes.TrimSpace(data))))
+}
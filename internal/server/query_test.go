@@ -0,0 +1,98 @@
+package server
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+func TestParseQueryParams(t *testing.T) {
+	tests := []struct {
+		name     string
+		flags    []string
+		expected string
+	}{
+		{"inferred", []string{"n=7", "ratio=0.5", "flag=true", "s=alice", "zip=02134"}, `{"flag":true,"n":7,"ratio":0.5,"s":"alice","zip":2134}`},
+		{"typed scalars", []string{"zip:STRING=02134", "n:double=7", "u:UINT=3", "on:BOOL=1", "at:DATETIME=2024-01-02 03:04:05"},
+			`{"at":"2024-01-02 03:04:05","n":7,"on":true,"u":3,"zip":"02134"}`},
+		{"vertices", []string{"p:VERTEX=Person:alice", "q:VERTEX<Company>=acme:inc"},
+			`{"p":{"id":"alice","type":"Person"},"q":{"id":"acme:inc","type":"Company"}}`},
+		{"repeated", []string{"ids=1", "ids=2", "names=a", "names=1"}, `{"ids":[1,2],"names":["a","1"]}`},
+		{"containers", []string{"ids:SET<INT>=7", "tags:LIST=x", "people:BAG<VERTEX<Person>>=bob", "people=eve"},
+			`{"ids":[7],"people":[{"id":"bob","type":"Person"},{"id":"eve","type":"Person"}],"tags":["x"]}`},
+		{"empty value", []string{"s="}, `{"s":""}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			params, err := parseQueryParams(tt.flags)
+			if err != nil {
+				t.Fatalf("parseQueryParams failed: %v", err)
+			}
+			if encoded, _ := json.Marshal(params); string(encoded) != tt.expected {
+				t.Errorf("Expected %s, got %s", tt.expected, encoded)
+			}
+		})
+	}
+}
+
+func TestParseQueryParamsErrors(t *testing.T) {
+	tests := []struct {
+		flags    []string
+		expected string
+	}{
+		{[]string{"n"}, "expected name=value"},
+		{[]string{"=1"}, "expected name=value"},
+		{[]string{"n:INT=abc"}, "--param n=abc: not a valid INT: invalid syntax"},
+		{[]string{"n:UINT=-1"}, "not a valid UINT"},
+		{[]string{"n:INTEGER=1"}, `unknown type "INTEGER"`},
+		{[]string{"n:MAP<INT>=1"}, "unknown type"},
+		{[]string{"p:VERTEX=alice"}, "expected TYPE:ID"},
+		{[]string{"n:INT=1", "n:STRING=2"}, "n was already declared as INT"},
+	}
+	for _, tt := range tests {
+		if _, err := parseQueryParams(tt.flags); err == nil || !strings.Contains(err.Error(), tt.expected) {
+			t.Errorf("%q: expected an error containing %q, got %v", tt.flags, tt.expected, err)
+		}
+	}
+}
+
+func TestRunQuery(t *testing.T) {
+	var path, auth, body string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		user, password, _ := r.BasicAuth()
+		auth = user + ":" + password
+		data, _ := io.ReadAll(r.Body)
+		body = string(data)
+		if r.URL.Path == "/restpp/query/social/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error":true,"message":"Endpoint is not found from url = /query/social/missing"}`))
+			return
+		}
+		w.Write([]byte(`{"error":false,"message":"","results":[{"n":2}]}`))
+	}))
+	defer mockServer.Close()
+
+	params := map[string]interface{}{"ids": []interface{}{int64(1), int64(2)}}
+	data, err := runQuery(&cobra.Command{}, "", mockServer.URL, "tigergraph", "secret", "social", "friends", params, time.Minute)
+	if err != nil {
+		t.Fatalf("runQuery failed: %v", err)
+	}
+	if path != "/restpp/query/social/friends" || auth != "tigergraph:secret" || body != `{"ids":[1,2]}` {
+		t.Errorf("Unexpected request %s as %s with %s", path, auth, body)
+	}
+	if !strings.Contains(string(data), `"results":[{"n":2}]`) {
+		t.Errorf("Unexpected response %s", data)
+	}
+
+	_, err = runQuery(&cobra.Command{}, "", mockServer.URL, "tigergraph", "secret", "social", "missing", nil, time.Minute)
+	if err == nil || !strings.Contains(err.Error(), "query missing failed: Endpoint is not found") {
+		t.Errorf("Expected the RESTPP error, got %v", err)
+	}
+}
@@ -0,0 +1,39 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// readyInterval is the pause between WaitForGSQL's login attempts; tests
+// shorten it.
+var readyInterval = 5 * time.Second
+
+// WaitForGSQL logs in to the GSQL server at host, given with its port,
+// until a login succeeds or timeout elapses. A server that is starting up
+// refuses connections or answers with errors for a while, so every failure
+// is retried except rejected credentials, which waiting does not fix.
+func WaitForGSQL(host, user, password string, timeout time.Duration) error {
+	timeout = helpers.BoundWait(timeout)
+	deadline := time.Now().Add(timeout)
+	session := &GSQLSession{
+		Host:     host,
+		User:     user,
+		Password: password,
+		Client:   helpers.NewHTTPClient(defaultProbeTimeout),
+	}
+	for {
+		session.ProbeBudget = max(min(time.Until(deadline), defaultProbeBudget), time.Second)
+		err := session.login()
+		if err == nil || errors.Is(err, errAuthentication) {
+			return err
+		}
+		if time.Now().Add(readyInterval).After(deadline) {
+			return fmt.Errorf("GSQL at %s was not ready after %s (last error: %v)", host, timeout, err)
+		}
+		time.Sleep(readyInterval)
+	}
+}
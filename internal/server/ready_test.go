@@ -0,0 +1,49 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestWaitForGSQL(t *testing.T) {
+	originalBackoff, originalInterval := probeBackoff, readyInterval
+	probeBackoff, readyInterval = 0, time.Millisecond
+	t.Cleanup(func() { probeBackoff, readyInterval = originalBackoff, originalInterval })
+
+	starting := 3
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if starting > 0 {
+			starting--
+			http.Error(w, "<html>502 Bad Gateway</html>", http.StatusBadGateway)
+			return
+		}
+		if user, password, _ := r.BasicAuth(); user != "tigergraph" || password != "tigergraph" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"isClientCompatible": true, "welcomeMessage": "Welcome to GSQL"})
+	}))
+	defer server.Close()
+
+	var err error
+	captureOutput(func() { err = WaitForGSQL(server.URL, "tigergraph", "tigergraph", 5*time.Second) })
+	if err != nil {
+		t.Fatalf("Expected the server to become ready, got %v", err)
+	}
+
+	captureOutput(func() { err = WaitForGSQL(server.URL, "tigergraph", "wrong", 5*time.Second) })
+	if !errors.Is(err, errAuthentication) {
+		t.Errorf("Expected rejected credentials to end the wait, got %v", err)
+	}
+
+	starting = 1 << 30
+	captureOutput(func() { err = WaitForGSQL(server.URL, "tigergraph", "tigergraph", 50*time.Millisecond) })
+	if err == nil || !strings.Contains(err.Error(), "was not ready after 50ms") {
+		t.Errorf("Expected a timeout, got %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package server
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// Responses of read-only commands can be reused for a short time, so a
+// script that asks for the same thing in a loop skips the login and the
+// GSQL round-trip. A response is kept per alias and endpoint in
+// responseCacheDir, which defaults to ~/.tgcli/cache, only when a TTL is
+// set with --cache-ttl or gsql.cache_ttl; nothing is cached by default.
+var responseCacheDir string
+
+type cachedResponse struct {
+	FetchedAt time.Time       `json:"fetchedAt"`
+	Data      json.RawMessage `json:"data"`
+}
+
+func responseCachePath(key string) string {
+	dir := responseCacheDir
+	if dir == "" {
+		dir = filepath.Join(constants.ConfigDir, "cache")
+	}
+	return filepath.Join(dir, key+".json")
+}
+
+// responseCacheKey names the entry for endpoint on a connection, which is
+// keyed like the session cache.
+func responseCacheKey(alias, user, host, endpoint string) string {
+	return sessionCacheKey(alias, user, host) + "_" + unsafeKeyChars.ReplaceAllString(endpoint, "_")
+}
+
+// responseCacheSettings reads --no-cache and the on-disk TTL: --cache-ttl,
+// else gsql.cache_ttl, else none.
+func responseCacheSettings(cmd *cobra.Command) (ttl time.Duration, noCache bool) {
+	noCache, _ = cmd.Flags().GetBool("no-cache")
+	ttl, _ = cmd.Flags().GetDuration("cache-ttl")
+	if !cmd.Flags().Changed("cache-ttl") && viper.IsSet("gsql.cache_ttl") {
+		ttl = viper.GetDuration("gsql.cache_ttl")
+	}
+	return ttl, noCache
+}
+
+// cachedFetch returns the response for key, from the cache when one
+// younger than ttl is there and from fetch otherwise. fetchedAt tells how
+// old the returned data is. Without a TTL, or with noCache, the cache is
+// neither read nor written.
+func cachedFetch(key string, ttl time.Duration, noCache bool, fetch func() ([]byte, error)) (data []byte, fetchedAt time.Time, err error) {
+	useCache := ttl > 0 && !noCache
+	if useCache {
+		if cached, ok := loadCachedResponse(key, ttl); ok {
+			return cached.Data, cached.FetchedAt, nil
+		}
+	}
+
+	data, err = fetch()
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	fetched := cachedResponse{FetchedAt: helpers.Now(), Data: data}
+	if useCache {
+		if encoded, err := json.Marshal(fetched); err == nil {
+			// A response that cannot be saved is only fetched again next
+			// time.
+			helpers.WriteFileAtomic(responseCachePath(key), encoded, 0600)
+		}
+	}
+	return data, fetched.FetchedAt, nil
+}
+
+// loadCachedResponse returns the entry for key if it is younger than ttl,
+// removing it once it is not.
+func loadCachedResponse(key string, ttl time.Duration) (cachedResponse, bool) {
+	path := responseCachePath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cachedResponse{}, false
+	}
+	var cached cachedResponse
+	if err := json.Unmarshal(data, &cached); err != nil || len(cached.Data) == 0 {
+		os.Remove(path)
+		return cachedResponse{}, false
+	}
+	if age := helpers.Now().Sub(cached.FetchedAt); age < 0 || age >= ttl {
+		os.Remove(path)
+		return cachedResponse{}, false
+	}
+	return cached, true
+}
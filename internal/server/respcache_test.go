@@ -0,0 +1,132 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+func withResponseCache(t *testing.T) string {
+	t.Helper()
+	originalDir, originalNow := responseCacheDir, helpers.Now
+	responseCacheDir = t.TempDir()
+	t.Cleanup(func() {
+		responseCacheDir, helpers.Now = originalDir, originalNow
+	})
+	return responseCacheDir
+}
+
+func TestCachedFetch(t *testing.T) {
+	dir := withResponseCache(t)
+	now := time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+	helpers.Now = func() time.Time { return now }
+	fetches := 0
+	fetch := func() ([]byte, error) {
+		fetches++
+		return []byte(`["social"]`), nil
+	}
+
+	cachedFetch("dev_graphs", 0, false, fetch)
+	data, fetchedAt, _ := cachedFetch("dev_graphs", 0, false, fetch)
+	if fetches != 2 || string(data) != `["social"]` || !fetchedAt.Equal(now) {
+		t.Errorf("Expected every call to fetch without a TTL, got %d (%s at %s)", fetches, data, fetchedAt)
+	}
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected nothing on disk without a TTL, got %d files", len(entries))
+	}
+
+	cachedFetch("prod_graphs", time.Minute, false, fetch)
+	now = now.Add(30 * time.Second)
+	if _, fetchedAt, _ := cachedFetch("prod_graphs", time.Minute, false, fetch); fetches != 3 || now.Sub(fetchedAt) != 30*time.Second {
+		t.Errorf("Expected the disk entry to be reused, got %d fetches (fetched %s)", fetches, fetchedAt)
+	}
+	if info, err := os.Stat(filepath.Join(dir, "prod_graphs.json")); err != nil || info.Mode().Perm() != 0600 {
+		t.Errorf("Expected a private cache file, got %v", err)
+	}
+
+	cachedFetch("prod_graphs", time.Minute, true, fetch)
+	if fetches != 4 {
+		t.Errorf("Expected --no-cache to fetch again, got %d fetches", fetches)
+	}
+
+	now = now.Add(time.Minute)
+	if _, fetchedAt, _ := cachedFetch("prod_graphs", time.Minute, false, fetch); fetches != 5 || !fetchedAt.Equal(now) {
+		t.Errorf("Expected an expired entry to be fetched again, got %d fetches", fetches)
+	}
+
+	failing := func() ([]byte, error) { return nil, errors.New("login failed") }
+	if _, _, err := cachedFetch("qa_graphs", time.Minute, false, failing); err == nil {
+		t.Error("Expected the fetch error")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "qa_graphs.json")); !os.IsNotExist(err) {
+		t.Error("Expected a failed fetch not to be cached")
+	}
+}
+
+func TestRunGraphsCache(t *testing.T) {
+	cleanup := setupServerTestEnvironment(t)
+	defer cleanup()
+	withResponseCache(t)
+
+	logins := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/gsqlserver/gsql/login":
+			logins++
+			json.NewEncoder(w).Encode(map[string]interface{}{"isClientCompatible": true, "welcomeMessage": "Welcome"})
+		case "/gsqlserver/gsql/file":
+			w.Write([]byte("  - Graph social(Person:v)\n  - Graph fraud(Account:v)\n"))
+		}
+	}))
+	defer mockServer.Close()
+	u, _ := url.Parse(mockServer.URL)
+	viper.Set("gsql.cache_ttl", "1m")
+
+	run := func(flags ...string) string {
+		cmd := &cobra.Command{}
+		cmd.Flags().String("host", "http://"+u.Hostname(), "")
+		cmd.Flags().String("gsPort", u.Port(), "")
+		cmd.Flags().String("output", "stdout", "")
+		cmd.Flags().Duration("cache-ttl", 0, "")
+		cmd.Flags().Bool("no-cache", false, "")
+		cmd.Flags().StringArray("graph", nil, "")
+		cmd.Flags().StringArray("exclude-graph", nil, "")
+		for _, flag := range flags {
+			name, value, found := strings.Cut(flag, "=")
+			if !found {
+				value = "true"
+			}
+			cmd.Flags().Set(name, value)
+		}
+		return captureOutput(func() { RunGraphs(cmd, nil) })
+	}
+
+	if out := run(); out != "fraud\nsocial\n" {
+		t.Errorf("Unexpected output %q", out)
+	}
+	run()
+	if logins != 1 {
+		t.Errorf("Expected gsql.cache_ttl to reuse the list across runs, got %d logins", logins)
+	}
+	if out := run("no-cache"); logins != 2 || !strings.Contains(out, "social") {
+		t.Errorf("Expected --no-cache to log in again, got %d logins", logins)
+	}
+	if out := run("graph=*a*", "exclude-graph=soc*"); out != "fraud\n" {
+		t.Errorf("Expected the selection to narrow the cached list, got %q", out)
+	}
+	status := helpers.ExitStatus()
+	if out := run("graph=socail"); out != "" || (status == 0 && helpers.ExitStatus() != helpers.ExitFailure) {
+		t.Errorf("Expected an unknown graph to fail without output, got %q (exit status %d)", out, helpers.ExitStatus())
+	}
+}
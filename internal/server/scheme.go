@@ -0,0 +1,202 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/helpers"
+)
+
+// serverTransport carries requests to TigerGraph servers. Tests replace it
+// with a transport that trusts their TLS test server.
+var serverTransport http.RoundTripper = http.DefaultTransport
+
+// schemeSignatures are error and response texts seen when http:// is used
+// against a TLS port, or https:// against a plain HTTP port.
+var schemeSignatures = []string{
+	"malformed HTTP response",
+	"server gave HTTP response to HTTPS client",
+	"first record does not look like a TLS handshake",
+	"HTTP request to an HTTPS server",
+	"plain HTTP request was sent to HTTPS port",
+}
+
+// schemeMismatchError reports that the server answers on the other scheme.
+type schemeMismatchError struct {
+	Address string
+	Host    string
+	Scheme  string
+	Alias   string
+}
+
+func (e *schemeMismatchError) Error() string {
+	suggested := e.Scheme + "://" + e.Host
+	fix := "use --host " + suggested
+	if e.Alias != "" {
+		fix = fmt.Sprintf("update your alias with: tg conf update --alias %s --host %s", e.Alias, suggested)
+	}
+	return fmt.Sprintf("the server at %s speaks %s — %s", e.Address, strings.ToUpper(e.Scheme), fix)
+}
+
+// unwrapSchemeMismatch returns the scheme mismatch inside err without the
+// url.Error the client wraps it in, or err unchanged.
+func unwrapSchemeMismatch(err error) error {
+	var mismatch *schemeMismatchError
+	if errors.As(err, &mismatch) {
+		return mismatch
+	}
+	return err
+}
+
+// newServerClient returns a client for the server behind alias whose
+// transport recognises a wrong http/https scheme. With --auto-scheme it
+// switches to the scheme the server speaks instead of failing.
+func newServerClient(cmd *cobra.Command, alias string, timeout time.Duration) *http.Client {
+	autoScheme, _ := cmd.Flags().GetBool("auto-scheme")
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     helpers.WrapTransport(&schemeTransport{base: serverTransport, alias: alias, autoScheme: autoScheme}),
+		CheckRedirect: helpers.FollowRedirect,
+	}
+}
+
+// schemeTransport probes the opposite scheme once when a request fails the
+// way a scheme mismatch does, and remembers the outcome for later requests.
+type schemeTransport struct {
+	base       http.RoundTripper
+	alias      string
+	autoScheme bool
+
+	mu       sync.Mutex
+	probed   bool
+	mismatch *schemeMismatchError
+	switched bool
+}
+
+func (t *schemeTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	t.mu.Lock()
+	mismatch, switched := t.mismatch, t.switched
+	t.mu.Unlock()
+	if switched {
+		return t.base.RoundTrip(withScheme(req, mismatch.Scheme))
+	}
+
+	resp, err := t.base.RoundTrip(req)
+	if !isSchemeMismatch(req, resp, err) {
+		return resp, err
+	}
+
+	if mismatch = t.detect(req); mismatch == nil {
+		return resp, err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	if !t.autoScheme || (req.Body != nil && req.GetBody == nil) {
+		return nil, mismatch
+	}
+
+	t.mu.Lock()
+	if !t.switched {
+		t.switched = true
+		fmt.Fprintf(helpers.Stdout(), "Note: the server at %s speaks %s, using %s://%s for this command\n", mismatch.Address, strings.ToUpper(mismatch.Scheme), mismatch.Scheme, mismatch.Address)
+	}
+	t.mu.Unlock()
+	return t.base.RoundTrip(withScheme(req, mismatch.Scheme))
+}
+
+// detect probes the opposite scheme the first time it is called and
+// returns the mismatch when the server answers on it.
+func (t *schemeTransport) detect(req *http.Request) *schemeMismatchError {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if !t.probed {
+		t.probed = true
+		if other := oppositeScheme(req.URL.Scheme); t.speaks(req, other) {
+			t.mismatch = &schemeMismatchError{Address: req.URL.Host, Host: req.URL.Hostname(), Scheme: other, Alias: t.alias}
+		}
+	}
+	return t.mismatch
+}
+
+// speaks reports whether the server answers on scheme. A certificate the
+// client does not trust still proves the port speaks TLS.
+func (t *schemeTransport) speaks(req *http.Request, scheme string) bool {
+	probe, err := http.NewRequestWithContext(req.Context(), "GET", scheme+"://"+req.URL.Host+"/", nil)
+	if err != nil {
+		return false
+	}
+	resp, err := t.base.RoundTrip(probe)
+	if err == nil {
+		defer resp.Body.Close()
+		return !isSchemeMismatch(probe, resp, nil)
+	}
+
+	var unknownAuthority x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var verifyErr *tls.CertificateVerificationError
+	return scheme == "https" && (errors.As(err, &unknownAuthority) || errors.As(err, &hostnameErr) || errors.As(err, &verifyErr))
+}
+
+// isSchemeMismatch reports whether a request failed the way it does when
+// the scheme does not match the port. TLS servers typically answer plain
+// HTTP with a 400 explaining the problem, or close the connection; plain
+// servers answer a TLS handshake with bytes that are not a TLS record.
+func isSchemeMismatch(req *http.Request, resp *http.Response, err error) bool {
+	if err != nil {
+		var recordErr tls.RecordHeaderError
+		if errors.As(err, &recordErr) {
+			return true
+		}
+		if req.URL.Scheme == "http" && (errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF)) {
+			return true
+		}
+		return containsSignature(err.Error())
+	}
+
+	if resp == nil || resp.StatusCode != http.StatusBadRequest || req.URL.Scheme != "http" {
+		return false
+	}
+	// Peek at the start of the body and put it back for the caller.
+	head, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+	resp.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(head), resp.Body), resp.Body}
+	return containsSignature(string(head))
+}
+
+func containsSignature(text string) bool {
+	for _, signature := range schemeSignatures {
+		if strings.Contains(text, signature) {
+			return true
+		}
+	}
+	return false
+}
+
+func oppositeScheme(scheme string) string {
+	if scheme == "https" {
+		return "http"
+	}
+	return "https"
+}
+
+// withScheme returns a copy of req sent with another scheme.
+func withScheme(req *http.Request, scheme string) *http.Request {
+	clone := req.Clone(req.Context())
+	clone.URL.Scheme = scheme
+	if req.GetBody != nil {
+		clone.Body, _ = req.GetBody()
+	}
+	return clone
+}
@@ -0,0 +1,204 @@
+package server
+
+import (
+	"bytes"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+)
+
+// newLoginServer serves the admin login endpoint over TLS or plain HTTP and
+// returns the URL with the wrong scheme for it.
+func newLoginServer(t *testing.T, useTLS bool) (*httptest.Server, string) {
+	t.Helper()
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/auth/login" {
+			http.SetCookie(w, &http.Cookie{Name: "TigerGraphApp", Value: "session"})
+			return
+		}
+		w.WriteHeader(http.StatusNotFound)
+	}))
+	// Silence the handshake errors the mismatched requests cause.
+	server.Config.ErrorLog = log.New(io.Discard, "", 0)
+
+	wrongURL := "https://" + server.Listener.Addr().String()
+	if useTLS {
+		server.StartTLS()
+		wrongURL = "http://" + server.Listener.Addr().String()
+	} else {
+		server.Start()
+	}
+	t.Cleanup(server.Close)
+	return server, wrongURL
+}
+
+// useServerTransport makes server clients trust the TLS test server.
+func useServerTransport(t *testing.T, transport http.RoundTripper) {
+	original := serverTransport
+	serverTransport = transport
+	t.Cleanup(func() { serverTransport = original })
+}
+
+func newSchemeCmd(autoScheme bool) *cobra.Command {
+	cmd := &cobra.Command{}
+	cmd.Flags().Bool("auto-scheme", autoScheme, "")
+	return cmd
+}
+
+func TestSchemeMismatchSuggestion(t *testing.T) {
+	tests := []struct {
+		name     string
+		useTLS   bool
+		alias    string
+		expected string
+	}{
+		{"http to TLS port", true, "prod", "the server at %s speaks HTTPS — update your alias with: tg conf update --alias prod --host https://127.0.0.1"},
+		{"https to plain port", false, "prod", "the server at %s speaks HTTP — update your alias with: tg conf update --alias prod --host http://127.0.0.1"},
+		{"without alias", true, "", "the server at %s speaks HTTPS — use --host https://127.0.0.1"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server, wrongURL := newLoginServer(t, tt.useTLS)
+			useServerTransport(t, server.Client().Transport)
+
+			client := newServerClient(newSchemeCmd(false), tt.alias, 5*time.Second)
+			_, err := adminLogin(client, wrongURL, "tigergraph", "tigergraph")
+
+			var mismatch *schemeMismatchError
+			if !errors.As(err, &mismatch) {
+				t.Fatalf("Expected a scheme mismatch, got %v", err)
+			}
+			if expected := fmt.Sprintf(tt.expected, server.Listener.Addr()); err.Error() != expected {
+				t.Errorf("Unexpected suggestion:\n%s\nexpected:\n%s", err, expected)
+			}
+		})
+	}
+}
+
+func TestSchemeMismatchUntrustedCertificate(t *testing.T) {
+	_, wrongURL := newLoginServer(t, true)
+	useServerTransport(t, http.DefaultTransport)
+
+	client := newServerClient(newSchemeCmd(false), "prod", 5*time.Second)
+	_, err := adminLogin(client, wrongURL, "tigergraph", "tigergraph")
+	if err == nil || !strings.Contains(err.Error(), "speaks HTTPS") {
+		t.Errorf("A self-signed certificate should still be recognised as HTTPS, got %v", err)
+	}
+}
+
+func TestAutoScheme(t *testing.T) {
+	for _, useTLS := range []bool{true, false} {
+		server, wrongURL := newLoginServer(t, useTLS)
+		useServerTransport(t, server.Client().Transport)
+
+		oldStdout := os.Stdout
+		r, w, _ := os.Pipe()
+		os.Stdout = w
+
+		client := newServerClient(newSchemeCmd(true), "prod", 5*time.Second)
+		cookie, err := adminLogin(client, wrongURL, "tigergraph", "tigergraph")
+		// Later requests go straight to the working scheme.
+		_, again := adminLogin(client, wrongURL, "tigergraph", "tigergraph")
+
+		w.Close()
+		os.Stdout = oldStdout
+		var output bytes.Buffer
+		output.ReadFrom(r)
+
+		if err != nil || again != nil || cookie != "TigerGraphApp=session" {
+			t.Errorf("TLS=%v: expected --auto-scheme to log in, got %q, %v, %v", useTLS, cookie, err, again)
+		}
+		if note := output.String(); strings.Count(note, "Note: the server at") != 1 || !strings.Contains(note, server.URL) {
+			t.Errorf("TLS=%v: expected one note naming %s, got %q", useTLS, server.URL, note)
+		}
+	}
+}
+
+func TestGSQLLoginStopsOnSchemeMismatch(t *testing.T) {
+	server, wrongURL := newLoginServer(t, true)
+	useServerTransport(t, server.Client().Transport)
+
+	session := &GSQLSession{
+		Host:        wrongURL,
+		User:        "tigergraph",
+		Password:    "tigergraph",
+		Client:      newServerClient(newSchemeCmd(false), "prod", 5*time.Second),
+		ProbeBudget: 10 * time.Second,
+	}
+
+	start := time.Now()
+	err := session.login()
+	if err == nil || !strings.HasPrefix(err.Error(), "the server at") {
+		t.Errorf("Expected the scheme mismatch to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*time.Second {
+		t.Errorf("Login kept probing for %s after a scheme mismatch", elapsed)
+	}
+}
+
+func TestSchemeMismatchPassesOtherFailures(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "invalid payload", http.StatusBadRequest)
+	}))
+	defer server.Close()
+	useServerTransport(t, http.DefaultTransport)
+
+	client := newServerClient(newSchemeCmd(true), "prod", 5*time.Second)
+	resp, err := client.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Expected the response to be passed through, got %v", err)
+	}
+	defer resp.Body.Close()
+	if body, _ := io.ReadAll(resp.Body); resp.StatusCode != http.StatusBadRequest || string(body) != "invalid payload\n" {
+		t.Errorf("Expected the original 400 with its body, got %d %q", resp.StatusCode, body)
+	}
+}
+
+func TestIsSchemeMismatch(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "http://host:14240/", nil)
+	httpsReq, _ := http.NewRequest("GET", "https://host:14240/", nil)
+
+	tests := []struct {
+		name     string
+		req      *http.Request
+		err      error
+		expected bool
+	}{
+		{"TLS alert read as HTTP", httpReq, errors.New(`malformed HTTP response "\x15\x03\x01\x00\x02\x02"`), true},
+		{"TLS port closes plain connection", httpReq, io.EOF, true},
+		{"plain port answers handshake", httpsReq, tls.RecordHeaderError{Msg: "first record does not look like a TLS handshake"}, true},
+		{"plain port message", httpsReq, errors.New("http: server gave HTTP response to HTTPS client"), true},
+		{"EOF over https", httpsReq, io.EOF, false},
+		{"connection refused", httpReq, errors.New("dial tcp 127.0.0.1:14240: connect: connection refused"), false},
+	}
+	for _, tt := range tests {
+		if got := isSchemeMismatch(tt.req, nil, tt.err); got != tt.expected {
+			t.Errorf("%s: isSchemeMismatch = %v, expected %v", tt.name, got, tt.expected)
+		}
+	}
+
+	for body, expected := range map[string]bool{
+		"Client sent an HTTP request to an HTTPS server.\n": true,
+		"The plain HTTP request was sent to HTTPS port":     true,
+		"invalid payload": false,
+	} {
+		resp := &http.Response{StatusCode: http.StatusBadRequest, Body: io.NopCloser(strings.NewReader(body))}
+		if got := isSchemeMismatch(httpReq, resp, nil); got != expected {
+			t.Errorf("400 %q: isSchemeMismatch = %v, expected %v", body, got, expected)
+		}
+		if kept, _ := io.ReadAll(resp.Body); string(kept) != body {
+			t.Errorf("400 %q: body not restored, got %q", body, kept)
+		}
+	}
+}
@@ -0,0 +1,176 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// Scratch buffers let a long statement be composed in an editor from the
+// GSQL prompt. Named buffers are kept under scratchDir, which defaults to
+// ~/.tgcli/scratch; unnamed ones are temporary files, removed when another
+// takes their place or the session ends.
+var (
+	scratchDir string
+	// editorForkThreshold is how quickly an editor has to return an
+	// unchanged file to be suspected of forking into the background.
+	editorForkThreshold = 500 * time.Millisecond
+)
+
+var errEditorReturnedEarly = errors.New("the editor returned immediately without changing the file; " +
+	`if it runs in the background, make it wait, e.g. EDITOR="code --wait"`)
+
+func scratchPath(name string) string {
+	dir := scratchDir
+	if dir == "" {
+		dir = filepath.Join(constants.ConfigDir, "scratch")
+	}
+	return filepath.Join(dir, name+".gsql")
+}
+
+// tempScratchPrefix starts the names of unnamed buffers' temporary files.
+const tempScratchPrefix = "tgcli-"
+
+// isTempScratch reports whether path is an unnamed buffer's temporary file.
+func isTempScratch(path string) bool {
+	return path != "" && strings.HasPrefix(filepath.Base(path), tempScratchPrefix) &&
+		filepath.Dir(path) == filepath.Clean(os.TempDir())
+}
+
+// removeTempScratch deletes the buffer \edit! would reopen when it is an
+// unnamed one, as the session ends.
+func (s *GSQLSession) removeTempScratch() {
+	if isTempScratch(s.lastScratch) {
+		os.Remove(s.lastScratch)
+		s.lastScratch = ""
+	}
+}
+
+// editorCommand returns $EDITOR split into its arguments, falling back to
+// notepad on Windows and vi elsewhere.
+func editorCommand() []string {
+	if editor := strings.Fields(os.Getenv("EDITOR")); len(editor) > 0 {
+		return editor
+	}
+	if runtime.GOOS == "windows" {
+		return []string{"notepad"}
+	}
+	return []string{"vi"}
+}
+
+// isEditCommand reports whether line is an \edit meta-command.
+func isEditCommand(line string) bool {
+	fields := strings.Fields(line)
+	return len(fields) > 0 && (fields[0] == `\edit` || fields[0] == `\edit!`)
+}
+
+// editScratch handles \edit, \edit <name> and \edit!. It opens the buffer
+// in the editor, shows the result and runs it once the user confirms.
+// Answers are read from reader, the prompt's own input.
+func (s *GSQLSession) editScratch(line string, reader *bufio.Reader) error {
+	path, err := s.scratchBuffer(strings.Fields(line))
+	if err != nil {
+		return err
+	}
+	if err := runEditor(path); err != nil {
+		if path != s.lastScratch && isTempScratch(path) {
+			os.Remove(path)
+		}
+		return err
+	}
+	if path != s.lastScratch {
+		s.removeTempScratch()
+		s.lastScratch = path
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	statement := strings.TrimSpace(string(data))
+	if statement == "" {
+		fmt.Fprintln(s.out(), "Buffer is empty, nothing to run")
+		return nil
+	}
+
+	fmt.Println(statement)
+	s.capture.echo(statement)
+	const confirm = "Run this? (y/n) [n] "
+	fmt.Print(confirm)
+	answer, _ := reader.ReadString('\n')
+	s.capture.input(confirm, strings.TrimSpace(answer))
+	if run, _ := helpers.ParseYesNo(answer); !run {
+		fmt.Fprintln(s.out(), `Not run. Reopen it with \edit!`)
+		return nil
+	}
+	s.remember(statement)
+	return s.executeCommand(statement)
+}
+
+// scratchBuffer returns the file an \edit command opens.
+func (s *GSQLSession) scratchBuffer(fields []string) (string, error) {
+	if fields[0] == `\edit!` {
+		if len(fields) > 1 {
+			return "", fmt.Errorf(`\edit! takes no name`)
+		}
+		if s.lastScratch == "" {
+			return "", fmt.Errorf(`no previous buffer, use \edit first`)
+		}
+		return s.lastScratch, nil
+	}
+
+	switch len(fields) {
+	case 1:
+		file, err := os.CreateTemp("", tempScratchPrefix+"*.gsql")
+		if err != nil {
+			return "", err
+		}
+		file.Close()
+		return file.Name(), nil
+	case 2:
+		name := fields[1]
+		if unsafeKeyChars.MatchString(name) {
+			return "", fmt.Errorf("invalid buffer name %q (use letters, digits, '.', '_' and '-')", name)
+		}
+		path := scratchPath(name)
+		if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+			return "", err
+		}
+		return path, nil
+	}
+	return "", fmt.Errorf(`usage: \edit [name] or \edit!`)
+}
+
+// runEditor opens path in the editor and waits for it to exit. An editor
+// that hands back an unchanged file right away has most likely forked.
+func runEditor(path string) error {
+	before, _ := os.ReadFile(path)
+
+	editor := editorCommand()
+	cmd := exec.Command(editor[0], append(editor[1:], path)...)
+	cmd.Stdin, cmd.Stdout, cmd.Stderr = os.Stdin, os.Stdout, os.Stderr
+
+	start := time.Now()
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("running %s: %v", strings.Join(editor, " "), err)
+	}
+
+	after, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	if bytes.Equal(before, after) && time.Since(start) < editorForkThreshold {
+		return errEditorReturnedEarly
+	}
+	return nil
+}
@@ -0,0 +1,206 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+)
+
+// useFakeEditor points $EDITOR at a shell script with the given body, run
+// with the file to edit as "$1", and keeps scratch buffers in a temp dir.
+func useFakeEditor(t *testing.T, body string) {
+	t.Helper()
+	if runtime.GOOS == "windows" {
+		t.Skip("fake editor is a shell script")
+	}
+	dir := t.TempDir()
+	script := filepath.Join(dir, "fake-editor")
+	if err := os.WriteFile(script, []byte("#!/bin/sh\n"+body+"\n"), 0700); err != nil {
+		t.Fatalf("Failed to write fake editor: %v", err)
+	}
+	t.Setenv("EDITOR", script)
+	t.Setenv("TMPDIR", dir)
+
+	originalDir := scratchDir
+	scratchDir = filepath.Join(dir, "scratch")
+	t.Cleanup(func() { scratchDir = originalDir })
+}
+
+// mockCommandServer records the statements sent to the GSQL file endpoint.
+func mockCommandServer(t *testing.T, received *[]string) *GSQLSession {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*received = append(*received, string(body))
+		w.Write([]byte("ok\n"))
+	}))
+	t.Cleanup(server.Close)
+	return &GSQLSession{Host: server.URL, Client: server.Client()}
+}
+
+func answers(lines ...string) *bufio.Reader {
+	return bufio.NewReader(strings.NewReader(strings.Join(lines, "\n") + "\n"))
+}
+
+func TestEditScratchRunsConfirmedBuffer(t *testing.T) {
+	useFakeEditor(t, `printf 'USE GRAPH social\nSHOW VERTEX *\n' > "$1"`)
+	var received []string
+	session := mockCommandServer(t, &received)
+
+	output := captureOutput(func() {
+		if err := session.editScratch(`\edit`, answers("y")); err != nil {
+			t.Errorf("editScratch failed: %v", err)
+		}
+	})
+
+	if len(received) != 1 || received[0] != "USE GRAPH social\nSHOW VERTEX *" {
+		t.Errorf("Expected the buffer to be executed once, got %q", received)
+	}
+	if !strings.Contains(output, "USE GRAPH social\nSHOW VERTEX *\nRun this? (y/n) [n] ") {
+		t.Errorf("Expected the buffer to be shown before the prompt, got %q", output)
+	}
+	if !strings.HasSuffix(session.lastScratch, ".gsql") {
+		t.Errorf("Expected an unnamed buffer to be a .gsql file, got %q", session.lastScratch)
+	}
+}
+
+func TestEditScratchDeclined(t *testing.T) {
+	useFakeEditor(t, `echo 'DROP ALL' > "$1"`)
+	var received []string
+	session := mockCommandServer(t, &received)
+
+	output := captureOutput(func() { session.editScratch(`\edit`, answers("n")) })
+	if len(received) != 0 {
+		t.Errorf("A declined buffer must not run, got %q", received)
+	}
+	if !strings.Contains(output, `Not run. Reopen it with \edit!`) {
+		t.Errorf("Expected a hint to reopen the buffer, got %q", output)
+	}
+}
+
+func TestEditScratchNamedBufferPersists(t *testing.T) {
+	useFakeEditor(t, `echo 'SHOW GRAPH' >> "$1"`)
+	var received []string
+	session := mockCommandServer(t, &received)
+
+	captureOutput(func() { session.editScratch(`\edit report`, answers("n")) })
+	captureOutput(func() { session.editScratch(`\edit!`, answers("y")) })
+
+	data, err := os.ReadFile(scratchPath("report"))
+	if err != nil || string(data) != "SHOW GRAPH\nSHOW GRAPH\n" {
+		t.Fatalf("Expected \\edit! to reopen the named buffer, got %q (%v)", data, err)
+	}
+	if len(received) != 1 || received[0] != "SHOW GRAPH\nSHOW GRAPH" {
+		t.Errorf("Expected the reopened buffer to run, got %q", received)
+	}
+
+	// A new session still finds the named buffer on disk.
+	next := mockCommandServer(t, &received)
+	captureOutput(func() { next.editScratch(`\edit report`, answers("n")) })
+	if data, _ := os.ReadFile(scratchPath("report")); strings.Count(string(data), "SHOW GRAPH") != 3 {
+		t.Errorf("Expected the named buffer to persist across sessions, got %q", data)
+	}
+}
+
+func TestEditScratchRemovesTempFiles(t *testing.T) {
+	useFakeEditor(t, `echo 'SHOW GRAPH' > "$1"`)
+	var received []string
+	session := mockCommandServer(t, &received)
+	tempFiles := func() []string {
+		files, _ := filepath.Glob(filepath.Join(os.TempDir(), tempScratchPrefix+"*.gsql"))
+		return files
+	}
+
+	captureOutput(func() { session.editScratch(`\edit`, answers("n")) })
+	first := session.lastScratch
+	captureOutput(func() { session.editScratch(`\edit`, answers("n")) })
+	if files := tempFiles(); len(files) != 1 || files[0] == first {
+		t.Errorf("Expected a new unnamed buffer to replace the previous one, got %q", files)
+	}
+
+	// The last one goes when the session ends.
+	captureOutput(func() { session.startInteractiveSession(strings.NewReader("\\edit\nn\nquit\n")) })
+	if files := tempFiles(); len(files) != 0 {
+		t.Errorf("Expected no unnamed buffers after the session, got %q", files)
+	}
+}
+
+func TestEditScratchForkingEditor(t *testing.T) {
+	useFakeEditor(t, `exit 0`)
+	session := &GSQLSession{}
+
+	err := session.editScratch(`\edit`, answers())
+	if err == nil || !strings.Contains(err.Error(), `EDITOR="code --wait"`) {
+		t.Errorf("Expected guidance for forking editors, got %v", err)
+	}
+
+	// An editor that takes its time is trusted even if nothing changed.
+	original := editorForkThreshold
+	editorForkThreshold = 0
+	defer func() { editorForkThreshold = original }()
+	output := captureOutput(func() {
+		if err := session.editScratch(`\edit`, answers()); err != nil {
+			t.Errorf("editScratch failed: %v", err)
+		}
+	})
+	if !strings.Contains(output, "Buffer is empty") {
+		t.Errorf("Expected an empty buffer notice, got %q", output)
+	}
+}
+
+func TestEditScratchErrors(t *testing.T) {
+	useFakeEditor(t, `exit 3`)
+	session := &GSQLSession{}
+
+	tests := []struct {
+		line    string
+		errText string
+	}{
+		{`\edit!`, "no previous buffer"},
+		{`\edit ../etc`, "invalid buffer name"},
+		{`\edit a b`, "usage"},
+		{`\edit! a`, "takes no name"},
+		{`\edit`, "exit status 3"},
+	}
+	for _, tt := range tests {
+		if err := session.editScratch(tt.line, answers()); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("%s: expected error containing %q, got %v", tt.line, tt.errText, err)
+		}
+	}
+}
+
+func TestEditorCommand(t *testing.T) {
+	t.Setenv("EDITOR", "code --wait")
+	if got := editorCommand(); strings.Join(got, " ") != "code --wait" {
+		t.Errorf("Expected $EDITOR to be split into arguments, got %v", got)
+	}
+
+	t.Setenv("EDITOR", "")
+	expected := "vi"
+	if runtime.GOOS == "windows" {
+		expected = "notepad"
+	}
+	if got := editorCommand(); len(got) != 1 || got[0] != expected {
+		t.Errorf("Expected the %s fallback, got %v", expected, got)
+	}
+}
+
+func TestIsEditCommand(t *testing.T) {
+	for line, expected := range map[string]bool{
+		`\edit`:        true,
+		`\edit report`: true,
+		`\edit!`:       true,
+		`\editor`:      false,
+		`SHOW GRAPH`:   false,
+	} {
+		if got := isEditCommand(line); got != expected {
+			t.Errorf("isEditCommand(%q) = %v, expected %v", line, got, expected)
+		}
+	}
+}
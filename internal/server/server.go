@@ -5,18 +5,27 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"math/rand"
+	"net"
 	"net/http"
+	"net/url"
 	"os"
-	"regexp"
+	"sort"
 	"strings"
+	"syscall"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/events"
+	"github.com/zrougamed/tgCli/internal/helpers"
 	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/internal/telemetry"
 	"github.com/zrougamed/tgCli/pkg/constants"
+	"golang.org/x/term"
 )
 
 var versionCommits = map[string]string{
@@ -39,74 +48,526 @@ var versionCommits = map[string]string{
 	"3.0.0": "c90ec746a7e77ef5b108554be2133dfd1e1ab1b2",
 }
 
+// Login probing tries each known client version in turn. Each attempt gets a
+// short timeout of its own and the whole probe is bounded by a budget, so an
+// unresponsive server fails fast instead of costing one full client timeout
+// per version. Retries back off exponentially from probeBackoff up to
+// maxProbeBackoff, with jitter.
+var (
+	defaultProbeTimeout = 5 * time.Second
+	defaultProbeBudget  = 30 * time.Second
+	probeBackoff        = 100 * time.Millisecond
+	maxProbeBackoff     = 2 * time.Second
+)
+
+// errAuthentication marks login failures caused by rejected credentials,
+// which no other version or retry will fix.
+var errAuthentication = errors.New("authentication failed")
+
+// maxPasswordPrompts is how many times an interactive login asks for the
+// password again after it was rejected.
+const maxPasswordPrompts = 3
+
+// isInteractive and readPassword let an interactive login re-prompt for a
+// mistyped password. Tests replace them.
+var (
+	isInteractive = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	readPassword  = func() (string, error) {
+		password, err := term.ReadPassword(int(syscall.Stdin))
+		fmt.Println()
+		return string(password), err
+	}
+)
+
 type GSQLSession struct {
 	Host     string
 	User     string
 	Password string
 	Version  string
 	Cookie   models.GSQLCookie
-	Client   *http.Client
+	// Token, when set, is sent as a bearer token instead of the user and
+	// password; see useExternalAuth.
+	Token        string
+	Client       *http.Client
+	ProbeTimeout time.Duration
+	ProbeBudget  time.Duration
+	// MaxResponseSize stops reading a command's output after this many
+	// bytes; 0 reads everything.
+	MaxResponseSize int64
+	// Versions restricts login probing to these versions, in order. When
+	// empty every known version is tried, newest first.
+	Versions []string
+	// Alias is the configured alias the session was opened with, if any.
+	Alias string
+	// Prompt is the interactive prompt template; see prompt.
+	Prompt string
+	// Graph is the graph selected with USE GRAPH, empty in global scope.
+	Graph string
+	// Messages is where the session reports on the connection, such as
+	// the server's welcome message; nil means helpers.Stdout(). Commands
+	// whose output is data send them to stderr.
+	Messages io.Writer
+
+	// lastScratch is the buffer \edit! reopens.
+	lastScratch string
+	// stateKey names the file the interactive session saves its state to;
+	// see saveState.
+	stateKey string
+	// history records the statements of an interactive session; nil keeps
+	// none.
+	history       *gsqlHistory
+	historyWarned bool
+	// capture records the interactive session for --capture; nil records
+	// nothing.
+	capture *transcript
+	// tablesWritten counts the result tables runSingleCommand has written,
+	// so --out-prefix numbers them across files.
+	tablesWritten int
+	// resumed is set while a session adopted from the cache has had no
+	// request accepted yet; cacheKey names its cache entry, empty when
+	// --session-cache is off.
+	resumed  bool
+	cacheKey string
+}
+
+// out returns where the interactive session prints: stdout, and the
+// --capture transcript when there is one.
+func (s *GSQLSession) out() io.Writer {
+	if s.capture == nil {
+		return helpers.Stdout()
+	}
+	return io.MultiWriter(helpers.Stdout(), s.capture)
+}
+
+// messages returns where the session reports on the connection.
+func (s *GSQLSession) messages() io.Writer {
+	if s.Messages != nil {
+		return s.Messages
+	}
+	return helpers.Stdout()
+}
+
+// probeVersions returns the known versions within the inclusive range
+// "min-max", newest first. Either bound may be omitted ("3.5.0-", "-3.4.0");
+// an empty range selects every known version.
+func probeVersions(versionRange string) ([]string, error) {
+	var minVersion, maxVersion string
+	if versionRange = strings.TrimSpace(versionRange); versionRange != "" {
+		parts := strings.SplitN(versionRange, "-", 2)
+		minVersion = strings.TrimSpace(parts[0])
+		if len(parts) == 2 {
+			maxVersion = strings.TrimSpace(parts[1])
+		} else {
+			maxVersion = minVersion
+		}
+		if minVersion != "" && maxVersion != "" && helpers.CompareVersions(minVersion, maxVersion) > 0 {
+			return nil, fmt.Errorf("invalid version range %q: %s is newer than %s", versionRange, minVersion, maxVersion)
+		}
+	}
+
+	var versions []string
+	for version := range versionCommits {
+		if minVersion != "" && helpers.CompareVersions(version, minVersion) < 0 {
+			continue
+		}
+		if maxVersion != "" && helpers.CompareVersions(version, maxVersion) > 0 {
+			continue
+		}
+		versions = append(versions, version)
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		return helpers.CompareVersions(versions[i], versions[j]) > 0
+	})
+
+	if len(versions) == 0 {
+		return nil, fmt.Errorf("no known GSQL versions in range %q", versionRange)
+	}
+	return versions, nil
 }
 
 func RunGSQL(cmd *cobra.Command, args []string) {
-	alias, _ := cmd.Flags().GetString("alias")
+	alias := serverAlias(cmd)
 	user, _ := cmd.Flags().GetString("user")
 	password, _ := cmd.Flags().GetString("password")
 	host, _ := cmd.Flags().GetString("host")
 	gsPort, _ := cmd.Flags().GetString("gsPort")
+	format, _ := cmd.Flags().GetString("format")
+	outPrefix, _ := cmd.Flags().GetString("out-prefix")
+	strictInit, _ := cmd.Flags().GetBool("strict-init")
+	continueOnError, _ := cmd.Flags().GetBool("continue-on-error")
+	allowConcurrent, _ := cmd.Flags().GetBool("allow-concurrent")
+	capturePath, _ := cmd.Flags().GetString("capture")
+	initFile, explicitInit := initFilePath(cmd)
+
+	scripts, err := singleCommands(cmd)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if format == "" {
+		format = "text"
+	}
+	if !gsqlFormats[format] {
+		fmt.Fprintf(helpers.Stdout(), "Error: unknown --format %q (expected text, csv or tsv)\n", format)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if format != "text" && len(scripts) == 0 {
+		fmt.Fprintf(helpers.Stdout(), "Error: --format %s needs --command or --file\n", format)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if outPrefix != "" && format == "text" {
+		fmt.Fprintln(helpers.Stdout(), "Error: --out-prefix needs --format csv or tsv")
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	if capturePath != "" && len(scripts) > 0 {
+		fmt.Fprintln(helpers.Stdout(), "Error: --capture records an interactive session; with --command or --file, redirect the output instead")
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	noLoginCheck, externalCookie, token, err := externalAuth(cmd)
+	if err != nil {
+		fmt.Fprintf(helpers.Stdout(), "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	// A single command keeps stdout for its own output; connection
+	// messages go to stderr.
+	messages := helpers.Stdout()
+	if len(scripts) > 0 {
+		messages = os.Stderr
+	}
 
 	// Get configuration if alias is provided
 	if alias != "" {
 		machineConfig := getMachineConfig(alias)
 		if machineConfig != nil {
+			warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
 			host = machineConfig.Host
 			user = machineConfig.User
 			password = machineConfig.Password
 			gsPort = machineConfig.GSPort
 		} else {
-			fmt.Printf("Alias %s not found. Try: tg conf list\n", alias)
+			fmt.Fprintf(messages, "Alias %s not found. Try: tg conf list\n", alias)
+			helpers.Fail(helpers.ExitFailure)
 			return
 		}
 	}
 
 	fullHost := fmt.Sprintf("%s:%s", host, gsPort)
 
+	useSessionCache, _ := cmd.Flags().GetBool("session-cache")
+	logout, _ := cmd.Flags().GetBool("logout")
+	cacheKey := sessionCacheKey(alias, user, fullHost)
+
+	if logout {
+		if err := clearCachedSession(cacheKey); err != nil {
+			fmt.Fprintf(messages, "Error clearing cached session: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		fmt.Fprintf(messages, "Cleared cached GSQL session for %s\n", fullHost)
+		return
+	}
+	if len(scripts) == 0 && helpers.StdoutRedirected() {
+		fmt.Fprintln(os.Stderr, "Error: --out-file cannot capture an interactive GSQL session; pass --command or --file")
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
+	// Interactive sessions lock their alias so a second one can warn that
+	// changes made in one may surprise the other.
+	concurrent := false
+	if len(scripts) == 0 {
+		lockKey := sessionLockKey(alias, fullHost)
+		if others := activeSessions(lockKey); len(others) > 0 {
+			concurrent = true
+			if !allowConcurrent {
+				target := alias
+				if target == "" {
+					target = fullHost
+				}
+				helpers.Warn(helpers.WarnConcurrentSession, "another interactive session to %s is open (%s); changes made in one may surprise the other. --allow-concurrent skips this check", target, describeHolders(others))
+			}
+		}
+		lock, err := lockSession(lockKey, user, fullHost)
+		if err != nil {
+			helpers.Warn(helpers.WarnSessionState, "could not lock the session: %v", err)
+		}
+		helpers.OnExit(func(int) { lock.release() })
+		defer lock.release()
+	}
+
+	var capture *transcript
+	if capturePath != "" {
+		capture, err = openTranscript(capturePath, fullHost)
+		if err != nil {
+			fmt.Fprintf(messages, "Error: cannot write --capture %s: %v\n", capturePath, err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		helpers.OnExit(func(int) { capture.close() })
+		defer capture.close()
+	}
+
+	probeTimeout, _ := cmd.Flags().GetDuration("probe-timeout")
+	probeBudget, _ := cmd.Flags().GetDuration("probe-budget")
+	versionRange, _ := cmd.Flags().GetString("version-range")
+
+	versions, err := probeVersions(versionRange)
+	if err != nil {
+		fmt.Fprintf(messages, "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+	maxResponse, _ := cmd.Flags().GetString("max-response-size")
+	maxResponseSize, err := helpers.ParseByteSize(maxResponse)
+	if err != nil {
+		fmt.Fprintf(messages, "Error: --max-response-size: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+
 	session := &GSQLSession{
-		Host:     fullHost,
-		User:     user,
-		Password: password,
-		Client:   &http.Client{Timeout: 60 * time.Second},
+		Host:         fullHost,
+		User:         user,
+		Password:     password,
+		Client:       newServerClient(cmd, alias, 60*time.Second),
+		ProbeTimeout: probeTimeout,
+		ProbeBudget:  probeBudget,
+		Versions:     versions,
+		Alias:        alias,
+		Prompt:       promptTemplate(cmd),
+		Messages:     messages,
+
+		MaxResponseSize: maxResponseSize,
+	}
+
+	resumed := false
+	if noLoginCheck {
+		// Auth is managed elsewhere: nothing is probed, checked or cached.
+		session.useExternalAuth(externalCookie, token)
+		resumed, useSessionCache = true, false
+	}
+	if useSessionCache {
+		session.cacheKey = cacheKey
+		cached, err := loadCachedSession(cacheKey)
+		switch {
+		case err == nil:
+			if err := session.resume(cached); err == nil {
+				resumed = true
+			} else {
+				fmt.Fprintf(messages, "Cached session rejected (%v), logging in again\n", err)
+			}
+		case errors.Is(err, errSessionExpired):
+			fmt.Fprintln(messages, "Cached session expired, logging in again")
+		case !errors.Is(err, os.ErrNotExist):
+			fmt.Fprintf(messages, "Ignoring cached session: %v\n", err)
+		}
+	}
+
+	if !resumed {
+		if err := session.loginWithPrompt(); err != nil {
+			fmt.Fprintf(messages, "Error logging in to TigerGraph: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+	}
+
+	// Only a fresh login is cached: saving a resumed session would extend
+	// its TTL on every run and keep a rejected cookie cached. retryResumed
+	// caches the login that replaces one.
+	if useSessionCache && !resumed {
+		if err := saveCachedSession(cacheKey, session); err != nil {
+			helpers.Warn(helpers.WarnSessionCache, "could not cache session: %v", err)
+		}
 	}
 
-	if err := session.login(); err != nil {
-		fmt.Printf("Error logging in to TigerGraph: %v\n", err)
+	if noLoginCheck {
+		fmt.Fprintf(messages, "Using the supplied session for %s without a login check\n", fullHost)
+	} else {
+		fmt.Fprintf(messages, "Connected to TigerGraph at %s\n", fullHost)
+	}
+
+	if len(scripts) > 0 {
+		if session.runScripts(scripts, format, outPrefix, helpers.Stdout(), continueOnError) > 0 {
+			helpers.Fail(helpers.ExitFailure)
+		}
 		return
 	}
 
-	fmt.Printf("Connected to TigerGraph at %s\n", fullHost)
+	// The init file prepares an interactive session; scripts set up what
+	// they need themselves.
+	if err := session.runInitFile(initFile, explicitInit); err != nil {
+		if strictInit {
+			fmt.Fprintf(messages, "Error: %v\n", err)
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		helpers.Warn(helpers.WarnInitFile, "%v; continuing without it", err)
+	}
 
 	// Start interactive GSQL session
-	session.startInteractiveSession()
+	// Sessions sharing an alias would overwrite each other's saved state.
+	if !concurrent {
+		session.stateKey = cacheKey
+	}
+	session.history = openHistory()
+	if capture != nil {
+		capture.scrub = session.history.scrub
+		session.capture = capture
+	}
+	session.startInteractiveSession(os.Stdin)
 }
 
+// login signs in, probing the known GSQL versions for one the server
+// accepts.
 func (s *GSQLSession) login() error {
-	for version, commit := range versionCommits {
-		s.Cookie = models.GSQLCookie{
-			ClientCommit:    commit,
-			FromGsqlClient:  false,
-			FromGraphStudio: false,
-			GShellTest:      true,
-			FromGsqlServer:  false,
-		}
+	span := telemetry.StartSpan("gsql.login", telemetry.String("server.address", s.Host))
+	err := s.probeLogin()
+	span.Finish(err)
+	return err
+}
+
+func (s *GSQLSession) probeLogin() error {
+	probeTimeout, budget := s.ProbeTimeout, s.ProbeBudget
+	if probeTimeout <= 0 {
+		probeTimeout = defaultProbeTimeout
+	}
+	if budget <= 0 {
+		budget = defaultProbeBudget
+	}
+
+	// Probe with a short-timeout copy of the client, restoring the regular
+	// one for the commands that follow.
+	client := s.Client
+	probeClient := &http.Client{}
+	if client != nil {
+		*probeClient = *client
+	}
+	probeClient.Timeout = probeTimeout
+	s.Client = probeClient
+	defer func() { s.Client = client }()
 
-		if err := s.attemptLogin(version); err == nil {
-			s.Version = version
-			return nil
+	deadline := time.Now().Add(budget)
+	retries := 0
+	var lastErr error
+
+	versions := s.Versions
+	if len(versions) == 0 {
+		versions, _ = probeVersions("")
+	}
+
+	for _, version := range versions {
+		commit := versionCommits[version]
+		for attempt := 0; ; attempt++ {
+			if attempt > 0 {
+				sleepBackoff(retries, deadline)
+				retries++
+			}
+			if time.Now().After(deadline) {
+				return fmt.Errorf("server at %s did not respond within the %s login probe budget (last error: %v)", s.Host, budget, lastErr)
+			}
+
+			s.Cookie = models.GSQLCookie{
+				ClientCommit:    commit,
+				FromGsqlClient:  false,
+				FromGraphStudio: false,
+				GShellTest:      true,
+				FromGsqlServer:  false,
+			}
+
+			err := s.attemptLogin(version)
+			if err == nil {
+				s.Version = version
+				return nil
+			}
+			lastErr = err
+
+			if errors.Is(err, errAuthentication) {
+				s.Version = version
+				return err
+			}
+
+			var mismatch *schemeMismatchError
+			if errors.As(err, &mismatch) {
+				return mismatch
+			}
+
+			// Nothing listens at a host that refuses the connection or does
+			// not resolve, and retrying would only delay saying so.
+			if isDialError(err) {
+				return err
+			}
+			// Another transport failure says nothing about version
+			// compatibility, so retry the same version while the budget
+			// allows.
+			if !isTransportError(err) {
+				break
+			}
 		}
 	}
 	return fmt.Errorf("unable to establish compatible connection")
 }
 
+// loginWithPrompt logs in, asking for the password again when the server
+// rejects the credentials and stdin is a terminal. The prompt goes to
+// stderr so it stays out of redirected output.
+func (s *GSQLSession) loginWithPrompt() error {
+	err := s.login()
+	for prompts := 0; errors.Is(err, errAuthentication) && prompts < maxPasswordPrompts && isInteractive(); prompts++ {
+		fmt.Fprintf(s.messages(), "Login failed: %v\n", err)
+		fmt.Fprintf(os.Stderr, "Password for %s (attempt %d of %d): ", s.User, prompts+1, maxPasswordPrompts)
+		password, readErr := readPassword()
+		if readErr != nil {
+			return err
+		}
+		s.Password = password
+		if s.Version != "" {
+			s.Versions = []string{s.Version}
+		}
+		err = s.login()
+	}
+	return err
+}
+
+func isTransportError(err error) bool {
+	var urlErr *url.Error
+	return errors.As(err, &urlErr)
+}
+
+// isDialError reports whether err is a connection that could not be made
+// at all: refused, or to a host name that does not resolve. A dial that
+// timed out may be a busy server and is not one.
+func isDialError(err error) bool {
+	var opErr *net.OpError
+	return errors.As(err, &opErr) && opErr.Op == "dial" && !opErr.Timeout()
+}
+
+// sleepBackoff pauses before the retry after retries earlier ones: a random
+// duration up to probeBackoff doubled for each, capped at maxProbeBackoff,
+// and never past the deadline.
+func sleepBackoff(retries int, deadline time.Time) {
+	if probeBackoff <= 0 {
+		return
+	}
+	ceiling := probeBackoff << min(retries, 16)
+	if ceiling > maxProbeBackoff || ceiling <= 0 {
+		ceiling = maxProbeBackoff
+	}
+	pause := ceiling/2 + time.Duration(rand.Int63n(int64(ceiling/2)+1))
+	if remaining := time.Until(deadline); pause > remaining {
+		pause = remaining
+	}
+	if pause > 0 {
+		time.Sleep(pause)
+	}
+}
+
 func (s *GSQLSession) attemptLogin(version string) error {
 	userPass := fmt.Sprintf("%s:%s", s.User, s.Password)
 	b64Val := base64.StdEncoding.EncodeToString([]byte(userPass))
@@ -130,6 +591,10 @@ func (s *GSQLSession) attemptLogin(version string) error {
 	}
 	defer resp.Body.Close()
 
+	if resp.StatusCode == http.StatusUnauthorized {
+		return fmt.Errorf("%w: server returned status %d", errAuthentication, resp.StatusCode)
+	}
+
 	body, err := io.ReadAll(resp.Body)
 	if err != nil {
 		return err
@@ -148,7 +613,7 @@ func (s *GSQLSession) attemptLogin(version string) error {
 
 	if loginResp.IsClientCompatible {
 		if loginResp.Error && s.User != "__GSQL__secret" {
-			return fmt.Errorf("%s", loginResp.Message)
+			return fmt.Errorf("%w: %s", errAuthentication, loginResp.Message)
 		}
 
 		// Update cookies from response
@@ -159,57 +624,165 @@ func (s *GSQLSession) attemptLogin(version string) error {
 			}
 		}
 
-		fmt.Println(loginResp.WelcomeMessage)
+		fmt.Fprintln(s.messages(), loginResp.WelcomeMessage)
 		return nil
 	}
 
 	return fmt.Errorf("client not compatible with version %s", version)
 }
 
-func (s *GSQLSession) startInteractiveSession() {
-	reader := bufio.NewReader(os.Stdin)
+func (s *GSQLSession) startInteractiveSession(input io.Reader) {
+	reader := bufio.NewReader(input)
+	s.offerRestore(reader)
+	defer s.removeTempScratch()
 
+	stateWarned := false
+	// Input that ends without quit, on Ctrl+D or at the end of a piped
+	// script, ends the session once its last line has run; the saved state
+	// is kept so the next session can restore it.
+	inputEnded := false
 	for {
-		fmt.Print("GSQL > ")
+		if err := s.saveState(); err != nil && !stateWarned {
+			helpers.Warn(helpers.WarnSessionState, "could not save session state: %v", err)
+			stateWarned = true
+		}
+		if inputEnded {
+			fmt.Fprintln(s.out())
+			return
+		}
+		prompt := s.prompt()
+		fmt.Print(prompt)
 		command, err := reader.ReadString('\n')
-		if err != nil {
-			fmt.Printf("Error reading input: %v\n", err)
-			continue
+		inputEnded = errors.Is(err, io.EOF)
+		if err != nil && !inputEnded {
+			// Another read error would only repeat.
+			fmt.Fprintf(helpers.Stdout(), "Error reading input: %v\n", err)
+			return
 		}
 
 		command = strings.TrimSpace(command)
+		if command == "" {
+			continue
+		}
+		s.capture.input(prompt, command)
 
 		if command == "Quit" || command == "quit" || command == "exit" {
-			fmt.Println("Goodbye!")
+			s.clearState()
+			fmt.Fprintln(s.out(), "Goodbye!")
 			break
 		}
 
-		if command == "" {
-			continue
+		if isEditCommand(command) {
+			err = s.editScratch(command, reader)
+		} else if isGraphCommand(command) {
+			err = s.runGraphCommand(command)
+		} else if isHistoryCommand(command) {
+			err = s.runHistoryCommand(command)
+		} else if isHelpCommand(command) {
+			err = s.runHelpCommand(command)
+		} else {
+			s.remember(command)
+			err = s.executeCommand(command)
 		}
-
-		if err := s.executeCommand(command); err != nil {
-			fmt.Printf("Error executing command: %v\n", err)
+		if err != nil {
+			// The server's own error output has already been printed.
+			var gsqlErr *GSQLError
+			if !errors.As(err, &gsqlErr) {
+				fmt.Fprintf(s.out(), "Error executing command: %v\n", err)
+			}
 		}
 	}
 }
 
-func (s *GSQLSession) executeCommand(command string) error {
+// commandRequest builds the request that sends the GSQL read from body to
+// the GSQL file endpoint.
+func (s *GSQLSession) commandRequest(body io.Reader) (*http.Request, error) {
 	userPass := fmt.Sprintf("%s:%s", s.User, s.Password)
 	b64Val := base64.StdEncoding.EncodeToString([]byte(userPass))
 
 	cookieJSON, _ := json.Marshal(s.Cookie)
 
-	req, err := http.NewRequest("POST", s.Host+constants.GSQL_PATH+constants.FILE_ENDPOINT, strings.NewReader(command))
+	req, err := http.NewRequest("POST", s.Host+constants.GSQL_PATH+constants.FILE_ENDPOINT, body)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
 	req.Header.Set("Content-Language", "en-US")
 	req.Header.Set("Authorization", "Basic "+b64Val)
+	if s.Token != "" {
+		req.Header.Set("Authorization", "Bearer "+s.Token)
+	}
 	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
 	req.Header.Set("Cookie", string(cookieJSON))
 	req.Header.Set("User-Agent", "Java/1.8.0")
+	return req, nil
+}
+
+// queryCommand runs command without echoing anything and returns its
+// output, for commands whose output is parsed rather than shown.
+func (s *GSQLSession) queryCommand(command string) (string, error) {
+	var output string
+	err := s.retryResumed(strings.NewReader(command), func(body io.Reader) error {
+		var err error
+		output, err = s.query(body)
+		return err
+	})
+	return output, err
+}
+
+// query is queryCommand for GSQL read from body.
+func (s *GSQLSession) query(body io.Reader) (string, error) {
+	req, err := s.commandRequest(body)
+	if err != nil {
+		return "", err
+	}
+	resp, err := s.Client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	var reader io.Reader = resp.Body
+	if s.MaxResponseSize > 0 {
+		reader = io.LimitReader(resp.Body, s.MaxResponseSize+1)
+	}
+	output, err := io.ReadAll(reader)
+	if err != nil {
+		return "", err
+	}
+	if s.MaxResponseSize > 0 && int64(len(output)) > s.MaxResponseSize {
+		return "", s.responseTooLarge()
+	}
+	if isLoginChallenge(resp, string(output)) {
+		return "", errLoginExpired
+	}
+	if gsqlErr := parseGSQLError(string(output)); gsqlErr != nil {
+		return "", gsqlErr
+	}
+	return string(output), nil
+}
+
+// responseTooLarge is the error for output beyond MaxResponseSize.
+func (s *GSQLSession) responseTooLarge() error {
+	return fmt.Errorf("output exceeded %s, stopped reading; raise --max-response-size (0 for no limit) if this is expected", helpers.FormatByteSize(s.MaxResponseSize))
+}
+
+// executeCommand runs command, streaming its output, and tracks the graph
+// it switches to.
+func (s *GSQLSession) executeCommand(command string) error {
+	if err := s.retryResumed(strings.NewReader(command), s.execute); err != nil {
+		return err
+	}
+	s.trackGraph(command)
+	return nil
+}
+
+// execute runs the GSQL read from body and streams its output.
+func (s *GSQLSession) execute(body io.Reader) error {
+	req, err := s.commandRequest(body)
+	if err != nil {
+		return err
+	}
 
 	resp, err := s.Client.Do(req)
 	if err != nil {
@@ -217,25 +790,38 @@ func (s *GSQLSession) executeCommand(command string) error {
 	}
 	defer resp.Body.Close()
 
+	if isLoginChallenge(resp, "") {
+		return errLoginExpired
+	}
+
 	// Read response in chunks to handle streaming output
 	buffer := make([]byte, 1024)
-	progressRegex := regexp.MustCompile(`\[.*?\]\s*([0-9]\d*|0)+%.*\(([1-9]\d*|0)\/([1-9]\d*|0)\)`)
+	printer := newCommandPrinter()
+	defer printer.finish()
+
+	// Errors are looked for as the output streams in; the scanner holds
+	// back a line a chunk splits.
+	var failure gsqlErrorScanner
+	var received int64
 
 	for {
 		n, err := resp.Body.Read(buffer)
 		if n > 0 {
+			// The first chunk shows whether the server answered with
+			// a login challenge; it is not printed then.
+			if received == 0 && isLoginChallenge(resp, string(buffer[:n])) {
+				return errLoginExpired
+			}
+			received += int64(n)
+			if s.MaxResponseSize > 0 && received > s.MaxResponseSize {
+				return s.responseTooLarge()
+			}
 			data := string(buffer[:n])
+			failure.write(data)
 
 			if !strings.Contains(data, constants.GSQL_SEPARATOR) {
-				// Check for progress bar
-				if progressRegex.MatchString(data) {
-					fmt.Print(data) // Print progress inline
-				} else {
-					fmt.Print(strings.TrimSpace(data))
-					if !strings.HasSuffix(data, "\n") {
-						fmt.Println()
-					}
-				}
+				printer.print(data)
+				s.capture.output(data)
 			} else if strings.Contains(data, constants.GSQL_COOKIES) {
 				// Update cookies
 				parts := strings.Split(data, "__,")
@@ -257,29 +843,41 @@ func (s *GSQLSession) executeCommand(command string) error {
 		}
 	}
 
+	if gsqlErr := failure.result(); gsqlErr != nil {
+		return gsqlErr
+	}
 	return nil
 }
 
 func RunBackup(cmd *cobra.Command, args []string) {
-	alias, _ := cmd.Flags().GetString("alias")
+	alias := serverAlias(cmd)
 	user, _ := cmd.Flags().GetString("user")
 	password, _ := cmd.Flags().GetString("password")
 	host, _ := cmd.Flags().GetString("host")
 	gsPort, _ := cmd.Flags().GetString("gsPort")
 	// restPort, _ := cmd.Flags().GetString("restPort")
 	backupType, _ := cmd.Flags().GetString("type")
+	withEvents, _ := cmd.Flags().GetBool("events")
+	local, _ := cmd.Flags().GetBool("local")
+	tag, _ := cmd.Flags().GetString("tag")
+
+	emitter := events.Start(withEvents)
+	defer emitter.Finish()
 
 	// Get configuration if alias is provided
 	if alias != "" {
 		machineConfig := getMachineConfig(alias)
 		if machineConfig != nil {
+			warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
 			host = machineConfig.Host
 			user = machineConfig.User
 			password = machineConfig.Password
 			gsPort = machineConfig.GSPort
 			// restPort = machineConfig.RestPort
 		} else {
-			fmt.Printf("Alias %s not found. Try: tg conf list\n", alias)
+			fmt.Fprintf(emitter.Out(), "Alias %s not found. Try: tg conf list\n", alias)
+			emitter.Fail(fmt.Errorf("alias %s not found", alias))
+			helpers.Fail(helpers.ExitFailure)
 			return
 		}
 	}
@@ -292,7 +890,16 @@ func RunBackup(cmd *cobra.Command, args []string) {
 		optionBKP = "-S"
 	}
 
-	fmt.Printf("Starting backup with type: %s\n", optionBKP)
+	if local {
+		probe := logRootProbe(cmd, alias, host, gsPort, user, password)
+		if code := runLocalBackup(tag, optionBKP, probe, emitter); code != 0 {
+			emitter.Finish()
+			helpers.Exit(code)
+		}
+		return
+	}
+
+	fmt.Fprintf(emitter.Out(), "Starting backup with type: %s\n", optionBKP)
 
 	// Authenticate and get session
 	fullHost := fmt.Sprintf("%s:%s", host, gsPort)
@@ -303,18 +910,24 @@ func RunBackup(cmd *cobra.Command, args []string) {
 
 	jsonData, _ := json.Marshal(loginData)
 
-	client := &http.Client{Timeout: 60 * time.Second}
+	client := newServerClient(cmd, alias, 60*time.Second)
 	resp, err := client.Post(fullHost+"/api/auth/login", "application/json", bytes.NewBuffer(jsonData))
 	if err != nil {
-		fmt.Printf("Error logging in: %v\n", err)
+		err = unwrapSchemeMismatch(err)
+		fmt.Fprintf(emitter.Out(), "Error logging in: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != 200 {
-		fmt.Printf("Authentication failed with status: %d\n", resp.StatusCode)
+		fmt.Fprintf(emitter.Out(), "Authentication failed with status: %d\n", resp.StatusCode)
+		emitter.Fail(fmt.Errorf("authentication failed with status: %d", resp.StatusCode))
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
+	emitter.Emit("auth.succeeded", map[string]interface{}{"host": fullHost})
 
 	// Get session cookie
 	cookie := resp.Header.Get("Set-Cookie")
@@ -323,72 +936,81 @@ func RunBackup(cmd *cobra.Command, args []string) {
 	}
 
 	// Get TigerGraph path
-	req, _ := http.NewRequest("GET", fullHost+"/api/log", nil)
-	req.Header.Set("Cookie", cookie)
-	req.Header.Set("Content-Type", "application/json")
-
-	resp, err = client.Do(req)
+	pathTG, err := fetchLogRoot(client, fullHost, cookie)
 	if err != nil {
-		fmt.Printf("Error getting log path: %v\n", err)
+		fmt.Fprintf(emitter.Out(), "Error getting log path: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
-	defer resp.Body.Close()
-
-	pathTG := "/home/tigergraph"
-	if resp.StatusCode == 200 {
-		var logResp struct {
-			Error   bool `json:"error"`
-			Results []struct {
-				Path string `json:"path"`
-			} `json:"results"`
-		}
-
-		body, _ := io.ReadAll(resp.Body)
-		if err := json.Unmarshal(body, &logResp); err == nil && !logResp.Error && len(logResp.Results) > 0 {
-			parts := strings.Split(logResp.Results[0].Path, "/log/")
-			if len(parts) > 0 {
-				pathTG = parts[0]
-			}
-		}
+	if pathTG == "" {
+		pathTG = "/home/tigergraph"
 	}
 
-	fmt.Printf("Using TigerGraph path: %s\n", pathTG)
-	fmt.Println("Backup functionality requires integration with pyTigerGraph equivalent")
-	fmt.Println("This is a placeholder for the full backup implementation")
+	fmt.Fprintf(emitter.Out(), "Using TigerGraph path: %s\n", pathTG)
+	emitter.Emit("backup.path", map[string]interface{}{"path": pathTG})
+	fmt.Fprintln(emitter.Out(), "Backup functionality requires integration with pyTigerGraph equivalent")
+	fmt.Fprintln(emitter.Out(), "This is a placeholder for the full backup implementation")
 }
 
 func RunServices(cmd *cobra.Command, args []string) {
+	alias := serverAlias(cmd)
 	user, _ := cmd.Flags().GetString("user")
 	password, _ := cmd.Flags().GetString("password")
 	host, _ := cmd.Flags().GetString("host")
 	gsPort, _ := cmd.Flags().GetString("gsPort")
 	ops, _ := cmd.Flags().GetString("ops")
+	withEvents, _ := cmd.Flags().GetBool("events")
+	local, _ := cmd.Flags().GetBool("local")
 
-	fullHost := fmt.Sprintf("%s:%s", host, gsPort)
+	emitter := events.Start(withEvents)
+	defer emitter.Finish()
 
-	loginData := map[string]string{
-		"username": user,
-		"password": password,
+	if alias != "" {
+		machineConfig := getMachineConfig(alias)
+		if machineConfig == nil {
+			fmt.Fprintf(emitter.Out(), "Alias %s not found. Try: tg conf list\n", alias)
+			emitter.Fail(fmt.Errorf("alias %s not found", alias))
+			helpers.Fail(helpers.ExitFailure)
+			return
+		}
+		warnAliasOverrides(cmd, alias, "host", "user", "password", "gsPort")
+		host = machineConfig.Host
+		user = machineConfig.User
+		password = machineConfig.Password
+		gsPort = machineConfig.GSPort
 	}
 
-	jsonData, _ := json.Marshal(loginData)
-
-	client := &http.Client{Timeout: 30 * time.Second}
-	resp, err := client.Post(fullHost+"/api/auth/login", "application/json", bytes.NewBuffer(jsonData))
-	if err != nil {
-		fmt.Printf("Error logging in: %v\n", err)
+	if local {
+		probe := logRootProbe(cmd, alias, host, gsPort, user, password)
+		if code := runLocalServices(ops, probe, emitter); code != 0 {
+			emitter.Finish()
+			helpers.Exit(code)
+		}
 		return
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		fmt.Printf("Authentication failed with status: %d\n", resp.StatusCode)
+	fullHost := fmt.Sprintf("%s:%s", host, gsPort)
+
+	client := newServerClient(cmd, alias, 30*time.Second)
+	cookie, err := adminLogin(client, fullHost, user, password)
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error logging in: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
-
-	cookie := resp.Header.Get("Set-Cookie")
-	if cookie != "" {
-		cookie = strings.Split(cookie, ";")[0]
+	emitter.Emit("auth.succeeded", map[string]interface{}{"host": fullHost})
+
+	if strings.HasPrefix(ops, "ensure-") {
+		waitTimeout, _ := cmd.Flags().GetDuration("wait-timeout")
+		output := helpers.OutputFormat(cmd)
+		if err := runEnsureServices(client, fullHost, cookie, ops, waitTimeout, output, emitter); err != nil {
+			emitter.Fail(err)
+			emitter.Finish()
+			helpers.Exit(1)
+		}
+		return
 	}
 
 	// Perform service operation
@@ -397,9 +1019,12 @@ func RunServices(cmd *cobra.Command, args []string) {
 	req.Header.Set("Cookie", cookie)
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err = client.Do(req)
+	emitter.Emit("services.requested", map[string]interface{}{"ops": ops, "services": managedServices})
+	resp, err := client.Do(req)
 	if err != nil {
-		fmt.Printf("Error performing service operation: %v\n", err)
+		fmt.Fprintf(emitter.Out(), "Error performing service operation: %v\n", err)
+		emitter.Fail(err)
+		helpers.Fail(helpers.ExitFailure)
 		return
 	}
 	defer resp.Body.Close()
@@ -411,36 +1036,59 @@ func RunServices(cmd *cobra.Command, args []string) {
 		}
 
 		if err := json.Unmarshal(body, &serviceResp); err == nil {
-			fmt.Println(serviceResp.Message)
+			fmt.Fprintln(emitter.Out(), serviceResp.Message)
 		}
 	} else {
-		fmt.Printf("Service operation failed with status: %d\n", resp.StatusCode)
+		fmt.Fprintf(emitter.Out(), "Service operation failed with status: %d\n", resp.StatusCode)
+		emitter.Fail(fmt.Errorf("service operation failed with status: %d", resp.StatusCode))
+		helpers.Fail(helpers.ExitFailure)
+	}
+}
+
+// adminLogin authenticates against the admin API on the GSQL port and
+// returns the session cookie to send with subsequent requests.
+func adminLogin(client *http.Client, fullHost, user, password string) (string, error) {
+	loginData := map[string]string{
+		"username": user,
+		"password": password,
+	}
+
+	jsonData, _ := json.Marshal(loginData)
+
+	resp, err := client.Post(fullHost+"/api/auth/login", "application/json", bytes.NewBuffer(jsonData))
+	if err != nil {
+		return "", unwrapSchemeMismatch(err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return "", fmt.Errorf("authentication failed with status: %d", resp.StatusCode)
+	}
+
+	cookie := resp.Header.Get("Set-Cookie")
+	if cookie != "" {
+		cookie = strings.Split(cookie, ";")[0]
 	}
+	return cookie, nil
 }
 
+// getMachineConfig returns the configured alias, falling back to one
+// defined in the environment (see envMachineConfig), or nil. The alias is
+// decoded through the struct's mapstructure tags, which match the keys
+// viper lowercases and accept ports written as numbers.
 func getMachineConfig(alias string) *models.MachineConfig {
-	machines := viper.GetStringMap("machines")
-	if machineData, exists := machines[alias]; exists {
-		// Convert map[string]interface{} to MachineConfig
-		if machineMap, ok := machineData.(map[string]interface{}); ok {
-			config := &models.MachineConfig{}
-			if host, ok := machineMap["host"].(string); ok {
-				config.Host = host
-			}
-			if user, ok := machineMap["user"].(string); ok {
-				config.User = user
-			}
-			if password, ok := machineMap["password"].(string); ok {
-				config.Password = password
-			}
-			if gsPort, ok := machineMap["gsPort"].(string); ok {
-				config.GSPort = gsPort
-			}
-			if restPort, ok := machineMap["restPort"].(string); ok {
-				config.RestPort = restPort
-			}
+	key := helpers.AliasKey(alias)
+	if _, exists := viper.GetStringMap("machines")[key]; exists {
+		config := &models.MachineConfig{}
+		if err := viper.UnmarshalKey("machines."+key, config); err == nil {
 			return config
 		}
 	}
-	return nil
+
+	// Aliases missing from the config may come from the environment.
+	config, err := envMachineConfig(alias)
+	if err != nil {
+		helpers.Warn(helpers.WarnEnvAlias, "%v", err)
+	}
+	return config
 }
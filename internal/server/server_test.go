@@ -4,16 +4,22 @@ import (
 	"bytes"
 	"encoding/base64"
 	"encoding/json"
+	"errors"
 	"io"
+	"net"
 	"net/http"
 	"net/http/httptest"
 	"os"
+	"path/filepath"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
 
 	"github.com/spf13/cobra"
 	"github.com/spf13/viper"
+	"github.com/zrougamed/tgCli/internal/config"
+	"github.com/zrougamed/tgCli/internal/helpers"
 	"github.com/zrougamed/tgCli/internal/models"
 )
 
@@ -32,6 +38,36 @@ func setupServerTestEnvironment(t *testing.T) func() {
 	return cleanup
 }
 
+// captureOutput returns what fn writes to stdout.
+func captureOutput(fn func()) string {
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	fn()
+
+	w.Close()
+	os.Stdout = oldStdout
+	var output bytes.Buffer
+	output.ReadFrom(r)
+	return output.String()
+}
+
+// captureStderr returns what fn writes to stderr.
+func captureStderr(fn func()) string {
+	oldStderr := os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stderr = w
+
+	fn()
+
+	w.Close()
+	os.Stderr = oldStderr
+	var output bytes.Buffer
+	output.ReadFrom(r)
+	return output.String()
+}
+
 func TestVersionCommits(t *testing.T) {
 	// Test that version commits map is properly populated
 	if len(versionCommits) == 0 {
@@ -224,21 +260,48 @@ func TestGSQLSessionExecuteCommand(t *testing.T) {
 	}
 }
 
+func TestInteractiveSessionEndOfInput(t *testing.T) {
+	var received []string
+	session := mockCommandServer(t, &received)
+	run := func(input io.Reader) string {
+		t.Helper()
+		done := make(chan string)
+		go func() { done <- captureOutput(func() { session.startInteractiveSession(input) }) }()
+		select {
+		case output := <-done:
+			return output
+		case <-time.After(5 * time.Second):
+			t.Fatal("The session did not end with its input")
+			return ""
+		}
+	}
+
+	// The last line has no newline, as when a script is piped in.
+	output := run(bytes.NewReader([]byte("USE GRAPH social\nSHOW VERTEX *")))
+	if len(received) != 2 || received[0] != "USE GRAPH social" || received[1] != "SHOW VERTEX *" {
+		t.Errorf("Expected both commands to run, got %q", received)
+	}
+	if strings.Count(output, "GSQL > ") != 2 || strings.Contains(output, "Error") {
+		t.Errorf("Expected two prompts and no error:\n%s", output)
+	}
+
+	// A read error ends the session rather than repeating.
+	received = nil
+	output = run(io.MultiReader(strings.NewReader("ls\n"), iotest.ErrReader(errors.New("input/output error"))))
+	if len(received) != 1 || strings.Count(output, "Error reading input: input/output error") != 1 {
+		t.Errorf("Expected one command and one read error, got %q:\n%s", received, output)
+	}
+}
+
 func TestGetMachineConfig(t *testing.T) {
 	cleanup := setupServerTestEnvironment(t)
 	defer cleanup()
 
-	// Debug: Let's see what the actual getMachineConfig function expects
-	// First, let's test with a nil case to make sure the function works
 	config := getMachineConfig("nonexistent")
 	if config != nil {
 		t.Error("getMachineConfig should return nil for non-existent config")
 	}
 
-	// Now test with actual data - let's try to match how the real config system works
-	// The actual config.go probably saves data in a specific format
-
-	// Try the same format as the working config tests
 	viper.Set("machines.testserver", map[string]interface{}{
 		"host":     "http://testhost",
 		"user":     "testuser",
@@ -252,7 +315,6 @@ func TestGetMachineConfig(t *testing.T) {
 		t.Fatal("getMachineConfig returned nil for valid config")
 	}
 
-	// Test the fields that we know work
 	if config.Host != "http://testhost" {
 		t.Errorf("Expected host 'http://testhost', got '%s'", config.Host)
 	}
@@ -263,22 +325,59 @@ func TestGetMachineConfig(t *testing.T) {
 		t.Errorf("Expected password 'testpass', got '%s'", config.Password)
 	}
 
-	if config.GSPort == "" {
-		t.Logf("Note: GSPort is empty - this may be a type conversion issue in getMachineConfig")
+	if config.GSPort != "14240" {
+		t.Errorf("Expected GSPort '14240', got '%s'", config.GSPort)
+	}
+	if config.RestPort != "9000" {
+		t.Errorf("Expected RestPort '9000', got '%s'", config.RestPort)
+	}
+}
 
-	} else {
-		if config.GSPort != "14240" {
-			t.Errorf("Expected GSPort '14240', got '%s'", config.GSPort)
-		}
+func TestGetMachineConfigRoundTrip(t *testing.T) {
+	cleanup := setupServerTestEnvironment(t)
+	defer cleanup()
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	viper.SetConfigFile(configFile)
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("alias", "Prod", "")
+	cmd.Flags().String("user", "admin", "")
+	cmd.Flags().String("password", "secret", "")
+	cmd.Flags().String("host", "http://10.0.0.5", "")
+	cmd.Flags().String("gsPort", "14241", "")
+	cmd.Flags().String("restPort", "9001", "")
+	cmd.Flags().String("default", "n", "")
+	captureOutput(func() { config.RunConfAdd(cmd, nil) })
+
+	expected := models.MachineConfig{Host: "http://10.0.0.5", User: "admin", Password: "secret", GSPort: "14241", RestPort: "9001"}
+	if machine := getMachineConfig("prod"); machine == nil || *machine != expected {
+		t.Errorf("Before reloading: expected %+v, got %+v", expected, machine)
 	}
 
-	if config.RestPort == "" {
-		t.Logf("Note: RestPort is empty - this may be a type conversion issue in getMachineConfig")
+	viper.Reset()
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+	helpers.LoadPasswords()
+	if machine := getMachineConfig("prod"); machine == nil || *machine != expected {
+		t.Errorf("After reloading: expected %+v, got %+v", expected, machine)
+	}
+}
 
-	} else {
-		if config.RestPort != "9000" {
-			t.Errorf("Expected RestPort '9000', got '%s'", config.RestPort)
-		}
+func TestGetMachineConfigNumericPorts(t *testing.T) {
+	cleanup := setupServerTestEnvironment(t)
+	defer cleanup()
+	configFile := filepath.Join(t.TempDir(), "config.yml")
+	os.WriteFile(configFile, []byte("machines:\n  prod:\n    host: http://10.0.0.5\n    gsPort: 14240\n    restPort: 9000\n"), 0600)
+	viper.SetConfigFile(configFile)
+	if err := viper.ReadInConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	machine := getMachineConfig("prod")
+	if machine == nil || machine.GSPort != "14240" || machine.RestPort != "9000" {
+		t.Errorf("Expected unquoted ports to be read as strings, got %+v", machine)
 	}
 }
 
@@ -863,3 +962,361 @@ func TestEdgeCases(t *testing.T) {
 		t.Error("Should return nil for malformed configuration")
 	}
 }
+
+func TestGSQLSessionLoginProbeBudget(t *testing.T) {
+	originalBackoff := probeBackoff
+	probeBackoff = 0
+	defer func() { probeBackoff = originalBackoff }()
+
+	release := make(chan struct{})
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer mockServer.Close()
+	defer close(release)
+
+	session := &GSQLSession{
+		Host:         mockServer.URL,
+		User:         "testuser",
+		Password:     "testpass",
+		Client:       &http.Client{Timeout: 60 * time.Second},
+		ProbeTimeout: 20 * time.Millisecond,
+		ProbeBudget:  100 * time.Millisecond,
+	}
+
+	start := time.Now()
+	err := session.login()
+	elapsed := time.Since(start)
+
+	if err == nil {
+		t.Fatal("Expected login to fail against an unresponsive server")
+	}
+	if !strings.Contains(err.Error(), "login probe budget") {
+		t.Errorf("Expected probe budget error, got: %v", err)
+	}
+	if elapsed > 2*time.Second {
+		t.Errorf("Login should fail fast, took %s", elapsed)
+	}
+	if session.Client.Timeout != 60*time.Second {
+		t.Error("The regular client timeout should be restored after probing")
+	}
+}
+
+func TestGSQLSessionLoginRetriesTransportErrors(t *testing.T) {
+	originalBackoff := probeBackoff
+	probeBackoff = 0
+	defer func() { probeBackoff = originalBackoff }()
+
+	attempts := 0
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		attempts++
+		if attempts == 1 {
+			// Drop the first connection without a response.
+			hijacker, _ := w.(http.Hijacker)
+			conn, _, _ := hijacker.Hijack()
+			conn.Close()
+			return
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"isClientCompatible": true,
+			"welcomeMessage":     "Welcome to GSQL",
+		})
+	}))
+	defer mockServer.Close()
+
+	session := &GSQLSession{
+		Host:     mockServer.URL,
+		User:     "testuser",
+		Password: "testpass",
+		Client:   &http.Client{Timeout: 30 * time.Second},
+	}
+
+	if err := session.login(); err != nil {
+		t.Fatalf("login should recover from a dropped connection: %v", err)
+	}
+	if attempts != 2 {
+		t.Errorf("Expected 2 attempts, got %d", attempts)
+	}
+}
+
+func TestGSQLSessionLoginFailsFastWhenRefused(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := "http://" + listener.Addr().String()
+	listener.Close()
+
+	session := &GSQLSession{
+		Host:        host,
+		User:        "testuser",
+		Password:    "testpass",
+		Client:      &http.Client{Timeout: 30 * time.Second},
+		ProbeBudget: 30 * time.Second,
+	}
+	start := time.Now()
+	err = session.login()
+	if !isDialError(err) {
+		t.Errorf("Expected the refused connection to be reported, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("A refused connection should not be retried until the budget runs out, took %s", elapsed)
+	}
+}
+
+func TestSleepBackoff(t *testing.T) {
+	originalBackoff, originalMax := probeBackoff, maxProbeBackoff
+	probeBackoff, maxProbeBackoff = 2*time.Millisecond, 8*time.Millisecond
+	defer func() { probeBackoff, maxProbeBackoff = originalBackoff, originalMax }()
+
+	// Each retry doubles the pause, up to the cap.
+	deadline := time.Now().Add(time.Minute)
+	for retries, least := range map[int]time.Duration{0: time.Millisecond, 1: 2 * time.Millisecond, 2: 4 * time.Millisecond, 20: 4 * time.Millisecond} {
+		start := time.Now()
+		sleepBackoff(retries, deadline)
+		if elapsed := time.Since(start); elapsed < least || elapsed > 2*least+50*time.Millisecond {
+			t.Errorf("Retry %d: expected a pause between %s and %s, got %s", retries, least, 2*least, elapsed)
+		}
+	}
+
+	start := time.Now()
+	sleepBackoff(0, time.Now())
+	if elapsed := time.Since(start); elapsed > 5*time.Millisecond {
+		t.Errorf("Expected no pause past the deadline, got %s", elapsed)
+	}
+}
+
+func TestProbeVersions(t *testing.T) {
+	testCases := []struct {
+		versionRange string
+		expected     []string
+		wantErr      bool
+	}{
+		{"3.5.0-3.6.2", []string{"3.6.2", "3.6.1", "3.6.0", "3.5.3", "3.5.0"}, false},
+		{"3.6.1", []string{"3.6.1"}, false},
+		{"3.6.0-", []string{"3.6.2", "3.6.1", "3.6.0"}, false},
+		{"-3.0.5", []string{"3.0.5", "3.0.0"}, false},
+		{"3.6.2-3.5.0", nil, true},
+		{"4.0.0-4.1.0", nil, true},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.versionRange, func(t *testing.T) {
+			versions, err := probeVersions(tc.versionRange)
+			if tc.wantErr {
+				if err == nil {
+					t.Errorf("Expected error for %q", tc.versionRange)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("Unexpected error: %v", err)
+			}
+			if strings.Join(versions, ",") != strings.Join(tc.expected, ",") {
+				t.Errorf("Expected %v, got %v", tc.expected, versions)
+			}
+		})
+	}
+
+	all, _ := probeVersions("")
+	if len(all) != len(versionCommits) || all[0] != "3.6.2" || all[len(all)-1] != "3.0.0" {
+		t.Errorf("Empty range should list every version newest first, got %v", all)
+	}
+}
+
+func TestGSQLSessionLoginRestrictedVersions(t *testing.T) {
+	var commits []string
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookie models.GSQLCookie
+		json.Unmarshal([]byte(r.Header.Get("Cookie")), &cookie)
+		commits = append(commits, cookie.ClientCommit)
+		json.NewEncoder(w).Encode(map[string]interface{}{"isClientCompatible": false})
+	}))
+	defer mockServer.Close()
+
+	session := &GSQLSession{
+		Host:     mockServer.URL,
+		User:     "testuser",
+		Password: "testpass",
+		Client:   &http.Client{Timeout: 30 * time.Second},
+		Versions: []string{"3.6.2", "3.5.3"},
+	}
+
+	if err := session.login(); err == nil {
+		t.Fatal("Expected login to fail")
+	}
+	expected := []string{versionCommits["3.6.2"], versionCommits["3.5.3"]}
+	if strings.Join(commits, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected only the selected versions to be probed in order, got %v", commits)
+	}
+}
+
+// mockPasswordServer accepts logins for 3.6.2 with password "right" and
+// rejects the credentials otherwise, counting the login requests.
+func mockPasswordServer(t *testing.T, logins *int) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		*logins++
+		var cookie models.GSQLCookie
+		json.Unmarshal([]byte(r.Header.Get("Cookie")), &cookie)
+		if cookie.ClientCommit != versionCommits["3.6.2"] {
+			json.NewEncoder(w).Encode(map[string]interface{}{"isClientCompatible": false})
+			return
+		}
+		expected := base64.StdEncoding.EncodeToString([]byte("tigergraph:right"))
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"isClientCompatible": true,
+			"error":              r.Header.Get("Authorization") != "Basic "+expected,
+			"message":            "Wrong password!",
+		})
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func usePasswordPrompt(t *testing.T, interactive bool, answers ...string) *int {
+	t.Helper()
+	originalInteractive, originalRead := isInteractive, readPassword
+	t.Cleanup(func() { isInteractive, readPassword = originalInteractive, originalRead })
+
+	prompts := 0
+	isInteractive = func() bool { return interactive }
+	readPassword = func() (string, error) {
+		if prompts >= len(answers) {
+			return "", io.EOF
+		}
+		prompts++
+		return answers[prompts-1], nil
+	}
+	return &prompts
+}
+
+func TestGSQLLoginStopsOnAuthenticationFailure(t *testing.T) {
+	logins := 0
+	mockServer := mockPasswordServer(t, &logins)
+
+	session := &GSQLSession{Host: mockServer.URL, User: "tigergraph", Password: "wrong", Client: mockServer.Client()}
+	err := session.login()
+	if !errors.Is(err, errAuthentication) || !strings.Contains(err.Error(), "Wrong password!") {
+		t.Errorf("Expected an authentication error, got %v", err)
+	}
+	if logins != 1 {
+		t.Errorf("Rejected credentials should not be retried with other versions, got %d logins", logins)
+	}
+}
+
+func TestLoginWithPrompt(t *testing.T) {
+	tests := []struct {
+		name        string
+		interactive bool
+		answers     []string
+		prompts     int
+		succeeds    bool
+	}{
+		{"not a terminal", false, []string{"right"}, 0, false},
+		{"corrected on second prompt", true, []string{"typo", "right"}, 2, true},
+		{"gives up after three prompts", true, []string{"a", "b", "c", "right"}, 3, false},
+		{"stdin closed", true, nil, 0, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			logins := 0
+			mockServer := mockPasswordServer(t, &logins)
+			prompts := usePasswordPrompt(t, tt.interactive, tt.answers...)
+
+			session := &GSQLSession{Host: mockServer.URL, User: "tigergraph", Password: "wrong", Client: mockServer.Client()}
+			var stdout string
+			captured := captureStderr(func() {
+				stdout = captureOutput(func() {
+					if err := session.loginWithPrompt(); (err == nil) != tt.succeeds {
+						t.Errorf("loginWithPrompt error = %v, expected success %v", err, tt.succeeds)
+					}
+				})
+			})
+			if *prompts != tt.prompts {
+				t.Errorf("Expected %d prompts, got %d", tt.prompts, *prompts)
+			}
+			if tt.succeeds && (session.Password != "right" || session.Version != "3.6.2") {
+				t.Errorf("Expected the corrected password to be kept, got %q (%s)", session.Password, session.Version)
+			}
+			if tt.prompts > 0 && !strings.Contains(captured, "Password for tigergraph (attempt 1 of 3)") {
+				t.Errorf("Expected a password prompt on stderr, got %q", captured)
+			}
+			if strings.Contains(stdout, "Password for") {
+				t.Errorf("Expected no password prompt on stdout, got %q", stdout)
+			}
+		})
+	}
+}
+
+func TestLoginWithPromptIgnoresOtherFailures(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{"isClientCompatible": false})
+	}))
+	defer mockServer.Close()
+	prompts := usePasswordPrompt(t, true, "right")
+
+	session := &GSQLSession{Host: mockServer.URL, Client: mockServer.Client(), Versions: []string{"3.6.2"}}
+	captureOutput(func() { session.loginWithPrompt() })
+	if *prompts != 0 {
+		t.Error("Only rejected credentials should prompt for the password")
+	}
+}
+
+func TestProbeVersionsIsStable(t *testing.T) {
+	first, err := probeVersions("")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if again, _ := probeVersions(""); strings.Join(again, ",") != strings.Join(first, ",") {
+			t.Fatalf("Probe order differs between runs: %v, %v", first, again)
+		}
+	}
+	for i := 1; i < len(first); i++ {
+		if helpers.CompareVersions(first[i-1], first[i]) <= 0 {
+			t.Errorf("Expected versions newest first, got %v", first)
+		}
+	}
+}
+
+func TestMaxResponseSize(t *testing.T) {
+	mockServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// An endless result, as from a runaway query.
+		line := []byte(strings.Repeat("x", 99) + "\n")
+		for i := 0; i < 100000; i++ {
+			if _, err := w.Write(line); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+		}
+	}))
+	defer mockServer.Close()
+	session := &GSQLSession{Host: mockServer.URL, Client: &http.Client{Timeout: 5 * time.Second}, MaxResponseSize: 10 << 10}
+
+	var err error
+	output := captureOutput(func() { err = session.executeCommand("RUN QUERY everything()") })
+	if err == nil || !strings.Contains(err.Error(), "output exceeded 10KB") || !strings.Contains(err.Error(), "--max-response-size") {
+		t.Errorf("Expected the size limit to stop the command, got %v", err)
+	}
+	if len(output) > 11<<10 {
+		t.Errorf("Expected printing to stop near the limit, printed %d bytes", len(output))
+	}
+
+	if _, err := session.queryCommand("RUN QUERY everything()"); err == nil || !strings.Contains(err.Error(), "output exceeded 10KB") {
+		t.Errorf("Expected queryCommand to stop at the limit, got %v", err)
+	}
+
+	// Within the limit, or without one, the output is read as before.
+	small := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	defer small.Close()
+	for _, limit := range []int64{10 << 10, 0} {
+		session := &GSQLSession{Host: small.URL, Client: small.Client(), MaxResponseSize: limit}
+		if output, err := session.queryCommand("ls"); err != nil || !strings.HasPrefix(output, "ok\n") {
+			t.Errorf("Limit %d: unexpected %q, %v", limit, output, err)
+		}
+	}
+}
@@ -0,0 +1,214 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/events"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/telemetry"
+)
+
+// managedServices are the services driven by `tg server services`.
+var managedServices = []string{"gpe", "gse", "restpp"}
+
+// servicePollInterval is how often ensure-* operations re-check status.
+var servicePollInterval = 2 * time.Second
+
+// ServiceResult reports what an ensure-* operation did for one service.
+type ServiceResult struct {
+	Name   string `json:"name"`
+	Status string `json:"status"`
+	Action string `json:"action"`
+}
+
+func isServiceRunning(status string) bool {
+	switch strings.ToLower(status) {
+	case "online", "running", "ready":
+		return true
+	}
+	return false
+}
+
+func serviceQuery(services []string) string {
+	params := make([]string, 0, len(services))
+	for _, name := range services {
+		params = append(params, "serviceName="+name)
+	}
+	return strings.Join(params, "&")
+}
+
+// fetchServiceStatus returns the current status of each requested service.
+func fetchServiceStatus(client *http.Client, fullHost, cookie string, services []string) (map[string]string, error) {
+	statusURL := fmt.Sprintf("%s/api/service/status?%s", fullHost, serviceQuery(services))
+	req, _ := http.NewRequest("GET", statusURL, nil)
+	req.Header.Set("Cookie", cookie)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error querying service status: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return nil, fmt.Errorf("service status query failed with status: %d", resp.StatusCode)
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("error reading service status: %v", err)
+	}
+
+	var statusResp struct {
+		Error   bool   `json:"error"`
+		Message string `json:"message"`
+		Results []struct {
+			ServiceName   string `json:"serviceName"`
+			ServiceStatus string `json:"serviceStatus"`
+		} `json:"results"`
+	}
+	if err := json.Unmarshal(body, &statusResp); err != nil {
+		return nil, fmt.Errorf("error parsing service status: %v", err)
+	}
+	if statusResp.Error {
+		return nil, fmt.Errorf("service status query failed: %s", statusResp.Message)
+	}
+
+	statuses := make(map[string]string, len(statusResp.Results))
+	for _, result := range statusResp.Results {
+		statuses[strings.ToLower(result.ServiceName)] = result.ServiceStatus
+	}
+	return statuses, nil
+}
+
+func postServiceOperation(client *http.Client, fullHost, cookie, ops string, services []string) error {
+	serviceURL := fmt.Sprintf("%s/api/service/%s?%s", fullHost, ops, serviceQuery(services))
+	req, _ := http.NewRequest("POST", serviceURL, nil)
+	req.Header.Set("Cookie", cookie)
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return fmt.Errorf("error performing service operation: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("service operation failed with status: %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// ensureServices brings the managed services into the desired state,
+// touching only those that are not already there, and waits until every
+// service reports the desired state or the timeout elapses.
+func ensureServices(client *http.Client, fullHost, cookie, ops string, timeout time.Duration, emitter *events.Emitter) ([]ServiceResult, error) {
+	var wantRunning bool
+	var action, doneLabel, alreadyLabel string
+	switch ops {
+	case "ensure-started":
+		wantRunning, action, doneLabel, alreadyLabel = true, "start", "started now", "already running"
+	case "ensure-stopped":
+		wantRunning, action, doneLabel, alreadyLabel = false, "stop", "stopped now", "already stopped"
+	default:
+		return nil, fmt.Errorf("unknown operation %q (expected ensure-started/ensure-stopped)", ops)
+	}
+
+	statuses, err := fetchServiceStatus(client, fullHost, cookie, managedServices)
+	if err != nil {
+		return nil, err
+	}
+
+	results := make([]ServiceResult, 0, len(managedServices))
+	var pending []string
+	for _, name := range managedServices {
+		result := ServiceResult{Name: name, Status: statuses[name], Action: alreadyLabel}
+		if isServiceRunning(statuses[name]) != wantRunning {
+			result.Action = doneLabel
+			pending = append(pending, name)
+		}
+		results = append(results, result)
+	}
+
+	if len(pending) == 0 {
+		emitServicesDone(emitter, results)
+		return results, nil
+	}
+
+	emitter.Emit("services.requested", map[string]interface{}{"ops": action, "services": pending})
+	if err := postServiceOperation(client, fullHost, cookie, action, pending); err != nil {
+		return results, err
+	}
+
+	deadline := time.Now().Add(timeout)
+	for {
+		statuses, err = fetchServiceStatus(client, fullHost, cookie, managedServices)
+		if err != nil {
+			return results, err
+		}
+
+		var waiting []string
+		for i := range results {
+			if statuses[results[i].Name] != results[i].Status {
+				emitter.Emit("service.state", map[string]interface{}{"name": results[i].Name, "status": statuses[results[i].Name]})
+			}
+			results[i].Status = statuses[results[i].Name]
+			if isServiceRunning(results[i].Status) != wantRunning {
+				waiting = append(waiting, results[i].Name)
+			}
+		}
+
+		if len(waiting) == 0 {
+			emitServicesDone(emitter, results)
+			return results, nil
+		}
+		if time.Now().After(deadline) {
+			return results, fmt.Errorf("timed out after %s waiting for %s to %s", timeout, strings.Join(waiting, ", "), action)
+		}
+		time.Sleep(servicePollInterval)
+	}
+}
+
+func emitServicesDone(emitter *events.Emitter, results []ServiceResult) {
+	for _, result := range results {
+		emitter.Emit("service.done", map[string]interface{}{"name": result.Name, "action": result.Action, "status": result.Status})
+	}
+}
+
+func runEnsureServices(client *http.Client, fullHost, cookie, ops string, timeout time.Duration, output string, emitter *events.Emitter) error {
+	if timeout <= 0 {
+		timeout = 2 * time.Minute
+	}
+	timeout = helpers.BoundWait(timeout)
+
+	span := telemetry.StartSpan("services.wait", telemetry.String("tg.services.ops", ops))
+	results, err := ensureServices(client, fullHost, cookie, ops, timeout, emitter)
+	span.Finish(err)
+
+	if output == "json" {
+		payload := map[string]interface{}{
+			"error":    err != nil,
+			"ops":      ops,
+			"services": results,
+		}
+		if err != nil {
+			payload["message"] = err.Error()
+		}
+		data, _ := json.Marshal(payload)
+		fmt.Fprintln(emitter.Out(), helpers.JSONOutput(string(data)))
+		return err
+	}
+
+	for _, result := range results {
+		fmt.Fprintf(emitter.Out(), "%-8s %-16s (%s)\n", result.Name, result.Action, result.Status)
+	}
+	if err != nil {
+		fmt.Fprintf(emitter.Out(), "Error: %v\n", err)
+	}
+	return err
+}
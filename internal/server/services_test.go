@@ -0,0 +1,238 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/events"
+)
+
+// mockServiceCluster simulates services that take a few status polls to
+// reach the state requested by a start/stop call.
+type mockServiceCluster struct {
+	mu         sync.Mutex
+	status     map[string]string
+	target     map[string]string
+	pollsLeft  map[string]int
+	delay      int
+	operations []string
+}
+
+func newMockServiceCluster(initial map[string]string, delay int) *mockServiceCluster {
+	return &mockServiceCluster{
+		status:    initial,
+		target:    map[string]string{},
+		pollsLeft: map[string]int{},
+		delay:     delay,
+	}
+}
+
+func (m *mockServiceCluster) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	names := r.URL.Query()["serviceName"]
+	switch r.URL.Path {
+	case "/api/service/status":
+		type result struct {
+			ServiceName   string `json:"serviceName"`
+			ServiceStatus string `json:"serviceStatus"`
+		}
+		var results []result
+		for _, name := range names {
+			if target, ok := m.target[name]; ok {
+				if m.pollsLeft[name] <= 0 {
+					m.status[name] = target
+					delete(m.target, name)
+				} else {
+					m.pollsLeft[name]--
+				}
+			}
+			results = append(results, result{ServiceName: name, ServiceStatus: m.status[name]})
+		}
+		json.NewEncoder(w).Encode(map[string]interface{}{"error": false, "results": results})
+	case "/api/service/start", "/api/service/stop":
+		target := "Online"
+		if strings.HasSuffix(r.URL.Path, "stop") {
+			target = "Down"
+		}
+		for _, name := range names {
+			m.operations = append(m.operations, r.URL.Path+":"+name)
+			if m.delay < 0 {
+				continue
+			}
+			m.target[name] = target
+			m.pollsLeft[name] = m.delay
+		}
+		json.NewEncoder(w).Encode(map[string]string{"message": "ok"})
+	}
+}
+
+func withFastServicePolling(t *testing.T) {
+	original := servicePollInterval
+	servicePollInterval = time.Millisecond
+	t.Cleanup(func() { servicePollInterval = original })
+}
+
+func TestEnsureServicesAlreadyRunning(t *testing.T) {
+	withFastServicePolling(t)
+	cluster := newMockServiceCluster(map[string]string{"gpe": "Online", "gse": "Online", "restpp": "Online"}, 0)
+	mockServer := httptest.NewServer(cluster)
+	defer mockServer.Close()
+
+	results, err := ensureServices(http.DefaultClient, mockServer.URL, "", "ensure-started", time.Second, nil)
+	if err != nil {
+		t.Fatalf("ensureServices failed: %v", err)
+	}
+
+	if len(cluster.operations) != 0 {
+		t.Errorf("Expected no start calls, got %v", cluster.operations)
+	}
+	for _, result := range results {
+		if result.Action != "already running" {
+			t.Errorf("Expected %s to be 'already running', got '%s'", result.Name, result.Action)
+		}
+	}
+}
+
+func TestEnsureServicesStartsOnlyStopped(t *testing.T) {
+	withFastServicePolling(t)
+	cluster := newMockServiceCluster(map[string]string{"gpe": "Down", "gse": "Online", "restpp": "Down"}, 3)
+	mockServer := httptest.NewServer(cluster)
+	defer mockServer.Close()
+
+	results, err := ensureServices(http.DefaultClient, mockServer.URL, "", "ensure-started", time.Second, nil)
+	if err != nil {
+		t.Fatalf("ensureServices failed: %v", err)
+	}
+
+	expectedOps := []string{"/api/service/start:gpe", "/api/service/start:restpp"}
+	if strings.Join(cluster.operations, ",") != strings.Join(expectedOps, ",") {
+		t.Errorf("Expected operations %v, got %v", expectedOps, cluster.operations)
+	}
+
+	expected := map[string]string{"gpe": "started now", "gse": "already running", "restpp": "started now"}
+	for _, result := range results {
+		if result.Action != expected[result.Name] {
+			t.Errorf("Expected %s action '%s', got '%s'", result.Name, expected[result.Name], result.Action)
+		}
+		if result.Status != "Online" {
+			t.Errorf("Expected %s to end Online, got '%s'", result.Name, result.Status)
+		}
+	}
+}
+
+func TestEnsureServicesStopped(t *testing.T) {
+	withFastServicePolling(t)
+	cluster := newMockServiceCluster(map[string]string{"gpe": "Online", "gse": "Down", "restpp": "Online"}, 2)
+	mockServer := httptest.NewServer(cluster)
+	defer mockServer.Close()
+
+	results, err := ensureServices(http.DefaultClient, mockServer.URL, "", "ensure-stopped", time.Second, nil)
+	if err != nil {
+		t.Fatalf("ensureServices failed: %v", err)
+	}
+
+	expected := map[string]string{"gpe": "stopped now", "gse": "already stopped", "restpp": "stopped now"}
+	for _, result := range results {
+		if result.Action != expected[result.Name] {
+			t.Errorf("Expected %s action '%s', got '%s'", result.Name, expected[result.Name], result.Action)
+		}
+	}
+}
+
+func TestEnsureServicesTimeout(t *testing.T) {
+	withFastServicePolling(t)
+	// A negative delay means the services never transition.
+	cluster := newMockServiceCluster(map[string]string{"gpe": "Down", "gse": "Online", "restpp": "Online"}, -1)
+	mockServer := httptest.NewServer(cluster)
+	defer mockServer.Close()
+
+	_, err := ensureServices(http.DefaultClient, mockServer.URL, "", "ensure-started", 20*time.Millisecond, nil)
+	if err == nil {
+		t.Fatal("Expected timeout error")
+	}
+	if !strings.Contains(err.Error(), "timed out") || !strings.Contains(err.Error(), "gpe") {
+		t.Errorf("Expected timeout error naming gpe, got: %v", err)
+	}
+}
+
+func TestEnsureServicesUnknownOperation(t *testing.T) {
+	_, err := ensureServices(http.DefaultClient, "http://127.0.0.1:0", "", "ensure-restarted", time.Second, nil)
+	if err == nil || !strings.Contains(err.Error(), "unknown operation") {
+		t.Errorf("Expected unknown operation error, got: %v", err)
+	}
+}
+
+func TestRunEnsureServicesJSON(t *testing.T) {
+	withFastServicePolling(t)
+	cluster := newMockServiceCluster(map[string]string{"gpe": "Down", "gse": "Online", "restpp": "Online"}, 1)
+	mockServer := httptest.NewServer(cluster)
+	defer mockServer.Close()
+
+	var output bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	err := runEnsureServices(http.DefaultClient, mockServer.URL, "", "ensure-started", time.Second, "json", nil)
+
+	w.Close()
+	os.Stdout = oldStdout
+	output.ReadFrom(r)
+
+	if err != nil {
+		t.Fatalf("runEnsureServices failed: %v", err)
+	}
+
+	var payload struct {
+		Error    bool            `json:"error"`
+		Ops      string          `json:"ops"`
+		Services []ServiceResult `json:"services"`
+	}
+	if err := json.Unmarshal(output.Bytes(), &payload); err != nil {
+		t.Fatalf("Output is not valid JSON: %v (%s)", err, output.String())
+	}
+	if payload.Error || payload.Ops != "ensure-started" || len(payload.Services) != 3 {
+		t.Errorf("Unexpected payload: %+v", payload)
+	}
+	if payload.Services[0].Action != "started now" {
+		t.Errorf("Expected gpe 'started now', got '%s'", payload.Services[0].Action)
+	}
+}
+
+func TestEnsureServicesEvents(t *testing.T) {
+	withFastServicePolling(t)
+	cluster := newMockServiceCluster(map[string]string{"gpe": "Down", "gse": "Online", "restpp": "Online"}, 1)
+	mockServer := httptest.NewServer(cluster)
+	defer mockServer.Close()
+
+	var buf bytes.Buffer
+	emitter := events.New(&buf)
+	if _, err := ensureServices(http.DefaultClient, mockServer.URL, "", "ensure-started", time.Second, emitter); err != nil {
+		t.Fatalf("ensureServices failed: %v", err)
+	}
+	emitter.Finish()
+
+	var names []string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		var event map[string]interface{}
+		if err := json.Unmarshal([]byte(line), &event); err != nil {
+			t.Fatalf("Invalid event line %q: %v", line, err)
+		}
+		names = append(names, fmt.Sprintf("%v", event["event"]))
+	}
+
+	expected := "services.requested,service.state,service.done,service.done,service.done,result"
+	if got := strings.Join(names, ","); got != expected {
+		t.Errorf("Expected events %s, got %s", expected, got)
+	}
+}
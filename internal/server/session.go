@@ -0,0 +1,168 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// A cached session lets consecutive gsql invocations skip version probing.
+// Each alias gets its own file under sessionCacheDir, which defaults to
+// ~/.tgcli/sessions, and the entry is only trusted for sessionCacheTTL.
+var (
+	sessionCacheDir string
+	sessionCacheTTL = 15 * time.Minute
+)
+
+var errSessionExpired = errors.New("cached session has expired")
+
+var unsafeKeyChars = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+type cachedSession struct {
+	Host      string            `json:"host"`
+	User      string            `json:"user"`
+	Version   string            `json:"version"`
+	Cookie    models.GSQLCookie `json:"cookie"`
+	ExpiresAt time.Time         `json:"expiresAt"`
+}
+
+// sessionCacheKey names the cache entry for a connection: the alias when one
+// is used, otherwise the user and host.
+func sessionCacheKey(alias, user, host string) string {
+	key := alias
+	if key == "" {
+		key = user + "@" + host
+	}
+	return unsafeKeyChars.ReplaceAllString(key, "_")
+}
+
+func sessionCachePath(key string) string {
+	dir := sessionCacheDir
+	if dir == "" {
+		dir = filepath.Join(constants.ConfigDir, "sessions")
+	}
+	return filepath.Join(dir, key+".json")
+}
+
+// loadCachedSession returns the cached session for key. Expired entries are
+// removed and reported as errSessionExpired.
+func loadCachedSession(key string) (*cachedSession, error) {
+	path := sessionCachePath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var cached cachedSession
+	if err := json.Unmarshal(data, &cached); err != nil {
+		return nil, fmt.Errorf("invalid session cache %s: %v", path, err)
+	}
+	if cached.Version == "" || cached.Cookie.ClientCommit == "" {
+		return nil, fmt.Errorf("invalid session cache %s: missing version or cookie", path)
+	}
+	if !time.Now().Before(cached.ExpiresAt) {
+		os.Remove(path)
+		return nil, errSessionExpired
+	}
+	return &cached, nil
+}
+
+// saveCachedSession writes the negotiated version and cookies of s for key.
+// The write is atomic so concurrent invocations never observe a partial
+// file.
+func saveCachedSession(key string, s *GSQLSession) error {
+	data, err := json.MarshalIndent(cachedSession{
+		Host:      s.Host,
+		User:      s.User,
+		Version:   s.Version,
+		Cookie:    s.Cookie,
+		ExpiresAt: time.Now().Add(sessionCacheTTL),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return helpers.WriteFileAtomic(sessionCachePath(key), data, 0600)
+}
+
+// clearCachedSession removes the cache entry for key, if any.
+func clearCachedSession(key string) error {
+	if err := os.Remove(sessionCachePath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
+
+// resume adopts a cached session without asking the server: its version
+// and cookies are used as they are, and the first request tells whether
+// the server still accepts them; see retryResumed.
+func (s *GSQLSession) resume(cached *cachedSession) error {
+	if cached.Host != s.Host || cached.User != s.User {
+		return fmt.Errorf("cached session belongs to %s@%s", cached.User, cached.Host)
+	}
+	s.Cookie = cached.Cookie
+	s.Version = cached.Version
+	s.resumed = true
+	return nil
+}
+
+// retryResumed sends body with send. When the session was resumed from
+// the cache and the server rejects it, it logs in again and sends body
+// once more, rewound to where it started. A body that cannot be rewound,
+// such as a script read from stdin, is only sent once the login is known
+// to work.
+func (s *GSQLSession) retryResumed(body io.Reader, send func(io.Reader) error) error {
+	if !s.resumed {
+		return send(body)
+	}
+	seeker, rewindable := body.(io.Seeker)
+	var start int64
+	if rewindable {
+		var err error
+		if start, err = seeker.Seek(0, io.SeekCurrent); err != nil {
+			rewindable = false
+		}
+	}
+	if !rewindable {
+		if err := s.relogin(); err != nil {
+			return err
+		}
+		return send(body)
+	}
+
+	err := send(body)
+	if !errors.Is(err, errLoginExpired) {
+		s.resumed = false
+		return err
+	}
+	fmt.Fprintln(s.messages(), "Cached session rejected, logging in again")
+	if err := s.relogin(); err != nil {
+		return err
+	}
+	if _, err := seeker.Seek(start, io.SeekStart); err != nil {
+		return err
+	}
+	return send(body)
+}
+
+// relogin replaces a resumed session with a fresh login, and caches it.
+func (s *GSQLSession) relogin() error {
+	s.resumed = false
+	if err := s.login(); err != nil {
+		return fmt.Errorf("logging in again: %w", err)
+	}
+	if s.cacheKey != "" {
+		if err := saveCachedSession(s.cacheKey, s); err != nil {
+			helpers.Warn(helpers.WarnSessionCache, "could not cache session: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,341 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/models"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+func withSessionCache(t *testing.T, ttl time.Duration) string {
+	t.Helper()
+	originalDir, originalTTL := sessionCacheDir, sessionCacheTTL
+	sessionCacheDir = t.TempDir()
+	sessionCacheTTL = ttl
+	t.Cleanup(func() {
+		sessionCacheDir, sessionCacheTTL = originalDir, originalTTL
+	})
+	return sessionCacheDir
+}
+
+func testSession(host string) *GSQLSession {
+	return &GSQLSession{
+		Host:     host,
+		User:     "tigergraph",
+		Password: "tigergraph",
+		Version:  "3.6.2",
+		Cookie: models.GSQLCookie{
+			ClientCommit:               versionCommits["3.6.2"],
+			GShellTest:                 true,
+			ApplicationGatewayAffinity: "affinity",
+		},
+		Client: &http.Client{Timeout: 5 * time.Second},
+	}
+}
+
+func TestSessionCacheKey(t *testing.T) {
+	if got := sessionCacheKey("prod", "tigergraph", "http://host:14240"); got != "prod" {
+		t.Errorf("Expected alias as key, got '%s'", got)
+	}
+	if got := sessionCacheKey("", "tigergraph", "http://host:14240"); got != "tigergraph_http_host_14240" {
+		t.Errorf("Expected sanitized user and host, got '%s'", got)
+	}
+	if got := sessionCacheKey("../etc", "", ""); got != ".._etc" {
+		t.Errorf("Expected path separators to be replaced, got '%s'", got)
+	}
+}
+
+func TestSessionCacheRoundTrip(t *testing.T) {
+	dir := withSessionCache(t, time.Minute)
+
+	session := testSession("http://host:14240")
+	if err := saveCachedSession("prod", session); err != nil {
+		t.Fatalf("saveCachedSession failed: %v", err)
+	}
+
+	info, err := os.Stat(filepath.Join(dir, "prod.json"))
+	if err != nil {
+		t.Fatalf("Cache file not written: %v", err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("Expected mode 0600, got %o", info.Mode().Perm())
+	}
+
+	cached, err := loadCachedSession("prod")
+	if err != nil {
+		t.Fatalf("loadCachedSession failed: %v", err)
+	}
+	if cached.Host != session.Host || cached.User != session.User || cached.Version != "3.6.2" {
+		t.Errorf("Unexpected cached session: %+v", cached)
+	}
+	if cached.Cookie != session.Cookie {
+		t.Errorf("Expected cookie %+v, got %+v", session.Cookie, cached.Cookie)
+	}
+}
+
+func TestSessionCacheExpired(t *testing.T) {
+	dir := withSessionCache(t, -time.Second)
+
+	if err := saveCachedSession("prod", testSession("http://host:14240")); err != nil {
+		t.Fatalf("saveCachedSession failed: %v", err)
+	}
+
+	if _, err := loadCachedSession("prod"); !errors.Is(err, errSessionExpired) {
+		t.Errorf("Expected errSessionExpired, got %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prod.json")); !os.IsNotExist(err) {
+		t.Error("Expired cache entry should be removed")
+	}
+}
+
+func TestSessionCacheInvalid(t *testing.T) {
+	dir := withSessionCache(t, time.Minute)
+
+	if _, err := loadCachedSession("missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Expected not-exist error for a missing entry, got %v", err)
+	}
+
+	tests := map[string]string{
+		"corrupt":   "{not json",
+		"no-cookie": `{"host":"h","user":"u","version":"3.6.2","expiresAt":"2999-01-01T00:00:00Z"}`,
+	}
+	for key, content := range tests {
+		if err := os.WriteFile(filepath.Join(dir, key+".json"), []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := loadCachedSession(key); err == nil || errors.Is(err, errSessionExpired) {
+			t.Errorf("%s: expected invalid cache error, got %v", key, err)
+		}
+	}
+}
+
+func TestClearCachedSession(t *testing.T) {
+	dir := withSessionCache(t, time.Minute)
+
+	if err := saveCachedSession("prod", testSession("http://host:14240")); err != nil {
+		t.Fatalf("saveCachedSession failed: %v", err)
+	}
+	if err := clearCachedSession("prod"); err != nil {
+		t.Errorf("clearCachedSession failed: %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prod.json")); !os.IsNotExist(err) {
+		t.Error("Cache entry should be removed")
+	}
+	if err := clearCachedSession("prod"); err != nil {
+		t.Errorf("Clearing a missing entry should succeed, got %v", err)
+	}
+}
+
+func TestSessionCacheConcurrentSaves(t *testing.T) {
+	dir := withSessionCache(t, time.Minute)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := saveCachedSession("prod", testSession("http://host:14240")); err != nil {
+				t.Errorf("saveCachedSession failed: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if _, err := loadCachedSession("prod"); err != nil {
+		t.Errorf("Cache corrupted by concurrent saves: %v", err)
+	}
+	entries, _ := os.ReadDir(dir)
+	if len(entries) != 1 {
+		t.Errorf("Expected only the cache file to remain, found %d entries", len(entries))
+	}
+}
+
+// resumeServer accepts commands sent with the cookie of testSession only
+// after accepted logins, and counts both.
+type resumeServer struct {
+	logins, commands int32
+	bodies           []string
+	acceptCached     bool
+}
+
+func (rs *resumeServer) start(t *testing.T) *httptest.Server {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var cookie models.GSQLCookie
+		json.Unmarshal([]byte(r.Header.Get("Cookie")), &cookie)
+		if strings.HasSuffix(r.URL.Path, constants.LOGIN_ENDPOINT) {
+			atomic.AddInt32(&rs.logins, 1)
+			json.NewEncoder(w).Encode(map[string]interface{}{"isClientCompatible": true, "welcomeMessage": "Welcome back"})
+			return
+		}
+		atomic.AddInt32(&rs.commands, 1)
+		body, _ := io.ReadAll(r.Body)
+		rs.bodies = append(rs.bodies, string(body))
+		if cookie.ApplicationGatewayAffinity == "affinity" && !rs.acceptCached {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		w.Write([]byte("ok\n__GSQL__RETURN__CODE__,0\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestGSQLSessionResume(t *testing.T) {
+	withSessionCache(t, time.Minute)
+	rs := &resumeServer{acceptCached: true}
+	server := rs.start(t)
+
+	if err := saveCachedSession("prod", testSession(server.URL)); err != nil {
+		t.Fatalf("saveCachedSession failed: %v", err)
+	}
+	cached, err := loadCachedSession("prod")
+	if err != nil {
+		t.Fatalf("loadCachedSession failed: %v", err)
+	}
+
+	session := &GSQLSession{Host: server.URL, User: "tigergraph", Password: "tigergraph", Client: &http.Client{}}
+	if err := session.resume(cached); err != nil {
+		t.Fatalf("resume failed: %v", err)
+	}
+	if session.Version != "3.6.2" || session.Cookie.ApplicationGatewayAffinity != "affinity" {
+		t.Errorf("Session did not adopt the cached state: %+v", session)
+	}
+	captureOutput(func() { err = session.executeCommand("ls") })
+	if err != nil || rs.logins != 0 || rs.commands != 1 {
+		t.Errorf("Expected the cached cookie to be used without a login, got %v after %d logins and %d commands", err, rs.logins, rs.commands)
+	}
+
+	other := &GSQLSession{Host: server.URL, User: "admin", Client: &http.Client{}}
+	if err := other.resume(cached); err == nil {
+		t.Error("Expected a session for another user to be rejected")
+	}
+}
+
+func TestGSQLSessionResumeRejected(t *testing.T) {
+	withSessionCache(t, time.Minute)
+	rs := &resumeServer{}
+	server := rs.start(t)
+	cached := &cachedSession{Host: server.URL, User: "tigergraph", Version: "3.6.2", Cookie: testSession(server.URL).Cookie}
+
+	resumed := func() *GSQLSession {
+		session := &GSQLSession{Host: server.URL, User: "tigergraph", Password: "tigergraph", Client: &http.Client{}, cacheKey: "prod"}
+		if err := session.resume(cached); err != nil {
+			t.Fatalf("resume failed: %v", err)
+		}
+		return session
+	}
+
+	// A rejected cookie means logging in again and sending the command
+	// once more.
+	var err error
+	output := captureOutput(func() { err = resumed().executeCommand("ls") })
+	if err != nil || rs.logins != 1 || !reflect.DeepEqual(rs.bodies, []string{"ls", "ls"}) {
+		t.Errorf("Expected a login and the command again, got %v after %d logins and %q", err, rs.logins, rs.bodies)
+	}
+	if !strings.Contains(output, "Cached session rejected, logging in again") {
+		t.Errorf("Expected the new login to be reported:\n%s", output)
+	}
+	if refreshed, err := loadCachedSession("prod"); err != nil || refreshed.Cookie.ApplicationGatewayAffinity != "" {
+		t.Errorf("Expected the new login to be cached, got %+v (%v)", refreshed, err)
+	}
+
+	// A file is sent again from the start.
+	rs.bodies, rs.logins = nil, 0
+	path := filepath.Join(t.TempDir(), "schema.gsql")
+	os.WriteFile(path, []byte("\n  USE GRAPH social\n"), 0600)
+	session := resumed()
+	captureOutput(func() { session.runScripts([]gsqlScript{{file: path}}, "text", "", io.Discard, false) })
+	if !reflect.DeepEqual(rs.bodies, []string{"USE GRAPH social\n", "USE GRAPH social\n"}) || session.Graph != "social" {
+		t.Errorf("Expected the file to be sent again, got %q in graph %q", rs.bodies, session.Graph)
+	}
+
+	// Stdin cannot be sent twice, so the login comes first.
+	rs.bodies, rs.logins = nil, 0
+	original := scriptInput
+	scriptInput = strings.NewReader("ls")
+	t.Cleanup(func() { scriptInput = original })
+	captureOutput(func() { resumed().runScripts([]gsqlScript{{file: "-"}}, "text", "", io.Discard, false) })
+	if rs.logins != 1 || !reflect.DeepEqual(rs.bodies, []string{"ls"}) {
+		t.Errorf("Expected a login before stdin is sent, got %d logins and %q", rs.logins, rs.bodies)
+	}
+}
+
+func TestRunGSQLResumedSessionKeepsExpiry(t *testing.T) {
+	withSessionCache(t, time.Minute)
+	rs := &resumeServer{acceptCached: true}
+	server := rs.start(t)
+	u, _ := url.Parse(server.URL)
+
+	host := "http://" + u.Hostname() + ":" + u.Port()
+	key := sessionCacheKey("", "tigergraph", host)
+	if err := saveCachedSession(key, testSession(host)); err != nil {
+		t.Fatalf("saveCachedSession failed: %v", err)
+	}
+	before, _ := os.ReadFile(sessionCachePath(key))
+
+	cmd := noLoginCmd(nil)
+	cmd.Flags().String("user", "tigergraph", "")
+	cmd.Flags().String("password", "tigergraph", "")
+	cmd.Flags().String("host", "http://"+u.Hostname(), "")
+	cmd.Flags().String("gsPort", u.Port(), "")
+	cmd.Flags().String("max-response-size", "0", "")
+	cmd.Flags().String("command", "ls", "")
+	cmd.Flags().Bool("session-cache", true, "")
+	captureOutput(func() { RunGSQL(cmd, nil) })
+
+	if rs.logins != 0 || rs.commands != 1 {
+		t.Fatalf("Expected the cached session to be used without a login, got %d logins and %d commands", rs.logins, rs.commands)
+	}
+	if after, _ := os.ReadFile(sessionCachePath(key)); !bytes.Equal(before, after) {
+		t.Errorf("Expected a resumed session to leave its cache entry alone, was\n%s\nnow\n%s", before, after)
+	}
+}
+
+func TestRunGSQLLogout(t *testing.T) {
+	dir := withSessionCache(t, time.Minute)
+
+	if err := saveCachedSession("tigergraph_http_127.0.0.1_14240", testSession("http://127.0.0.1:14240")); err != nil {
+		t.Fatalf("saveCachedSession failed: %v", err)
+	}
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("alias", "", "")
+	cmd.Flags().String("user", "tigergraph", "")
+	cmd.Flags().String("password", "tigergraph", "")
+	cmd.Flags().String("host", "http://127.0.0.1", "")
+	cmd.Flags().String("gsPort", "14240", "")
+	cmd.Flags().Bool("logout", true, "")
+
+	var output bytes.Buffer
+	oldStdout := os.Stdout
+	r, w, _ := os.Pipe()
+	os.Stdout = w
+
+	RunGSQL(cmd, []string{})
+
+	w.Close()
+	os.Stdout = oldStdout
+	output.ReadFrom(r)
+
+	if _, err := os.Stat(filepath.Join(dir, "tigergraph_http_127.0.0.1_14240.json")); !os.IsNotExist(err) {
+		t.Error("Expected --logout to remove the cached session")
+	}
+	if output.String() != "Cleared cached GSQL session for http://127.0.0.1:14240\n" {
+		t.Errorf("Unexpected output: %q", output.String())
+	}
+}
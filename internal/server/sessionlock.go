@@ -0,0 +1,138 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// Every interactive session leaves a lock file under sessionLockDir, which
+// defaults to ~/.tgcli/locks, named after its alias and process ID. The
+// lock is advisory: a new session to the same alias warns about the others
+// rather than refusing to start.
+var sessionLockDir string
+
+// lockHolder is what a session writes to its lock file.
+type lockHolder struct {
+	Key     string    `json:"key"`
+	PID     int       `json:"pid"`
+	User    string    `json:"user"`
+	Host    string    `json:"host"`
+	Started time.Time `json:"started"`
+}
+
+// sessionLock is the lock file of the running session.
+type sessionLock struct {
+	path string
+}
+
+// processAlive reports whether a process with pid is running. Tests
+// replace it.
+var processAlive = func(pid int) bool {
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	// On Windows FindProcess fails for processes that have exited.
+	if runtime.GOOS == "windows" {
+		return true
+	}
+	return process.Signal(syscall.Signal(0)) == nil
+}
+
+func sessionLocksPath() string {
+	if sessionLockDir != "" {
+		return sessionLockDir
+	}
+	return filepath.Join(constants.ConfigDir, "locks")
+}
+
+// sessionLockKey names the locks of a connection: its alias, ignoring case,
+// or its host when no alias was used.
+func sessionLockKey(alias, host string) string {
+	key := helpers.AliasKey(alias)
+	if key == "" {
+		key = host
+	}
+	return unsafeKeyChars.ReplaceAllString(key, "_")
+}
+
+// activeSessions returns the other sessions holding a lock for key. Lock
+// files of processes that are gone are removed.
+func activeSessions(key string) []lockHolder {
+	dir := sessionLocksPath()
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil
+	}
+	var holders []lockHolder
+	for _, entry := range entries {
+		name, ok := strings.CutSuffix(entry.Name(), ".lock")
+		if !ok {
+			continue
+		}
+		dot := strings.LastIndex(name, ".")
+		if dot < 0 || name[:dot] != key {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		pid, err := strconv.Atoi(name[dot+1:])
+		if err != nil || pid == os.Getpid() {
+			continue
+		}
+		var holder lockHolder
+		data, err := os.ReadFile(path)
+		if err == nil {
+			err = json.Unmarshal(data, &holder)
+		}
+		if err != nil || holder.PID != pid || !processAlive(pid) {
+			os.Remove(path)
+			continue
+		}
+		holders = append(holders, holder)
+	}
+	return holders
+}
+
+// lockSession writes the lock file of this process for key.
+func lockSession(key, user, host string) (*sessionLock, error) {
+	dir := sessionLocksPath()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	data, err := json.Marshal(lockHolder{Key: key, PID: os.Getpid(), User: user, Host: host, Started: helpers.Now()})
+	if err != nil {
+		return nil, err
+	}
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d.lock", key, os.Getpid()))
+	if err := helpers.WriteFileAtomic(path, data, 0600); err != nil {
+		return nil, err
+	}
+	return &sessionLock{path: path}, nil
+}
+
+// release removes the lock file. It may be called more than once, and on
+// a nil lock.
+func (l *sessionLock) release() {
+	if l != nil {
+		os.Remove(l.path)
+	}
+}
+
+// describeHolders renders the sessions holding locks for a warning.
+func describeHolders(holders []lockHolder) string {
+	var parts []string
+	for _, holder := range holders {
+		parts = append(parts, fmt.Sprintf("pid %d as %s since %s", holder.PID, holder.User, holder.Started.Local().Format("15:04 Jan 2")))
+	}
+	return strings.Join(parts, "; ")
+}
@@ -0,0 +1,91 @@
+package server
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withSessionLocks(t *testing.T, alive map[int]bool) string {
+	t.Helper()
+	originalDir, originalAlive := sessionLockDir, processAlive
+	sessionLockDir = t.TempDir()
+	processAlive = func(pid int) bool { return alive[pid] }
+	t.Cleanup(func() { sessionLockDir, processAlive = originalDir, originalAlive })
+	return sessionLockDir
+}
+
+// writeLock leaves the lock file another process would.
+func writeLock(t *testing.T, dir string, holder lockHolder) string {
+	t.Helper()
+	data, _ := json.Marshal(holder)
+	path := filepath.Join(dir, fmt.Sprintf("%s.%d.lock", holder.Key, holder.PID))
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestSessionLockKey(t *testing.T) {
+	if got := sessionLockKey("Prod", "http://10.0.0.1:14240"); got != "prod" {
+		t.Errorf("Expected the alias ignoring case, got %q", got)
+	}
+	if got := sessionLockKey("", "http://10.0.0.1:14240"); got != "http_10.0.0.1_14240" {
+		t.Errorf("Expected the host without an alias, got %q", got)
+	}
+}
+
+func TestActiveSessions(t *testing.T) {
+	dir := withSessionLocks(t, map[int]bool{101: true, 303: true})
+	started := time.Date(2024, 3, 1, 9, 30, 0, 0, time.UTC)
+	writeLock(t, dir, lockHolder{Key: "prod", PID: 101, User: "tigergraph", Host: "http://prod:14240", Started: started})
+	stale := writeLock(t, dir, lockHolder{Key: "prod", PID: 202, User: "tigergraph", Started: started})
+	writeLock(t, dir, lockHolder{Key: "prod.eu", PID: 303, User: "tigergraph", Started: started})
+	os.WriteFile(filepath.Join(dir, "prod.404.lock"), []byte("{"), 0600)
+
+	holders := activeSessions("prod")
+	if len(holders) != 1 || holders[0].PID != 101 {
+		t.Fatalf("Expected only the running session to prod, got %+v", holders)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Error("Expected the lock of a process that is gone to be removed")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "prod.404.lock")); !os.IsNotExist(err) {
+		t.Error("Expected an unreadable lock to be removed")
+	}
+	if got := describeHolders(holders); !strings.HasPrefix(got, "pid 101 as tigergraph since ") {
+		t.Errorf("Unexpected description %q", got)
+	}
+	if holders := activeSessions("staging"); len(holders) != 0 {
+		t.Errorf("Expected no sessions to staging, got %+v", holders)
+	}
+}
+
+func TestLockSession(t *testing.T) {
+	dir := withSessionLocks(t, map[int]bool{os.Getpid(): true})
+
+	lock, err := lockSession("prod", "tigergraph", "http://prod:14240")
+	if err != nil {
+		t.Fatalf("lockSession failed: %v", err)
+	}
+	data, _ := os.ReadFile(filepath.Join(dir, fmt.Sprintf("prod.%d.lock", os.Getpid())))
+	var holder lockHolder
+	if err := json.Unmarshal(data, &holder); err != nil || holder.PID != os.Getpid() || holder.Host != "http://prod:14240" {
+		t.Errorf("Unexpected lock file %s (%v)", data, err)
+	}
+	if holders := activeSessions("prod"); len(holders) != 0 {
+		t.Errorf("A session should not see its own lock, got %+v", holders)
+	}
+
+	lock.release()
+	lock.release()
+	if entries, _ := os.ReadDir(dir); len(entries) != 0 {
+		t.Errorf("Expected release to remove the lock, left %v", entries)
+	}
+	var none *sessionLock
+	none.release()
+}
@@ -0,0 +1,181 @@
+package server
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// An interactive session saves its state before every prompt so a session
+// cut short, e.g. by a closed terminal, can be picked up again. Each
+// connection gets its own file under sessionStateDir, which defaults to
+// ~/.tgcli/state. A new session offers to restore state saved within
+// stateRestoreWindow; files older than stateMaxAge are removed.
+var (
+	sessionStateDir    string
+	stateRestoreWindow = time.Hour
+	stateMaxAge        = 24 * time.Hour
+)
+
+// sessionState is what an interactive session saves between prompts.
+type sessionState struct {
+	Alias string `json:"alias,omitempty"`
+	Host  string `json:"host"`
+	User  string `json:"user"`
+	Graph string `json:"graph,omitempty"`
+	// Scratch is the buffer \edit! reopens.
+	Scratch string    `json:"scratch,omitempty"`
+	SavedAt time.Time `json:"savedAt"`
+}
+
+func sessionStatePath(key string) string {
+	dir := sessionStateDir
+	if dir == "" {
+		dir = filepath.Join(constants.ConfigDir, "state")
+	}
+	return filepath.Join(dir, key+".json")
+}
+
+// saveState records the session's current state. Sessions without a state
+// key, such as single-command runs, keep none.
+func (s *GSQLSession) saveState() error {
+	if s.stateKey == "" {
+		return nil
+	}
+	data, err := json.MarshalIndent(sessionState{
+		Alias:   s.Alias,
+		Host:    s.Host,
+		User:    s.User,
+		Graph:   s.Graph,
+		Scratch: s.lastScratch,
+		SavedAt: helpers.Now(),
+	}, "", "  ")
+	if err != nil {
+		return err
+	}
+	return helpers.WriteFileAtomic(sessionStatePath(s.stateKey), data, 0600)
+}
+
+// clearState removes the saved state once the session ends cleanly.
+func (s *GSQLSession) clearState() {
+	if s.stateKey != "" {
+		os.Remove(sessionStatePath(s.stateKey))
+	}
+}
+
+// loadState returns the state saved for key. A state file that cannot be
+// read is removed, so it is only reported once.
+func loadState(key string) (*sessionState, error) {
+	path := sessionStatePath(key)
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var state sessionState
+	err = json.Unmarshal(data, &state)
+	switch {
+	case err != nil:
+	case state.SavedAt.IsZero():
+		err = errors.New("missing savedAt")
+	case state.Graph != "" && !graphName.MatchString(state.Graph):
+		err = fmt.Errorf("invalid graph name %q", state.Graph)
+	}
+	if err != nil {
+		os.Remove(path)
+		return nil, fmt.Errorf("invalid session state %s: %v", path, err)
+	}
+	return &state, nil
+}
+
+// pruneStates removes the state files of every connection that have not
+// been touched within stateMaxAge.
+func pruneStates() {
+	dir := filepath.Dir(sessionStatePath("x"))
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	cutoff := helpers.Now().Add(-stateMaxAge)
+	for _, entry := range entries {
+		if !strings.HasSuffix(entry.Name(), ".json") {
+			continue
+		}
+		if info, err := entry.Info(); err == nil && info.ModTime().Before(cutoff) {
+			os.Remove(filepath.Join(dir, entry.Name()))
+		}
+	}
+}
+
+// offerRestore looks for state left by an earlier session on the same
+// connection and, if the user agrees, selects its graph again and brings
+// back its \edit! buffer. Answers are read from reader, the prompt's own
+// input; an empty answer restores.
+func (s *GSQLSession) offerRestore(reader *bufio.Reader) {
+	if s.stateKey == "" {
+		return
+	}
+	pruneStates()
+
+	state, err := loadState(s.stateKey)
+	if err != nil {
+		if !errors.Is(err, os.ErrNotExist) {
+			helpers.Warn(helpers.WarnSessionState, "ignoring %v", err)
+		}
+		return
+	}
+	age := helpers.Now().Sub(state.SavedAt)
+	if age > stateRestoreWindow || state.Host != s.Host || state.User != s.User {
+		s.clearState()
+		return
+	}
+	if state.Graph == "" && state.Scratch == "" {
+		return
+	}
+
+	fmt.Fprintf(s.out(), "Previous session from %s ago: %s\n", age.Round(time.Second), describeState(state))
+	const confirm = "Restore previous session state? [Y/n] "
+	fmt.Print(confirm)
+	answer, _ := reader.ReadString('\n')
+	answer = strings.TrimSpace(answer)
+	s.capture.input(confirm, answer)
+	if answer != "" {
+		if restore, _ := helpers.ParseYesNo(answer); !restore {
+			s.clearState()
+			return
+		}
+	}
+
+	if state.Scratch != "" {
+		if _, err := os.Stat(state.Scratch); err == nil {
+			s.lastScratch = state.Scratch
+		}
+	}
+	if state.Graph != "" {
+		if err := s.executeCommand("USE GRAPH " + state.Graph); err != nil {
+			var gsqlErr *GSQLError
+			if !errors.As(err, &gsqlErr) {
+				fmt.Fprintf(s.out(), "Error restoring graph %s: %v\n", state.Graph, err)
+			}
+		}
+	}
+}
+
+// describeState summarizes what restoring state would bring back.
+func describeState(state *sessionState) string {
+	var parts []string
+	if state.Graph != "" {
+		parts = append(parts, "graph "+state.Graph)
+	}
+	if state.Scratch != "" {
+		parts = append(parts, `\edit! buffer `+state.Scratch)
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,123 @@
+package server
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func withSessionState(t *testing.T) string {
+	t.Helper()
+	original := sessionStateDir
+	sessionStateDir = t.TempDir()
+	t.Cleanup(func() { sessionStateDir = original })
+	return sessionStateDir
+}
+
+// mockUseGraph accepts every command and records it.
+func mockUseGraph(t *testing.T, commands *[]string) *httptest.Server {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		*commands = append(*commands, string(body))
+		w.Write([]byte("__GSQL__RETURN__CODE__,0\n"))
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func TestSessionStateRestore(t *testing.T) {
+	withSessionState(t)
+	var commands []string
+	server := mockUseGraph(t, &commands)
+	newSession := func() *GSQLSession {
+		return &GSQLSession{Host: server.URL, User: "tigergraph", Client: server.Client(), stateKey: "prod"}
+	}
+
+	// The first session ends without quit, as when the terminal closes.
+	captureOutput(func() { newSession().startInteractiveSession(strings.NewReader(`\use social` + "\n")) })
+	state, err := loadState("prod")
+	if err != nil || state.Graph != "social" {
+		t.Fatalf("Expected the graph to be saved, got %+v (%v)", state, err)
+	}
+
+	commands = nil
+	session := newSession()
+	output := captureOutput(func() { session.startInteractiveSession(strings.NewReader("\nexit\n")) })
+	if !strings.Contains(output, "graph social\nRestore previous session state? [Y/n] ") {
+		t.Errorf("Expected the restore prompt, got %q", output)
+	}
+	if len(commands) != 1 || commands[0] != "USE GRAPH social" || session.Graph != "social" {
+		t.Errorf("Expected USE GRAPH to be re-issued, got %q (graph %q)", commands, session.Graph)
+	}
+	if _, err := os.Stat(sessionStatePath("prod")); !os.IsNotExist(err) {
+		t.Errorf("Expected a clean exit to remove the state, got %v", err)
+	}
+}
+
+func TestSessionStateDeclined(t *testing.T) {
+	withSessionState(t)
+	var commands []string
+	server := mockUseGraph(t, &commands)
+	session := &GSQLSession{Host: server.URL, User: "tigergraph", Client: server.Client(), stateKey: "prod", Graph: "social"}
+	if err := session.saveState(); err != nil {
+		t.Fatal(err)
+	}
+
+	session = &GSQLSession{Host: server.URL, User: "tigergraph", Client: server.Client(), stateKey: "prod"}
+	captureOutput(func() { session.offerRestore(answers("n")) })
+	if len(commands) != 0 || session.Graph != "" {
+		t.Errorf("Declining should not restore anything, got %q (graph %q)", commands, session.Graph)
+	}
+	if _, err := loadState("prod"); !os.IsNotExist(err) {
+		t.Errorf("Expected declined state to be removed, got %v", err)
+	}
+}
+
+func TestSessionStateIgnored(t *testing.T) {
+	dir := withSessionState(t)
+	session := &GSQLSession{Host: "http://host:14240", User: "tigergraph", stateKey: "prod"}
+
+	for name, content := range map[string]string{
+		"corrupt":      "{not json",
+		"no timestamp": `{"host":"http://host:14240","user":"tigergraph","graph":"social"}`,
+		"bad graph":    `{"host":"http://host:14240","user":"tigergraph","graph":"x; DROP ALL","savedAt":"` + time.Now().Format(time.RFC3339) + `"}`,
+		"stale":        `{"host":"http://host:14240","user":"tigergraph","graph":"social","savedAt":"` + time.Now().Add(-2*stateRestoreWindow).Format(time.RFC3339) + `"}`,
+		"other host":   `{"host":"http://other:14240","user":"tigergraph","graph":"social","savedAt":"` + time.Now().Format(time.RFC3339) + `"}`,
+	} {
+		path := filepath.Join(dir, "prod.json")
+		if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+			t.Fatal(err)
+		}
+		output := captureOutput(func() { session.offerRestore(answers("y")) })
+		if strings.Contains(output, "Restore") || session.Graph != "" {
+			t.Errorf("%s: expected no restore, got %q", name, output)
+		}
+		if _, err := os.Stat(path); !os.IsNotExist(err) {
+			t.Errorf("%s: expected the state file to be removed, got %v", name, err)
+		}
+	}
+}
+
+func TestPruneStates(t *testing.T) {
+	dir := withSessionState(t)
+	old, recent := filepath.Join(dir, "old.json"), filepath.Join(dir, "recent.json")
+	for _, path := range []string{old, recent} {
+		os.WriteFile(path, []byte("{}"), 0600)
+	}
+	stale := time.Now().Add(-2 * stateMaxAge)
+	os.Chtimes(old, stale, stale)
+
+	pruneStates()
+	if _, err := os.Stat(old); !os.IsNotExist(err) {
+		t.Errorf("Expected state older than a day to be removed, got %v", err)
+	}
+	if _, err := os.Stat(recent); err != nil {
+		t.Errorf("Expected recent state to be kept, got %v", err)
+	}
+}
@@ -0,0 +1,46 @@
+package telemetry
+
+import (
+	"context"
+	"os"
+	"strconv"
+	"time"
+
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// defaultExportTimeout keeps a missing or slow collector from holding up
+// the command. OTEL_EXPORTER_OTLP_TIMEOUT, in milliseconds, overrides it.
+const defaultExportTimeout = 100 * time.Millisecond
+
+// defaultServiceName is used unless OTEL_SERVICE_NAME is set.
+const defaultServiceName = "tg"
+
+// FromEnv returns an OTLP/HTTP exporter configured from the standard
+// OTEL_* variables, or false when no endpoint is set. The exporter reads
+// the endpoint and headers itself; tg only shortens the default timeout
+// and turns off retries, which would outlast the command.
+func FromEnv() (sdktrace.SpanExporter, bool) {
+	if os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") == "" && os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") == "" {
+		return nil, false
+	}
+	exporter, err := otlptracehttp.New(context.Background(),
+		otlptracehttp.WithTimeout(exportTimeout()),
+		otlptracehttp.WithRetry(otlptracehttp.RetryConfig{Enabled: false}),
+	)
+	if err != nil {
+		return nil, false
+	}
+	return exporter, true
+}
+
+// exportTimeout is how long the export at the end of a run may take.
+func exportTimeout() time.Duration {
+	for _, name := range []string{"OTEL_EXPORTER_OTLP_TRACES_TIMEOUT", "OTEL_EXPORTER_OTLP_TIMEOUT"} {
+		if ms, err := strconv.Atoi(os.Getenv(name)); err == nil && ms > 0 {
+			return time.Duration(ms) * time.Millisecond
+		}
+	}
+	return defaultExportTimeout
+}
@@ -0,0 +1,263 @@
+// Package telemetry records OpenTelemetry traces of a command and exports
+// them over OTLP/HTTP.
+//
+// Tracing is on when an OTLP endpoint is configured through the standard
+// OTEL_EXPORTER_OTLP_ENDPOINT or OTEL_EXPORTER_OTLP_TRACES_ENDPOINT
+// variables and --trace or telemetry.traces in the config asks for it. A
+// run then produces one trace:
+//
+//	tg <command>        root span, with the exit code
+//	  HTTP <method>     one per request: method, redacted URL, status
+//	  <phase>           login, wait loops and file transfers
+//	    HTTP <method>   requests made during the phase
+//
+// Spans are batched by the OpenTelemetry SDK and flushed when the command
+// ends, with a short timeout, so a missing collector costs at most that
+// timeout. Every string attribute passes through helpers.Redact.
+package telemetry
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/trace"
+)
+
+// instrumentationName names the tracer, the scope of every span.
+const instrumentationName = "github.com/zrougamed/tgCli"
+
+// maxSpans bounds the spans queued for export, e.g. in a long GSQL
+// session. The SDK drops spans beyond it.
+const maxSpans = 2048
+
+// Attribute is a span attribute.
+type Attribute = attribute.KeyValue
+
+// String returns a string attribute. The value is redacted.
+func String(key, value string) Attribute {
+	return attribute.String(key, helpers.Redact(value))
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int64) Attribute {
+	return attribute.Int64(key, value)
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return attribute.Bool(key, value)
+}
+
+// Span is one timed operation. A nil *Span is valid and records nothing,
+// so callers can trace unconditionally.
+type Span struct {
+	span   trace.Span
+	ctx    context.Context
+	tracer *tracer
+}
+
+// SetAttributes adds attributes to the span.
+func (s *Span) SetAttributes(attrs ...Attribute) {
+	if s == nil {
+		return
+	}
+	s.span.SetAttributes(attrs...)
+}
+
+// Finish ends the span, marking it failed when err is not nil.
+func (s *Span) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.tracer.close(s)
+	if err != nil {
+		s.span.SetStatus(codes.Error, helpers.Redact(err.Error()))
+	}
+	s.span.End()
+}
+
+// tracer holds the provider of one run.
+type tracer struct {
+	provider *sdktrace.TracerProvider
+	tracer   trace.Tracer
+	root     *Span
+
+	mu sync.Mutex
+	// open are the phase spans in progress; new spans are children of
+	// the last one.
+	open []*Span
+}
+
+var (
+	activeMu sync.Mutex
+	active   *tracer
+)
+
+func current() *tracer {
+	activeMu.Lock()
+	defer activeMu.Unlock()
+	return active
+}
+
+// Start begins tracing a run whose root span is name. Spans go to exporter
+// in batches and are flushed when Shutdown is called.
+func Start(name string, exporter sdktrace.SpanExporter, attrs ...Attribute) {
+	// The SDK reports failed exports to its error handler, which logs them
+	// by default; tg words them like its other warnings.
+	otel.SetErrorHandler(otel.ErrorHandlerFunc(warnExportFailed))
+	provider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter, sdktrace.WithMaxQueueSize(maxSpans), sdktrace.WithMaxExportBatchSize(maxSpans)),
+		sdktrace.WithResource(runResource()),
+	)
+	t := &tracer{provider: provider, tracer: provider.Tracer(instrumentationName, trace.WithInstrumentationVersion(constants.VERSION_CLI))}
+	ctx, span := t.tracer.Start(context.Background(), name, trace.WithAttributes(attrs...))
+	t.root = &Span{span: span, ctx: ctx, tracer: t}
+	activeMu.Lock()
+	active = t
+	activeMu.Unlock()
+	helpers.OnExit(Shutdown)
+}
+
+// runResource describes tg to the collector. OTEL_SERVICE_NAME and
+// OTEL_RESOURCE_ATTRIBUTES override the defaults.
+func runResource() *resource.Resource {
+	defaults := resource.NewSchemaless(
+		attribute.String("service.name", defaultServiceName),
+		attribute.String("service.version", constants.VERSION_CLI),
+	)
+	fromEnv, err := resource.New(context.Background(), resource.WithFromEnv())
+	if err != nil {
+		return defaults
+	}
+	merged, err := resource.Merge(defaults, fromEnv)
+	if err != nil {
+		return defaults
+	}
+	return merged
+}
+
+// Enabled reports whether a run is being traced.
+func Enabled() bool {
+	return current() != nil
+}
+
+// StartSpan begins a phase of the run, such as a login or a wait loop.
+// Spans started before it finishes are its children. It returns nil when
+// the run is not traced.
+func StartSpan(name string, attrs ...Attribute) *Span {
+	t := current()
+	if t == nil {
+		return nil
+	}
+	span := t.newSpan(name, trace.SpanKindInternal, attrs)
+	t.mu.Lock()
+	t.open = append(t.open, span)
+	t.mu.Unlock()
+	return span
+}
+
+func (t *tracer) newSpan(name string, kind trace.SpanKind, attrs []Attribute) *Span {
+	t.mu.Lock()
+	parent := t.root
+	if len(t.open) > 0 {
+		parent = t.open[len(t.open)-1]
+	}
+	t.mu.Unlock()
+	ctx, span := t.tracer.Start(parent.ctx, name, trace.WithSpanKind(kind), trace.WithAttributes(attrs...))
+	return &Span{span: span, ctx: ctx, tracer: t}
+}
+
+// close removes a finished span from the open phases.
+func (t *tracer) close(s *Span) {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	for i := len(t.open) - 1; i >= 0; i-- {
+		if t.open[i] == s {
+			t.open = append(t.open[:i], t.open[i+1:]...)
+			break
+		}
+	}
+}
+
+// Shutdown ends the root span with the process exit code and exports the
+// run's spans. It is safe to call more than once.
+func Shutdown(code int) {
+	activeMu.Lock()
+	t := active
+	active = nil
+	activeMu.Unlock()
+	if t == nil {
+		return
+	}
+
+	var err error
+	if code != 0 {
+		err = fmt.Errorf("exit status %d", code)
+	}
+	t.root.SetAttributes(Int("process.exit.code", int64(code)))
+	t.mu.Lock()
+	open := append([]*Span(nil), t.open...)
+	t.mu.Unlock()
+	for i := len(open) - 1; i >= 0; i-- {
+		open[i].Finish(err)
+	}
+	t.root.Finish(err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), exportTimeout())
+	defer cancel()
+	if err := t.provider.Shutdown(ctx); err != nil {
+		warnExportFailed(err)
+	}
+}
+
+func warnExportFailed(err error) {
+	fmt.Fprintf(os.Stderr, "Warning: exporting traces failed: %v\n", err)
+}
+
+// Transport wraps base so every request of a traced run gets a client
+// span, and carries the trace to the server in a traceparent header.
+func Transport(base http.RoundTripper) http.RoundTripper {
+	return &transport{base: base}
+}
+
+type transport struct {
+	base http.RoundTripper
+}
+
+func (t *transport) RoundTrip(req *http.Request) (*http.Response, error) {
+	tr := current()
+	if tr == nil {
+		return t.base.RoundTrip(req)
+	}
+	span := tr.newSpan("HTTP "+req.Method, trace.SpanKindClient, []Attribute{
+		String("http.request.method", req.Method),
+		String("url.full", req.URL.String()),
+		String("server.address", req.URL.Hostname()),
+	})
+	req = req.Clone(req.Context())
+	propagation.TraceContext{}.Inject(span.ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := t.base.RoundTrip(req)
+	if err != nil {
+		span.Finish(err)
+		return resp, err
+	}
+	span.SetAttributes(Int("http.response.status_code", int64(resp.StatusCode)))
+	if resp.StatusCode >= 400 {
+		span.Finish(fmt.Errorf("%s", resp.Status))
+	} else {
+		span.Finish(nil)
+	}
+	return resp, err
+}
@@ -0,0 +1,284 @@
+// Package tui holds the interactive terminal components of tg, drawn on
+// stderr so that stdout stays free for a command's output.
+//
+// Components talk to a Terminal rather than to os.Stdin directly, so
+// tests drive them by scripting the keys a user would press.
+package tui
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+// ErrCancelled is returned when the user leaves a component with Esc or
+// Ctrl+C.
+var ErrCancelled = errors.New("cancelled")
+
+// maxRows is how many items a selector shows at once; the list scrolls
+// with the cursor.
+const maxRows = 10
+
+// Terminal is what the components need from a terminal: raw key input
+// and a screen to draw on.
+type Terminal interface {
+	io.Reader
+	io.Writer
+	// MakeRaw switches to raw mode, so keys arrive one by one and are not
+	// echoed, and returns a function that restores the previous mode.
+	MakeRaw() (restore func(), err error)
+}
+
+// stdTerminal reads keys from stdin and draws on stderr.
+type stdTerminal struct{}
+
+func (stdTerminal) Read(p []byte) (int, error)  { return os.Stdin.Read(p) }
+func (stdTerminal) Write(p []byte) (int, error) { return os.Stderr.Write(p) }
+
+func (stdTerminal) MakeRaw() (func(), error) {
+	fd := int(os.Stdin.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return nil, err
+	}
+	return func() { term.Restore(fd, state) }, nil
+}
+
+// Open returns the terminal the process runs in, or false when stdin or
+// stderr is not one, e.g. in a script or a pipeline. Tests replace it.
+var Open = func() (Terminal, bool) {
+	if !term.IsTerminal(int(os.Stdin.Fd())) || !term.IsTerminal(int(os.Stderr.Fd())) {
+		return nil, false
+	}
+	return stdTerminal{}, true
+}
+
+// Keys the selector understands.
+type key int
+
+const (
+	keyRune key = iota
+	keyUp
+	keyDown
+	keySpace
+	keyBackspace
+	keyEnter
+	keyCancel
+	keyOther
+)
+
+// readKey decodes the next key from r. Arrow keys arrive as escape
+// sequences; an Esc with nothing buffered after it is Esc itself.
+func readKey(r *bufio.Reader) (key, rune, error) {
+	c, _, err := r.ReadRune()
+	if err != nil {
+		return keyOther, 0, err
+	}
+	switch c {
+	case '\r', '\n':
+		return keyEnter, 0, nil
+	case ' ':
+		return keySpace, 0, nil
+	case 0x7f, 0x08:
+		return keyBackspace, 0, nil
+	case 0x03, 0x04:
+		return keyCancel, 0, nil
+	case 0x10: // Ctrl+P
+		return keyUp, 0, nil
+	case 0x0e: // Ctrl+N
+		return keyDown, 0, nil
+	case 0x1b:
+		if r.Buffered() == 0 {
+			return keyCancel, 0, nil
+		}
+		next, _, _ := r.ReadRune()
+		if next != '[' && next != 'O' {
+			return keyOther, 0, nil
+		}
+		final, _, _ := r.ReadRune()
+		switch final {
+		case 'A':
+			return keyUp, 0, nil
+		case 'B':
+			return keyDown, 0, nil
+		}
+		// Skip the rest of longer sequences such as Delete (ESC [ 3 ~).
+		for final >= '0' && final <= '9' || final == ';' {
+			final, _, _ = r.ReadRune()
+		}
+		return keyOther, 0, nil
+	}
+	if c < ' ' {
+		return keyOther, 0, nil
+	}
+	return keyRune, c, nil
+}
+
+// selector is the state of a Select on screen.
+type selector struct {
+	title    string
+	items    []string
+	multi    bool
+	filter   string
+	visible  []int // indices into items matching the filter
+	cursor   int   // position in visible
+	offset   int   // first row of visible shown
+	selected map[int]bool
+	drawn    int // lines drawn by the last frame
+}
+
+func (s *selector) applyFilter() {
+	s.visible = s.visible[:0]
+	needle := strings.ToLower(s.filter)
+	for i, item := range s.items {
+		if strings.Contains(strings.ToLower(item), needle) {
+			s.visible = append(s.visible, i)
+		}
+	}
+	s.cursor = min(s.cursor, max(len(s.visible)-1, 0))
+	s.scroll()
+}
+
+// scroll keeps the cursor within the rows shown.
+func (s *selector) scroll() {
+	if s.cursor < s.offset {
+		s.offset = s.cursor
+	}
+	if s.cursor >= s.offset+maxRows {
+		s.offset = s.cursor - maxRows + 1
+	}
+	s.offset = max(0, min(s.offset, len(s.visible)-maxRows))
+}
+
+// frame renders the selector. Lines end in \r\n since raw mode does not
+// return the carriage.
+func (s *selector) frame() []string {
+	help := "↑/↓ move, type to filter, enter picks, esc cancels"
+	if s.multi {
+		help = "↑/↓ move, space toggles, type to filter, enter confirms, esc cancels"
+	}
+	lines := []string{s.title + " (" + help + ")"}
+	if s.filter != "" {
+		lines = append(lines, "Filter: "+s.filter)
+	}
+	if len(s.visible) == 0 {
+		lines = append(lines, "  (no match)")
+	}
+	for row := s.offset; row < len(s.visible) && row < s.offset+maxRows; row++ {
+		pointer := "  "
+		if row == s.cursor {
+			pointer = "> "
+		}
+		box := ""
+		if s.multi {
+			box = "[ ] "
+			if s.selected[s.visible[row]] {
+				box = "[x] "
+			}
+		}
+		lines = append(lines, pointer+box+s.items[s.visible[row]])
+	}
+	if len(s.visible) > maxRows {
+		lines = append(lines, fmt.Sprintf("  (%d of %d shown; scroll or filter)", maxRows, len(s.visible)))
+	}
+	if s.multi {
+		lines = append(lines, fmt.Sprintf("%d selected", len(s.selected)))
+	}
+	return lines
+}
+
+// draw replaces the previous frame with the current one.
+func (s *selector) draw(w io.Writer) {
+	var b strings.Builder
+	s.clear(&b)
+	lines := s.frame()
+	b.WriteString(strings.Join(lines, "\r\n") + "\r\n")
+	s.drawn = len(lines)
+	io.WriteString(w, b.String())
+}
+
+// clear moves back to the first line of the previous frame and erases it.
+func (s *selector) clear(b *strings.Builder) {
+	if s.drawn > 0 {
+		fmt.Fprintf(b, "\x1b[%dA\r\x1b[J", s.drawn)
+	}
+}
+
+// Select shows items on t and lets the user pick from them, returning the
+// indices picked in the order of items. With multi, space toggles items
+// and enter confirms, which may leave nothing picked; otherwise enter
+// picks the item under the cursor. Typing filters the items shown,
+// ignoring case. Esc or Ctrl+C returns ErrCancelled.
+func Select(t Terminal, title string, items []string, multi bool) ([]int, error) {
+	restore, err := t.MakeRaw()
+	if err != nil {
+		return nil, err
+	}
+	defer restore()
+
+	s := &selector{title: title, items: items, multi: multi, selected: make(map[int]bool)}
+	s.applyFilter()
+	r := bufio.NewReader(t)
+	defer func() {
+		var b strings.Builder
+		s.clear(&b)
+		io.WriteString(t, b.String())
+	}()
+	for {
+		s.draw(t)
+		k, c, err := readKey(r)
+		if err != nil {
+			if err == io.EOF {
+				return nil, ErrCancelled
+			}
+			return nil, err
+		}
+		switch k {
+		case keyUp:
+			s.cursor = max(s.cursor-1, 0)
+			s.scroll()
+		case keyDown:
+			s.cursor = min(s.cursor+1, max(len(s.visible)-1, 0))
+			s.scroll()
+		case keySpace:
+			if s.multi && len(s.visible) > 0 {
+				item := s.visible[s.cursor]
+				if s.selected[item] {
+					delete(s.selected, item)
+				} else {
+					s.selected[item] = true
+				}
+			}
+		case keyRune:
+			s.filter += string(c)
+			s.applyFilter()
+		case keyBackspace:
+			if s.filter != "" {
+				runes := []rune(s.filter)
+				s.filter = string(runes[:len(runes)-1])
+				s.applyFilter()
+			}
+		case keyCancel:
+			return nil, ErrCancelled
+		case keyEnter:
+			if !s.multi {
+				if len(s.visible) == 0 {
+					continue
+				}
+				return []int{s.visible[s.cursor]}, nil
+			}
+			picked := []int{}
+			for i := range items {
+				if s.selected[i] {
+					picked = append(picked, i)
+				}
+			}
+			return picked, nil
+		}
+	}
+}
@@ -0,0 +1,146 @@
+package tui
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Keys as a terminal in raw mode sends them.
+const (
+	up        = "\x1b[A"
+	down      = "\x1b[B"
+	backspace = "\x7f"
+	enter     = "\r"
+	esc       = "\x1b"
+	ctrlC     = "\x03"
+)
+
+// fakeTerminal plays scripted keys and records what is drawn.
+type fakeTerminal struct {
+	keys     *strings.Reader
+	screen   bytes.Buffer
+	raw      bool
+	restored bool
+}
+
+func newFakeTerminal(keys ...string) *fakeTerminal {
+	return &fakeTerminal{keys: strings.NewReader(strings.Join(keys, ""))}
+}
+
+func (t *fakeTerminal) Read(p []byte) (int, error)  { return t.keys.Read(p) }
+func (t *fakeTerminal) Write(p []byte) (int, error) { return t.screen.Write(p) }
+
+func (t *fakeTerminal) MakeRaw() (func(), error) {
+	t.raw = true
+	return func() { t.restored = true }, nil
+}
+
+var machines = []string{"production  enterprise  ready", "staging     starter     ready", "prod-eu     enterprise  ready", "analytics   free        ready"}
+
+func TestSelectMulti(t *testing.T) {
+	tests := []struct {
+		name     string
+		keys     []string
+		expected []int
+	}{
+		{"toggle two", []string{" ", down, down, " ", enter}, []int{0, 2}},
+		{"toggle off again", []string{" ", down, " ", up, " ", enter}, []int{1}},
+		{"filter then toggle", []string{"prod", down, " ", enter}, []int{2}},
+		{"filter ignores case", []string{"ANALYTICS", " ", enter}, []int{3}},
+		{"backspace widens the filter", []string{"prod-x", backspace, backspace, down, " ", enter}, []int{2}},
+		{"selection survives filtering", []string{" ", "stag", " ", backspace, backspace, backspace, backspace, enter}, []int{0, 1}},
+		{"cursor stops at the ends", []string{up, up, " ", down, down, down, down, down, " ", enter}, []int{0, 3}},
+		{"nothing picked", []string{enter}, []int{}},
+		{"arrows in application mode", []string{"\x1bOB", " ", enter}, []int{1}},
+		{"other escape sequences are ignored", []string{"\x1b[3~", " ", enter}, []int{0}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			terminal := newFakeTerminal(tt.keys...)
+			picked, err := Select(terminal, "Select the instances to stop", machines, true)
+			if err != nil {
+				t.Fatalf("Select failed: %v", err)
+			}
+			if !reflect.DeepEqual(picked, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, picked)
+			}
+			if !terminal.raw || !terminal.restored {
+				t.Error("Expected the terminal to be put in raw mode and restored")
+			}
+		})
+	}
+}
+
+func TestSelectSingle(t *testing.T) {
+	picked, err := Select(newFakeTerminal(down, " ", down, enter), "Pick an alias", machines, false)
+	if err != nil || !reflect.DeepEqual(picked, []int{2}) {
+		t.Errorf("Expected the item under the cursor, got %v (%v)", picked, err)
+	}
+	// Enter does nothing while the filter matches nothing.
+	picked, err = Select(newFakeTerminal("zzz", enter, backspace, backspace, backspace, enter), "Pick an alias", machines, false)
+	if err != nil || !reflect.DeepEqual(picked, []int{0}) {
+		t.Errorf("Expected the first item, got %v (%v)", picked, err)
+	}
+}
+
+func TestSelectCancel(t *testing.T) {
+	for name, keys := range map[string][]string{"esc": {" ", esc}, "ctrl+c": {" ", ctrlC}, "end of input": {" "}} {
+		terminal := newFakeTerminal(keys...)
+		if _, err := Select(terminal, "Select", machines, true); !errors.Is(err, ErrCancelled) {
+			t.Errorf("%s: expected ErrCancelled, got %v", name, err)
+		}
+		if !terminal.restored {
+			t.Errorf("%s: expected the terminal to be restored", name)
+		}
+	}
+}
+
+func TestSelectFrame(t *testing.T) {
+	terminal := newFakeTerminal("prod", " ", enter)
+	Select(terminal, "Select the instances to stop", machines, true)
+	screen := terminal.screen.String()
+	for _, expected := range []string{
+		"Select the instances to stop (↑/↓ move, space toggles",
+		"Filter: prod\r\n> [x] production  enterprise  ready\r\n  [ ] prod-eu     enterprise  ready\r\n1 selected\r\n",
+	} {
+		if !strings.Contains(screen, expected) {
+			t.Errorf("Expected the screen to show %q:\n%q", expected, screen)
+		}
+	}
+	// Each frame replaces the previous one, and the last is erased.
+	if !strings.HasSuffix(screen, "\x1b[5A\r\x1b[J") {
+		t.Errorf("Expected the selector to be erased at the end:\n%q", screen)
+	}
+}
+
+func TestSelectScrolls(t *testing.T) {
+	var items []string
+	for i := 1; i <= 15; i++ {
+		items = append(items, fmt.Sprintf("machine-%02d", i))
+	}
+	keys := []string{strings.Repeat(down, 12), " "}
+	s := &selector{items: items, multi: true, selected: make(map[int]bool)}
+	s.applyFilter()
+	r := bufio.NewReader(strings.NewReader(strings.Join(keys, "")))
+	for i := 0; i < 12; i++ {
+		if k, _, _ := readKey(r); k != keyDown {
+			t.Fatalf("Expected down, got %v", k)
+		}
+		s.cursor = min(s.cursor+1, len(s.visible)-1)
+		s.scroll()
+	}
+	frame := strings.Join(s.frame(), "\n")
+	if strings.Contains(frame, "machine-02") || !strings.Contains(frame, "> [ ] machine-13") || !strings.Contains(frame, "(10 of 15 shown; scroll or filter)") {
+		t.Errorf("Expected rows 4 to 13 with the cursor on 13:\n%s", frame)
+	}
+
+	picked, _ := Select(newFakeTerminal(append(keys, enter)...), "Select", items, true)
+	if !reflect.DeepEqual(picked, []int{12}) {
+		t.Errorf("Expected machine-13, got %v", picked)
+	}
+}
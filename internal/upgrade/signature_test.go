@@ -0,0 +1,130 @@
+package upgrade
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// testKey is a fixture signing key; seed and id make it deterministic.
+type testKey struct {
+	id   [8]byte
+	priv ed25519.PrivateKey
+}
+
+func newTestKey(seed byte, id uint64) testKey {
+	var key testKey
+	binary.LittleEndian.PutUint64(key.id[:], id)
+	key.priv = ed25519.NewKeyFromSeed(bytes.Repeat([]byte{seed}, ed25519.SeedSize))
+	return key
+}
+
+// pubFile renders the key as a minisign .pub file.
+func (k testKey) pubFile() string {
+	raw := append(append([]byte("Ed"), k.id[:]...), k.priv.Public().(ed25519.PublicKey)...)
+	return fmt.Sprintf("untrusted comment: minisign public key %016X\n%s\n", binary.LittleEndian.Uint64(k.id[:]), base64.StdEncoding.EncodeToString(raw))
+}
+
+func (k testKey) encoded() string {
+	return strings.Split(k.pubFile(), "\n")[1]
+}
+
+// sign produces what "minisign -S -l" writes for message.
+func (k testKey) sign(message []byte, comment string) []byte {
+	sig := ed25519.Sign(k.priv, message)
+	raw := append(append([]byte("Ed"), k.id[:]...), sig...)
+	global := ed25519.Sign(k.priv, append(append([]byte(nil), sig...), comment...))
+	return []byte(fmt.Sprintf("untrusted comment: signature from minisign secret key\n%s\ntrusted comment: %s\n%s\n",
+		base64.StdEncoding.EncodeToString(raw), comment, base64.StdEncoding.EncodeToString(global)))
+}
+
+func mustKeyring(t *testing.T, keys ...testKey) Keyring {
+	t.Helper()
+	var encoded []string
+	for _, key := range keys {
+		encoded = append(encoded, key.encoded())
+	}
+	keyring, err := ParseKeyring(strings.Join(encoded, ","))
+	if err != nil {
+		t.Fatalf("ParseKeyring: %v", err)
+	}
+	return keyring
+}
+
+func TestParsePublicKey(t *testing.T) {
+	key := newTestKey(1, 0x1122334455667788)
+	for _, text := range []string{key.pubFile(), key.encoded()} {
+		parsed, err := ParsePublicKey(text)
+		if err != nil || parsed.KeyID() != "1122334455667788" {
+			t.Errorf("ParsePublicKey = %v (%v)", parsed.KeyID(), err)
+		}
+	}
+	for _, bad := range []string{"", "not base64!", base64.StdEncoding.EncodeToString([]byte("Ed short"))} {
+		if _, err := ParsePublicKey(bad); err == nil {
+			t.Errorf("Expected %q to be rejected", bad)
+		}
+	}
+	if keyring, err := ParseKeyring(""); err != nil || len(keyring) != 0 {
+		t.Errorf("Expected an empty keyring, got %v (%v)", keyring, err)
+	}
+}
+
+func TestKeyringVerify(t *testing.T) {
+	key, other := newTestKey(1, 1), newTestKey(2, 2)
+	keyring := mustKeyring(t, key)
+	checksums := []byte("abc123  tg-v0.2.0-linux-amd64.tar.gz\n")
+	signature := key.sign(checksums, "timestamp:1700000000\tfile:checksums.txt")
+
+	if err := keyring.Verify(checksums, signature); err != nil {
+		t.Fatalf("Expected a valid signature, got %v", err)
+	}
+
+	tamperedComment := bytes.Replace(signature, []byte("timestamp:1700000000"), []byte("timestamp:1800000000"), 1)
+	prehashed := key.sign(checksums, "c")
+	lines := strings.Split(string(prehashed), "\n")
+	raw, _ := base64.StdEncoding.DecodeString(lines[1])
+	raw[1] = 'D'
+	lines[1] = base64.StdEncoding.EncodeToString(raw)
+
+	for name, tt := range map[string]struct {
+		message, signature []byte
+		errText            string
+	}{
+		"tampered checksums": {[]byte("evil00  tg-v0.2.0-linux-amd64.tar.gz\n"), signature, "does not match the signed file"},
+		"tampered comment":   {checksums, tamperedComment, "trusted comment signature"},
+		"untrusted key":      {checksums, other.sign(checksums, "c"), "not trusted"},
+		"prehashed":          {checksums, []byte(strings.Join(lines, "\n")), "minisign -S -l"},
+		"garbage":            {checksums, []byte("not a signature"), "invalid minisign signature"},
+	} {
+		if err := keyring.Verify(tt.message, tt.signature); err == nil || !strings.Contains(err.Error(), tt.errText) {
+			t.Errorf("%s: expected an error containing %q, got %v", name, tt.errText, err)
+		}
+	}
+}
+
+func TestKeyringEndorse(t *testing.T) {
+	oldKey, newKey, rogue := newTestKey(1, 1), newTestKey(2, 2), newTestKey(3, 3)
+	keyring := mustKeyring(t, oldKey)
+
+	pub := []byte(newKey.pubFile())
+	rotated, err := keyring.Endorse(pub, oldKey.sign(pub, "endorse"))
+	if err != nil || len(rotated) != 2 || len(keyring) != 1 {
+		t.Fatalf("Endorse = %d keys (%v); original has %d", len(rotated), err, len(keyring))
+	}
+	checksums := []byte("abc  tg\n")
+	if err := rotated.Verify(checksums, newKey.sign(checksums, "c")); err != nil {
+		t.Errorf("Expected the endorsed key to be trusted, got %v", err)
+	}
+
+	if _, err := keyring.Endorse(pub, rogue.sign(pub, "endorse")); err == nil || !strings.Contains(err.Error(), "not trusted") {
+		t.Errorf("Expected an endorsement by an unknown key to fail, got %v", err)
+	}
+	swapped := []byte(rogue.pubFile())
+	if _, err := keyring.Endorse(swapped, oldKey.sign(pub, "endorse")); err == nil {
+		t.Error("Expected an endorsement over a different key to fail")
+	}
+}
@@ -0,0 +1,382 @@
+// Package upgrade replaces the running tg binary with a release from
+// GitHub. The release's checksums file must carry a valid signature from a
+// key embedded in the binary before any artifact listed in it is trusted.
+package upgrade
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/download"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+	"golang.org/x/term"
+)
+
+const (
+	checksumsAsset  = "checksums.txt"
+	signatureSuffix = ".minisig"
+	// signingKeyAsset is the new public key a release ships when the
+	// signing key is rotated, signed by the previous key.
+	signingKeyAsset = "signing-key.pub"
+)
+
+// Releases come from GitHub; tests point these at a local server.
+var (
+	releaseAPI      = "https://api.github.com/repos/zrougamed/tgCli/releases"
+	releaseDownload = "https://github.com/zrougamed/tgCli/releases/download"
+	executablePath  = os.Executable
+	// confirmInput is where the --skip-signature confirmation is read from.
+	confirmInput io.Reader = os.Stdin
+	// interactive reports whether a person can answer the confirmation.
+	interactive = func() bool { return term.IsTerminal(int(os.Stdin.Fd())) }
+	// showProgress reports whether the download is drawn as a progress bar.
+	showProgress = func() bool { return term.IsTerminal(int(os.Stdout.Fd())) }
+)
+
+var errSignature = errors.New("refusing to install")
+
+// errCancelled is returned when the --skip-signature confirmation is
+// declined.
+var errCancelled = errors.New("upgrade cancelled")
+
+// options is what RunUpgrade reads from its flags.
+type options struct {
+	Version       string
+	SkipSignature bool
+	Restart       bool
+	Keys          string
+	GOOS, GOARCH  string
+}
+
+func RunUpgrade(cmd *cobra.Command, args []string) {
+	version, _ := cmd.Flags().GetString("version")
+	skipSignature, _ := cmd.Flags().GetBool("skip-signature")
+	restart, _ := cmd.Flags().GetBool("restart")
+
+	err := upgrade(options{
+		Version:       version,
+		SkipSignature: skipSignature,
+		Restart:       restart,
+		Keys:          constants.RELEASE_SIGNING_KEYS,
+		GOOS:          runtime.GOOS,
+		GOARCH:        runtime.GOARCH,
+	})
+	if errors.Is(err, errCancelled) {
+		fmt.Fprintln(os.Stderr, "Upgrade cancelled")
+		helpers.Fail(helpers.ExitCancelled)
+		return
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Error: %v\n", err)
+		helpers.Fail(helpers.ExitFailure)
+		return
+	}
+}
+
+func upgrade(opts options) error {
+	client := helpers.NewHTTPClient(60 * time.Second)
+
+	tag := opts.Version
+	if tag == "" {
+		latest, err := latestTag(client)
+		if err != nil {
+			return err
+		}
+		if helpers.CompareVersions(latest, constants.VERSION_CLI) <= 0 {
+			fmt.Fprintf(helpers.Stdout(), "tg %s is up to date (latest release: %s)\n", constants.VERSION_CLI, latest)
+			return nil
+		}
+		tag = latest
+	}
+	if !strings.HasPrefix(tag, "v") {
+		tag = "v" + tag
+	}
+
+	base := releaseDownload + "/" + tag + "/"
+	checksums, err := fetch(client, base+checksumsAsset)
+	if err != nil {
+		return err
+	}
+	if err := checkSignature(client, base, checksums, opts); err != nil {
+		return err
+	}
+
+	asset := assetName(tag, opts.GOOS, opts.GOARCH)
+	digest, err := checksumFor(checksums, asset)
+	if err != nil {
+		return err
+	}
+
+	dir := filepath.Join(constants.ConfigDir, "upgrade")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	archive := filepath.Join(dir, asset)
+	if _, err := os.Stat(download.PartialPath(archive)); err == nil && !opts.Restart {
+		fmt.Fprintf(helpers.Stdout(), "Resuming the download of %s\n", asset)
+	} else {
+		fmt.Fprintf(helpers.Stdout(), "Downloading %s\n", asset)
+	}
+	downloadOpts := download.Options{Client: client, Digest: digest, Restart: opts.Restart}
+	var bar *helpers.ProgressBar
+	if showProgress() {
+		bar = helpers.NewProgressBar(os.Stdout)
+		downloadOpts.Progress = func(done, total int64) {
+			if total > 0 {
+				bar.Update(int(done*100/total), fmt.Sprintf("(%s/%s)", formatMB(done), formatMB(total)))
+			}
+		}
+	}
+	err = download.File(base+asset, archive, downloadOpts)
+	if bar != nil {
+		bar.Finish()
+	}
+	if err != nil {
+		return fmt.Errorf("downloading %s: %v", asset, err)
+	}
+	defer os.Remove(archive)
+
+	exe, err := executablePath()
+	if err != nil {
+		return err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return err
+	}
+	staged := exe + ".new"
+	if err := extractBinary(archive, staged); err != nil {
+		os.Remove(staged)
+		return fmt.Errorf("extracting %s: %v", asset, err)
+	}
+	if err := replaceExecutable(staged, exe); err != nil {
+		os.Remove(staged)
+		return err
+	}
+	fmt.Fprintf(helpers.Stdout(), "Upgraded tg %s to %s\n", constants.VERSION_CLI, strings.TrimPrefix(tag, "v"))
+	return nil
+}
+
+// formatMB formats a byte count for the progress bar.
+func formatMB(n int64) string {
+	return fmt.Sprintf("%.1fMB", float64(n)/(1<<20))
+}
+
+// checkSignature verifies the signature over the checksums file, or with
+// --skip-signature asks for explicit confirmation instead.
+func checkSignature(client *http.Client, base string, checksums []byte, opts options) error {
+	if opts.SkipSignature {
+		return confirmSkipSignature()
+	}
+
+	keyring, err := ParseKeyring(opts.Keys)
+	if err != nil {
+		return fmt.Errorf("embedded release key: %v", err)
+	}
+	if len(keyring) == 0 {
+		return fmt.Errorf("%w: this build has no release signing key, so the download cannot be verified; "+
+			"install a release build or use --skip-signature", errSignature)
+	}
+	signature, err := fetch(client, base+checksumsAsset+signatureSuffix)
+	if err != nil {
+		return fmt.Errorf("%w: the release has no checksums signature (%v)", errSignature, err)
+	}
+
+	err = verifyChecksums(keyring, checksums, signature, func() ([]byte, []byte, error) {
+		pub, err := fetch(client, base+signingKeyAsset)
+		if err != nil {
+			return nil, nil, err
+		}
+		sig, err := fetch(client, base+signingKeyAsset+signatureSuffix)
+		return pub, sig, err
+	})
+	if err != nil {
+		return fmt.Errorf("%w: signature verification failed: %v. "+
+			"The release may have been tampered with; please report it at https://github.com/zrougamed/tgCli/issues", errSignature, err)
+	}
+	fmt.Fprintln(helpers.Stdout(), "Release signature verified")
+	return nil
+}
+
+// verifyChecksums checks signature over checksums. When the release was
+// signed with a key the keyring does not hold, the key endorsement the
+// release ships is fetched and, if a trusted key signed it, the new key is
+// trusted for this release.
+func verifyChecksums(keyring Keyring, checksums, signature []byte, fetchEndorsement func() (pub, sig []byte, err error)) error {
+	sig, err := ParseSignature(signature)
+	if err != nil {
+		return err
+	}
+	if _, ok := keyring.find(sig.KeyID); !ok {
+		pub, endorsement, err := fetchEndorsement()
+		if err != nil {
+			return fmt.Errorf("signed with key %s, which is not trusted, and no key endorsement was found (%v)", formatKeyID(sig.KeyID), err)
+		}
+		if keyring, err = keyring.Endorse(pub, endorsement); err != nil {
+			return err
+		}
+	}
+	return keyring.Verify(checksums, signature)
+}
+
+// confirmSkipSignature asks on stderr before installing an unverified
+// binary, returning errCancelled when the answer is no. It never succeeds
+// without a person at the terminal.
+func confirmSkipSignature() error {
+	if !interactive() {
+		return fmt.Errorf("%w: --skip-signature needs confirmation at an interactive terminal", errSignature)
+	}
+	fmt.Fprintln(os.Stderr, "WARNING: the release signature will not be checked. Checksums alone do not protect against a compromised release.")
+	fmt.Fprint(os.Stderr, "Install without verifying the signature? (y/n) [n] ")
+	answer, _ := bufio.NewReader(confirmInput).ReadString('\n')
+	if ok, _ := helpers.ParseYesNo(answer); !ok {
+		return errCancelled
+	}
+	return nil
+}
+
+// latestTag returns the tag of the latest release.
+func latestTag(client *http.Client) (string, error) {
+	data, err := fetch(client, releaseAPI+"/latest")
+	if err != nil {
+		return "", fmt.Errorf("looking up the latest release: %v", err)
+	}
+	var release struct {
+		TagName string `json:"tag_name"`
+	}
+	if err := json.Unmarshal(data, &release); err != nil || release.TagName == "" {
+		return "", fmt.Errorf("looking up the latest release: unexpected response")
+	}
+	return release.TagName, nil
+}
+
+func fetch(client *http.Client, url string) ([]byte, error) {
+	resp, err := client.Get(url)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("GET %s: status %d", url, resp.StatusCode)
+	}
+	return io.ReadAll(resp.Body)
+}
+
+// assetName is the archive the release workflow builds for a platform.
+func assetName(tag, goos, goarch string) string {
+	ext := ".tar.gz"
+	if goos == "windows" {
+		ext = ".zip"
+	}
+	return fmt.Sprintf("tg-%s-%s-%s%s", tag, goos, goarch, ext)
+}
+
+// checksumFor finds name in a sha256sum listing.
+func checksumFor(checksums []byte, name string) (string, error) {
+	for _, line := range strings.Split(string(checksums), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == name {
+			return "sha256:" + fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("%s is not listed in %s; this release may not support your platform", name, checksumsAsset)
+}
+
+// extractBinary writes the tg binary in archive to dest.
+func extractBinary(archive, dest string) error {
+	if strings.HasSuffix(archive, ".zip") {
+		return extractZip(archive, dest)
+	}
+	file, err := os.Open(archive)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tr := tar.NewReader(gz)
+	for {
+		header, err := tr.Next()
+		if err == io.EOF {
+			return fmt.Errorf("no tg binary in the archive")
+		}
+		if err != nil {
+			return err
+		}
+		if header.Typeflag == tar.TypeReg && isBinary(header.Name) {
+			return writeBinary(tr, dest)
+		}
+	}
+}
+
+func extractZip(archive, dest string) error {
+	reader, err := zip.OpenReader(archive)
+	if err != nil {
+		return err
+	}
+	defer reader.Close()
+	for _, entry := range reader.File {
+		if entry.Mode().IsRegular() && isBinary(entry.Name) {
+			rc, err := entry.Open()
+			if err != nil {
+				return err
+			}
+			defer rc.Close()
+			return writeBinary(rc, dest)
+		}
+	}
+	return fmt.Errorf("no tg binary in the archive")
+}
+
+// isBinary reports whether an archive entry is the tg binary, named
+// tg-<tag>-<platform> by the release workflow.
+func isBinary(name string) bool {
+	base := filepath.Base(name)
+	return base == "tg" || base == "tg.exe" || strings.HasPrefix(base, "tg-")
+}
+
+func writeBinary(r io.Reader, dest string) error {
+	file, err := os.OpenFile(dest, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, 0755)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(file, r); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// replaceExecutable moves staged over exe. The old binary is moved aside
+// first, since Windows cannot overwrite a running executable, and put back
+// if the swap fails.
+func replaceExecutable(staged, exe string) error {
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return fmt.Errorf("replacing %s: %v", exe, err)
+	}
+	if err := os.Rename(staged, exe); err != nil {
+		os.Rename(old, exe)
+		return fmt.Errorf("replacing %s: %v", exe, err)
+	}
+	// A running Windows binary cannot be removed; it is cleaned up on the
+	// next upgrade instead.
+	os.Remove(old)
+	return nil
+}
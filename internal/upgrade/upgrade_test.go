@@ -0,0 +1,333 @@
+package upgrade
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/spf13/cobra"
+	"github.com/zrougamed/tgCli/internal/download"
+	"github.com/zrougamed/tgCli/internal/helpers"
+	"github.com/zrougamed/tgCli/pkg/constants"
+)
+
+// fakeRelease serves a release the way GitHub does; files maps asset
+// names to their contents.
+type fakeRelease struct {
+	tag   string
+	files map[string][]byte
+	// ranges records the Range header of each ranged request.
+	ranges []string
+}
+
+func (r *fakeRelease) serve(t *testing.T) {
+	t.Helper()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/api/latest" {
+			fmt.Fprintf(w, `{"tag_name": %q}`, r.tag)
+			return
+		}
+		data, ok := r.files[strings.TrimPrefix(req.URL.Path, "/download/"+r.tag+"/")]
+		if !ok {
+			http.NotFound(w, req)
+			return
+		}
+		if byteRange := req.Header.Get("Range"); byteRange != "" {
+			r.ranges = append(r.ranges, byteRange)
+		}
+		http.ServeContent(w, req, "", time.Time{}, bytes.NewReader(data))
+	}))
+	t.Cleanup(server.Close)
+
+	originalAPI, originalDownload, originalExe := releaseAPI, releaseDownload, executablePath
+	originalInput, originalInteractive, originalDir := confirmInput, interactive, constants.ConfigDir
+	originalProgress := showProgress
+	releaseAPI, releaseDownload = server.URL+"/api", server.URL+"/download"
+	constants.ConfigDir = t.TempDir()
+	showProgress = func() bool { return false }
+	t.Cleanup(func() {
+		releaseAPI, releaseDownload, executablePath = originalAPI, originalDownload, originalExe
+		confirmInput, interactive, constants.ConfigDir = originalInput, originalInteractive, originalDir
+		showProgress = originalProgress
+	})
+}
+
+// newFakeRelease builds a signed release holding a linux/amd64 archive.
+func newFakeRelease(t *testing.T, key testKey) *fakeRelease {
+	t.Helper()
+	tag := "v99.0.0"
+	asset := assetName(tag, "linux", "amd64")
+
+	var archive bytes.Buffer
+	gz := gzip.NewWriter(&archive)
+	tw := tar.NewWriter(gz)
+	binary := []byte("new binary")
+	tw.WriteHeader(&tar.Header{Name: "tg-" + tag + "-linux-amd64", Mode: 0755, Size: int64(len(binary)), Typeflag: tar.TypeReg})
+	tw.Write(binary)
+	tw.Close()
+	gz.Close()
+
+	sum := sha256.Sum256(archive.Bytes())
+	checksums := []byte(hex.EncodeToString(sum[:]) + "  " + asset + "\n")
+	return &fakeRelease{tag: tag, files: map[string][]byte{
+		asset:                       archive.Bytes(),
+		checksumsAsset:              checksums,
+		checksumsAsset + ".minisig": key.sign(checksums, "file:checksums.txt"),
+	}}
+}
+
+// installedBinary points the upgrade at a fake executable.
+func installedBinary(t *testing.T) string {
+	t.Helper()
+	exe := filepath.Join(t.TempDir(), "tg")
+	if err := os.WriteFile(exe, []byte("old binary"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	executablePath = func() (string, error) { return exe, nil }
+	return exe
+}
+
+func runUpgrade(t *testing.T, opts options) (string, error) {
+	t.Helper()
+	opts.GOOS, opts.GOARCH = "linux", "amd64"
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	r, w, _ := os.Pipe()
+	os.Stdout, os.Stderr = w, w
+	err := upgrade(opts)
+	w.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	var out bytes.Buffer
+	out.ReadFrom(r)
+	return out.String(), err
+}
+
+func assertBinary(t *testing.T, exe, expected string) {
+	t.Helper()
+	if data, _ := os.ReadFile(exe); string(data) != expected {
+		t.Errorf("Expected the installed binary to be %q, got %q", expected, data)
+	}
+}
+
+func TestUpgradeVerified(t *testing.T) {
+	key := newTestKey(1, 1)
+	release := newFakeRelease(t, key)
+	release.serve(t)
+	exe := installedBinary(t)
+
+	out, err := runUpgrade(t, options{Keys: key.encoded()})
+	if err != nil {
+		t.Fatalf("upgrade: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Release signature verified") || !strings.Contains(out, "Upgraded tg "+constants.VERSION_CLI+" to 99.0.0") {
+		t.Errorf("Unexpected output:\n%s", out)
+	}
+	assertBinary(t, exe, "new binary")
+	if _, err := os.Stat(exe + ".old"); !os.IsNotExist(err) {
+		t.Errorf("Expected the old binary to be removed, got %v", err)
+	}
+}
+
+func TestUpgradeResume(t *testing.T) {
+	key := newTestKey(1, 1)
+	release := newFakeRelease(t, key)
+	release.serve(t)
+	exe := installedBinary(t)
+	asset := assetName(release.tag, "linux", "amd64")
+	archive := filepath.Join(constants.ConfigDir, "upgrade", asset)
+	data := release.files[asset]
+
+	// An earlier run stopped after the first 10 bytes.
+	leaveHalfDownloaded := func(t *testing.T) {
+		t.Helper()
+		os.MkdirAll(filepath.Dir(archive), 0700)
+		os.WriteFile(download.PartialPath(archive), data[:10], 0600)
+		sidecar := fmt.Sprintf(`{"url": %q, "size": %d, "offset": 10}`, releaseDownload+"/"+release.tag+"/"+asset, len(data))
+		os.WriteFile(download.PartialPath(archive)+".json", []byte(sidecar), 0600)
+		release.ranges = nil
+	}
+
+	leaveHalfDownloaded(t)
+	out, err := runUpgrade(t, options{Keys: key.encoded()})
+	if err != nil {
+		t.Fatalf("upgrade: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Resuming the download of "+asset) || !strings.HasPrefix(release.ranges[0], "bytes=10-") {
+		t.Errorf("Expected the download to resume at byte 10, got ranges %q:\n%s", release.ranges, out)
+	}
+	assertBinary(t, exe, "new binary")
+
+	// --restart fetches the whole archive again.
+	leaveHalfDownloaded(t)
+	out, err = runUpgrade(t, options{Keys: key.encoded(), Restart: true})
+	if err != nil {
+		t.Fatalf("upgrade --restart: %v\n%s", err, out)
+	}
+	if !strings.Contains(out, "Downloading "+asset) || !strings.HasPrefix(release.ranges[0], "bytes=0-") {
+		t.Errorf("Expected the download to start over, got ranges %q:\n%s", release.ranges, out)
+	}
+	if _, err := os.Stat(download.PartialPath(archive)); !os.IsNotExist(err) {
+		t.Errorf("Expected the partial download to be gone, got %v", err)
+	}
+}
+
+func TestUpgradeRefusesTampering(t *testing.T) {
+	key, rogue := newTestKey(1, 1), newTestKey(2, 2)
+
+	tests := []struct {
+		name    string
+		tamper  func(r *fakeRelease)
+		keys    string
+		errText string
+	}{
+		{"tampered checksums", func(r *fakeRelease) {
+			r.files[checksumsAsset] = append([]byte("0000  extra\n"), r.files[checksumsAsset]...)
+		}, key.encoded(), "does not match the signed file"},
+		{"missing signature", func(r *fakeRelease) { delete(r.files, checksumsAsset+".minisig") }, key.encoded(), "no checksums signature"},
+		{"signed by another key", func(r *fakeRelease) {
+			r.files[checksumsAsset+".minisig"] = rogue.sign(r.files[checksumsAsset], "c")
+		}, key.encoded(), "no key endorsement was found"},
+		{"no embedded key", func(r *fakeRelease) {}, "", "no release signing key"},
+		{"tampered artifact", func(r *fakeRelease) {
+			asset := assetName(r.tag, "linux", "amd64")
+			r.files[asset] = append(r.files[asset], 0)
+		}, key.encoded(), "checksum mismatch"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			release := newFakeRelease(t, key)
+			tt.tamper(release)
+			release.serve(t)
+			exe := installedBinary(t)
+
+			_, err := runUpgrade(t, options{Keys: tt.keys})
+			if err == nil || !strings.Contains(err.Error(), tt.errText) {
+				t.Errorf("Expected an error containing %q, got %v", tt.errText, err)
+			}
+			assertBinary(t, exe, "old binary")
+		})
+	}
+}
+
+func TestUpgradeKeyRotation(t *testing.T) {
+	oldKey, newKey := newTestKey(1, 1), newTestKey(2, 2)
+	release := newFakeRelease(t, newKey)
+	pub := []byte(newKey.pubFile())
+	release.files[signingKeyAsset] = pub
+	release.files[signingKeyAsset+".minisig"] = oldKey.sign(pub, "endorse")
+	release.serve(t)
+	exe := installedBinary(t)
+
+	if out, err := runUpgrade(t, options{Keys: oldKey.encoded()}); err != nil {
+		t.Fatalf("Expected the endorsed key to be accepted: %v\n%s", err, out)
+	}
+	assertBinary(t, exe, "new binary")
+}
+
+func TestUpgradeSkipSignature(t *testing.T) {
+	release := newFakeRelease(t, newTestKey(1, 1))
+	delete(release.files, checksumsAsset+".minisig")
+	release.serve(t)
+
+	for _, tt := range []struct {
+		name        string
+		interactive bool
+		answer      string
+		installed   bool
+		expected    error
+	}{
+		{"not a terminal", false, "y\n", false, errSignature},
+		{"declined", true, "\n", false, errCancelled},
+		{"confirmed", true, "y\n", true, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			exe := installedBinary(t)
+			interactive = func() bool { return tt.interactive }
+			confirmInput = strings.NewReader(tt.answer)
+
+			_, err := runUpgrade(t, options{SkipSignature: true})
+			if tt.installed {
+				if err != nil {
+					t.Fatalf("upgrade: %v", err)
+				}
+				assertBinary(t, exe, "new binary")
+				return
+			}
+			if !errors.Is(err, tt.expected) {
+				t.Errorf("Expected %v, got %v", tt.expected, err)
+			}
+			assertBinary(t, exe, "old binary")
+		})
+	}
+}
+
+func TestRunUpgradeDeclined(t *testing.T) {
+	release := newFakeRelease(t, newTestKey(1, 1))
+	release.serve(t)
+	exe := installedBinary(t)
+	interactive = func() bool { return true }
+	confirmInput = strings.NewReader("n\n")
+
+	cmd := &cobra.Command{}
+	cmd.Flags().String("version", release.tag, "")
+	cmd.Flags().Bool("skip-signature", true, "")
+	cmd.Flags().Bool("restart", false, "")
+
+	oldStdout, oldStderr := os.Stdout, os.Stderr
+	stdoutR, stdoutW, _ := os.Pipe()
+	stderrR, stderrW, _ := os.Pipe()
+	os.Stdout, os.Stderr = stdoutW, stderrW
+	status := helpers.ExitStatus()
+	RunUpgrade(cmd, nil)
+	stdoutW.Close()
+	stderrW.Close()
+	os.Stdout, os.Stderr = oldStdout, oldStderr
+	var stdout, stderr bytes.Buffer
+	stdout.ReadFrom(stdoutR)
+	stderr.ReadFrom(stderrR)
+
+	if status == 0 && helpers.ExitStatus() != helpers.ExitCancelled {
+		t.Errorf("Expected exit status %d, got %d", helpers.ExitCancelled, helpers.ExitStatus())
+	}
+	if stdout.Len() != 0 {
+		t.Errorf("Expected nothing on stdout, got %q", stdout.String())
+	}
+	if !strings.Contains(stderr.String(), "WARNING: the release signature will not be checked.") ||
+		!strings.HasSuffix(stderr.String(), "Install without verifying the signature? (y/n) [n] Upgrade cancelled\n") {
+		t.Errorf("Expected the warning, prompt and cancellation on stderr, got %q", stderr.String())
+	}
+	assertBinary(t, exe, "old binary")
+}
+
+func TestUpgradeUpToDate(t *testing.T) {
+	release := newFakeRelease(t, newTestKey(1, 1))
+	release.tag = "v" + constants.VERSION_CLI
+	release.serve(t)
+	exe := installedBinary(t)
+
+	out, err := runUpgrade(t, options{})
+	if err != nil || !strings.Contains(out, "is up to date") {
+		t.Errorf("Expected nothing to do, got %q (%v)", out, err)
+	}
+	assertBinary(t, exe, "old binary")
+}
+
+func TestChecksumFor(t *testing.T) {
+	checksums := []byte("aaa  tg-v1.0.0-linux-amd64.tar.gz\nbbb *tg-v1.0.0-windows-amd64.zip\n")
+	if digest, err := checksumFor(checksums, "tg-v1.0.0-windows-amd64.zip"); err != nil || digest != "sha256:bbb" {
+		t.Errorf("checksumFor = %q (%v)", digest, err)
+	}
+	if _, err := checksumFor(checksums, "tg-v1.0.0-plan9-amd64.tar.gz"); err == nil || !strings.Contains(err.Error(), "not listed") {
+		t.Errorf("Expected a missing platform error, got %v", err)
+	}
+}
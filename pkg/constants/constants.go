@@ -1,12 +1,21 @@
 package constants
 
+// TGCLOUD_DEFAULT_BASE_URL is the control plane used when tgcloud.base_url
+// is not configured. Tokens written by older releases were issued by it.
+const TGCLOUD_DEFAULT_BASE_URL = "https://tgcloud.io/api"
+
 var (
-	TGCLOUD_BASE_URL = "https://tgcloud.io/api"
+	TGCLOUD_BASE_URL = TGCLOUD_DEFAULT_BASE_URL
 	TIGERTOOL_URL    = "https://tigertool.tigergraph.com"
+	// RELEASE_SIGNING_KEYS are the minisign public keys, comma separated,
+	// trusted to sign release checksums. Release builds set it with
+	// -ldflags -X; tg upgrade refuses to install without one.
+	RELEASE_SIGNING_KEYS = ""
 )
 
 const (
 	VERSION_CLI      = "0.1.1"
+	CONFIG_VERSION   = 1
 	GSQL_PATH        = "/gsqlserver/gsql/"
 	GSQL_SEPARATOR   = "__GSQL__"
 	GSQL_COOKIES     = "__GSQL__COOKIES__"
@@ -21,5 +30,7 @@ var (
 	ConfigFile       string
 	CredsFile        string
 	Debug            bool
+	JSONPretty       bool
+	Context          string
 	AvailableVersion string
 )